@@ -0,0 +1,70 @@
+package main
+
+import "strings"
+
+// Strict aliasing
+// Nothing in the backend reorders or caches memory accesses by type yet, so
+// every program is compiled with -fno-strict-aliasing semantics (the default,
+// and what game code that puns float/int through pointers expects).
+// -fstrict-aliasing opts in for when type-based alias analysis lands;
+// -Wstrict-aliasing (implied by strict mode) reports casts that would break.
+
+// pointeeType returns the type a pointer type points to
+func pointeeType(typ string) (string, bool) {
+	typ = strings.TrimSpace(typ)
+	if !strings.HasSuffix(typ, "*") {
+		return "", false
+	}
+	return strings.TrimSpace(typ[:len(typ)-1]), true
+}
+
+// normalizeAliasType drops qualifiers and signedness, which don't affect
+// whether two lvalue types may alias
+func normalizeAliasType(typ string) string {
+	var kept []string
+	for _, word := range strings.Fields(strings.ReplaceAll(typ, "*", " * ")) {
+		switch word {
+		case "const", "volatile", "restrict", "signed", "unsigned", "static", "extern":
+			continue
+		}
+		kept = append(kept, word)
+	}
+	if len(kept) == 0 {
+		return "int" // plain "unsigned"
+	}
+	return strings.Join(kept, "")
+}
+
+// aliasCompatible reports whether an object of type from may be accessed
+// through an lvalue of type to
+func aliasCompatible(from, to string) bool {
+	// Character types and void may alias anything
+	if to == "char" || to == "void" || from == "void" {
+		return true
+	}
+	return from == to
+}
+
+// checkAliasingCast warns about pointer casts that break strict aliasing
+func (is *InstructionSelector) checkAliasingCast(fromType, toType string) {
+	if !is.strictAliasing && !is.warnStrictAliasing {
+		return
+	}
+	from, ok := pointeeType(fromType)
+	if !ok {
+		return
+	}
+	to, ok := pointeeType(toType)
+	if !ok {
+		return
+	}
+	// Compare through typedefs (e.g. Vector2* vs struct Vector2*)
+	from = normalizeAliasType(is.resolveType(from))
+	to = normalizeAliasType(is.resolveType(to))
+	if aliasCompatible(from, to) {
+		return
+	}
+	is.warn("-Wstrict-aliasing", is.line, is.column,
+		"in function '%s': cast from '%s' to '%s' breaks strict-aliasing rules",
+		is.currentFunc, fromType, toType)
+}
@@ -0,0 +1,870 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// AArch64 code emitter
+// -target=arm64 emits the same IR as AArch64 GAS for Linux (AAPCS64). The
+// selector already put arguments, parameters and results in the AAPCS64
+// registers (see calling_convention.go); the register allocator still
+// hands out its x86-64 register names, which map onto AArch64 registers
+// that play the same role:
+//
+//	rbx r12 r13 r14 r15  ->  x19-x23   callee-saved
+//	rcx rdx rsi rdi r8 r9 ->  x9-x14    caller-saved, so not live across calls
+//	r10                   ->  x24       callee-saved here, saved like the others
+//
+// Argument registers x0-x7 and x8 are only written right before a call
+// (or a system call), so they never hold an allocated temp. x15, x16 and x17 are the emitter's
+// scratch registers, and x29 is the frame pointer every slot is addressed
+// from. Floating values live in general registers as bit patterns, as on
+// x86-64, and move through d16/d17 to be operated on.
+//
+// There is no red zone, no built-in assembler and no JIT for AArch64: the
+// text is assembled and linked by an AArch64 gcc (see AssembleAndLink).
+
+var arm64Regs = map[string]string{
+	"rbx": "x19", "r12": "x20", "r13": "x21", "r14": "x22", "r15": "x23", "r10": "x24",
+	"rcx": "x9", "rdx": "x10", "rsi": "x11", "rdi": "x12", "r8": "x13", "r9": "x14",
+	"rax": "x0", "r11": "x15",
+}
+
+// arm64CalleeSaved are the callee-saved registers allocated temps can be in,
+// in the order they're saved
+var arm64CalleeSaved = []string{"x19", "x20", "x21", "x22", "x23", "x24"}
+
+// ARM64Emitter writes AArch64 assembly for a program's IR
+type ARM64Emitter struct {
+	text   strings.Builder
+	data   strings.Builder
+	bss    strings.Builder
+	rodata strings.Builder
+
+	instructions []*IRInstruction
+	stringLits   map[string]string
+	globalVars   map[string]*Symbol
+	stringOrder  []string
+	globalOrder  []string
+
+	frames    map[string]*FrameManager // each function's slots (see frame.go)
+	frameSize int                      // bytes of slots below x29
+	saved     []string                 // callee-saved registers the function uses
+
+	sourceLines []string // -emit-asm-annotated
+	lastLine    int
+
+	startStub bool          // -ffreestanding: write a _start that calls main (see freestanding.go)
+	inits     InitFunctions // constructors and destructors (see constructors.go)
+	target    *TargetSpec // Plain char signedness
+}
+
+func NewARM64Emitter(instructions []*IRInstruction, stringLits map[string]string, globalVars map[string]*Symbol) *ARM64Emitter {
+	return &ARM64Emitter{
+		instructions: instructions,
+		stringLits:   stringLits,
+		globalVars:   globalVars,
+		target:       defaultTarget,
+	}
+}
+
+// Emit returns the program as AArch64 GAS text
+func (ae *ARM64Emitter) Emit() string {
+	ae.emitGlobals()
+	for _, line := range ae.inits.arraySections(".balign 8") {
+		fmt.Fprintf(&ae.data, "    %s\n", line)
+	}
+	ae.emitText()
+	ae.emitStrings()
+
+	var sb strings.Builder
+	for _, section := range []*strings.Builder{&ae.rodata, &ae.data, &ae.bss} {
+		if section.Len() > 0 {
+			sb.WriteString(section.String())
+			sb.WriteString("\n")
+		}
+	}
+	sb.WriteString(ae.text.String())
+	if ae.startStub {
+		// Like startStub: argc at [sp], argv after it, envp after argv's NULL
+		sb.WriteString("\n    .text\n    .globl _start\n_start:\n")
+		sb.WriteString("    mov x29, #0\n    mov x30, #0\n")
+		for _, name := range ae.inits.constructorOrder() {
+			fmt.Fprintf(&sb, "    bl %s\n", name)
+		}
+		sb.WriteString("    ldr x0, [sp]\n    add x1, sp, #8\n    add x2, x1, x0, lsl #3\n    add x2, x2, #8\n")
+		sb.WriteString("    bl main\n")
+		if destructors := ae.inits.destructorOrder(); len(destructors) > 0 {
+			sb.WriteString("    mov x19, x0\n")
+			for _, name := range destructors {
+				fmt.Fprintf(&sb, "    bl %s\n", name)
+			}
+			sb.WriteString("    mov x0, x19\n")
+		}
+		fmt.Fprintf(&sb, "    mov x8, #%d\n    svc #0\n", linuxSyscalls["aarch64"]["exit"])
+	}
+	return sb.String()
+}
+
+func (ae *ARM64Emitter) emit(format string, args ...interface{}) {
+	fmt.Fprintf(&ae.text, "    "+format+"\n", args...)
+}
+
+func (ae *ARM64Emitter) emitStrings() {
+	if len(ae.stringLits) == 0 {
+		return
+	}
+	ae.rodata.WriteString("    .section .rodata\n")
+	for _, label := range orderedKeys(ae.stringLits, ae.stringOrder) {
+		fmt.Fprintf(&ae.rodata, "%s:\n", label)
+		fmt.Fprintf(&ae.rodata, "    .string \"%s\"\n", escapeString(ae.stringLits[label]))
+	}
+}
+
+// emitGlobals lays out globals like the x86-64 emitter does, with .balign
+// since .align counts powers of two on AArch64
+func (ae *ARM64Emitter) emitGlobals() {
+	for _, name := range orderedKeys(ae.globalVars, ae.globalOrder) {
+		sym := ae.globalVars[name]
+		if sym.IsExternal {
+			continue
+		}
+		if sym.InitValue != "" || sym.InitData != nil {
+			if ae.data.Len() == 0 {
+				ae.data.WriteString("    .data\n")
+			}
+			if !sym.IsStatic {
+				fmt.Fprintf(&ae.data, "    .globl %s\n", name)
+			}
+			if sym.InitData != nil {
+				fmt.Fprintf(&ae.data, "    .balign %d\n", sym.alignment())
+				fmt.Fprintf(&ae.data, "%s:\n", name)
+				for _, line := range dataDirectives(sym.InitData, sym.InitAddrs) {
+					fmt.Fprintf(&ae.data, "    %s\n", line)
+				}
+				continue
+			}
+			fmt.Fprintf(&ae.data, "    .balign %d\n", max(sym.Size, sym.Align, 1))
+			fmt.Fprintf(&ae.data, "%s:\n", name)
+			fmt.Fprintf(&ae.data, "    %s %s\n", sym.dataDirective(), sym.InitValue)
+			continue
+		}
+		if ae.bss.Len() == 0 {
+			ae.bss.WriteString("    .bss\n")
+		}
+		if sym.IsStatic {
+			fmt.Fprintf(&ae.bss, "    .local %s\n", name)
+		}
+		fmt.Fprintf(&ae.bss, "    .comm %s,%d,%d\n", name, sym.Size, sym.alignment())
+	}
+}
+
+// commAlign aligns a common symbol of size bytes: the largest power of two
+// up to its size and 16 (the assembler rejects any other alignment)
+func commAlign(size int) int {
+	align := 1
+	for align*2 <= size && align < 16 {
+		align *= 2
+	}
+	return align
+}
+
+// alignment aligns a global: as commAlign does for its size, or more if
+// it or its type asks for more (see attributes.go)
+func (sym *Symbol) alignment() int {
+	return max(commAlign(sym.Size), sym.Align)
+}
+
+func (ae *ARM64Emitter) emitText() {
+	ae.text.WriteString("    .text\n")
+	for i := 0; i < len(ae.instructions); {
+		instr := ae.instructions[i]
+		if instr.Op == OpLabel && isFunctionLabel(instr.Dst.Value) {
+			i = ae.emitFunction(i)
+			continue
+		}
+		if instr.Op == OpLabel {
+			fmt.Fprintf(&ae.text, "%s:\n", instr.Dst.Value)
+		}
+		i++
+	}
+}
+
+// emitFunction emits the function whose label is at start and returns the
+// index after its body
+func (ae *ARM64Emitter) emitFunction(start int) int {
+	name := ae.instructions[start].Dst.Value
+	end := start + 1
+	for end < len(ae.instructions) && !(ae.instructions[end].Op == OpLabel && isFunctionLabel(ae.instructions[end].Dst.Value)) {
+		end++
+	}
+	body := ae.instructions[start+1 : end]
+
+	ae.frameSize = 0
+	if frame, ok := ae.frames[name]; ok {
+		ae.frameSize = frame.Size()
+	}
+	ae.saved = ae.calleeSavedIn(body)
+
+	fmt.Fprintf(&ae.text, "\n    .globl %s\n", name)
+	fmt.Fprintf(&ae.text, "    .type %s, %%function\n", name)
+	fmt.Fprintf(&ae.text, "    .balign 4\n")
+	fmt.Fprintf(&ae.text, "%s:\n", name)
+
+	// The frame record (x29, x30) is pushed first; slots and then the
+	// saved registers sit below x29, and sp stays 16-byte aligned. The
+	// CFA is x29+16 from then on (see unwind.go).
+	ae.emit(".cfi_startproc")
+	ae.emit("stp x29, x30, [sp, #-16]!")
+	ae.emit(".cfi_def_cfa_offset 16")
+	ae.emit(".cfi_offset 29, -16")
+	ae.emit(".cfi_offset 30, -8")
+	ae.emit("mov x29, sp")
+	ae.emit(".cfi_def_cfa_register 29")
+	if size := roundUp(ae.frameSize+8*len(ae.saved), 16); size > 0 {
+		if size < 4096 {
+			ae.emit("sub sp, sp, #%d", size)
+		} else {
+			ae.movImm("x16", int64(size))
+			ae.emit("sub sp, sp, x16")
+		}
+	}
+	for i, reg := range ae.saved {
+		ae.memory("str", reg, "x29", ae.saveSlot(i), "x15")
+		ae.emit(".cfi_offset %s, %d", strings.TrimPrefix(reg, "x"), ae.saveSlot(i)-16)
+	}
+
+	for i, instr := range body {
+		ae.annotateLine(instr)
+		// An epilogue with more of the body after it
+		more := (instr.Op == OpRet || instr.Op == OpTailCall) && continuesAfter(body[i+1:])
+		if more {
+			ae.emit(".cfi_remember_state")
+		}
+		ae.emitInstruction(instr)
+		if more {
+			ae.emit(".cfi_restore_state")
+		}
+	}
+	ae.emit(".cfi_endproc")
+	fmt.Fprintf(&ae.text, "    .size %s, .-%s\n", name, name)
+	return end
+}
+
+// calleeSavedIn lists the callee-saved registers body's temps were given
+func (ae *ARM64Emitter) calleeSavedIn(body []*IRInstruction) []string {
+	used := make(map[string]bool)
+	var visit func(op *Operand)
+	visit = func(op *Operand) {
+		if op == nil {
+			return
+		}
+		if op.Type == "reg" {
+			used[ae.reg(op.Value)] = true
+		}
+		visit(op.IndexTemp)
+		visit(op.SourcePtr)
+	}
+	for _, instr := range body {
+		visit(instr.Dst)
+		visit(instr.Src1)
+		visit(instr.Src2)
+	}
+	var regs []string
+	for _, reg := range arm64CalleeSaved {
+		if used[reg] {
+			regs = append(regs, reg)
+		}
+	}
+	return regs
+}
+
+// saveSlot is where the i'th saved register is kept, below the slots
+func (ae *ARM64Emitter) saveSlot(i int) int {
+	return -(ae.frameSize + 8*(i+1))
+}
+
+func (ae *ARM64Emitter) emitEpilogue() {
+	for i, reg := range ae.saved {
+		ae.memory("ldr", reg, "x29", ae.saveSlot(i), reg)
+	}
+	ae.emit("mov sp, x29")
+	ae.emit("ldp x29, x30, [sp], #16")
+	ae.emit(".cfi_def_cfa 31, 0")
+}
+
+func (ae *ARM64Emitter) annotateLine(instr *IRInstruction) {
+	if ae.sourceLines == nil || instr.Op == OpLabel || instr.Line <= 0 || instr.Line > len(ae.sourceLines) || instr.Line == ae.lastLine {
+		return
+	}
+	ae.lastLine = instr.Line
+	ae.emit("// %s: %s", instr.Pos, strings.TrimSpace(ae.sourceLines[instr.Line-1]))
+}
+
+func (ae *ARM64Emitter) emitInstruction(instr *IRInstruction) {
+	switch instr.Op {
+	case OpNop:
+		ae.emit("nop")
+	case OpMov:
+		ae.emitMov(instr.Dst, instr.Src1)
+	case OpMovFloat:
+		ae.put(instr.Dst, ae.value(instr.Src1, ae.scratchFor(instr.Dst)))
+	case OpConvert:
+		ae.emitConvert(instr.Dst, instr.Src1)
+	case OpAdd:
+		ae.emitArith("add", "fadd", instr)
+	case OpSub:
+		ae.emitArith("sub", "fsub", instr)
+	case OpMul:
+		ae.emitArith("mul", "fmul", instr)
+	case OpDiv:
+		ae.emitDivide(instr, false)
+	case OpMod:
+		ae.emitDivide(instr, true)
+	case OpAnd:
+		ae.emitArith("and", "", instr)
+	case OpOr:
+		ae.emitArith("orr", "", instr)
+	case OpXor:
+		ae.emitArith("eor", "", instr)
+	case OpShl:
+		ae.emitArith("lsl", "", instr)
+	case OpShr:
+		if ae.target.IsUnsigned(instr.Src1.DataType) {
+			ae.emitArith("lsr", "", instr)
+		} else {
+			ae.emitArith("asr", "", instr)
+		}
+	case OpNeg:
+		dst := ae.scratchFor(instr.Dst)
+		ae.emit("neg %s, %s", dst, ae.value(instr.Src1, dst))
+		ae.put(instr.Dst, dst)
+	case OpNot:
+		dst := ae.scratchFor(instr.Dst)
+		ae.emit("cmp %s, #0", ae.value(instr.Src1, dst))
+		ae.emit("cset %s, eq", dst)
+		ae.put(instr.Dst, dst)
+	case OpEq:
+		ae.emitCompare("eq", instr)
+	case OpNe:
+		ae.emitCompare("ne", instr)
+	case OpLt:
+		ae.emitCompare("lt", instr)
+	case OpLe:
+		ae.emitCompare("le", instr)
+	case OpGt:
+		ae.emitCompare("gt", instr)
+	case OpGe:
+		ae.emitCompare("ge", instr)
+	case OpLoad:
+		ae.emitLoad(instr.Dst, instr.Src1)
+	case OpStore:
+		ae.emitStore(instr.Dst, instr.Src1)
+	case OpLoadAddr:
+		dst := ae.scratchFor(instr.Dst)
+		ae.put(instr.Dst, ae.addressOf(instr.Src1, dst))
+	case OpSetArg:
+		ae.put(instr.Dst, ae.value(instr.Src1, ae.scratchFor(instr.Dst)))
+	case OpCall:
+		if instr.Src1.Type == "reg" {
+			ae.emit("blr %s", ae.reg(instr.Src1.Value))
+		} else {
+			ae.emit("bl %s", instr.Src1.Value)
+		}
+		if instr.Dst != nil && !(instr.Dst.Type == "reg" && ae.reg(instr.Dst.Value) == "x0") {
+			ae.put(instr.Dst, "x0")
+		}
+	case OpTailCall:
+		ae.emitEpilogue()
+		ae.emit("b %s", instr.Src1.Value)
+	case OpSyscall:
+		ae.emit("mov x8, #%s", instr.Src1.Value)
+		ae.emit("svc #0")
+		if instr.Dst != nil && !(instr.Dst.Type == "reg" && ae.reg(instr.Dst.Value) == "x0") {
+			ae.put(instr.Dst, "x0")
+		}
+	case OpRet:
+		ae.emitEpilogue()
+		ae.emit("ret")
+	case OpJmp:
+		ae.emit("b %s", instr.Dst.Value)
+	case OpJz:
+		ae.emit("cbz %s, %s", ae.value(instr.Src1, "x16"), instr.Dst.Value)
+	case OpJnz:
+		ae.emit("cbnz %s, %s", ae.value(instr.Src1, "x16"), instr.Dst.Value)
+	case OpLabel:
+		fmt.Fprintf(&ae.text, "%s:\n", instr.Dst.Value)
+	case OpMemcpy:
+		// Src1 first: loading it may use x15
+		src := ae.value(instr.Src1, "x16")
+		if src != "x16" {
+			ae.emit("mov x16, %s", src)
+		}
+		if dst := ae.value(instr.Dst, "x15"); dst != "x15" {
+			ae.emit("mov x15, %s", dst)
+		}
+		ae.movImm("x8", ae.immediate(instr.Src2, false))
+		fmt.Fprintf(&ae.text, "1:\n")
+		ae.emit("ldrb w17, [x16], #1")
+		ae.emit("strb w17, [x15], #1")
+		ae.emit("subs x8, x8, #1")
+		ae.emit("b.ne 1b")
+	case OpMemset:
+		val := ae.value(instr.Src1, "x16")
+		if val != "x16" {
+			ae.emit("mov x16, %s", val)
+		}
+		if dst := ae.value(instr.Dst, "x15"); dst != "x15" {
+			ae.emit("mov x15, %s", dst)
+		}
+		ae.movImm("x8", ae.immediate(instr.Src2, false))
+		fmt.Fprintf(&ae.text, "1:\n")
+		ae.emit("strb w16, [x15], #1")
+		ae.emit("subs x8, x8, #1")
+		ae.emit("b.ne 1b")
+	}
+}
+
+// reg maps an allocator register to its AArch64 register; ABI registers
+// (x0-x8, d0-d7) are already AArch64 names
+func (ae *ARM64Emitter) reg(name string) string {
+	if reg, ok := arm64Regs[name]; ok {
+		return reg
+	}
+	return name
+}
+
+// scratchFor is the register a value bound for op is computed in: op's own
+// register, or x16
+func (ae *ARM64Emitter) scratchFor(op *Operand) string {
+	if op != nil && op.Type == "reg" {
+		return ae.reg(op.Value)
+	}
+	return "x16"
+}
+
+// wreg is the 32-bit view of a general register
+func wreg(reg string) string {
+	return "w" + strings.TrimPrefix(reg, "x")
+}
+
+// movImm loads a 64-bit constant into reg
+func (ae *ARM64Emitter) movImm(reg string, value int64) {
+	if value >= -65536 && value <= 65535 {
+		ae.emit("mov %s, #%d", reg, value)
+		return
+	}
+	first := true
+	for shift := 0; shift < 64; shift += 16 {
+		chunk := (uint64(value) >> shift) & 0xffff
+		if chunk == 0 {
+			continue
+		}
+		if first {
+			ae.emit("movz %s, #%d, lsl #%d", reg, chunk, shift)
+			first = false
+		} else {
+			ae.emit("movk %s, #%d, lsl #%d", reg, chunk, shift)
+		}
+	}
+}
+
+// immediate is an imm operand's value: integers as themselves, floating
+// constants (or any constant when asFloat) as the bits of the double
+func (ae *ARM64Emitter) immediate(op *Operand, asFloat bool) int64 {
+	val := op.Value
+	switch val {
+	case "\\0":
+		val = "0"
+	case "\\n":
+		val = "10"
+	case "\\t":
+		val = "9"
+	case "\\r":
+		val = "13"
+	case "\\\\":
+		val = "92"
+	case "\\'":
+		val = "39"
+	case "\\\"":
+		val = "34"
+	}
+	if asFloat || strings.Contains(val, ".") || op.DataType == "float" || op.DataType == "double" {
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return int64(math.Float64bits(f))
+		}
+	}
+	if n, err := parseIntegerLiteral(val); err == nil {
+		return n
+	}
+	return 0
+}
+
+// unscaled maps a load or store to its form taking a signed 9-bit offset
+var unscaled = map[string]string{
+	"ldr": "ldur", "ldrsw": "ldursw", "ldrh": "ldurh", "ldrsh": "ldursh", "ldrb": "ldurb", "ldrsb": "ldursb",
+	"str": "stur", "strh": "sturh", "strb": "sturb",
+}
+
+// memory emits a load or store of reg at base+offset. An offset out of
+// ldur/stur's reach is added to base in temp first.
+func (ae *ARM64Emitter) memory(insn, reg, base string, offset int, temp string) {
+	switch {
+	case offset == 0:
+		ae.emit("%s %s, [%s]", insn, reg, base)
+	case offset >= -256 && offset <= 255:
+		ae.emit("%s %s, [%s, #%d]", unscaled[insn], reg, base, offset)
+	default:
+		ae.movImm(temp, int64(offset))
+		ae.emit("add %s, %s, %s", temp, base, temp)
+		ae.emit("%s %s, [%s]", insn, reg, temp)
+	}
+}
+
+// symbolAddress puts the address of a global or label in reg
+func (ae *ARM64Emitter) symbolAddress(reg, symbol string) string {
+	ae.emit("adrp %s, %s", reg, symbol)
+	ae.emit("add %s, %s, :lo12:%s", reg, reg, symbol)
+	return reg
+}
+
+// otherScratch is a scratch register other than reg for address parts
+func otherScratch(reg string) string {
+	if reg == "x15" {
+		return "x17"
+	}
+	return "x15"
+}
+
+// location resolves a memory operand to a base register and an offset,
+// using reg (and a second scratch for an index) to compute the base
+func (ae *ARM64Emitter) location(op *Operand, reg string) (string, int) {
+	switch op.Type {
+	case "ptr":
+		ptr := op.IndexTemp
+		if ptr == nil {
+			ptr = op.SourcePtr
+		}
+		return ae.value(ptr, reg), 0
+	case "array":
+		index := ae.value(op.IndexTemp, otherScratch(reg))
+		if op.IsGlobal {
+			if index == reg {
+				ae.emit("mov %s, %s", otherScratch(reg), index)
+				index = otherScratch(reg)
+			}
+			ae.symbolAddress(reg, op.Value)
+			ae.emit("add %s, %s, %s", reg, reg, index)
+			return reg, 0
+		}
+		ae.emit("add %s, x29, %s", reg, index)
+		return reg, op.Offset
+	default:
+		if op.IsGlobal {
+			return ae.symbolAddress(reg, op.Value), op.Offset
+		}
+		return "x29", op.Offset
+	}
+}
+
+// isMemory reports whether op names memory rather than a register or a
+// constant
+func isMemory(op *Operand) bool {
+	switch op.Type {
+	case "mem", "var", "ptr", "array":
+		return true
+	}
+	return false
+}
+
+// load reads size bytes at op into reg, sign-extending a 2- or 4-byte value
+// if signed and a byte per the target's char signedness for dataType
+func (ae *ARM64Emitter) load(op *Operand, reg string, size int, signed bool, dataType string) string {
+	base, offset := ae.location(op, reg)
+	switch size {
+	case 4:
+		if signed {
+			ae.memory("ldrsw", reg, base, offset, reg)
+		} else {
+			ae.memory("ldr", wreg(reg), base, offset, reg)
+		}
+	case 2:
+		if signed {
+			ae.memory("ldrsh", reg, base, offset, reg)
+		} else {
+			ae.memory("ldrh", wreg(reg), base, offset, reg)
+		}
+	case 1:
+		if ae.target.IsSignedChar(dataType) {
+			ae.memory("ldrsb", reg, base, offset, reg)
+		} else {
+			ae.memory("ldrb", wreg(reg), base, offset, reg)
+		}
+	default:
+		ae.memory("ldr", reg, base, offset, reg)
+	}
+	return reg
+}
+
+// store writes the low size bytes of reg to op
+func (ae *ARM64Emitter) store(op *Operand, reg string, size int) {
+	base, offset := ae.location(op, "x15")
+	switch size {
+	case 4:
+		ae.memory("str", wreg(reg), base, offset, "x17")
+	case 2:
+		ae.memory("strh", wreg(reg), base, offset, "x17")
+	case 1:
+		ae.memory("strb", wreg(reg), base, offset, "x17")
+	default:
+		ae.memory("str", reg, base, offset, "x17")
+	}
+}
+
+// value returns a register holding op's 64-bit value, loading it into
+// scratch if it isn't in one already
+func (ae *ARM64Emitter) value(op *Operand, scratch string) string {
+	switch op.Type {
+	case "reg":
+		return ae.reg(op.Value)
+	case "freg":
+		ae.emit("fmov %s, %s", scratch, op.Value)
+		return scratch
+	case "imm":
+		if n := ae.immediate(op, false); n == 0 {
+			return "xzr"
+		}
+		ae.movImm(scratch, ae.immediate(op, false))
+		return scratch
+	case "label":
+		return ae.symbolAddress(scratch, op.Value)
+	case "addr":
+		return ae.addressOf(op, scratch)
+	case "mem", "var", "ptr", "array":
+		return ae.load(op, scratch, 8, false, "")
+	}
+	return ae.reg(op.Value)
+}
+
+// addressOf puts the address op names in scratch
+func (ae *ARM64Emitter) addressOf(op *Operand, scratch string) string {
+	switch op.Type {
+	case "label":
+		return ae.symbolAddress(scratch, op.Value)
+	case "mem", "var", "addr", "array", "ptr":
+		base, offset := ae.location(op, scratch)
+		switch {
+		case offset == 0:
+			if base != scratch {
+				ae.emit("mov %s, %s", scratch, base)
+			}
+		case offset < 0 && offset > -4096:
+			ae.emit("sub %s, %s, #%d", scratch, base, -offset)
+		case offset > 0 && offset < 4096:
+			ae.emit("add %s, %s, #%d", scratch, base, offset)
+		default:
+			temp := otherScratch(scratch)
+			ae.movImm(temp, int64(offset))
+			ae.emit("add %s, %s, %s", scratch, base, temp)
+		}
+		return scratch
+	}
+	return ae.value(op, scratch)
+}
+
+// put writes the register value to op
+func (ae *ARM64Emitter) put(op *Operand, value string) {
+	switch op.Type {
+	case "reg":
+		if reg := ae.reg(op.Value); reg != value {
+			ae.emit("mov %s, %s", reg, value)
+		}
+	case "freg":
+		ae.emit("fmov %s, %s", op.Value, value)
+	default:
+		ae.store(op, value, 8)
+	}
+}
+
+// is32Bit reports whether a value of this type is handled in 32 bits, as
+// the x86-64 emitter's movl/idivl do
+func is32Bit(dataType string) bool {
+	return dataType == "int" || dataType == "unsigned int" || dataType == "unsigned" || strings.HasPrefix(dataType, "enum ")
+}
+
+func isFloating(ops ...*Operand) bool {
+	for _, op := range ops {
+		if op.DataType == "float" || op.DataType == "double" {
+			return true
+		}
+	}
+	return false
+}
+
+func (ae *ARM64Emitter) emitMov(dst, src *Operand) {
+	if (is32Bit(src.DataType) || is32Bit(dst.DataType)) && isMemory(src) {
+		// 32-bit values are sign-extended from memory, and stored as 32
+		// bits
+		reg := ae.load(src, ae.scratchFor(dst), 4, true, "")
+		if isMemory(dst) {
+			ae.store(dst, reg, 4)
+		} else {
+			ae.put(dst, reg)
+		}
+		return
+	}
+	ae.put(dst, ae.value(src, ae.scratchFor(dst)))
+}
+
+// emitArith emits a two-operand operation; fop, if set, is used instead
+// when an operand is floating
+func (ae *ARM64Emitter) emitArith(op, fop string, instr *IRInstruction) {
+	if fop != "" && isFloating(instr.Dst, instr.Src1, instr.Src2) {
+		ae.emit("fmov d16, %s", ae.floatValue(instr.Src1, "x16"))
+		ae.emit("fmov d17, %s", ae.floatValue(instr.Src2, "x17"))
+		ae.emit("%s d16, d16, d17", fop)
+		ae.emit("fmov x16, d16")
+		ae.put(instr.Dst, "x16")
+		return
+	}
+	a := ae.value(instr.Src1, "x16")
+	b := ae.value(instr.Src2, "x17")
+	dst := ae.scratchFor(instr.Dst)
+	ae.emit("%s %s, %s, %s", op, dst, a, b)
+	ae.put(instr.Dst, dst)
+}
+
+// floatValue is value with constants read as doubles
+func (ae *ARM64Emitter) floatValue(op *Operand, scratch string) string {
+	if op.Type == "imm" {
+		ae.movImm(scratch, ae.immediate(op, true))
+		return scratch
+	}
+	return ae.value(op, scratch)
+}
+
+// emitDivide emits / or %: sdiv, and msub for the remainder. An int
+// divisor divides in 32 bits, like idivl, and unsigned operands with udiv
+// in 64.
+func (ae *ARM64Emitter) emitDivide(instr *IRInstruction, remainder bool) {
+	if !remainder && isFloating(instr.Dst, instr.Src1, instr.Src2) {
+		ae.emitArith("", "fdiv", instr)
+		return
+	}
+	a := ae.value(instr.Src1, "x16")
+	b := ae.value(instr.Src2, "x17")
+	dst := ae.scratchFor(instr.Dst)
+	if ae.target.IsUnsigned(instr.Src1.DataType) || ae.target.IsUnsigned(instr.Src2.DataType) {
+		if remainder {
+			ae.emit("udiv x15, %s, %s", a, b)
+			ae.emit("msub %s, x15, %s, %s", dst, b, a)
+		} else {
+			ae.emit("udiv %s, %s, %s", dst, a, b)
+		}
+		ae.put(instr.Dst, dst)
+		return
+	}
+	size := 8
+	if instr.Src2.DataType == "int" || strings.HasPrefix(instr.Src2.DataType, "enum ") {
+		size = 4
+		a, b = wreg(a), wreg(b)
+	}
+	if remainder {
+		q := "x15"
+		if size == 4 {
+			q = "w15"
+		}
+		ae.emit("sdiv %s, %s, %s", q, a, b)
+		if size == 4 {
+			ae.emit("msub %s, %s, %s, %s", wreg(dst), q, b, a)
+		} else {
+			ae.emit("msub %s, %s, %s, %s", dst, q, b, a)
+		}
+	} else if size == 4 {
+		ae.emit("sdiv %s, %s, %s", wreg(dst), a, b)
+	} else {
+		ae.emit("sdiv %s, %s, %s", dst, a, b)
+	}
+	if size == 4 {
+		ae.emit("sxtw %s, %s", dst, wreg(dst))
+	}
+	ae.put(instr.Dst, dst)
+}
+
+// unsignedConds are the conditions for ordering comparisons of unsigned
+// integers, and floatConds of doubles (false when unordered)
+var (
+	unsignedConds = map[string]string{"lt": "lo", "le": "ls", "gt": "hi", "ge": "hs"}
+	floatConds    = map[string]string{"lt": "mi", "le": "ls", "gt": "gt", "ge": "ge"}
+)
+
+func (ae *ARM64Emitter) emitCompare(cond string, instr *IRInstruction) {
+	if isFloating(instr.Src1, instr.Src2) {
+		ae.emit("fmov d16, %s", ae.floatValue(instr.Src1, "x16"))
+		ae.emit("fmov d17, %s", ae.floatValue(instr.Src2, "x17"))
+		ae.emit("fcmp d16, d17")
+		if c, ok := floatConds[cond]; ok {
+			cond = c
+		}
+	} else {
+		a := ae.value(instr.Src1, "x16")
+		b := ae.value(instr.Src2, "x17")
+		ae.emit("cmp %s, %s", a, b)
+		if c, ok := unsignedConds[cond]; ok && (ae.target.IsUnsigned(instr.Src1.DataType) || ae.target.IsUnsigned(instr.Src2.DataType)) {
+			cond = c
+		}
+	}
+	dst := ae.scratchFor(instr.Dst)
+	ae.emit("cset %s, %s", dst, cond)
+	ae.put(instr.Dst, dst)
+}
+
+func (ae *ARM64Emitter) emitLoad(dst, src *Operand) {
+	reg := ae.scratchFor(dst)
+	switch src.Type {
+	case "var":
+		size := src.Size
+		if size <= 0 || size > 8 {
+			size = 8
+		}
+		ae.put(dst, ae.load(src, reg, size, isSignedInteger(ae.target, src.DataType), src.DataType))
+	case "ptr":
+		// The width comes from the pointee type
+		size := 8
+		if n, ok := ae.target.SizeOf(src.DataType); ok && n < 8 {
+			size = n
+		}
+		ae.put(dst, ae.load(src, reg, size, isSignedInteger(ae.target, src.DataType), src.DataType))
+	case "array", "mem":
+		ae.put(dst, ae.load(src, reg, 8, false, ""))
+	case "addr", "label":
+		ae.put(dst, ae.addressOf(src, reg))
+	default:
+		ae.emitMov(dst, src)
+	}
+}
+
+func (ae *ARM64Emitter) emitStore(dst, src *Operand) {
+	switch dst.Type {
+	case "var":
+		value := ae.value(src, "x16")
+		size := 8
+		if !dst.IsGlobal && (src.Type == "imm" || isMemory(src)) && dst.Size > 0 && dst.Size < 8 {
+			size = dst.Size
+		}
+		ae.store(dst, value, size)
+	case "array":
+		ae.store(dst, ae.value(src, "x16"), 8)
+	case "ptr":
+		size := dst.Size
+		if size != 1 && size != 2 && size != 4 {
+			size = 8
+		}
+		ae.store(dst, ae.value(src, "x16"), size)
+	default:
+		ae.emitMov(dst, src)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Compile artifacts
+// Embedders (playgrounds, graders, visualizers) want every stage of one
+// compile at once. CompileArtifacts runs the pipeline a single time and keeps
+// what each stage produced, so nothing has to be re-run per view.
+
+// Diagnostic is one error or warning, tagged with the stage that reported it.
+// Line and Column are where it is in the preprocessed source (0 if that
+// isn't known); File and Range are where that is in the files it came from,
+// filled in for -fdiagnostics-format=json (see diagnostics_json.go).
+type Diagnostic struct {
+	File     string       `json:"file"`
+	Range    *SourceRange `json:"range,omitempty"`
+	Severity string       `json:"severity"` // "error" or "warning"
+	Stage    string       `json:"-"`        // "preprocess", "parse", "check", "select", "allocate", "emit", "assemble"
+	Code     string       `json:"code"`     // the -W option that controls a warning, if one does
+	Message  string       `json:"message"`
+	Line     int          `json:"-"`
+	Column   int          `json:"-"`
+}
+
+// String is d as the compiler prints it, "line N: message"
+func (d Diagnostic) String() string {
+	if d.Line > 0 {
+		return fmt.Sprintf("line %d: %s", d.Line, d.Message)
+	}
+	return d.Message
+}
+
+// Artifacts holds the output of every pipeline stage. -emit-artifacts
+// writes it as JSON, with the machine code in base64.
+type Artifacts struct {
+	Source       string            `json:"source"`
+	Preprocessed string            `json:"preprocessed"`
+	IR           []string          `json:"ir"`           // three-address code before register allocation
+	Assembly     string            `json:"assembly"`     // GAS text
+	Instrs       []*MachineInstr   `json:"-"`            // structured form of Assembly
+	MachineCode  []byte            `json:"machine_code"` // .text as encoded by the built-in assembler
+	Relocations  []Relocation      `json:"relocations"`  // references MachineCode makes to external symbols
+	Symbols      map[string]uint64 `json:"symbols"`      // label offsets within MachineCode
+	Index        *SymbolIndex      `json:"index"`        // declarations and where they are (see symbol_index.go)
+	Diagnostics  []Diagnostic      `json:"diagnostics"`
+}
+
+// JSON is a as -emit-artifacts writes it
+func (a *Artifacts) JSON() []byte {
+	data, _ := json.MarshalIndent(a, "", "  ")
+	return append(data, '\n')
+}
+
+// Errors returns the error diagnostics
+func (a *Artifacts) Errors() []Diagnostic {
+	var errs []Diagnostic
+	for _, d := range a.Diagnostics {
+		if d.Severity == "error" {
+			errs = append(errs, d)
+		}
+	}
+	return errs
+}
+
+// CompileArtifacts compiles source and returns every stage's output. A
+// failing stage is recorded as an error diagnostic (and returned) with the
+// artifacts of the stages before it still filled in.
+func CompileArtifacts(source string, options CompilerOptions) (*Artifacts, error) {
+	options.Cache = false // a cached compile skips the stages
+	cp := NewCompilerPipeline(source, options)
+	cp.keepIR = true
+	cp.warningOutput = io.Discard // they're among the diagnostics
+	art := &Artifacts{Source: source}
+
+	err := cp.Compile()
+	art.Preprocessed = cp.preprocessed
+	art.IR = cp.irText
+	if cp.parser != nil {
+		art.Index = cp.symbolIndex()
+	}
+	// Placed in the files they came from, as -fdiagnostics-format=json has them
+	art.Diagnostics = cp.Diagnostics(err)
+	if err != nil {
+		return art, err
+	}
+
+	art.Assembly = cp.assembly
+	if cp.emitter == nil {
+		// AArch64: the built-in assembler only encodes x86-64
+		return art, nil
+	}
+	art.Instrs = cp.emitter.MachineInstrs()
+
+	// The built-in assembler doesn't cover every instruction gcc accepts yet;
+	// a gap costs the machine code view, not the compile
+	assembler := NewAssembler()
+	code, err := assembler.AssembleInstrs(art.Instrs)
+	if err != nil {
+		art.Diagnostics = append(art.Diagnostics, Diagnostic{Severity: "warning", Stage: "assemble", Message: err.Error()})
+		return art, nil
+	}
+	art.MachineCode = append([]byte(nil), code...)
+	art.Relocations = append([]Relocation(nil), assembler.relocations...)
+	art.Symbols = assembler.symbols
+	return art, nil
+}
+
+// failedStage names the first stage that produced nothing
+func (cp *CompilerPipeline) failedStage() string {
+	switch {
+	case cp.preprocessed == "":
+		return "preprocess"
+	case cp.checker == nil:
+		return "parse"
+	case cp.selector == nil:
+		return "check"
+	case cp.ir == nil:
+		return "select"
+	case cp.emitter == nil:
+		return "allocate"
+	}
+	return "emit"
+}
+
+var opNames = map[OpCode]string{
+	OpNop: "nop", OpAdd: "add", OpSub: "sub", OpMul: "mul", OpDiv: "div", OpMod: "mod",
+	OpNeg: "neg", OpAnd: "and", OpOr: "or", OpXor: "xor", OpNot: "not", OpShl: "shl", OpShr: "shr",
+	OpEq: "eq", OpNe: "ne", OpLt: "lt", OpLe: "le", OpGt: "gt", OpGe: "ge",
+	OpMov: "mov", OpMovFloat: "movf", OpLoad: "load", OpStore: "store", OpLoadAddr: "lea",
+	OpCall: "call", OpRet: "ret", OpJmp: "jmp", OpJz: "jz", OpJnz: "jnz", OpLabel: "label",
+	OpPush: "push", OpPop: "pop", OpParam: "param", OpSetArg: "setarg",
+	OpMemcpy: "memcpy", OpMemset: "memset", OpTailCall: "tailcall", OpSyscall: "syscall",
+	OpConvert: "convert", OpAtomicAdd: "atomic_add", OpAtomicXchg: "atomic_xchg", OpFence: "fence",
+	OpTLSAddr: "tlsaddr", OpPopcnt: "popcnt", OpClz: "clz", OpCtz: "ctz", OpBswap: "bswap",
+	OpPopArgs: "popargs",
+}
+
+func (op OpCode) String() string {
+	if name, ok := opNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("op%d", int(op))
+}
+
+// String renders an IR operand compactly: t3, %rax, $5, x@-8, [t4], g[t2]
+func (o *Operand) String() string {
+	if o == nil {
+		return "_"
+	}
+	switch o.Type {
+	case "temp":
+		return o.Value
+	case "reg", "freg":
+		return "%" + o.Value
+	case "imm":
+		return "$" + o.Value
+	case "label":
+		return o.Value
+	case "var", "addr":
+		prefix := ""
+		if o.Type == "addr" {
+			prefix = "&"
+		}
+		if o.IsGlobal {
+			if o.Offset != 0 {
+				return fmt.Sprintf("%s%s+%d", prefix, o.Value, o.Offset)
+			}
+			return prefix + o.Value
+		}
+		return fmt.Sprintf("%s%s@%d", prefix, o.Value, o.Offset)
+	case "mem":
+		return fmt.Sprintf("[rbp%+d]", o.Offset)
+	case "ptr":
+		return "[" + o.IndexTemp.String() + "]"
+	case "array":
+		return fmt.Sprintf("%s@%d[%s]", o.Value, o.Offset, o.IndexTemp.String())
+	}
+	return o.Type + ":" + o.Value
+}
+
+// String renders one IR instruction, e.g. "t3 = add t1, $4", and marks a
+// volatile access: "store x@-8 <- $1 volatile"
+func (instr *IRInstruction) String() string {
+	if instr.Volatile {
+		return instr.text() + " volatile"
+	}
+	return instr.text()
+}
+
+func (instr *IRInstruction) text() string {
+	switch instr.Op {
+	case OpLabel:
+		return instr.Dst.String() + ":"
+	case OpJmp:
+		return fmt.Sprintf("    jmp %s", instr.Dst)
+	case OpCall:
+		if instr.Src1 == nil {
+			// Runtime helper call with arguments already in registers
+			return fmt.Sprintf("    call %s", instr.Dst)
+		}
+	case OpJz, OpJnz:
+		return fmt.Sprintf("    %s %s, %s", instr.Op, instr.Src1, instr.Dst)
+	case OpStore:
+		return fmt.Sprintf("    store %s <- %s", instr.Dst, instr.Src1)
+	}
+	var srcs []string
+	for _, src := range []*Operand{instr.Src1, instr.Src2} {
+		if src != nil {
+			srcs = append(srcs, src.String())
+		}
+	}
+	if instr.Dst == nil {
+		return strings.TrimRight("    "+instr.Op.String()+" "+strings.Join(srcs, ", "), " ")
+	}
+	return fmt.Sprintf("    %s = %s %s", instr.Dst, instr.Op, strings.Join(srcs, ", "))
+}
@@ -13,13 +13,38 @@ type Assembler struct {
 	relocations  []Relocation
 	labelTargets map[string]int
 	currentAddr  uint64
+	
+	// Branch layout state (see AssembleText)
+	fixups     []jumpFixup
+	longJumps  map[int]bool // instruction index -> needs rel32
+	instrIndex int
+	
+	// Data sections the directives lay out (see assembler_data.go)
+	rodata, data, bss *Section
+	bindings          map[string]byte // from .globl, .weak and .local; STB_LOCAL otherwise
+	commons           map[string]bool // defined by .comm
+	
+	// Call frame information from the .cfi_ directives (see unwind.go)
+	frames []*unwindFrame
+	frame  *unwindFrame // the function being described
+	
+	enc ByteEncoder // immediate/displacement byte order
+}
+
+// jumpFixup is a displacement waiting for its label's final offset
+type jumpFixup struct {
+	offset int    // position of the displacement in code
+	size   int    // 1 (rel8) or 4 (rel32)
+	label  string // target label
+	instr  int    // instruction index, for promotion to rel32
 }
 
 type Relocation struct {
-	Type   RelocationType
-	Offset uint64
-	Symbol string
-	Addend int64
+	Type    RelocationType `json:"type"`
+	Offset  uint64         `json:"offset"`
+	Symbol  string         `json:"symbol"`
+	Addend  int64          `json:"addend"`
+	Section string         `json:"section,omitempty"` // the data section patched ("rodata" or "data"); "" is .text
 }
 
 type RelocationType int
@@ -30,6 +55,8 @@ const (
 	R_X86_64_PC32
 	R_X86_64_PLT32
 	R_X86_64_GOTPCREL
+	R_X86_64_32
+	R_X86_64_32S
 )
 
 // Register encoding
@@ -53,22 +80,22 @@ const (
 )
 
 var regNameToCode = map[string]int{
-	"rax": REG_RAX, "eax": REG_RAX, "al": REG_RAX,
-	"rcx": REG_RCX, "ecx": REG_RCX, "cl": REG_RCX,
-	"rdx": REG_RDX, "edx": REG_RDX, "dl": REG_RDX,
-	"rbx": REG_RBX, "ebx": REG_RBX, "bl": REG_RBX,
-	"rsp": REG_RSP, "esp": REG_RSP,
-	"rbp": REG_RBP, "ebp": REG_RBP,
-	"rsi": REG_RSI, "esi": REG_RSI,
-	"rdi": REG_RDI, "edi": REG_RDI,
-	"r8":  REG_R8,  "r8d": REG_R8,  "r8b": REG_R8,
-	"r9":  REG_R9,  "r9d": REG_R9,  "r9b": REG_R9,
-	"r10": REG_R10, "r10d": REG_R10,
-	"r11": REG_R11, "r11d": REG_R11,
-	"r12": REG_R12, "r12d": REG_R12,
-	"r13": REG_R13, "r13d": REG_R13,
-	"r14": REG_R14, "r14d": REG_R14,
-	"r15": REG_R15, "r15d": REG_R15,
+	"rax": REG_RAX, "eax": REG_RAX, "ax": REG_RAX, "al": REG_RAX,
+	"rcx": REG_RCX, "ecx": REG_RCX, "cx": REG_RCX, "cl": REG_RCX,
+	"rdx": REG_RDX, "edx": REG_RDX, "dx": REG_RDX, "dl": REG_RDX,
+	"rbx": REG_RBX, "ebx": REG_RBX, "bx": REG_RBX, "bl": REG_RBX,
+	"rsp": REG_RSP, "esp": REG_RSP, "spl": REG_RSP,
+	"rbp": REG_RBP, "ebp": REG_RBP, "bpl": REG_RBP,
+	"rsi": REG_RSI, "esi": REG_RSI, "si": REG_RSI, "sil": REG_RSI,
+	"rdi": REG_RDI, "edi": REG_RDI, "di": REG_RDI, "dil": REG_RDI,
+	"r8":  REG_R8,  "r8d": REG_R8,  "r8w": REG_R8,  "r8b": REG_R8,
+	"r9":  REG_R9,  "r9d": REG_R9,  "r9w": REG_R9,  "r9b": REG_R9,
+	"r10": REG_R10, "r10d": REG_R10, "r10w": REG_R10, "r10b": REG_R10,
+	"r11": REG_R11, "r11d": REG_R11, "r11w": REG_R11, "r11b": REG_R11,
+	"r12": REG_R12, "r12d": REG_R12, "r12w": REG_R12, "r12b": REG_R12,
+	"r13": REG_R13, "r13d": REG_R13, "r13w": REG_R13, "r13b": REG_R13,
+	"r14": REG_R14, "r14d": REG_R14, "r14w": REG_R14, "r14b": REG_R14,
+	"r15": REG_R15, "r15d": REG_R15, "r15w": REG_R15, "r15b": REG_R15,
 }
 
 func NewAssembler() *Assembler {
@@ -78,134 +105,258 @@ func NewAssembler() *Assembler {
 		relocations:  make([]Relocation, 0),
 		labelTargets: make(map[string]int),
 		currentAddr:  0,
+		longJumps:    make(map[int]bool),
+		enc:          encoderX86_64,
 	}
 }
 
 func (a *Assembler) AssembleText(asmText string) ([]byte, error) {
-	lines := strings.Split(asmText, "\n")
-	
 	// Debug: print input
 	debugMode := false  // Disable debug
 	if debugMode {
 		fmt.Printf("=== ASSEMBLER INPUT (%d bytes) ===\n%s\n=== END INPUT ===\n", len(asmText), asmText)
 	}
 	
-	// First pass: collect labels
-	offset := 0
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
+	return a.AssembleInstrs(ParseMachineText(asmText))
+}
+
+// AssembleInstrs encodes a structured instruction stream (see MachineInstr)
+func (a *Assembler) AssembleInstrs(instrs []*MachineInstr) ([]byte, error) {
+	debugMode := false  // Disable debug
+	
+	// Layout passes: every jump starts out as a short (rel8) jump. After each
+	// pass the fixups are checked against the real label offsets, and any jump
+	// whose displacement doesn't fit is promoted to rel32. Promotion only grows
+	// code, so this converges; the final pass back-patches every displacement.
+	a.longJumps = make(map[int]bool)
+	for pass := 0; ; pass++ {
+		a.code = a.code[:0]
+		a.relocations = a.relocations[:0]
+		a.fixups = a.fixups[:0]
+		a.labelTargets = make(map[string]int)
+		a.symbols = make(map[string]uint64)
+		a.resetData()
+		a.bindings = make(map[string]byte)
+		a.commons = make(map[string]bool)
+		a.frames, a.frame = nil, nil
 		
-		if strings.HasSuffix(line, ":") {
-			label := strings.TrimSuffix(line, ":")
-			a.labelTargets[label] = offset
-			a.symbols[label] = uint64(offset)
-			continue
+		instructionCount := 0
+		current := "text"
+		for _, mi := range instrs {
+			inText := current == "text"
+			if usesTLS(mi) {
+				return nil, errNativeTLS
+			}
+			switch mi.Kind {
+			case MDirective:
+				if sec, ok := sectionDirective(mi.Op, mi.Args); ok {
+					current = dataSectionOf(sec)
+				} else if a.symbolDirective(mi) {
+					continue
+				} else if inText && strings.HasPrefix(mi.Op, ".cfi_") {
+					if err := a.cfiDirective(mi); err != nil {
+						return nil, err
+					}
+				} else if !inText || mi.Op == ".comm" || mi.Op == ".lcomm" {
+					if err := a.dataDirective(mi, current); err != nil {
+						return nil, err
+					}
+				}
+				continue
+			case MLabel:
+				if a.isDefined(mi.Op) {
+					return nil, fmt.Errorf("symbol '%s' is already defined", mi.Op)
+				}
+				if inText {
+					a.labelTargets[mi.Op] = len(a.code)
+					a.symbols[mi.Op] = uint64(len(a.code))
+				} else if s := a.section(current); s != nil {
+					s.define(mi.Op)
+				}
+				continue
+			case MInstr:
+				if !inText {
+					continue
+				}
+			default:
+				continue
+			}
+			
+			a.instrIndex = instructionCount
+			instructionCount++
+			beforeSize := len(a.code)
+			err := a.encodeInstruction(mi)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode '%s': %w", strings.TrimSpace(mi.String()), err)
+			}
+			
+			if debugMode {
+				fmt.Printf("pass %d #%d Encoded '%s': %d bytes (total now: %d)\n", pass, instructionCount, mi, len(a.code)-beforeSize, len(a.code))
+			}
 		}
 		
-		if strings.HasPrefix(line, ".") {
-			continue
+		if !a.relaxJumps() {
+			break
 		}
-		
-		size := a.estimateInstructionSize(line)
-		offset += size
 	}
 	
-	// Debug output (can be removed later)
+	a.applyFixups()
+	
 	if debugMode {
-		fmt.Printf("After first pass: expected size = %d\n", offset)
+		fmt.Printf("Final code size: %d bytes\n", len(a.code))
 	}
 	
-	// Second pass: encode instructions
-	instructionCount := 0
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") || strings.HasSuffix(line, ":") {
-			continue
+	return a.code, nil
+}
+
+// sectionDirective reports which section a directive switches to, if any
+func sectionDirective(name, args string) (string, bool) {
+	switch name {
+	case ".text", ".data", ".bss":
+		return name, true
+	case ".section":
+		if fields := strings.Fields(args); len(fields) > 0 {
+			name, _, _ := strings.Cut(fields[0], ",")
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// symbolDirective records the binding .globl, .weak or .local gives the
+// symbols it names, and reports whether mi was one of them
+func (a *Assembler) symbolDirective(mi *MachineInstr) bool {
+	var binding byte
+	switch mi.Op {
+	case ".globl", ".global":
+		binding = STB_GLOBAL
+	case ".weak":
+		binding = STB_WEAK
+	case ".local":
+		binding = STB_LOCAL
+	default:
+		return false
+	}
+	for _, name := range strings.Split(mi.Args, ",") {
+		a.bindings[strings.TrimSpace(name)] = binding
+	}
+	return true
+}
+
+// isDefined reports whether a label or .comm has already defined name
+func (a *Assembler) isDefined(name string) bool {
+	if _, ok := a.symbols[name]; ok {
+		return true
+	}
+	for _, s := range []*Section{a.rodata, a.data, a.bss} {
+		if _, ok := s.Symbols[name]; ok {
+			return true
 		}
-		
-		if strings.HasPrefix(line, ".") {
+	}
+	return false
+}
+
+// Object packages what the last AssembleInstrs produced for the linker
+func (a *Assembler) Object(name string) *LinkObject {
+	return &LinkObject{
+		Name:        name,
+		Text:        a.code,
+		TextSymbols: a.symbols,
+		Rodata:      a.rodata,
+		Data:        a.data,
+		Bss:         a.bss,
+		Relocations: a.relocations,
+		Bindings:    a.bindings,
+		Commons:     a.commons,
+		Frames:      a.frames,
+	}
+}
+
+// relaxJumps promotes short jumps whose target is out of rel8 range
+// Returns true if anything changed and another layout pass is needed
+func (a *Assembler) relaxJumps() bool {
+	changed := false
+	for _, f := range a.fixups {
+		if f.size != 1 {
 			continue
 		}
-		
-		instructionCount++
-		beforeSize := len(a.code)
-		err := a.encodeInstruction(line)
-		if err != nil {
-			return nil, fmt.Errorf("failed to encode '%s': %w", line, err)
-		}
-		
-		if debugMode {
-			fmt.Printf("#%d Encoded '%s': %d bytes (total now: %d)\n", instructionCount, line, len(a.code)-beforeSize, len(a.code))
+		target, ok := a.labelTargets[f.label]
+		disp := target - (f.offset + 1)
+		if !ok || disp < -128 || disp > 127 {
+			a.longJumps[f.instr] = true
+			changed = true
 		}
 	}
-	
-	if debugMode {
-		fmt.Printf("Final code size: %d bytes\n", len(a.code))
-	}
-	
-	return a.code, nil
+	return changed
 }
 
-func (a *Assembler) estimateInstructionSize(line string) int {
-	parts := strings.Fields(line)
-	if len(parts) == 0 {
-		return 0
-	}
-	
-	mnemonic := parts[0]
-	
-	switch mnemonic {
-	case "pushq", "popq":
-		return 2
-	case "ret", "nop":
-		return 1
-	case "call", "jmp", "je", "jne", "jl", "jle", "jg", "jge":
-		return 5
-	case "movq", "addq", "subq", "imulq", "cmpq":
-		return 8
-	case "idivq":
-		return 3
-	case "cqto":
-		return 1
-	default:
-		return 8
+// applyFixups back-patches jump/call displacements now that all labels are placed
+// Targets that aren't local labels become PC32 relocations for the linker
+func (a *Assembler) applyFixups() {
+	for _, f := range a.fixups {
+		target, ok := a.labelTargets[f.label]
+		if !ok {
+			a.relocations = append(a.relocations, Relocation{
+				Type:   R_X86_64_PC32,
+				Offset: uint64(f.offset),
+				Symbol: f.label,
+				Addend: -4,
+			})
+			continue
+		}
+		
+		disp := target - (f.offset + f.size)
+		a.enc.Put(a.code[f.offset:], uint64(disp), f.size)
 	}
 }
 
-func (a *Assembler) encodeInstruction(line string) error {
-	parts := strings.Fields(line)
-	if len(parts) == 0 {
-		return nil
+func (a *Assembler) encodeInstruction(mi *MachineInstr) error {
+	// Encoders take the operands in AT&T order, source first
+	mnemonic := mi.Op
+	switch mi.Prefix {
+	case "":
+	case "lock":
+		// Only read-modify-write instructions on memory take it (see atomics.go)
+		if len(mi.Operands) == 0 || mi.Operands[len(mi.Operands)-1].Kind != MOpMem {
+			return fmt.Errorf("lock prefix needs a memory destination: lock %s", mi.Op)
+		}
+		a.emit(0xF0)
+	case "rep":
+		// Block moves and fills (see memops.go)
+		if mnemonic != "movsb" && mnemonic != "stosb" && mnemonic != "stosq" {
+			return fmt.Errorf("unsupported string instruction: rep %s", mnemonic)
+		}
+		a.emit(0xF3)
+	default:
+		return fmt.Errorf("unsupported prefix: %s", mi.Prefix)
 	}
 	
-	mnemonic := parts[0]
-	
 	switch mnemonic {
 	case "pushq":
-		return a.encodePush(parts[1:])
+		return a.encodePush(mi.Operands)
 	case "popq":
-		return a.encodePop(parts[1:])
+		return a.encodePop(mi.Operands)
 	case "movq":
-		return a.encodeMov(parts[1:])
+		if handled, err := a.encodeMovqXMM(mi.Operands); handled {
+			return err
+		}
+		return a.encodeMov(mi.Operands)
 	case "addq":
-		return a.encodeAdd(parts[1:])
+		return a.encodeAdd(mi.Operands)
 	case "subq":
-		return a.encodeSub(parts[1:])
+		return a.encodeSub(mi.Operands)
 	case "imulq":
-		return a.encodeImul(parts[1:])
+		return a.encodeImul(mi.Operands)
 	case "idivq":
-		return a.encodeIdiv(parts[1:])
+		return a.encodeIdiv(mi.Operands)
 	case "cmpq":
-		return a.encodeCmp(parts[1:])
+		return a.encodeCmp(mi.Operands)
 	case "andq":
-		return a.encodeAnd(parts[1:])
+		return a.encodeAnd(mi.Operands)
 	case "orq":
-		return a.encodeOr(parts[1:])
+		return a.encodeOr(mi.Operands)
 	case "xorq":
-		return a.encodeXor(parts[1:])
+		return a.encodeXor(mi.Operands)
 	case "ret":
 		a.emit(0xC3)
 		return nil
@@ -218,59 +369,175 @@ func (a *Assembler) encodeInstruction(line string) error {
 	case "cqto":
 		a.emit(0x48, 0x99)
 		return nil
+	case "cdq", "cltd":
+		a.emit(0x99)
+		return nil
+	case "rep":
+		return fmt.Errorf("rep requires a string instruction")
+	case "movsb":
+		a.emit(0xA4)
+		return nil
+	case "stosb":
+		a.emit(0xAA)
+		return nil
+	case "stosq":
+		a.emit(0x48, 0xAB)
+		return nil
 	case "call":
-		return a.encodeCall(parts[1:])
+		return a.encodeCall(mi.Operands)
 	case "jmp":
-		return a.encodeJmp(parts[1:])
+		return a.encodeJmp(mi.Operands)
 	case "je", "jz":
-		return a.encodeJe(parts[1:])
+		return a.encodeJe(mi.Operands)
 	case "jne", "jnz":
-		return a.encodeJne(parts[1:])
+		return a.encodeJne(mi.Operands)
 	case "jl":
-		return a.encodeJl(parts[1:])
+		return a.encodeJl(mi.Operands)
 	case "jle":
-		return a.encodeJle(parts[1:])
+		return a.encodeJle(mi.Operands)
 	case "jg":
-		return a.encodeJg(parts[1:])
+		return a.encodeJg(mi.Operands)
 	case "jge":
-		return a.encodeJge(parts[1:])
+		return a.encodeJge(mi.Operands)
+	case "jb", "jc", "jnae":
+		return a.encodeConditionalJump(0x82, mi.Operands)
+	case "jae", "jnc", "jnb":
+		return a.encodeConditionalJump(0x83, mi.Operands)
+	case "jbe", "jna":
+		return a.encodeConditionalJump(0x86, mi.Operands)
+	case "ja", "jnbe":
+		return a.encodeConditionalJump(0x87, mi.Operands)
+	case "jp", "jpe":
+		return a.encodeConditionalJump(0x8A, mi.Operands)
+	case "jnp", "jpo":
+		return a.encodeConditionalJump(0x8B, mi.Operands)
 	case "sete", "setz":
-		return a.encodeSetCC(0x94, parts[1:])
+		return a.encodeSetCC(0x94, mi.Operands)
 	case "setne", "setnz":
-		return a.encodeSetCC(0x95, parts[1:])
+		return a.encodeSetCC(0x95, mi.Operands)
 	case "setl":
-		return a.encodeSetCC(0x9C, parts[1:])
+		return a.encodeSetCC(0x9C, mi.Operands)
 	case "setle":
-		return a.encodeSetCC(0x9E, parts[1:])
+		return a.encodeSetCC(0x9E, mi.Operands)
 	case "setg":
-		return a.encodeSetCC(0x9F, parts[1:])
+		return a.encodeSetCC(0x9F, mi.Operands)
 	case "setge":
-		return a.encodeSetCC(0x9D, parts[1:])
+		return a.encodeSetCC(0x9D, mi.Operands)
+	case "setb", "setc", "setnae":
+		return a.encodeSetCC(0x92, mi.Operands)
+	case "setae", "setnc", "setnb":
+		return a.encodeSetCC(0x93, mi.Operands)
+	case "setbe", "setna":
+		return a.encodeSetCC(0x96, mi.Operands)
+	case "seta", "setnbe":
+		return a.encodeSetCC(0x97, mi.Operands)
 	case "movzbq":
-		return a.encodeMovzbq(parts[1:])
+		return a.encodeMovzbq(mi.Operands)
+	case "movzbl":
+		return a.encodeMovx(false, 0xB6, mnemonic, mi.Operands)
+	case "movzwl":
+		return a.encodeMovx(false, 0xB7, mnemonic, mi.Operands)
+	case "movsbq":
+		return a.encodeMovx(true, 0xBE, mnemonic, mi.Operands)
+	case "movswq":
+		return a.encodeMovx(true, 0xBF, mnemonic, mi.Operands)
+	case "movslq":
+		return a.encodeMovslq(mi.Operands)
+	case "movl":
+		return a.encodeMovl(mi.Operands)
+	case "movb", "movw":
+		return a.encodeNarrowMov(mnemonic, mi.Operands)
+	case "idivl":
+		return a.encodeIdivl(mi.Operands)
+	case "cltq":
+		a.emit(0x48, 0x98)
+		return nil
+	case "lock":
+		// Prefixes the next instruction, when atomics.go puts it on a line
+		// of its own
+		a.emit(0xF0)
+		return nil
+	case "mfence":
+		a.emit(0x0F, 0xAE, 0xF0)
+		return nil
+	case "xchgb", "xchgw", "xchgl", "xchgq", "xaddb", "xaddw", "xaddl", "xaddq", "addb", "addw", "addl":
+		return a.encodeAtomic(mnemonic, mi.Operands)
+	case "popcntl", "popcntq":
+		return a.encodeBitCount(0xB8, mnemonic, mi.Operands)
+	case "lzcntl", "lzcntq":
+		return a.encodeBitCount(0xBD, mnemonic, mi.Operands)
+	case "tzcntl", "tzcntq":
+		return a.encodeBitCount(0xBC, mnemonic, mi.Operands)
+	case "bswapl", "bswapq":
+		return a.encodeBswap(mnemonic, mi.Operands)
+	case "divq":
+		return a.encodeDivq(mi.Operands)
 	case "testq":
-		return a.encodeTest(parts[1:])
+		return a.encodeTest(mi.Operands)
 	case "leaq":
-		return a.encodeLea(parts[1:])
+		return a.encodeLea(mi.Operands)
 	case "salq", "shlq":
-		return a.encodeShift(0xE0, parts[1:]) // SAL/SHL use /4
+		return a.encodeShift(4, mi.Operands) // SAL/SHL use /4
 	case "sarq":
-		return a.encodeShift(0xF8, parts[1:]) // SAR uses /7
+		return a.encodeShift(7, mi.Operands) // SAR uses /7
 	case "shrq":
-		return a.encodeShift(0xE8, parts[1:]) // SHR uses /5
+		return a.encodeShift(5, mi.Operands) // SHR uses /5
 	case "negq":
-		return a.encodeNeg(parts[1:])
+		return a.encodeNeg(mi.Operands)
+	// SSE2 scalar floating point
+	case "movsd":
+		return a.encodeSSEMove(0xF2, mnemonic, mi.Operands)
+	case "movss":
+		return a.encodeSSEMove(0xF3, mnemonic, mi.Operands)
+	case "movups":
+		return a.encodeSSEMove(0, mnemonic, mi.Operands)
+	case "addsd":
+		return a.encodeSSEArith(0xF2, 0x58, mnemonic, mi.Operands)
+	case "addss":
+		return a.encodeSSEArith(0xF3, 0x58, mnemonic, mi.Operands)
+	case "subsd":
+		return a.encodeSSEArith(0xF2, 0x5C, mnemonic, mi.Operands)
+	case "subss":
+		return a.encodeSSEArith(0xF3, 0x5C, mnemonic, mi.Operands)
+	case "mulsd":
+		return a.encodeSSEArith(0xF2, 0x59, mnemonic, mi.Operands)
+	case "mulss":
+		return a.encodeSSEArith(0xF3, 0x59, mnemonic, mi.Operands)
+	case "divsd":
+		return a.encodeSSEArith(0xF2, 0x5E, mnemonic, mi.Operands)
+	case "divss":
+		return a.encodeSSEArith(0xF3, 0x5E, mnemonic, mi.Operands)
+	case "ucomisd":
+		return a.encodeSSEArith(0x66, 0x2E, mnemonic, mi.Operands)
+	case "ucomiss":
+		return a.encodeSSEArith(0, 0x2E, mnemonic, mi.Operands)
+	case "cvtss2sd":
+		return a.encodeSSEArith(0xF3, 0x5A, mnemonic, mi.Operands)
+	case "cvtsd2ss":
+		return a.encodeSSEArith(0xF2, 0x5A, mnemonic, mi.Operands)
+	case "cvtsi2sd", "cvtsi2sdq":
+		return a.encodeCvtsi2sd(0xF2, true, mnemonic, mi.Operands)
+	case "cvtsi2sdl":
+		return a.encodeCvtsi2sd(0xF2, false, mnemonic, mi.Operands)
+	case "cvtsi2ss", "cvtsi2ssq":
+		return a.encodeCvtsi2sd(0xF3, true, mnemonic, mi.Operands)
+	case "cvtsi2ssl":
+		return a.encodeCvtsi2sd(0xF3, false, mnemonic, mi.Operands)
+	case "cvttsd2si", "cvttsd2siq", "cvttsd2sil":
+		return a.encodeCvttsd2si(0xF2, mnemonic, mi.Operands)
+	case "cvttss2si", "cvttss2siq", "cvttss2sil":
+		return a.encodeCvttsd2si(0xF3, mnemonic, mi.Operands)
 	default:
 		return fmt.Errorf("unsupported mnemonic: %s", mnemonic)
 	}
 }
 
-func (a *Assembler) encodePush(operands []string) error {
+func (a *Assembler) encodePush(operands []MachineOperand) error {
 	if len(operands) != 1 {
 		return fmt.Errorf("push requires 1 operand")
 	}
 	
-	reg := parseRegister(operands[0])
+	reg := regOf(operands[0])
 	if reg == -1 {
 		return fmt.Errorf("invalid register: %s", operands[0])
 	}
@@ -282,12 +549,12 @@ func (a *Assembler) encodePush(operands []string) error {
 	return nil
 }
 
-func (a *Assembler) encodePop(operands []string) error {
+func (a *Assembler) encodePop(operands []MachineOperand) error {
 	if len(operands) != 1 {
 		return fmt.Errorf("pop requires 1 operand")
 	}
 	
-	reg := parseRegister(operands[0])
+	reg := regOf(operands[0])
 	if reg == -1 {
 		return fmt.Errorf("invalid register: %s", operands[0])
 	}
@@ -299,913 +566,270 @@ func (a *Assembler) encodePop(operands []string) error {
 	return nil
 }
 
-func (a *Assembler) encodeMov(operands []string) error {
-	if len(operands) != 2 {
-		return fmt.Errorf("mov requires 2 operands")
-	}
-	
-	src := strings.TrimSuffix(strings.TrimSpace(operands[0]), ",")
-	dst := strings.TrimSpace(operands[1])
-	
-	// Check for immediate to register or memory
-	if strings.HasPrefix(src, "$") {
-		imm, err := parseImmediate(src)
+func (a *Assembler) encodeMov(operands []MachineOperand) error {
+	src, dst, err := operandPair("mov", operands)
+	if err != nil {
+		return err
+	}
+	srcReg, dstReg := regOf(src), regOf(dst)
+	srcMem, srcIsMem := memOf(src)
+	dstMem, dstIsMem := memOf(dst)
+	
+	switch {
+	case src.Kind == MOpImm:
+		imm, err := immValue(src)
 		if err != nil {
 			return err
 		}
-		
-		dstReg := parseRegister(dst)
-		if dstReg != -1 {
-			// Destination is register
-			// REX.W prefix for 64-bit
-			rex := byte(0x48)
-			if dstReg >= 8 {
-				rex |= 0x01
-			}
-			a.emit(rex)
-			
-			// Check if small immediate (can use sign-extended 32-bit)
-			if imm >= -2147483648 && imm <= 2147483647 {
-				a.emit(0xC7)
-				a.emit(0xC0 + byte(dstReg&7))
-				a.emitInt32(int32(imm))
-			} else {
-				a.emit(0xB8 + byte(dstReg&7))
-				a.emitInt64(imm)
-			}
-			return nil
-		}
-		
-		// Check if destination is memory
-		if strings.Contains(dst, "(%") && strings.HasSuffix(dst, ")") {
-			// Parse memory operand
-			memStr := dst
-			lastPct := strings.LastIndex(memStr, "%")
-			if lastPct == -1 {
-				return fmt.Errorf("invalid memory operand: %s", dst)
-			}
-			baseRegStr := memStr[lastPct:]
-			baseRegStr = strings.TrimSuffix(baseRegStr, ")")
-			baseReg := parseRegister(baseRegStr)
-			if baseReg == -1 {
-				return fmt.Errorf("invalid base register in: %s", dst)
-			}
-			
-			offsetStr := strings.TrimPrefix(memStr[:lastPct], "(")
-			offsetStr = strings.TrimSuffix(offsetStr, "(")
-			offset := int32(0)
-			if offsetStr != "" {
-				val, err := strconv.ParseInt(offsetStr, 10, 32)
-				if err != nil {
-					return fmt.Errorf("invalid offset in: %s", dst)
-				}
-				offset = int32(val)
-			}
-			
-			// movq $imm, offset(%base)
-			rex := byte(0x48)
-			if baseReg >= 8 {
-				rex |= 0x01 // REX.B
-				baseReg -= 8
-			}
-			a.emit(rex, 0xC7)
-			
-			// ModR/M for memory (opcode extension /0)
-			if offset == 0 && (baseReg&7) != 5 {
-				modrm := byte(0x00) | byte(baseReg&7)
-				a.emit(modrm)
-				if (baseReg & 7) == 4 {
-					a.emit(0x24)
-				}
-			} else if offset >= -128 && offset <= 127 {
-				modrm := byte(0x40) | byte(baseReg&7)
-				a.emit(modrm)
-				if (baseReg & 7) == 4 {
-					a.emit(0x24)
-				}
-				a.emit(byte(offset))
-			} else {
-				modrm := byte(0x80) | byte(baseReg&7)
-				a.emit(modrm)
-				if (baseReg & 7) == 4 {
-					a.emit(0x24)
-				}
-				a.emitInt32(offset)
-			}
+		switch {
+		case dstReg != -1 && imm == int64(int32(imm)):
+			// Sign-extended imm32: REX.W C7 /0 id
+			a.emitOp(true, 0xC7, 0, dstReg, nil)
 			a.emitInt32(int32(imm))
-			return nil
-		}
-		
-		return fmt.Errorf("invalid destination register: %s", dst)
-	}
-	
-	// Register to register
-	srcReg := parseRegister(src)
-	dstReg := parseRegister(dst)
-	
-	if srcReg != -1 && dstReg != -1 {
-		// REX.W prefix
-		rex := byte(0x48)
-		if srcReg >= 8 {
-			rex |= 0x04
-		}
-		if dstReg >= 8 {
-			rex |= 0x01
+		case dstReg != -1:
+			// REX.W B8+r io
+			a.emit(rexFor(true, 0, dstReg), 0xB8+byte(dstReg&7))
+			a.emitInt64(imm)
+		case dstIsMem && dstMem.base != -1:
+			// Not %rip: its displacement has to be the last field
+			a.emitOp(true, 0xC7, 0, -1, &dstMem)
+			a.emitInt32(int32(imm))
+		default:
+			return fmt.Errorf("invalid destination register: %s", dst)
 		}
-		a.emit(rex)
-		
-		a.emit(0x89)
-		modrm := byte(0xC0) | byte((srcReg&7)<<3) | byte(dstReg&7)
-		a.emit(modrm)
-		return nil
-	}
-	
-	// Check for memory-to-memory move (offset(%reg) to offset(%reg))
-	// Register indirect (%reg) is OK as source or dest
-	// RIP-relative (%rip) is also special
-	srcHasOffset := strings.Contains(src, "(%") && !strings.HasPrefix(src, "(") && !strings.Contains(src, "(%rip)")
-	dstHasOffset := strings.Contains(dst, "(%") && !strings.HasPrefix(dst, "(") && !strings.Contains(dst, "(%rip)")
-	
-	if srcHasOffset && dstHasOffset {
+	case srcReg != -1 && dstReg != -1:
+		a.emitOp(true, 0x89, srcReg, dstReg, nil)
+	case srcIsMem && dstIsMem:
 		return fmt.Errorf("memory-to-memory move not supported: movq %s, %s (code generator should split this)", src, dst)
+	case srcReg != -1 && dstIsMem:
+		a.emitOp(true, 0x89, srcReg, -1, &dstMem)
+	case srcIsMem && dstReg != -1:
+		a.emitOp(true, 0x8B, dstReg, -1, &srcMem)
+	default:
+		return fmt.Errorf("unsupported mov operands: %s, %s", src, dst)
 	}
-	
-	// Check for RIP-relative addressing: symbol(%rip)
-	if strings.Contains(src, "(%rip)") {
-		// movq symbol(%rip), %reg or movq symbol(%rip), mem
-		symbol := strings.TrimSuffix(src, "(%rip)")
-		symbol = strings.TrimSpace(symbol)
-		
-		if dstReg != -1 {
-			// Destination is register
-			rex := byte(0x48)
-			if dstReg >= 8 {
-				rex |= 0x04 // REX.R
-				dstReg -= 8
-			}
-			
-			a.emit(rex, 0x8B)
-			// ModR/M: 00 reg 101 (RIP-relative)
-			modrm := byte(0x05) | byte((dstReg&7)<<3)
-			a.emit(modrm)
-			
-			// Add relocation
-			a.relocations = append(a.relocations, Relocation{
-				Type:   R_X86_64_PC32,
-				Offset: uint64(len(a.code)),
-				Symbol: symbol,
-				Addend: -4,
-			})
-			a.emitInt32(0)
-			return nil
-		}
-		
-		// Destination is memory - not directly supported, but we can suggest split
-		return fmt.Errorf("movq %%rip, mem not directly supported - split into: movq %s, %%rax; movq %%rax, %s", src, dst)
-	}
-	
-	if strings.Contains(dst, "(%rip)") && srcReg != -1 {
-		// movq %reg, symbol(%rip) - store to RIP-relative address
-		symbol := strings.TrimSuffix(dst, "(%rip)")
-		symbol = strings.TrimSpace(symbol)
-		
-		rex := byte(0x48)
-		if srcReg >= 8 {
-			rex |= 0x04 // REX.R
-			srcReg -= 8
-		}
-		
-		a.emit(rex, 0x89)
-		// ModR/M: 00 reg 101 (RIP-relative)
-		modrm := byte(0x05) | byte((srcReg&7)<<3)
-		a.emit(modrm)
-		
-		// Add relocation
-		a.relocations = append(a.relocations, Relocation{
-			Type:   R_X86_64_PC32,
-			Offset: uint64(len(a.code)),
-			Symbol: symbol,
-			Addend: -4,
-		})
-		a.emitInt32(0)
-		return nil
-	}
-	
-	// Check for memory addressing: (%reg) or offset(%reg)
-	if strings.Contains(dst, "(%") && strings.HasSuffix(dst, ")") {
-		// movq %src, (%dst) or movq %src, offset(%dst) or movq mem, (%dst)
-		
-		// If source is also memory, this is a special case we'll handle
-		// For movq mem, (%reg), we can't encode directly - would need to be split
-		// But let's be helpful and provide better guidance
-		if srcReg == -1 {
-			if strings.Contains(src, "(%") {
-				// Both are memory - definitely not encodable
-				return fmt.Errorf("movq mem, mem not supported - split into: movq %s, %%rax; movq %%rax, %s", src, dst)
-			}
-			// Source is immediate or label
-			return fmt.Errorf("source must be register for memory store: %s to %s", src, dst)
-		}
-		
-		// Parse destination: (%reg) or offset(%reg)
-		memStr := dst
-		// Extract base register (everything after the last %)
-		lastPct := strings.LastIndex(memStr, "%")
-		if lastPct == -1 {
-			return fmt.Errorf("invalid memory operand: %s", dst)
-		}
-		baseRegStr := memStr[lastPct:]
-		baseRegStr = strings.TrimSuffix(baseRegStr, ")")
-		baseReg := parseRegister(baseRegStr)
-		if baseReg == -1 {
-			return fmt.Errorf("invalid base register in: %s", dst)
-		}
-		
-		// Extract offset (everything before the %)
-		offsetStr := strings.TrimPrefix(memStr[:lastPct], "(")
-		offsetStr = strings.TrimSuffix(offsetStr, "(")
-		offset := int32(0)
-		if offsetStr != "" {
-			val, err := strconv.ParseInt(offsetStr, 10, 32)
-			if err != nil {
-				return fmt.Errorf("invalid offset in: %s (offset: %s)", dst, offsetStr)
-			}
-			offset = int32(val)
-		}
-		
-		// REX.W prefix
-		rex := byte(0x48)
-		if srcReg >= 8 {
-			rex |= 0x04 // REX.R
-		}
-		if baseReg >= 8 {
-			rex |= 0x01 // REX.B
-		}
-		a.emit(rex, 0x89)
-		
-		// ModR/M byte
-		if offset == 0 && (baseReg&7) != 5 { // Not RBP
-			// [base] - mod=00
-			modrm := byte(0x00) | byte((srcReg&7)<<3) | byte(baseReg&7)
-			a.emit(modrm)
-			if (baseReg & 7) == 4 { // RSP needs SIB
-				a.emit(0x24) // SIB: scale=0, index=none, base=RSP
-			}
-		} else if offset >= -128 && offset <= 127 {
-			// [base+disp8] - mod=01
-			modrm := byte(0x40) | byte((srcReg&7)<<3) | byte(baseReg&7)
-			a.emit(modrm)
-			if (baseReg & 7) == 4 { // RSP needs SIB
-				a.emit(0x24)
-			}
-			a.emit(byte(offset))
-		} else {
-			// [base+disp32] - mod=10
-			modrm := byte(0x80) | byte((srcReg&7)<<3) | byte(baseReg&7)
-			a.emit(modrm)
-			if (baseReg & 7) == 4 { // RSP needs SIB
-				a.emit(0x24)
-			}
-			a.emitInt32(offset)
-		}
-		return nil
-	}
-	
-	if strings.Contains(src, "(%") && strings.HasSuffix(src, ")") {
-		// movq (%src), %dst or movq offset(%src), %dst
-		if dstReg == -1 {
-			return fmt.Errorf("destination must be register for memory load")
-		}
-		
-		// Parse source: (%reg) or offset(%reg)
-		memStr := src
-		// Extract base register (everything after the last %)
-		lastPct := strings.LastIndex(memStr, "%")
-		if lastPct == -1 {
-			return fmt.Errorf("invalid memory operand: %s", src)
-		}
-		baseRegStr := memStr[lastPct:]
-		baseRegStr = strings.TrimSuffix(baseRegStr, ")")
-		baseReg := parseRegister(baseRegStr)
-		if baseReg == -1 {
-			return fmt.Errorf("invalid base register in: %s", src)
-		}
-		
-		// Extract offset (everything before the %)
-		offsetStr := strings.TrimPrefix(memStr[:lastPct], "(")
-		offsetStr = strings.TrimSuffix(offsetStr, "(")
-		offset := int32(0)
-		if offsetStr != "" {
-			val, err := strconv.ParseInt(offsetStr, 10, 32)
-			if err != nil {
-				return fmt.Errorf("invalid offset in: %s (offset: %s)", src, offsetStr)
-			}
-			offset = int32(val)
-		}
-		
-		// REX.W prefix
-		rex := byte(0x48)
-		if dstReg >= 8 {
-			rex |= 0x04 // REX.R
-		}
-		if baseReg >= 8 {
-			rex |= 0x01 // REX.B
-		}
-		a.emit(rex, 0x8B)
-		
-		// ModR/M byte
-		if offset == 0 && (baseReg&7) != 5 { // Not RBP
-			// [base] - mod=00
-			modrm := byte(0x00) | byte((dstReg&7)<<3) | byte(baseReg&7)
-			a.emit(modrm)
-			if (baseReg & 7) == 4 { // RSP needs SIB
-				a.emit(0x24)
-			}
-		} else if offset >= -128 && offset <= 127 {
-			// [base+disp8] - mod=01
-			modrm := byte(0x40) | byte((dstReg&7)<<3) | byte(baseReg&7)
-			a.emit(modrm)
-			if (baseReg & 7) == 4 { // RSP needs SIB
-				a.emit(0x24)
-			}
-			a.emit(byte(offset))
-		} else {
-			// [base+disp32] - mod=10
-			modrm := byte(0x80) | byte((dstReg&7)<<3) | byte(baseReg&7)
-			a.emit(modrm)
-			if (baseReg & 7) == 4 { // RSP needs SIB
-				a.emit(0x24)
-			}
-			a.emitInt32(offset)
-		}
-		return nil
-	}
-	
-	return fmt.Errorf("unsupported mov operands: %s, %s", src, dst)
+	return nil
 }
 
-func (a *Assembler) encodeAdd(operands []string) error {
+func (a *Assembler) encodeAdd(operands []MachineOperand) error {
 	return a.encodeALU(0x01, 0x81, 0, operands)
 }
 
-func (a *Assembler) encodeSub(operands []string) error {
+func (a *Assembler) encodeSub(operands []MachineOperand) error {
 	return a.encodeALU(0x29, 0x81, 5, operands)
 }
 
-func (a *Assembler) encodeImul(operands []string) error {
-	if len(operands) != 2 {
-		return fmt.Errorf("imul requires 2 operands")
+func (a *Assembler) encodeImul(operands []MachineOperand) error {
+	src, dst, err := operandPair("imul", operands)
+	if err != nil {
+		return err
+	}
+	dstReg := regOf(dst)
+	if dstReg == -1 {
+		return fmt.Errorf("destination must be register for imul")
 	}
 	
-	src := strings.TrimSuffix(strings.TrimSpace(operands[0]), ",")
-	dst := strings.TrimSpace(operands[1])
-	
-	// Check for immediate source: imulq $imm, %reg
-	if strings.HasPrefix(src, "$") {
-		dstReg := parseRegister(dst)
-		if dstReg == -1 {
-			return fmt.Errorf("destination must be register for imul")
-		}
-		
-		imm, err := parseImmediate(src)
+	// imulq $imm, %reg is the three-operand form with the register twice
+	if src.Kind == MOpImm {
+		imm, err := immValue(src)
 		if err != nil {
 			return err
 		}
-		
-		rex := byte(0x48)
-		if dstReg >= 8 {
-			rex |= 0x05 // REX.RB (dst is both src and dst)
-			dstReg -= 8
-		}
-		a.emit(rex)
-		
-		// Use imul r64, r64, imm32 form (opcode 0x69)
 		if imm >= -128 && imm <= 127 {
 			// Sign-extended imm8
-			a.emit(0x6B)
-			modrm := byte(0xC0) | byte((dstReg&7)<<3) | byte(dstReg&7)
-			a.emit(modrm)
+			a.emitOp(true, 0x6B, dstReg, dstReg, nil)
 			a.emit(byte(imm))
 		} else {
-			// imm32
-			a.emit(0x69)
-			modrm := byte(0xC0) | byte((dstReg&7)<<3) | byte(dstReg&7)
-			a.emit(modrm)
+			a.emitOp(true, 0x69, dstReg, dstReg, nil)
 			a.emitInt32(int32(imm))
 		}
 		return nil
 	}
 	
-	srcReg := parseRegister(src)
-	dstReg := parseRegister(dst)
-	
-	// Check for imulq mem, %reg
-	if srcReg == -1 && dstReg != -1 && strings.Contains(src, "(%") && strings.HasSuffix(src, ")") {
-		// Parse memory operand
-		memStr := src
-		lastPct := strings.LastIndex(memStr, "%")
-		if lastPct == -1 {
-			return fmt.Errorf("invalid memory operand: %s", src)
-		}
-		baseRegStr := memStr[lastPct:]
-		baseRegStr = strings.TrimSuffix(baseRegStr, ")")
-		baseReg := parseRegister(baseRegStr)
-		if baseReg == -1 {
-			return fmt.Errorf("invalid base register in: %s", src)
-		}
-		
-		offsetStr := strings.TrimPrefix(memStr[:lastPct], "(")
-		offsetStr = strings.TrimSuffix(offsetStr, "(")
-		offset := int32(0)
-		if offsetStr != "" {
-			val, err := strconv.ParseInt(offsetStr, 10, 32)
-			if err != nil {
-				return fmt.Errorf("invalid offset in: %s", src)
-			}
-			offset = int32(val)
-		}
-		
-		// imulq mem, %reg uses opcode 0x0F 0xAF
-		rex := byte(0x48)
-		if dstReg >= 8 {
-			rex |= 0x04 // REX.R
-			dstReg -= 8
-		}
-		if baseReg >= 8 {
-			rex |= 0x01 // REX.B
-			baseReg -= 8
-		}
-		a.emit(rex, 0x0F, 0xAF)
-		
-		// ModR/M
-		if offset == 0 && (baseReg&7) != 5 {
-			modrm := byte(0x00) | byte((dstReg&7)<<3) | byte(baseReg&7)
-			a.emit(modrm)
-			if (baseReg & 7) == 4 {
-				a.emit(0x24)
-			}
-		} else if offset >= -128 && offset <= 127 {
-			modrm := byte(0x40) | byte((dstReg&7)<<3) | byte(baseReg&7)
-			a.emit(modrm)
-			if (baseReg & 7) == 4 {
-				a.emit(0x24)
-			}
-			a.emit(byte(offset))
-		} else {
-			modrm := byte(0x80) | byte((dstReg&7)<<3) | byte(baseReg&7)
-			a.emit(modrm)
-			if (baseReg & 7) == 4 {
-				a.emit(0x24)
-			}
-			a.emitInt32(offset)
-		}
+	// imulq r/m64, %reg: REX.W 0F AF /r
+	if srcReg := regOf(src); srcReg != -1 {
+		a.emitSSE(0, true, 0xAF, dstReg, srcReg, nil)
 		return nil
 	}
-	
-	if srcReg == -1 || dstReg == -1 {
+	mem, ok := memOf(src)
+	if !ok {
 		return fmt.Errorf("imul requires register operands")
 	}
-	
-	rex := byte(0x48)
-	if dstReg >= 8 {
-		rex |= 0x04
-	}
-	if srcReg >= 8 {
-		rex |= 0x01
-	}
-	a.emit(rex)
-	
-	a.emit(0x0F, 0xAF)
-	modrm := byte(0xC0) | byte((dstReg&7)<<3) | byte(srcReg&7)
-	a.emit(modrm)
+	a.emitSSE(0, true, 0xAF, dstReg, -1, &mem)
 	return nil
 }
 
-func (a *Assembler) encodeIdiv(operands []string) error {
+func (a *Assembler) encodeIdiv(operands []MachineOperand) error {
 	if len(operands) != 1 {
 		return fmt.Errorf("idiv requires 1 operand")
 	}
 	
-	op := strings.TrimSpace(operands[0])
-	reg := parseRegister(op)
-	
-	if reg == -1 {
-		// Check for memory operand
-		if strings.Contains(op, "(%") && strings.HasSuffix(op, ")") {
-			// Parse memory operand
-			memStr := op
-			lastPct := strings.LastIndex(memStr, "%")
-			if lastPct == -1 {
-				return fmt.Errorf("invalid memory operand: %s", op)
-			}
-			baseRegStr := memStr[lastPct:]
-			baseRegStr = strings.TrimSuffix(baseRegStr, ")")
-			baseReg := parseRegister(baseRegStr)
-			if baseReg == -1 {
-				return fmt.Errorf("invalid base register in: %s", op)
-			}
-			
-			offsetStr := strings.TrimPrefix(memStr[:lastPct], "(")
-			offsetStr = strings.TrimSuffix(offsetStr, "(")
-			offset := int32(0)
-			if offsetStr != "" {
-				val, err := strconv.ParseInt(offsetStr, 10, 32)
-				if err != nil {
-					return fmt.Errorf("invalid offset in: %s", op)
-				}
-				offset = int32(val)
-			}
-			
-			rex := byte(0x48)
-			if baseReg >= 8 {
-				rex |= 0x01 // REX.B
-				baseReg -= 8
-			}
-			a.emit(rex, 0xF7)
-			
-			// ModR/M for idiv /7
-			if offset == 0 && (baseReg&7) != 5 {
-				modrm := byte(0x38) | byte(baseReg&7) // /7 = 111 in bits 5-3
-				a.emit(modrm)
-				if (baseReg & 7) == 4 {
-					a.emit(0x24)
-				}
-			} else if offset >= -128 && offset <= 127 {
-				modrm := byte(0x78) | byte(baseReg&7) // mod=01, /7
-				a.emit(modrm)
-				if (baseReg & 7) == 4 {
-					a.emit(0x24)
-				}
-				a.emit(byte(offset))
-			} else {
-				modrm := byte(0xB8) | byte(baseReg&7) // mod=10, /7
-				a.emit(modrm)
-				if (baseReg & 7) == 4 {
-					a.emit(0x24)
-				}
-				a.emitInt32(offset)
-			}
-			return nil
-		}
-		return fmt.Errorf("invalid register: %s", op)
+	// F7 /7
+	if reg := regOf(operands[0]); reg != -1 {
+		a.emitOp(true, 0xF7, 7, reg, nil)
+		return nil
 	}
-	
-	rex := byte(0x48)
-	if reg >= 8 {
-		rex |= 0x01
+	mem, ok := memOf(operands[0])
+	if !ok {
+		return fmt.Errorf("invalid register: %s", operands[0])
 	}
-	a.emit(rex)
-	
-	a.emit(0xF7)
-	a.emit(0xF8 + byte(reg&7))
+	a.emitOp(true, 0xF7, 7, -1, &mem)
 	return nil
 }
 
-func (a *Assembler) encodeCmp(operands []string) error {
+func (a *Assembler) encodeCmp(operands []MachineOperand) error {
 	return a.encodeALU(0x39, 0x81, 7, operands)
 }
 
-func (a *Assembler) encodeAnd(operands []string) error {
+func (a *Assembler) encodeAnd(operands []MachineOperand) error {
 	return a.encodeALU(0x21, 0x81, 4, operands)
 }
 
-func (a *Assembler) encodeOr(operands []string) error {
+func (a *Assembler) encodeOr(operands []MachineOperand) error {
 	return a.encodeALU(0x09, 0x81, 1, operands)
 }
 
-func (a *Assembler) encodeXor(operands []string) error {
+func (a *Assembler) encodeXor(operands []MachineOperand) error {
 	return a.encodeALU(0x31, 0x81, 6, operands)
 }
 
-func (a *Assembler) encodeALU(regOpcode, immOpcode byte, immExt byte, operands []string) error {
+// encodeALU handles the two-operand integer ops: regOpcode /r stores into
+// r/m (+2 loads from it), immOpcode /immExt takes an imm32
+func (a *Assembler) encodeALU(regOpcode, immOpcode byte, immExt byte, operands []MachineOperand) error {
 	if len(operands) != 2 {
 		return fmt.Errorf("ALU op requires 2 operands")
 	}
+	src, dst := operands[0], operands[1]
+	srcReg, dstReg := regOf(src), regOf(dst)
+	srcMem, srcIsMem := memOf(src)
+	dstMem, dstIsMem := memOf(dst)
 	
-	src := strings.TrimSuffix(strings.TrimSpace(operands[0]), ",")
-	dst := strings.TrimSpace(operands[1])
-	
-	if strings.HasPrefix(src, "$") {
-		dstReg := parseRegister(dst)
-		
-		if dstReg == -1 {
-			// Destination might be memory: op $imm, offset(%base)
-			if strings.Contains(dst, "(%") && strings.HasSuffix(dst, ")") {
-				// Parse memory operand
-				memStr := dst
-				lastPct := strings.LastIndex(memStr, "%")
-				if lastPct == -1 {
-					return fmt.Errorf("invalid memory operand: %s", dst)
-				}
-				baseRegStr := memStr[lastPct:]
-				baseRegStr = strings.TrimSuffix(baseRegStr, ")")
-				baseReg := parseRegister(baseRegStr)
-				if baseReg == -1 {
-					return fmt.Errorf("invalid base register in: %s", dst)
-				}
-				
-				offsetStr := strings.TrimPrefix(memStr[:lastPct], "(")
-				offsetStr = strings.TrimSuffix(offsetStr, "(")
-				offset := int32(0)
-				if offsetStr != "" {
-					val, err := strconv.ParseInt(offsetStr, 10, 32)
-					if err != nil {
-						return fmt.Errorf("invalid offset in: %s", dst)
-					}
-					offset = int32(val)
-				}
-				
-				imm, err := parseImmediate(src)
-				if err != nil {
-					return err
-				}
-				
-				rex := byte(0x48)
-				if baseReg >= 8 {
-					rex |= 0x01 // REX.B
-					baseReg -= 8
-				}
-				a.emit(rex, immOpcode)
-				
-				// ModR/M for memory
-				if offset == 0 && (baseReg&7) != 5 {
-					modrm := byte(0x00) | byte(immExt<<3) | byte(baseReg&7)
-					a.emit(modrm)
-					if (baseReg & 7) == 4 {
-						a.emit(0x24)
-					}
-				} else if offset >= -128 && offset <= 127 {
-					modrm := byte(0x40) | byte(immExt<<3) | byte(baseReg&7)
-					a.emit(modrm)
-					if (baseReg & 7) == 4 {
-						a.emit(0x24)
-					}
-					a.emit(byte(offset))
-				} else {
-					modrm := byte(0x80) | byte(immExt<<3) | byte(baseReg&7)
-					a.emit(modrm)
-					if (baseReg & 7) == 4 {
-						a.emit(0x24)
-					}
-					a.emitInt32(offset)
-				}
-				a.emitInt32(int32(imm))
-				return nil
-			}
-			return fmt.Errorf("invalid destination: %s", dst)
-		}
-		
-		imm, err := parseImmediate(src)
+	switch {
+	case src.Kind == MOpImm:
+		imm, err := immValue(src)
 		if err != nil {
 			return err
 		}
-		
-		rex := byte(0x48)
-		if dstReg >= 8 {
-			rex |= 0x01
+		switch {
+		case dstReg != -1:
+			a.emitOp(true, immOpcode, int(immExt), dstReg, nil)
+		case dstIsMem && dstMem.base != -1:
+			// Not %rip: its displacement has to be the last field
+			a.emitOp(true, immOpcode, int(immExt), -1, &dstMem)
+		default:
+			return fmt.Errorf("invalid destination: %s", dst)
 		}
-		a.emit(rex)
-		
-		a.emit(immOpcode)
-		modrm := byte(0xC0) | byte(immExt<<3) | byte(dstReg&7)
-		a.emit(modrm)
 		a.emitInt32(int32(imm))
-		return nil
-	}
-	
-	srcReg := parseRegister(src)
-	dstReg := parseRegister(dst)
-	
-	if srcReg != -1 && dstReg != -1 {
-		rex := byte(0x48)
-		if srcReg >= 8 {
-			rex |= 0x04
-		}
-		if dstReg >= 8 {
-			rex |= 0x01
-		}
-		a.emit(rex)
-		
-		a.emit(regOpcode)
-		modrm := byte(0xC0) | byte((srcReg&7)<<3) | byte(dstReg&7)
-		a.emit(modrm)
-		return nil
-	}
-	
-	// Check for ALU reg, memory: op %reg, offset(%base)
-	if srcReg != -1 && strings.Contains(dst, "(%") && strings.HasSuffix(dst, ")") {
-		// Parse memory operand
-		memStr := dst
-		lastPct := strings.LastIndex(memStr, "%")
-		if lastPct == -1 {
-			return fmt.Errorf("invalid memory operand: %s", dst)
-		}
-		baseRegStr := memStr[lastPct:]
-		baseRegStr = strings.TrimSuffix(baseRegStr, ")")
-		baseReg := parseRegister(baseRegStr)
-		if baseReg == -1 {
-			return fmt.Errorf("invalid base register in: %s", dst)
-		}
-		
-		offsetStr := strings.TrimPrefix(memStr[:lastPct], "(")
-		offsetStr = strings.TrimSuffix(offsetStr, "(")
-		offset := int32(0)
-		if offsetStr != "" {
-			val, err := strconv.ParseInt(offsetStr, 10, 32)
-			if err != nil {
-				return fmt.Errorf("invalid offset in: %s", dst)
-			}
-			offset = int32(val)
-		}
-		
-		rex := byte(0x48)
-		if srcReg >= 8 {
-			rex |= 0x04 // REX.R
-			srcReg -= 8
-		}
-		if baseReg >= 8 {
-			rex |= 0x01 // REX.B
-			baseReg -= 8
-		}
-		a.emit(rex, regOpcode)
-		
-		// ModR/M
-		if offset == 0 && (baseReg&7) != 5 {
-			modrm := byte(0x00) | byte((srcReg&7)<<3) | byte(baseReg&7)
-			a.emit(modrm)
-			if (baseReg & 7) == 4 {
-				a.emit(0x24)
-			}
-		} else if offset >= -128 && offset <= 127 {
-			modrm := byte(0x40) | byte((srcReg&7)<<3) | byte(baseReg&7)
-			a.emit(modrm)
-			if (baseReg & 7) == 4 {
-				a.emit(0x24)
-			}
-			a.emit(byte(offset))
-		} else {
-			modrm := byte(0x80) | byte((srcReg&7)<<3) | byte(baseReg&7)
-			a.emit(modrm)
-			if (baseReg & 7) == 4 {
-				a.emit(0x24)
-			}
-			a.emitInt32(offset)
-		}
-		return nil
-	}
-	
-	// Check for ALU memory, reg: op offset(%base), %reg
-	if dstReg != -1 && strings.Contains(src, "(%") && strings.HasSuffix(src, ")") {
-		// Parse memory operand
-		memStr := src
-		lastPct := strings.LastIndex(memStr, "%")
-		if lastPct == -1 {
-			return fmt.Errorf("invalid memory operand: %s", src)
-		}
-		baseRegStr := memStr[lastPct:]
-		baseRegStr = strings.TrimSuffix(baseRegStr, ")")
-		baseReg := parseRegister(baseRegStr)
-		if baseReg == -1 {
-			return fmt.Errorf("invalid base register in: %s", src)
-		}
-		
-		offsetStr := strings.TrimPrefix(memStr[:lastPct], "(")
-		offsetStr = strings.TrimSuffix(offsetStr, "(")
-		offset := int32(0)
-		if offsetStr != "" {
-			val, err := strconv.ParseInt(offsetStr, 10, 32)
-			if err != nil {
-				return fmt.Errorf("invalid offset in: %s", src)
-			}
-			offset = int32(val)
-		}
-		
-		rex := byte(0x48)
-		if dstReg >= 8 {
-			rex |= 0x04 // REX.R
-			dstReg -= 8
-		}
-		if baseReg >= 8 {
-			rex |= 0x01 // REX.B
-			baseReg -= 8
-		}
-		// Use reverse opcode (add 0x02 to regOpcode)
-		a.emit(rex, regOpcode+0x02)
-		
-		// ModR/M
-		if offset == 0 && (baseReg&7) != 5 {
-			modrm := byte(0x00) | byte((dstReg&7)<<3) | byte(baseReg&7)
-			a.emit(modrm)
-			if (baseReg & 7) == 4 {
-				a.emit(0x24)
-			}
-		} else if offset >= -128 && offset <= 127 {
-			modrm := byte(0x40) | byte((dstReg&7)<<3) | byte(baseReg&7)
-			a.emit(modrm)
-			if (baseReg & 7) == 4 {
-				a.emit(0x24)
-			}
-			a.emit(byte(offset))
-		} else {
-			modrm := byte(0x80) | byte((dstReg&7)<<3) | byte(baseReg&7)
-			a.emit(modrm)
-			if (baseReg & 7) == 4 {
-				a.emit(0x24)
-			}
-			a.emitInt32(offset)
-		}
-		return nil
+	case srcReg != -1 && dstReg != -1:
+		a.emitOp(true, regOpcode, srcReg, dstReg, nil)
+	case srcReg != -1 && dstIsMem:
+		a.emitOp(true, regOpcode, srcReg, -1, &dstMem)
+	case srcIsMem && dstReg != -1:
+		a.emitOp(true, regOpcode+0x02, dstReg, -1, &srcMem)
+	default:
+		return fmt.Errorf("unsupported ALU operands")
 	}
-	
-	return fmt.Errorf("unsupported ALU operands")
+	return nil
 }
 
-func (a *Assembler) encodeCall(operands []string) error {
+func (a *Assembler) encodeCall(operands []MachineOperand) error {
 	if len(operands) != 1 {
 		return fmt.Errorf("call requires 1 operand")
 	}
 	
 	target := operands[0]
 	
-	// Direct call
-	if !strings.HasPrefix(target, "*") {
+	// Direct call (always rel32; resolved after layout or left as a relocation)
+	if target.Kind == MOpSymbol && !target.Indirect {
 		a.emit(0xE8)
-		
-		if addr, ok := a.labelTargets[target]; ok {
-			offset := int32(addr - (len(a.code) + 4))
-			a.emitInt32(offset)
-		} else {
-			a.relocations = append(a.relocations, Relocation{
-				Type:   R_X86_64_PC32,
-				Offset: uint64(len(a.code)),
-				Symbol: target,
-				Addend: -4,
-			})
-			a.emitInt32(0)
-		}
+		a.fixups = append(a.fixups, jumpFixup{offset: len(a.code), size: 4, label: target.Symbol, instr: a.instrIndex})
+		a.emitInt32(0)
 		return nil
 	}
 	
-	return fmt.Errorf("indirect call not yet supported")
+	// Through a register: FF /2
+	if !target.Indirect {
+		return fmt.Errorf("invalid call target: %s", target)
+	}
+	target.Indirect = false
+	reg := regOf(target)
+	if reg == -1 {
+		return fmt.Errorf("indirect call through memory not yet supported")
+	}
+	if reg >= 8 {
+		a.emit(0x41)  // REX.B for R8-R15
+	}
+	a.emit(0xFF, 0xD0+byte(reg&7))
+	return nil
 }
 
-func (a *Assembler) encodeJmp(operands []string) error {
+func (a *Assembler) encodeJmp(operands []MachineOperand) error {
 	return a.encodeConditionalJump(0xE9, operands)
 }
 
-func (a *Assembler) encodeJe(operands []string) error {
+func (a *Assembler) encodeJe(operands []MachineOperand) error {
 	return a.encodeConditionalJump(0x84, operands)
 }
 
-func (a *Assembler) encodeJne(operands []string) error {
+func (a *Assembler) encodeJne(operands []MachineOperand) error {
 	return a.encodeConditionalJump(0x85, operands)
 }
 
-func (a *Assembler) encodeJl(operands []string) error {
+func (a *Assembler) encodeJl(operands []MachineOperand) error {
 	return a.encodeConditionalJump(0x8C, operands)
 }
 
-func (a *Assembler) encodeJle(operands []string) error {
+func (a *Assembler) encodeJle(operands []MachineOperand) error {
 	return a.encodeConditionalJump(0x8E, operands)
 }
 
-func (a *Assembler) encodeJg(operands []string) error {
+func (a *Assembler) encodeJg(operands []MachineOperand) error {
 	return a.encodeConditionalJump(0x8F, operands)
 }
 
-func (a *Assembler) encodeJge(operands []string) error {
+func (a *Assembler) encodeJge(operands []MachineOperand) error {
 	return a.encodeConditionalJump(0x8D, operands)
 }
 
-func (a *Assembler) encodeConditionalJump(opcode byte, operands []string) error {
+func (a *Assembler) encodeConditionalJump(opcode byte, operands []MachineOperand) error {
 	if len(operands) != 1 {
 		return fmt.Errorf("jump requires 1 operand")
 	}
 	
-	target := operands[0]
+	if operands[0].Kind != MOpSymbol || operands[0].Indirect {
+		return fmt.Errorf("invalid jump target: %s", operands[0])
+	}
+	target := operands[0].Symbol
+	
+	// Short form: EB rel8 for jmp, 7x rel8 for jcc (near opcode 0F 8x)
+	if !a.longJumps[a.instrIndex] {
+		if opcode == 0xE9 {
+			a.emit(0xEB)
+		} else {
+			a.emit(opcode - 0x10)
+		}
+		a.fixups = append(a.fixups, jumpFixup{offset: len(a.code), size: 1, label: target, instr: a.instrIndex})
+		a.emit(0)
+		return nil
+	}
 	
 	if opcode == 0xE9 {
 		a.emit(0xE9)
 	} else {
 		a.emit(0x0F, opcode)
 	}
-	
-	if addr, ok := a.labelTargets[target]; ok {
-		offset := int32(addr - (len(a.code) + 4))
-		a.emitInt32(offset)
-	} else {
-		a.emitInt32(0)
-	}
+	a.fixups = append(a.fixups, jumpFixup{offset: len(a.code), size: 4, label: target, instr: a.instrIndex})
+	a.emitInt32(0)
 	
 	return nil
 }
 
-func (a *Assembler) encodeSetCC(opcode byte, operands []string) error {
+func (a *Assembler) encodeSetCC(opcode byte, operands []MachineOperand) error {
 	if len(operands) != 1 {
 		return fmt.Errorf("setCC requires 1 operand")
 	}
 	
-	reg := parseRegister(operands[0])
+	reg := regOf(operands[0])
 	if reg == -1 {
 		return fmt.Errorf("invalid register: %s", operands[0])
 	}
@@ -1219,69 +843,268 @@ func (a *Assembler) encodeSetCC(opcode byte, operands []string) error {
 	return nil
 }
 
-func (a *Assembler) encodeMovzbq(operands []string) error {
-	if len(operands) != 2 {
-		return fmt.Errorf("movzbq requires 2 operands")
+func (a *Assembler) encodeMovzbq(operands []MachineOperand) error {
+	src, dst, err := operandPair("movzbq", operands)
+	if err != nil {
+		return err
 	}
-	
-	src := strings.TrimSuffix(strings.TrimSpace(operands[0]), ",")
-	dst := strings.TrimSpace(operands[1])
-	
-	srcReg := parseRegister(src)
-	dstReg := parseRegister(dst)
-	
+	srcReg, dstReg := regOf(src), regOf(dst)
 	if srcReg == -1 || dstReg == -1 {
 		return fmt.Errorf("movzbq requires register operands")
 	}
 	
 	// MOVZX with REX.W for 64-bit destination
-	rex := byte(0x48)
-	if dstReg >= 8 {
-		rex |= 0x04
+	a.emitSSE(0, true, 0xB6, dstReg, srcReg, nil)
+	return nil
+}
+
+// emitOp emits REX, a one-byte opcode and the ModR/M for reg and r/m.
+// rmReg is used when r/m is a register, otherwise mem is used.
+func (a *Assembler) emitOp(w bool, opcode byte, reg int, rmReg int, mem *memOperand) {
+	rex := rexFor(w, reg, rmReg)
+	if mem != nil {
+		rex = mem.rex(w, reg)
+	}
+	if rex != 0 {
+		a.emit(rex)
 	}
-	if srcReg >= 8 {
-		rex |= 0x01
+	a.emit(opcode)
+	if mem != nil {
+		a.emitModRMMem(reg, *mem)
+		return
 	}
-	a.emit(rex)
-	
-	a.emit(0x0F, 0xB6)
-	modrm := byte(0xC0) | byte((dstReg&7)<<3) | byte(srcReg&7)
-	a.emit(modrm)
+	a.emit(byte(0xC0) | byte((reg&7)<<3) | byte(rmReg&7))
+}
+
+// encodeAtomic handles the read-modify-write instructions of atomics.go,
+// register into memory at any width: xchg (86/87 /r), xadd (0F C0/C1 /r)
+// and add (00/01 /r, addq has encodeAdd)
+func (a *Assembler) encodeAtomic(name string, operands []MachineOperand) error {
+	src, dst, err := operandPair(name, operands)
+	if err != nil {
+		return err
+	}
+	srcReg := regOf(src)
+	mem, ok := memOf(dst)
+	if srcReg == -1 || !ok {
+		return fmt.Errorf("unsupported %s operands: %s, %s", name, src, dst)
+	}
+	op, suffix := name[:len(name)-1], name[len(name)-1]
+	opcode := map[string]byte{"xchg": 0x87, "xadd": 0xC1, "add": 0x01}[op]
+	if suffix == 'b' {
+		// The byte forms are one less
+		opcode--
+	}
+	if suffix == 'w' {
+		a.emit(0x66)
+	}
+	if op == "xadd" {
+		a.emitSSE(0, suffix == 'q', opcode, srcReg, -1, &mem)
+		return nil
+	}
+	a.emitOp(suffix == 'q', opcode, srcReg, -1, &mem)
 	return nil
 }
 
-func (a *Assembler) encodeTest(operands []string) error {
-	if len(operands) != 2 {
-		return fmt.Errorf("test requires 2 operands")
+// encodeMovx handles the extending moves movzbl, movzwl, movsbq and movswq
+// (0F opcode /r) from a register or memory
+func (a *Assembler) encodeMovx(w bool, opcode byte, name string, operands []MachineOperand) error {
+	src, dst, err := operandPair(name, operands)
+	if err != nil {
+		return err
+	}
+	dstReg := regOf(dst)
+	if dstReg == -1 {
+		return fmt.Errorf("%s destination must be a register: %s", name, dst)
+	}
+	if srcReg := regOf(src); srcReg != -1 {
+		a.emitSSE(0, w, opcode, dstReg, srcReg, nil)
+		return nil
 	}
-	
-	src := strings.TrimSuffix(strings.TrimSpace(operands[0]), ",")
-	dst := strings.TrimSpace(operands[1])
-	
-	srcReg := parseRegister(src)
-	dstReg := parseRegister(dst)
-	
-	if srcReg != -1 && dstReg != -1 {
-		rex := byte(0x48)
-		if srcReg >= 8 {
-			rex |= 0x04
+	mem, ok := memOf(src)
+	if !ok {
+		return fmt.Errorf("invalid %s source: %s", name, src)
+	}
+	a.emitSSE(0, w, opcode, dstReg, -1, &mem)
+	return nil
+}
+
+// encodeMovslq handles movslq (REX.W 63 /r) from a register or memory
+func (a *Assembler) encodeMovslq(operands []MachineOperand) error {
+	src, dst, err := operandPair("movslq", operands)
+	if err != nil {
+		return err
+	}
+	dstReg := regOf(dst)
+	if dstReg == -1 {
+		return fmt.Errorf("movslq destination must be a register: %s", dst)
+	}
+	if srcReg := regOf(src); srcReg != -1 {
+		a.emitOp(true, 0x63, dstReg, srcReg, nil)
+		return nil
+	}
+	mem, ok := memOf(src)
+	if !ok {
+		return fmt.Errorf("invalid movslq source: %s", src)
+	}
+	a.emitOp(true, 0x63, dstReg, -1, &mem)
+	return nil
+}
+
+// encodeMovl handles 32-bit moves between registers and memory, and of
+// immediates into registers. Writing a 32-bit register zeros its upper half.
+func (a *Assembler) encodeMovl(operands []MachineOperand) error {
+	src, dst, err := operandPair("movl", operands)
+	if err != nil {
+		return err
+	}
+	srcReg, dstReg := regOf(src), regOf(dst)
+	switch {
+	case src.Kind == MOpImm && dstReg != -1:
+		imm, err := immValue(src)
+		if err != nil {
+			return err
 		}
-		if dstReg >= 8 {
-			rex |= 0x01
+		// C7 /0 id
+		a.emitOp(false, 0xC7, 0, dstReg, nil)
+		a.emitInt32(int32(imm))
+	case srcReg != -1 && dstReg != -1:
+		a.emitOp(false, 0x89, srcReg, dstReg, nil)
+	case dstReg != -1:
+		mem, ok := memOf(src)
+		if !ok {
+			return fmt.Errorf("invalid movl source: %s", src)
+		}
+		a.emitOp(false, 0x8B, dstReg, -1, &mem)
+	case srcReg != -1:
+		mem, ok := memOf(dst)
+		if !ok {
+			return fmt.Errorf("invalid movl destination: %s", dst)
+		}
+		a.emitOp(false, 0x89, srcReg, -1, &mem)
+	default:
+		return fmt.Errorf("unsupported movl operands: %s, %s", src, dst)
+	}
+	return nil
+}
+
+// encodeNarrowMov handles movb (88/8A /r, C6 /0 ib) and movw (66 89/8B /r,
+// 66 C7 /0 iw) between registers and memory, and of immediates into memory.
+// %spl, %bpl, %sil and %dil are only reachable with a REX prefix.
+func (a *Assembler) encodeNarrowMov(name string, operands []MachineOperand) error {
+	src, dst, err := operandPair(name, operands)
+	if err != nil {
+		return err
+	}
+	byteOp := name == "movb"
+	opcode := func(op byte) byte {
+		if byteOp {
+			return op - 1
+		}
+		a.emit(0x66)
+		return op
+	}
+	emit := func(op byte, reg, rmReg int, mem *memOperand) {
+		op = opcode(op)
+		rex := rexFor(false, reg, rmReg)
+		if mem != nil {
+			rex = mem.rex(false, reg)
+		}
+		if byteOp && rex == 0 && (reg >= 4 || (mem == nil && rmReg >= 4)) {
+			rex = 0x40
+		}
+		if rex != 0 {
+			a.emit(rex)
 		}
-		a.emit(rex)
-		
-		a.emit(0x85)
-		modrm := byte(0xC0) | byte((srcReg&7)<<3) | byte(dstReg&7)
-		a.emit(modrm)
+		a.emit(op)
+		if mem != nil {
+			a.emitModRMMem(reg, *mem)
+			return
+		}
+		a.emit(byte(0xC0) | byte((reg&7)<<3) | byte(rmReg&7))
+	}
+	srcReg, dstReg := regOf(src), regOf(dst)
+	switch {
+	case src.Kind == MOpImm:
+		imm, err := immValue(src)
+		if err != nil {
+			return err
+		}
+		mem, ok := memOf(dst)
+		if !ok || mem.base == -1 {
+			// A %rip displacement would have to come before the immediate
+			return fmt.Errorf("unsupported %s operands: %s, %s", name, src, dst)
+		}
+		emit(0xC7, 0, -1, &mem)
+		if byteOp {
+			a.emit(byte(imm))
+		} else {
+			a.code = a.enc.Append(a.code, uint64(imm), 2)
+		}
+	case srcReg != -1 && dstReg != -1:
+		emit(0x89, srcReg, dstReg, nil)
+	case dstReg != -1:
+		mem, ok := memOf(src)
+		if !ok {
+			return fmt.Errorf("invalid %s source: %s", name, src)
+		}
+		emit(0x8B, dstReg, -1, &mem)
+	case srcReg != -1:
+		mem, ok := memOf(dst)
+		if !ok {
+			return fmt.Errorf("invalid %s destination: %s", name, dst)
+		}
+		emit(0x89, srcReg, -1, &mem)
+	default:
+		return fmt.Errorf("unsupported %s operands: %s, %s", name, src, dst)
+	}
+	return nil
+}
+
+// encodeIdivl handles signed 32-bit division of %edx:%eax by a register or
+// memory (F7 /7)
+func (a *Assembler) encodeIdivl(operands []MachineOperand) error {
+	if len(operands) != 1 {
+		return fmt.Errorf("idivl requires 1 operand")
+	}
+	if reg := regOf(operands[0]); reg != -1 {
+		a.emitOp(false, 0xF7, 7, reg, nil)
 		return nil
 	}
+	mem, ok := memOf(operands[0])
+	if !ok {
+		return fmt.Errorf("invalid idivl operand: %s", operands[0])
+	}
+	a.emitOp(false, 0xF7, 7, -1, &mem)
+	return nil
+}
+
+// encodeDivq handles unsigned 64-bit division by a register (REX.W F7 /6)
+func (a *Assembler) encodeDivq(operands []MachineOperand) error {
+	if len(operands) != 1 {
+		return fmt.Errorf("divq requires 1 operand")
+	}
+	reg := regOf(operands[0])
+	if reg == -1 {
+		return fmt.Errorf("divq requires a register operand: %s", operands[0])
+	}
+	a.emitOp(true, 0xF7, 6, reg, nil)
+	return nil
+}
+
+func (a *Assembler) encodeTest(operands []MachineOperand) error {
+	src, dst, err := operandPair("test", operands)
+	if err != nil {
+		return err
+	}
 	
-	// Check for test mem, mem (typically same operand)
-	srcIsMem := strings.Contains(src, "(%") && strings.HasSuffix(src, ")")
-	dstIsMem := strings.Contains(dst, "(%") && strings.HasSuffix(dst, ")")
+	srcReg, dstReg := regOf(src), regOf(dst)
+	if srcReg != -1 && dstReg != -1 {
+		a.emitOp(true, 0x85, srcReg, dstReg, nil)
+		return nil
+	}
 	
-	if srcIsMem && dstIsMem {
+	if src.Kind == MOpMem && dst.Kind == MOpMem {
 		// For test mem, mem we convert to: load mem into reg, test reg, reg
 		// This is typically used for testing if a value is zero
 		return fmt.Errorf("test mem, mem not directly supported - use cmpq or load to register first")
@@ -1294,259 +1117,89 @@ func (a *Assembler) emit(bytes ...byte) {
 	a.code = append(a.code, bytes...)
 }
 
-func (a *Assembler) encodeLea(operands []string) error {
-	// leaq label(%rip), %reg or leaq offset(%base), %reg
-	if len(operands) != 2 {
-		return fmt.Errorf("lea requires 2 operands")
+func (a *Assembler) encodeLea(operands []MachineOperand) error {
+	// leaq label(%rip), %reg or leaq offset(%base), %reg: REX.W 8D /r
+	src, dst, err := operandPair("lea", operands)
+	if err != nil {
+		return err
 	}
 	
-	src := strings.TrimSpace(strings.TrimSuffix(operands[0], ","))
-	dst := strings.TrimSpace(operands[1])
-	
-	dstReg := parseRegister(dst)
+	dstReg := regOf(dst)
 	if dstReg < 0 {
 		return fmt.Errorf("invalid destination register: %s", dst)
 	}
 	
-	// Check for RIP-relative addressing: label(%rip)
-	if strings.Contains(src, "(%rip)") {
-		label := strings.TrimSuffix(src, "(%rip)")
-		label = strings.TrimSpace(label)
-		
-		// leaq label(%rip), reg
-		// Opcode: REX.W + 0x8D /r with ModR/M 00 reg 101
-		// REX.W = 0x48
-		rex := byte(0x48)
-		if dstReg >= 8 {
-			rex |= 0x04 // REX.R
-			dstReg -= 8
-		}
-		
-		a.emit(rex, 0x8D)
-		// ModR/M: 00 reg 101 (RIP-relative)
-		modrm := byte(0x05) | byte(dstReg<<3)
-		a.emit(modrm)
-		
-		// Add relocation for the displacement (4 bytes)
-		a.relocations = append(a.relocations, Relocation{
-			Type:   R_X86_64_PC32,
-			Offset: uint64(len(a.code)),
-			Symbol: label,
-			Addend: -4,
-		})
-		a.emitInt32(0) // Placeholder for displacement
-		
-		return nil
+	mem, ok := memOf(src)
+	if !ok {
+		return fmt.Errorf("unsupported lea addressing mode: %s", src)
 	}
-	
-	// Check for regular addressing: offset(%base)
-	if strings.Contains(src, "(%") && strings.HasSuffix(src, ")") {
-		// Parse: offset(%base)
-		memStr := src
-		lastPct := strings.LastIndex(memStr, "%")
-		if lastPct == -1 {
-			return fmt.Errorf("invalid memory operand: %s", src)
-		}
-		baseRegStr := memStr[lastPct:]
-		baseRegStr = strings.TrimSuffix(baseRegStr, ")")
-		baseReg := parseRegister(baseRegStr)
-		if baseReg == -1 {
-			return fmt.Errorf("invalid base register in: %s", src)
-		}
-		
-		offsetStr := strings.TrimPrefix(memStr[:lastPct], "(")
-		offsetStr = strings.TrimSuffix(offsetStr, "(")
-		offset := int32(0)
-		if offsetStr != "" {
-			val, err := strconv.ParseInt(offsetStr, 10, 32)
-			if err != nil {
-				return fmt.Errorf("invalid offset in: %s", src)
-			}
-			offset = int32(val)
-		}
-		
-		// LEA offset(%base), %dst
-		rex := byte(0x48)
-		if dstReg >= 8 {
-			rex |= 0x04 // REX.R
-			dstReg -= 8
-		}
-		if baseReg >= 8 {
-			rex |= 0x01 // REX.B
-			baseReg -= 8
-		}
-		
-		a.emit(rex, 0x8D)
-		
-		// ModR/M
-		if offset == 0 && (baseReg&7) != 5 { // Not RBP
-			modrm := byte(0x00) | byte((dstReg&7)<<3) | byte(baseReg&7)
-			a.emit(modrm)
-			if (baseReg & 7) == 4 { // RSP needs SIB
-				a.emit(0x24)
-			}
-		} else if offset >= -128 && offset <= 127 {
-			modrm := byte(0x40) | byte((dstReg&7)<<3) | byte(baseReg&7)
-			a.emit(modrm)
-			if (baseReg & 7) == 4 { // RSP needs SIB
-				a.emit(0x24)
-			}
-			a.emit(byte(offset))
-		} else {
-			modrm := byte(0x80) | byte((dstReg&7)<<3) | byte(baseReg&7)
-			a.emit(modrm)
-			if (baseReg & 7) == 4 { // RSP needs SIB
-				a.emit(0x24)
-			}
-			a.emitInt32(offset)
-		}
-		return nil
-	}
-	
-	return fmt.Errorf("unsupported lea addressing mode: %s", src)
+	a.emitOp(true, 0x8D, dstReg, -1, &mem)
+	return nil
 }
 
-func (a *Assembler) encodeShift(modrmExt byte, operands []string) error {
+func (a *Assembler) encodeShift(ext int, operands []MachineOperand) error {
 	// shift $imm, %reg or shift %cl, %reg
-	if len(operands) != 2 {
-		return fmt.Errorf("shift requires 2 operands")
+	src, dst, err := operandPair("shift", operands)
+	if err != nil {
+		return err
 	}
 	
-	src := strings.TrimSpace(strings.TrimSuffix(operands[0], ","))
-	dst := strings.TrimSpace(operands[1])
-	
-	dstReg := parseRegister(dst)
+	dstReg := regOf(dst)
 	if dstReg < 0 {
 		return fmt.Errorf("invalid destination register: %s", dst)
 	}
 	
-	rex := byte(0x48)
-	if dstReg >= 8 {
-		rex |= 0x01 // REX.B
-		dstReg -= 8
-	}
-	
 	// Check for immediate shift
-	if strings.HasPrefix(src, "$") {
-		imm, err := parseImmediate(src)
+	if src.Kind == MOpImm {
+		imm, err := immValue(src)
 		if err != nil {
 			return err
 		}
 		
-		a.emit(rex)
 		if imm == 1 {
 			// Special encoding for shift by 1
-			a.emit(0xD1)
-			a.emit(modrmExt | byte(dstReg&7))
+			a.emitOp(true, 0xD1, ext, dstReg, nil)
 		} else {
 			// Shift by immediate byte
-			a.emit(0xC1)
-			a.emit(modrmExt | byte(dstReg&7))
+			a.emitOp(true, 0xC1, ext, dstReg, nil)
 			a.emit(byte(imm))
 		}
 		return nil
 	}
 	
 	// Check for shift by CL register
-	if src == "%cl" || src == "%rcx" {
-		a.emit(rex, 0xD3)
-		a.emit(modrmExt | byte(dstReg&7))
+	if src.Kind == MOpReg && !src.Indirect && (src.Reg == "cl" || src.Reg == "rcx") {
+		a.emitOp(true, 0xD3, ext, dstReg, nil)
 		return nil
 	}
 	
 	return fmt.Errorf("unsupported shift operands: %s, %s", src, dst)
 }
 
-func (a *Assembler) encodeNeg(operands []string) error {
-	// negq %reg or negq offset(%base)
+func (a *Assembler) encodeNeg(operands []MachineOperand) error {
+	// negq %reg or negq offset(%base): REX.W F7 /3
 	if len(operands) != 1 {
 		return fmt.Errorf("neg requires 1 operand")
 	}
 	
-	dst := strings.TrimSpace(operands[0])
-	dstReg := parseRegister(dst)
-	
-	if dstReg != -1 {
-		// negq %reg
-		rex := byte(0x48)
-		if dstReg >= 8 {
-			rex |= 0x01 // REX.B
-			dstReg -= 8
-		}
-		a.emit(rex, 0xF7)
-		a.emit(0xD8 | byte(dstReg&7)) // ModR/M for NEG /3
+	if reg := regOf(operands[0]); reg != -1 {
+		a.emitOp(true, 0xF7, 3, reg, nil)
 		return nil
 	}
-	
-	// Check for memory operand
-	if strings.Contains(dst, "(%") && strings.HasSuffix(dst, ")") {
-		// Parse memory operand
-		memStr := dst
-		lastPct := strings.LastIndex(memStr, "%")
-		if lastPct == -1 {
-			return fmt.Errorf("invalid memory operand: %s", dst)
-		}
-		baseRegStr := memStr[lastPct:]
-		baseRegStr = strings.TrimSuffix(baseRegStr, ")")
-		baseReg := parseRegister(baseRegStr)
-		if baseReg == -1 {
-			return fmt.Errorf("invalid base register in: %s", dst)
-		}
-		
-		offsetStr := strings.TrimPrefix(memStr[:lastPct], "(")
-		offsetStr = strings.TrimSuffix(offsetStr, "(")
-		offset := int32(0)
-		if offsetStr != "" {
-			val, err := strconv.ParseInt(offsetStr, 10, 32)
-			if err != nil {
-				return fmt.Errorf("invalid offset in: %s", dst)
-			}
-			offset = int32(val)
-		}
-		
-		rex := byte(0x48)
-		if baseReg >= 8 {
-			rex |= 0x01 // REX.B
-			baseReg -= 8
-		}
-		a.emit(rex, 0xF7)
-		
-		// ModR/M for memory (opcode extension /3 for NEG)
-		if offset == 0 && (baseReg&7) != 5 {
-			modrm := byte(0x18) | byte(baseReg&7) // /3 = 011 in bits 5-3
-			a.emit(modrm)
-			if (baseReg & 7) == 4 {
-				a.emit(0x24)
-			}
-		} else if offset >= -128 && offset <= 127 {
-			modrm := byte(0x58) | byte(baseReg&7) // mod=01, /3
-			a.emit(modrm)
-			if (baseReg & 7) == 4 {
-				a.emit(0x24)
-			}
-			a.emit(byte(offset))
-		} else {
-			modrm := byte(0x98) | byte(baseReg&7) // mod=10, /3
-			a.emit(modrm)
-			if (baseReg & 7) == 4 {
-				a.emit(0x24)
-			}
-			a.emitInt32(offset)
-		}
-		return nil
+	mem, ok := memOf(operands[0])
+	if !ok {
+		return fmt.Errorf("invalid neg operand: %s", operands[0])
 	}
-	
-	return fmt.Errorf("invalid neg operand: %s", dst)
+	a.emitOp(true, 0xF7, 3, -1, &mem)
+	return nil
 }
 
 func (a *Assembler) emitInt32(val int32) {
-	a.emit(byte(val), byte(val>>8), byte(val>>16), byte(val>>24))
+	a.code = a.enc.Append(a.code, uint64(val), 4)
 }
 
 func (a *Assembler) emitInt64(val int64) {
-	for i := 0; i < 8; i++ {
-		a.emit(byte(val >> (i * 8)))
-	}
+	a.code = a.enc.Append(a.code, uint64(val), 8)
 }
 
 func parseRegister(s string) int {
@@ -1563,11 +1216,12 @@ func parseImmediate(s string) (int64, error) {
 	s = strings.TrimPrefix(s, "$")
 	
 	if strings.HasPrefix(s, "0x") {
-		val, err := strconv.ParseInt(s[2:], 16, 64)
+		// Up to 64 bits, the top one the sign bit
+		val, err := strconv.ParseUint(s[2:], 16, 64)
 		if err != nil {
 			return 0, fmt.Errorf("invalid hex immediate: %s", s)
 		}
-		return val, nil
+		return int64(val), nil
 	}
 	
 	// Try parsing as integer first
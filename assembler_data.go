@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Data directives
+// Besides .text, the assembler lays out the data the assembly declares
+// into .rodata, .data and .bss Sections for the linker (and the JIT), so
+// what links is exactly what the assembly says:
+//
+//	.section .rodata / .data / .bss     switch section (.section .rodata.*,
+//	                                    .data.* and .bss.* too; other
+//	                                    sections are skipped)
+//	name:                               a symbol at this offset
+//	.byte .short .value .2byte .long    integers, comma separated; .quad
+//	.int .4byte .quad .8byte            also takes symbol[+-offset], which
+//	                                    becomes an absolute relocation
+//	.string .asciz .ascii               a quoted string (NUL terminated but
+//	                                    for .ascii)
+//	.double .float                      floating-point constants
+//	.zero .skip .space                  n bytes (of an optional fill byte)
+//	.align .balign .p2align             alignment (.p2align takes a power)
+//	.comm .lcomm name, size[, align]    size bytes of .bss, wherever they are
+//
+// Only .zero, .skip, .space and alignment can go in .bss. A .comm symbol
+// is global (unless .local names it); .type, .size and the like are
+// ignored.
+
+// dataSectionOf maps a section name to the Section its contents go in,
+// "text", or "" for sections whose contents are skipped
+func dataSectionOf(name string) string {
+	name = strings.TrimPrefix(name, ".")
+	for _, sec := range []string{"text", "rodata", "data", "bss"} {
+		if name == sec || strings.HasPrefix(name, sec+".") {
+			return sec
+		}
+	}
+	return ""
+}
+
+// resetData starts the data sections over, for another layout pass
+func (a *Assembler) resetData() {
+	a.rodata = newSection("rodata")
+	a.data = newSection("data")
+	a.bss = newSection("bss")
+}
+
+// Sections are the data sections the last AssembleInstrs laid out
+func (a *Assembler) Sections() (rodata, data, bss *Section) {
+	return a.rodata, a.data, a.bss
+}
+
+// section is the data Section named sec ("rodata", "data" or "bss")
+func (a *Assembler) section(sec string) *Section {
+	switch sec {
+	case "rodata":
+		return a.rodata
+	case "data":
+		return a.data
+	case "bss":
+		return a.bss
+	}
+	return nil
+}
+
+// dataDirective handles a directive while section sec is current
+func (a *Assembler) dataDirective(mi *MachineInstr, sec string) error {
+	if mi.Op == ".comm" || mi.Op == ".lcomm" {
+		return a.common(mi.Args, mi.Op == ".lcomm")
+	}
+	s := a.section(sec)
+	if s == nil {
+		return nil
+	}
+	args := strings.TrimSpace(mi.Args)
+	initialized := true
+	var err error
+	switch mi.Op {
+	case ".byte":
+		err = a.integers(s, args, 1)
+	case ".short", ".value", ".2byte", ".word":
+		err = a.integers(s, args, 2)
+	case ".long", ".int", ".4byte":
+		err = a.integers(s, args, 4)
+	case ".quad", ".8byte":
+		err = a.integers(s, args, 8)
+	case ".string", ".asciz", ".ascii":
+		var text string
+		text, err = parseGASString(args)
+		if err == nil {
+			s.write([]byte(text)...)
+			if mi.Op != ".ascii" {
+				s.write(0)
+			}
+		}
+	case ".double", ".float":
+		size := 8
+		if mi.Op == ".float" {
+			size = 4
+		}
+		err = floats(s, args, size)
+	case ".zero", ".skip", ".space":
+		initialized = false
+		err = reserve(s, args)
+	case ".align", ".balign", ".p2align":
+		initialized = false
+		var n int64
+		n, err = strconv.ParseInt(strings.TrimSpace(strings.Split(args, ",")[0]), 0, 64)
+		if err == nil && mi.Op == ".p2align" {
+			n = 1 << n
+		}
+		if err == nil && n > 0 {
+			s.align(uint64(n))
+		}
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", mi.Op, args, err)
+	}
+	if initialized && sec == "bss" {
+		return fmt.Errorf("%s in .bss: only space can be reserved there", mi.Op)
+	}
+	return nil
+}
+
+// common reserves .comm's (or .lcomm's) name, size[, align] in .bss
+func (a *Assembler) common(args string, local bool) error {
+	fields := strings.Split(args, ",")
+	if len(fields) < 2 {
+		return fmt.Errorf(".comm %s: expected name, size", args)
+	}
+	size, err := strconv.ParseUint(strings.TrimSpace(fields[1]), 0, 64)
+	if err != nil {
+		return fmt.Errorf(".comm %s: %w", args, err)
+	}
+	if len(fields) > 2 {
+		align, err := strconv.ParseUint(strings.TrimSpace(fields[2]), 0, 64)
+		if err != nil {
+			return fmt.Errorf(".comm %s: %w", args, err)
+		}
+		if align > 0 {
+			// ELF alignments are powers of two
+			a.bss.align(uint64(1) << bits.Len64(align-1))
+		}
+	}
+	name := strings.TrimSpace(fields[0])
+	if a.isDefined(name) {
+		return fmt.Errorf("symbol '%s' is already defined", name)
+	}
+	// A common symbol is global unless .local said otherwise
+	if _, ok := a.bindings[name]; !ok && !local {
+		a.bindings[name] = STB_GLOBAL
+	}
+	a.commons[name] = true
+	a.bss.define(name)
+	a.bss.Size += size
+	return nil
+}
+
+// integers writes comma-separated integers of size bytes; a symbol
+// (plus or minus a constant) is only allowed as a .quad
+func (a *Assembler) integers(s *Section, args string, size int) error {
+	for _, field := range strings.Split(args, ",") {
+		field = strings.TrimSpace(field)
+		if val, err := strconv.ParseInt(field, 0, 64); err == nil {
+			s.writeInt(uint64(val), size)
+			continue
+		}
+		if val, err := strconv.ParseUint(field, 0, 64); err == nil {
+			s.writeInt(val, size)
+			continue
+		}
+		symbol, addend, ok := symbolExpression(field)
+		if !ok {
+			return fmt.Errorf("can't read '%s' as a value", field)
+		}
+		if size != 8 {
+			return fmt.Errorf("the address of %s only fits a .quad", symbol)
+		}
+		a.relocations = append(a.relocations, Relocation{
+			Type:    R_X86_64_64,
+			Offset:  s.Size,
+			Symbol:  symbol,
+			Addend:  addend,
+			Section: s.Name,
+		})
+		s.writeInt(0, 8)
+	}
+	return nil
+}
+
+// symbolExpression reads "name", "name+8" or "name-8"
+func symbolExpression(text string) (symbol string, addend int64, ok bool) {
+	symbol = text
+	if i := strings.LastIndexAny(text, "+-"); i > 0 {
+		val, err := strconv.ParseInt(strings.TrimSpace(text[i:]), 0, 64)
+		if err != nil {
+			return "", 0, false
+		}
+		symbol, addend = strings.TrimSpace(text[:i]), val
+	}
+	if symbol == "" || strings.ContainsAny(symbol, " \t\"'()") {
+		return "", 0, false
+	}
+	return symbol, addend, true
+}
+
+// floats writes comma-separated floating-point constants
+func floats(s *Section, args string, size int) error {
+	for _, field := range strings.Split(args, ",") {
+		val, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return err
+		}
+		if size == 4 {
+			s.writeInt(uint64(math.Float32bits(float32(val))), 4)
+		} else {
+			s.writeInt(math.Float64bits(val), 8)
+		}
+	}
+	return nil
+}
+
+// reserve adds .zero's (or .skip's) n[, fill] bytes
+func reserve(s *Section, args string) error {
+	fields := strings.Split(args, ",")
+	n, err := strconv.ParseUint(strings.TrimSpace(fields[0]), 0, 64)
+	if err != nil {
+		return err
+	}
+	var fill int64
+	if len(fields) > 1 {
+		if fill, err = strconv.ParseInt(strings.TrimSpace(fields[1]), 0, 64); err != nil {
+			return err
+		}
+	}
+	if s.Name == "bss" {
+		if fill != 0 {
+			return fmt.Errorf("a fill byte in .bss")
+		}
+		s.Size += n
+		return nil
+	}
+	for i := uint64(0); i < n; i++ {
+		s.write(byte(fill))
+	}
+	return nil
+}
+
+// parseGASString decodes a quoted string with GAS's escapes: the C ones,
+// octal \ooo and hex \xhh
+func parseGASString(args string) (string, error) {
+	if len(args) < 2 || args[0] != '"' || args[len(args)-1] != '"' {
+		return "", fmt.Errorf("expected a quoted string")
+	}
+	body := args[1 : len(args)-1]
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i >= len(body) {
+			return "", fmt.Errorf("string ends in a backslash")
+		}
+		switch c = body[i]; c {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'x':
+			val := 0
+			for i+1 < len(body) && isHexDigit(body[i+1]) {
+				i++
+				val = val*16 + hexValue(body[i])
+			}
+			b.WriteByte(byte(val))
+		default:
+			if c >= '0' && c <= '7' {
+				val := 0
+				for n := 0; n < 3 && i < len(body) && body[i] >= '0' && body[i] <= '7'; n++ {
+					val = val*8 + int(body[i]-'0')
+					i++
+				}
+				i--
+				b.WriteByte(byte(val))
+				continue
+			}
+			b.WriteByte(c) // \" \\ and anything else stand for themselves
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SSE2 scalar floating point encodings
+// All of these share the layout: [mandatory prefix] [REX] 0F <opcode> ModR/M [SIB] [disp]
+
+// parseXMMRegister returns the xmm register number (0-15) or -1
+func parseXMMRegister(s string) int {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "%")
+	s = strings.ToLower(s)
+	if !strings.HasPrefix(s, "xmm") {
+		return -1
+	}
+	n, err := strconv.Atoi(s[3:])
+	if err != nil || n < 0 || n > 15 {
+		return -1
+	}
+	return n
+}
+
+// memOperand is a memory reference ready to encode: disp(%base),
+// disp(%base,%index,scale) or symbol+disp(%rip)
+type memOperand struct {
+	base    int
+	disp    int32
+	symbol  string // non-empty for RIP-relative references
+	indexed bool
+	index   int
+	scale   int
+}
+
+// memOf checks that o is a memory operand the encoders can address and
+// converts it, false if not
+func memOf(o MachineOperand) (memOperand, bool) {
+	if o.Kind != MOpMem || o.Indirect || o.Disp != int64(int32(o.Disp)) {
+		return memOperand{}, false
+	}
+	if o.Reg == "rip" {
+		if o.Index != "" {
+			return memOperand{}, false
+		}
+		return memOperand{base: -1, symbol: o.Symbol, disp: int32(o.Disp)}, true
+	}
+	if o.Symbol != "" {
+		return memOperand{}, false
+	}
+
+	mem := memOperand{base: parseRegister(o.Reg), disp: int32(o.Disp)}
+	if o.Index != "" {
+		mem.indexed, mem.index, mem.scale = true, parseRegister(o.Index), o.Scale
+		if mem.index == -1 || mem.index == REG_RSP || (o.Scale != 1 && o.Scale != 2 && o.Scale != 4 && o.Scale != 8) {
+			return memOperand{}, false
+		}
+	}
+	if mem.base == -1 {
+		return memOperand{}, false
+	}
+	return mem, true
+}
+
+// regOf is the number of the general register o names, or -1
+func regOf(o MachineOperand) int {
+	if o.Kind != MOpReg || o.Indirect {
+		return -1
+	}
+	return parseRegister(o.Reg)
+}
+
+// xmmOf is the number of the xmm register o names, or -1
+func xmmOf(o MachineOperand) int {
+	if o.Kind != MOpReg || o.Indirect {
+		return -1
+	}
+	return parseXMMRegister(o.Reg)
+}
+
+// immValue is the value of the immediate o; a float's digits truncate
+func immValue(o MachineOperand) (int64, error) {
+	if o.Symbol == "" {
+		return o.Disp, nil
+	}
+	return parseImmediate(o.Symbol)
+}
+
+// rex is the REX prefix for reg and this operand as r/m, 0 if none is needed
+func (mem memOperand) rex(w bool, reg int) byte {
+	rex := rexFor(w, reg, mem.base)
+	if mem.indexed && mem.index >= 8 {
+		rex |= 0x42 // REX.X
+	}
+	return rex
+}
+
+// rexFor computes the REX prefix for a reg field and an r/m register or memory base
+// Returns 0 if no prefix is needed
+func rexFor(w bool, reg int, rm int) byte {
+	rex := byte(0)
+	if w {
+		rex |= 0x08
+	}
+	if reg >= 8 {
+		rex |= 0x04 // REX.R
+	}
+	if rm >= 8 {
+		rex |= 0x01 // REX.B
+	}
+	if rex != 0 {
+		rex |= 0x40
+	}
+	return rex
+}
+
+// emitModRMMem emits the ModR/M (+SIB, displacement) for a memory operand
+// RIP-relative operands get a PC32 relocation against the symbol
+func (a *Assembler) emitModRMMem(reg int, mem memOperand) {
+	if mem.symbol != "" || mem.base == -1 {
+		// ModR/M: 00 reg 101 (RIP-relative)
+		a.emit(byte(0x05) | byte((reg&7)<<3))
+		a.emitRIPDisplacement(mem.symbol, int64(mem.disp))
+		return
+	}
+
+	if mem.indexed {
+		// ModR/M r/m 100 takes a SIB: scale, index, base
+		sib := byte(map[int]byte{1: 0, 2: 1, 4: 2, 8: 3}[mem.scale]<<6) | byte((mem.index&7)<<3) | byte(mem.base&7)
+		switch {
+		case mem.disp == 0 && mem.base&7 != 5:
+			a.emit(byte(0x04)|byte((reg&7)<<3), sib)
+		case mem.disp >= -128 && mem.disp <= 127:
+			a.emit(byte(0x44)|byte((reg&7)<<3), sib, byte(mem.disp))
+		default:
+			a.emit(byte(0x84)|byte((reg&7)<<3), sib)
+			a.emitInt32(mem.disp)
+		}
+		return
+	}
+
+	base := mem.base & 7
+	if mem.disp == 0 && base != 5 { // Not RBP/R13
+		a.emit(byte(0x00) | byte((reg&7)<<3) | byte(base))
+		if base == 4 { // RSP/R12 needs SIB
+			a.emit(0x24)
+		}
+	} else if mem.disp >= -128 && mem.disp <= 127 {
+		a.emit(byte(0x40) | byte((reg&7)<<3) | byte(base))
+		if base == 4 {
+			a.emit(0x24)
+		}
+		a.emit(byte(mem.disp))
+	} else {
+		a.emit(byte(0x80) | byte((reg&7)<<3) | byte(base))
+		if base == 4 {
+			a.emit(0x24)
+		}
+		a.emitInt32(mem.disp)
+	}
+}
+
+// emitRIPDisplacement emits the displacement of a symbol+disp(%rip)
+// operand, a PC32 relocation. The symbol may carry an offset of its own
+// (origin+4, a member of a global struct); the displacement must be the
+// instruction's last field.
+func (a *Assembler) emitRIPDisplacement(symbol string, disp int64) {
+	name, addend, ok := symbolExpression(symbol)
+	if !ok {
+		name, addend = symbol, 0
+	}
+	a.relocations = append(a.relocations, Relocation{
+		Type:   R_X86_64_PC32,
+		Offset: uint64(len(a.code)),
+		Symbol: name,
+		Addend: addend + disp - 4,
+	})
+	a.emitInt32(0)
+}
+
+// emitSSE emits prefix, REX, 0F opcode and the ModR/M for reg <- r/m
+// rmReg is used when rm is a register (xmm or GPR), otherwise mem is used
+func (a *Assembler) emitSSE(prefix byte, w bool, opcode byte, reg int, rmReg int, mem *memOperand) {
+	if prefix != 0 {
+		a.emit(prefix)
+	}
+
+	rex := rexFor(w, reg, rmReg)
+	if mem != nil {
+		rex = mem.rex(w, reg)
+	}
+	if rex != 0 {
+		a.emit(rex)
+	}
+	a.emit(0x0F, opcode)
+
+	if mem != nil {
+		a.emitModRMMem(reg, *mem)
+		return
+	}
+	a.emit(byte(0xC0) | byte((reg&7)<<3) | byte(rmReg&7))
+}
+
+// operandPair is the source and destination of a two-operand instruction
+func operandPair(name string, operands []MachineOperand) (MachineOperand, MachineOperand, error) {
+	if len(operands) != 2 {
+		return MachineOperand{}, MachineOperand{}, fmt.Errorf("%s requires 2 operands", name)
+	}
+	return operands[0], operands[1], nil
+}
+
+// encodeSSEMove handles movsd/movss: xmm<-xmm, xmm<-mem, mem<-xmm
+func (a *Assembler) encodeSSEMove(prefix byte, name string, operands []MachineOperand) error {
+	src, dst, err := operandPair(name, operands)
+	if err != nil {
+		return err
+	}
+
+	srcX := xmmOf(src)
+	dstX := xmmOf(dst)
+
+	if dstX != -1 {
+		if srcX != -1 {
+			a.emitSSE(prefix, false, 0x10, dstX, srcX, nil)
+			return nil
+		}
+		mem, ok := memOf(src)
+		if !ok {
+			return fmt.Errorf("invalid %s source: %s", name, src)
+		}
+		a.emitSSE(prefix, false, 0x10, dstX, -1, &mem)
+		return nil
+	}
+
+	if srcX != -1 {
+		mem, ok := memOf(dst)
+		if !ok {
+			return fmt.Errorf("invalid %s destination: %s", name, dst)
+		}
+		// Store form uses opcode 0x11
+		a.emitSSE(prefix, false, 0x11, srcX, -1, &mem)
+		return nil
+	}
+
+	return fmt.Errorf("%s requires an xmm operand: %s, %s", name, src, dst)
+}
+
+// encodeSSEArith handles addsd/subsd/mulsd/divsd/ucomisd style ops: xmm <- xmm/mem
+func (a *Assembler) encodeSSEArith(prefix byte, opcode byte, name string, operands []MachineOperand) error {
+	src, dst, err := operandPair(name, operands)
+	if err != nil {
+		return err
+	}
+
+	dstX := xmmOf(dst)
+	if dstX == -1 {
+		return fmt.Errorf("%s destination must be an xmm register: %s", name, dst)
+	}
+
+	if srcX := xmmOf(src); srcX != -1 {
+		a.emitSSE(prefix, false, opcode, dstX, srcX, nil)
+		return nil
+	}
+
+	mem, ok := memOf(src)
+	if !ok {
+		return fmt.Errorf("invalid %s source: %s", name, src)
+	}
+	a.emitSSE(prefix, false, opcode, dstX, -1, &mem)
+	return nil
+}
+
+// encodeCvtsi2sd handles cvtsi2sd/cvtsi2ss: xmm <- r/m32 or r/m64
+func (a *Assembler) encodeCvtsi2sd(prefix byte, w bool, name string, operands []MachineOperand) error {
+	src, dst, err := operandPair(name, operands)
+	if err != nil {
+		return err
+	}
+
+	dstX := xmmOf(dst)
+	if dstX == -1 {
+		return fmt.Errorf("%s destination must be an xmm register: %s", name, dst)
+	}
+
+	if srcReg := regOf(src); srcReg != -1 {
+		// A 32-bit register name selects the 32-bit form
+		if strings.HasPrefix(src.Reg, "e") || strings.HasSuffix(src.Reg, "d") {
+			w = false
+		}
+		a.emitSSE(prefix, w, 0x2A, dstX, srcReg, nil)
+		return nil
+	}
+
+	mem, ok := memOf(src)
+	if !ok {
+		return fmt.Errorf("invalid %s source: %s", name, src)
+	}
+	a.emitSSE(prefix, w, 0x2A, dstX, -1, &mem)
+	return nil
+}
+
+// encodeCvttsd2si handles cvttsd2si/cvttss2si: r32/r64 <- xmm/mem (truncating)
+func (a *Assembler) encodeCvttsd2si(prefix byte, name string, operands []MachineOperand) error {
+	src, dst, err := operandPair(name, operands)
+	if err != nil {
+		return err
+	}
+
+	dstReg := regOf(dst)
+	if dstReg == -1 {
+		return fmt.Errorf("%s destination must be a general register: %s", name, dst)
+	}
+	w := !(strings.HasPrefix(dst.Reg, "e") || strings.HasSuffix(dst.Reg, "d"))
+
+	if srcX := xmmOf(src); srcX != -1 {
+		a.emitSSE(prefix, w, 0x2C, dstReg, srcX, nil)
+		return nil
+	}
+
+	mem, ok := memOf(src)
+	if !ok {
+		return fmt.Errorf("invalid %s source: %s", name, src)
+	}
+	a.emitSSE(prefix, w, 0x2C, dstReg, -1, &mem)
+	return nil
+}
+
+// encodeMovqXMM handles movq between general registers and xmm registers
+// Returns handled=false when neither operand is an xmm register
+func (a *Assembler) encodeMovqXMM(operands []MachineOperand) (bool, error) {
+	src, dst, err := operandPair("movq", operands)
+	if err != nil {
+		return false, nil
+	}
+
+	srcX := xmmOf(src)
+	dstX := xmmOf(dst)
+	if srcX == -1 && dstX == -1 {
+		return false, nil
+	}
+
+	if dstX != -1 && srcX != -1 {
+		// movq %xmm, %xmm: F3 0F 7E /r
+		a.emitSSE(0xF3, false, 0x7E, dstX, srcX, nil)
+		return true, nil
+	}
+
+	if dstX != -1 {
+		// movq r/m64, %xmm: 66 REX.W 0F 6E /r
+		if srcReg := regOf(src); srcReg != -1 {
+			a.emitSSE(0x66, true, 0x6E, dstX, srcReg, nil)
+			return true, nil
+		}
+		mem, ok := memOf(src)
+		if !ok {
+			return true, fmt.Errorf("invalid movq source: %s", src)
+		}
+		a.emitSSE(0x66, true, 0x6E, dstX, -1, &mem)
+		return true, nil
+	}
+
+	// movq %xmm, r/m64: 66 REX.W 0F 7E /r
+	if dstReg := regOf(dst); dstReg != -1 {
+		a.emitSSE(0x66, true, 0x7E, srcX, dstReg, nil)
+		return true, nil
+	}
+	mem, ok := memOf(dst)
+	if !ok {
+		return true, fmt.Errorf("invalid movq destination: %s", dst)
+	}
+	a.emitSSE(0x66, true, 0x7E, srcX, -1, &mem)
+	return true, nil
+}
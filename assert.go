@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// assert
+// System headers are skipped, so #include <assert.h> defines assert itself:
+//
+//	assert(e)  ->  __builtin_assert(e, "e", __FILE__, __LINE__)
+//
+// or, if NDEBUG is defined where <assert.h> is included, ((void)0). The
+// builtin is selected inline as a test of e and a call-free path when it
+// holds; when it doesn't, "assertion failed: e, file:line" is written to
+// stderr and the program aborts (exit status 134).
+
+// assertMacro is assert as <assert.h> defines it, given whether NDEBUG is
+// defined
+func assertMacro(ndebug bool) *FunctionMacro {
+	if ndebug {
+		return &FunctionMacro{Params: []string{"e"}, Body: "((void)0)"}
+	}
+	return &FunctionMacro{Params: []string{"e"}, Body: "__builtin_assert(e, #e, __FILE__, __LINE__)"}
+}
+
+// selectAssert selects __builtin_assert(e, text, file, line)
+func (is *InstructionSelector) selectAssert(node *ASTNode) (*Operand, error) {
+	text, file, line := node.Children[1], node.Children[2], node.Children[3]
+	if text.Type != NodeString || file.Type != NodeString || line.Type != NodeNumber {
+		return nil, fmt.Errorf("__builtin_assert takes an expression, its text, a file name and a line number")
+	}
+	cond, err := is.selectExpression(node.Children[0])
+	if err != nil {
+		return nil, err
+	}
+	okLabel := is.newLabel(".L_assert_ok")
+	is.emit(OpJnz, &Operand{Type: "label", Value: okLabel}, cond, nil)
+
+	message := fmt.Sprintf("assertion failed: %s, %s:%s\n", text.Value, file.Value, strings.TrimSpace(line.Value))
+	report := &ASTNode{Type: NodeCall, Name: "fputs", Children: []*ASTNode{
+		{Type: NodeString, Value: message},
+		{Type: NodeIdentifier, VarName: "stderr"},
+	}}
+	if _, err := is.selectExpression(report); err != nil {
+		return nil, err
+	}
+	if _, err := is.selectExpression(&ASTNode{Type: NodeCall, Name: "abort"}); err != nil {
+		return nil, err
+	}
+	is.emit(OpLabel, &Operand{Type: "label", Value: okLabel}, nil, nil)
+	return &Operand{Type: "imm", Value: "0"}, nil
+}
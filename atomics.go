@@ -0,0 +1,187 @@
+package main
+
+import "fmt"
+
+// Atomic builtins
+// The gcc builtins that simple lock-free code and code shared between
+// pthreads need, on x86-64:
+//
+//	__atomic_load_n(p, order)         mov: x86 loads are ordered already
+//	__atomic_store_n(p, v, order)     mov, then mfence for __ATOMIC_SEQ_CST
+//	__atomic_fetch_add(p, v, order)   lock xadd, or lock add if the old value isn't used
+//	__sync_lock_test_and_set(p, v)    xchg, which locks by itself
+//	__sync_synchronize()              mfence
+//
+// p points to an integer or a pointer of 1, 2, 4 or 8 bytes, and v is
+// converted to that type; the loads, exchanges and additions yield it too.
+// The memory orders are the __ATOMIC_* macros, and any but seq_cst (or one
+// that isn't a constant) needs no fence. Each access is marked Volatile
+// (see volatile.go), so no pass moves, merges or drops it. AArch64 has
+// none of them yet.
+
+// atomicBuiltin describes one of the builtins
+type atomicBuiltin struct {
+	args   int
+	result bool // yields the pointee's type rather than void
+}
+
+var atomicBuiltins = map[string]atomicBuiltin{
+	"__atomic_load_n":          {args: 2, result: true},
+	"__atomic_store_n":         {args: 3},
+	"__atomic_fetch_add":       {args: 3, result: true},
+	"__sync_lock_test_and_set": {args: 2, result: true},
+	"__sync_synchronize":       {args: 0},
+}
+
+// atomicSeqCst is __ATOMIC_SEQ_CST
+const atomicSeqCst = 5
+
+// atomicWidths are the size suffix and %rax's name for each access size
+var atomicWidths = map[int][2]string{1: {"b", "%al"}, 2: {"w", "%ax"}, 4: {"l", "%eax"}, 8: {"q", "%rax"}}
+
+// checkAtomic checks a call of an atomic builtin and returns its type; ok
+// is false if node doesn't call one
+func (tc *TypeChecker) checkAtomic(node *ASTNode) (typ string, ok bool) {
+	builtin, ok := atomicBuiltins[node.Name]
+	if !ok {
+		return "", false
+	}
+	types := make([]string, len(node.Children))
+	for i, arg := range node.Children {
+		types[i] = tc.exprType(arg)
+	}
+	switch want, have := builtin.args, len(node.Children); {
+	case have < want:
+		tc.errorf(node, "too few arguments to function '%s' (expected %d, have %d)", node.Name, want, have)
+		return "", true
+	case have > want:
+		tc.errorf(node, "too many arguments to function '%s' (expected %d, have %d)", node.Name, want, have)
+		return "", true
+	}
+	if builtin.args == 0 {
+		return "void", true
+	}
+	if types[0] == "" {
+		// Unknown: trust it
+		return "", true
+	}
+	pointee, isPointer := pointeeType(tc.normalizeType(types[0]))
+	if !isPointer || !tc.atomicType(pointee) {
+		tc.errorf(node, "operand type '%s' is incompatible with argument 1 of '%s'", types[0], node.Name)
+		return "", true
+	}
+	if node.Name != "__atomic_load_n" {
+		tc.checkConversion(node, pointee, node.Children[1], fmt.Sprintf("passing argument 2 of '%s'", node.Name))
+	}
+	if !builtin.result {
+		return "void", true
+	}
+	return pointee, true
+}
+
+// atomicType reports whether the builtins can access an object of type typ:
+// an integer or a pointer of a size they handle
+func (tc *TypeChecker) atomicType(typ string) bool {
+	switch tc.kindOf(typ) {
+	case kindPointer:
+		return true
+	case kindArith:
+		typ = tc.normalizeType(typ)
+		size, _ := tc.target.SizeOf(typ)
+		_, ok := atomicWidths[size]
+		return ok && !isFloatType(typ)
+	}
+	return false
+}
+
+// selectAtomic selects a call of an atomic builtin; ok is false if node
+// doesn't call one. With used false the value is dropped.
+func (is *InstructionSelector) selectAtomic(node *ASTNode, used bool) (result *Operand, ok bool, err error) {
+	builtin, ok := atomicBuiltins[node.Name]
+	if !ok {
+		return nil, false, nil
+	}
+	if is.target.Arch == "aarch64" {
+		return nil, true, fmt.Errorf("in function '%s': %s isn't supported on aarch64", is.currentFunc, node.Name)
+	}
+	if len(node.Children) != builtin.args {
+		return nil, true, fmt.Errorf("in function '%s': %s takes %d arguments", is.currentFunc, node.Name, builtin.args)
+	}
+	if builtin.args == 0 {
+		is.emit(OpFence, nil, nil, nil)
+		is.instructions[len(is.instructions)-1].Volatile = true
+		return &Operand{Type: "imm", Value: "0"}, true, nil
+	}
+
+	ptr, err := is.selectExpression(node.Children[0])
+	if err != nil {
+		return nil, true, err
+	}
+	// In a temp, not an address operand: it's dereferenced
+	addr := is.newTemp()
+	is.emit(OpMov, addr, ptr, nil)
+	typ, _ := pointeeType(trimTopQualifiers(ptr.DataType))
+	typ = is.scalarType(typ)
+	target := &Operand{Type: "ptr", IndexTemp: addr, Size: is.types().SizeOf(typ), DataType: typ}
+	var value *Operand
+	if node.Name != "__atomic_load_n" {
+		if value, err = is.selectExpression(node.Children[1]); err != nil {
+			return nil, true, err
+		}
+		if value.Type != "temp" {
+			// The emitter moves it to %rax as it stands
+			data := is.newTemp()
+			is.emit(OpMov, data, value, nil)
+			value = data
+		}
+	}
+	if used || node.Name == "__atomic_load_n" {
+		result = is.newTemp()
+		result.DataType = typ
+	}
+
+	start := len(is.instructions)
+	switch node.Name {
+	case "__atomic_load_n":
+		is.emit(OpLoad, result, target, nil)
+	case "__atomic_store_n":
+		is.emit(OpStore, target, value, nil)
+		if order := node.Children[2]; order.Type != NodeNumber || order.IntValue == atomicSeqCst {
+			is.emit(OpFence, nil, nil, nil)
+		}
+		result = &Operand{Type: "imm", Value: "0"}
+	case "__atomic_fetch_add":
+		is.emit(OpAtomicAdd, result, target, value)
+	case "__sync_lock_test_and_set":
+		is.emit(OpAtomicXchg, result, target, value)
+	}
+	for _, instr := range is.instructions[start:] {
+		instr.Volatile = true
+	}
+	if result == nil {
+		result = &Operand{Type: "imm", Value: "0"}
+	}
+	return result, true, nil
+}
+
+// emitAtomic emits OpAtomicAdd and OpAtomicXchg: the value goes through
+// %rax and the address through %r11, and the old value, if it's wanted,
+// comes back in %rax
+func (ce *CodeEmitter) emitAtomic(instr *IRInstruction) {
+	width := atomicWidths[instr.Src1.Size]
+	ce.emit("movq", ce.operand(instr.Src1.IndexTemp), RegOp("r11"))
+	ce.emit("movq", ce.operand(instr.Src2), RegOp("rax"))
+	value, target := RegOp(width[1]), MemOp("r11", 0)
+	switch {
+	case instr.Op == OpAtomicXchg:
+		ce.emit("xchg"+width[0], value, target)
+	case instr.Dst == nil:
+		ce.emitPrefixed("lock", "add"+width[0], value, target)
+	default:
+		ce.emitPrefixed("lock", "xadd"+width[0], value, target)
+	}
+	if instr.Dst != nil {
+		ce.extendRAX(instr.Src1.DataType)
+		ce.emit("movq", RegOp("rax"), ce.operand(instr.Dst))
+	}
+}
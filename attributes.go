@@ -0,0 +1,157 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Attributes
+// GCC's __attribute__((...)) specifiers are read wherever a declaration
+// may have them: among its specifiers (before or after the type), after a
+// declarator, after struct or union and after the closing brace of its
+// members, and after a function's parameter list. Each lists attributes,
+// some with arguments, as in __attribute__((ms_abi, format(printf, 1, 2)));
+// the underscored spelling (__packed__) is the same attribute. The compiler
+// acts on:
+//
+//	ms_abi       the function is called with the Windows x64 convention
+//	             (see calling_convention.go)
+//	sysv_abi     with the System V one, as it would be anyway
+//	packed       a struct's members (or the member) get no padding before
+//	             them, and the struct is 1-byte aligned
+//	aligned(N)   a struct, member or variable is aligned to at least N
+//	             bytes (16 if N is left out); a local to at most 16, the
+//	             stack's own alignment
+//	noreturn     calls to the function don't come back: nothing after
+//	             one is emitted, and -Wreturn-type knows (_Noreturn too)
+//	constructor  the function runs before main, or after it returns for
+//	destructor   destructor, in order of priority if given (see
+//	             constructors.go)
+//	used         a static function isn't reported as unused (nor
+//	unused       with unused)
+//
+// and reads the rest only to get past them. An attribute statement
+// (__attribute__((fallthrough));) is an empty statement.
+
+// Attribute is one attribute of a declaration
+type Attribute struct {
+	Name string   // without surrounding underscores: ms_abi for __ms_abi__
+	Args []string // each argument's tokens, joined
+}
+
+// isAttributeKeyword reports whether an identifier starts an attribute
+// specifier
+func isAttributeKeyword(lexeme string) bool {
+	return lexeme == "__attribute__" || lexeme == "__attribute"
+}
+
+// atAttribute reports whether the current token starts one
+func (p *Parser) atAttribute() bool {
+	return p.match(IDENTIFIER) && isAttributeKeyword(p.current().Lexeme)
+}
+
+// parseAttributes reads the __attribute__((...)) specifiers at the current
+// token, if there are any
+func (p *Parser) parseAttributes() []Attribute {
+	var attrs []Attribute
+	for p.atAttribute() {
+		p.advance()
+		attrs = append(attrs, p.parseAttributeList()...)
+	}
+	return attrs
+}
+
+// parseAttributeList reads the ((...)) after __attribute__
+func (p *Parser) parseAttributeList() []Attribute {
+	var attrs []Attribute
+	if !p.match(LPAREN) {
+		return nil
+	}
+	depth := 0
+	for !p.match(EOF) {
+		tok := p.current()
+		p.advance()
+		switch {
+		case tok.Type == LPAREN:
+			depth++
+			if depth == 3 && len(attrs) > 0 {
+				attrs[len(attrs)-1].Args = append(attrs[len(attrs)-1].Args, "")
+				continue
+			}
+		case tok.Type == RPAREN:
+			depth--
+			if depth == 0 {
+				return attrs
+			}
+		case tok.Type == COMMA && depth <= 3:
+			if depth == 3 && len(attrs) > 0 {
+				attrs[len(attrs)-1].Args = append(attrs[len(attrs)-1].Args, "")
+			}
+			continue
+		case depth == 2:
+			// Names can be keywords: __attribute__((const))
+			attrs = append(attrs, Attribute{Name: strings.TrimSuffix(strings.TrimPrefix(tok.Lexeme, "__"), "__")})
+			continue
+		}
+		if depth >= 3 && len(attrs) > 0 && len(attrs[len(attrs)-1].Args) > 0 {
+			args := attrs[len(attrs)-1].Args
+			args[len(args)-1] += tok.Lexeme
+		}
+	}
+	return attrs
+}
+
+// hasAttribute reports whether attrs include the named attribute
+func hasAttribute(attrs []Attribute, name string) bool {
+	for _, attr := range attrs {
+		if attr.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// attributeNumber is an attribute's integer argument, if it has one
+func attributeNumber(attr Attribute, arg int) (int, bool) {
+	if arg >= len(attr.Args) {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.TrimRight(strings.Trim(attr.Args[arg], "()"), "uUlL"), 0, 64)
+	return int(n), err == nil
+}
+
+// alignedAttribute is the alignment attrs ask for (the largest, if several
+// do), or 0 if they don't
+func alignedAttribute(attrs []Attribute) int {
+	align := 0
+	for _, attr := range attrs {
+		if attr.Name != "aligned" {
+			continue
+		}
+		n, ok := attributeNumber(attr, 0)
+		if !ok {
+			n = 16 // the largest alignment any type has
+		}
+		align = max(align, n)
+	}
+	return align
+}
+
+// applyAttributes records what a struct's attributes ask of its layout
+func (def *StructDef) applyAttributes(attrs []Attribute) {
+	def.Packed = def.Packed || hasAttribute(attrs, "packed")
+	def.Aligned = max(def.Aligned, alignedAttribute(attrs))
+}
+
+// applyAttributes records what a member's attributes ask of its place in
+// its struct
+func (member *StructMember) applyAttributes(attrs []Attribute) {
+	member.Packed = member.Packed || hasAttribute(attrs, "packed")
+	member.Aligned = max(member.Aligned, alignedAttribute(attrs))
+}
+
+// atNoreturn reports whether the current token is C11's _Noreturn, which is
+// the noreturn attribute
+func (p *Parser) atNoreturn() bool {
+	return p.match(IDENTIFIER) && p.current().Lexeme == "_Noreturn"
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Benchmark harness: ccompiler bench <dir> [--cc=gcc] [--runs=N] [options]
+// Every .c file in dir is built twice, by this compiler (with the usual
+// compiler options) and by the reference compiler at -O2, and both binaries
+// are run --runs times (default 3). The table compares compile time (source
+// to linked binary, no cache), binary size and the best run time, each as
+// ours/reference, with the geometric mean of each column at the bottom.
+// The two builds must print the same output and exit the same way; a
+// benchmark where they don't is reported and left out of the means, since
+// timing a miscompile says nothing.
+
+// benchRunTimeout bounds each benchmark run
+const benchRunTimeout = 60 * time.Second
+
+// benchSide is one compiler's build and runs of a benchmark
+type benchSide struct {
+	compile time.Duration
+	size    int64
+	run     time.Duration // the best of the runs
+	output  goldenResult
+}
+
+// runBenchCommand implements the bench subcommand and returns the exit status
+func runBenchCommand(args []string) int {
+	reference, runs := "gcc", 3
+	var rest []string
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--cc="):
+			reference = strings.TrimPrefix(arg, "--cc=")
+		case strings.HasPrefix(arg, "--runs="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--runs="))
+			if err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "Error: --runs needs a positive count, got %q\n", strings.TrimPrefix(arg, "--runs="))
+				return 2
+			}
+			runs = n
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	cl, err := parseCommandLine(rest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	dir := cl.sourceFile
+	if dir == "" {
+		fmt.Fprintln(os.Stderr, "Usage: ccompiler bench <dir> [--cc=gcc] [--runs=N] [options]")
+		return 2
+	}
+	if _, err := exec.LookPath(reference); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: reference compiler %s not found\n", reference)
+		return 2
+	}
+	sources, err := filepath.Glob(filepath.Join(dir, "*.c"))
+	if err != nil || len(sources) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no .c files in %s\n", dir)
+		return 2
+	}
+	sort.Strings(sources)
+
+	workDir, err := os.MkdirTemp("", "ccompiler-bench-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	defer os.RemoveAll(workDir)
+
+	options := cl.options
+	options.Cache = false // Time the whole compile
+	failed := 0
+	var compileRatios, sizeRatios, runRatios []float64
+	fmt.Printf("%-20s %-28s %-26s %s\n", "benchmark", "compile (ours / "+reference+")", "size (ours / "+reference+")", "run (ours / "+reference+")")
+	for _, source := range sources {
+		name := strings.TrimSuffix(filepath.Base(source), ".c")
+		binary := filepath.Join(workDir, name)
+		ours, err := benchOurs(source, binary, options, runs)
+		if err != nil {
+			failed++
+			fmt.Printf("%-20s FAIL (ours): %v\n", name, err)
+			continue
+		}
+		ref, err := benchReference(reference, source, binary+".ref", runs)
+		if err != nil {
+			failed++
+			fmt.Printf("%-20s FAIL (%s): %v\n", name, reference, err)
+			continue
+		}
+		if ours.output != ref.output {
+			failed++
+			fmt.Printf("%-20s FAIL: output differs from %s: %s\n", name, reference, describeMismatch(ref.output, ours.output))
+			continue
+		}
+		compileRatios = append(compileRatios, ratio(ours.compile.Seconds(), ref.compile.Seconds()))
+		sizeRatios = append(sizeRatios, ratio(float64(ours.size), float64(ref.size)))
+		runRatios = append(runRatios, ratio(ours.run.Seconds(), ref.run.Seconds()))
+		fmt.Printf("%-20s %-28s %-26s %s\n", name,
+			benchColumn(formatBenchDuration(ours.compile), formatBenchDuration(ref.compile), compileRatios[len(compileRatios)-1]),
+			benchColumn(formatBenchSize(ours.size), formatBenchSize(ref.size), sizeRatios[len(sizeRatios)-1]),
+			benchColumn(formatBenchDuration(ours.run), formatBenchDuration(ref.run), runRatios[len(runRatios)-1]))
+	}
+
+	if len(runRatios) > 0 {
+		fmt.Printf("%-20s %-28s %-26s %s\n", "geomean",
+			fmt.Sprintf("%27.2fx", geomean(compileRatios)),
+			fmt.Sprintf("%25.2fx", geomean(sizeRatios)),
+			fmt.Sprintf("%24.2fx", geomean(runRatios)))
+	}
+	fmt.Printf("\n%d benchmarked, %d failed\n", len(runRatios), failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// benchOurs builds source with this compiler and times its runs
+func benchOurs(source, binary string, options CompilerOptions, runs int) (side benchSide, err error) {
+	text, err := os.ReadFile(source)
+	if err != nil {
+		return benchSide{}, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			side, err = benchSide{}, fmt.Errorf("compiler panicked: %v", r)
+		}
+	}()
+	options.SourceFile = source
+	start := time.Now()
+	compiler := NewCompilerPipeline(string(text), options)
+	if err := compiler.Compile(); err != nil {
+		return benchSide{}, fmt.Errorf("compile: %v", err)
+	}
+	if err := compiler.AssembleAndLink(binary); err != nil {
+		return benchSide{}, fmt.Errorf("link: %v", err)
+	}
+	side.compile = time.Since(start)
+	return side, side.measure(source, binary, runs)
+}
+
+// benchReference builds source with the reference compiler at -O2 and times
+// its runs
+func benchReference(reference, source, binary string, runs int) (side benchSide, err error) {
+	start := time.Now()
+	out, err := exec.Command(reference, "-O2", "-w", source, "-o", binary, "-lm").CombinedOutput()
+	if err != nil {
+		return benchSide{}, fmt.Errorf("compile: %v\n%s", err, out)
+	}
+	side.compile = time.Since(start)
+	return side, side.measure(source, binary, runs)
+}
+
+// measure records binary's size, output and best run time
+func (side *benchSide) measure(source, binary string, runs int) error {
+	info, err := os.Stat(binary)
+	if err != nil {
+		return err
+	}
+	side.size = info.Size()
+	for i := 0; i < runs; i++ {
+		output, elapsed, err := benchRun(source, binary)
+		if err != nil {
+			return err
+		}
+		if i == 0 || elapsed < side.run {
+			side.run = elapsed
+		}
+		side.output = output
+	}
+	return nil
+}
+
+// benchRun runs binary once from source's directory
+func benchRun(source, binary string) (goldenResult, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), benchRunTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, binary)
+	cmd.Dir = filepath.Dir(source)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = io.Discard
+	start := time.Now()
+	err := cmd.Run()
+	elapsed := time.Since(start)
+	if ctx.Err() != nil {
+		return goldenResult{}, 0, fmt.Errorf("timed out after %v", benchRunTimeout)
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return goldenResult{}, 0, fmt.Errorf("run: %v", err)
+	}
+	return goldenResult{stdout: stdout.String(), exitCode: cmd.ProcessState.ExitCode()}, elapsed, nil
+}
+
+// benchColumn renders "ours / reference  ratio"
+func benchColumn(ours, reference string, r float64) string {
+	return fmt.Sprintf("%8s / %-8s %6.2fx", ours, reference, r)
+}
+
+func ratio(ours, reference float64) float64 {
+	if reference <= 0 {
+		return math.NaN()
+	}
+	return ours / reference
+}
+
+// geomean is the geometric mean of the ratios that are defined
+func geomean(ratios []float64) float64 {
+	sum, n := 0.0, 0
+	for _, r := range ratios {
+		if r > 0 && !math.IsNaN(r) && !math.IsInf(r, 0) {
+			sum += math.Log(r)
+			n++
+		}
+	}
+	if n == 0 {
+		return math.NaN()
+	}
+	return math.Exp(sum / float64(n))
+}
+
+func formatBenchDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	case d >= time.Millisecond:
+		return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+	}
+	return fmt.Sprintf("%dus", d.Microseconds())
+}
+
+func formatBenchSize(size int64) string {
+	if size >= 1<<20 {
+		return fmt.Sprintf("%.1fM", float64(size)/(1<<20))
+	}
+	return fmt.Sprintf("%.1fK", float64(size)/(1<<10))
+}
@@ -0,0 +1,27 @@
+#include <stdio.h>
+
+// Integer arithmetic and branches: longest Collatz chain
+int main() {
+    long best = 0;
+    long bestStart = 0;
+    long start = 1;
+    while (start < 300000) {
+        long n = start;
+        long steps = 0;
+        while (n != 1) {
+            if (n % 2 == 0) {
+                n = n / 2;
+            } else {
+                n = 3 * n + 1;
+            }
+            steps++;
+        }
+        if (steps > best) {
+            best = steps;
+            bestStart = start;
+        }
+        start++;
+    }
+    printf("longest chain below 300000 starts at %ld (%ld steps)\n", bestStart, best);
+    return 0;
+}
@@ -0,0 +1,14 @@
+#include <stdio.h>
+
+// Call-heavy: naive recursion
+int fib(int n) {
+    if (n < 2) {
+        return n;
+    }
+    return fib(n - 1) + fib(n - 2);
+}
+
+int main() {
+    printf("fib(32) = %d\n", fib(32));
+    return 0;
+}
@@ -0,0 +1,30 @@
+#include <stdio.h>
+
+// Floating-point loops: a 120x120 matrix product
+int main() {
+    double a[14400];
+    double b[14400];
+    double c[14400];
+    int n = 120;
+    for (int i = 0; i < n; i++) {
+        for (int j = 0; j < n; j++) {
+            a[i * n + j] = (i + j) % 7 - 3;
+            b[i * n + j] = (i * j) % 5 - 2;
+        }
+    }
+    for (int i = 0; i < n; i++) {
+        for (int j = 0; j < n; j++) {
+            double sum = 0;
+            for (int k = 0; k < n; k++) {
+                sum += a[i * n + k] * b[k * n + j];
+            }
+            c[i * n + j] = sum;
+        }
+    }
+    double trace = 0;
+    for (int i = 0; i < n; i++) {
+        trace += c[i * n + i];
+    }
+    printf("trace = %.1f, c[5][7] = %.1f\n", trace, c[5 * n + 7]);
+    return 0;
+}
@@ -0,0 +1,42 @@
+#include <stdio.h>
+
+// Struct-heavy: an array of particles stepped through a simulation
+typedef struct {
+    double x;
+    double y;
+    double vx;
+    double vy;
+} Particle;
+
+void step(Particle *p, int count, double dt) {
+    for (int i = 0; i < count; i++) {
+        p[i].vy = p[i].vy - 9.8 * dt;
+        p[i].x = p[i].x + p[i].vx * dt;
+        p[i].y = p[i].y + p[i].vy * dt;
+        if (p[i].y < 0) {
+            p[i].y = -p[i].y;
+            p[i].vy = -p[i].vy * 0.9;
+        }
+    }
+}
+
+int main() {
+    Particle particles[256];
+    for (int i = 0; i < 256; i++) {
+        particles[i].x = i;
+        particles[i].y = 10 + i % 13;
+        particles[i].vx = (i % 5) - 2;
+        particles[i].vy = 0;
+    }
+    for (int t = 0; t < 4000; t++) {
+        step(particles, 256, 0.001);
+    }
+    double sx = 0;
+    double sy = 0;
+    for (int i = 0; i < 256; i++) {
+        sx += particles[i].x;
+        sy += particles[i].y;
+    }
+    printf("centroid = (%.3f, %.3f)\n", sx / 256, sy / 256);
+    return 0;
+}
@@ -0,0 +1,24 @@
+#include <stdio.h>
+
+// Array-heavy: sieve of Eratosthenes, repeated
+int main() {
+    int composite[100000];
+    int total = 0;
+    for (int round = 0; round < 20; round++) {
+        for (int i = 0; i < 100000; i++) {
+            composite[i] = 0;
+        }
+        int count = 0;
+        for (int i = 2; i < 100000; i++) {
+            if (!composite[i]) {
+                count++;
+                for (int j = i + i; j < 100000; j += i) {
+                    composite[j] = 1;
+                }
+            }
+        }
+        total += count;
+    }
+    printf("primes below 100000: %d (x20 = %d)\n", total / 20, total);
+    return 0;
+}
@@ -0,0 +1,191 @@
+package main
+
+import "fmt"
+
+// Bit builtins
+// gcc's builtins for counting and reordering the bits of an integer, which
+// hashes, bitsets and byte-order code lean on:
+//
+//	__builtin_popcount(x)   set bits          popcnt
+//	__builtin_clz(x)        leading zeros     lzcnt
+//	__builtin_ctz(x)        trailing zeros    tzcnt
+//	__builtin_bswap32(x)    bytes reversed    bswap
+//
+// popcount, clz and ctz take an unsigned int, and with an l or ll suffix an
+// unsigned long; they yield an int. bswap16, bswap32 and bswap64 take and
+// yield the unsigned integer of their width. As in gcc, clz and ctz of 0
+// are undefined (lzcnt and tzcnt give the width).
+//
+// Each is selected as one instruction, through %rax like the other
+// operations the emitter splits itself:
+//
+//	popcnt  dst, x, 4    the operand's width in bytes
+//
+// popcnt, lzcnt and tzcnt (BMI) aren't in every x86-64, and -mno-popcnt,
+// -mno-lzcnt and -mno-bmi turn them off, leaving a call of libgcc's
+// __popcountdi2, __clzdi2 or __ctzdi2 on the value as an unsigned long (an
+// unsigned int one less 32 leading zeros). Every x86-64 has bswap. AArch64
+// calls libgcc for all of them, byte swaps included.
+
+// bitBuiltin describes one of the builtins
+type bitBuiltin struct {
+	op     OpCode
+	width  int    // bytes in the operand
+	libgcc string // what to call without the instruction
+}
+
+var bitBuiltins = map[string]bitBuiltin{
+	"__builtin_popcount":   {OpPopcnt, 4, "__popcountdi2"},
+	"__builtin_popcountl":  {OpPopcnt, 8, "__popcountdi2"},
+	"__builtin_popcountll": {OpPopcnt, 8, "__popcountdi2"},
+	"__builtin_clz":        {OpClz, 4, "__clzdi2"},
+	"__builtin_clzl":       {OpClz, 8, "__clzdi2"},
+	"__builtin_clzll":      {OpClz, 8, "__clzdi2"},
+	"__builtin_ctz":        {OpCtz, 4, "__ctzdi2"},
+	"__builtin_ctzl":       {OpCtz, 8, "__ctzdi2"},
+	"__builtin_ctzll":      {OpCtz, 8, "__ctzdi2"},
+	"__builtin_bswap16":    {OpBswap, 2, "__bswapsi2"},
+	"__builtin_bswap32":    {OpBswap, 4, "__bswapsi2"},
+	"__builtin_bswap64":    {OpBswap, 8, "__bswapdi2"},
+}
+
+// bitMnemonics are the instructions for the ops
+var bitMnemonics = map[OpCode]string{OpPopcnt: "popcnt", OpClz: "lzcnt", OpCtz: "tzcnt", OpBswap: "bswap"}
+
+// isLibgccHelper reports whether name is a libgcc function the builtins
+// call
+func isLibgccHelper(name string) bool {
+	for _, builtin := range bitBuiltins {
+		if builtin.libgcc == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasBitInstr reports whether op's instruction may be used
+func (is *InstructionSelector) hasBitInstr(op OpCode) bool {
+	switch {
+	case is.target.Arch == "aarch64":
+		return false
+	case op == OpPopcnt:
+		return !is.noPopcnt
+	case op == OpClz:
+		return !is.noLzcnt
+	case op == OpCtz:
+		return !is.noBMI
+	}
+	return true
+}
+
+// selectBitBuiltin selects a call of a bit builtin; ok is false if node
+// doesn't call one
+func (is *InstructionSelector) selectBitBuiltin(node *ASTNode) (result *Operand, ok bool, err error) {
+	builtin, ok := bitBuiltins[node.Name]
+	if !ok {
+		return nil, false, nil
+	}
+	if len(node.Children) != 1 {
+		return nil, true, fmt.Errorf("in function '%s': %s takes 1 argument", is.currentFunc, node.Name)
+	}
+	typ := "int"
+	if builtin.op == OpBswap {
+		typ = integerName(is.target, builtin.width, true)
+		if builtin.width == 2 {
+			typ = "unsigned short"
+		}
+	}
+
+	if !is.hasBitInstr(builtin.op) {
+		// The checker converted the argument to the parameter's type, so
+		// it's already the unsigned long libgcc takes
+		call := &ASTNode{Type: NodeCall, Name: builtin.libgcc, Children: node.Children}
+		value, err := is.selectExpression(call)
+		if err != nil {
+			return nil, true, err
+		}
+		switch {
+		case builtin.op == OpClz && builtin.width == 4:
+			result = is.newTemp()
+			is.emit(OpSub, result, value, &Operand{Type: "imm", Value: "32"})
+		case builtin.op == OpBswap && builtin.width == 2:
+			result = is.newTemp()
+			is.emit(OpShr, result, value, &Operand{Type: "imm", Value: "16"})
+		default:
+			return value, true, nil
+		}
+		result.DataType = typ
+		return result, true, nil
+	}
+
+	value, err := is.selectExpression(node.Children[0])
+	if err != nil {
+		return nil, true, err
+	}
+	result = is.newTemp()
+	result.DataType = typ
+	is.emit(builtin.op, result, value, &Operand{Type: "imm", Value: fmt.Sprint(builtin.width)})
+	return result, true, nil
+}
+
+// emitBitOp emits OpPopcnt, OpClz, OpCtz and OpBswap on the width Src2
+// gives. A 16-bit swap is a 32-bit one of the zero-extended value, shifted
+// back down.
+func (ce *CodeEmitter) emitBitOp(instr *IRInstruction) {
+	name := bitMnemonics[instr.Op]
+	ce.emit("movq", ce.operand(instr.Src1), RegOp("rax"))
+	switch {
+	case instr.Op == OpBswap && instr.Src2.Value == "8":
+		ce.emit("bswapq", RegOp("rax"))
+	case instr.Op == OpBswap:
+		ce.emit("bswapl", RegOp("eax"))
+		if instr.Src2.Value == "2" {
+			ce.emit("shrq", ImmOp(16), RegOp("rax"))
+		}
+	case instr.Src2.Value == "8":
+		ce.emit(name+"q", RegOp("rax"), RegOp("rax"))
+	default:
+		ce.emit(name+"l", RegOp("eax"), RegOp("eax"))
+	}
+	ce.emit("movq", RegOp("rax"), ce.operand(instr.Dst))
+}
+
+// encodeBitCount handles popcnt (F3 0F B8 /r), lzcnt (F3 0F BD /r) and
+// tzcnt (F3 0F BC /r), l and q, from a register or memory into a register
+func (a *Assembler) encodeBitCount(opcode byte, name string, operands []MachineOperand) error {
+	src, dst, err := operandPair(name, operands)
+	if err != nil {
+		return err
+	}
+	dstReg := regOf(dst)
+	if dstReg == -1 {
+		return fmt.Errorf("%s destination must be a register: %s", name, dst)
+	}
+	w := name[len(name)-1] == 'q'
+	if srcReg := regOf(src); srcReg != -1 {
+		a.emitSSE(0xF3, w, opcode, dstReg, srcReg, nil)
+		return nil
+	}
+	mem, ok := memOf(src)
+	if !ok {
+		return fmt.Errorf("invalid %s source: %s", name, src)
+	}
+	a.emitSSE(0xF3, w, opcode, dstReg, -1, &mem)
+	return nil
+}
+
+// encodeBswap handles bswapl and bswapq (0F C8+r) of a register
+func (a *Assembler) encodeBswap(name string, operands []MachineOperand) error {
+	if len(operands) != 1 {
+		return fmt.Errorf("%s requires 1 operand", name)
+	}
+	reg := regOf(operands[0])
+	if reg == -1 {
+		return fmt.Errorf("%s operand must be a register: %s", name, operands[0])
+	}
+	if rex := rexFor(name == "bswapq", 0, reg); rex != 0 {
+		a.emit(rex)
+	}
+	a.emit(0x0F, 0xC8+byte(reg&7))
+	return nil
+}
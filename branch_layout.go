@@ -0,0 +1,176 @@
+package main
+
+// Static branch layout (-O1 and up)
+// if/else is normally laid out then-branch first, so the then-branch is the
+// fall-through path and the else is reached by a jump. When the then-branch
+// looks unlikely it's placed out of line instead:
+//
+//	jnz .L_cold, cond          jz .L_cold, cond
+//	<else>                     <then>
+//	jmp .L_endif               jmp .L_endif
+//	.L_cold: <then>            .L_cold: <else>
+//	.L_endif:                  .L_endif:
+//
+// and layoutColdBlocks later moves each .L_cold block to the end of its
+// function, so the likely path runs straight through. A branch is unlikely
+// if __builtin_expect says so, or if it looks like error handling: it calls
+// exit, abort or perror, or returns a negative constant. Loops are
+// rotated so the test sits at the bottom and the back-edge, which is nearly
+// always taken, is the conditional jump.
+
+// coldFunctions are calls that mark the branch making them as cold
+var coldFunctions = map[string]bool{
+	"exit": true, "abort": true, "_exit": true, "perror": true, "__assert_fail": true,
+}
+
+// predictThen guesses whether the then-branch of an if is taken: +1 likely,
+// -1 unlikely, 0 no idea
+func predictThen(node *ASTNode) int {
+	if expected, ok := builtinExpectation(node.Children[0]); ok {
+		if expected {
+			return 1
+		}
+		return -1
+	}
+	if isErrorPath(node.Children[1]) {
+		return -1
+	}
+	if len(node.Children) > 2 && isErrorPath(node.Children[2]) {
+		return 1
+	}
+	return 0
+}
+
+// builtinExpectation reads the expected truth value of a
+// __builtin_expect(e, c) condition
+func builtinExpectation(cond *ASTNode) (expected bool, ok bool) {
+	if cond.Type != NodeCall || cond.Name != "__builtin_expect" || len(cond.Children) != 2 {
+		return false, false
+	}
+	c := cond.Children[1]
+	if c.Type != NodeNumber {
+		return false, false
+	}
+	return c.Value != "0", true
+}
+
+// isErrorPath reports whether a statement bails out: it calls one of
+// coldFunctions or returns a negative constant
+func isErrorPath(node *ASTNode) bool {
+	if node == nil {
+		return false
+	}
+	switch node.Type {
+	case NodeCall:
+		if coldFunctions[node.Name] {
+			return true
+		}
+	case NodeReturn:
+		if len(node.Children) > 0 {
+			value := node.Children[0]
+			if value.Type == NodeUnaryOp && value.Operator == "-" && value.Children[0].Type == NodeNumber {
+				return true
+			}
+		}
+	}
+	for _, child := range node.Children {
+		if isErrorPath(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// layoutColdBlocks moves each cold block to the end of its function. A block
+// only moves if none of its temps are used outside it and no temp is live
+// across it: live ranges are linear, so a temp held over the moved block
+// could share a register with one inside it.
+func (is *InstructionSelector) layoutColdBlocks() {
+	if len(is.coldBlocks) == 0 {
+		return
+	}
+	instrs := is.instructions
+	is.instructions = make([]*IRInstruction, 0, len(instrs))
+	start := 0
+	for start < len(instrs) {
+		end := start + 1
+		for end < len(instrs) && !(instrs[end].Op == OpLabel && isFunctionLabel(instrs[end].Dst.Value)) {
+			end++
+		}
+		is.instructions = append(is.instructions, is.sinkColdBlocks(instrs[start:end])...)
+		start = end
+	}
+}
+
+// sinkColdBlocks moves the movable cold blocks of one function to its end,
+// after the final return
+func (is *InstructionSelector) sinkColdBlocks(fn []*IRInstruction) []*IRInstruction {
+	moved := make(map[string]bool)
+	for {
+		next := -1
+		for i, instr := range fn {
+			if instr.Op == OpLabel && !moved[instr.Dst.Value] {
+				if _, cold := is.coldBlocks[instr.Dst.Value]; cold {
+					next = i
+					break
+				}
+			}
+		}
+		if next < 0 {
+			return fn
+		}
+		label := fn[next].Dst.Value
+		moved[label] = true
+		end := -1
+		for i := next + 1; i < len(fn); i++ {
+			if fn[i].Op == OpLabel && fn[i].Dst.Value == is.coldBlocks[label] {
+				end = i
+				break
+			}
+		}
+		// The block is entered only by its jump: what precedes it jumps
+		// over it to the end label
+		jumpsOver := fn[next-1].Op == OpJmp && fn[next-1].Dst.Value == is.coldBlocks[label]
+		if end < 0 || !jumpsOver || !isolatedTemps(fn, next, end) {
+			continue
+		}
+		block := fn[next:end]
+		rest := make([]*IRInstruction, 0, len(fn)+1)
+		rest = append(rest, fn[:next-1]...)
+		rest = append(rest, fn[end:]...)
+		rest = append(rest, block...)
+		rest = append(rest, &IRInstruction{Op: OpJmp, Dst: &Operand{Type: "label", Value: is.coldBlocks[label]}})
+		fn = rest
+	}
+}
+
+// isolatedTemps reports whether fn[start:end] shares no temps with the rest
+// of fn, and no temp is live across it
+func isolatedTemps(fn []*IRInstruction, start, end int) bool {
+	first := make(map[string]int)
+	last := make(map[string]int)
+	inside := make(map[string]bool)
+	for i, instr := range fn {
+		for _, op := range tempOperands(instr) {
+			if op == nil || op.Type != "temp" {
+				continue
+			}
+			if _, seen := first[op.Value]; !seen {
+				first[op.Value] = i
+			}
+			last[op.Value] = i
+			if i >= start && i < end {
+				inside[op.Value] = true
+			}
+		}
+	}
+	for name := range first {
+		if inside[name] && (first[name] < start || last[name] >= end) {
+			return false
+		}
+		if first[name] < start && last[name] >= end {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// ByteEncoder is the single place multi-byte values are turned into bytes
+// The assembler, data sections, linker relocations and ELF writer all go
+// through it, so a big-endian or 32-bit target only has to swap the encoder.
+type ByteEncoder struct {
+	Order    binary.ByteOrder
+	WordSize int // pointer/address size in bytes (4 or 8)
+}
+
+// x86-64: little-endian, 64-bit addresses
+var encoderX86_64 = ByteEncoder{Order: binary.LittleEndian, WordSize: 8}
+
+// Append encodes the low size bytes of val (size 1, 2, 4 or 8) onto dst
+func (e ByteEncoder) Append(dst []byte, val uint64, size int) []byte {
+	var tmp [8]byte
+	if size != 1 && size != 2 && size != 4 {
+		size = 8
+	}
+	e.Put(tmp[:size], val, size)
+	return append(dst, tmp[:size]...)
+}
+
+// Put encodes val into dst[0:size] in place (used for back-patching)
+func (e ByteEncoder) Put(dst []byte, val uint64, size int) {
+	switch size {
+	case 1:
+		dst[0] = byte(val)
+	case 2:
+		e.Order.PutUint16(dst, uint16(val))
+	case 4:
+		e.Order.PutUint32(dst, uint32(val))
+	default:
+		e.Order.PutUint64(dst, val)
+	}
+}
+
+// AppendWord encodes an address-sized value
+func (e ByteEncoder) AppendWord(dst []byte, val uint64) []byte {
+	return e.Append(dst, val, e.WordSize)
+}
+
+// WriteStruct serializes a fixed-size header struct (ELF headers, symbols)
+func (e ByteEncoder) WriteStruct(buf *bytes.Buffer, v any) {
+	binary.Write(buf, e.Order, v)
+}
+
+// ELFData returns the e_ident[EI_DATA] value: 1 little-endian, 2 big-endian
+func (e ByteEncoder) ELFData() byte {
+	if e.Order == binary.BigEndian {
+		return 2
+	}
+	return 1
+}
+
+// ELFClass returns the e_ident[EI_CLASS] value: 1 for 32-bit, 2 for 64-bit
+func (e ByteEncoder) ELFClass() byte {
+	if e.WordSize == 4 {
+		return 1
+	}
+	return 2
+}
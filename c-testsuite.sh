@@ -0,0 +1,89 @@
+#!/bin/bash
+# Conformance run against the public c-testsuite (single-exec tests)
+# https://github.com/c-testsuite/c-testsuite
+#
+# Usage: ./c-testsuite.sh [suite-dir]
+#
+# Each tests/single-exec/NNNNN.c must compile, exit 0, and print exactly
+# NNNNN.c.expected; a test without an .expected file is skipped, not
+# counted. One summary line per run is appended to
+# c-testsuite-results.tsv so coverage can be tracked over time, and the
+# per-test status of the latest run is written to c-testsuite-latest.txt
+# (diff two of those to see what a change fixed or broke).
+
+SUITE_DIR="${1:-/tmp/c-testsuite}"
+RESULTS_FILE="c-testsuite-results.tsv"
+LATEST_FILE="c-testsuite-latest.txt"
+WORK_DIR="$(mktemp -d /tmp/c-testsuite-run.XXXXXX)"
+trap 'rm -rf "$WORK_DIR"' EXIT
+COMPILER="$WORK_DIR/ccompiler"
+TIMEOUT=10
+
+if [ ! -d "$SUITE_DIR/tests/single-exec" ]; then
+    echo "Fetching c-testsuite into $SUITE_DIR..."
+    git clone --depth 1 https://github.com/c-testsuite/c-testsuite "$SUITE_DIR" || exit 1
+fi
+
+# Always measure the current source, not a stale binary
+echo "Building compiler..."
+go build -o "$COMPILER" . || exit 1
+
+pass=0
+fail_compile=0
+fail_run=0
+fail_output=0
+skipped=0
+: > "$LATEST_FILE"
+
+for src in "$SUITE_DIR"/tests/single-exec/*.c; do
+    name="$(basename "$src" .c)"
+    expected="$src.expected"
+    bin="$WORK_DIR/$name"
+
+    if [ ! -f "$expected" ]; then
+        echo "$name SKIP" >> "$LATEST_FILE"
+        skipped=$((skipped + 1))
+        continue
+    fi
+
+    if ! timeout "$TIMEOUT" "$COMPILER" "$src" -o "$bin" > "$WORK_DIR/$name.log" 2>&1; then
+        echo "$name COMPILE" >> "$LATEST_FILE"
+        fail_compile=$((fail_compile + 1))
+        continue
+    fi
+
+    if ! timeout "$TIMEOUT" "$bin" > "$WORK_DIR/$name.out" 2>/dev/null; then
+        echo "$name RUN" >> "$LATEST_FILE"
+        fail_run=$((fail_run + 1))
+        continue
+    fi
+
+    if ! cmp -s "$WORK_DIR/$name.out" "$expected"; then
+        echo "$name OUTPUT" >> "$LATEST_FILE"
+        fail_output=$((fail_output + 1))
+        continue
+    fi
+
+    echo "$name PASS" >> "$LATEST_FILE"
+    pass=$((pass + 1))
+done
+
+total=$((pass + fail_compile + fail_run + fail_output))
+commit="$(git rev-parse --short HEAD 2>/dev/null || echo unknown)"
+
+if [ ! -f "$RESULTS_FILE" ]; then
+    printf "date\tcommit\tpass\tcompile_fail\trun_fail\toutput_fail\ttotal\tskipped\n" > "$RESULTS_FILE"
+fi
+printf "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\n" "$(date -u +%Y-%m-%dT%H:%M:%SZ)" "$commit" \
+    "$pass" "$fail_compile" "$fail_run" "$fail_output" "$total" "$skipped" >> "$RESULTS_FILE"
+
+echo "================================================"
+echo "c-testsuite results ($commit)"
+echo "================================================"
+echo "  Passed:          $pass / $total"
+echo "  Compile failure: $fail_compile"
+echo "  Runtime failure: $fail_run"
+echo "  Wrong output:    $fail_output"
+echo "  Skipped:         $skipped (no .expected)"
+echo ""
+echo "History: $RESULTS_FILE   Per-test: $LATEST_FILE"
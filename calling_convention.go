@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Calling conventions
+// The selector writes arguments, parameters and results as moves to and
+// from the physical registers the target's ABI puts them in, so those
+// registers come from the target's CallingConvention rather than being
+// spelled out at each call and return:
+//
+//   - x86-64 System V: integers in rdi, rsi, rdx, rcx, r8, r9, doubles in
+//     xmm0-xmm7, results in rax/rdx and xmm0/xmm1; a struct result too big
+//     for registers is written through a pointer passed as the first
+//     argument, and variadic callees get the number of vector registers
+//     used in %al. A float argument or result is single precision in
+//     its register (see conversions.go). Arguments past the registers
+//     are pushed an eightbyte each, last to first, with %rsp kept 16-byte
+//     aligned at the call; the callee copies them from above its return
+//     address into its parameter slots, and the caller pops them after.
+//     A struct goes there whole if it's over 16 bytes, or if its
+//     eightbytes don't all fit in the registers left.
+//   - AArch64 (AAPCS64): integers in x0-x7, doubles in d0-d7, results in
+//     x0/x1 and d0/d1; the result pointer travels in x8, outside the
+//     argument registers. Structs of up to 16 bytes go in integer
+//     registers unless every member is a double. (Structs of floats are
+//     passed that way too, not as homogeneous aggregates in s registers.)
+//     Arguments past the registers, and structs over 16 bytes, aren't
+//     passed yet.
+//   - Windows x64, for functions declared __attribute__((ms_abi)) (see
+//     attributes.go), so code written for it can be called and can call
+//     back: the first four arguments in rcx, rdx, r8, r9 or xmm0-xmm3 by
+//     position (a third argument is r8 or xmm2, whatever the first two
+//     were), the rest pushed above 32 bytes the caller reserves for the
+//     callee to keep the four in; results in rax and xmm0. The callee must
+//     keep rdi, rsi and xmm6-xmm15, which System V code changes freely, so
+//     an ms_abi function saves them on entry and restores them on return.
+//     Structs aren't passed to or returned from ms_abi functions by value,
+//     and floating arguments aren't passed to variadic ones.
+
+// CallingConvention names the registers one ABI passes values in
+type CallingConvention struct {
+	Name         string
+	IntArgs      []string
+	FloatArgs    []string
+	IntResults   []string
+	FloatResults []string
+
+	StructReturn      string   // holds the address a large struct result is written to
+	StructReturnIsArg bool     // StructReturn is IntArgs[0], so the arguments start at IntArgs[1]
+	VarargCount       string   // gets the number of FloatArgs a variadic call uses ("" if not needed)
+	EightbyteClasses  bool     // each eightbyte of a small struct takes its own class (SysV); otherwise the struct has one
+	StackArgs         bool     // arguments past the registers are passed on the stack
+	Positional        bool     // the n'th argument takes the n'th register of its class, skipping the other class's
+	ShadowSpace       int      // bytes the caller reserves below the stack arguments for the callee
+	Preserves         []string // registers the callee keeps that System V code doesn't
+}
+
+var sysVConvention = &CallingConvention{
+	Name:              "sysv",
+	IntArgs:           []string{"rdi", "rsi", "rdx", "rcx", "r8", "r9"},
+	FloatArgs:         []string{"xmm0", "xmm1", "xmm2", "xmm3", "xmm4", "xmm5", "xmm6", "xmm7"},
+	IntResults:        []string{"rax", "rdx"},
+	FloatResults:      []string{"xmm0", "xmm1"},
+	StructReturn:      "rdi",
+	StructReturnIsArg: true,
+	VarargCount:       "rax",
+	EightbyteClasses:  true,
+	StackArgs:         true,
+}
+
+var aapcs64Convention = &CallingConvention{
+	Name:         "aapcs64",
+	IntArgs:      []string{"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7"},
+	FloatArgs:    []string{"d0", "d1", "d2", "d3", "d4", "d5", "d6", "d7"},
+	IntResults:   []string{"x0", "x1"},
+	FloatResults: []string{"d0", "d1"},
+	StructReturn: "x8",
+}
+
+var msABIConvention = &CallingConvention{
+	Name:              "ms_abi",
+	IntArgs:           []string{"rcx", "rdx", "r8", "r9"},
+	FloatArgs:         []string{"xmm0", "xmm1", "xmm2", "xmm3"},
+	IntResults:        []string{"rax"},
+	FloatResults:      []string{"xmm0"},
+	StructReturn:      "rcx",
+	StructReturnIsArg: true,
+	StackArgs:         true,
+	Positional:        true,
+	ShadowSpace:       32,
+	Preserves:         []string{"rdi", "rsi", "xmm6", "xmm7", "xmm8", "xmm9", "xmm10", "xmm11", "xmm12", "xmm13", "xmm14", "xmm15"},
+}
+
+// CallingConvention returns the convention of the target's architecture
+func (t *TargetSpec) CallingConvention() *CallingConvention {
+	if t.Arch == "aarch64" {
+		return aapcs64Convention
+	}
+	return sysVConvention
+}
+
+// argRegisters are the integer registers ordinary arguments start from
+func (cc *CallingConvention) argRegisters(structReturn bool) []string {
+	if structReturn && cc.StructReturnIsArg {
+		return cc.IntArgs[1:]
+	}
+	return cc.IntArgs
+}
+
+// conventionOf is the convention the named function is called with: the
+// target's, or Windows x64 if it was declared ms_abi
+func (is *InstructionSelector) conventionOf(name string) (*CallingConvention, error) {
+	sig, ok := is.functions[name]
+	if !ok || !sig.MSABI {
+		return is.target.CallingConvention(), nil
+	}
+	if is.target.Arch != "x86_64" {
+		return nil, fmt.Errorf("'%s' is declared ms_abi, which is only supported on x86-64", name)
+	}
+	return msABIConvention, nil
+}
+
+// checkPassedByValue rejects a struct result or parameter of a function
+// called with a convention structs aren't passed in yet
+func (is *InstructionSelector) checkPassedByValue(cc *CallingConvention, name, returnType string, paramTypes []string) error {
+	if !cc.StackArgs {
+		// Structs over 16 bytes are passed in memory, on the stack
+		for _, typ := range paramTypes {
+			if _, small := is.structClasses(typ); is.isStructType(typ) && !small {
+				return fmt.Errorf("'%s' takes a struct of over 16 bytes by value, which isn't supported on %s", name, is.target.Arch)
+			}
+		}
+	}
+	if cc != msABIConvention {
+		return nil
+	}
+	if is.isStructType(returnType) {
+		return fmt.Errorf("'%s' is ms_abi and returns a struct, which isn't supported", name)
+	}
+	for _, typ := range paramTypes {
+		if is.isStructType(typ) {
+			return fmt.Errorf("'%s' is ms_abi and takes a struct, which isn't supported", name)
+		}
+	}
+	return nil
+}
+
+// preserveRegisters gives each register the function being selected must
+// keep for its callers a slot, which the emitter saves it to on entry and
+// restores it from on return
+func (is *InstructionSelector) preserveRegisters(cc *CallingConvention) {
+	for _, reg := range cc.Preserves {
+		size := 8
+		if strings.HasPrefix(reg, "xmm") {
+			size = 16
+		}
+		is.frame.Alloc(SlotSaved, reg, size, size)
+	}
+}
@@ -2,27 +2,54 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
 // Code emitter - generates x86-64 assembly from IR
 type CodeEmitter struct {
-	output       strings.Builder
-	dataSection  strings.Builder
-	bssSection   strings.Builder
-	rodataSection strings.Builder
+	output       machineBuffer
+	dataSection  machineBuffer
+	bssSection   machineBuffer
+	rodataSection machineBuffer
+	program      []*MachineInstr // Complete stream from the last Emit
 	
 	instructions []*IRInstruction
 	stringLits   map[string]string
 	globalVars   map[string]*Symbol
 	floatLits    map[string]string  // label -> float literal value
 	
+	// Emission order of the maps above (see orderedKeys)
+	stringOrder  []string
+	globalOrder  []string
+	floatOrder   []string
+	
 	currentFunc   string
 	stackSize     int
 	usedRegisters []int
+	frames        map[string]*FrameManager // each function's slots (see frame.go)
+	noRedZone     bool                     // -mno-red-zone
+	redZone       bool                     // the current function's frame is in the red zone
+	omitFrame     bool                     // -fomit-frame-pointer
+	noFrame       bool                     // the current function doesn't set up %rbp
+	cfa           int                      // how far the CFA is above %rsp (see unwind.go)
+	intelSyntax   bool                     // -masm=intel (see intel_syntax.go)
+	startStub     bool                     // -ffreestanding: the program brings its own _start (see freestanding.go)
+	inits         InitFunctions            // constructors and destructors (see constructors.go)
 	
 	labelCounter  int
 	floatCounter  int
+	
+	textRelocs    []Relocation // Relocations from the last EmitMachineCode
+	
+	// -emit-asm-annotated: the (preprocessed) source, whose lines are
+	// written as comments ahead of the code selected from them
+	sourceLines   []string
+	lastLine      int
+	
+	target        *TargetSpec  // Plain char signedness
+	
+	functions     *functionCache // functions emitted before (nil for none; see function_cache.go)
 }
 
 func NewCodeEmitter(instructions []*IRInstruction, stringLits map[string]string, globalVars map[string]*Symbol) *CodeEmitter {
@@ -31,11 +58,13 @@ func NewCodeEmitter(instructions []*IRInstruction, stringLits map[string]string,
 		stringLits:    stringLits,
 		globalVars:    globalVars,
 		floatLits:     make(map[string]string),
+		target:        defaultTarget,
 	}
 }
 
 func (ce *CodeEmitter) Emit() string {
 	ce.emitBssSection()
+	ce.emitInitArrays()
 	ce.emitTextSection()
 	// Emit data section last, after we've discovered all float literals
 	ce.emitDataSection()
@@ -48,19 +77,23 @@ func (ce *CodeEmitter) emitDataSection() {
 		return
 	}
 	
-	ce.rodataSection.WriteString("    .section .rodata\n")
+	ce.rodataSection.Add(NewDirective(".section", ".rodata"))
 	
 	// Emit string literals
-	for label, str := range ce.stringLits {
-		ce.rodataSection.WriteString(fmt.Sprintf("%s:\n", label))
-		ce.rodataSection.WriteString(fmt.Sprintf("    .string \"%s\"\n", escapeString(str)))
+	for _, label := range orderedKeys(ce.stringLits, ce.stringOrder) {
+		ce.rodataSection.Add(
+			NewLabel(label),
+			NewDirective(".string", "\""+escapeString(ce.stringLits[label])+"\""),
+		)
 	}
 	
 	// Emit float literals
-	for label, value := range ce.floatLits {
-		ce.rodataSection.WriteString(fmt.Sprintf("    .align 8\n"))
-		ce.rodataSection.WriteString(fmt.Sprintf("%s:\n", label))
-		ce.rodataSection.WriteString(fmt.Sprintf("    .double %s\n", value))
+	for _, label := range orderedKeys(ce.floatLits, ce.floatOrder) {
+		ce.rodataSection.Add(
+			NewDirective(".align", "8"),
+			NewLabel(label),
+			NewDirective(".double", ce.floatLits[label]),
+		)
 	}
 }
 
@@ -69,18 +102,57 @@ func (ce *CodeEmitter) emitBssSection() {
 		return
 	}
 	
-	ce.bssSection.WriteString("    .bss\n")
-	for name, sym := range ce.globalVars {
+	ce.bssSection.Add(NewDirective(".bss", ""))
+	var threadLocals []string
+	for _, name := range orderedKeys(ce.globalVars, ce.globalOrder) {
+		sym := ce.globalVars[name]
 		// Skip external symbols (libc provides these)
 		if sym.IsExternal {
 			continue
 		}
-		ce.bssSection.WriteString(fmt.Sprintf("    .comm %s,%d,%d\n", name, sym.Size, sym.Size))
+		
+		// Thread-local variables have sections of their own (see tls.go)
+		if sym.IsThreadLocal {
+			threadLocals = append(threadLocals, name)
+			continue
+		}
+		
+		// Constant-initialized variables live in .data
+		if sym.InitValue != "" || sym.InitData != nil {
+			ce.emitDataVar(name, sym)
+			continue
+		}
+		
+		// Statics stay file-local
+		if sym.IsStatic {
+			ce.bssSection.Add(NewDirective(".local", name))
+		}
+		ce.bssSection.Add(NewDirective(".comm", fmt.Sprintf("%s,%d,%d", name, sym.Size, sym.alignment())))
+	}
+	ce.emitThreadLocals(threadLocals)
+}
+
+// emitDataVar writes an initialized global into the .data section
+func (ce *CodeEmitter) emitDataVar(name string, sym *Symbol) {
+	if !sym.IsStatic {
+		ce.dataSection.Add(NewDirective(".globl", name))
+	}
+	if sym.InitData != nil {
+		ce.dataSection.Add(NewDirective(".align", fmt.Sprint(sym.alignment())), NewLabel(name))
+		for _, line := range dataDirectives(sym.InitData, sym.InitAddrs) {
+			ce.dataSection.Add(directiveLine(line))
+		}
+		return
 	}
+	ce.dataSection.Add(
+		NewDirective(".align", fmt.Sprint(max(sym.Size, sym.Align, 1))),
+		NewLabel(name),
+		NewDirective(sym.dataDirective(), sym.InitValue),
+	)
 }
 
 func (ce *CodeEmitter) emitTextSection() {
-	ce.output.WriteString("    .text\n")
+	ce.output.Add(NewDirective(".text", ""))
 	
 	debug := false  // Disable debug
 	i := 0
@@ -97,7 +169,12 @@ func (ce *CodeEmitter) emitTextSection() {
 				if debug {
 					fmt.Printf("  -> Emitting function %s, i before=%d\n", instr.Dst.Value, i)
 				}
+				if ce.functions.emitCached(ce, instr.Dst.Value, &i) {
+					continue
+				}
+				start := len(ce.output.Instrs())
 				ce.emitFunction(instr.Dst.Value, &i)
+				ce.functions.store(ce, instr.Dst.Value, ce.output.Instrs()[start:])
 				if debug {
 					fmt.Printf("  -> After emitFunction, i=%d\n", i)
 				}
@@ -121,24 +198,53 @@ func (ce *CodeEmitter) emitFunction(name string, startIdx *int) {
 	ce.currentFunc = name
 	
 	// Emit function header
-	ce.output.WriteString(fmt.Sprintf("\n    .globl %s\n", name))
-	ce.output.WriteString(fmt.Sprintf("    .type %s, @function\n", name))
-	ce.output.WriteString(fmt.Sprintf("%s:\n", name))
-	
-	// Prologue
-	ce.output.WriteString("    pushq %rbp\n")
-	ce.output.WriteString("    movq %rsp, %rbp\n")
-	
-	// Calculate stack size needed (skip the label instruction itself)
-	ce.stackSize = ce.calculateStackSize(*startIdx + 1)
-	if ce.stackSize > 0 {
-		// Align to 16 bytes
+	ce.output.Add(
+		&MachineInstr{Kind: MBlank},
+		NewDirective(".globl", name),
+		NewDirective(".type", name+", @function"),
+		NewLabel(name),
+	)
+	
+	// The frame holds the slots the selector laid out (skip the label
+	// instruction itself when looking at the body)
+	ce.stackSize = 0
+	if frame, ok := ce.frames[name]; ok {
+		ce.stackSize = frame.Size()
+	}
+	ce.usedRegisters = ce.collectCalleeSaved(*startIdx + 1)
+	ce.noFrame = ce.omitFrame && isLeaf(ce.functionBody(*startIdx + 1))
+	ce.redZone = ce.usesRedZone(*startIdx + 1)
+	
+	// Prologue, described for unwinders as it goes (see unwind.go)
+	start := len(ce.output.Instrs())
+	ce.cfi(".cfi_startproc", "")
+	ce.cfa = 8
+	if !ce.noFrame {
+		ce.output.Add(NewInstr("pushq", RegOp("rbp")))
+		ce.cfa = 16
+		ce.cfi(".cfi_def_cfa_offset", "16")
+		ce.savedAt("rbp", -16)
+		ce.output.Add(NewInstr("movq", RegOp("rsp"), RegOp("rbp")))
+		ce.cfi(".cfi_def_cfa_register", "%d", dwarfRegs["rbp"])
+	}
+	if !ce.redZone && (ce.stackSize > 0 || len(ce.usedRegisters)%2 == 1) {
+		// Align to 16 bytes, counting the callee-saved pushes below
 		ce.stackSize = (ce.stackSize + 15) & ^15
-		ce.output.WriteString(fmt.Sprintf("    subq $%d, %%rsp\n", ce.stackSize))
+		if len(ce.usedRegisters)%2 == 1 {
+			ce.stackSize += 8
+		}
+		if ce.noFrame {
+			// And the eightbyte %rbp would have been pushed to, which
+			// keeps the registers pushed below clear of the slots
+			ce.stackSize += 8
+		}
+		ce.output.Add(NewInstr("subq", ImmOp(int64(ce.stackSize)), RegOp("rsp")))
+		ce.moveRSP(ce.stackSize)
 	}
 	
 	// Save callee-saved registers
 	ce.emitRegisterSaves()
+	ce.emitPreservedSaves()
 	
 	// Process function body
 	*startIdx++
@@ -151,82 +257,253 @@ func (ce *CodeEmitter) emitFunction(name string, startIdx *int) {
 			break
 		}
 		
-		if instr.Op == OpRet {
-			ce.emitReturn()
+		ce.annotateLine(instr)
+		if instr.Op == OpRet || instr.Op == OpTailCall {
+			// Not necessarily the end: early returns are followed by
+			// the rest of the body, which still has the frame
+			more := continuesAfter(ce.instructions[*startIdx+1:])
+			cfa := ce.cfa
+			if more {
+				ce.cfi(".cfi_remember_state", "")
+			}
+			if instr.Op == OpRet {
+				ce.emitReturn()
+			} else {
+				ce.emitInstruction(instr)
+			}
+			if more {
+				ce.cfi(".cfi_restore_state", "")
+				ce.cfa = cfa
+			}
 			*startIdx++
-			break
+			continue
 		}
 		
 		ce.emitInstruction(instr)
 		*startIdx++
 	}
+	if ce.noFrame {
+		ce.addressFromRSP(ce.output.Instrs()[start:])
+	}
 	
-	ce.output.WriteString(fmt.Sprintf("    .size %s, .-%s\n", name, name))
+	ce.cfi(".cfi_endproc", "")
+	ce.output.Add(NewDirective(".size", name+", .-"+name))
 }
 
-func (ce *CodeEmitter) calculateStackSize(startIdx int) int {
-	maxOffset := 0
+
+// annotateLine writes where instr came from and the source line there as a
+// comment, when annotating and it differs from the previous instruction's
+func (ce *CodeEmitter) annotateLine(instr *IRInstruction) {
+	if ce.sourceLines == nil || instr.Op == OpLabel || instr.Line <= 0 || instr.Line > len(ce.sourceLines) || instr.Line == ce.lastLine {
+		return
+	}
+	ce.lastLine = instr.Line
+	ce.output.Add(&MachineInstr{Kind: MComment, Op: fmt.Sprintf("    # %s: %s", instr.Pos, strings.TrimSpace(ce.sourceLines[instr.Line-1]))})
+}
+
+// usesRedZone reports whether the function starting at startIdx can keep
+// its slots in the red zone instead of reserving them (see frame.go)
+func (ce *CodeEmitter) usesRedZone(startIdx int) bool {
+	size := ce.stackSize + 8*len(ce.usedRegisters)
+	if ce.noFrame {
+		// Below the return address rather than the saved %rbp
+		size += 8
+	}
+	if ce.noRedZone || size > redZoneSize {
+		return false
+	}
+	return isLeaf(ce.functionBody(startIdx))
+}
+
+// functionBody is the code of the function whose body starts at startIdx
+func (ce *CodeEmitter) functionBody(startIdx int) []*IRInstruction {
+	end := startIdx
+	for end < len(ce.instructions) {
+		instr := ce.instructions[end]
+		if instr.Op == OpLabel && ce.isFunctionLabel(instr.Dst.Value) {
+			break
+		}
+		end++
+	}
+	return ce.instructions[startIdx:end]
+}
+
+// collectCalleeSaved finds the callee-saved registers the allocator assigned
+// in this function; they must be preserved for C callers (qsort, pthreads ...)
+func (ce *CodeEmitter) collectCalleeSaved(startIdx int) []int {
+	used := make(map[string]bool)
+	var visit func(op *Operand)
+	visit = func(op *Operand) {
+		if op == nil {
+			return
+		}
+		if op.Type == "reg" {
+			used[op.Value] = true
+		}
+		visit(op.IndexTemp)
+		visit(op.SourcePtr)
+	}
 	
 	for i := startIdx; i < len(ce.instructions); i++ {
 		instr := ce.instructions[i]
-		
 		if instr.Op == OpLabel && ce.isFunctionLabel(instr.Dst.Value) {
 			break
 		}
-		
-		operands := []*Operand{instr.Dst, instr.Src1, instr.Src2}
-		for _, op := range operands {
-			if op != nil && (op.Type == "mem" || op.Type == "var") && op.Offset < 0 {
-				offset := -op.Offset
-				if offset > maxOffset {
-					maxOffset = offset
-				}
-			}
-		}
+		visit(instr.Dst)
+		visit(instr.Src1)
+		visit(instr.Src2)
 	}
 	
-	return maxOffset
+	var regs []int
+	for _, reg := range []int{RBX, R12, R13, R14, R15} {
+		if used[regNames[reg]] {
+			regs = append(regs, reg)
+		}
+	}
+	return regs
+}
+
+// redZoneSaveSlot is where the i'th callee-saved register is kept in a
+// red-zone frame, below the function's slots
+func (ce *CodeEmitter) redZoneSaveSlot(i int) MachineOperand {
+	return MemOp("rbp", int64(-(ce.stackSize + 8*(i+1))))
 }
 
 func (ce *CodeEmitter) emitRegisterSaves() {
+	if ce.redZone {
+		for i, reg := range ce.usedRegisters {
+			slot := ce.redZoneSaveSlot(i)
+			ce.output.Add(NewInstr("movq", RegOp(regNames[reg]), slot))
+			// The slot is below %rbp, which is 16 below the CFA
+			ce.savedAt(regNames[reg], int(slot.Disp)-16)
+		}
+		return
+	}
 	calleeSaved := []int{RBX, R12, R13, R14, R15}
 	
 	for _, reg := range calleeSaved {
 		for _, usedReg := range ce.usedRegisters {
 			if reg == usedReg {
-				ce.output.WriteString(fmt.Sprintf("    pushq %%%s\n", regNames[reg]))
+				ce.output.Add(NewInstr("pushq", RegOp(regNames[reg])))
+				ce.moveRSP(8)
+				ce.savedAt(regNames[reg], -ce.cfa)
 			}
 		}
 	}
 }
 
 func (ce *CodeEmitter) emitRegisterRestores() {
+	if ce.redZone {
+		for i, reg := range ce.usedRegisters {
+			ce.output.Add(NewInstr("movq", ce.redZoneSaveSlot(i), RegOp(regNames[reg])))
+		}
+		return
+	}
 	calleeSaved := []int{R15, R14, R13, R12, RBX}
 	
 	for _, reg := range calleeSaved {
 		for _, usedReg := range ce.usedRegisters {
 			if reg == usedReg {
-				ce.output.WriteString(fmt.Sprintf("    popq %%%s\n", regNames[reg]))
+				ce.output.Add(NewInstr("popq", RegOp(regNames[reg])))
+				ce.moveRSP(-8)
+			}
+		}
+	}
+}
+
+// preservedSlots are where the function saves the registers its
+// convention has it keep (see calling_convention.go)
+func (ce *CodeEmitter) preservedSlots() []FrameSlot {
+	var slots []FrameSlot
+	if frame, ok := ce.frames[ce.currentFunc]; ok {
+		for _, slot := range frame.Slots {
+			if slot.Kind == SlotSaved {
+				slots = append(slots, slot)
 			}
 		}
 	}
+	return slots
+}
+
+// preservedMove is the move that saves or restores reg whole
+func preservedMove(reg string) string {
+	if strings.HasPrefix(reg, "xmm") {
+		return "movups"
+	}
+	return "movq"
+}
+
+func (ce *CodeEmitter) emitPreservedSaves() {
+	for _, slot := range ce.preservedSlots() {
+		ce.output.Add(NewInstr(preservedMove(slot.Name), RegOp(slot.Name), MemOp("rbp", int64(slot.Offset))))
+	}
+}
+
+func (ce *CodeEmitter) emitPreservedRestores() {
+	for _, slot := range ce.preservedSlots() {
+		ce.output.Add(NewInstr(preservedMove(slot.Name), MemOp("rbp", int64(slot.Offset)), RegOp(slot.Name)))
+	}
 }
 
 func (ce *CodeEmitter) emitReturn() {
+	ce.emitEpilogue()
+	ce.output.Add(NewInstr("ret"))
+}
+
+// emitEpilogue tears the frame down, leaving %rsp at the return address
+func (ce *CodeEmitter) emitEpilogue() {
+	ce.emitPreservedRestores()
+	if ce.redZone {
+		// %rsp never moved
+		ce.emitRegisterRestores()
+		if !ce.noFrame {
+			ce.output.Add(NewInstr("popq", RegOp("rbp")))
+			ce.cfi(".cfi_def_cfa", "%d, 8", dwarfRegs["rsp"])
+		}
+		return
+	}
+	if ce.noFrame {
+		// A leaf: %rsp is still at the save area
+		ce.emitRegisterRestores()
+		if ce.stackSize > 0 {
+			ce.output.Add(NewInstr("addq", ImmOp(int64(ce.stackSize)), RegOp("rsp")))
+			ce.moveRSP(-ce.stackSize)
+		}
+		return
+	}
+	if len(ce.usedRegisters) > 0 {
+		// Point rsp back at the save area before popping
+		saveArea := ce.stackSize + 8*len(ce.usedRegisters)
+		ce.output.Add(NewInstr("leaq", MemOp("rbp", int64(-saveArea)), RegOp("rsp")))
+	}
 	ce.emitRegisterRestores()
-	ce.output.WriteString("    movq %rbp, %rsp\n")
-	ce.output.WriteString("    popq %rbp\n")
-	ce.output.WriteString("    ret\n")
+	ce.output.Add(
+		NewInstr("movq", RegOp("rbp"), RegOp("rsp")),
+		NewInstr("popq", RegOp("rbp")),
+	)
+	ce.cfi(".cfi_def_cfa", "%d, 8", dwarfRegs["rsp"])
 }
 
 func (ce *CodeEmitter) emitLabel(label string) {
-	ce.output.WriteString(fmt.Sprintf("%s:\n", label))
+	ce.output.Add(NewLabel(label))
+}
+
+// emit appends an instruction to the text section
+func (ce *CodeEmitter) emit(op string, operands ...MachineOperand) {
+	ce.output.Add(NewInstr(op, operands...))
+}
+
+// emitPrefixed appends an instruction with a lock or rep prefix
+func (ce *CodeEmitter) emitPrefixed(prefix, op string, operands ...MachineOperand) {
+	mi := NewInstr(op, operands...)
+	mi.Prefix = prefix
+	ce.output.Add(mi)
 }
 
 func (ce *CodeEmitter) emitInstruction(instr *IRInstruction) {
 	switch instr.Op {
 	case OpNop:
-		ce.output.WriteString("    nop\n")
+		ce.emit("nop")
 		
 	case OpMov:
 		ce.emitMov(instr.Dst, instr.Src1)
@@ -251,7 +528,7 @@ func (ce *CodeEmitter) emitInstruction(instr *IRInstruction) {
 		
 	case OpNeg:
 		ce.emitMov(instr.Dst, instr.Src1)
-		ce.output.WriteString(fmt.Sprintf("    negq %s\n", ce.formatOperand(instr.Dst)))
+		ce.emit("negq", ce.operand(instr.Dst))
 		
 	case OpAnd:
 		ce.emitBinaryOp("andq", instr.Dst, instr.Src1, instr.Src2)
@@ -264,24 +541,28 @@ func (ce *CodeEmitter) emitInstruction(instr *IRInstruction) {
 		
 	case OpNot:
 		ce.emitMov(instr.Dst, instr.Src1)
-		dstStr := ce.formatOperand(instr.Dst)
-		if strings.Contains(dstStr, "(") && strings.Contains(dstStr, ")") {
-			ce.output.WriteString(fmt.Sprintf("    movq %s, %%rax\n", dstStr))
-			ce.output.WriteString("    testq %rax, %rax\n")
-			ce.output.WriteString("    sete %al\n")
-			ce.output.WriteString("    movzbq %al, %rax\n")
-			ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", dstStr))
+		dst := ce.operand(instr.Dst)
+		if dst.Kind == MOpMem {
+			ce.emit("movq", dst, RegOp("rax"))
+			ce.emit("testq", RegOp("rax"), RegOp("rax"))
+			ce.emit("sete", RegOp("al"))
+			ce.emit("movzbq", RegOp("al"), RegOp("rax"))
+			ce.emit("movq", RegOp("rax"), dst)
 		} else {
-			ce.output.WriteString(fmt.Sprintf("    testq %s, %s\n", dstStr, dstStr))
-			ce.output.WriteString("    sete %al\n")
-			ce.output.WriteString(fmt.Sprintf("    movzbq %%al, %s\n", dstStr))
+			ce.emit("testq", dst, dst)
+			ce.emit("sete", RegOp("al"))
+			ce.emit("movzbq", RegOp("al"), dst)
 		}
 		
 	case OpShl:
 		ce.emitShift("salq", instr.Dst, instr.Src1, instr.Src2)
 		
 	case OpShr:
-		ce.emitShift("sarq", instr.Dst, instr.Src1, instr.Src2)
+		if ce.target.IsUnsigned(instr.Src1.DataType) {
+			ce.emitShift("shrq", instr.Dst, instr.Src1, instr.Src2)
+		} else {
+			ce.emitShift("sarq", instr.Dst, instr.Src1, instr.Src2)
+		}
 		
 	case OpEq:
 		ce.emitComparison("sete", instr.Dst, instr.Src1, instr.Src2)
@@ -306,31 +587,31 @@ func (ce *CodeEmitter) emitInstruction(instr *IRInstruction) {
 		
 	case OpLoadAddr:
 		// Load address of variable/memory location
-		dstStr := ce.formatOperand(instr.Dst)
+		dst := ce.operand(instr.Dst)
 		src1 := instr.Src1
 		
 		if src1.Type == "var" {
 			if src1.IsGlobal {
-				ce.output.WriteString(fmt.Sprintf("    leaq %s(%%rip), %s\n", src1.Value, dstStr))
+				ce.emit("leaq", globalAddr(src1), dst)
 			} else {
-				ce.output.WriteString(fmt.Sprintf("    leaq %d(%%rbp), %s\n", src1.Offset, dstStr))
+				ce.emit("leaq", MemOp("rbp", int64(src1.Offset)), dst)
 			}
 		} else if src1.Type == "mem" {
-			ce.output.WriteString(fmt.Sprintf("    leaq %d(%%rbp), %s\n", src1.Offset, dstStr))
+			ce.emit("leaq", MemOp("rbp", int64(src1.Offset)), dst)
 		} else if src1.Type == "temp" {
 			// Temp might have been allocated on stack - check allocator mapping
-			// For now, try to use formatOperand but strip the dereference
-			srcStr := ce.formatOperand(src1)
-			// If srcStr is like offset(%rbp), use leaq with it
-			if strings.Contains(srcStr, "(%rbp)") {
-				ce.output.WriteString(fmt.Sprintf("    leaq %s, %s\n", srcStr, dstStr))
+			// For now, try to use its operand but strip the dereference
+			src := ce.operand(src1)
+			// If src is like offset(%rbp), use leaq with it
+			if src.Kind == MOpMem && src.Reg == "rbp" && src.Index == "" {
+				ce.emit("leaq", src, dst)
 			} else {
 				// Shouldn't happen - fallback to moving the value
-				ce.output.WriteString(fmt.Sprintf("    movq %s, %s\n", srcStr, dstStr))
+				ce.emit("movq", src, dst)
 			}
 		} else {
 			// Fallback
-			ce.output.WriteString(fmt.Sprintf("    leaq %s, %s\n", ce.formatOperand(src1), dstStr))
+			ce.emit("leaq", ce.operand(src1), dst)
 		}
 		
 	case OpStore:
@@ -340,27 +621,27 @@ func (ce *CodeEmitter) emitInstruction(instr *IRInstruction) {
 		ce.emitCall(instr)
 		
 	case OpJmp:
-		ce.output.WriteString(fmt.Sprintf("    jmp %s\n", instr.Dst.Value))
+		ce.emit("jmp", SymOp(instr.Dst.Value))
 		
 	case OpJz:
-		src1Str := ce.formatOperand(instr.Src1)
-		if strings.Contains(src1Str, "(") && strings.Contains(src1Str, ")") {
-			ce.output.WriteString(fmt.Sprintf("    movq %s, %%rax\n", src1Str))
-			ce.output.WriteString("    testq %rax, %rax\n")
+		src1 := ce.operand(instr.Src1)
+		if src1.Kind == MOpMem {
+			ce.emit("movq", src1, RegOp("rax"))
+			ce.emit("testq", RegOp("rax"), RegOp("rax"))
 		} else {
-			ce.output.WriteString(fmt.Sprintf("    testq %s, %s\n", src1Str, src1Str))
+			ce.emit("testq", src1, src1)
 		}
-		ce.output.WriteString(fmt.Sprintf("    jz %s\n", instr.Dst.Value))
+		ce.emit("jz", SymOp(instr.Dst.Value))
 		
 	case OpJnz:
-		src1Str := ce.formatOperand(instr.Src1)
-		if strings.Contains(src1Str, "(") && strings.Contains(src1Str, ")") {
-			ce.output.WriteString(fmt.Sprintf("    movq %s, %%rax\n", src1Str))
-			ce.output.WriteString("    testq %rax, %rax\n")
+		src1 := ce.operand(instr.Src1)
+		if src1.Kind == MOpMem {
+			ce.emit("movq", src1, RegOp("rax"))
+			ce.emit("testq", RegOp("rax"), RegOp("rax"))
 		} else {
-			ce.output.WriteString(fmt.Sprintf("    testq %s, %s\n", src1Str, src1Str))
+			ce.emit("testq", src1, src1)
 		}
-		ce.output.WriteString(fmt.Sprintf("    jnz %s\n", instr.Dst.Value))
+		ce.emit("jnz", SymOp(instr.Dst.Value))
 		
 	case OpLabel:
 		ce.emitLabel(instr.Dst.Value)
@@ -369,15 +650,57 @@ func (ce *CodeEmitter) emitInstruction(instr *IRInstruction) {
 		// Parameters handled in OpCall
 		
 	case OpPush:
-		ce.output.WriteString(fmt.Sprintf("    pushq %s\n", ce.formatOperand(instr.Src1)))
+		// Through %rax, like an argument register: the value may be an
+		// address to take or a floating constant
+		if src := instr.Src1; src.Type == "imm" && strings.Contains(src.Value, ".") {
+			ce.emit("movq", RIPOp(ce.getFloatLabel(src.Value)), RegOp("rax"))
+		} else {
+			ce.emitSetArg(&IRInstruction{Op: OpSetArg, Dst: &Operand{Type: "reg", Value: "rax"}, Src1: src})
+		}
+		ce.emit("pushq", RegOp("rax"))
+		
+	case OpPopArgs:
+		ce.emit("addq", ImmTextOp(instr.Src1.Value), RegOp("rsp"))
 		
 	case OpPop:
-		ce.output.WriteString(fmt.Sprintf("    popq %s\n", ce.formatOperand(instr.Dst)))
+		ce.emit("popq", ce.operand(instr.Dst))
 		
 	case OpSetArg:
 		// Special handling for setting up function arguments
 		// This bypasses the register allocator to avoid conflicts
 		ce.emitSetArg(instr)
+		
+	case OpMemcpy:
+		ce.emitMemcpy(instr)
+		
+	case OpMemset:
+		ce.emitMemset(instr)
+		
+	case OpConvert:
+		ce.emitConvert(instr.Dst, instr.Src1)
+		
+	case OpAtomicAdd, OpAtomicXchg:
+		ce.emitAtomic(instr)
+		
+	case OpFence:
+		ce.emit("mfence")
+		
+	case OpTLSAddr:
+		ce.emitTLSAddr(instr)
+		
+	case OpPopcnt, OpClz, OpCtz, OpBswap:
+		ce.emitBitOp(instr)
+		
+	case OpTailCall:
+		ce.emitEpilogue()
+		ce.emit("jmp", SymOp(instr.Src1.Value))
+		
+	case OpSyscall:
+		ce.emit("movq", ImmTextOp(instr.Src1.Value), RegOp("rax"))
+		ce.emit("syscall")
+		if instr.Dst != nil && instr.Dst.Value != "rax" {
+			ce.emitMov(instr.Dst, &Operand{Type: "reg", Value: "rax"})
+		}
 	}
 }
 
@@ -386,37 +709,36 @@ func (ce *CodeEmitter) emitMov(dst, src *Operand) {
 		return // No-op
 	}
 	
-	dstStr := ce.formatOperand(dst)
-	srcStr := ce.formatOperand(src)
+	dstOp := ce.operand(dst)
+	srcOp := ce.operand(src)
 	
 	// Handle floating point immediate values
 	if src.Type == "imm" && strings.Contains(src.Value, ".") {
 		// It's a float literal - store in .rodata and load address
-		label, exists := ce.floatLits[src.Value]
-		if !exists {
-			ce.floatCounter++
-			label = fmt.Sprintf(".FC%d", ce.floatCounter)
-			ce.floatLits[label] = src.Value
-		}
+		label := ce.getFloatLabel(src.Value)
 		// Load the float constant as a 64-bit integer from .rodata
-		dstIsMem := strings.Contains(dstStr, "(") && strings.Contains(dstStr, ")")
-		if dstIsMem {
-			ce.output.WriteString(fmt.Sprintf("    movq %s(%%rip), %%rax\n", label))
-			ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", dstStr))
+		if dstOp.Kind == MOpMem {
+			ce.emit("movq", RIPOp(label), RegOp("rax"))
+			ce.emit("movq", RegOp("rax"), dstOp)
 		} else {
-			ce.output.WriteString(fmt.Sprintf("    movq %s(%%rip), %s\n", label, dstStr))
+			ce.emit("movq", RIPOp(label), dstOp)
 		}
 		return
 	}
 	
+	// Address-of (&var) - emitLoad computes it with leaq
+	if src.Type == "addr" {
+		ce.emitLoad(dst, src)
+		return
+	}
+	
 	// Handle label (string literals, addresses) - use leaq
 	if src.Type == "label" {
-		dstIsMem := strings.Contains(dstStr, "(") && strings.Contains(dstStr, ")")
-		if dstIsMem {
-			ce.output.WriteString(fmt.Sprintf("    leaq %s(%%rip), %%rax\n", src.Value))
-			ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", dstStr))
+		if dstOp.Kind == MOpMem {
+			ce.emit("leaq", RIPOp(src.Value), RegOp("rax"))
+			ce.emit("movq", RegOp("rax"), dstOp)
 		} else {
-			ce.output.WriteString(fmt.Sprintf("    leaq %s(%%rip), %s\n", src.Value, dstStr))
+			ce.emit("leaq", RIPOp(src.Value), dstOp)
 		}
 		return
 	}
@@ -436,22 +758,22 @@ func (ce *CodeEmitter) emitMov(dst, src *Operand) {
 	
 	if use32Bit {
 		// Use 32-bit load with sign extension
-		dstStr32 := ce.formatOperand32(dst)
-		srcStr32 := ce.formatOperand32(src)
+		dstOp32 := ce.operand32(dst)
+		srcOp32 := ce.operand32(src)
 		
 		// Check for memory-to-memory
-		srcIsMem := strings.Contains(srcStr, "(") && strings.Contains(srcStr, ")")
-		dstIsMem := strings.Contains(dstStr, "(") && strings.Contains(dstStr, ")")
+		srcIsMem := srcOp.Kind == MOpMem
+		dstIsMem := dstOp.Kind == MOpMem
 		
 		if srcIsMem && dstIsMem {
-			ce.output.WriteString(fmt.Sprintf("    movl %s, %%eax\n", srcStr32))
-			ce.output.WriteString(fmt.Sprintf("    movl %%eax, %s\n", dstStr32))
+			ce.emit("movl", srcOp32, RegOp("eax"))
+			ce.emit("movl", RegOp("eax"), dstOp32)
 		} else {
 			// Use movslq for sign-extending 32-bit to 64-bit when loading to register
-			if !dstIsMem && srcIsMem {
-				ce.output.WriteString(fmt.Sprintf("    movslq %s, %s\n", srcStr32, dstStr))
+			if !dstIsMem && srcIsMem && !ce.target.IsUnsigned(src.DataType) && !ce.target.IsUnsigned(dst.DataType) {
+				ce.emit("movslq", srcOp32, dstOp)
 			} else {
-				ce.output.WriteString(fmt.Sprintf("    movl %s, %s\n", srcStr32, dstStr32))
+				ce.emit("movl", srcOp32, dstOp32)
 			}
 		}
 		return
@@ -459,29 +781,25 @@ func (ce *CodeEmitter) emitMov(dst, src *Operand) {
 	
 	// Handle immediate to memory
 	if dst.Type == "mem" && src.Type == "imm" {
-		ce.output.WriteString(fmt.Sprintf("    movq %s, %%rax\n", srcStr))
-		ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", dstStr))
+		ce.emit("movq", srcOp, RegOp("rax"))
+		ce.emit("movq", RegOp("rax"), dstOp)
 		return
 	}
 	
-	// Check for memory-to-memory by pattern (both have (%reg) syntax)
-	srcIsMem := strings.Contains(srcStr, "(") && strings.Contains(srcStr, ")")
-	dstIsMem := strings.Contains(dstStr, "(") && strings.Contains(dstStr, ")")
-	
-	if srcIsMem && dstIsMem {
+	if srcOp.Kind == MOpMem && dstOp.Kind == MOpMem {
 		// Memory to memory through register
-		ce.output.WriteString(fmt.Sprintf("    movq %s, %%rax\n", srcStr))
-		ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", dstStr))
+		ce.emit("movq", srcOp, RegOp("rax"))
+		ce.emit("movq", RegOp("rax"), dstOp)
 		return
 	}
 	
-	ce.output.WriteString(fmt.Sprintf("    movq %s, %s\n", srcStr, dstStr))
+	ce.emit("movq", srcOp, dstOp)
 }
 
 func (ce *CodeEmitter) emitMovFloat(dst, src *Operand) {
 	// Move floating point values using XMM registers and movsd
-	dstStr := ce.formatOperand(dst)
-	srcStr := ce.formatOperand(src)
+	dstOp := ce.operand(dst)
+	srcOp := ce.operand(src)
 	
 	// Handle floating point immediate values
 	if src.Type == "imm" {
@@ -489,11 +807,11 @@ func (ce *CodeEmitter) emitMovFloat(dst, src *Operand) {
 		
 		// Load the float constant using movsd
 		if dst.Type == "freg" {
-			ce.output.WriteString(fmt.Sprintf("    movsd %s(%%rip), %%%s\n", label, dst.Value))
+			ce.emit("movsd", RIPOp(label), RegOp(dst.Value))
 		} else {
 			// Load to temp XMM register first, then move to destination
-			ce.output.WriteString(fmt.Sprintf("    movsd %s(%%rip), %%xmm0\n", label))
-			ce.output.WriteString(fmt.Sprintf("    movsd %%xmm0, %s\n", dstStr))
+			ce.emit("movsd", RIPOp(label), RegOp("xmm0"))
+			ce.emit("movsd", RegOp("xmm0"), dstOp)
 		}
 		return
 	}
@@ -502,10 +820,10 @@ func (ce *CodeEmitter) emitMovFloat(dst, src *Operand) {
 	if dst.Type == "freg" {
 		if src.Type == "temp" || src.Type == "reg" {
 			// Move from GPR to XMM (use movq for bit pattern transfer)
-			ce.output.WriteString(fmt.Sprintf("    movq %s, %%%s\n", srcStr, dst.Value))
+			ce.emit("movq", srcOp, RegOp(dst.Value))
 		} else {
 			// Load from memory to XMM
-			ce.output.WriteString(fmt.Sprintf("    movsd %s, %%%s\n", srcStr, dst.Value))
+			ce.emit("movsd", srcOp, RegOp(dst.Value))
 		}
 		return
 	}
@@ -536,31 +854,31 @@ func (ce *CodeEmitter) emitBinaryOp(op string, dst, src1, src2 *Operand) {
 			// Move src1 to xmm0
 			if src1.Type == "imm" {
 				label := ce.getFloatLabel(src1.Value)
-				ce.output.WriteString(fmt.Sprintf("    movsd %s(%%rip), %%xmm0\n", label))
+				ce.emit("movsd", RIPOp(label), RegOp("xmm0"))
 			} else if src1.Type == "temp" || src1.Type == "reg" {
 				// For GPRs, move as bit pattern first
-				ce.output.WriteString(fmt.Sprintf("    movq %s, %%xmm0\n", ce.formatOperand(src1)))
+				ce.emit("movq", ce.operand(src1), RegOp("xmm0"))
 			} else {
-				ce.output.WriteString(fmt.Sprintf("    movsd %s, %%xmm0\n", ce.formatOperand(src1)))
+				ce.emit("movsd", ce.operand(src1), RegOp("xmm0"))
 			}
 			
 			// Apply operation with src2
 			if src2.Type == "imm" {
 				label := ce.getFloatLabel(src2.Value)
-				ce.output.WriteString(fmt.Sprintf("    %s %s(%%rip), %%xmm0\n", floatOp, label))
+				ce.emit(floatOp, RIPOp(label), RegOp("xmm0"))
 			} else if src2.Type == "temp" || src2.Type == "reg" {
 				// For GPRs, move to xmm1 first
-				ce.output.WriteString(fmt.Sprintf("    movq %s, %%xmm1\n", ce.formatOperand(src2)))
-				ce.output.WriteString(fmt.Sprintf("    %s %%xmm1, %%xmm0\n", floatOp))
+				ce.emit("movq", ce.operand(src2), RegOp("xmm1"))
+				ce.emit(floatOp, RegOp("xmm1"), RegOp("xmm0"))
 			} else {
-				ce.output.WriteString(fmt.Sprintf("    %s %s, %%xmm0\n", floatOp, ce.formatOperand(src2)))
+				ce.emit(floatOp, ce.operand(src2), RegOp("xmm0"))
 			}
 			
 			// Store result
 			if dst.Type == "temp" || dst.Type == "reg" {
-				ce.output.WriteString(fmt.Sprintf("    movq %%xmm0, %s\n", ce.formatOperand(dst)))
+				ce.emit("movq", RegOp("xmm0"), ce.operand(dst))
 			} else {
-				ce.output.WriteString(fmt.Sprintf("    movsd %%xmm0, %s\n", ce.formatOperand(dst)))
+				ce.emit("movsd", RegOp("xmm0"), ce.operand(dst))
 			}
 			return
 		}
@@ -571,14 +889,14 @@ func (ce *CodeEmitter) emitBinaryOp(op string, dst, src1, src2 *Operand) {
 	ce.emitMov(dst, src1)
 	
 	// Apply operation - handle float immediates
-	src2Str := ce.loadFloatIfNeeded(src2, "%r10")
-	dstStr := ce.formatOperand(dst)
+	src2Op := ce.loadFloatIfNeeded(src2, RegOp("r10"))
+	dstOp := ce.operand(dst)
 	
 	if dst.Type == "mem" && src2.Type == "mem" {
-		ce.output.WriteString(fmt.Sprintf("    movq %s, %%rax\n", src2Str))
-		ce.output.WriteString(fmt.Sprintf("    %s %%rax, %s\n", op, dstStr))
+		ce.emit("movq", src2Op, RegOp("rax"))
+		ce.emit(op, RegOp("rax"), dstOp)
 	} else {
-		ce.output.WriteString(fmt.Sprintf("    %s %s, %s\n", op, src2Str, dstStr))
+		ce.emit(op, src2Op, dstOp)
 	}
 }
 
@@ -593,31 +911,31 @@ func (ce *CodeEmitter) emitMul(dst, src1, src2 *Operand) {
 		// Move src1 to xmm0
 		if src1.Type == "imm" {
 			label := ce.getFloatLabel(src1.Value)
-			ce.output.WriteString(fmt.Sprintf("    movsd %s(%%rip), %%xmm0\n", label))
+			ce.emit("movsd", RIPOp(label), RegOp("xmm0"))
 		} else if src1.Type == "temp" || src1.Type == "reg" {
 			// For GPRs, move as bit pattern first
-			ce.output.WriteString(fmt.Sprintf("    movq %s, %%xmm0\n", ce.formatOperand(src1)))
+			ce.emit("movq", ce.operand(src1), RegOp("xmm0"))
 		} else {
-			ce.output.WriteString(fmt.Sprintf("    movsd %s, %%xmm0\n", ce.formatOperand(src1)))
+			ce.emit("movsd", ce.operand(src1), RegOp("xmm0"))
 		}
 		
 		// Multiply by src2
 		if src2.Type == "imm" {
 			label := ce.getFloatLabel(src2.Value)
-			ce.output.WriteString(fmt.Sprintf("    mulsd %s(%%rip), %%xmm0\n", label))
+			ce.emit("mulsd", RIPOp(label), RegOp("xmm0"))
 		} else if src2.Type == "temp" || src2.Type == "reg" {
 			// For GPRs, move to xmm1 first
-			ce.output.WriteString(fmt.Sprintf("    movq %s, %%xmm1\n", ce.formatOperand(src2)))
-			ce.output.WriteString(fmt.Sprintf("    mulsd %%xmm1, %%xmm0\n"))
+			ce.emit("movq", ce.operand(src2), RegOp("xmm1"))
+			ce.emit("mulsd", RegOp("xmm1"), RegOp("xmm0"))
 		} else {
-			ce.output.WriteString(fmt.Sprintf("    mulsd %s, %%xmm0\n", ce.formatOperand(src2)))
+			ce.emit("mulsd", ce.operand(src2), RegOp("xmm0"))
 		}
 		
 		// Store result
 		if dst.Type == "temp" || dst.Type == "reg" {
-			ce.output.WriteString(fmt.Sprintf("    movq %%xmm0, %s\n", ce.formatOperand(dst)))
+			ce.emit("movq", RegOp("xmm0"), ce.operand(dst))
 		} else {
-			ce.output.WriteString(fmt.Sprintf("    movsd %%xmm0, %s\n", ce.formatOperand(dst)))
+			ce.emit("movsd", RegOp("xmm0"), ce.operand(dst))
 		}
 		return
 	}
@@ -625,17 +943,16 @@ func (ce *CodeEmitter) emitMul(dst, src1, src2 *Operand) {
 	// Integer multiplication
 	ce.emitMov(dst, src1)
 	
-	src2Str := ce.loadFloatIfNeeded(src2, "%r10")
-	dstStr := ce.formatOperand(dst)
-	dstIsMem := strings.Contains(dstStr, "(") && strings.Contains(dstStr, ")")
+	src2Op := ce.loadFloatIfNeeded(src2, RegOp("r10"))
+	dstOp := ce.operand(dst)
 	
-	if dstIsMem {
+	if dstOp.Kind == MOpMem {
 		// imul doesn't support memory destination - use rax
-		ce.output.WriteString(fmt.Sprintf("    movq %s, %%rax\n", dstStr))
-		ce.output.WriteString(fmt.Sprintf("    imulq %s, %%rax\n", src2Str))
-		ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", dstStr))
+		ce.emit("movq", dstOp, RegOp("rax"))
+		ce.emit("imulq", src2Op, RegOp("rax"))
+		ce.emit("movq", RegOp("rax"), dstOp)
 	} else {
-		ce.output.WriteString(fmt.Sprintf("    imulq %s, %s\n", src2Str, dstStr))
+		ce.emit("imulq", src2Op, dstOp)
 	}
 }
 
@@ -650,363 +967,375 @@ func (ce *CodeEmitter) emitDiv(dst, src1, src2 *Operand) {
 		// Move src1 to xmm0
 		if src1.Type == "imm" {
 			label := ce.getFloatLabel(src1.Value)
-			ce.output.WriteString(fmt.Sprintf("    movsd %s(%%rip), %%xmm0\n", label))
+			ce.emit("movsd", RIPOp(label), RegOp("xmm0"))
 		} else if src1.Type == "temp" || src1.Type == "reg" {
 			// For GPRs, move as bit pattern first
-			ce.output.WriteString(fmt.Sprintf("    movq %s, %%xmm0\n", ce.formatOperand(src1)))
+			ce.emit("movq", ce.operand(src1), RegOp("xmm0"))
 		} else {
-			ce.output.WriteString(fmt.Sprintf("    movsd %s, %%xmm0\n", ce.formatOperand(src1)))
+			ce.emit("movsd", ce.operand(src1), RegOp("xmm0"))
 		}
 		
 		// Divide by src2
 		if src2.Type == "imm" {
 			label := ce.getFloatLabel(src2.Value)
-			ce.output.WriteString(fmt.Sprintf("    divsd %s(%%rip), %%xmm0\n", label))
+			ce.emit("divsd", RIPOp(label), RegOp("xmm0"))
 		} else if src2.Type == "temp" || src2.Type == "reg" {
 			// For GPRs, move to xmm1 first
-			ce.output.WriteString(fmt.Sprintf("    movq %s, %%xmm1\n", ce.formatOperand(src2)))
-			ce.output.WriteString(fmt.Sprintf("    divsd %%xmm1, %%xmm0\n"))
+			ce.emit("movq", ce.operand(src2), RegOp("xmm1"))
+			ce.emit("divsd", RegOp("xmm1"), RegOp("xmm0"))
 		} else {
-			ce.output.WriteString(fmt.Sprintf("    divsd %s, %%xmm0\n", ce.formatOperand(src2)))
+			ce.emit("divsd", ce.operand(src2), RegOp("xmm0"))
 		}
 		
 		// Store result
 		if dst.Type == "temp" || dst.Type == "reg" {
-			ce.output.WriteString(fmt.Sprintf("    movq %%xmm0, %s\n", ce.formatOperand(dst)))
+			ce.emit("movq", RegOp("xmm0"), ce.operand(dst))
 		} else {
-			ce.output.WriteString(fmt.Sprintf("    movsd %%xmm0, %s\n", ce.formatOperand(dst)))
+			ce.emit("movsd", RegOp("xmm0"), ce.operand(dst))
 		}
 		return
 	}
 	
 	// Division requires RAX and RDX
 	// Check if we're working with 32-bit integers
-	use32Bit := (src2.DataType == "int" || src2.DataType == "unsigned int" || src2.DataType == "unsigned" || 
-	             strings.HasPrefix(src2.DataType, "enum "))
+	use32Bit := (src2.DataType == "int" || strings.HasPrefix(src2.DataType, "enum "))
+	
+	if ce.target.IsUnsigned(src1.DataType) || ce.target.IsUnsigned(src2.DataType) {
+		// Unsigned operands are zero-extended, so a 64-bit divide serves
+		// every width
+		ce.emitUnsignedDivide(src1, src2)
+		ce.emit("movq", RegOp("rax"), ce.operand(dst))
+		return
+	}
 	
 	if use32Bit {
 		// 32-bit division
-		ce.output.WriteString(fmt.Sprintf("    movl %s, %%eax\n", ce.formatOperand32(src1)))
-		ce.output.WriteString("    cdq\n") // sign-extend EAX to EDX:EAX
+		src2 = ce.divisorOutOfRDX(src2)
+		ce.emit("movl", ce.operand32(src1), RegOp("eax"))
+		ce.emit("cdq") // sign-extend EAX to EDX:EAX
 		
 		if src2.Type == "imm" {
-			ce.output.WriteString(fmt.Sprintf("    movl %s, %%r11d\n", src2.Value))
-			ce.output.WriteString("    idivl %r11d\n")
+			ce.emit("movl", ce.operand32(src2), RegOp("r11d"))
+			ce.emit("idivl", RegOp("r11d"))
 		} else {
-			ce.output.WriteString(fmt.Sprintf("    idivl %s\n", ce.formatOperand32(src2)))
+			ce.emit("idivl", ce.operand32(src2))
 		}
 		
-		ce.output.WriteString(fmt.Sprintf("    movl %%eax, %s\n", ce.formatOperand32(dst)))
+		ce.emit("cltq")
+		ce.emit("movq", RegOp("rax"), ce.operand(dst))
 	} else {
 		// 64-bit division (original code)
-		ce.output.WriteString(fmt.Sprintf("    movq %s, %%rax\n", ce.formatOperand(src1)))
-		ce.output.WriteString("    cqto\n")
+		src2 = ce.divisorOutOfRDX(src2)
+		ce.emit("movq", ce.operand(src1), RegOp("rax"))
+		ce.emit("cqto")
 		
 		if src2.Type == "imm" {
-			src2Str := ce.loadFloatIfNeeded(src2, "%r11")
-			if src2Str == "%r11" {
-				ce.output.WriteString("    idivq %r11\n")
+			src2Op := ce.loadFloatIfNeeded(src2, RegOp("r11"))
+			if src2Op == RegOp("r11") {
+				ce.emit("idivq", RegOp("r11"))
 			} else {
-				ce.output.WriteString(fmt.Sprintf("    movq %s, %%r11\n", src2Str))
-				ce.output.WriteString("    idivq %r11\n")
+				ce.emit("movq", src2Op, RegOp("r11"))
+				ce.emit("idivq", RegOp("r11"))
 			}
 		} else {
-			ce.output.WriteString(fmt.Sprintf("    idivq %s\n", ce.formatOperand(src2)))
+			ce.emit("idivq", ce.operand(src2))
 		}
 		
-		ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", ce.formatOperand(dst)))
+		ce.emit("movq", RegOp("rax"), ce.operand(dst))
 	}
 }
 
 func (ce *CodeEmitter) emitMod(dst, src1, src2 *Operand) {
 	// Modulo - result in RDX
 	// Check if we're working with 32-bit integers
-	use32Bit := (src2.DataType == "int" || src2.DataType == "unsigned int" || src2.DataType == "unsigned" || 
-	             strings.HasPrefix(src2.DataType, "enum "))
+	use32Bit := (src2.DataType == "int" || strings.HasPrefix(src2.DataType, "enum "))
+	
+	if ce.target.IsUnsigned(src1.DataType) || ce.target.IsUnsigned(src2.DataType) {
+		// Unsigned operands are zero-extended, so a 64-bit divide serves
+		// every width
+		ce.emitUnsignedDivide(src1, src2)
+		ce.emit("movq", RegOp("rdx"), ce.operand(dst))
+		return
+	}
 	
 	if use32Bit {
 		// 32-bit division
-		ce.output.WriteString(fmt.Sprintf("    movl %s, %%eax\n", ce.formatOperand32(src1)))
-		ce.output.WriteString("    cdq\n") // sign-extend EAX to EDX:EAX
+		src2 = ce.divisorOutOfRDX(src2)
+		ce.emit("movl", ce.operand32(src1), RegOp("eax"))
+		ce.emit("cdq") // sign-extend EAX to EDX:EAX
 		
 		if src2.Type == "imm" {
-			ce.output.WriteString(fmt.Sprintf("    movl %s, %%r11d\n", src2.Value))
-			ce.output.WriteString("    idivl %r11d\n")
+			ce.emit("movl", ce.operand32(src2), RegOp("r11d"))
+			ce.emit("idivl", RegOp("r11d"))
 		} else {
-			ce.output.WriteString(fmt.Sprintf("    idivl %s\n", ce.formatOperand32(src2)))
+			ce.emit("idivl", ce.operand32(src2))
 		}
 		
-		ce.output.WriteString(fmt.Sprintf("    movl %%edx, %s\n", ce.formatOperand32(dst)))
+		ce.emit("movslq", RegOp("edx"), RegOp("rax"))
+		ce.emit("movq", RegOp("rax"), ce.operand(dst))
 	} else {
 		// 64-bit division (original code)
-		ce.output.WriteString(fmt.Sprintf("    movq %s, %%rax\n", ce.formatOperand(src1)))
-		ce.output.WriteString("    cqto\n")
+		src2 = ce.divisorOutOfRDX(src2)
+		ce.emit("movq", ce.operand(src1), RegOp("rax"))
+		ce.emit("cqto")
 		
 		if src2.Type == "imm" {
-			src2Str := ce.loadFloatIfNeeded(src2, "%r11")
-			if src2Str == "%r11" {
-				ce.output.WriteString("    idivq %r11\n")
+			src2Op := ce.loadFloatIfNeeded(src2, RegOp("r11"))
+			if src2Op == RegOp("r11") {
+				ce.emit("idivq", RegOp("r11"))
 			} else {
-				ce.output.WriteString(fmt.Sprintf("    movq %s, %%r11\n", src2Str))
-				ce.output.WriteString("    idivq %r11\n")
+				ce.emit("movq", src2Op, RegOp("r11"))
+				ce.emit("idivq", RegOp("r11"))
 			}
 		} else {
-			ce.output.WriteString(fmt.Sprintf("    idivq %s\n", ce.formatOperand(src2)))
+			ce.emit("idivq", ce.operand(src2))
 		}
 		
-		ce.output.WriteString(fmt.Sprintf("    movq %%rdx, %s\n", ce.formatOperand(dst)))
+		ce.emit("movq", RegOp("rdx"), ce.operand(dst))
 	}
 }
 
+// emitUnsignedDivide divides src1 by src2 as unsigned 64-bit integers,
+// leaving the quotient in %rax and the remainder in %rdx
+func (ce *CodeEmitter) emitUnsignedDivide(src1, src2 *Operand) {
+	ce.emit("movq", ce.operand(src2), RegOp("r11"))
+	ce.emit("movq", ce.operand(src1), RegOp("rax"))
+	ce.emit("xorq", RegOp("rdx"), RegOp("rdx"))
+	ce.emit("divq", RegOp("r11"))
+}
+
+// divisorOutOfRDX moves a divisor the allocator left in %rdx (its last use)
+// to %r11, since cqto/cdq overwrite %rdx before idiv reads it
+func (ce *CodeEmitter) divisorOutOfRDX(src2 *Operand) *Operand {
+	if src2.Type != "imm" && ce.operand(src2) == RegOp("rdx") {
+		ce.emit("movq", RegOp("rdx"), RegOp("r11"))
+		return &Operand{Type: "reg", Value: "r11", DataType: src2.DataType}
+	}
+	return src2
+}
+
 func (ce *CodeEmitter) emitShift(op string, dst, src1, src2 *Operand) {
+	// Shift amount must be in CL. The shift is done in %r11: dst may be
+	// %rcx, or the count's register, and src1 may be in %rcx.
+	if src2.Type != "imm" {
+		ce.emit("movq", ce.operand(src1), RegOp("r11"))
+		ce.emit("movq", ce.operand(src2), RegOp("rcx"))
+		ce.emit(op, RegOp("cl"), RegOp("r11"))
+		ce.emit("movq", RegOp("r11"), ce.operand(dst))
+		return
+	}
+	
 	ce.emitMov(dst, src1)
 	
-	// Shift amount must be in CL
-	if src2.Type != "imm" {
-		ce.output.WriteString(fmt.Sprintf("    movq %s, %%rcx\n", ce.formatOperand(src2)))
-		ce.output.WriteString(fmt.Sprintf("    %s %%cl, %s\n", op, ce.formatOperand(dst)))
+	// Handle float immediates
+	src2Op := ce.loadFloatIfNeeded(src2, RegOp("rcx"))
+	if src2Op == RegOp("rcx") {
+		ce.emit(op, RegOp("cl"), ce.operand(dst))
 	} else {
-		// Handle float immediates
-		src2Str := ce.loadFloatIfNeeded(src2, "%rcx")
-		if src2Str == "%rcx" {
-			ce.output.WriteString(fmt.Sprintf("    %s %%cl, %s\n", op, ce.formatOperand(dst)))
-		} else {
-			ce.output.WriteString(fmt.Sprintf("    %s %s, %s\n", op, src2Str, ce.formatOperand(dst)))
-		}
+		ce.emit(op, src2Op, ce.operand(dst))
 	}
 }
 
+// unsignedSetCC is the setcc for an ordering comparison of unsigned
+// integers or of doubles (ucomisd sets the flags like an unsigned compare)
+var unsignedSetCC = map[string]string{
+	"setl": "setb", "setle": "setbe", "setg": "seta", "setge": "setae",
+}
+
 func (ce *CodeEmitter) emitComparison(setcc string, dst, src1, src2 *Operand) {
-	src1Str := ce.formatOperand(src1)
-	src2Str := ce.formatOperand(src2)
+	if isFloating(src1, src2) {
+		ce.loadXMM(src1, "xmm0")
+		ce.loadXMM(src2, "xmm1")
+		ce.emit("ucomisd", RegOp("xmm1"), RegOp("xmm0"))
+		if cc, ok := unsignedSetCC[setcc]; ok {
+			setcc = cc
+		}
+	} else if ce.target.IsUnsigned(src1.DataType) || ce.target.IsUnsigned(src2.DataType) {
+		if cc, ok := unsignedSetCC[setcc]; ok {
+			setcc = cc
+		}
+	}
+	src1Op := ce.operand(src1)
+	src2Op := ce.operand(src2)
 	
 	// Handle float immediates - they need to be in .rodata
 	if src2.Type == "imm" && (src2.DataType == "float" || src2.DataType == "double") {
 		label := ce.getFloatLabel(src2.Value)
 		// Load into a register for comparison
-		ce.output.WriteString(fmt.Sprintf("    movq %s(%%rip), %%r10\n", label))
-		src2Str = "%r10"
+		ce.emit("movq", RIPOp(label), RegOp("r10"))
+		src2Op = RegOp("r10")
 	}
 	
-	src1IsMem := strings.Contains(src1Str, "(") && strings.Contains(src1Str, ")")
-	src2IsMem := strings.Contains(src2Str, "(") && strings.Contains(src2Str, ")")
-	
-	if src1IsMem && src2IsMem {
-		// Both are memory - load one into register
-		ce.output.WriteString(fmt.Sprintf("    movq %s, %%rax\n", src1Str))
-		ce.output.WriteString(fmt.Sprintf("    cmpq %s, %%rax\n", src2Str))
+	if isFloating(src1, src2) {
+		// Compared above
+	} else if (src1Op.Kind == MOpMem && src2Op.Kind == MOpMem) || src1.Type == "imm" {
+		// Both are memory, or the first is a constant (cmp can't take
+		// one there) - load it into a register
+		ce.emit("movq", src1Op, RegOp("rax"))
+		ce.emit("cmpq", src2Op, RegOp("rax"))
 	} else {
-		ce.output.WriteString(fmt.Sprintf("    cmpq %s, %s\n", src2Str, src1Str))
+		ce.emit("cmpq", src2Op, src1Op)
 	}
 	
-	ce.output.WriteString(fmt.Sprintf("    %s %%al\n", setcc))
+	ce.emit(setcc, RegOp("al"))
 	
-	dstStr := ce.formatOperand(dst)
-	dstIsMem := strings.Contains(dstStr, "(") && strings.Contains(dstStr, ")")
-	
-	if dstIsMem {
-		ce.output.WriteString("    movzbq %al, %rax\n")
-		ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", dstStr))
+	dstOp := ce.operand(dst)
+	if dstOp.Kind == MOpMem {
+		ce.emit("movzbq", RegOp("al"), RegOp("rax"))
+		ce.emit("movq", RegOp("rax"), dstOp)
 	} else {
-		ce.output.WriteString(fmt.Sprintf("    movzbq %%al, %s\n", dstStr))
+		ce.emit("movzbq", RegOp("al"), dstOp)
+	}
+}
+
+// loadXMM loads op, a double, into the XMM register xmm
+func (ce *CodeEmitter) loadXMM(op *Operand, xmm string) {
+	switch op.Type {
+	case "imm":
+		ce.emit("movsd", RIPOp(ce.getFloatLabel(op.Value)), RegOp(xmm))
+	case "temp", "reg":
+		ce.emit("movq", ce.operand(op), RegOp(xmm))
+	default:
+		ce.emit("movsd", ce.operand(op), RegOp(xmm))
+	}
+}
+
+// byteLoad widens the byte at src into the 64-bit register dst: plain char
+// follows the target's signedness, other byte types zero-extend
+func (ce *CodeEmitter) byteLoad(dataType string, src, dst MachineOperand) {
+	if ce.target.IsSignedChar(dataType) {
+		ce.emit("movsbq", src, dst)
+		return
+	}
+	ce.emit("movzbl", src, ce.get32BitReg(dst))
+}
+
+// narrowLoad loads the size-byte value of type dataType at src into the
+// 64-bit register dst, extended to its canonical form (see conversions.go)
+func (ce *CodeEmitter) narrowLoad(dataType string, size int, src, dst MachineOperand) {
+	signed := isSignedInteger(ce.target, dataType)
+	switch {
+	case size == 1:
+		ce.byteLoad(dataType, src, dst)
+	case size == 2 && signed:
+		ce.emit("movswq", src, dst)
+	case size == 2:
+		ce.emit("movzwl", src, ce.get32BitReg(dst))
+	case signed:
+		ce.emit("movslq", src, dst)
+	default:
+		// movl zeros the upper 32 bits
+		ce.emit("movl", src, ce.get32BitReg(dst))
 	}
 }
 
 func (ce *CodeEmitter) emitLoad(dst, src *Operand) {
 	switch src.Type {
 	case "var":
-		dstStr := ce.formatOperand(dst)
+		dstOp := ce.operand(dst)
+		addr := MemOp("rbp", int64(src.Offset))
+		if src.IsGlobal {
+			addr = globalAddr(src)
+		}
 		// Check if destination is also memory
-		if strings.Contains(dstStr, "(") && strings.Contains(dstStr, ")") {
+		if dstOp.Kind == MOpMem {
 			// Load through register - use appropriate size
 			if src.Size > 0 && src.Size < 8 {
-				if src.IsGlobal {
-					if src.Size == 4 {
-						// Load 32-bit and zero-extend
-						ce.output.WriteString(fmt.Sprintf("    movl %s(%%rip), %%eax\n", src.Value))
-					} else if src.Size == 2 {
-						ce.output.WriteString(fmt.Sprintf("    movzwl %s(%%rip), %%eax\n", src.Value))
-					} else if src.Size == 1 {
-						ce.output.WriteString(fmt.Sprintf("    movzbl %s(%%rip), %%eax\n", src.Value))
-					}
-				} else {
-					if src.Size == 4 {
-						ce.output.WriteString(fmt.Sprintf("    movl %d(%%rbp), %%eax\n", src.Offset))
-					} else if src.Size == 2 {
-						ce.output.WriteString(fmt.Sprintf("    movzwl %d(%%rbp), %%eax\n", src.Offset))
-					} else if src.Size == 1 {
-						ce.output.WriteString(fmt.Sprintf("    movzbl %d(%%rbp), %%eax\n", src.Offset))
-					}
-				}
-				// movl to %eax zeros upper 32 bits of %rax
-				ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", dstStr))
+				ce.narrowLoad(src.DataType, src.Size, addr, RegOp("rax"))
 			} else {
 				// Default 8-byte load
-				if src.IsGlobal {
-					ce.output.WriteString(fmt.Sprintf("    movq %s(%%rip), %%rax\n", src.Value))
-				} else {
-					ce.output.WriteString(fmt.Sprintf("    movq %d(%%rbp), %%rax\n", src.Offset))
-				}
-				ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", dstStr))
+				ce.emit("movq", addr, RegOp("rax"))
 			}
+			ce.emit("movq", RegOp("rax"), dstOp)
 		} else {
 			// Direct load to register - use appropriate size
 			if src.Size > 0 && src.Size < 8 {
-				if src.IsGlobal {
-					// For direct register loads, we can use movl directly which zeros upper bits
-					dstStr32 := ce.formatOperand32(dst)
-					if src.Size == 4 {
-						ce.output.WriteString(fmt.Sprintf("    movl %s(%%rip), %s\n", src.Value, dstStr32))
-					} else if src.Size == 2 {
-						ce.output.WriteString(fmt.Sprintf("    movzwl %s(%%rip), %s\n", src.Value, dstStr32))
-					} else if src.Size == 1 {
-						ce.output.WriteString(fmt.Sprintf("    movzbl %s(%%rip), %s\n", src.Value, dstStr32))
-					}
-				} else {
-					// Local variable load
-					dstStr32 := ce.formatOperand32(dst)
-					if src.Size == 4 {
-						ce.output.WriteString(fmt.Sprintf("    movl %d(%%rbp), %s\n", src.Offset, dstStr32))
-					} else if src.Size == 2 {
-						ce.output.WriteString(fmt.Sprintf("    movzwl %d(%%rbp), %s\n", src.Offset, dstStr32))
-					} else if src.Size == 1 {
-						ce.output.WriteString(fmt.Sprintf("    movzbl %d(%%rbp), %s\n", src.Offset, dstStr32))
-					}
-				}
+				ce.narrowLoad(src.DataType, src.Size, addr, dstOp)
 			} else {
 				// Default 8-byte load
-				if src.IsGlobal {
-					ce.output.WriteString(fmt.Sprintf("    movq %s(%%rip), %s\n", src.Value, dstStr))
-				} else {
-					ce.output.WriteString(fmt.Sprintf("    movq %d(%%rbp), %s\n", src.Offset, dstStr))
-				}
+				ce.emit("movq", addr, dstOp)
 			}
 		}
 	case "array":
 		// Load from array[index]: base(%rbp) + index_temp
-		indexReg := ce.formatOperand(src.IndexTemp)
-		dstReg := ce.formatOperand(dst)
+		indexOp := ce.operand(src.IndexTemp)
+		dstOp := ce.operand(dst)
 		
 		// Move index to r11 to avoid clobbering
-		ce.output.WriteString(fmt.Sprintf("    movq %s, %%r11\n", indexReg))
+		ce.emit("movq", indexOp, RegOp("r11"))
 		
 		if src.IsGlobal {
 			// Global array: load from symbol + offset
-			ce.output.WriteString(fmt.Sprintf("    leaq %s(%%rip), %%rdx\n", src.Value))
-			ce.output.WriteString(fmt.Sprintf("    movq (%%rdx, %%r11, 1), %s\n", dstReg))
+			ce.emit("leaq", RIPOp(src.Value), RegOp("rax"))
+			ce.emit("movq", MemOp("rax", 0).Indexed("r11", 1), dstOp)
 		} else {
 			// Local array: load from rbp + base_offset + computed_offset
-			ce.output.WriteString(fmt.Sprintf("    leaq %d(%%rbp), %%rdx\n", src.Offset))
-			ce.output.WriteString(fmt.Sprintf("    movq (%%rdx, %%r11, 1), %s\n", dstReg))
+			ce.emit("movq", MemOp("rbp", int64(src.Offset)).Indexed("r11", 1), dstOp)
 		}
 	case "addr":
 		// Address-of: compute address and store in dst
-		dstStr := ce.formatOperand(dst)
-		dstIsMem := strings.Contains(dstStr, "(") && strings.Contains(dstStr, ")")
+		dstOp := ce.operand(dst)
+		addr := MemOp("rbp", int64(src.Offset))
+		if src.IsGlobal {
+			addr = globalAddr(src)
+		}
 		
-		if dstIsMem {
+		if dstOp.Kind == MOpMem {
 			// Destination is memory, go through rax
-			if src.IsGlobal {
-				ce.output.WriteString(fmt.Sprintf("    leaq %s(%%rip), %%rax\n", src.Value))
-			} else {
-				ce.output.WriteString(fmt.Sprintf("    leaq %d(%%rbp), %%rax\n", src.Offset))
-			}
-			ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", dstStr))
+			ce.emit("leaq", addr, RegOp("rax"))
+			ce.emit("movq", RegOp("rax"), dstOp)
 		} else {
 			// Destination is register
-			if src.IsGlobal {
-				ce.output.WriteString(fmt.Sprintf("    leaq %s(%%rip), %s\n", src.Value, dstStr))
-			} else {
-				ce.output.WriteString(fmt.Sprintf("    leaq %d(%%rbp), %s\n", src.Offset, dstStr))
-			}
+			ce.emit("leaq", addr, dstOp)
 		}
 	case "ptr":
 		// Dereference: load from address in IndexTemp
-		ptrReg := ce.formatOperand(src.IndexTemp)
-		ptrIsMem := strings.Contains(ptrReg, "(") && strings.Contains(ptrReg, ")")
-		
-		dstStr := ce.formatOperand(dst)
-		dstIsMem := strings.Contains(dstStr, "(") && strings.Contains(dstStr, ")")
+		ptrOp := ce.operand(src.IndexTemp)
+		dstOp := ce.operand(dst)
 		
 		// If pointer is in memory, load it first
-		if ptrIsMem {
-			ce.output.WriteString(fmt.Sprintf("    movq %s, %%r11\n", ptrReg))
-			ptrReg = "%r11"
-		}
-		
-		// Determine the appropriate mov instruction based on data type
-		// Strip qualifiers like const, volatile, etc.
-		dataType := strings.TrimSpace(src.DataType)
-		dataType = strings.TrimPrefix(dataType, "const ")
-		dataType = strings.TrimPrefix(dataType, "volatile ")
-		dataType = strings.TrimPrefix(dataType, "register ")
-		dataType = strings.TrimSpace(dataType)
-		
-		movInstr := "movq"
-		if dataType == "char" || dataType == "signed char" || dataType == "unsigned char" {
-			movInstr = "movb"
-		} else if dataType == "short" || dataType == "short int" || dataType == "signed short" || dataType == "unsigned short" {
-			movInstr = "movw"
-		} else if dataType == "int" || dataType == "signed int" || dataType == "unsigned int" {
-			movInstr = "movl"
-		}
-		
-		if dstIsMem {
-			if movInstr == "movb" {
-				ce.output.WriteString(fmt.Sprintf("    movb (%s), %%al\n", ptrReg))
-				ce.output.WriteString("    movzbq %al, %rax\n")  // Zero-extend to 64-bit
-				ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", dstStr))
-			} else if movInstr == "movw" {
-				ce.output.WriteString(fmt.Sprintf("    movzwl (%s), %%eax\n", ptrReg))
-				ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", dstStr))
-			} else if movInstr == "movl" {
-				// movl zeros upper 32 bits automatically
-				ce.output.WriteString(fmt.Sprintf("    movl (%s), %%eax\n", ptrReg))
-				ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", dstStr))
-			} else {
-				ce.output.WriteString(fmt.Sprintf("    movq (%s), %%rax\n", ptrReg))
-				ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", dstStr))
-			}
+		if ptrOp.Kind == MOpMem {
+			ce.emit("movq", ptrOp, RegOp("r11"))
+			ptrOp = RegOp("r11")
+		}
+		pointee := MemOp(ptrOp.Reg, 0)
+		
+		// The width comes from the pointee type
+		size := 8
+		if n, ok := ce.target.SizeOf(src.DataType); ok && n < 8 {
+			size = n
+		}
+		if size < 8 {
+			ce.narrowLoad(src.DataType, size, pointee, RegOp("rax"))
+			ce.emit("movq", RegOp("rax"), dstOp)
+		} else if dstOp.Kind == MOpMem {
+			ce.emit("movq", pointee, RegOp("rax"))
+			ce.emit("movq", RegOp("rax"), dstOp)
 		} else {
-			if movInstr == "movb" {
-				ce.output.WriteString(fmt.Sprintf("    movzbl (%s), %%eax\n", ptrReg))
-				ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", dstStr))
-			} else if movInstr == "movw" {
-				ce.output.WriteString(fmt.Sprintf("    movzwl (%s), %%eax\n", ptrReg))
-				ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", dstStr))
-			} else if movInstr == "movl" {
-				// movl to 32-bit register zeros upper 32 bits
-				dstStr32 := ce.formatOperand32(dst)
-				ce.output.WriteString(fmt.Sprintf("    movl (%s), %s\n", ptrReg, dstStr32))
-			} else {
-				ce.output.WriteString(fmt.Sprintf("    movq (%s), %s\n", ptrReg, dstStr))
-			}
+			ce.emit("movq", pointee, dstOp)
 		}
 	case "label":
 		// String literal or global label - use leaq to load address
-		dstStr := ce.formatOperand(dst)
-		dstIsMem := strings.Contains(dstStr, "(") && strings.Contains(dstStr, ")")
+		dstOp := ce.operand(dst)
 		
-		if dstIsMem {
-			ce.output.WriteString(fmt.Sprintf("    leaq %s(%%rip), %%rax\n", src.Value))
-			ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", dstStr))
+		if dstOp.Kind == MOpMem {
+			ce.emit("leaq", RIPOp(src.Value), RegOp("rax"))
+			ce.emit("movq", RegOp("rax"), dstOp)
 		} else {
-			ce.output.WriteString(fmt.Sprintf("    leaq %s(%%rip), %s\n", src.Value, dstStr))
+			ce.emit("leaq", RIPOp(src.Value), dstOp)
 		}
 	case "mem":
 		// Load from stack location
-		dstStr := ce.formatOperand(dst)
-		srcStr := ce.formatOperand(src) // This will be offset(%rbp)
-		
-		dstIsMem := strings.Contains(dstStr, "(") && strings.Contains(dstStr, ")")
+		dstOp := ce.operand(dst)
+		srcOp := ce.operand(src) // This will be offset(%rbp)
 		
-		if dstIsMem {
+		if dstOp.Kind == MOpMem {
 			// Mem to mem - use intermediate register
-			ce.output.WriteString(fmt.Sprintf("    movq %s, %%rax\n", srcStr))
-			ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s\n", dstStr))
+			ce.emit("movq", srcOp, RegOp("rax"))
+			ce.emit("movq", RegOp("rax"), dstOp)
 		} else {
 			// Mem to register - direct move
-			ce.output.WriteString(fmt.Sprintf("    movq %s, %s\n", srcStr, dstStr))
+			ce.emit("movq", srcOp, dstOp)
 		}
 	default:
 		ce.emitMov(dst, src)
@@ -1016,146 +1345,161 @@ func (ce *CodeEmitter) emitLoad(dst, src *Operand) {
 func (ce *CodeEmitter) emitStore(dst, src *Operand) {
 	switch dst.Type {
 	case "var":
+		target := MemOp("rbp", int64(dst.Offset))
+		if dst.IsGlobal {
+			target = globalAddr(dst)
+		}
+		
 		// Special handling for label sources (string literals)
 		if src.Type == "label" {
-			if dst.IsGlobal {
-				ce.output.WriteString(fmt.Sprintf("    leaq %s(%%rip), %%rax\n", src.Value))
-				ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s(%%rip)\n", dst.Value))
+			ce.emit("leaq", RIPOp(src.Value), RegOp("rax"))
+			ce.emit("movq", RegOp("rax"), target)
+			return
+		}
+		
+		// Address-of (&var): the address, not what's there
+		if src.Type == "addr" {
+			if src.IsGlobal {
+				ce.emit("leaq", globalAddr(src), RegOp("rax"))
 			} else {
-				ce.output.WriteString(fmt.Sprintf("    leaq %s(%%rip), %%rax\n", src.Value))
-				ce.output.WriteString(fmt.Sprintf("    movq %%rax, %d(%%rbp)\n", dst.Offset))
+				ce.emit("leaq", MemOp("rbp", int64(src.Offset)), RegOp("rax"))
 			}
+			ce.emit("movq", RegOp("rax"), target)
 			return
 		}
 		
-		srcStr := ce.formatOperand(src)
-		srcIsMem := strings.Contains(srcStr, "(") && strings.Contains(srcStr, ")")
+		srcOp := ce.operand(src)
+		srcIsMem := srcOp.Kind == MOpMem
 		
 		if dst.IsGlobal {
-			if src.Type == "imm" || srcIsMem {
+			if src.Type == "imm" || srcIsMem || (dst.Size > 0 && dst.Size < 8) {
 				// Handle float immediates
-				loadedStr := ce.loadFloatIfNeeded(src, "%rax")
-				if loadedStr != "%rax" {
-					ce.output.WriteString(fmt.Sprintf("    movq %s, %%rax\n", loadedStr))
+				loaded := ce.loadFloatIfNeeded(src, RegOp("rax"))
+				if loaded != RegOp("rax") {
+					ce.emit("movq", loaded, RegOp("rax"))
+				}
+				// A member of a global struct is stored at its width
+				switch dst.Size {
+				case 4:
+					ce.emit("movl", RegOp("eax"), target)
+				case 2:
+					ce.emit("movw", RegOp("ax"), target)
+				case 1:
+					ce.emit("movb", RegOp("al"), target)
+				default:
+					ce.emit("movq", RegOp("rax"), target)
 				}
-				ce.output.WriteString(fmt.Sprintf("    movq %%rax, %s(%%rip)\n", dst.Value))
 			} else {
-				ce.output.WriteString(fmt.Sprintf("    movq %s, %s(%%rip)\n", srcStr, dst.Value))
+				ce.emit("movq", srcOp, target)
 			}
 		} else {
 			if srcIsMem || src.Type == "imm" {
 				// Handle float immediates
-				loadedStr := ce.loadFloatIfNeeded(src, "%rax")
-				if loadedStr != "%rax" {
-					ce.output.WriteString(fmt.Sprintf("    movq %s, %%rax\n", loadedStr))
+				loaded := ce.loadFloatIfNeeded(src, RegOp("rax"))
+				if loaded != RegOp("rax") {
+					ce.emit("movq", loaded, RegOp("rax"))
 				}
 				// Check if we have a specific size to store
 				if dst.Size > 0 && dst.Size < 8 {
 					// Use appropriately sized move instruction
 					if dst.Size == 4 {
-						ce.output.WriteString(fmt.Sprintf("    movl %%eax, %d(%%rbp)\n", dst.Offset))
+						ce.emit("movl", RegOp("eax"), target)
 					} else if dst.Size == 2 {
-						ce.output.WriteString(fmt.Sprintf("    movw %%ax, %d(%%rbp)\n", dst.Offset))
+						ce.emit("movw", RegOp("ax"), target)
 					} else if dst.Size == 1 {
-						ce.output.WriteString(fmt.Sprintf("    movb %%al, %d(%%rbp)\n", dst.Offset))
+						ce.emit("movb", RegOp("al"), target)
 					} else {
-						ce.output.WriteString(fmt.Sprintf("    movq %%rax, %d(%%rbp)\n", dst.Offset))
+						ce.emit("movq", RegOp("rax"), target)
 					}
 				} else {
-					// For integer immediates, use movl to avoid garbage in upper bytes
-					if src.Type == "imm" && !strings.Contains(src.Value, ".") {
-						// Use 32-bit mov for integer immediates
-						ce.output.WriteString(fmt.Sprintf("    movl $%s, %%eax\n", src.Value))
-						ce.output.WriteString(fmt.Sprintf("    movq %%rax, %d(%%rbp)\n", dst.Offset))
-					} else {
-						ce.output.WriteString(fmt.Sprintf("    movq %%rax, %d(%%rbp)\n", dst.Offset))
-					}
+					ce.emit("movq", RegOp("rax"), target)
 				}
 			} else {
-				ce.output.WriteString(fmt.Sprintf("    movq %s, %d(%%rbp)\n", srcStr, dst.Offset))
+				ce.emit("movq", srcOp, target)
 			}
 		}
 	case "array":
 		// Store to array[index]: base(%rbp) + index_temp
 		// IMPORTANT: Use separate registers for index and value!
-		indexReg := ce.formatOperand(dst.IndexTemp)
+		indexOp := ce.operand(dst.IndexTemp)
 		
-		// Move index to r11 to avoid clobbering
-		ce.output.WriteString(fmt.Sprintf("    movq %s, %%r11\n", indexReg))
+		// Move index to r11 to avoid clobbering; a global array's address
+		// is added to it before rax is needed for the value
+		ce.emit("movq", indexOp, RegOp("r11"))
+		if dst.IsGlobal {
+			ce.emit("leaq", RIPOp(dst.Value), RegOp("rax"))
+			ce.emit("addq", RegOp("rax"), RegOp("r11"))
+		}
 		
 		// Get source value into rax
-		srcReg := ce.formatOperand(src)
 		if src.Type == "imm" {
 			// Use helper for float immediates
-			loadedStr := ce.loadFloatIfNeeded(src, "%rax")
-			if loadedStr != "%rax" {
-				ce.output.WriteString(fmt.Sprintf("    movq %s, %%rax\n", loadedStr))
+			loaded := ce.loadFloatIfNeeded(src, RegOp("rax"))
+			if loaded != RegOp("rax") {
+				ce.emit("movq", loaded, RegOp("rax"))
 			}
+		} else if src.Type == "label" {
+			// A string's or function's address
+			ce.emit("leaq", RIPOp(src.Value), RegOp("rax"))
 		} else {
-			ce.output.WriteString(fmt.Sprintf("    movq %s, %%rax\n", srcReg))
+			ce.emit("movq", ce.operand(src), RegOp("rax"))
 		}
 		
 		if dst.IsGlobal {
 			// Global array: store to symbol + offset
-			ce.output.WriteString(fmt.Sprintf("    leaq %s(%%rip), %%rdx\n", dst.Value))
-			ce.output.WriteString(fmt.Sprintf("    movq %%rax, (%%rdx, %%r11, 1)\n"))
+			ce.emit("movq", RegOp("rax"), MemOp("r11", 0))
 		} else {
 			// Local array: store to rbp + base_offset + computed_offset
-			ce.output.WriteString(fmt.Sprintf("    leaq %d(%%rbp), %%rdx\n", dst.Offset))
-			ce.output.WriteString(fmt.Sprintf("    movq %%rax, (%%rdx, %%r11, 1)\n"))
+			ce.emit("movq", RegOp("rax"), MemOp("rbp", int64(dst.Offset)).Indexed("r11", 1))
 		}
 	case "ptr":
 		// Dereference store: store to address in IndexTemp
-		ptrReg := ce.formatOperand(dst.IndexTemp)
-		ptrIsMem := strings.Contains(ptrReg, "(") && strings.Contains(ptrReg, ")")
+		ptrOp := ce.operand(dst.IndexTemp)
 		
 		// Load pointer into a dedicated register if it's in memory
-		if ptrIsMem {
-			ce.output.WriteString(fmt.Sprintf("    movq %s, %%r11\n", ptrReg))
-			ptrReg = "%r11"
+		if ptrOp.Kind == MOpMem {
+			ce.emit("movq", ptrOp, RegOp("r11"))
+			ptrOp = RegOp("r11")
 		}
+		pointee := MemOp(ptrOp.Reg, 0)
 		
-		srcReg := ce.formatOperand(src)
-		srcIsMem := strings.Contains(srcReg, "(") && strings.Contains(srcReg, ")")
+		srcOp := ce.operand(src)
 		
 		// Choose a value register that won't clobber the pointer
-		valueReg := "%rax"
-		if ptrReg == "%rax" {
-			valueReg = "%r10"
+		valueReg := RegOp("rax")
+		if ptrOp == RegOp("rax") {
+			valueReg = RegOp("r10")
 		}
 		
-		if src.Type == "imm" || srcIsMem || src.Type == "label" {
+		if src.Type == "imm" || srcOp.Kind == MOpMem || src.Type == "label" {
 			// Need to load source into register first
 			if src.Type == "label" {
-				ce.output.WriteString(fmt.Sprintf("    leaq %s(%%rip), %s\n", srcReg, valueReg))
+				ce.emit("leaq", RIPOp(src.Value), valueReg)
 			} else if src.Type == "imm" {
 				// Use helper for float immediates
-				loadedStr := ce.loadFloatIfNeeded(src, valueReg)
-				if loadedStr != valueReg {
-					ce.output.WriteString(fmt.Sprintf("    movq %s, %s\n", loadedStr, valueReg))
+				loaded := ce.loadFloatIfNeeded(src, valueReg)
+				if loaded != valueReg {
+					ce.emit("movq", loaded, valueReg)
 				}
 			} else {
-				ce.output.WriteString(fmt.Sprintf("    movq %s, %s\n", srcReg, valueReg))
+				ce.emit("movq", srcOp, valueReg)
 			}
-			srcReg = valueReg
+			srcOp = valueReg
 		}
 		
 		// Use appropriate store size based on dst.Size
 		if dst.Size == 4 {
 			// 32-bit store - convert register to 32-bit version
-			srcReg32 := ce.get32BitReg(srcReg)
-			ce.output.WriteString(fmt.Sprintf("    movl %s, (%s)\n", srcReg32, ptrReg))
+			ce.emit("movl", ce.get32BitReg(srcOp), pointee)
 		} else if dst.Size == 2 {
 			// 16-bit store
-			srcReg16 := ce.get16BitReg(srcReg)
-			ce.output.WriteString(fmt.Sprintf("    movw %s, (%s)\n", srcReg16, ptrReg))
+			ce.emit("movw", ce.get16BitReg(srcOp), pointee)
 		} else if dst.Size == 1 {
 			// 8-bit store
-			srcReg8 := ce.get8BitReg(srcReg)
-			ce.output.WriteString(fmt.Sprintf("    movb %s, (%s)\n", srcReg8, ptrReg))
+			ce.emit("movb", ce.get8BitReg(srcOp), pointee)
 		} else {
 			// 64-bit store (default)
-			ce.output.WriteString(fmt.Sprintf("    movq %s, (%s)\n", srcReg, ptrReg))
+			ce.emit("movq", srcOp, pointee)
 		}
 	default:
 		ce.emitMov(dst, src)
@@ -1166,13 +1510,13 @@ func (ce *CodeEmitter) emitStore(dst, src *Operand) {
 func (ce *CodeEmitter) getFloatLabel(value string) string {
 	// Convert integer immediates to float format
 	floatVal := value
-	if !strings.Contains(floatVal, ".") {
+	if !strings.ContainsAny(floatVal, ".eEn") {
 		floatVal = floatVal + ".0"
 	}
 	
 	// Check if we already have this float value
-	for label, val := range ce.floatLits {
-		if val == floatVal {
+	for _, label := range ce.floatOrder {
+		if ce.floatLits[label] == floatVal {
 			return label
 		}
 	}
@@ -1181,6 +1525,7 @@ func (ce *CodeEmitter) getFloatLabel(value string) string {
 	ce.floatCounter++
 	label := fmt.Sprintf(".FC%d", ce.floatCounter)
 	ce.floatLits[label] = floatVal
+	ce.floatOrder = append(ce.floatOrder, label)
 	return label
 }
 
@@ -1192,8 +1537,8 @@ func (ce *CodeEmitter) emitSetArg(instr *IRInstruction) {
 	dstReg := instr.Dst.Value  // e.g., "rdi", "xmm0"
 	src := instr.Src1
 	
-	// Format the destination register
-	dstStr := "%" + dstReg
+	// The destination register
+	dst := RegOp(dstReg)
 	
 	// Check if destination is an XMM register (float)
 	isFloatReg := strings.HasPrefix(dstReg, "xmm")
@@ -1205,65 +1550,66 @@ func (ce *CodeEmitter) emitSetArg(instr *IRInstruction) {
 		case "imm":
 			// Float immediate - load from .rodata
 			label := ce.getFloatLabel(src.Value)
-			ce.output.WriteString(fmt.Sprintf("    movsd %s(%%rip), %s\n", label, dstStr))
+			ce.emit("movsd", RIPOp(label), dst)
 		case "temp", "reg":
-			srcStr := ce.formatOperand(src)
-			if strings.Contains(srcStr, "(") && strings.Contains(srcStr, ")") {
+			srcOp := ce.operand(src)
+			if srcOp.Kind == MOpMem {
 				// Source is in memory
-				ce.output.WriteString(fmt.Sprintf("    movsd %s, %s\n", srcStr, dstStr))
+				ce.emit("movsd", srcOp, dst)
 			} else {
 				// Source is in a GPR - use movq to move bitwise
-				ce.output.WriteString(fmt.Sprintf("    movq %s, %s\n", srcStr, dstStr))
+				ce.emit("movq", srcOp, dst)
 			}
-		case "mem", "var":
-			srcStr := ce.formatOperand(src)
-			ce.output.WriteString(fmt.Sprintf("    movsd %s, %s\n", srcStr, dstStr))
 		default:
-			srcStr := ce.formatOperand(src)
-			ce.output.WriteString(fmt.Sprintf("    movsd %s, %s\n", srcStr, dstStr))
+			ce.emit("movsd", ce.operand(src), dst)
 		}
 	} else {
 		// Moving to integer register
 		switch src.Type {
 		case "imm":
-			ce.output.WriteString(fmt.Sprintf("    movq $%s, %s\n", src.Value, dstStr))
+			ce.emit("movq", ImmTextOp(src.Value), dst)
 		case "temp", "reg":
-			srcStr := ce.formatOperand(src)
-			if strings.Contains(srcStr, "(") && strings.Contains(srcStr, ")") {
-				ce.output.WriteString(fmt.Sprintf("    movq %s, %s\n", srcStr, dstStr))
-			} else {
-				ce.output.WriteString(fmt.Sprintf("    movq %s, %s\n", srcStr, dstStr))
+			srcOp := ce.operand(src)
+			if srcOp == dst {
+				// Already there: the allocator prefers argument registers
+				break
 			}
-		case "mem", "var":
-			srcStr := ce.formatOperand(src)
-			ce.output.WriteString(fmt.Sprintf("    movq %s, %s\n", srcStr, dstStr))
+			ce.emit("movq", srcOp, dst)
 		case "label":
-			ce.output.WriteString(fmt.Sprintf("    leaq %s(%%rip), %s\n", src.Value, dstStr))
+			ce.emit("leaq", RIPOp(src.Value), dst)
+		case "addr":
+			// &var passes the address, not the value
+			ce.emit("leaq", ce.operand(src), dst)
 		default:
-			srcStr := ce.formatOperand(src)
-			ce.output.WriteString(fmt.Sprintf("    movq %s, %s\n", srcStr, dstStr))
+			ce.emit("movq", ce.operand(src), dst)
 		}
 	}
 }
 
 // Helper to load a float immediate into a register if needed
-func (ce *CodeEmitter) loadFloatIfNeeded(op *Operand, tempReg string) string {
+func (ce *CodeEmitter) loadFloatIfNeeded(op *Operand, tempReg MachineOperand) MachineOperand {
 	// Only treat as float if it's explicitly a float type
 	if op.Type == "imm" && (op.DataType == "float" || op.DataType == "double") {
 		// Float immediate - load from .rodata
 		label := ce.getFloatLabel(op.Value)
-		ce.output.WriteString(fmt.Sprintf("    movq %s(%%rip), %s\n", label, tempReg))
+		ce.emit("movq", RIPOp(label), tempReg)
 		return tempReg
 	}
-	return ce.formatOperand(op)
+	return ce.operand(op)
 }
 
 func (ce *CodeEmitter) emitCall(instr *IRInstruction) {
 	// Arguments should already be in registers from OpMov instructions
 	// Stack alignment should be handled in function prologue, not here
 	
-	// Call
-	ce.output.WriteString(fmt.Sprintf("    call %s\n", instr.Src1.Value))
+	// Call, through the register the address is in for an indirect call
+	if instr.Src1.Type == "reg" {
+		callee := RegOp(instr.Src1.Value)
+		callee.Indirect = true
+		ce.emit("call", callee)
+	} else {
+		ce.emit("call", SymOp(instr.Src1.Value))
+	}
 	
 	// Move result
 	if instr.Dst != nil && instr.Dst.Value != "rax" {
@@ -1271,213 +1617,307 @@ func (ce *CodeEmitter) emitCall(instr *IRInstruction) {
 	}
 }
 
-// Helper to convert 64-bit register name to 32-bit
-func (ce *CodeEmitter) get32BitReg(reg64 string) string {
-	// Remove % prefix if present
-	reg := strings.TrimPrefix(reg64, "%")
-	
-	switch reg {
-	case "rax": return "%eax"
-	case "rbx": return "%ebx"
-	case "rcx": return "%ecx"
-	case "rdx": return "%edx"
-	case "rsi": return "%esi"
-	case "rdi": return "%edi"
-	case "rbp": return "%ebp"
-	case "rsp": return "%esp"
-	case "r8": return "%r8d"
-	case "r9": return "%r9d"
-	case "r10": return "%r10d"
-	case "r11": return "%r11d"
-	case "r12": return "%r12d"
-	case "r13": return "%r13d"
-	case "r14": return "%r14d"
-	case "r15": return "%r15d"
-	default: return reg64  // Return as-is if not recognized
-	}
-}
-
-// Helper to convert 64-bit register name to 16-bit
-func (ce *CodeEmitter) get16BitReg(reg64 string) string {
-	reg := strings.TrimPrefix(reg64, "%")
-	
-	switch reg {
-	case "rax": return "%ax"
-	case "rbx": return "%bx"
-	case "rcx": return "%cx"
-	case "rdx": return "%dx"
-	case "rsi": return "%si"
-	case "rdi": return "%di"
-	case "rbp": return "%bp"
-	case "rsp": return "%sp"
-	case "r8": return "%r8w"
-	case "r9": return "%r9w"
-	case "r10": return "%r10w"
-	case "r11": return "%r11w"
-	case "r12": return "%r12w"
-	case "r13": return "%r13w"
-	case "r14": return "%r14w"
-	case "r15": return "%r15w"
+// Helper to convert a 64-bit register to its 32-bit half
+func (ce *CodeEmitter) get32BitReg(reg64 MachineOperand) MachineOperand {
+	if reg64.Kind != MOpReg {
+		return reg64
+	}
+	return RegOp(ce.reg64to32(reg64.Reg))
+}
+
+// Helper to convert a 64-bit register to its 16-bit part
+func (ce *CodeEmitter) get16BitReg(reg64 MachineOperand) MachineOperand {
+	if reg64.Kind != MOpReg {
+		return reg64
+	}
+	
+	switch reg64.Reg {
+	case "rax": return RegOp("ax")
+	case "rbx": return RegOp("bx")
+	case "rcx": return RegOp("cx")
+	case "rdx": return RegOp("dx")
+	case "rsi": return RegOp("si")
+	case "rdi": return RegOp("di")
+	case "rbp": return RegOp("bp")
+	case "rsp": return RegOp("sp")
+	case "r8": return RegOp("r8w")
+	case "r9": return RegOp("r9w")
+	case "r10": return RegOp("r10w")
+	case "r11": return RegOp("r11w")
+	case "r12": return RegOp("r12w")
+	case "r13": return RegOp("r13w")
+	case "r14": return RegOp("r14w")
+	case "r15": return RegOp("r15w")
 	default: return reg64
 	}
 }
 
-// Helper to convert 64-bit register name to 8-bit
-func (ce *CodeEmitter) get8BitReg(reg64 string) string {
-	reg := strings.TrimPrefix(reg64, "%")
-	
-	switch reg {
-	case "rax": return "%al"
-	case "rbx": return "%bl"
-	case "rcx": return "%cl"
-	case "rdx": return "%dl"
-	case "rsi": return "%sil"
-	case "rdi": return "%dil"
-	case "rbp": return "%bpl"
-	case "rsp": return "%spl"
-	case "r8": return "%r8b"
-	case "r9": return "%r9b"
-	case "r10": return "%r10b"
-	case "r11": return "%r11b"
-	case "r12": return "%r12b"
-	case "r13": return "%r13b"
-	case "r14": return "%r14b"
-	case "r15": return "%r15b"
+// Helper to convert a 64-bit register to its low byte
+func (ce *CodeEmitter) get8BitReg(reg64 MachineOperand) MachineOperand {
+	if reg64.Kind != MOpReg {
+		return reg64
+	}
+	
+	switch reg64.Reg {
+	case "rax": return RegOp("al")
+	case "rbx": return RegOp("bl")
+	case "rcx": return RegOp("cl")
+	case "rdx": return RegOp("dl")
+	case "rsi": return RegOp("sil")
+	case "rdi": return RegOp("dil")
+	case "rbp": return RegOp("bpl")
+	case "rsp": return RegOp("spl")
+	case "r8": return RegOp("r8b")
+	case "r9": return RegOp("r9b")
+	case "r10": return RegOp("r10b")
+	case "r11": return RegOp("r11b")
+	case "r12": return RegOp("r12b")
+	case "r13": return RegOp("r13b")
+	case "r14": return RegOp("r14b")
+	case "r15": return RegOp("r15b")
 	default: return reg64
 	}
 }
 
-func (ce *CodeEmitter) formatOperand(op *Operand) string {
+// globalAddr addresses a global, or a member Offset bytes into one,
+// relative to %rip
+func globalAddr(op *Operand) MachineOperand {
+	addr := RIPOp(op.Value)
+	addr.Disp = int64(op.Offset)
+	return addr
+}
+
+// immEscapes are the values of the character escapes an imm operand may be
+// written with
+var immEscapes = map[string]string{
+	"\\0": "0", "\\n": "10", "\\t": "9", "\\r": "13", "\\\\": "92", "\\'": "39", "\\\"": "34",
+}
+
+// immOperand is the immediate an imm operand holds
+func immOperand(op *Operand) MachineOperand {
+	if val, ok := immEscapes[op.Value]; ok {
+		return ImmTextOp(val)
+	}
+	return ImmTextOp(op.Value)
+}
+
+// operand is op as an instruction operand
+func (ce *CodeEmitter) operand(op *Operand) MachineOperand {
 	if op == nil {
-		return ""
+		return SymOp("")
 	}
 	
 	switch op.Type {
 	case "reg":
-		return "%" + op.Value
+		return RegOp(op.Value)
 	case "freg":
-		return "%" + op.Value
+		return RegOp(op.Value)
 	case "imm":
-		// Convert escape sequences to numeric values for assembly
-		val := op.Value
-		if val == "\\0" {
-			val = "0"
-		} else if val == "\\n" {
-			val = "10"
-		} else if val == "\\t" {
-			val = "9"
-		} else if val == "\\r" {
-			val = "13"
-		} else if val == "\\\\" {
-			val = "92"
-		} else if val == "\\'" {
-			val = "39"
-		} else if val == "\\\"" {
-			val = "34"
-		}
-		return "$" + val
+		return immOperand(op)
 	case "label":
-		return op.Value
+		return SymOp(op.Value)
 	case "mem":
-		if op.Offset == 0 {
-			return "(%rbp)"
-		}
-		return fmt.Sprintf("%d(%%rbp)", op.Offset)
+		return MemOp("rbp", int64(op.Offset))
 	case "var":
 		if op.IsGlobal {
-			return op.Value + "(%rip)"
+			return globalAddr(op)
 		}
-		return fmt.Sprintf("%d(%%rbp)", op.Offset)
+		return MemOp("rbp", int64(op.Offset))
 	case "array":
 		// arr[index] where index is in IndexTemp
-		// Need to generate: offset(%rbp, %index_reg, 8)
-		// For now, simplify by using the computed offset in a temp reg
 		if op.IndexTemp != nil {
-			indexReg := ce.formatOperand(op.IndexTemp)
+			index := ce.operand(op.IndexTemp)
 			if op.IsGlobal {
-				return fmt.Sprintf("%s(%s, %s, 1)", op.Value, "%rip", indexReg)
+				return RIPOp(op.Value).Indexed(index.Reg, 1)
 			}
-			return fmt.Sprintf("%d(%%rbp, %s, 1)", op.Offset, indexReg)
+			return MemOp("rbp", int64(op.Offset)).Indexed(index.Reg, 1)
 		}
-		return fmt.Sprintf("%d(%%rbp)", op.Offset)
+		return MemOp("rbp", int64(op.Offset))
 	case "addr":
 		// Address of variable - use lea
 		if op.IsGlobal {
-			return op.Value + "(%rip)"
+			return globalAddr(op)
 		}
-		return fmt.Sprintf("%d(%%rbp)", op.Offset)
+		return MemOp("rbp", int64(op.Offset))
 	case "ptr":
 		// Dereference - load from address in IndexTemp
 		if op.IndexTemp != nil {
-			ptrReg := ce.formatOperand(op.IndexTemp)
-			return fmt.Sprintf("(%s)", ptrReg)
+			return MemOp(ce.operand(op.IndexTemp).Reg, 0)
 		}
-		return "(%%rax)"
+		return MemOp("rax", 0)
 	default:
-		return op.Value
+		return SymOp(op.Value)
 	}
 }
 
 func (ce *CodeEmitter) buildOutput() string {
-	var result strings.Builder
+	var program []*MachineInstr
+	blank := &MachineInstr{Kind: MBlank}
 	
 	// RO data section
 	if ce.rodataSection.Len() > 0 {
-		result.WriteString(ce.rodataSection.String())
-		result.WriteString("\n")
+		program = append(program, ce.rodataSection.Instrs()...)
+		program = append(program, blank)
 	}
 	
 	// Data section
 	if ce.dataSection.Len() > 0 {
-		result.WriteString("    .data\n")
-		result.WriteString(ce.dataSection.String())
-		result.WriteString("\n")
+		program = append(program, NewDirective(".data", ""))
+		program = append(program, ce.dataSection.Instrs()...)
+		program = append(program, blank)
 	}
 	
 	// BSS section
 	if ce.bssSection.Len() > 0 {
-		result.WriteString(ce.bssSection.String())
-		result.WriteString("\n")
+		program = append(program, ce.bssSection.Instrs()...)
+		program = append(program, blank)
 	}
 	
 	// Text section
-	result.WriteString(ce.output.String())
+	program = append(program, ce.output.Instrs()...)
+	if ce.startStub {
+		program = append(program, blank)
+		program = append(program, startStub(ce.inits)...)
+	}
 	
-	return result.String()
+	ce.program = program
+	if ce.intelSyntax {
+		return PrintMachineInstrsIntel(program)
+	}
+	return PrintMachineInstrs(program)
 }
 
+// MachineInstrs returns the structured instruction stream from the last Emit
+func (ce *CodeEmitter) MachineInstrs() []*MachineInstr {
+	return ce.program
+}
+
+// escapeString writes a string literal's bytes (decoded by the lexer) for
+// GAS's .string: quotes and backslashes are escaped, the usual control
+// characters get their C escapes, and any other byte outside printable
+// ASCII is written in octal, so the assembled bytes are exactly the
+// literal's
 func escapeString(s string) string {
-	// String from lexer already has escape sequences like \n, \t
-	// Just need to escape quotes and backslashes for assembly
-	s = strings.ReplaceAll(s, "\\", "\\\\")  // Escape backslashes first
-	s = strings.ReplaceAll(s, "\"", "\\\"")  // Escape quotes
-	// Now unescape common sequences so GAS interprets them
-	s = strings.ReplaceAll(s, "\\\\n", "\\n")
-	s = strings.ReplaceAll(s, "\\\\t", "\\t")
-	s = strings.ReplaceAll(s, "\\\\r", "\\r")
-	s = strings.ReplaceAll(s, "\\\\0", "\\0")
-	return s
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			b.WriteString("\\\"")
+		case '\\':
+			b.WriteString("\\\\")
+		case '\n':
+			b.WriteString("\\n")
+		case '\t':
+			b.WriteString("\\t")
+		case '\r':
+			b.WriteString("\\r")
+		default:
+			if c < ' ' || c > '~' {
+				fmt.Fprintf(&b, "\\%03o", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	return b.String()
 }
 
 // EmitMachineCode generates machine code directly using the assembler
 func (ce *CodeEmitter) EmitMachineCode() ([]byte, map[string]uint64, error) {
-	// Generate assembly text first
-	asmText := ce.Emit()
+	// Build the instruction stream; the assembler encodes it directly
+	ce.Emit()
 	
 	// Create assembler and assemble
 	assembler := NewAssembler()
-	machineCode, err := assembler.AssembleText(asmText)
+	machineCode, err := assembler.AssembleInstrs(ce.program)
 	if err != nil {
 		return nil, nil, fmt.Errorf("assembly failed: %w", err)
 	}
 	
+	ce.textRelocs = assembler.GetRelocations()
+	
 	// Return machine code and symbols
 	return machineCode, assembler.GetSymbols(), nil
 }
 
-// GetSections returns rodata and data sections
-func (ce *CodeEmitter) GetSections() (rodata, data []byte, bssSize uint64) {
-	// For now, return empty sections
-	// TODO: Parse and encode rodata and data sections
-	return nil, nil, 0
+// GetRelocations returns the .text relocations from the last EmitMachineCode
+func (ce *CodeEmitter) GetRelocations() []Relocation {
+	return ce.textRelocs
+}
+
+// Section is an encoded data section for the native linker
+type Section struct {
+	Name    string            // "rodata", "data" or "bss"
+	Data    []byte            // Contents (nil for bss)
+	Size    uint64            // len(Data), or reserved size for bss
+	Symbols map[string]uint64 // Symbol -> offset within the section
+	Align   uint64            // Strictest alignment asked of it (.align, .comm)
+	
+	enc     ByteEncoder
+}
+
+func newSection(name string) *Section {
+	return &Section{Name: name, Symbols: make(map[string]uint64), enc: encoderX86_64}
+}
+
+// align pads the section to a multiple of n
+func (s *Section) align(n uint64) {
+	s.Align = max(s.Align, n)
+	for s.Size%n != 0 {
+		if s.Name != "bss" {
+			s.Data = append(s.Data, 0)
+		}
+		s.Size++
+	}
+}
+
+func (s *Section) define(name string) {
+	s.Symbols[name] = s.Size
+}
+
+func (s *Section) write(b ...byte) {
+	s.Data = append(s.Data, b...)
+	s.Size += uint64(len(b))
+}
+
+// writeInt encodes an integer of the given width in the target byte order
+func (s *Section) writeInt(val uint64, size int) {
+	s.Data = s.enc.Append(s.Data, val, size)
+	s.Size += uint64(size)
+}
+
+// orderedKeys lists m's keys in the order given, then any keys order misses
+// sorted by name, so data sections come out the same on every run
+func orderedKeys[V any](m map[string]V, order []string) []string {
+	keys := make([]string, 0, len(m))
+	listed := make(map[string]bool, len(order))
+	for _, k := range order {
+		if _, ok := m[k]; ok && !listed[k] {
+			listed[k] = true
+			keys = append(keys, k)
+		}
+	}
+	var rest []string
+	for k := range m {
+		if !listed[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexValue(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	default:
+		return int(c-'A') + 10
+	}
 }
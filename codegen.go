@@ -70,10 +70,41 @@ type Symbol struct {
 	Name       string
 	Offset     int  // Stack offset for locals
 	IsGlobal   bool
-	IsExternal bool // For libc symbols like stderr, stdout, stdin
+	IsExternal bool // Declared only (extern, or libc's stderr ...): no storage here
 	Size       int
 	Type       string
 	ArraySize  int  // For arrays, 0 if not an array
+	IsStatic   bool   // File-local symbol (static globals and static locals)
+	InitValue  string // Constant initializer; emitted to .data instead of .bss
+	InitFloat  bool   // InitValue is a floating constant
+	InitData   []byte // A brace initializer's bytes (see global_data.go); also emitted to .data
+	InitAddrs  []DataAddress // The addresses among InitData's bytes
+	IsConst    bool   // const-qualified object itself (see const.go)
+	IsVolatile bool   // volatile-qualified object itself (see volatile.go)
+	IsThreadLocal bool // One instance per thread (__thread, see tls.go)
+	HasInit    bool   // Some declaration of this global has an initializer
+	Align      int    // Alignment asked of a global beyond its size's (aligned(N), see attributes.go)
+	Line       int    // Where a local was declared (see unused.go)
+	Column     int
+}
+
+// dataDirective is the directive that writes the symbol's InitValue
+func (sym *Symbol) dataDirective() string {
+	if sym.InitFloat {
+		if sym.Size == 4 {
+			return ".float"
+		}
+		return ".double"
+	}
+	switch sym.Size {
+	case 1:
+		return ".byte"
+	case 2:
+		return ".short"
+	case 4:
+		return ".long"
+	}
+	return ".quad"
 }
 
 type Function struct {
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Compilation cache
+// Compile's assembly depends only on the preprocessed source, the options
+// that steer code generation, and the compiler itself, so it's stored on
+// disk under a hash of those and reused while none of them change. Only the
+// assembly is kept, with the warnings that came with it and the calls that
+// are checked for undefined symbols before linking: it's enough for -S
+// and for linking with gcc, while the built-in assembler, linker and JIT
+// want the emitter's structured output and always compile. -fno-cache turns
+// the cache off; $CCOMPILER_CACHE_DIR moves it.
+
+// compileCacheEntry is what's stored per key
+type compileCacheEntry struct {
+	Assembly string          `json:"assembly"`
+	Warnings []cachedWarning `json:"warnings,omitempty"`
+	Calls    []callSite      `json:"calls,omitempty"`
+	Defined  []string        `json:"defined,omitempty"`
+}
+
+// cachedWarning is a warning as an entry keeps it, with the position in the
+// preprocessed source that Diagnostic's own JSON leaves out
+type cachedWarning struct {
+	Diagnostic
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// compileCacheDir is where entries live, or "" if there's nowhere to put them
+func compileCacheDir() string {
+	if dir := os.Getenv("CCOMPILER_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(base, "ccompiler")
+}
+
+// usesCache reports whether this compile may be answered from the cache
+func (cp *CompilerPipeline) usesCache() bool {
+	o := cp.options
+	return o.Cache && !cp.keepIR && !o.SyntaxOnly && !o.StopAfterIR &&
+		!o.UseNativeBackend && !o.InternalLinker && !o.VerifyNative
+}
+
+// cacheKey hashes everything the assembly depends on
+func (cp *CompilerPipeline) cacheKey() string {
+	h := sha256.New()
+	writeCompilerStamp(h)
+	o := cp.options
+	fmt.Fprintf(h, "O%d inline=%d sibling=%t linear=%t strict=%t wstrict=%t wstrings=%t wimplicit=%t wswitch=%t wconversion=%t wuninit=%t wreturn=%t wmain=%t wvalue=%t wunused=%t,%t,%t werror=%t noredzone=%t omitfp=%t nobits=%t,%t,%t intel=%t annotate=%t sanitize=%t freestanding=%t subset=%t\n",
+		o.OptimizationLevel, o.InlineLimit, o.OptimizeSiblingCalls, o.UseLinearScan, o.StrictAliasing,
+		o.WarnStrictAliasing, o.WarnWriteStrings, o.WarnImplicitFunctionDecl, o.WarnSwitch, o.WarnConversion, o.WarnUninitialized, o.WarnReturnType, o.WarnMain, o.WarnUnusedValue, o.WarnUnusedVariable, o.WarnUnusedFunction, o.WarnUnreachableCode, o.WarningsAsErrors, o.NoRedZone, o.OmitFramePointer, o.NoPopcnt, o.NoLzcnt, o.NoBMI, o.IntelSyntax, o.AnnotateAsm, o.SanitizeLight, o.Freestanding, o.StdSubset)
+	h.Write(cp.target.JSON())
+	if o.HeaderSummaries != "" {
+		if data, err := os.ReadFile(o.HeaderSummaries); err == nil {
+			h.Write(data)
+		}
+	}
+	for _, profile := range cp.profiles {
+		h.Write(profile.JSON())
+	}
+	if o.AnnotateAsm && cp.preprocessor != nil {
+		// The comments name the files each line came from
+		fmt.Fprintf(h, "%s %v\n", o.SourceFile, cp.preprocessor.lineMap)
+	}
+	h.Write([]byte(cp.preprocessed))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeCompilerStamp identifies the compiler build: a rebuilt compiler may
+// generate different output for the same input
+func writeCompilerStamp(w io.Writer) {
+	fmt.Fprintf(w, "ccompiler %s\n", compilerVersion)
+	if exe, err := os.Executable(); err == nil {
+		if info, err := os.Stat(exe); err == nil {
+			fmt.Fprintf(w, "%s %d %d\n", exe, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+}
+
+// loadCached fills in the assembly from the cache, reporting whether there
+// was an entry
+func (cp *CompilerPipeline) loadCached(key string) bool {
+	dir := compileCacheDir()
+	if dir == "" {
+		return false
+	}
+	data, err := os.ReadFile(filepath.Join(dir, key+".json"))
+	if err != nil {
+		return false
+	}
+	var entry compileCacheEntry
+	if json.Unmarshal(data, &entry) != nil {
+		return false
+	}
+	for _, warning := range entry.Warnings {
+		warning.Diagnostic.Line, warning.Diagnostic.Column = warning.Line, warning.Column
+		cp.reportWarning(warning.Diagnostic)
+	}
+	cp.assembly = entry.Assembly
+	cp.calls = entry.Calls
+	cp.defined = make(map[string]bool)
+	for _, name := range entry.Defined {
+		cp.defined[name] = true
+	}
+	return true
+}
+
+// storeCached saves the assembly just generated. Failing to is harmless:
+// the next compile just misses.
+func (cp *CompilerPipeline) storeCached(key string) {
+	dir := compileCacheDir()
+	if dir == "" || os.MkdirAll(dir, 0755) != nil {
+		return
+	}
+	entry := compileCacheEntry{Assembly: cp.assembly, Calls: cp.calls}
+	for name := range cp.defined {
+		entry.Defined = append(entry.Defined, name)
+	}
+	sort.Strings(entry.Defined)
+	for _, warnings := range [][]Diagnostic{cp.checker.warnings, cp.selector.warnings} {
+		for _, warning := range warnings {
+			entry.Warnings = append(entry.Warnings, cachedWarning{warning, warning.Line, warning.Column})
+		}
+	}
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		return
+	}
+	writeCacheFile(dir, key+".json", data)
+}
+
+// writeCacheFile writes data to dir/name aside and renames it into place,
+// so a concurrent compile never reads half an entry
+func writeCacheFile(dir, name string, data []byte) {
+	tmp, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if os.Rename(tmp.Name(), filepath.Join(dir, name)) != nil {
+		os.Remove(tmp.Name())
+	}
+}
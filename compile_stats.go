@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// Compile statistics
+// -stats reports where a compile's time and memory go: how long each phase
+// took and how much it allocated, the token and IR counts that drive them,
+// and the process's peak resident memory. The report goes to stderr once
+// the compile (and link, if there is one) is done.
+
+type compileStats struct {
+	phases    []phaseStat
+	tokens    int // lexed, or taken from the token cache
+	irInstrs  int
+	functions int
+	largest   irSegment // the function with the most IR
+}
+
+type phaseStat struct {
+	name      string
+	elapsed   time.Duration
+	allocated uint64 // bytes allocated during the phase
+}
+
+// phase starts timing the named phase and returns the func that ends it.
+// Nil stats time nothing.
+func (s *compileStats) phase(name string) func() {
+	if s == nil {
+		return func() {}
+	}
+	start := time.Now()
+	before := totalAllocated()
+	return func() {
+		s.phases = append(s.phases, phaseStat{name, time.Since(start), totalAllocated() - before})
+	}
+}
+
+// countIR records the size of the program's IR, split into functions
+func (s *compileStats) countIR(segments []irSegment) {
+	for _, segment := range segments {
+		s.irInstrs += len(segment.Instrs)
+		if segment.Function == "" {
+			continue
+		}
+		s.functions++
+		if len(segment.Instrs) > len(s.largest.Instrs) {
+			s.largest = segment
+		}
+	}
+}
+
+// totalAllocated is how many bytes the process has allocated on the heap
+// so far, freed or not
+func totalAllocated() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.TotalAlloc
+}
+
+func (s *compileStats) print(w io.Writer) {
+	fmt.Fprintln(w, "=== Compile statistics ===")
+	var elapsed time.Duration
+	var allocated uint64
+	for _, phase := range s.phases {
+		fmt.Fprintf(w, "  %-14s %12v %12s allocated\n", phase.name, phase.elapsed.Round(time.Microsecond), formatBytes(phase.allocated))
+		elapsed += phase.elapsed
+		allocated += phase.allocated
+	}
+	fmt.Fprintf(w, "  %-14s %12v %12s allocated\n", "total", elapsed.Round(time.Microsecond), formatBytes(allocated))
+	fmt.Fprintf(w, "  Tokens: %d\n", s.tokens)
+	if s.functions > 0 {
+		fmt.Fprintf(w, "  IR: %d instructions in %d function(s) (largest: %s, %d)\n",
+			s.irInstrs, s.functions, s.largest.Function, len(s.largest.Instrs))
+	}
+	if peak, ok := peakRSS(); ok {
+		fmt.Fprintf(w, "  Peak memory: %s resident\n", formatBytes(peak))
+	}
+}
+
+// formatBytes writes a byte count in the largest unit it has a whole one of
+func formatBytes(n uint64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// peakRSS isn't known without getrusage
+func peakRSS() (uint64, bool) {
+	return 0, false
+}
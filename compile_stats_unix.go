@@ -0,0 +1,21 @@
+//go:build unix
+
+package main
+
+import (
+	"runtime"
+	"syscall"
+)
+
+// peakRSS is the most memory the process has had resident
+func peakRSS() (uint64, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, false
+	}
+	// Linux and the BSDs count kilobytes; macOS counts bytes
+	if runtime.GOOS == "darwin" || runtime.GOOS == "ios" {
+		return uint64(usage.Maxrss), true
+	}
+	return uint64(usage.Maxrss) * 1024, true
+}
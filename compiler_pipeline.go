@@ -1,10 +1,15 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -16,38 +21,117 @@ type CompilerPipeline struct {
 	
 	preprocessor *Preprocessor
 	parser       *Parser
+	checker      *TypeChecker
 	selector     *InstructionSelector
-	allocator    *RegisterAllocator
 	emitter      *CodeEmitter
 	
+	target   *TargetSpec       // Implementation-defined type model (see target_spec.go)
+	profiles []*LibraryProfile // Libraries in effect (see library_profile.go)
+	
+	// Kept for CompileArtifacts
+	keepIR       bool
+	preprocessed string
+	irText       []string
+	
+	// Checked against the libraries before linking (see link_check.go)
+	calls   []callSite
+	defined map[string]bool
+	
+	inits InitFunctions // constructors and destructors (see constructors.go)
+	
+	warnings      []Diagnostic // reported so far, in order
+	fs            SourceFS     // what headers and profiles are read from (nil: the host's)
+	warningOutput io.Writer     // where they're printed (nil: stderr)
+	
+	stats *compileStats // -stats (nil without it; see compile_stats.go)
+	phase string        // the phase running, or the one a failed compile stopped in
+	
 	options CompilerOptions
 }
 
 type CompilerOptions struct {
 	OptimizationLevel int
+	InlineLimit       int      // -finline-limit: largest function (in IR instructions) inlined at -O2
+	OptimizeSiblingCalls bool  // -foptimize-sibling-calls: turn calls in tail position into jumps (default at -O2)
 	DebugInfo         bool
 	Verbose           bool
 	UseLinearScan     bool
 	UseNativeBackend  bool
 	NoPreprocess      bool // Skip preprocessing
-	LibraryFlags      []string // Additional library flags like -lc, -lraylib
+	ExternalCpp       bool // -fexternal-cpp: preprocess with the system's cpp (see external_cpp.go)
+	LibraryFlags      []string // Additional library flags like -lc, -lraylib, and -L directories
+	LinkMap           string   // -Wl,-Map=<file>: write a link map (see linker_map.go)
+	InternalLinker    bool     // Link with the built-in assembler/linker/ELF writer (no gcc)
+	StrictAliasing    bool     // -fstrict-aliasing: allow type-based alias assumptions (off by default)
+	WarnStrictAliasing bool    // -Wstrict-aliasing: report type-punning pointer casts
+	WarnWriteStrings  bool     // -Wwrite-strings: give string literals type const char[]
+	WarnImplicitFunctionDecl bool // -Wimplicit-function-declaration: report calls without a prototype (on by default)
+	WarnSwitch               bool // -Wswitch: report enumerators missing from a switch on an enum without a default (on by default)
+	WarnConversion           bool // -Wconversion: report implicit conversions that may change a value
+	WarnUninitialized        bool // -Wuninitialized: report locals read before they're stored (on by default)
+	WarnReturnType           bool // -Wreturn-type: report returns that don't match the return type, and non-void functions whose end is reached (on by default)
+	WarnMain                 bool // -Wmain: report a main whose signature isn't one C allows (on by default when hosted)
+	WarnUnusedValue          bool // -Wunused-value: report expression statements with no effect (on by default)
+	WarnUnusedVariable       bool // -Wunused-variable: report locals that are never read
+	WarnUnusedFunction       bool // -Wunused-function: report static functions that are never called
+	WarnUnreachableCode      bool // -Wunreachable-code: report code after a return or jump
+	WarningsAsErrors  bool     // -Werror: fail the compile if any warning is reported
+	DiagnosticsJSON   bool     // -fdiagnostics-format=json: report warnings and errors as JSON at the end (see diagnostics_json.go)
+	NoRedZone         bool     // -mno-red-zone: leaf functions reserve their frame like any other
+	OmitFramePointer  bool     // -fomit-frame-pointer: leaf functions don't set up %rbp
+	NoPopcnt          bool     // -mno-popcnt: __builtin_popcount calls libgcc instead of using popcnt
+	NoLzcnt           bool     // -mno-lzcnt: __builtin_clz calls libgcc instead of using lzcnt
+	NoBMI             bool     // -mno-bmi: __builtin_ctz calls libgcc instead of using tzcnt
+	IntelSyntax       bool     // -masm=intel: print Intel-syntax assembly instead of AT&T
+	VerifyNative      bool     // After gcc links, report instructions the internal assembler can't encode
+	Target            string   // -target=: "x86_64" (default) or "arm64"
+	TargetSpec        string   // JSON target spec to load over the built-in one for Target
+	SyntaxOnly        bool        // -fsyntax-only: stop once the source has been checked, before register allocation
+	StopAfterIR       bool        // -emit-ir: stop once the IR has been selected (keeps its text)
+	AnnotateAsm       bool        // -emit-asm-annotated: comment the assembly with the source lines
+	Cache             bool        // Reuse assembly from the on-disk compile cache (on unless -fno-cache)
+	IncludePaths      []string    // -I: searched before the default include paths
+	Macros            []MacroFlag // -D and -U, in command-line order
+	SanitizeLight     bool        // -fsanitize=light: trap on null dereferences and division by zero (see sanitize.go)
+	Freestanding      bool        // -ffreestanding: no libc; a builtin runtime and _start instead (see freestanding.go)
+	StdSubset         bool        // -std=subset: reject code outside the subset known to compile correctly (see subset.go)
+	LibProfiles       []string    // -libprofile: library profiles by name or path (raylib if none given)
+	HeaderSummaries   string      // -header-summaries: header summaries to apply before preprocessing
+	EmitHeaderSummaries string    // -emit-header-summaries: where to save the summaries of included headers
+	HeaderOverlay     string      // -fheader-overlay: headers served from memory, over the disk (see preprocessor_fs.go)
+	SourceFile        string      // Name of the source file, for __FILE__ ("<stdin>" if empty)
+	Stats             bool        // -stats: report each phase's time and allocations, and peak memory
 }
 
 func NewCompilerPipeline(source string, options CompilerOptions) *CompilerPipeline {
-	return &CompilerPipeline{
+	cp := &CompilerPipeline{
 		source:  source,
 		options: options,
 	}
+	if options.Stats {
+		cp.stats = &compileStats{}
+	}
+	return cp
 }
 
-func (cp *CompilerPipeline) Compile() error {
-	var err error
-	
-	if cp.options.Verbose {
-		fmt.Println("=== Compilation Pipeline ===")
+// Preprocess runs phase 0 alone (it's also the first step of Compile) and
+// returns the preprocessed source. -E stops here.
+func (cp *CompilerPipeline) Preprocess() (string, error) {
+	target, err := resolveTarget(cp.options.Target, cp.options.TargetSpec)
+	if err != nil {
+		return "", err
+	}
+	cp.target = target
+	fsys, err := cp.fileSystem()
+	if err != nil {
+		return "", err
+	}
+	profiles, err := loadLibraryProfiles(fsys, cp.options.LibProfiles)
+	if err != nil {
+		return "", err
 	}
+	cp.profiles = profiles
 	
-	// Phase 0: Preprocessing (if not disabled)
 	preprocessedSource := cp.source
 	
 	if !cp.options.NoPreprocess {
@@ -58,10 +142,51 @@ func (cp *CompilerPipeline) Compile() error {
 		
 		// Use our simple preprocessor to handle #include and #define
 		cp.preprocessor = NewPreprocessor()
+		cp.preprocessor.SetFileSystem(fsys)
+		cp.preprocessor.SetTarget(cp.target)
+		if cp.options.Freestanding {
+			cp.preprocessor.Define("__STDC_HOSTED__", "0")
+		}
+		cp.preprocessor.headerCache = cp.options.Cache
+		cp.preprocessor.mainFile = cp.options.SourceFile
+		if cp.options.HeaderSummaries != "" {
+			summaries, err := ReadHeaderSummaries(fsys, cp.options.HeaderSummaries)
+			if err != nil {
+				return "", err
+			}
+			for _, summary := range summaries {
+				cp.preprocessor.ApplyHeaderSummary(summary)
+			}
+		}
+		if len(cp.options.IncludePaths) > 0 {
+			cp.preprocessor.SetIncludePaths(append(append([]string(nil), cp.options.IncludePaths...), cp.preprocessor.includePaths...))
+		}
+		for _, profile := range cp.profiles {
+			cp.preprocessor.SetIncludePaths(append(cp.preprocessor.includePaths, profile.includeDirs()...))
+			for name, value := range profile.Defines {
+				cp.preprocessor.Define(name, value)
+			}
+		}
+		for _, macro := range cp.options.Macros {
+			if macro.Undef {
+				cp.preprocessor.Undefine(macro.Name)
+			} else if err := cp.preprocessor.DefineMacro(macro.Name + " " + macro.Value); err != nil {
+				return "", fmt.Errorf("-D%s: %w", macro.Name, err)
+			}
+		}
 		var err error
-		preprocessedSource, err = cp.preprocessor.Process(cp.source)
+		if cp.options.ExternalCpp {
+			preprocessedSource, err = cp.preprocessor.ProcessExternal(cp.source)
+		} else {
+			preprocessedSource, err = cp.preprocessor.Process(cp.source)
+		}
 		if err != nil {
-			return fmt.Errorf("preprocessing error: %w", err)
+			return "", fmt.Errorf("preprocessing error: %w", err)
+		}
+		if cp.options.EmitHeaderSummaries != "" {
+			if err := WriteHeaderSummaries(cp.options.EmitHeaderSummaries, cp.preprocessor.HeaderSummaries()); err != nil {
+				return "", err
+			}
 		}
 		
 		// Save preprocessed output for debugging
@@ -74,18 +199,79 @@ func (cp *CompilerPipeline) Compile() error {
 		}
 	}
 	
+	cp.preprocessed = preprocessedSource
+	return preprocessedSource, nil
+}
+
+func (cp *CompilerPipeline) Compile() error {
+	if cp.options.Verbose {
+		fmt.Println("=== Compilation Pipeline ===")
+	}
+	
+	// Phase 0: Preprocessing (if not disabled)
+	done := cp.enter("preprocess")
+	preprocessedSource, err := cp.Preprocess()
+	if err != nil {
+		return err
+	}
+	done()
+	
+	// Unchanged since the last compile: reuse its assembly (see compile_cache.go)
+	cacheKey := ""
+	if cp.usesCache() {
+		cacheKey = cp.cacheKey()
+		if cp.loadCached(cacheKey) {
+			if cp.options.Verbose {
+				fmt.Println("\n  Reusing assembly from the compile cache")
+			}
+			return nil
+		}
+	}
+	
 	// Phase 1: Parsing
 	if cp.options.Verbose {
 		fmt.Println("\n[1/5] Parsing...")
 	}
 	start := time.Now()
+	done = cp.enter("parse")
 	
 	// Parser will extract structs, typedefs, and functions from the preprocessed source
 	cp.parser = NewParser(preprocessedSource)
+	cp.parser.target = cp.target
+	if err := cp.declareProfileTypes(); err != nil {
+		return err
+	}
 	cp.ast, err = cp.parser.Parse()
 	if err != nil {
 		return fmt.Errorf("parse error: %w", err)
 	}
+	cp.inits = initFunctions(cp.ast)
+	done()
+	if cp.stats != nil {
+		cp.stats.tokens = cp.parser.tokens.lexed
+	}
+	
+	// Semantic checks before any code is selected (see typecheck.go)
+	done = cp.enter("typecheck")
+	cp.checker = NewTypeChecker(cp.parser)
+	cp.checker.warnImplicitDecl = cp.options.WarnImplicitFunctionDecl
+	cp.checker.warnSwitch = cp.options.WarnSwitch
+	cp.checker.warnReturnType = cp.options.WarnReturnType
+	cp.checker.warnMain = cp.options.WarnMain && !cp.options.Freestanding
+	cp.checker.warnUnusedValue = cp.options.WarnUnusedValue
+	cp.checker.warnConversion = cp.options.WarnConversion
+	cp.checker.subset = cp.options.StdSubset
+	if cp.preprocessor != nil {
+		cp.checker.headerFunctions = cp.preprocessor.functionSigs
+	}
+	err = cp.checker.Check(cp.ast)
+	for _, warning := range cp.checker.warnings {
+		cp.reportWarning(warning)
+	}
+	if err != nil {
+		return fmt.Errorf("type error: %w", err)
+	}
+	done()
 	
 	if cp.options.Verbose {
 		fmt.Printf("  Completed in %v\n", time.Since(start))
@@ -96,11 +282,27 @@ func (cp *CompilerPipeline) Compile() error {
 		fmt.Println("\n[2/5] Instruction Selection...")
 	}
 	start = time.Now()
+	done = cp.enter("select")
 	
 	cp.selector = NewInstructionSelector()
 	cp.selector.structs = cp.parser.structs  // Pass struct definitions FROM PARSER
 	cp.selector.typedefs = cp.parser.typedefs  // Pass typedef aliases FROM PARSER
 	cp.selector.enums = cp.parser.enums  // Pass enum constants FROM PARSER
+	cp.selector.functionPointers = cp.parser.functionPointers
+	cp.selector.strictAliasing = cp.options.StrictAliasing
+	cp.selector.warnStrictAliasing = cp.options.WarnStrictAliasing
+	cp.selector.warnWriteStrings = cp.options.WarnWriteStrings
+	cp.selector.warnUninitialized = cp.options.WarnUninitialized
+	cp.selector.warnReturnType = cp.options.WarnReturnType
+	cp.selector.warnUnusedVariable = cp.options.WarnUnusedVariable
+	cp.selector.warnUnusedFunction = cp.options.WarnUnusedFunction
+	cp.selector.warnUnreachable = cp.options.WarnUnreachableCode
+	cp.selector.optLevel = cp.options.OptimizationLevel
+	cp.selector.target = cp.target
+	cp.selector.noPopcnt = cp.options.NoPopcnt
+	cp.selector.noLzcnt = cp.options.NoLzcnt
+	cp.selector.noBMI = cp.options.NoBMI
+	cp.declareProfileGlobals()
 	
 	// Also add structs from headers (preprocessor)
 	if cp.preprocessor != nil {
@@ -121,6 +323,17 @@ func (cp *CompilerPipeline) Compile() error {
 					Name:    structDef.Name,
 					Members: members,
 					Size:    structDef.Size,
+					Align:   structDef.Align,
+				}
+			}
+		}
+		// A header the parser never saw (a summary's, or one included with
+		// <>) still names its structs by their typedefs: resolve them, so
+		// the signatures below pass and return them as structs
+		for name := range cp.preprocessor.typedefMap {
+			if _, known := cp.selector.typedefs[name]; !known {
+				if _, ok := cp.selector.structs[name]; ok {
+					cp.selector.typedefs[name] = "struct " + name
 				}
 			}
 		}
@@ -129,9 +342,27 @@ func (cp *CompilerPipeline) Compile() error {
 	// Extract function signatures from parsed AST
 	for _, child := range cp.ast.Children {
 		if child.Type == NodeFunction {
+			declOnly := child.Children == nil
+			// ms_abi and noreturn on any declaration hold for all of them
+			msABI := hasAttribute(child.Attributes, "ms_abi")
+			noReturn := hasAttribute(child.Attributes, "noreturn")
+			if known, defined := cp.selector.functions[child.Name]; defined {
+				known.MSABI = known.MSABI || msABI
+				known.NoReturn = known.NoReturn || noReturn
+				if declOnly {
+					continue
+				}
+				msABI, noReturn = known.MSABI, known.NoReturn
+			}
+			// A libc function the program prototypes itself is still external
+			_, libc := libcPrototypes[child.Name]
 			cp.selector.functions[child.Name] = &FunctionSignature{
 				ReturnType: child.ReturnType,
 				ParamTypes: child.ParamTypes,
+				Variadic:   child.IsVariadic,
+				External:   declOnly && libc,
+				MSABI:      msABI,
+				NoReturn:   noReturn,
 			}
 		}
 	}
@@ -145,17 +376,63 @@ func (cp *CompilerPipeline) Compile() error {
 			}
 		}
 	}
+	addLibcPrototypes(cp.selector.functions)
 	
 	err = cp.selector.SelectInstructions(cp.ast)
+	if err == nil {
+		err = cp.selector.lowerThreadLocals(cp.options.Freestanding)
+	}
 	if err != nil {
 		return fmt.Errorf("instruction selection error: %w", err)
 	}
+	if cp.options.WarnUnusedFunction {
+		cp.selector.checkUnusedFunctions(cp.ast)
+	}
+	cp.selector.dropAfterNoReturn()
+	if cp.options.SanitizeLight {
+		cp.selector.insertSanitizerChecks()
+	}
+	cp.selector.layoutColdBlocks()
+	if cp.options.OptimizationLevel >= 2 {
+		cp.selector.inlineCalls(cp.options.InlineLimit)
+	}
+	if cp.options.OptimizeSiblingCalls {
+		cp.selector.markTailCalls()
+	}
+	if cp.options.Freestanding {
+		cp.selector.addFreestandingRuntime()
+	}
+	cp.selector.lowerMemoryOps()
 	cp.ir = cp.selector.instructions
+	cp.attachProvenance(cp.ir)
+	if err := verifyIR(cp.ir, false); err != nil {
+		return err
+	}
+	cp.calls = collectCallSites(cp.ir)
+	cp.defined = definedFunctions(cp.ir)
+	done()
+	if cp.keepIR || cp.options.StopAfterIR {
+		// Allocation rewrites operands in place, so snapshot the text now
+		cp.irText = make([]string, len(cp.ir))
+		for i, instr := range cp.ir {
+			cp.irText[i] = instr.String()
+		}
+	}
+	for _, warning := range cp.selector.warnings {
+		cp.reportWarning(warning)
+	}
+	if warnings := len(cp.checker.warnings) + len(cp.selector.warnings); cp.options.WarningsAsErrors && warnings > 0 {
+		return fmt.Errorf("%d warning(s) %w", warnings, errWarningsAsErrors)
+	}
 	
 	if cp.options.Verbose {
 		fmt.Printf("  Generated %d IR instructions\n", len(cp.ir))
 		fmt.Printf("  Completed in %v\n", time.Since(start))
 	}
+	// The checks that run during selection are part of -fsyntax-only's
+	if cp.options.StopAfterIR || cp.options.SyntaxOnly {
+		return nil
+	}
 	
 	// Phase 3: Register Allocation
 	if cp.options.Verbose {
@@ -163,26 +440,33 @@ func (cp *CompilerPipeline) Compile() error {
 	}
 	start = time.Now()
 	
-	if cp.options.UseLinearScan {
-		lsAlloc := NewLinearScanAllocator(cp.ir)
-		err = lsAlloc.Allocate()
-		if err != nil {
-			return fmt.Errorf("register allocation error: %w", err)
+	// One function at a time (see ir_segments.go)
+	done = cp.enter("regalloc")
+	segments := segmentIR(cp.ir)
+	if cp.stats != nil {
+		cp.stats.countIR(segments)
+	}
+	functions := cp.newFunctionCache()
+	usedRegs := make(map[int]bool)
+	spilled, coalesced := 0, 0
+	for _, segment := range segments {
+		// A function whose assembly is cached isn't allocated, or verified
+		if functions.lookup(segment, cp.selector.frames) {
+			continue
 		}
-	} else {
-		cp.allocator = NewRegisterAllocator(cp.ir)
-		err = cp.allocator.Allocate()
-		if err != nil {
-			return fmt.Errorf("register allocation error: %w", err)
-		}
-		
-		if cp.options.Verbose {
-			usedRegs := cp.allocator.GetUsedRegisters()
-			spilledVars := cp.allocator.GetSpilledVars()
-			fmt.Printf("  Used %d registers\n", len(usedRegs))
-			fmt.Printf("  Spilled %d variables\n", len(spilledVars))
+		if err := cp.allocate(segment, usedRegs, &spilled, &coalesced); err != nil {
+			return err
 		}
 	}
+	done()
+	if cp.options.Verbose && !cp.options.UseLinearScan {
+		fmt.Printf("  Used %d registers\n", len(usedRegs))
+		fmt.Printf("  Spilled %d variables\n", spilled)
+		fmt.Printf("  Coalesced %d moves\n", coalesced)
+	}
+	if cp.options.Verbose && functions != nil {
+		fmt.Printf("  Reused %s\n", functions)
+	}
 	
 	if cp.options.Verbose {
 		fmt.Printf("  Completed in %v\n", time.Since(start))
@@ -193,15 +477,47 @@ func (cp *CompilerPipeline) Compile() error {
 		fmt.Println("\n[4/5] Code Emission...")
 	}
 	start = time.Now()
+	done = cp.enter("emit")
 	
-	cp.emitter = NewCodeEmitter(cp.ir, cp.selector.stringLits, cp.selector.globalVars)
-	cp.assembly = cp.emitter.Emit()
+	if cp.target.Arch == "aarch64" {
+		arm64 := NewARM64Emitter(cp.ir, cp.selector.stringLits, cp.selector.globalVars)
+		arm64.target = cp.target
+		arm64.frames = cp.selector.frames
+		arm64.stringOrder = cp.selector.stringOrder
+		arm64.globalOrder = cp.selector.globalOrder
+		arm64.startStub = cp.options.Freestanding
+		arm64.inits = cp.inits
+		if cp.options.AnnotateAsm {
+			arm64.sourceLines = strings.Split(cp.preprocessed, "\n")
+		}
+		cp.assembly = arm64.Emit()
+	} else {
+		cp.emitter = NewCodeEmitter(cp.ir, cp.selector.stringLits, cp.selector.globalVars)
+		cp.emitter.target = cp.target
+		cp.emitter.frames = cp.selector.frames
+		cp.emitter.noRedZone = cp.options.NoRedZone
+		cp.emitter.omitFrame = cp.options.OmitFramePointer
+		cp.emitter.intelSyntax = cp.options.IntelSyntax
+		cp.emitter.startStub = cp.options.Freestanding
+		cp.emitter.inits = cp.inits
+		cp.emitter.stringOrder = cp.selector.stringOrder
+		cp.emitter.globalOrder = cp.selector.globalOrder
+		cp.emitter.functions = functions
+		if cp.options.AnnotateAsm {
+			cp.emitter.sourceLines = strings.Split(cp.preprocessed, "\n")
+		}
+		cp.assembly = cp.emitter.Emit()
+	}
+	done()
 	
 	if cp.options.Verbose {
 		fmt.Printf("  Generated %d lines of assembly\n", countLines(cp.assembly))
 		fmt.Printf("  Completed in %v\n", time.Since(start))
 	}
 	
+	if cacheKey != "" {
+		cp.storeCached(cacheKey)
+	}
 	return nil
 }
 
@@ -213,6 +529,11 @@ func (cp *CompilerPipeline) WriteAssembly(filename string) error {
 	return os.WriteFile(filename, []byte(cp.assembly), 0644)
 }
 
+// WriteIR writes the IR text kept by -emit-ir, one instruction per line
+func (cp *CompilerPipeline) WriteIR(filename string) error {
+	return os.WriteFile(filename, []byte(strings.Join(cp.irText, "\n")+"\n"), 0644)
+}
+
 func (cp *CompilerPipeline) AssembleAndLink(outputBinary string) error {
 	if cp.options.Verbose {
 		fmt.Println("\n[5/5] Assembly and Linking...")
@@ -229,22 +550,17 @@ func (cp *CompilerPipeline) AssembleAndLink(outputBinary string) error {
 	// Assemble and link with GCC  
 	gccArgs := []string{"-no-pie", asmFile, "-o", outputBinary}
 	
-	// Add Raylib library flags
-	gccArgs = append(gccArgs,
-		"-L/home/lee/Documents/clibs/raylib/src",
-		"-lraylib",
-		"-lm",
-		"-lpthread",
-		"-ldl",
-		"-lrt",
-	)
-	
-	// Add any additional library flags from options
-	if len(cp.options.LibraryFlags) > 0 {
-		gccArgs = append(gccArgs, cp.options.LibraryFlags...)
+	// Library profiles' flags, then those from the command line
+	gccArgs = append(gccArgs, cp.linkFlags()...)
+	if err := cp.checkUndefinedSymbols(gccArgs, !cp.options.Freestanding); err != nil {
+		return err
 	}
 	
-	cmd := exec.Command("gcc", gccArgs...)
+	gcc, err := cp.targetGCC()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(gcc, gccArgs...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "GCC output: %s\n", output)
@@ -259,6 +575,60 @@ func (cp *CompilerPipeline) AssembleAndLink(outputBinary string) error {
 	return nil
 }
 
+// allocate assigns registers to one function's segment, adding what the
+// graph-coloring allocator reports to the counts -v prints
+func (cp *CompilerPipeline) allocate(segment irSegment, usedRegs map[int]bool, spilled, coalesced *int) error {
+	if cp.options.UseLinearScan {
+		lsAlloc := NewLinearScanAllocator(segment.Instrs, cp.selector.frames)
+		if err := lsAlloc.Allocate(); err != nil {
+			return fmt.Errorf("register allocation error: %w", err)
+		}
+	} else {
+		allocator := NewRegisterAllocator(segment.Instrs, cp.selector.frames)
+		if err := allocator.Allocate(); err != nil {
+			return fmt.Errorf("register allocation error: %w", err)
+		}
+		for _, reg := range allocator.GetUsedRegisters() {
+			usedRegs[reg] = true
+		}
+		*spilled += len(allocator.GetSpilledVars())
+		*coalesced += allocator.CoalescedMoves()
+	}
+	return verifyIR(segment.Instrs, true)
+}
+
+// enter records that the named phase is running and starts timing it for
+// -stats; the func it returns ends the timing
+func (cp *CompilerPipeline) enter(name string) func() {
+	cp.phase = name
+	return cp.stats.phase(name)
+}
+
+// Link builds the executable the way the options ask for: with the
+// internal linker, gcc on the native backend's text, or gcc
+func (cp *CompilerPipeline) Link(outputBinary string) error {
+	defer cp.enter("link")()
+	switch {
+	case cp.options.InternalLinker:
+		return cp.LinkInternal(outputBinary)
+	case cp.options.UseNativeBackend:
+		return cp.AssembleAndLinkNative(outputBinary)
+	}
+	return cp.AssembleAndLink(outputBinary)
+}
+
+// targetGCC is the gcc that assembles and links for the target: the host's,
+// or for AArch64 on another machine, a cross gcc
+func (cp *CompilerPipeline) targetGCC() (string, error) {
+	if cp.target.Arch != "aarch64" || runtime.GOARCH == "arm64" {
+		return "gcc", nil
+	}
+	if _, err := exec.LookPath("aarch64-linux-gnu-gcc"); err == nil {
+		return "aarch64-linux-gnu-gcc", nil
+	}
+	return "", fmt.Errorf("no AArch64 gcc to link with (install aarch64-linux-gnu-gcc, or use -S)")
+}
+
 func (cp *CompilerPipeline) AssembleAndLinkNative(outputBinary string) error {
 	if cp.options.Verbose {
 		fmt.Println("\n[5/5] Native Assembly and Linking...")
@@ -280,17 +650,11 @@ func (cp *CompilerPipeline) AssembleAndLinkNative(outputBinary string) error {
 		return fmt.Errorf("failed to write assembly: %w", err)
 	}
 	
-	// Use GCC to assemble and link with Raylib
-	gccArgs := []string{
-		"-no-pie",
-		asmFile,
-		"-o", outputBinary,
-		"-L/home/lee/Documents/clibs/raylib/src",
-		"-lraylib",
-		"-lm",
-		"-lpthread",
-		"-ldl",
-		"-lrt",
+	// Use GCC to assemble and link with the profiles' and user libraries
+	gccArgs := []string{"-no-pie", asmFile, "-o", outputBinary}
+	gccArgs = append(gccArgs, cp.linkFlags()...)
+	if err := cp.checkUndefinedSymbols(gccArgs, !cp.options.Freestanding); err != nil {
+		return err
 	}
 	
 	cmd := exec.Command("gcc", gccArgs...)
@@ -315,6 +679,167 @@ func (cp *CompilerPipeline) AssembleAndLinkNative(outputBinary string) error {
 	return nil
 }
 
+// startStub is the process entry for internally linked and freestanding
+// programs. The kernel starts it with argc at (%rsp), then the argv
+// pointers and a NULL, then the envp pointers and a NULL; it passes
+// main(argc, argv, envp) and hands main's return value to exit(2), running
+// the program's constructors before main and its destructors after (see
+// constructors.go). %rsp is 16-byte aligned on entry, as the calls need it
+// to be. It has no return address, which tells unwinders the stack ends
+// there.
+func startStub(inits InitFunctions) []*MachineInstr {
+	instrs := []*MachineInstr{
+		NewDirective(".text", ""),
+		NewDirective(".globl", "_start"),
+		NewLabel("_start"),
+		NewDirective(".cfi_startproc", ""),
+		NewDirective(".cfi_undefined", fmt.Sprint(dwarfReturnAddress)),
+		NewInstr("xorq", RegOp("rbp"), RegOp("rbp")), // the outermost frame
+	}
+	for _, name := range inits.constructorOrder() {
+		instrs = append(instrs, NewInstr("call", SymOp(name)))
+	}
+	instrs = append(instrs,
+		NewInstr("movq", MemOp("rsp", 0), RegOp("rdi")),
+		NewInstr("leaq", MemOp("rsp", 8), RegOp("rsi")),
+		NewInstr("leaq", MemOp("rsi", 8), RegOp("rdx")),
+		NewInstr("movq", RegOp("rdi"), RegOp("rax")),
+		NewInstr("shlq", ImmOp(3), RegOp("rax")),
+		NewInstr("addq", RegOp("rax"), RegOp("rdx")),
+		NewInstr("call", SymOp("main")),
+		NewInstr("movq", RegOp("rax"), RegOp("rdi")),
+	)
+	if destructors := inits.destructorOrder(); len(destructors) > 0 {
+		// main's result waits in a register the calls keep
+		instrs = append(instrs, NewInstr("movq", RegOp("rax"), RegOp("rbx")))
+		for _, name := range destructors {
+			instrs = append(instrs, NewInstr("call", SymOp(name)))
+		}
+		instrs = append(instrs, NewInstr("movq", RegOp("rbx"), RegOp("rdi")))
+	}
+	return append(instrs,
+		NewInstr("movq", ImmOp(60), RegOp("rax")),
+		NewInstr("syscall"),
+		NewDirective(".cfi_endproc", ""),
+	)
+}
+
+// LinkInternal builds the executable without gcc: the built-in assembler
+// encodes .text, .rodata, .data and .bss, the Linker adds what the -l
+// archives provide (see linker_archive.go), lays it all out and writes the
+// ELF. There is no libc, so calls to other external functions fail as
+// undefined symbols (-ffreestanding supplies a few).
+func (cp *CompilerPipeline) LinkInternal(outputBinary string) error {
+	if cp.options.Verbose {
+		fmt.Println("\n[5/5] Internal Assembly and Linking...")
+	}
+	start := time.Now()
+	
+	// Nothing but the program and the -l archives is linked in
+	if err := cp.checkUndefinedSymbols(cp.options.LibraryFlags, false); err != nil {
+		return err
+	}
+	archives, err := findArchives(cp.options.LibraryFlags)
+	if err != nil {
+		return err
+	}
+	
+	// A freestanding program's stream has the stub already
+	instrs := cp.emitter.MachineInstrs()
+	if !cp.options.Freestanding {
+		instrs = append(instrs, startStub(cp.inits)...)
+	}
+	assembler := NewAssembler()
+	text, err := assembler.AssembleInstrs(instrs)
+	if err != nil {
+		return fmt.Errorf("internal assembly failed: %w", err)
+	}
+	
+	rodata, data, bss := assembler.Sections()
+	
+	linker := NewLinker()
+	linker.AddObject(assembler.Object(cp.options.SourceFile))
+	if err := linker.PullArchives(archives); err != nil {
+		return fmt.Errorf("internal linking failed: %w", err)
+	}
+	linker.SetEntryPoint("_start")
+	
+	binary, err := linker.Link()
+	if err != nil {
+		return fmt.Errorf("internal linking failed: %w", err)
+	}
+	
+	if err := os.WriteFile(outputBinary, binary, 0755); err != nil {
+		return fmt.Errorf("failed to write executable: %w", err)
+	}
+	if cp.options.LinkMap != "" {
+		if err := linker.WriteMapFile(cp.options.LinkMap); err != nil {
+			return fmt.Errorf("failed to write link map: %w", err)
+		}
+	}
+	
+	if cp.options.Verbose {
+		fmt.Printf("  Output: %s\n", outputBinary)
+		fmt.Printf("  .text %d bytes, .rodata %d bytes, .data %d bytes, .bss %d bytes\n",
+			len(text), rodata.Size, data.Size, bss.Size)
+		if len(linker.inputs) > 1 {
+			fmt.Printf("  %d archive members linked\n", len(linker.inputs)-1)
+		}
+		fmt.Printf("  Completed in %v\n", time.Since(start))
+	}
+	
+	return nil
+}
+
+// runBuiltProgram runs the program -run built with args, on this process's
+// stdin, stdout and stderr, and returns the status to exit with: the
+// program's own, or as shells report it, 128 plus the signal that killed it
+func runBuiltProgram(binary string, args []string) (int, error) {
+	if !strings.Contains(binary, "/") {
+		binary = "./" + binary
+	}
+	cmd := exec.Command(binary, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return 0, err
+	}
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", binary, status.Signal())
+		return 128 + int(status.Signal()), nil
+	}
+	return cmd.ProcessState.ExitCode(), nil
+}
+
+// reportWarning prints a warning and keeps it for Warnings (only keeps it
+// with -fdiagnostics-format=json)
+func (cp *CompilerPipeline) reportWarning(warning Diagnostic) {
+	cp.warnings = append(cp.warnings, warning)
+	if cp.options.DiagnosticsJSON {
+		return
+	}
+	out := cp.warningOutput
+	if out == nil {
+		out = os.Stderr
+	}
+	fmt.Fprintf(out, "warning: %s\n", warning)
+}
+
+// Warnings are the warnings the compile reported
+func (cp *CompilerPipeline) Warnings() []Diagnostic {
+	return cp.warnings
+}
+
+// ReportStats prints the -stats report to stderr, if it was asked for
+func (cp *CompilerPipeline) ReportStats() {
+	if cp.stats != nil {
+		cp.stats.print(os.Stderr)
+	}
+}
+
 func countLines(s string) int {
 	count := 0
 	for _, c := range s {
@@ -327,67 +852,58 @@ func countLines(s string) int {
 
 // CLI entry point
 func runCompiler() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: ccompiler <source.c> [options]")
-		fmt.Println("\nOptions:")
-		fmt.Println("  -run          Compile and run immediately")
-		fmt.Println("  -v            Verbose output")
-		fmt.Println("  -O<level>     Optimization level (0-3)")
-		fmt.Println("  -o <file>     Output file (default: a.out)")
-		fmt.Println("  -S            Output assembly only")
-		fmt.Println("  -l<lib>       Link with library (e.g., -lc, -lraylib)")
-		fmt.Println("  -linear-scan  Use linear scan register allocation")
-		fmt.Println("  -native       Use built-in assembler/linker (faster!)")
+	if len(os.Args) > 1 && os.Args[1] == "test" {
+		os.Exit(runTestCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		os.Exit(runBenchCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "subset" {
+		os.Exit(runSubsetCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "raylib-test" {
+		os.Exit(runRaylibTestCommand(os.Args[2:]))
+	}
+	cl, err := parseCommandLine(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	switch {
+	case cl.showHelp:
+		printUsage(os.Stdout)
+		return
+	case cl.showVersion:
+		fmt.Printf("ccompiler %s\n", compilerVersion)
+		return
+	case cl.printTargetSpec:
+		// Needs no source file
+		printTargetSpec(cl.options.Target, cl.options.TargetSpec)
+		return
+	case cl.printLibProfile != "":
+		printLibraryProfile(cl.printLibProfile)
+		return
+	case cl.sourceFile == "":
+		printUsage(os.Stderr)
 		os.Exit(1)
 	}
 	
-	sourceFile := os.Args[1]
-	
-	// Parse options
-	options := CompilerOptions{
-		OptimizationLevel: 0,
-		DebugInfo:         false,
-		Verbose:           false,
-		UseLinearScan:     false,
-		UseNativeBackend:  false,
-		LibraryFlags:      []string{},
-	}
-	
-	runMode := false
-	asmOnly := false
-	outputFile := "a.out"
-	
-	for i := 2; i < len(os.Args); i++ {
-		arg := os.Args[i]
-		switch {
-		case arg == "-run":
-			runMode = true
-		case arg == "-v":
-			options.Verbose = true
-		case arg == "-S":
-			asmOnly = true
-		case arg == "-linear-scan":
-			options.UseLinearScan = true
-		case arg == "-native":
-			options.UseNativeBackend = true
-		case arg == "-o":
-			if i+1 < len(os.Args) {
-				outputFile = os.Args[i+1]
-				i++
-			}
-		case strings.HasPrefix(arg, "-l"):
-			// Library flag: -lc, -lraylib, etc.
-			options.LibraryFlags = append(options.LibraryFlags, arg)
-		case arg == "-O0":
-			options.OptimizationLevel = 0
-		case arg == "-O1":
-			options.OptimizationLevel = 1
-		case arg == "-O2":
-			options.OptimizationLevel = 2
-		case arg == "-O3":
-			options.OptimizationLevel = 3
-		}
+	if cl.watch {
+		runWatch(cl)
+		return
+	}
+	
+	sourceFile := cl.sourceFile
+	options := cl.options
+	options.SourceFile = sourceFile
+	if cl.jitMode {
+		// The JIT needs the emitter's output, not just the assembly
+		options.Cache = false
 	}
+	runMode := cl.runMode
+	jitMode := cl.jitMode
+	asmOnly := cl.asmOnly
+	outputFile := cl.outputFile
 	
 	startTime := time.Now()
 	
@@ -401,15 +917,99 @@ func runCompiler() {
 	// Create compiler
 	compiler := NewCompilerPipeline(string(source), options)
 	
+	if cl.preprocessOnly {
+		preprocessed, err := compiler.Preprocess()
+		if options.DiagnosticsJSON {
+			compiler.WriteDiagnostics(os.Stderr, err)
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Compilation error: %v\n", err)
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+		if outputFile == "" {
+			os.Stdout.WriteString(preprocessed)
+		} else if err := os.WriteFile(outputFile, []byte(preprocessed), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", outputFile, err)
+			os.Exit(1)
+		} else {
+			writeDependencyFile(cl, compiler, outputFile)
+		}
+		return
+	}
+	if cl.symbolIndex {
+		// Positions are reported even if parsing stops partway
+		index, err := BuildSymbolIndex(string(source), options)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Compilation error: %v\n", err)
+		}
+		if outputFile == "" {
+			os.Stdout.Write(index.JSON())
+		} else if err := os.WriteFile(outputFile, index.JSON(), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", outputFile, err)
+			os.Exit(1)
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	if cl.artifacts {
+		// What the stages before a failure produced is written too
+		art, err := CompileArtifacts(string(source), options)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Compilation error: %v\n", err)
+		}
+		if outputFile == "" {
+			os.Stdout.Write(art.JSON())
+		} else if err := os.WriteFile(outputFile, art.JSON(), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", outputFile, err)
+			os.Exit(1)
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	if outputFile == "" {
+		outputFile = "a.out"
+	}
+	
 	// Compile
 	err = compiler.Compile()
-	if err != nil {
+	if options.DiagnosticsJSON {
+		compiler.WriteDiagnostics(os.Stderr, err)
+	} else if err != nil {
 		fmt.Fprintf(os.Stderr, "Compilation error: %v\n", err)
+	}
+	if err != nil {
 		os.Exit(1)
 	}
+	if options.SyntaxOnly || options.StopAfterIR || asmOnly || jitMode {
+		// Nothing to link: the statistics are complete
+		compiler.ReportStats()
+	}
 	
 	compileTime := time.Since(startTime)
 	
+	if options.SyntaxOnly {
+		return
+	}
+	if options.StopAfterIR {
+		irFile := cl.outputFile
+		if irFile == "" {
+			irFile = strings.TrimSuffix(filepath.Base(sourceFile), filepath.Ext(sourceFile)) + ".ir"
+		}
+		if err := compiler.WriteIR(irFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing IR: %v\n", err)
+			os.Exit(1)
+		}
+		writeDependencyFile(cl, compiler, irFile)
+		fmt.Printf("✓ IR generated: %s\n", irFile)
+		fmt.Printf("  Time: %v\n", compileTime)
+		return
+	}
+	
 	if asmOnly {
 		// Output assembly only
 		asmFile := outputFile
@@ -422,6 +1022,7 @@ func runCompiler() {
 			fmt.Fprintf(os.Stderr, "Error writing assembly: %v\n", err)
 			os.Exit(1)
 		}
+		writeDependencyFile(cl, compiler, asmFile)
 		
 		if !runMode {
 			fmt.Printf("✓ Assembly generated: %s\n", asmFile)
@@ -430,11 +1031,32 @@ func runCompiler() {
 		return
 	}
 	
+	// JIT: encode in memory and call main directly, nothing is written
+	if jitMode {
+		if options.Verbose {
+			fmt.Print("\n=== Running Program (JIT) ===\n\n")
+		}
+		exitCode, err := compiler.RunJIT()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "JIT error: %v\n", err)
+			os.Exit(1)
+		}
+		if options.Verbose {
+			fmt.Printf("\n=== Program Finished (exit code %d) ===\n", exitCode)
+		}
+		os.Exit(exitCode)
+	}
+	
 	// Assemble and link
-	if options.UseNativeBackend {
-		err = compiler.AssembleAndLinkNative(outputFile)
-	} else {
-		err = compiler.AssembleAndLink(outputFile)
+	var verifyReport chan *NativeVerifyReport
+	if options.VerifyNative && !options.InternalLinker && !options.UseNativeBackend {
+		// Runs alongside gcc; reported only once the real link succeeds
+		verifyReport = make(chan *NativeVerifyReport, 1)
+		go func() { verifyReport <- compiler.VerifyNative() }()
+	}
+	err = compiler.Link(outputFile)
+	if err == nil && verifyReport != nil {
+		(<-verifyReport).Print(os.Stderr)
 	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -445,6 +1067,8 @@ func runCompiler() {
 		fmt.Fprintf(os.Stderr, "Assembly saved to: %s\n", asmFile)
 		os.Exit(1)
 	}
+	writeDependencyFile(cl, compiler, outputFile)
+	compiler.ReportStats()
 	
 	totalTime := time.Since(startTime)
 	
@@ -457,28 +1081,20 @@ func runCompiler() {
 	// Run if requested
 	if runMode {
 		if options.Verbose {
-			fmt.Println("\n=== Running Program ===\n")
+			fmt.Print("\n=== Running Program ===\n\n")
 		}
 		
-		cmd := exec.Command("./" + outputFile)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		
-		err := cmd.Run()
-		
+		exitCode, err := runBuiltProgram(outputFile, cl.programArgs)
 		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nProgram error: %v\n", err)
+			os.Exit(1)
+		}
+		if exitCode != 0 {
 			if options.Verbose {
 				fmt.Printf("\n=== Program Crashed ===\n")
+				fmt.Fprintf(os.Stderr, "Exit code: %d\n", exitCode)
 			}
-			if exitErr, ok := err.(*exec.ExitError); ok {
-				if options.Verbose {
-					fmt.Fprintf(os.Stderr, "Exit code: %d\n", exitErr.ExitCode())
-				}
-				os.Exit(exitErr.ExitCode())
-			}
-			fmt.Fprintf(os.Stderr, "\nProgram error: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitCode)
 		}
 		
 		if options.Verbose {
@@ -488,7 +1104,8 @@ func runCompiler() {
 		if options.Verbose {
 			fmt.Printf("Total time: %v\n", totalTime)
 		} else {
-			fmt.Printf("\n[Compiled and ran in %v]\n", totalTime)
+			// stderr, so the program's stdout can be piped on its own
+			fmt.Fprintf(os.Stderr, "\n[Compiled and ran in %v]\n", totalTime)
 		}
 	}
 }
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Const correctness
+// Constness is kept in the type strings parseType produces: "const T" for a
+// const object or pointee (const int, const char*) and a trailing " const"
+// for a const pointer (char* const). Symbols record their own constness in
+// IsConst and keep the pointee's in Type. Writing to a const object
+// (directly, through a pointer to const, or to a member of a const struct)
+// is a type error. Converting a pointer to const into a pointer to non-const is a
+// warning, as in gcc. With -Wwrite-strings, string literals are const char
+// arrays, so `char *s = "..."` is reported too. -Werror promotes warnings to
+// errors.
+
+// splitTopConst separates an object's own constness from its type:
+// "char* const" -> ("char*", true), "const int" -> ("const int", true),
+// "const char*" -> ("const char*", false)
+func splitTopConst(typ string) (string, bool) {
+	typ = strings.TrimSpace(typ)
+	if trimmed, ok := strings.CutSuffix(typ, " const"); ok {
+		return trimmed, true
+	}
+	return typ, isConstType(typ)
+}
+
+// isConstType reports whether an object of type typ is itself const. Pointers
+// are const only with a trailing " const"; a leading const is the pointee's.
+func isConstType(typ string) bool {
+	typ = strings.TrimSpace(typ)
+	if strings.HasSuffix(typ, " const") {
+		return true
+	}
+	typ = strings.TrimSuffix(typ, " volatile")
+	if strings.HasSuffix(typ, "*") {
+		return false
+	}
+	for _, word := range strings.Fields(typ) {
+		if word == "const" {
+			return true
+		}
+	}
+	return false
+}
+
+// constPointee returns the type a (possibly const) pointer type points to
+func constPointee(typ string) (string, bool) {
+	return pointeeType(trimTopQualifiers(typ))
+}
+
+// addConst qualifies typ itself: a prefix for objects, a suffix for pointers
+func addConst(typ string) string {
+	if typ == "" || isConstType(typ) {
+		return typ
+	}
+	if strings.HasSuffix(strings.TrimSuffix(typ, " volatile"), "*") {
+		return typ + " const"
+	}
+	return "const " + typ
+}
+
+// exprType works out the C type of an expression from the AST without
+// selecting it, as far as const checks need. "" means unknown.
+func (is *InstructionSelector) exprType(node *ASTNode) string {
+	switch node.Type {
+	case NodeIdentifier:
+		sym, ok := is.localVars[node.VarName]
+		if !ok {
+			sym, ok = is.globalVars[node.VarName]
+		}
+		if !ok {
+			return ""
+		}
+		typ := sym.Type
+		if sym.IsConst {
+			typ = addConst(typ)
+		}
+		if sym.IsVolatile {
+			typ = addVolatile(typ)
+		}
+		if sym.ArraySize > 0 {
+			// Arrays decay to a pointer to their (maybe qualified) elements
+			return typ + "*"
+		}
+		return typ
+	case NodeString:
+		if is.warnWriteStrings {
+			return "const char*"
+		}
+		return "char*"
+	case NodeCast:
+		return node.DataType
+	case NodeCall:
+		if sig, ok := is.functions[node.Name]; ok {
+			return sig.ReturnType
+		}
+	case NodeAssignment:
+		return is.exprType(node.Children[0])
+	case NodeTernary:
+		if len(node.Children) == 3 {
+			return is.exprType(node.Children[1])
+		}
+	case NodeUnaryOp:
+		switch node.Operator {
+		case "*":
+			typ, _ := constPointee(is.exprType(node.Children[0]))
+			return typ
+		case "&":
+			if typ := is.exprType(node.Children[0]); typ != "" {
+				return typ + "*"
+			}
+		}
+	case NodeArrayAccess:
+		typ, _ := constPointee(is.exprType(node.Children[0]))
+		return typ
+	case NodeMemberAccess:
+		baseType := is.exprType(node.Children[0])
+		if node.IsPointer {
+			baseType, _ = constPointee(baseType)
+		}
+		if baseType == "" {
+			return ""
+		}
+		member, err := is.lookupMember(baseType, node.MemberName)
+		if err != nil {
+			return ""
+		}
+		typ := member.Type
+		if isConstType(baseType) {
+			// Members of a const struct are const
+			typ = addConst(typ)
+		}
+		if isVolatileType(baseType) {
+			typ = addVolatile(typ)
+		}
+		if member.ArraySize > 0 {
+			typ += "*"
+		}
+		return typ
+	}
+	return ""
+}
+
+// checkWritable rejects node's write to a const object, of type typ.
+// action names the write ("assignment", "increment", "decrement") as gcc
+// does.
+func (tc *TypeChecker) checkWritable(node *ASTNode, typ, action string) {
+	if !isConstType(typ) {
+		return
+	}
+	target := node.Children[0]
+	what := "read-only location"
+	switch target.Type {
+	case NodeIdentifier:
+		what = fmt.Sprintf("read-only variable '%s'", target.VarName)
+	case NodeMemberAccess:
+		if _, inConst, _ := tc.member(target); inConst {
+			what = fmt.Sprintf("member '%s' in read-only object", target.MemberName)
+		} else {
+			what = fmt.Sprintf("read-only member '%s'", target.MemberName)
+		}
+	}
+	tc.errors = append(tc.errors, tc.locate(node, fmt.Sprintf("%s of %s", action, what)))
+}
+
+// checkConstDiscard warns when value, a pointer to const, is converted to
+// toType, a pointer to non-const. context describes the conversion, e.g.
+// "initialization" or "passing argument 1 of 'f'".
+func (is *InstructionSelector) checkConstDiscard(toType string, value *ASTNode, context string) {
+	toPointee, ok := constPointee(toType)
+	if !ok || isConstType(toPointee) {
+		return
+	}
+	fromType := is.exprType(value)
+	fromPointee, ok := constPointee(fromType)
+	if !ok || !isConstType(fromPointee) {
+		return
+	}
+	is.warn("", is.line, is.column,
+		"in function '%s': %s discards 'const' qualifier from pointer target type ('%s' to '%s')",
+		is.currentFunc, context, fromType, strings.TrimSpace(toType))
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Integer constant expressions
+// Case labels, array dimensions, enum values and #if conditions all need an
+// integer the compiler can work out without running anything: literals and
+// enum constants combined with arithmetic, shifts, bitwise and logical
+// operators, comparisons, ?: and sizeof. evalConstant folds a parsed
+// expression to that integer; each caller says what its identifiers mean
+// (enum constants in the parser and checker; in #if, anything left after
+// macro expansion is 0). Arithmetic is done in 64 bits.
+
+// constLookup gives the value of an identifier in a constant expression
+type constLookup func(name string) (int64, bool)
+
+// evalConstant evaluates an integer constant expression
+func evalConstant(node *ASTNode, lookup constLookup) (int64, error) {
+	switch node.Type {
+	case NodeNumber:
+		return parseIntegerLiteral(node.Value)
+	case NodeSizeof:
+		// The parser's size for an expression's type; the checker refines
+		// it later, but a constant is needed now
+		return int64(node.IntValue), nil
+	case NodeIdentifier:
+		if value, ok := lookup(node.VarName); ok {
+			return value, nil
+		}
+		return 0, fmt.Errorf("'%s' is not a constant", node.VarName)
+	case NodeCast:
+		return evalConstant(node.Children[0], lookup)
+	case NodeUnaryOp:
+		value, err := evalConstant(node.Children[0], lookup)
+		if err != nil {
+			return 0, err
+		}
+		switch node.Operator {
+		case "-":
+			return -value, nil
+		case "+":
+			return value, nil
+		case "~":
+			return ^value, nil
+		case "!":
+			return boolValue(value == 0), nil
+		}
+		return 0, fmt.Errorf("unary '%s' in a constant expression", node.Operator)
+	case NodeTernary:
+		cond, err := evalConstant(node.Children[0], lookup)
+		if err != nil {
+			return 0, err
+		}
+		if cond != 0 {
+			return evalConstant(node.Children[1], lookup)
+		}
+		return evalConstant(node.Children[2], lookup)
+	case NodeBinaryOp:
+		return evalConstantBinary(node, lookup)
+	case NodeCall:
+		return 0, fmt.Errorf("function call '%s' in a constant expression", node.Name)
+	case NodeString:
+		return 0, fmt.Errorf("string literal in an integer constant expression")
+	}
+	return 0, fmt.Errorf("expression is not an integer constant")
+}
+
+func evalConstantBinary(node *ASTNode, lookup constLookup) (int64, error) {
+	left, err := evalConstant(node.Children[0], lookup)
+	if err != nil {
+		return 0, err
+	}
+	// The right operand of && and || isn't evaluated when the left decides,
+	// so (N != 0 && M / N > 2) is fine with N 0
+	switch node.Operator {
+	case "&&":
+		if left == 0 {
+			return 0, nil
+		}
+	case "||":
+		if left != 0 {
+			return 1, nil
+		}
+	}
+	right, err := evalConstant(node.Children[1], lookup)
+	if err != nil {
+		return 0, err
+	}
+	switch node.Operator {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/", "%":
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero in a constant expression")
+		}
+		if node.Operator == "/" {
+			return left / right, nil
+		}
+		return left % right, nil
+	case "<<":
+		return left << uint64(right&63), nil
+	case ">>":
+		return left >> uint64(right&63), nil
+	case "&":
+		return left & right, nil
+	case "|":
+		return left | right, nil
+	case "^":
+		return left ^ right, nil
+	case "&&", "||":
+		return boolValue(right != 0), nil
+	case "==":
+		return boolValue(left == right), nil
+	case "!=":
+		return boolValue(left != right), nil
+	case "<":
+		return boolValue(left < right), nil
+	case ">":
+		return boolValue(left > right), nil
+	case "<=":
+		return boolValue(left <= right), nil
+	case ">=":
+		return boolValue(left >= right), nil
+	}
+	return 0, fmt.Errorf("operator '%s' in a constant expression", node.Operator)
+}
+
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// parseIntegerLiteral reads a decimal, octal, hex or binary literal with
+// any u/l suffixes. Values past the int64 range wrap, as unsigned ones
+// would.
+func parseIntegerLiteral(lexeme string) (int64, error) {
+	digits := strings.TrimRight(lexeme, "uUlL")
+	if value, err := strconv.ParseInt(digits, 0, 64); err == nil {
+		return value, nil
+	}
+	if value, err := strconv.ParseUint(digits, 0, 64); err == nil {
+		return int64(value), nil
+	}
+	return 0, fmt.Errorf("'%s' is not an integer constant", lexeme)
+}
+
+// characterConstant is the value of a character constant, given what's
+// between its quotes (C11 6.4.4.4): an int holding the char, which is
+// signed, or for gcc's multi-character constants ('ab') the chars' bytes,
+// first one highest
+func characterConstant(lexeme string) (int, error) {
+	chars := decodeCString(lexeme)
+	switch len(chars) {
+	case 0:
+		return 0, fmt.Errorf("empty character literal")
+	case 1:
+		return int(int8(chars[0])), nil
+	}
+	var value int32
+	for _, c := range chars {
+		value = value<<8 | int32(c)
+	}
+	return int(value), nil
+}
+
+// isFloatLiteral reports whether a number token is a floating constant:
+// one with a fraction or an exponent
+func isFloatLiteral(lexeme string) bool {
+	if strings.HasPrefix(lexeme, "0x") || strings.HasPrefix(lexeme, "0X") {
+		return strings.ContainsAny(lexeme, ".pP")
+	}
+	return strings.ContainsAny(lexeme, ".eE")
+}
+
+// parseFloatLiteral reads a decimal or hex floating constant (C11 6.4.4.2)
+// and returns its value, spelled as the backend reads constants, and its
+// type: float with an f suffix, whose value is rounded to float, long
+// double with an l suffix (its value is a double's, as it is everywhere
+// else), and double otherwise
+func parseFloatLiteral(lexeme string) (string, string, error) {
+	digits := strings.TrimRight(lexeme, "fFlL")
+	suffix := strings.ToLower(lexeme[len(digits):])
+	value, err := strconv.ParseFloat(digits, 64)
+	if err != nil || len(suffix) > 1 {
+		return "", "", fmt.Errorf("'%s' is not a floating constant", lexeme)
+	}
+	if suffix == "f" {
+		single := float32(value)
+		if math.IsInf(float64(single), 0) {
+			return "", "", fmt.Errorf("floating constant '%s' exceeds the range of float", lexeme)
+		}
+		return formatDouble(float64(single)), "float", nil
+	}
+	if suffix == "l" {
+		return formatDouble(value), "long double", nil
+	}
+	return formatDouble(value), "double", nil
+}
+
+// integerLiteralType is the type of an integer constant (C11 6.4.4.1): the
+// first of int, long that holds its value (unsigned ones too for a hex or
+// octal constant, or only unsigned ones with a U suffix), starting from
+// long with an L suffix
+func integerLiteralType(lexeme string, target *TargetSpec) string {
+	digits := strings.TrimRight(lexeme, "uUlL")
+	suffix := strings.ToLower(lexeme[len(digits):])
+	value, err := strconv.ParseUint(digits, 0, 64)
+	if err != nil {
+		return "int"
+	}
+	decimal := digits == "0" || !strings.HasPrefix(digits, "0")
+	unsigned := strings.Contains(suffix, "u")
+	candidates := []string{"int", "long"}
+	if strings.Contains(suffix, "l") {
+		candidates = candidates[1:]
+	}
+	for _, name := range candidates {
+		width := uint(target.Sizes[name] * 8)
+		if !unsigned && value < 1<<(width-1) {
+			return name
+		}
+		if (unsigned || !decimal) && (width >= 64 || value < 1<<width) {
+			return "unsigned " + name
+		}
+	}
+	return "unsigned long"
+}
+
+// parseConstantExpression parses an integer constant expression at the
+// parser's position, up to but not including a comma, and evaluates it
+// with the enum constants declared so far
+func (p *Parser) parseConstantExpression() (int, error) {
+	expr, err := p.parseTernary()
+	if err != nil {
+		return 0, err
+	}
+	value, err := evalConstant(expr, p.enumConstant)
+	return int(value), err
+}
+
+// parseArrayDimension parses the size between [ and ], which may be
+// omitted (0)
+func (p *Parser) parseArrayDimension() (int, error) {
+	if p.match(RBRACKET) {
+		return 0, nil
+	}
+	line := p.current().Line
+	size, err := p.parseConstantExpression()
+	if err != nil {
+		return 0, fmt.Errorf("array size must be an integer constant at line %d: %w", line, err)
+	}
+	if size < 0 {
+		return 0, fmt.Errorf("array size is negative at line %d", line)
+	}
+	return size, nil
+}
+
+func (p *Parser) enumConstant(name string) (int64, bool) {
+	value, ok := p.enums[name]
+	return int64(value), ok
+}
+
+func (is *InstructionSelector) enumConstant(name string) (int64, bool) {
+	value, ok := is.enums[name]
+	return int64(value), ok
+}
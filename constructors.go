@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Constructors and destructors
+// A function declared __attribute__((constructor)) runs before main, and
+// one declared destructor after main returns (or exit is called), as
+// gcc's do: each is an entry in .init_array or .fini_array, which the C
+// runtime's startup code runs. A priority, constructor(101), orders them:
+// constructors by increasing priority, then those without one in the order
+// they're defined, and destructors the other way around. The entries go in
+// sections named for their priority (.init_array.00101) for the linker to
+// sort, as gcc's do.
+//
+// Without the C runtime there is nothing to run the arrays, so the entry
+// point runs the functions itself, in the same order: the _start stub the
+// internal linker and -ffreestanding use calls the constructors before main
+// and the destructors once it returns (exit, which doesn't know of them,
+// skips them), and -jit calls them around main.
+
+// InitFunction is a constructor or destructor
+type InitFunction struct {
+	Name     string
+	Priority int // 0 if none was given
+}
+
+// InitFunctions are a program's constructors and destructors, each in the
+// order they're defined
+type InitFunctions struct {
+	Constructors []InitFunction
+	Destructors  []InitFunction
+}
+
+// initFunctions finds the constructors and destructors the program
+// defines. The attribute can be on any declaration of the function.
+func initFunctions(program *ASTNode) InitFunctions {
+	attrs := make(map[string][]Attribute)
+	for _, node := range program.Children {
+		if node.Type == NodeFunction {
+			attrs[node.Name] = append(attrs[node.Name], node.Attributes...)
+		}
+	}
+	var inits InitFunctions
+	for _, node := range program.Children {
+		if node.Type != NodeFunction || len(node.Children) == 0 {
+			continue
+		}
+		for _, attr := range attrs[node.Name] {
+			fn := InitFunction{Name: node.Name}
+			fn.Priority, _ = attributeNumber(attr, 0)
+			switch attr.Name {
+			case "constructor":
+				inits.Constructors = append(inits.Constructors, fn)
+			case "destructor":
+				inits.Destructors = append(inits.Destructors, fn)
+			}
+		}
+	}
+	return inits
+}
+
+// constructorOrder is the order the constructors run in
+func (inits InitFunctions) constructorOrder() []string {
+	fns := append([]InitFunction(nil), inits.Constructors...)
+	sort.SliceStable(fns, func(i, j int) bool { return runsBefore(fns[i], fns[j]) })
+	return initNames(fns)
+}
+
+// destructorOrder is the order the destructors run in: the reverse of the
+// constructors'
+func (inits InitFunctions) destructorOrder() []string {
+	fns := append([]InitFunction(nil), inits.Destructors...)
+	sort.SliceStable(fns, func(i, j int) bool { return runsBefore(fns[i], fns[j]) })
+	names := initNames(fns)
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return names
+}
+
+// runsBefore reports whether constructor a runs before b: those with a
+// priority first, lowest first
+func runsBefore(a, b InitFunction) bool {
+	if (a.Priority == 0) != (b.Priority == 0) {
+		return a.Priority != 0
+	}
+	return a.Priority < b.Priority
+}
+
+// initNames are the functions' names
+func initNames(fns []InitFunction) []string {
+	names := make([]string, len(fns))
+	for i, fn := range fns {
+		names[i] = fn.Name
+	}
+	return names
+}
+
+// arraySections are the .init_array and .fini_array entries, each a
+// .section directive, align (the emitter's directive for 8-byte
+// alignment) and a .quad of the function
+func (inits InitFunctions) arraySections(align string) []string {
+	var lines []string
+	for _, array := range []struct {
+		section string
+		fns     []InitFunction
+	}{{".init_array", inits.Constructors}, {".fini_array", inits.Destructors}} {
+		for _, fn := range array.fns {
+			section := array.section
+			if fn.Priority != 0 {
+				section += fmt.Sprintf(".%05d", fn.Priority)
+			}
+			lines = append(lines, fmt.Sprintf(".section %s,\"aw\"", section), align, ".quad "+fn.Name)
+		}
+	}
+	return lines
+}
+
+// emitInitArrays writes the .init_array and .fini_array entries after the
+// program's data
+func (ce *CodeEmitter) emitInitArrays() {
+	for _, line := range ce.inits.arraySections(".align 8") {
+		ce.dataSection.Add(directiveLine(line))
+	}
+}
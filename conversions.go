@@ -0,0 +1,541 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Conversions
+// Every value in a register or temp is in one canonical form for its type,
+// so that most conversions cost nothing: an integer holds its C value in
+// all 64 bits (sign-extended for signed types, zero-extended for unsigned
+// ones, whatever its width), and a floating value is a double, whatever its
+// C type. Only conversions that change that form need code.
+//
+// The checker lowers C's implicit conversions onto the AST: the usual
+// arithmetic conversions bring a binary operator's operands to the type
+// it's computed in, which it records as the operator's DataType (integer
+// promotions included), and initializers, assignments, returns and
+// prototyped arguments convert as if by assignment, as do explicit casts
+// (which leave pointers as they are). An operand whose form changes is
+// wrapped in
+//
+//	NodeCast{Operator: "implicit", DataType: to, Value: from}
+//
+// and a constant is just rewritten. Selection turns those into OpConvert:
+//
+//	convert  dst, src   src from src's DataType to dst's
+//
+// which narrows or extends an integer to dst's width and signedness,
+// converts between integers and doubles (cvtsi2sd, cvttsd2si; an unsigned
+// long above LONG_MAX converts as if signed), or between a double and a
+// float's single-precision bits. The backends compare, divide and shift
+// unsigned operands as unsigned, and results of unsigned int arithmetic wrap
+// to 32 bits. -Wconversion reports the implicit conversions that may change
+// a value; a cast says the change is intended.
+//
+// A float is only single precision where the ABI or memory layout says so.
+// After a load of a 4-byte float member or element, and after a float
+// parameter or result comes in from an XMM register, the value is widened
+// to double; before a store to one, and before a float argument or result
+// goes out in one, it is narrowed back.
+
+// integerName is the canonical name of the size-byte integer type
+func integerName(t *TargetSpec, size int, unsigned bool) string {
+	name := "long"
+	if size <= t.Sizes["int"] {
+		name = "int"
+	}
+	if unsigned {
+		return "unsigned " + name
+	}
+	return name
+}
+
+// promoted applies the integer promotions to typ, a normalized arithmetic
+// type: anything narrower than int becomes int
+func promoted(t *TargetSpec, typ string) string {
+	if isFloatType(typ) {
+		return typ
+	}
+	size, ok := t.SizeOf(typ)
+	if !ok {
+		return typ
+	}
+	if size < t.Sizes["int"] {
+		return "int"
+	}
+	return integerName(t, size, t.IsUnsigned(typ))
+}
+
+// commonType is the type the usual arithmetic conversions bring left and
+// right to (long double is computed as double)
+func commonType(t *TargetSpec, left, right string) string {
+	switch {
+	case left == "long double" || right == "long double" || left == "double" || right == "double":
+		return "double"
+	case left == "float" || right == "float":
+		return "float"
+	}
+	left, right = promoted(t, left), promoted(t, right)
+	if left == right {
+		return left
+	}
+	ls, _ := t.SizeOf(left)
+	rs, _ := t.SizeOf(right)
+	lu, ru := t.IsUnsigned(left), t.IsUnsigned(right)
+	switch {
+	case lu == ru && ls >= rs, lu && ls >= rs:
+		return left
+	case lu == ru, ru && rs >= ls:
+		return right
+	case lu:
+		// The signed type is wider, so it holds every value of the other
+		return right
+	}
+	return left
+}
+
+// changesRepresentation reports whether converting a value between two
+// normalized arithmetic types changes its canonical form
+func changesRepresentation(t *TargetSpec, from, to string) bool {
+	if from == to {
+		return false
+	}
+	switch {
+	case isFloatType(from) && isFloatType(to):
+		// Doubles round to single precision
+		return to == "float"
+	case isFloatType(from) || isFloatType(to):
+		return true
+	}
+	fromSize, ok := t.SizeOf(from)
+	toSize, ok2 := t.SizeOf(to)
+	if !ok || !ok2 {
+		return false
+	}
+	if key, _ := scalarKey(to); key == "_Bool" {
+		return true
+	}
+	if toSize >= 8 {
+		return false
+	}
+	fromUnsigned, toUnsigned := t.IsUnsigned(from), t.IsUnsigned(to)
+	return fromSize > toSize || (fromSize == toSize && fromUnsigned != toUnsigned) || (!fromUnsigned && toUnsigned)
+}
+
+// operationType is the type a binary operator on operands of type left and
+// right is computed in, or "" if either isn't arithmetic
+func (tc *TypeChecker) operationType(op, left, right string) string {
+	left, right = tc.normalizeType(left), tc.normalizeType(right)
+	if tc.kindOf(left) != kindArith || tc.kindOf(right) != kindArith {
+		return ""
+	}
+	switch op {
+	case "&&", "||":
+		return ""
+	case "<<", ">>":
+		return promoted(tc.target, left)
+	}
+	return commonType(tc.target, left, right)
+}
+
+// convertImplicitly lowers the conversion of node's value from type from to
+// type to, if both are arithmetic and its form changes
+func (tc *TypeChecker) convertImplicitly(node *ASTNode, from, to string) {
+	from, to = tc.normalizeType(from), tc.normalizeType(to)
+	if tc.kindOf(from) != kindArith || tc.kindOf(to) != kindArith || !changesRepresentation(tc.target, from, to) {
+		return
+	}
+	if node.Type == NodeNumber && convertConstant(tc.target, node, to) {
+		return
+	}
+	inner := *node
+	*node = ASTNode{
+		Type:     NodeCast,
+		Operator: "implicit",
+		DataType: to,
+		Value:    from,
+		Children: []*ASTNode{&inner},
+		Line:     inner.Line,
+		Column:   inner.Column,
+	}
+}
+
+// convertConstant rewrites a literal as the constant of type to it
+// converts to. ok is false if the literal can't be read.
+func convertConstant(t *TargetSpec, node *ASTNode, to string) (ok bool) {
+	floating := isFloatType(node.DataType)
+	if isFloatType(to) {
+		var value float64
+		if floating {
+			v, err := strconv.ParseFloat(node.Value, 64)
+			if err != nil {
+				return false
+			}
+			value = float64(float32(v))
+		} else {
+			v, err := parseIntegerLiteral(node.Value)
+			if err != nil {
+				return false
+			}
+			value = float64(v)
+		}
+		node.Value = formatDouble(value)
+		node.DataType = "double"
+		return true
+	}
+	var value int64
+	if floating {
+		v, err := strconv.ParseFloat(node.Value, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+		value = int64(v)
+	} else {
+		v, err := parseIntegerLiteral(node.Value)
+		if err != nil {
+			return false
+		}
+		value = v
+	}
+	size, _ := t.SizeOf(to)
+	if key, _ := scalarKey(to); key == "_Bool" {
+		value = boolValue(value != 0)
+	} else if shift := uint(64 - 8*size); shift > 0 {
+		if t.IsUnsigned(to) {
+			value = int64(uint64(value) << shift >> shift)
+		} else {
+			value = value << shift >> shift
+		}
+	}
+	node.Value = strconv.FormatInt(value, 10)
+	node.IntValue = int(value)
+	node.DataType = to
+	return true
+}
+
+// formatDouble spells a double as a floating literal, always with a '.'
+// (2.0e+06, not 2e+06): the backend tells floating immediates from
+// integer ones by it
+func formatDouble(value float64) string {
+	text := strconv.FormatFloat(value, 'g', -1, 64)
+	if strings.ContainsAny(text, ".nN") {
+		return text
+	}
+	if e := strings.IndexAny(text, "eE"); e >= 0 {
+		return text[:e] + ".0" + text[e:]
+	}
+	return text + ".0"
+}
+
+// scalarType is typ without qualifiers, resolved through typedefs, with
+// long double read as double
+func (is *InstructionSelector) scalarType(typ string) string {
+	for i := 0; i < 8; i++ {
+		resolved := is.resolveType(typ)
+		if resolved == typ {
+			break
+		}
+		typ = resolved
+	}
+	var words []string
+	for _, word := range strings.Fields(typ) {
+		switch word {
+		case "const", "volatile", "register", "static", "extern":
+			continue
+		}
+		words = append(words, word)
+	}
+	typ = strings.Join(words, " ")
+	if typ == "long double" {
+		return "double"
+	}
+	return typ
+}
+
+// convert converts value from type from to type to
+func (is *InstructionSelector) convert(value *Operand, from, to string) *Operand {
+	from, to = is.scalarType(from), is.scalarType(to)
+	if !changesRepresentation(is.target, from, to) {
+		return is.typed(value, to)
+	}
+	if to == "float" && isFloatType(from) {
+		// Round through single precision
+		result := is.widen(is.narrow(value))
+		result.DataType = "float"
+		return result
+	}
+	result := is.newTemp()
+	result.DataType = to
+	src := *value
+	src.DataType = from
+	is.emit(OpConvert, result, &src, nil)
+	return result
+}
+
+// typed is value read as type typ, which has the same canonical form
+func (is *InstructionSelector) typed(value *Operand, typ string) *Operand {
+	same := *value
+	same.DataType = typ
+	return &same
+}
+
+// wrap brings the result of integer arithmetic in type typ back to typ's
+// canonical form. Only unsigned types need it: signed overflow is undefined.
+func (is *InstructionSelector) wrap(value *Operand, typ string) *Operand {
+	typ = is.scalarType(typ)
+	size, ok := is.target.SizeOf(typ)
+	if !ok || size >= 8 || isFloatType(typ) || !is.target.IsUnsigned(typ) || strings.HasSuffix(typ, "*") {
+		return value
+	}
+	result := is.newTemp()
+	result.DataType = typ
+	src := *value
+	src.DataType = "unsigned long"
+	is.emit(OpConvert, result, &src, nil)
+	return result
+}
+
+// wrapUnary types and wraps the result of - or ~ on operand, which is
+// computed in operand's promoted type
+func (is *InstructionSelector) wrapUnary(result, operand *Operand) *Operand {
+	typ := is.scalarType(operand.DataType)
+	if _, ok := is.target.SizeOf(typ); !ok || isFloatType(typ) || strings.HasSuffix(typ, "*") {
+		return result
+	}
+	typ = promoted(is.target, typ)
+	result.DataType = typ
+	return is.wrap(result, typ)
+}
+
+// isSingle reports whether typ is C's float
+func (is *InstructionSelector) isSingle(typ string) bool {
+	return strings.TrimPrefix(is.resolveType(typ), "const ") == "float"
+}
+
+// isFloatingType reports whether typ is float or double
+func (is *InstructionSelector) isFloatingType(typ string) bool {
+	switch strings.TrimPrefix(is.resolveType(typ), "const ") {
+	case "float", "double":
+		return true
+	}
+	return false
+}
+
+// widen converts value, a float's single-precision bits, to a double temp
+func (is *InstructionSelector) widen(value *Operand) *Operand {
+	result := is.newTemp()
+	result.DataType = "double"
+	src := *value
+	src.DataType = "float"
+	is.emit(OpConvert, result, &src, nil)
+	return result
+}
+
+// narrow converts value, a double, to a temp holding its single-precision bits
+func (is *InstructionSelector) narrow(value *Operand) *Operand {
+	if value.Type == "imm" && !strings.Contains(value.Value, ".") {
+		value = &Operand{Type: "imm", Value: value.Value + ".0"}
+	}
+	result := is.newTemp()
+	result.DataType = "float"
+	src := *value
+	src.DataType = "double"
+	is.emit(OpConvert, result, &src, nil)
+	return result
+}
+
+// emitConvert converts through %rax and %xmm0
+func (ce *CodeEmitter) emitConvert(dst, src *Operand) {
+	fromFloat, toFloat := isFloating(src), isFloating(dst)
+	if fromFloat && src.DataType == "float" && src.Type != "imm" && src.Type != "temp" && src.Type != "reg" {
+		ce.emit("movss", ce.operand(src), RegOp("xmm0"))
+	} else if fromFloat {
+		ce.loadXMM(src, "xmm0")
+	} else {
+		ce.emit("movq", ce.operand(src), RegOp("rax"))
+	}
+	switch {
+	case fromFloat && toFloat && src.DataType == "float":
+		ce.emit("cvtss2sd", RegOp("xmm0"), RegOp("xmm0"))
+	case fromFloat && toFloat:
+		ce.emit("cvtsd2ss", RegOp("xmm0"), RegOp("xmm0"))
+	case toFloat:
+		ce.emit("cvtsi2sdq", RegOp("rax"), RegOp("xmm0"))
+	case fromFloat:
+		ce.emit("cvttsd2siq", RegOp("xmm0"), RegOp("rax"))
+	}
+	if toFloat {
+		ce.emit("movq", RegOp("xmm0"), ce.operand(dst))
+		return
+	}
+	ce.extendRAX(dst.DataType)
+	ce.emit("movq", RegOp("rax"), ce.operand(dst))
+}
+
+// extendRAX brings %rax to the canonical form of integer type typ
+func (ce *CodeEmitter) extendRAX(typ string) {
+	rax, eax, ax, al := RegOp("rax"), RegOp("eax"), RegOp("ax"), RegOp("al")
+	if key, _ := scalarKey(typ); key == "_Bool" {
+		ce.emit("testq", rax, rax)
+		ce.emit("setne", al)
+		ce.emit("movzbq", al, rax)
+		return
+	}
+	size, _ := ce.target.SizeOf(typ)
+	unsigned := ce.target.IsUnsigned(typ)
+	switch {
+	case size == 1 && unsigned:
+		ce.emit("movzbl", al, eax)
+	case size == 1:
+		ce.emit("movsbq", al, rax)
+	case size == 2 && unsigned:
+		ce.emit("movzwl", ax, eax)
+	case size == 2:
+		ce.emit("movswq", ax, rax)
+	case size == 4 && unsigned:
+		ce.emit("movl", eax, eax)
+	case size == 4:
+		ce.emit("cltq")
+	}
+}
+
+// emitConvert converts through x16 and d16
+func (ae *ARM64Emitter) emitConvert(dst, src *Operand) {
+	fromFloat, toFloat := isFloating(src), isFloating(dst)
+	switch {
+	case fromFloat && toFloat && src.DataType == "float":
+		ae.emit("fmov d16, %s", ae.floatValue(src, "x16"))
+		ae.emit("fcvt d16, s16")
+		ae.emit("fmov x16, d16")
+	case fromFloat && toFloat:
+		ae.emit("fmov d16, %s", ae.floatValue(src, "x16"))
+		ae.emit("fcvt s16, d16")
+		ae.emit("fmov w16, s16")
+	case toFloat:
+		ae.emit("scvtf d16, %s", ae.value(src, "x16"))
+		ae.emit("fmov x16, d16")
+	case fromFloat:
+		ae.emit("fmov d16, %s", ae.floatValue(src, "x16"))
+		ae.emit("fcvtzs x16, d16")
+		ae.extend("x16", dst.DataType)
+	default:
+		if value := ae.value(src, "x16"); value != "x16" {
+			ae.emit("mov x16, %s", value)
+		}
+		ae.extend("x16", dst.DataType)
+	}
+	ae.put(dst, "x16")
+}
+
+// extend brings reg to the canonical form of integer type typ
+func (ae *ARM64Emitter) extend(reg, typ string) {
+	if key, _ := scalarKey(typ); key == "_Bool" {
+		ae.emit("cmp %s, #0", reg)
+		ae.emit("cset %s, ne", reg)
+		return
+	}
+	size, _ := ae.target.SizeOf(typ)
+	unsigned := ae.target.IsUnsigned(typ)
+	switch {
+	case size == 1 && unsigned:
+		ae.emit("uxtb %s, %s", wreg(reg), wreg(reg))
+	case size == 1:
+		ae.emit("sxtb %s, %s", reg, wreg(reg))
+	case size == 2 && unsigned:
+		ae.emit("uxth %s, %s", wreg(reg), wreg(reg))
+	case size == 2:
+		ae.emit("sxth %s, %s", reg, wreg(reg))
+	case size == 4 && unsigned:
+		ae.emit("mov %s, %s", wreg(reg), wreg(reg))
+	case size == 4:
+		ae.emit("sxtw %s, %s", reg, wreg(reg))
+	}
+}
+
+// isSignedInteger reports whether typ is a signed integer type wider than
+// char, whose narrow loads sign-extend
+func isSignedInteger(t *TargetSpec, typ string) bool {
+	key, ok := scalarKey(typ)
+	if !ok || t.IsUnsigned(typ) {
+		return false
+	}
+	switch key {
+	case "short", "int", "long", "long long":
+		return true
+	}
+	return false
+}
+
+// checkPrecision reports, for -Wconversion, an implicit conversion of value
+// from type from to type to that may change it. A constant is only reported
+// if it does change; an explicit cast says the change is intended.
+func (tc *TypeChecker) checkPrecision(node, value *ASTNode, from, to string) {
+	from, to = tc.normalizeType(from), tc.normalizeType(to)
+	if !changesRepresentation(tc.target, from, to) {
+		return
+	}
+	if before, changed, ok := tc.convertedConstant(value, from, to); ok {
+		if changed != before {
+			tc.warnf(node, "-Wconversion", "conversion from '%s' to '%s' changes value from '%s' to '%s'", from, to, before, changed)
+		}
+		return
+	}
+	fromFloat, toFloat := isFloatType(from), isFloatType(to)
+	fromSize, _ := tc.target.SizeOf(from)
+	toSize, _ := tc.target.SizeOf(to)
+	switch {
+	case fromFloat || toFloat:
+		// Every int is exact in a double, but not every long
+		if !fromFloat && to != "float" && fromSize < 8 {
+			return
+		}
+	case fromSize < toSize || (fromSize == toSize && tc.target.IsUnsigned(from) == tc.target.IsUnsigned(to)):
+		if !tc.target.IsUnsigned(from) && tc.target.IsUnsigned(to) {
+			tc.warnf(node, "-Wconversion", "conversion to '%s' from '%s' may change the sign of the result", to, from)
+		}
+		return
+	case fromSize == toSize:
+		tc.warnf(node, "-Wconversion", "conversion to '%s' from '%s' may change the sign of the result", to, from)
+		return
+	}
+	if key, _ := scalarKey(to); key == "_Bool" {
+		return
+	}
+	tc.warnf(node, "-Wconversion", "conversion from '%s' to '%s' may change value", from, to)
+}
+
+// convertedConstant spells value, if it's a constant, before and after
+// conversion from type from to type to
+func (tc *TypeChecker) convertedConstant(value *ASTNode, from, to string) (before, after string, ok bool) {
+	constant := *value
+	if isFloatType(from) {
+		if value.Type != NodeNumber {
+			return "", "", false
+		}
+		before = value.Value
+	} else {
+		n, err := evalConstant(value, func(name string) (int64, bool) {
+			v, ok := tc.enums[name]
+			return int64(v), ok
+		})
+		if err != nil {
+			return "", "", false
+		}
+		before = strconv.FormatInt(n, 10)
+		constant = ASTNode{Type: NodeNumber, Value: before, DataType: from}
+	}
+	if !convertConstant(tc.target, &constant, to) {
+		return "", "", false
+	}
+	after = constant.Value
+	// Compare as numbers: 3 and 3.0 are the same value
+	b, _ := strconv.ParseFloat(before, 64)
+	a, _ := strconv.ParseFloat(after, 64)
+	if a == b {
+		after = before
+	}
+	return before, after, true
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dependency files
+// -MD writes, next to the output, a Make rule saying what the output was
+// built from: the source and every header #include opened, in the order
+// they were opened,
+//
+//	prog: prog.c util.h /usr/include/raylib.h
+//
+// so a Makefile that includes the .d files rebuilds whenever one changes.
+// -MMD leaves out headers found in the system include directories. The
+// rule goes to <output without extension>.d unless -MF names the file, and
+// its target is the output unless -MT names it; -MP adds an empty rule for
+// each header, so deleting one doesn't break the build. Angle-bracket
+// system headers are never read (see Preprocessor.Process), so they never
+// appear. Nothing is written for -E to stdout, -fsyntax-only or -jit,
+// which have no output for the rule to be about.
+
+// systemIncludeDirs are searched for headers after -I and the library
+// profiles' directories
+var systemIncludeDirs = []string{"/usr/include", "/usr/local/include"}
+
+// IncludedFiles are the paths of the files #include opened so far, in the
+// order they were opened
+func (p *Preprocessor) IncludedFiles() []string {
+	return p.includes
+}
+
+// dependencyOptions are -MD and the flags that go with it
+type dependencyOptions struct {
+	write      bool   // -MD or -MMD
+	userOnly   bool   // -MMD: skip headers from the system include directories
+	file       string // -MF
+	target     string // -MT
+	phonyRules bool   // -MP
+}
+
+// writeDependencies writes the rule for output, built from source by
+// compiler, as the options ask
+func writeDependencies(deps dependencyOptions, compiler *CompilerPipeline, source, output string) error {
+	var headers []string
+	if compiler.preprocessor != nil {
+		for _, path := range compiler.preprocessor.IncludedFiles() {
+			if deps.userOnly && isSystemHeader(path) {
+				continue
+			}
+			headers = append(headers, strings.TrimPrefix(path, "./"))
+		}
+	}
+	target := deps.target
+	if target == "" {
+		target = output
+	}
+	file := deps.file
+	if file == "" {
+		file = strings.TrimSuffix(output, filepath.Ext(output)) + ".d"
+	}
+	return os.WriteFile(file, []byte(makeRule(target, source, headers, deps.phonyRules)), 0644)
+}
+
+// writeDependencyFile writes the -MD rule for output, if asked, and exits
+// if that fails
+func writeDependencyFile(cl *commandLine, compiler *CompilerPipeline, output string) {
+	if !cl.deps.write {
+		return
+	}
+	if err := writeDependencies(cl.deps, compiler, cl.sourceFile, output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing dependencies: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// makeRule renders "target: source headers..." with Make's escapes, one
+// prerequisite per continued line past the first, and with phony an empty
+// rule per header
+func makeRule(target, source string, headers []string, phony bool) string {
+	var sb strings.Builder
+	sb.WriteString(escapeMakePath(target) + ": " + escapeMakePath(source))
+	for _, header := range headers {
+		sb.WriteString(" \\\n  " + escapeMakePath(header))
+	}
+	sb.WriteString("\n")
+	if phony {
+		for _, header := range headers {
+			sb.WriteString("\n" + escapeMakePath(header) + ":\n")
+		}
+	}
+	return sb.String()
+}
+
+// escapeMakePath escapes the characters Make would otherwise split or
+// expand a file name on
+func escapeMakePath(path string) string {
+	var sb strings.Builder
+	for _, c := range path {
+		switch c {
+		case ' ', '\t', '#':
+			sb.WriteByte('\\')
+		case '$':
+			sb.WriteByte('$')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// isSystemHeader reports whether path is in one of the system include
+// directories
+func isSystemHeader(path string) bool {
+	for _, dir := range systemIncludeDirs {
+		if strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
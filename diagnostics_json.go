@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// JSON diagnostics
+// -fdiagnostics-format=json reports a compile's warnings and errors as one
+// JSON array on stderr, once the compile is over, instead of a line each as
+// they come, for editors and CI problem matchers to read:
+//
+//	[{"file": "game.c",
+//	  "range": {"start": {"line": 12, "column": 5}, "end": {"line": 12, "column": 11}},
+//	  "severity": "warning",
+//	  "code": "-Wswitch",
+//	  "message": "in function 'draw': enumeration value 'BLUE' not handled in switch"}]
+//
+// Positions are mapped back through the preprocessor to the file and line
+// they came from. A diagnostic that knows its column covers the word (or
+// character) there; one that knows only its line, as most errors do, covers
+// all of it, and one that knows neither has no range. A warning's code is the -W option that controls it, given
+// where the warning is made; under -Werror the warnings are errors, coded
+// -Werror=..., in place of the error counting them. Other errors have no
+// code, and a parse error listing several is one diagnostic each.
+
+// SourceRange is the text a diagnostic is about, end exclusive
+type SourceRange struct {
+	Start SourcePoint `json:"start"`
+	End   SourcePoint `json:"end"`
+}
+
+// SourcePoint is a position in a file; lines and columns count from 1
+type SourcePoint struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// errWarningsAsErrors fails a compile that reported warnings under -Werror
+var errWarningsAsErrors = errors.New("treated as errors (-Werror)")
+
+// diagnosticLocation splits a message into its line, column (if known)
+// and the rest
+var diagnosticLocation = regexp.MustCompile(`^line (\d+)(?:, column (\d+))?: (.*)$`)
+
+// errorStage is the stage a failed compile's error starts with
+var errorStage = regexp.MustCompile(`^[a-z/ ]*error: `)
+
+// errorItem is one of the errors a parse error lists
+var errorItem = regexp.MustCompile(`^\s*\[\d+\] (.*)$`)
+
+// Diagnostics are the compile's warnings and err, the error it failed with
+// (nil if it didn't), as -fdiagnostics-format=json reports them
+func (cp *CompilerPipeline) Diagnostics(err error) []Diagnostic {
+	lines := make(map[string][]string) // the files read for the length of a line
+	diagnostics := []Diagnostic{}
+	for _, d := range cp.warnings {
+		if cp.options.WarningsAsErrors {
+			d.Severity = "error"
+			if d.Code != "" {
+				d.Code = "-Werror=" + strings.TrimPrefix(d.Code, "-W")
+			}
+		}
+		diagnostics = append(diagnostics, cp.place(d, lines))
+	}
+	if err == nil || errors.Is(err, errWarningsAsErrors) {
+		return diagnostics
+	}
+
+	message := errorStage.ReplaceAllString(err.Error(), "")
+	var items []string
+	for _, line := range strings.Split(message, "\n") {
+		if m := errorItem.FindStringSubmatch(line); m != nil {
+			items = append(items, m[1])
+		}
+	}
+	if items == nil {
+		items = []string{message}
+	}
+	for _, item := range items {
+		d := Diagnostic{Severity: "error", Stage: cp.failedStage(), Message: item}
+		if m := diagnosticLocation.FindStringSubmatch(item); m != nil {
+			d.Line, _ = strconv.Atoi(m[1])
+			d.Column, _ = strconv.Atoi(m[2])
+			d.Message = m[3]
+		}
+		diagnostics = append(diagnostics, cp.place(d, lines))
+	}
+	return diagnostics
+}
+
+// place fills in d's file and range from its line and column
+func (cp *CompilerPipeline) place(d Diagnostic, lines map[string][]string) Diagnostic {
+	d.File = cp.options.SourceFile
+	if d.Line <= 0 {
+		return d
+	}
+	pos := cp.sourcePos(d.Line)
+	d.File = pos.File
+	text := []rune(cp.sourceLine(pos, lines))
+	start, end := SourcePoint{pos.Line, 1}, SourcePoint{pos.Line, len(text) + 1}
+	if d.Column > 0 {
+		start.Column, end.Column = d.Column, d.Column+1
+		for end.Column <= len(text) && isWordRune(text[start.Column-1]) && isWordRune(text[end.Column-1]) {
+			end.Column++
+		}
+	}
+	d.Range = &SourceRange{start, end}
+	return d
+}
+
+// isWordRune says whether r can be part of an identifier or number
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// sourceLine is the text of the line at pos, or "" if it can't be read
+func (cp *CompilerPipeline) sourceLine(pos SourcePos, lines map[string][]string) string {
+	text, ok := lines[pos.File]
+	if !ok {
+		if pos.File == cp.options.SourceFile {
+			text = strings.Split(cp.source, "\n")
+		} else if content, err := os.ReadFile(pos.File); err == nil {
+			text = strings.Split(string(content), "\n")
+		}
+		lines[pos.File] = text
+	}
+	if pos.Line < 1 || pos.Line > len(text) {
+		return ""
+	}
+	return strings.TrimRight(text[pos.Line-1], "\r")
+}
+
+// WriteDiagnostics prints the compile's diagnostics to out as a JSON array
+func (cp *CompilerPipeline) WriteDiagnostics(out io.Writer, err error) {
+	data, _ := json.MarshalIndent(cp.Diagnostics(err), "", "  ")
+	out.Write(append(data, '\n'))
+}
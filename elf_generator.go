@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"encoding/binary"
 )
 
 // ELF Generator - Creates ELF64 executable files
@@ -18,6 +17,11 @@ type ELFGenerator struct {
 	rodataData     []byte
 	dataData       []byte
 	bssSize        uint64
+	bssAlign       uint64 // where .bss starts after .data; 1 if unset
+	ehFrameData    []byte // call frame information (see unwind.go), after .rodata
+	ehFrameHdr     []byte
+	
+	enc            ByteEncoder
 }
 
 // ELF64 Header
@@ -104,8 +108,9 @@ const (
 
 // Program header types
 const (
-	PT_NULL = 0
-	PT_LOAD = 1
+	PT_NULL         = 0
+	PT_LOAD         = 1
+	PT_GNU_EH_FRAME = 0x6474e550
 )
 
 // Program header flags
@@ -121,6 +126,7 @@ func NewELFGenerator() *ELFGenerator {
 		symbolTable: make([]ELF64Symbol, 0),
 		stringTable: []byte{0},
 		shstrtab:    []byte{0},
+		enc:         encoderX86_64,
 	}
 }
 
@@ -131,6 +137,13 @@ func (e *ELFGenerator) SetCode(textData, rodataData, dataData []byte, bssSize ui
 	e.bssSize = bssSize
 }
 
+// SetUnwind sets .eh_frame and .eh_frame_hdr, which go in the read-only
+// segment after .rodata
+func (e *ELFGenerator) SetUnwind(frame, hdr []byte) {
+	e.ehFrameData = frame
+	e.ehFrameHdr = hdr
+}
+
 func (e *ELFGenerator) AddSymbol(name string, value uint64, size uint64, section uint16, binding byte, symType byte) {
 	nameOffset := e.addString(name)
 	
@@ -148,36 +161,130 @@ func (e *ELFGenerator) AddSymbol(name string, value uint64, size uint64, section
 	e.symbolTable = append(e.symbolTable, sym)
 }
 
-func (e *ELFGenerator) Generate(entryPoint uint64) ([]byte, error) {
-	buf := new(bytes.Buffer)
-	
-	// Base address for executable
-	baseAddr := uint64(0x400000)
+// ELFLayout gives the file offset and virtual address of each loadable section
+// Each segment starts on its own page so its permissions don't leak onto
+// neighbouring sections (text R+X, rodata R, data/bss R+W)
+type ELFLayout struct {
+	NumPH        int
+	TextOffset   uint64
+	TextAddr     uint64
+	RodataOffset uint64
+	RodataAddr   uint64
+	RodataEnd    uint64 // file offset of the read-only segment's end
+	EhFrameHdrOffset uint64
+	EhFrameHdrAddr   uint64
+	EhFrameOffset    uint64
+	EhFrameAddr      uint64
+	DataOffset   uint64
+	DataAddr     uint64
+	BssAddr      uint64
+}
+
+const elfBaseAddr = uint64(0x400000)
+const elfPageSize = uint64(0x1000)
+
+func alignUp(v, align uint64) uint64 {
+	return (v + align - 1) &^ (align - 1)
+}
+
+// Layout computes section placement for the current section sizes
+func (e *ELFGenerator) Layout() ELFLayout {
+	var l ELFLayout
 	
 	// Calculate number of program headers needed
-	numPH := 2 // text + data always
+	l.NumPH = 2 // text + data always
+	if e.hasReadOnly() {
+		l.NumPH++
+	}
+	if len(e.ehFrameData) > 0 {
+		l.NumPH++ // PT_GNU_EH_FRAME
+	}
+	
+	headerSize := uint64(64)       // ELF header
+	phSize := uint64(56 * l.NumPH) // program headers follow the ELF header
+	
+	l.TextOffset = headerSize + phSize
+	l.TextAddr = elfBaseAddr + l.TextOffset
+	textEnd := l.TextOffset + uint64(len(e.textData))
+	
+	l.RodataOffset = alignUp(textEnd, elfPageSize)
+	l.RodataAddr = elfBaseAddr + l.RodataOffset
+	rodataEnd := textEnd
+	if e.hasReadOnly() {
+		rodataEnd = l.RodataOffset + uint64(len(e.rodataData))
+	}
+	if len(e.ehFrameData) > 0 {
+		l.EhFrameHdrOffset = alignUp(rodataEnd, 4)
+		l.EhFrameHdrAddr = elfBaseAddr + l.EhFrameHdrOffset
+		l.EhFrameOffset = alignUp(l.EhFrameHdrOffset+uint64(len(e.ehFrameHdr)), 8)
+		l.EhFrameAddr = elfBaseAddr + l.EhFrameOffset
+		rodataEnd = l.EhFrameOffset + uint64(len(e.ehFrameData))
+	}
+	l.RodataEnd = rodataEnd
+	
+	l.DataOffset = alignUp(rodataEnd, elfPageSize)
+	l.DataAddr = elfBaseAddr + l.DataOffset
+	l.BssAddr = alignUp(l.DataAddr+uint64(len(e.dataData)), max(e.bssAlign, 1))
+	return l
+}
+
+// hasReadOnly reports whether there's a read-only segment: .rodata or the
+// unwind tables
+func (e *ELFGenerator) hasReadOnly() bool {
+	return len(e.rodataData) > 0 || len(e.ehFrameData) > 0
+}
+
+// SectionIndex returns the section header index for a named section
+// Empty optional sections are omitted from the header table
+func (e *ELFGenerator) SectionIndex(name string) uint16 {
+	idx := uint16(1) // .text
+	if name == "text" {
+		return idx
+	}
 	if len(e.rodataData) > 0 {
-		numPH = 3
+		idx++
+		if name == "rodata" {
+			return idx
+		}
+	}
+	if len(e.ehFrameData) > 0 {
+		idx += 2 // .eh_frame_hdr, .eh_frame
+	}
+	if len(e.dataData) > 0 {
+		idx++
+		if name == "data" {
+			return idx
+		}
 	}
+	if e.bssSize > 0 {
+		idx++
+		if name == "bss" {
+			return idx
+		}
+	}
+	return SHN_UNDEF
+}
+
+func (e *ELFGenerator) Generate(entryPoint uint64) ([]byte, error) {
+	buf := new(bytes.Buffer)
 	
-	// Calculate offsets
-	headerSize := uint64(64)                              // ELF header
-	phOffset := headerSize                                 // program headers start after ELF header
-	phSize := uint64(56 * numPH)                          // program headers
+	layout := e.Layout()
+	numPH := layout.NumPH
+	phOffset := uint64(64) // program headers start after ELF header
 	
-	textOffset := phOffset + phSize
-	textAddr := baseAddr + textOffset
+	textOffset := layout.TextOffset
+	textAddr := layout.TextAddr
 	textSize := uint64(len(e.textData))
 	
-	rodataOffset := textOffset + textSize
-	rodataAddr := baseAddr + rodataOffset
+	rodataOffset := layout.RodataOffset
+	rodataAddr := layout.RodataAddr
 	rodataSize := uint64(len(e.rodataData))
 	
-	dataOffset := rodataOffset + rodataSize
-	dataAddr := baseAddr + dataOffset
+	dataOffset := layout.DataOffset
+	dataAddr := layout.DataAddr
 	dataSize := uint64(len(e.dataData))
 	
-	bssAddr := dataAddr + dataSize
+	bssAddr := layout.BssAddr
 	
 	// Build section headers first to know how many we have
 	e.buildSections(textOffset, textSize, textAddr,
@@ -206,8 +313,8 @@ func (e *ELFGenerator) Generate(entryPoint uint64) ([]byte, error) {
 	// Create ELF header
 	e.header = ELF64Header{
 		Magic:      [4]byte{0x7F, 'E', 'L', 'F'},
-		Class:      2,
-		Data:       1,
+		Class:      e.enc.ELFClass(),
+		Data:       e.enc.ELFData(),
 		Version:    1,
 		OSABI:      0,
 		ABIVersion: 0,
@@ -227,7 +334,7 @@ func (e *ELFGenerator) Generate(entryPoint uint64) ([]byte, error) {
 	}
 	
 	// Write ELF header
-	binary.Write(buf, binary.LittleEndian, &e.header)
+	e.enc.WriteStruct(buf, &e.header)
 	
 	// Write program headers
 	e.writeProgramHeaders(buf, textOffset, textSize, textAddr,
@@ -239,10 +346,20 @@ func (e *ELFGenerator) Generate(entryPoint uint64) ([]byte, error) {
 	
 	// Write .rodata section
 	if len(e.rodataData) > 0 {
+		padTo(buf, rodataOffset)
 		buf.Write(e.rodataData)
 	}
 	
+	// Write the unwind tables
+	if len(e.ehFrameData) > 0 {
+		padTo(buf, layout.EhFrameHdrOffset)
+		buf.Write(e.ehFrameHdr)
+		padTo(buf, layout.EhFrameOffset)
+		buf.Write(e.ehFrameData)
+	}
+	
 	// Write .data section
+	padTo(buf, dataOffset)
 	if len(e.dataData) > 0 {
 		buf.Write(e.dataData)
 	}
@@ -258,12 +375,19 @@ func (e *ELFGenerator) Generate(entryPoint uint64) ([]byte, error) {
 	
 	// Write section headers
 	for _, section := range e.sections {
-		binary.Write(buf, binary.LittleEndian, &section)
+		e.enc.WriteStruct(buf, &section)
 	}
 	
 	return buf.Bytes(), nil
 }
 
+// padTo zero-fills the buffer up to a file offset
+func padTo(buf *bytes.Buffer, offset uint64) {
+	for uint64(buf.Len()) < offset {
+		buf.WriteByte(0)
+	}
+}
+
 func (e *ELFGenerator) buildSections(textOff, textSize, textAddr,
 	rodataOff, rodataSize, rodataAddr,
 	dataOff, dataSize, dataAddr,
@@ -304,6 +428,29 @@ func (e *ELFGenerator) buildSections(textOff, textSize, textAddr,
 		})
 	}
 	
+	// .eh_frame_hdr and .eh_frame sections
+	if len(e.ehFrameData) > 0 {
+		layout := e.Layout()
+		e.sections = append(e.sections, ELF64Section{
+			Name:      e.addShString(".eh_frame_hdr"),
+			Type:      SHT_PROGBITS,
+			Flags:     SHF_ALLOC,
+			Addr:      layout.EhFrameHdrAddr,
+			Offset:    layout.EhFrameHdrOffset,
+			Size:      uint64(len(e.ehFrameHdr)),
+			AddrAlign: 4,
+		})
+		e.sections = append(e.sections, ELF64Section{
+			Name:      e.addShString(".eh_frame"),
+			Type:      SHT_PROGBITS,
+			Flags:     SHF_ALLOC,
+			Addr:      layout.EhFrameAddr,
+			Offset:    layout.EhFrameOffset,
+			Size:      uint64(len(e.ehFrameData)),
+			AddrAlign: 8,
+		})
+	}
+	
 	// .data section
 	if dataSize > 0 {
 		e.sections = append(e.sections, ELF64Section{
@@ -331,7 +478,7 @@ func (e *ELFGenerator) buildSections(textOff, textSize, textAddr,
 			Size:      bssSize,
 			Link:      0,
 			Info:      0,
-			AddrAlign: 8,
+			AddrAlign: max(e.bssAlign, 8),
 			EntSize:   0,
 		})
 	}
@@ -398,21 +545,22 @@ func (e *ELFGenerator) writeProgramHeaders(buf *bytes.Buffer,
 		MemSz:  textOff + textSize,
 		Align:  0x1000,
 	}
-	binary.Write(buf, binary.LittleEndian, &textPH)
+	e.enc.WriteStruct(buf, &textPH)
 	
-	// Rodata segment (readable) - only if we have rodata
-	if rodataSize > 0 {
+	// Rodata segment (readable) - only if we have rodata or unwind tables
+	layout := e.Layout()
+	if e.hasReadOnly() {
 		rodataPH := ELF64ProgramHeader{
 			Type:   PT_LOAD,
 			Flags:  PF_R,
 			Offset: rodataOff,
 			VAddr:  rodataAddr,
 			PAddr:  rodataAddr,
-			FileSz: rodataSize,
-			MemSz:  rodataSize,
+			FileSz: layout.RodataEnd - rodataOff,
+			MemSz:  layout.RodataEnd - rodataOff,
 			Align:  0x1000,
 		}
-		binary.Write(buf, binary.LittleEndian, &rodataPH)
+		e.enc.WriteStruct(buf, &rodataPH)
 	}
 	
 	// Data+BSS segment (readable + writable)
@@ -423,10 +571,25 @@ func (e *ELFGenerator) writeProgramHeaders(buf *bytes.Buffer,
 		VAddr:  dataAddr,
 		PAddr:  dataAddr,
 		FileSz: dataSize,
-		MemSz:  dataSize + bssSize,
+		MemSz:  bssAddr + bssSize - dataAddr,
 		Align:  0x1000,
 	}
-	binary.Write(buf, binary.LittleEndian, &dataPH)
+	e.enc.WriteStruct(buf, &dataPH)
+	
+	// Where unwinders find the .eh_frame_hdr
+	if len(e.ehFrameData) > 0 {
+		ehPH := ELF64ProgramHeader{
+			Type:   PT_GNU_EH_FRAME,
+			Flags:  PF_R,
+			Offset: layout.EhFrameHdrOffset,
+			VAddr:  layout.EhFrameHdrAddr,
+			PAddr:  layout.EhFrameHdrAddr,
+			FileSz: uint64(len(e.ehFrameHdr)),
+			MemSz:  uint64(len(e.ehFrameHdr)),
+			Align:  4,
+		}
+		e.enc.WriteStruct(buf, &ehPH)
+	}
 }
 
 func (e *ELFGenerator) buildSymbolTable() []byte {
@@ -434,11 +597,11 @@ func (e *ELFGenerator) buildSymbolTable() []byte {
 	
 	// First symbol is always null
 	nullSym := ELF64Symbol{}
-	binary.Write(buf, binary.LittleEndian, &nullSym)
+	e.enc.WriteStruct(buf, &nullSym)
 	
 	// Write actual symbols
 	for _, sym := range e.symbolTable {
-		binary.Write(buf, binary.LittleEndian, &sym)
+		e.enc.WriteStruct(buf, &sym)
 	}
 	
 	return buf.Bytes()
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// External preprocessor
+// -fexternal-cpp preprocesses with the system's cpp instead of ours, for
+// headers ours can't handle yet. It sees the source as ours would:
+//
+//	macros     ours, all of them: the predefined ones, the target's, the
+//	           library profiles', -D and -U, from a prelude (-undef -include)
+//	includes   "..." from the including file's directory, then -I, ".",
+//	           and the profiles' directories (-iquote)
+//	<...>      empty, as ours skips them, from a directory of stubs
+//	           (-nostdinc -isystem); <assert.h> defines our assert
+//
+// cpp stops at the first header it can't find, so each stub is made when
+// cpp asks for it and cpp run again. Its line markers are taken out of the
+// output, and tell which lines came from where and which headers were read
+// (for -MD); its warnings are only shown if it fails.
+
+// cppMissingHeader finds the header cpp couldn't find in its errors
+var cppMissingHeader = regexp.MustCompile(`fatal error: (\S+): No such file or directory`)
+
+// cppLineMarker is a line marker in cpp's output: # line "file" flags
+var cppLineMarker = regexp.MustCompile(`^# (\d+) "((?:[^"\\]|\\.)*)"(.*)$`)
+
+// cppBuiltinMacros are computed by cpp itself as they are by us
+var cppBuiltinMacros = map[string]bool{"__FILE__": true, "__LINE__": true, "__DATE__": true, "__TIME__": true}
+
+// ProcessExternal preprocesses source with the system's cpp
+func (p *Preprocessor) ProcessExternal(source string) (string, error) {
+	work, err := os.MkdirTemp("", "ccompiler-cpp-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(work)
+	stubs := filepath.Join(work, "include")
+	if err := os.MkdirAll(stubs, 0755); err != nil {
+		return "", err
+	}
+	prelude := filepath.Join(work, "prelude.h")
+	if err := os.WriteFile(prelude, []byte(p.macroPrelude()), 0644); err != nil {
+		return "", err
+	}
+
+	// The main source says what it's called, for __FILE__ and the markers
+	main := p.currentFile()
+	args := []string{"-E", "-undef", "-nostdinc", "-include", prelude}
+	if main != "<stdin>" {
+		args = append(args, "-iquote", filepath.Dir(main))
+	}
+	for _, dir := range p.includePaths {
+		if !isSystemIncludeDir(dir) {
+			args = append(args, "-iquote", dir)
+		}
+	}
+	args = append(args, "-isystem", stubs, "-")
+	input := fmt.Sprintf("# 1 %s\n%s", strconv.Quote(main), strings.TrimPrefix(source, utf8BOM))
+
+	for made := map[string]bool{}; ; {
+		cmd := exec.Command("cpp", args...)
+		cmd.Env = append(os.Environ(), "LC_ALL=C")
+		cmd.Stdin = strings.NewReader(input)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		err := cmd.Run()
+		if err == nil {
+			return p.readCppOutput(stdout.String(), main, work), nil
+		}
+		missing := cppMissingHeader.FindStringSubmatch(stderr.String())
+		if missing == nil || made[missing[1]] || filepath.IsAbs(missing[1]) || strings.Contains(missing[1], "..") {
+			if stderr.Len() > 0 {
+				return "", fmt.Errorf("cpp failed:\n%s", strings.TrimRight(stderr.String(), "\n"))
+			}
+			return "", fmt.Errorf("cpp failed: %w", err)
+		}
+		made[missing[1]] = true
+		if err := writeHeaderStub(filepath.Join(stubs, missing[1]), missing[1]); err != nil {
+			return "", err
+		}
+	}
+}
+
+// macroPrelude defines the macros in effect, for cpp to start from
+func (p *Preprocessor) macroPrelude() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var lines []string
+	for name, value := range p.defines {
+		if !cppBuiltinMacros[name] {
+			lines = append(lines, fmt.Sprintf("#undef %s\n#define %s %s", name, name, value))
+		}
+	}
+	for name, macro := range p.funcMacros {
+		params := append([]string(nil), macro.Params...)
+		if macro.Variadic {
+			params = append(params, "...")
+		}
+		lines = append(lines, fmt.Sprintf("#undef %s\n#define %s(%s) %s", name, name, strings.Join(params, ", "), macro.Body))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// writeHeaderStub makes the empty stand-in for a system header
+func writeHeaderStub(path, name string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	content := ""
+	if name == "assert.h" {
+		content = fmt.Sprintf("#undef assert\n#ifdef NDEBUG\n#define assert(e) %s\n#else\n#define assert(e) %s\n#endif\n",
+			assertMacro(true).Body, assertMacro(false).Body)
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+// readCppOutput takes the line markers out of cpp's output, recording
+// where each line came from and the headers read. Files under work (the
+// prelude and the stubs) are ours.
+func (p *Preprocessor) readCppOutput(output, main, work string) string {
+	var result strings.Builder
+	var lineMap []SourcePos
+	file, line := "", 1
+	for _, text := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+		marker := cppLineMarker.FindStringSubmatch(text)
+		if marker == nil {
+			result.WriteString(text)
+			result.WriteString("\n")
+			lineMap = append(lineMap, SourcePos{file, line})
+			line++
+			continue
+		}
+		line, _ = strconv.Atoi(marker[1])
+		file, _ = strconv.Unquote(`"` + marker[2] + `"`)
+		switch {
+		case file == main:
+			file = ""
+		case strings.HasPrefix(file, work+string(filepath.Separator)) || strings.HasPrefix(file, "<"):
+		case strings.HasPrefix(strings.TrimSpace(marker[3]), "1") && !p.processed[p.canonicalPath(file)]:
+			// Entering a header for the first time
+			p.processed[p.canonicalPath(file)] = true
+			p.includes = append(p.includes, file)
+			if content, err := p.fs.ReadFile(file); err == nil {
+				p.ApplyHeaderSummary(p.summarizeHeader(file, content))
+			}
+		}
+	}
+	p.lineMap = lineMap
+	return result.String()
+}
+
+// isSystemIncludeDir reports whether dir is one of the system include
+// directories
+func isSystemIncludeDir(dir string) bool {
+	for _, system := range systemIncludeDirs {
+		if dir == system {
+			return true
+		}
+	}
+	return false
+}
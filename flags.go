@@ -0,0 +1,426 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Command-line flags
+// Every option is a flagSpec in cliFlags, which both parseCommandLine and
+// --help read, so an option can't be accepted without being documented.
+// Options that take a value accept it the way gcc does: joined for the
+// one-letter ones (-Idir, -DNAME=1, -lm), or as the next argument
+// (-I dir, -D NAME, -o file). The one argument that isn't an option is the
+// source file; it may come anywhere. Everything after "--" is passed to the
+// program -run runs.
+
+const compilerVersion = "0.1.0"
+
+// flagValue says whether and how an option takes a value
+type flagValue int
+
+const (
+	flagNoValue  flagValue = iota
+	flagSeparate           // -o file
+	flagJoinable           // -Idir or -I dir
+	flagJoined             // -finline-limit=24, -lm
+)
+
+type flagSpec struct {
+	name    string // including the dash, and the '=' of joined values
+	value   flagValue
+	metavar string // the value's name in --help
+	help    string // empty for aliases and negative forms, left out of --help
+	apply   func(cl *commandLine, value string) error
+}
+
+// MacroFlag is one -D or -U, applied in command-line order
+type MacroFlag struct {
+	Name  string
+	Value string
+	Undef bool
+}
+
+// commandLine is everything parsed from the arguments
+type commandLine struct {
+	sourceFile string
+	outputFile string // empty if -o wasn't given
+	options    CompilerOptions
+
+	runMode         bool
+	watch           bool
+	programArgs     []string // after "--": the arguments -run passes the program
+	jitMode         bool
+	asmOnly         bool
+	preprocessOnly  bool
+	symbolIndex     bool
+	artifacts       bool
+	printTargetSpec bool
+	printLibProfile string // -print-libprofile=: the profile to print
+	deps            dependencyOptions
+	showHelp        bool
+	showVersion     bool
+
+	siblingCalls string // "on"/"off" when given, else follows -O
+}
+
+// do adapts an option without a value to flagSpec.apply
+func do(set func(cl *commandLine)) func(cl *commandLine, _ string) error {
+	return func(cl *commandLine, _ string) error {
+		set(cl)
+		return nil
+	}
+}
+
+var cliFlags []*flagSpec
+
+func init() {
+	cliFlags = []*flagSpec{
+		{name: "--help", help: "Show this help", apply: do(func(cl *commandLine) { cl.showHelp = true })},
+		{name: "-help", apply: do(func(cl *commandLine) { cl.showHelp = true })},
+		{name: "--version", help: "Print the compiler version", apply: do(func(cl *commandLine) { cl.showVersion = true })},
+		{name: "-o", value: flagSeparate, metavar: "<file>", help: "Output file (default: a.out)", apply: func(cl *commandLine, v string) error {
+			if v == "-" {
+				// -E and -emit-symbol-index write to stdout without -o
+				return fmt.Errorf("-o - (stdout) is not supported")
+			}
+			cl.outputFile = v
+			return nil
+		}},
+		{name: "-E", help: "Preprocess only; write the result to stdout (or -o)", apply: do(func(cl *commandLine) { cl.preprocessOnly = true })},
+		{name: "-S", help: "Output assembly only", apply: do(func(cl *commandLine) { cl.asmOnly = true })},
+		{name: "-fsyntax-only", help: "Only parse and check the source, reporting diagnostics", apply: do(func(cl *commandLine) { cl.options.SyntaxOnly = true })},
+		{name: "-emit-symbol-index", help: "Write the declarations and their positions as JSON to stdout (or -o)", apply: do(func(cl *commandLine) { cl.symbolIndex = true })},
+		{name: "-emit-artifacts", help: "Write every stage's output (IR, assembly, machine code, diagnostics) as JSON to stdout (or -o)", apply: do(func(cl *commandLine) { cl.artifacts = true })},
+		{name: "-emit-ir", help: "Write the IR to <source>.ir (or -o) instead of compiling", apply: do(func(cl *commandLine) { cl.options.StopAfterIR = true })},
+		{name: "-emit-asm-annotated", help: "Like -S, with each statement's source line as a comment", apply: do(func(cl *commandLine) {
+			cl.asmOnly = true
+			cl.options.AnnotateAsm = true
+		})},
+		{name: "-run", help: "Compile and run immediately", apply: do(func(cl *commandLine) { cl.runMode = true })},
+		{name: "-watch", help: "Rebuild (and with -run, rerun) whenever the source or its headers change", apply: do(func(cl *commandLine) { cl.watch = true })},
+		{name: "-jit", help: "Run main in-process from memory (no output file)", apply: do(func(cl *commandLine) { cl.jitMode = true })},
+		{name: "-MD", help: "Also write a Make rule listing the source and its headers to <output>.d", apply: do(func(cl *commandLine) { cl.deps.write = true })},
+		{name: "-MMD", help: "Like -MD, leaving out system headers", apply: do(func(cl *commandLine) {
+			cl.deps.write = true
+			cl.deps.userOnly = true
+		})},
+		{name: "-MF", value: flagSeparate, metavar: "<file>", help: "Write the -MD rule to file", apply: func(cl *commandLine, v string) error {
+			cl.deps.file = v
+			return nil
+		}},
+		{name: "-MT", value: flagSeparate, metavar: "<target>", help: "Make the -MD rule's target target instead of the output", apply: func(cl *commandLine, v string) error {
+			cl.deps.target = v
+			return nil
+		}},
+		{name: "-MP", help: "Add an empty rule for each header to the -MD file", apply: do(func(cl *commandLine) { cl.deps.phonyRules = true })},
+		{name: "-v", help: "Verbose output", apply: do(func(cl *commandLine) { cl.options.Verbose = true })},
+		{name: "-stats", help: "Report each phase's time and allocations, token and IR counts, and peak memory", apply: do(func(cl *commandLine) { cl.options.Stats = true })},
+
+		{name: "-I", value: flagJoinable, metavar: "<dir>", help: "Search dir for #include files, before the default paths", apply: func(cl *commandLine, v string) error {
+			cl.options.IncludePaths = append(cl.options.IncludePaths, v)
+			return nil
+		}},
+		{name: "-D", value: flagJoinable, metavar: "<name>[=<val>]", help: "Define a macro (as 1 if no value is given)", apply: func(cl *commandLine, v string) error {
+			name, value, hasValue := strings.Cut(v, "=")
+			if !hasValue {
+				value = "1"
+			}
+			if name == "" {
+				return fmt.Errorf("macro name missing after -D")
+			}
+			cl.options.Macros = append(cl.options.Macros, MacroFlag{Name: name, Value: value})
+			return nil
+		}},
+		{name: "-U", value: flagJoinable, metavar: "<name>", help: "Undefine a macro", apply: func(cl *commandLine, v string) error {
+			cl.options.Macros = append(cl.options.Macros, MacroFlag{Name: v, Undef: true})
+			return nil
+		}},
+
+		{name: "-O", value: flagJoined, metavar: "<level>", help: "Optimization level (0-3)", apply: func(cl *commandLine, v string) error {
+			level, err := strconv.Atoi(v)
+			if err != nil || level < 0 || level > 3 {
+				return fmt.Errorf("invalid optimization level -O%s", v)
+			}
+			cl.options.OptimizationLevel = level
+			return nil
+		}},
+		{name: "-finline-limit=", value: flagJoined, metavar: "<n>", help: "Inline functions of up to n IR instructions at -O2 (default 24)", apply: func(cl *commandLine, v string) error {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 0 {
+				return fmt.Errorf("invalid -finline-limit=%s", v)
+			}
+			cl.options.InlineLimit = limit
+			return nil
+		}},
+		{name: "-foptimize-sibling-calls", help: "Turn calls in tail position into jumps (default at -O2)", apply: do(func(cl *commandLine) { cl.siblingCalls = "on" })},
+		{name: "-fno-optimize-sibling-calls", apply: do(func(cl *commandLine) { cl.siblingCalls = "off" })},
+		{name: "-fsanitize=", value: flagJoined, metavar: "light", help: "Abort with the source line on null dereferences and division by zero", apply: func(cl *commandLine, v string) error {
+			if v != "light" {
+				return fmt.Errorf("unsupported -fsanitize=%s (only 'light' is available)", v)
+			}
+			cl.options.SanitizeLight = true
+			return nil
+		}},
+		{name: "-fno-sanitize=all", apply: do(func(cl *commandLine) { cl.options.SanitizeLight = false })},
+		{name: "-mno-red-zone", help: "Don't keep leaf functions' locals below the stack pointer", apply: do(func(cl *commandLine) { cl.options.NoRedZone = true })},
+		{name: "-mred-zone", apply: do(func(cl *commandLine) { cl.options.NoRedZone = false })},
+		{name: "-fomit-frame-pointer", help: "Address leaf functions' frames from the stack pointer instead of setting up %rbp", apply: do(func(cl *commandLine) { cl.options.OmitFramePointer = true })},
+		{name: "-fno-omit-frame-pointer", help: "Set up %rbp in every function, for unwinders and profilers (default)", apply: do(func(cl *commandLine) { cl.options.OmitFramePointer = false })},
+		{name: "-mno-popcnt", help: "Call libgcc for __builtin_popcount instead of using popcnt", apply: do(func(cl *commandLine) { cl.options.NoPopcnt = true })},
+		{name: "-mpopcnt", apply: do(func(cl *commandLine) { cl.options.NoPopcnt = false })},
+		{name: "-mno-lzcnt", help: "Call libgcc for __builtin_clz instead of using lzcnt", apply: do(func(cl *commandLine) { cl.options.NoLzcnt = true })},
+		{name: "-mlzcnt", apply: do(func(cl *commandLine) { cl.options.NoLzcnt = false })},
+		{name: "-mno-bmi", help: "Call libgcc for __builtin_ctz instead of using tzcnt", apply: do(func(cl *commandLine) { cl.options.NoBMI = true })},
+		{name: "-mbmi", apply: do(func(cl *commandLine) { cl.options.NoBMI = false })},
+		{name: "-masm=", value: flagJoined, metavar: "att|intel", help: "Assembly syntax for -S and the assembler (default att)", apply: func(cl *commandLine, v string) error {
+			switch v {
+			case "att":
+				cl.options.IntelSyntax = false
+			case "intel":
+				cl.options.IntelSyntax = true
+			default:
+				return fmt.Errorf("unsupported -masm=%s (use 'att' or 'intel')", v)
+			}
+			return nil
+		}},
+		{name: "-header-summaries=", value: flagJoined, metavar: "<file>", help: "Apply saved header summaries (types and prototypes) before preprocessing", apply: func(cl *commandLine, v string) error {
+			cl.options.HeaderSummaries = v
+			return nil
+		}},
+		{name: "-emit-header-summaries=", value: flagJoined, metavar: "<file>", help: "Save summaries of the headers the source includes", apply: func(cl *commandLine, v string) error {
+			cl.options.EmitHeaderSummaries = v
+			return nil
+		}},
+		{name: "-fheader-overlay=", value: flagJoined, metavar: "<file>", help: "Serve the files in <file> (JSON: path to contents) from memory, ahead of the disk", apply: func(cl *commandLine, v string) error {
+			cl.options.HeaderOverlay = v
+			return nil
+		}},
+		{name: "-fno-cache", help: "Don't reuse or store assembly in the compile cache", apply: do(func(cl *commandLine) { cl.options.Cache = false })},
+		{name: "-fcache", apply: do(func(cl *commandLine) { cl.options.Cache = true })},
+
+		{name: "-libprofile=", value: flagJoined, metavar: "<name|file>", help: "Use a library profile (repeatable; default: raylib; 'none' for none)", apply: func(cl *commandLine, v string) error {
+			cl.options.LibProfiles = append(cl.options.LibProfiles, v)
+			return nil
+		}},
+		{name: "-print-libprofile=", value: flagJoined, metavar: "<name|file>", help: "Print a library profile as JSON", apply: func(cl *commandLine, v string) error {
+			cl.printLibProfile = v
+			return nil
+		}},
+		{name: "-l", value: flagJoined, metavar: "<lib>", help: "Link with library (e.g., -lc, -lraylib)", apply: func(cl *commandLine, v string) error {
+			cl.options.LibraryFlags = append(cl.options.LibraryFlags, "-l"+v)
+			return nil
+		}},
+		{name: "-L", value: flagJoined, metavar: "<dir>", help: "Search <dir> for -l libraries", apply: func(cl *commandLine, v string) error {
+			cl.options.LibraryFlags = append(cl.options.LibraryFlags, "-L"+v)
+			return nil
+		}},
+		{name: "-Wl,-Map=", value: flagJoined, metavar: "<file>", help: "Write a link map to <file>", apply: func(cl *commandLine, v string) error {
+			cl.options.LinkMap = v
+			return nil
+		}},
+		{name: "-pthread", help: "Link with the pthread library", apply: do(func(cl *commandLine) { cl.options.LibraryFlags = append(cl.options.LibraryFlags, "-lpthread") })},
+		{name: "-linear-scan", help: "Use linear scan register allocation", apply: do(func(cl *commandLine) { cl.options.UseLinearScan = true })},
+		{name: "-native", help: "Use built-in assembler/linker (faster!)", apply: do(func(cl *commandLine) { cl.options.UseNativeBackend = true })},
+		{name: "-fuse-ld=internal", help: "Link without gcc (the program and static -l libraries only)", apply: do(func(cl *commandLine) { cl.options.InternalLinker = true })},
+		{name: "-fexternal-cpp", help: "Preprocess with the system's cpp, with the same -I, -D and -U", apply: do(func(cl *commandLine) { cl.options.ExternalCpp = true })},
+		{name: "-fno-external-cpp", apply: do(func(cl *commandLine) { cl.options.ExternalCpp = false })},
+		{name: "-ffreestanding", help: "Don't use libc: link a builtin write/exit/malloc and _start instead", apply: do(func(cl *commandLine) { cl.options.Freestanding = true })},
+		{name: "-fhosted", apply: do(func(cl *commandLine) { cl.options.Freestanding = false })},
+		{name: "-verify-native", help: "Link with gcc, and list instructions the built-in assembler can't encode", apply: do(func(cl *commandLine) { cl.options.VerifyNative = true })},
+
+		{name: "-fstrict-aliasing", help: "Opt in to type-based aliasing rules (default: -fno-strict-aliasing)", apply: do(func(cl *commandLine) { cl.options.StrictAliasing = true })},
+		{name: "-fno-strict-aliasing", apply: do(func(cl *commandLine) { cl.options.StrictAliasing = false })},
+		{name: "-Wstrict-aliasing", help: "Warn about pointer casts that break strict aliasing", apply: do(func(cl *commandLine) { cl.options.WarnStrictAliasing = true })},
+		{name: "-Wno-strict-aliasing", apply: do(func(cl *commandLine) { cl.options.WarnStrictAliasing = false })},
+		{name: "-Wwrite-strings", help: "Treat string literals as const char arrays", apply: do(func(cl *commandLine) { cl.options.WarnWriteStrings = true })},
+		{name: "-Wno-write-strings", apply: do(func(cl *commandLine) { cl.options.WarnWriteStrings = false })},
+		{name: "-Wimplicit-function-declaration", apply: do(func(cl *commandLine) { cl.options.WarnImplicitFunctionDecl = true })},
+		{name: "-Wno-implicit-function-declaration", help: "Don't warn about calls to undeclared functions", apply: do(func(cl *commandLine) { cl.options.WarnImplicitFunctionDecl = false })},
+		{name: "-Wswitch", apply: do(func(cl *commandLine) { cl.options.WarnSwitch = true })},
+		{name: "-Wno-switch", help: "Don't warn about enumerators a switch doesn't handle", apply: do(func(cl *commandLine) { cl.options.WarnSwitch = false })},
+		{name: "-Wconversion", help: "Warn about implicit conversions that may change a value", apply: do(func(cl *commandLine) { cl.options.WarnConversion = true })},
+		{name: "-Wno-conversion", apply: do(func(cl *commandLine) { cl.options.WarnConversion = false })},
+		{name: "-Wuninitialized", apply: do(func(cl *commandLine) { cl.options.WarnUninitialized = true })},
+		{name: "-Wno-uninitialized", help: "Don't warn about locals read before they're assigned", apply: do(func(cl *commandLine) { cl.options.WarnUninitialized = false })},
+		{name: "-Wreturn-type", apply: do(func(cl *commandLine) { cl.options.WarnReturnType = true })},
+		{name: "-Wno-return-type", help: "Don't warn about returns that don't match the return type", apply: do(func(cl *commandLine) { cl.options.WarnReturnType = false })},
+		{name: "-Wmain", apply: do(func(cl *commandLine) { cl.options.WarnMain = true })},
+		{name: "-Wno-main", help: "Don't warn about a main with an unusual signature", apply: do(func(cl *commandLine) { cl.options.WarnMain = false })},
+		{name: "-Wunused-value", apply: do(func(cl *commandLine) { cl.options.WarnUnusedValue = true })},
+		{name: "-Wno-unused-value", help: "Don't warn about statements with no effect", apply: do(func(cl *commandLine) { cl.options.WarnUnusedValue = false })},
+		{name: "-Wunused-variable", help: "Warn about locals that are never read", apply: do(func(cl *commandLine) { cl.options.WarnUnusedVariable = true })},
+		{name: "-Wno-unused-variable", apply: do(func(cl *commandLine) { cl.options.WarnUnusedVariable = false })},
+		{name: "-Wunused-function", help: "Warn about static functions that are never called", apply: do(func(cl *commandLine) { cl.options.WarnUnusedFunction = true })},
+		{name: "-Wno-unused-function", apply: do(func(cl *commandLine) { cl.options.WarnUnusedFunction = false })},
+		{name: "-Wunreachable-code", help: "Warn about code after a return or jump that can never run", apply: do(func(cl *commandLine) { cl.options.WarnUnreachableCode = true })},
+		{name: "-Wno-unreachable-code", apply: do(func(cl *commandLine) { cl.options.WarnUnreachableCode = false })},
+		{name: "-Werror", help: "Make all warnings into errors", apply: do(func(cl *commandLine) { cl.options.WarningsAsErrors = true })},
+		{name: "-Wno-error", apply: do(func(cl *commandLine) { cl.options.WarningsAsErrors = false })},
+		{name: "-fdiagnostics-format=", value: flagJoined, metavar: "text|json", help: "Report warnings and errors as lines as they come (default), or as a JSON array at the end", apply: func(cl *commandLine, v string) error {
+			switch v {
+			case "text":
+				cl.options.DiagnosticsJSON = false
+			case "json":
+				cl.options.DiagnosticsJSON = true
+			default:
+				return fmt.Errorf("unsupported -fdiagnostics-format=%s (use 'text' or 'json')", v)
+			}
+			return nil
+		}},
+
+		{name: "-std=", value: flagJoined, metavar: "subset", help: "Reject code outside the subset of C known to compile correctly", apply: func(cl *commandLine, v string) error {
+			if v != "subset" {
+				return fmt.Errorf("unsupported -std=%s (only 'subset' is available)", v)
+			}
+			cl.options.StdSubset = true
+			return nil
+		}},
+
+		{name: "-target-spec=", value: flagJoined, metavar: "<file>", help: "Load type sizes, alignments and char signedness from a JSON spec", apply: func(cl *commandLine, v string) error {
+			cl.options.TargetSpec = v
+			return nil
+		}},
+		{name: "-target=", value: flagJoined, metavar: "x86_64|arm64", help: "Generate code for x86-64 (default) or AArch64 Linux", apply: func(cl *commandLine, v string) error {
+			spec, err := TargetForArch(v)
+			if err != nil {
+				return err
+			}
+			cl.options.Target = spec.Arch
+			return nil
+		}},
+		{name: "-print-target-spec", help: "Print the target spec in effect (default: x86-64 System V)", apply: do(func(cl *commandLine) { cl.printTargetSpec = true })},
+	}
+}
+
+// parseCommandLine parses the arguments after the program name
+func parseCommandLine(args []string) (*commandLine, error) {
+	cl := &commandLine{
+		options: CompilerOptions{
+			LibraryFlags:             []string{},
+			WarnImplicitFunctionDecl: true,
+			WarnSwitch:               true,
+			WarnUninitialized:        true,
+			WarnReturnType:           true,
+			WarnMain:                 true,
+			WarnUnusedValue:          true,
+			Cache:                    true,
+		},
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			cl.programArgs = args[i+1:]
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			if cl.sourceFile != "" {
+				return nil, fmt.Errorf("more than one source file: %s and %s", cl.sourceFile, arg)
+			}
+			cl.sourceFile = arg
+			continue
+		}
+		spec, value, ok := matchFlag(arg)
+		if !ok {
+			return nil, fmt.Errorf("unrecognized command-line option '%s' (see --help)", arg)
+		}
+		if spec.value == flagSeparate || (spec.value == flagJoinable && value == "") {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing argument to '%s'", arg)
+			}
+			i++
+			value = args[i]
+		}
+		if err := spec.apply(cl, value); err != nil {
+			return nil, err
+		}
+	}
+	cl.options.OptimizeSiblingCalls = cl.siblingCalls == "on" || (cl.siblingCalls == "" && cl.options.OptimizationLevel >= 2)
+	if cl.watch {
+		for _, f := range []struct {
+			flag string
+			set  bool
+		}{
+			{"-jit", cl.jitMode},
+			{"-E", cl.preprocessOnly},
+			{"-emit-symbol-index", cl.symbolIndex},
+			{"-emit-artifacts", cl.artifacts},
+			{"-emit-ir", cl.options.StopAfterIR},
+		} {
+			if f.set {
+				return nil, fmt.Errorf("-watch can't be combined with %s", f.flag)
+			}
+		}
+	}
+	if len(cl.programArgs) > 0 && (!cl.runMode || cl.jitMode) {
+		return nil, fmt.Errorf("arguments after '--' are for the program, and need -run (without -jit)")
+	}
+	if cl.options.Target == "aarch64" {
+		// The built-in assembler, linker and JIT only speak x86-64
+		x86Only := []struct {
+			flag string
+			set  bool
+		}{
+			{"-jit", cl.jitMode},
+			{"-native", cl.options.UseNativeBackend},
+			{"-fuse-ld=internal", cl.options.InternalLinker},
+			{"-verify-native", cl.options.VerifyNative},
+			{"-masm=intel", cl.options.IntelSyntax},
+		}
+		for _, f := range x86Only {
+			if f.set {
+				return nil, fmt.Errorf("%s is not supported with -target=arm64", f.flag)
+			}
+		}
+	}
+	return cl, nil
+}
+
+// matchFlag finds the spec for arg, and the value joined to it if any
+func matchFlag(arg string) (*flagSpec, string, bool) {
+	for _, spec := range cliFlags {
+		if arg == spec.name && spec.value != flagJoined {
+			return spec, "", true
+		}
+	}
+	// Joined values: the longest matching prefix wins
+	var best *flagSpec
+	for _, spec := range cliFlags {
+		if spec.value != flagJoined && spec.value != flagJoinable {
+			continue
+		}
+		if strings.HasPrefix(arg, spec.name) && len(arg) > len(spec.name) && (best == nil || len(spec.name) > len(best.name)) {
+			best = spec
+		}
+	}
+	if best == nil {
+		return nil, "", false
+	}
+	return best, arg[len(best.name):], true
+}
+
+// printUsage writes --help
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: ccompiler <source.c> [options]")
+	fmt.Fprintln(w, "       ccompiler <source.c> -run [options] [-- <args>...]   Compile, then run with args")
+	fmt.Fprintln(w, "       ccompiler test <dir> [--update] [options]   Check programs against <name>.expected")
+	fmt.Fprintln(w, "       ccompiler bench <dir> [--cc=gcc] [--runs=N] [options]   Compare compile time, size and speed with <cc> -O2")
+	fmt.Fprintln(w, "       ccompiler subset <dir> [--cc=gcc] [options]   Check -std=subset against <cc> over a corpus and list what's outside it")
+	fmt.Fprintln(w, "       ccompiler raylib-test <examples_dir> [--report=file] [options]   Build raylib's examples and report the phase each failure stopped in")
+	fmt.Fprintln(w, "\nOptions:")
+	for _, spec := range cliFlags {
+		if spec.help == "" {
+			continue
+		}
+		name := spec.name
+		switch spec.value {
+		case flagSeparate, flagJoinable:
+			name += " " + spec.metavar
+		case flagJoined:
+			name += spec.metavar
+		}
+		fmt.Fprintf(w, "  %-36s %s\n", name, spec.help)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+// Stack frames
+// Every stack slot a function uses is handed out by its FrameManager:
+// parameters, locals, the selector's temporaries (?: joins, struct copies,
+// compound literals), buffers for struct results, the frames of calls
+// inlined into it, and the register allocator's spill slots. Slots are laid out downward from %rbp, each aligned to
+// its own alignment, and the code emitter sizes the frame from the
+// manager instead of scanning the code for the deepest offset.
+//
+// A leaf function (one that makes no calls and pushes nothing) whose slots
+// and callee-saved registers fit in the 128 bytes below %rsp that the
+// System V ABI leaves to it, the red zone, doesn't move %rsp at all: the
+// registers are saved with moves below its slots rather than pushed.
+// -mno-red-zone turns that off, for code where the red zone isn't safe
+// (interrupt handlers that run on the same stack).
+//
+// Every function sets up %rbp as its frame pointer by default
+// (-fno-omit-frame-pointer), so unwinders, profilers and debuggers can walk
+// the chain of saved %rbp values. -fomit-frame-pointer leaves it out of
+// leaf functions, which are where that saves the most: without the push
+// and the move the slots are addressed from %rsp, which a leaf never moves
+// once its frame is reserved. The slots stay where they were, just below
+// the return address, so their alignment doesn't change.
+
+// redZoneSize is how far below %rsp a leaf function may keep its slots
+const redZoneSize = 128
+
+// SlotKind says what a stack slot holds
+type SlotKind int
+
+const (
+	SlotParam        SlotKind = iota // a parameter, stored from its register
+	SlotLocal                        // a local variable
+	SlotTemp                         // a temporary the selector needed in memory
+	SlotReturnBuffer                 // where a struct result is returned or collected
+	SlotInlined                      // the frame of an inlined call
+	SlotSpill                        // a temp the register allocator couldn't keep in a register
+	SlotSaved                        // a register the function's convention keeps, named by the slot (see calling_convention.go)
+)
+
+// FrameSlot is one slot; Offset is from %rbp
+type FrameSlot struct {
+	Name   string
+	Kind   SlotKind
+	Offset int
+	Size   int
+}
+
+// FrameManager lays out one function's frame
+type FrameManager struct {
+	Function string
+	Slots    []FrameSlot
+	size     int // bytes in use below %rbp
+}
+
+func NewFrameManager(function string) *FrameManager {
+	return &FrameManager{Function: function}
+}
+
+// Alloc reserves size bytes aligned to align and returns the slot's offset
+// from %rbp
+func (f *FrameManager) Alloc(kind SlotKind, name string, size, align int) int {
+	if size < 0 {
+		size = 0
+	}
+	if align < 1 {
+		align = 1
+	}
+	f.size = roundUp(f.size+size, align)
+	f.Slots = append(f.Slots, FrameSlot{Name: name, Kind: kind, Offset: -f.size, Size: size})
+	return -f.size
+}
+
+// AllocFrame places another function's frame (an inlined call's) below
+// everything allocated so far and returns how far below %rbp it starts:
+// the inlined code's offsets move down by that much
+func (f *FrameManager) AllocFrame(inner *FrameManager) int {
+	depth := roundUp(f.size, 16)
+	f.size = depth + inner.Size()
+	f.Slots = append(f.Slots, FrameSlot{Name: inner.Function, Kind: SlotInlined, Offset: -f.size, Size: inner.Size()})
+	return depth
+}
+
+// Size is how many bytes below %rbp the slots take
+func (f *FrameManager) Size() int {
+	return f.size
+}
+
+func roundUp(n, align int) int {
+	return (n + align - 1) / align * align
+}
+
+// spillFrames gives the register allocators, which work on the whole
+// program at once, spill slots in the frame of the function each temp is in
+type spillFrames struct {
+	frames map[string]*FrameManager
+	owner  []string // function of each instruction
+}
+
+func newSpillFrames(instrs []*IRInstruction, frames map[string]*FrameManager) *spillFrames {
+	if frames == nil {
+		frames = make(map[string]*FrameManager)
+	}
+	owner := make([]string, len(instrs))
+	function := ""
+	for i, instr := range instrs {
+		if instr.Op == OpLabel && isFunctionLabel(instr.Dst.Value) {
+			function = instr.Dst.Value
+		}
+		owner[i] = function
+	}
+	return &spillFrames{frames: frames, owner: owner}
+}
+
+// spill reserves a slot for temp, which is used at instruction i, and
+// returns its offset from %rbp
+func (s *spillFrames) spill(temp string, i int) int {
+	function := s.owner[i]
+	frame, ok := s.frames[function]
+	if !ok {
+		frame = NewFrameManager(function)
+		s.frames[function] = frame
+	}
+	return frame.Alloc(SlotSpill, temp, 8, 8)
+}
+
+// slotAlign is the alignment for a slot of size bytes: every slot holds at
+// least an eightbyte's worth, since values are moved in whole registers
+func slotAlign(size int) int {
+	if size >= 16 {
+		return 16
+	}
+	return 8
+}
+
+// addressFromRSP rewrites the %rbp-relative operands of a function
+// emitted without a frame pointer to the same addresses from %rsp: %rbp
+// would have been just below the return address, and %rsp is below that
+// by the frame and the registers pushed after it
+func (ce *CodeEmitter) addressFromRSP(code []*MachineInstr) {
+	delta := int64(-8)
+	if !ce.redZone {
+		delta += int64(ce.stackSize + 8*len(ce.usedRegisters))
+	}
+	for _, mi := range code {
+		for i, op := range mi.Operands {
+			if op.Kind == MOpMem && op.Reg == "rbp" {
+				mi.Operands[i].Reg = "rsp"
+				mi.Operands[i].Disp += delta
+			}
+		}
+	}
+}
+
+// isLeaf reports whether a function's code (its body, after the entry
+// label) calls, pushes or copies through the stack
+func isLeaf(body []*IRInstruction) bool {
+	for _, instr := range body {
+		switch instr.Op {
+		case OpCall, OpTailCall, OpPush, OpMemcpy, OpMemset:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,183 @@
+package main
+
+import "fmt"
+
+// Freestanding programs
+// -ffreestanding builds a program that doesn't use libc at all: it's linked
+// with -nostdlib -static (or by the internal linker), starts at the same
+// _start stub the internal linker uses, and __STDC_HOSTED__ is 0. The few
+// libc functions a simple program can't do without are supplied by a tiny
+// builtin runtime, written directly as IR around OpSyscall:
+//
+//	write(fd, buf, n)  the write system call; errors come back as -errno
+//	exit(status)       the exit system call (nothing is buffered to flush)
+//	_exit(status)      the same
+//	malloc(n)          a bump allocator that grows the heap with brk, in
+//	                   16-byte steps; 0 once brk fails
+//	free(p)            does nothing
+//
+// Only the functions the program calls and doesn't define itself are
+// added. System call arguments go in the first argument registers of the
+// target's convention, which on both x86-64 and AArch64 Linux are the ones
+// the kernel reads them from.
+//
+// Any program, freestanding or not, can make a system call itself with
+// the __syscall builtin:
+//
+//	long n = __syscall(1, 1, "hi\n", 3);    // write(1, "hi\n", 3)
+//
+// The first argument is the call's number, a constant; up to six more are
+// its arguments, in the registers the kernel takes them in (on x86-64 the
+// fourth goes in r10, not rcx, which the syscall instruction overwrites).
+// The result is what the kernel returns: -errno on failure.
+
+// linuxSyscalls are the system call numbers the runtime uses, by architecture
+var linuxSyscalls = map[string]map[string]int{
+	"x86_64":  {"write": 1, "exit": 60, "brk": 12},
+	"aarch64": {"write": 64, "exit": 93, "brk": 214},
+}
+
+// linuxSyscallArgs are the registers system call arguments go in, by
+// architecture
+var linuxSyscallArgs = map[string][]string{
+	"x86_64":  {"rdi", "rsi", "rdx", "r10", "r8", "r9"},
+	"aarch64": {"x0", "x1", "x2", "x3", "x4", "x5"},
+}
+
+// freestandingRuntime are the builtin functions, in the order they're added
+var freestandingRuntime = []struct {
+	name string
+	emit func(is *InstructionSelector)
+}{
+	{"write", func(is *InstructionSelector) { is.emitSyscallFunction("write") }},
+	{"exit", func(is *InstructionSelector) { is.emitSyscallFunction("exit") }},
+	{"_exit", func(is *InstructionSelector) { is.emitSyscallFunction("exit") }},
+	{"malloc", (*InstructionSelector).emitBrkMalloc},
+	{"free", func(is *InstructionSelector) { is.emit(OpRet, nil, nil, nil) }},
+}
+
+// brkGlobal holds the end of the heap malloc has handed out (0 until the
+// first call asks the kernel where it starts)
+const brkGlobal = "__ccompiler_brk"
+
+// addFreestandingRuntime appends the builtin functions the program uses
+func (is *InstructionSelector) addFreestandingRuntime() {
+	used := make(map[string]bool)
+	for _, instr := range is.instructions {
+		for _, op := range []*Operand{instr.Src1, instr.Src2} {
+			if op != nil && op.Type == "label" {
+				used[op.Value] = true
+			}
+		}
+	}
+	defined := definedFunctions(is.instructions)
+	for _, fn := range freestandingRuntime {
+		if !used[fn.name] || defined[fn.name] {
+			continue
+		}
+		is.currentFunc = fn.name
+		is.line, is.column = 0, 0
+		is.frame = NewFrameManager(fn.name)
+		is.frames[fn.name] = is.frame
+		is.emit(OpLabel, &Operand{Type: "label", Value: fn.name}, nil, nil)
+		fn.emit(is)
+	}
+}
+
+// syscallNumber is the number of the named system call on the target
+func (is *InstructionSelector) syscallNumber(name string) *Operand {
+	return &Operand{Type: "imm", Value: fmt.Sprintf("%d", linuxSyscalls[is.target.Arch][name])}
+}
+
+// emitSyscallFunction is the body of a function that passes its arguments,
+// still in their registers, straight to a system call and returns its result
+func (is *InstructionSelector) emitSyscallFunction(name string) {
+	result := &Operand{Type: "reg", Value: is.target.CallingConvention().IntResults[0]}
+	is.emit(OpSyscall, result, is.syscallNumber(name), nil)
+	is.emit(OpRet, nil, nil, nil)
+}
+
+// selectSyscall selects __syscall(n, args...) as system call n
+func (is *InstructionSelector) selectSyscall(node *ASTNode) (*Operand, error) {
+	regs := linuxSyscallArgs[is.target.Arch]
+	if len(node.Children) == 0 || len(node.Children) > len(regs)+1 {
+		return nil, fmt.Errorf("in function '%s': __syscall takes a system call number and up to %d arguments", is.currentFunc, len(regs))
+	}
+	number, err := evalConstant(node.Children[0], is.enumConstant)
+	if err != nil {
+		return nil, fmt.Errorf("in function '%s': __syscall's system call number must be a constant", is.currentFunc)
+	}
+	// Every argument is worked out before the registers are loaded
+	var args []*Operand
+	for _, child := range node.Children[1:] {
+		arg, err := is.selectExpression(child)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	for i, arg := range args {
+		is.emit(OpSetArg, &Operand{Type: "reg", Value: regs[i]}, arg, nil)
+	}
+	result := is.newTemp()
+	is.emit(OpSyscall, result, &Operand{Type: "imm", Value: fmt.Sprintf("%d", number)}, nil)
+	return result, nil
+}
+
+// emitBrkMalloc is malloc's body: round the size up to 16 bytes and move
+// the break past it
+func (is *InstructionSelector) emitBrkMalloc() {
+	cc := is.target.CallingConvention()
+	arg := &Operand{Type: "reg", Value: cc.IntArgs[0]}
+	result := &Operand{Type: "reg", Value: cc.IntResults[0]}
+	heap := &Operand{Type: "var", Value: brkGlobal, IsGlobal: true}
+	is.defineGlobal(&Symbol{Name: brkGlobal, Type: "char*", IsGlobal: true, IsStatic: true, Size: 8})
+
+	size := is.newTemp()
+	is.emit(OpMov, size, arg, nil)
+	start := is.newTemp()
+	is.emit(OpLoad, start, heap, nil)
+	haveHeap := is.newLabel(".L_malloc_heap")
+	is.emit(OpJnz, &Operand{Type: "label", Value: haveHeap}, start, nil)
+	// brk(0) fails, returning the current break
+	is.emit(OpSetArg, arg, &Operand{Type: "imm", Value: "0"}, nil)
+	is.emit(OpSyscall, start, is.syscallNumber("brk"), nil)
+	is.emit(OpLabel, &Operand{Type: "label", Value: haveHeap}, nil, nil)
+
+	rounded := is.newTemp()
+	is.emit(OpAdd, rounded, size, &Operand{Type: "imm", Value: "15"})
+	is.emit(OpAnd, rounded, rounded, &Operand{Type: "imm", Value: "-16"})
+	end := is.newTemp()
+	is.emit(OpAdd, end, start, rounded)
+	is.emit(OpSetArg, arg, end, nil)
+	newEnd := is.newTemp()
+	is.emit(OpSyscall, newEnd, is.syscallNumber("brk"), nil)
+	failed := is.newTemp()
+	is.emit(OpLt, failed, newEnd, end)
+	ok := is.newLabel(".L_malloc_ok")
+	is.emit(OpJz, &Operand{Type: "label", Value: ok}, failed, nil)
+	is.emit(OpMov, result, &Operand{Type: "imm", Value: "0"}, nil)
+	is.emit(OpRet, nil, nil, nil)
+
+	is.emit(OpLabel, &Operand{Type: "label", Value: ok}, nil, nil)
+	is.emit(OpStore, heap, end, nil)
+	is.emit(OpMov, result, start, nil)
+	is.emit(OpRet, nil, nil, nil)
+}
+
+// linkFlags are the flags the program is linked with: the library
+// profiles' and the command line's, or for a freestanding program no libc
+// and only the libraries named on the command line
+func (cp *CompilerPipeline) linkFlags() []string {
+	var flags []string
+	if cp.options.Freestanding {
+		flags = append([]string{"-nostdlib", "-static"}, cp.options.LibraryFlags...)
+	} else {
+		flags = cp.profileLinkFlags()
+	}
+	// ld writes the map itself
+	if cp.options.LinkMap != "" {
+		flags = append(flags, "-Wl,-Map="+cp.options.LinkMap)
+	}
+	return flags
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// Function cache
+// An edit to a file misses the compile cache (compile_cache.go) as a
+// whole, though most of its functions are usually just as they were.
+// Register allocation and emission work one function at a time (see
+// ir_segments.go), so what they produce is also cached per function, next
+// to the compile cache: under a hash of the function's IR, its frame before
+// allocation, and what else steers the back end. Selection still runs over
+// the whole program and numbers temps and labels as it goes, so an edit
+// renumbers everything after it; the hash reads each temp and generated
+// label as the order it first appears in the function instead, and the
+// cached assembly keeps such labels as placeholders ({0}, {1} ...) that are
+// filled in with this compile's names. Float constants are placeholders
+// too ({F0} ...), since the emitter numbers them (.FC1 ...) across the
+// whole program.
+
+// functionCacheEntry is what's stored per function
+type functionCacheEntry struct {
+	Assembly string   `json:"assembly"`
+	Floats   []string `json:"floats,omitempty"` // the value of each {F<i>}
+}
+
+type functionCache struct {
+	dir    string
+	prefix []byte              // hashed ahead of every function: compiler, target, options
+	keys   map[string]string   // function -> its key
+	names  map[string][]string // function -> its numbered names, in placeholder order
+	hits   map[string]*functionCacheEntry
+}
+
+// generatedName matches the names selection numbers: labels (.L_else_12,
+// .str_3) and compound literals' slots (main.compound_lit.7)
+var generatedName = regexp.MustCompile(`^\.[A-Za-z_]\w*_\d+$|\.compound_lit\.\d+$`)
+
+// asmSymbol matches the runs of an assembly line a name can be
+var asmSymbol = regexp.MustCompile(`[A-Za-z0-9_.]+`)
+
+var (
+	floatLabel  = regexp.MustCompile(`^\.FC\d+$`)
+	placeholder = regexp.MustCompile(`\{(F?)(\d+)\}`)
+)
+
+// newFunctionCache returns the cache this compile uses, or nil if it can't
+// use one: when the compile cache is off, for AArch64, and when the
+// assembly is annotated with source lines
+func (cp *CompilerPipeline) newFunctionCache() *functionCache {
+	dir := compileCacheDir()
+	if !cp.usesCache() || cp.options.AnnotateAsm || cp.target.Arch == "aarch64" || dir == "" {
+		return nil
+	}
+	h := sha256.New()
+	writeCompilerStamp(h)
+	fmt.Fprintf(h, "linear=%t noredzone=%t omitfp=%t nobits=%t,%t,%t\n", cp.options.UseLinearScan, cp.options.NoRedZone, cp.options.OmitFramePointer, cp.options.NoPopcnt, cp.options.NoLzcnt, cp.options.NoBMI)
+	h.Write(cp.target.JSON())
+	return &functionCache{
+		dir:    filepath.Join(dir, "functions"),
+		prefix: h.Sum(nil),
+		keys:   make(map[string]string),
+		names:  make(map[string][]string),
+		hits:   make(map[string]*functionCacheEntry),
+	}
+}
+
+// lookup hashes a function's segment and reports whether its assembly is
+// cached, in which case it needn't be allocated
+func (fc *functionCache) lookup(segment irSegment, frames map[string]*FrameManager) bool {
+	if fc == nil || segment.Function == "" {
+		return false
+	}
+	key := &irKey{h: sha256.New(), index: make(map[string]int)}
+	key.h.Write(fc.prefix)
+	frameSize := 0
+	var saved []string // registers its convention has it keep (ms_abi)
+	if frame, ok := frames[segment.Function]; ok {
+		frameSize = frame.Size()
+		for _, slot := range frame.Slots {
+			if slot.Kind == SlotSaved {
+				saved = append(saved, slot.Name)
+			}
+		}
+	}
+	fmt.Fprintf(key.h, "%s frame=%d saved=%v\n", segment.Function, frameSize, saved)
+	for _, instr := range segment.Instrs {
+		key.instr(instr)
+	}
+	name := hex.EncodeToString(key.h.Sum(nil))
+	fc.keys[segment.Function] = name
+	fc.names[segment.Function] = key.names
+
+	data, err := os.ReadFile(filepath.Join(fc.dir, name+".json"))
+	if err != nil {
+		return false
+	}
+	var entry functionCacheEntry
+	if json.Unmarshal(data, &entry) != nil {
+		return false
+	}
+	fc.hits[segment.Function] = &entry
+	return true
+}
+
+// emitCached writes the cached assembly of the function whose label is at
+// *i, if there is one, and moves *i to the next function
+func (fc *functionCache) emitCached(ce *CodeEmitter, name string, i *int) bool {
+	if fc == nil {
+		return false
+	}
+	entry, ok := fc.hits[name]
+	if !ok {
+		return false
+	}
+	names := fc.names[name]
+	floats := make([]string, len(entry.Floats))
+	for j, value := range entry.Floats {
+		floats[j] = ce.getFloatLabel(value)
+	}
+	ce.output.Add(ParseMachineText(placeholder.ReplaceAllStringFunc(entry.Assembly, func(p string) string {
+		m := placeholder.FindStringSubmatch(p)
+		n, _ := strconv.Atoi(m[2])
+		if m[1] == "F" {
+			return floats[n]
+		}
+		return names[n]
+	}))...)
+	for *i++; *i < len(ce.instructions); *i++ {
+		if instr := ce.instructions[*i]; instr.Op == OpLabel && ce.isFunctionLabel(instr.Dst.Value) {
+			break
+		}
+	}
+	return true
+}
+
+// store caches the assembly just emitted for a function that missed.
+// Failing to is harmless, as it is for the compile cache.
+func (fc *functionCache) store(ce *CodeEmitter, name string, instrs []*MachineInstr) {
+	if fc == nil {
+		return
+	}
+	key, ok := fc.keys[name]
+	if _, hit := fc.hits[name]; !ok || hit {
+		return
+	}
+	index := make(map[string]int)
+	for i, n := range fc.names[name] {
+		index[n] = i
+	}
+	entry := functionCacheEntry{}
+	floats := make(map[string]int)
+	portable := true
+	entry.Assembly = asmSymbol.ReplaceAllStringFunc(PrintMachineInstrs(instrs), func(run string) string {
+		if i, ok := index[run]; ok {
+			return fmt.Sprintf("{%d}", i)
+		}
+		if floatLabel.MatchString(run) {
+			i, ok := floats[run]
+			if !ok {
+				i = len(entry.Floats)
+				floats[run] = i
+				entry.Floats = append(entry.Floats, ce.floatLits[run])
+			}
+			return fmt.Sprintf("{F%d}", i)
+		}
+		if generatedName.MatchString(run) {
+			// A numbered name the function's IR doesn't mention
+			portable = false
+		}
+		return run
+	})
+	if !portable || os.MkdirAll(fc.dir, 0755) != nil {
+		return
+	}
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		return
+	}
+	writeCacheFile(fc.dir, key+".json", data)
+}
+
+// irKey hashes IR with its temps and generated names numbered in order of
+// appearance. Source positions aren't hashed: they don't change the code.
+type irKey struct {
+	h     hash.Hash
+	index map[string]int
+	names []string
+}
+
+func (k *irKey) instr(instr *IRInstruction) {
+	fmt.Fprintf(k.h, "%d %v ", instr.Op, instr.Clobbers)
+	k.operand(instr.Dst)
+	k.operand(instr.Src1)
+	k.operand(instr.Src2)
+	k.h.Write([]byte{'\n'})
+}
+
+func (k *irKey) operand(op *Operand) {
+	if op == nil {
+		k.h.Write([]byte("-;"))
+		return
+	}
+	value := op.Value
+	if op.Type == "temp" {
+		value = k.name(value)
+	} else if op.Type != "imm" && op.Type != "reg" {
+		value = asmSymbol.ReplaceAllStringFunc(value, func(run string) string {
+			if generatedName.MatchString(run) {
+				return k.name(run)
+			}
+			return run
+		})
+	}
+	fmt.Fprintf(k.h, "%s %q %d %t %d %q (", op.Type, value, op.Offset, op.IsGlobal, op.Size, op.DataType)
+	k.operand(op.IndexTemp)
+	k.operand(op.SourcePtr)
+	k.h.Write([]byte(");"))
+}
+
+// name is the placeholder of a numbered name
+func (k *irKey) name(n string) string {
+	i, ok := k.index[n]
+	if !ok {
+		i = len(k.names)
+		k.index[n] = i
+		k.names = append(k.names, n)
+	}
+	return "{" + strconv.Itoa(i) + "}"
+}
+
+// Hits is how many functions the cache answered
+func (fc *functionCache) Hits() int {
+	if fc == nil {
+		return 0
+	}
+	return len(fc.hits)
+}
+
+// String describes the cache's hits for -v
+func (fc *functionCache) String() string {
+	return fmt.Sprintf("%d of %d function(s) from the function cache", fc.Hits(), len(fc.keys))
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Global data
+// A global's storage is sized like a local's: a struct (or an array of
+// them) as laid out, a scalar array in eightbyte slots (see
+// NodeArrayAccess). One without an initializer is a common symbol in .bss,
+// aligned to the largest power of two up to its size (commAlign); one with
+// a constant scalar initializer is a directive in .data (InitValue).
+//
+// A brace initializer is worked out at compile time into the bytes of the
+// whole object (InitData), laid out like initializers.go stores a local's:
+// each value at the offset of the member or element the parser labeled it
+// with, recursing into nested braces, the rest zero. The bytes are emitted
+// to .data as .byte runs, with .zero for the gaps:
+//
+//	int counts[4] = {1, 2};    .byte 1,0,0,0,0,0,0,0,2
+//	                           .zero 23
+//
+// A multi-dimensional array's rows are flattened by the parser. A string
+// initializes a char array with its characters. A pointer's value can be an
+// address the linker fills in (DataAddress): a string's, a function's, or
+// a global's or its element's, plus a constant; it's emitted as a .quad of
+// the symbol in the place of the eightbyte:
+//
+//	char *names[] = {"zero", "one"};    .quad .str_1
+//	                                    .quad .str_2
+//
+// Anything else that isn't a constant is an error.
+
+// DataAddress is an address in a global's initializer: Symbol's plus
+// Addend, stored in the eightbyte at Offset
+type DataAddress struct {
+	Offset int
+	Symbol string
+	Addend int
+}
+
+// dataLayout is a global's initialized bytes and the addresses among them
+type dataLayout struct {
+	data  []byte
+	addrs []DataAddress
+}
+
+// globalData lays out value, the brace initializer of the size-byte global
+// of type typ (an array of arraySize of them if arraySize > 0)
+func (is *InstructionSelector) globalData(typ string, size, arraySize int, value *ASTNode) ([]byte, []DataAddress, error) {
+	out := &dataLayout{data: make([]byte, size)}
+	if err := is.layoutData(out, 0, size, typ, arraySize, value); err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(out.addrs, func(i, j int) bool { return out.addrs[i].Offset < out.addrs[j].Offset })
+	return out.data, out.addrs, nil
+}
+
+// layoutData writes value, the initializer of the size-byte object of type
+// typ at offset, into out
+func (is *InstructionSelector) layoutData(out *dataLayout, offset, size int, typ string, arraySize int, value *ASTNode) error {
+	if value.Type == NodeString && arraySize > 0 {
+		// A char array's characters; the rest, with the NUL, stay zero
+		stride := size / arraySize
+		for i := 0; i < arraySize && i < len(value.Value); i++ {
+			out.data[offset+i*stride] = value.Value[i]
+		}
+		return nil
+	}
+	if value.Type != NodeCompoundLiteral || (value.ArraySize > 0 && arraySize == 0) {
+		return is.putConstant(out, offset, size, typ, value)
+	}
+
+	if arraySize > 0 {
+		stride := size / arraySize
+		for i, child := range value.Children {
+			index := i
+			if i < len(value.InitFields) && strings.HasPrefix(value.InitFields[i], "[") {
+				fmt.Sscanf(value.InitFields[i], "[%d]", &index)
+			}
+			if index >= arraySize {
+				return fmt.Errorf("too many initializers for %s[%d]", typ, arraySize)
+			}
+			if err := is.layoutData(out, offset+index*stride, stride, typ, 0, child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	structDef, ok := is.structDefOf(typ)
+	if !ok {
+		// {v} for a scalar
+		if len(value.Children) == 0 {
+			return nil
+		}
+		return is.layoutData(out, offset, size, typ, 0, value.Children[0])
+	}
+	for i, child := range value.Children {
+		var member StructMember
+		if i >= len(value.InitFields) || value.InitFields[i] == "" {
+			if i >= len(structDef.Members) {
+				return fmt.Errorf("too many initializers for struct %s", structDef.Name)
+			}
+			member = structDef.Members[i]
+		} else {
+			found, err := is.lookupMember(typ, value.InitFields[i])
+			if err != nil {
+				return err
+			}
+			member = found
+		}
+		end := min(member.Offset+member.Size, size)
+		if err := is.layoutData(out, offset+member.Offset, end-member.Offset, member.Type, member.ArraySize, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putConstant writes the value of the size-byte scalar of type typ at
+// offset into out, as many of its bytes as there's room for
+func (is *InstructionSelector) putConstant(out *dataLayout, offset, size int, typ string, value *ASTNode) error {
+	data := out.data[offset : offset+size]
+	width := min(len(data), 8)
+	if symbol, addend, ok := is.addressConstant(value); ok {
+		if width != 8 {
+			return fmt.Errorf("initializer element is not computable at load time (an address in %d bytes)", width)
+		}
+		out.addrs = append(out.addrs, DataAddress{Offset: offset, Symbol: symbol, Addend: addend})
+		return nil
+	}
+	if width != 1 && width != 2 && width != 4 && width != 8 {
+		return nil
+	}
+	val, floating, isConst := constantInitializer(value)
+	if isConst && (floating || is.isFloatingType(typ)) {
+		f, err := strconv.ParseFloat(strings.TrimRight(val, "fFlL"), 64)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a floating constant", val)
+		}
+		switch {
+		case !is.isFloatingType(typ):
+			encoderX86_64.Put(data, uint64(int64(f)), width)
+		case is.types().SizeOf(typ) == 4:
+			encoderX86_64.Put(data, uint64(math.Float32bits(float32(f))), 4)
+		default:
+			encoderX86_64.Put(data, math.Float64bits(f), width)
+		}
+		return nil
+	}
+	n, err := evalConstant(value, is.enumConstant)
+	if err != nil {
+		return fmt.Errorf("initializer element is not constant: %w", err)
+	}
+	encoderX86_64.Put(data, uint64(n), width)
+	return nil
+}
+
+// scalarInitializer sets the InitValue of sym, a scalar global, from its
+// initializer: a constant, or an address the linker fills in
+func (is *InstructionSelector) scalarInitializer(sym *Symbol, value *ASTNode) error {
+	if val, floating, ok := constantInitializer(value); ok {
+		sym.InitValue = val
+		sym.InitFloat = floating
+		return nil
+	}
+	if symbol, addend, ok := is.addressConstant(value); ok {
+		if sym.Size != 8 {
+			return fmt.Errorf("initializer element is not computable at load time (an address in %d bytes)", sym.Size)
+		}
+		sym.InitValue = symbol
+		if addend != 0 {
+			sym.InitValue += fmt.Sprintf("%+d", addend)
+		}
+		return nil
+	}
+	n, err := evalConstant(value, is.enumConstant)
+	if err != nil {
+		return fmt.Errorf("initializer element is not constant: %w", err)
+	}
+	sym.InitValue = strconv.FormatInt(n, 10)
+	return nil
+}
+
+// addressConstant reads value as an address the linker can fill in: a
+// string, function or array, or the address of a global, an element of a
+// global array or a member of a global struct, plus or minus a constant
+// number of elements. It
+// returns the symbol and the offset from it in bytes.
+func (is *InstructionSelector) addressConstant(value *ASTNode) (string, int, bool) {
+	switch value.Type {
+	case NodeString:
+		return is.stringLabel(value.Value), 0, true
+	case NodeCast:
+		if len(value.Children) == 1 {
+			return is.addressConstant(value.Children[0])
+		}
+	case NodeIdentifier:
+		if sym, ok := is.globalVars[value.VarName]; ok && sym.ArraySize > 0 {
+			return value.VarName, 0, true
+		}
+		if _, ok := is.functions[value.VarName]; ok {
+			if _, shadowed := is.globalVars[value.VarName]; !shadowed {
+				return value.VarName, 0, true
+			}
+		}
+	case NodeUnaryOp:
+		if value.Operator != "&" || len(value.Children) != 1 {
+			break
+		}
+		target := value.Children[0]
+		if target.Type == NodeIdentifier {
+			if _, ok := is.functions[target.VarName]; ok {
+				if _, shadowed := is.globalVars[target.VarName]; !shadowed {
+					return target.VarName, 0, true
+				}
+			}
+		}
+		if symbol, offset, _, ok := is.objectAddress(target); ok {
+			return symbol, offset, true
+		}
+	case NodeBinaryOp:
+		if value.Operator != "+" && value.Operator != "-" {
+			break
+		}
+		symbol, addend, ok := is.addressConstant(value.Children[0])
+		n, err := evalConstant(value.Children[1], is.enumConstant)
+		if !ok || err != nil {
+			break
+		}
+		stride := 1 // a string's chars
+		base := value.Children[0]
+		if base.Type == NodeUnaryOp && base.Operator == "&" && len(base.Children) == 1 && base.Children[0].Type == NodeArrayAccess {
+			base = base.Children[0].Children[0] // &a[i] + n steps over a's elements
+		}
+		if base.Type == NodeIdentifier {
+			if sym, ok := is.globalVars[base.VarName]; ok && sym.ArraySize > 0 {
+				stride = is.elementStride(sym)
+			}
+		}
+		if value.Operator == "-" {
+			n = -n
+		}
+		return symbol, addend + int(n)*stride, true
+	}
+	return "", 0, false
+}
+
+// objectAddress reads target as an object at a fixed place in a global: the
+// global itself, an element at a constant index or a member of a struct.
+// It returns the object's type with its place.
+func (is *InstructionSelector) objectAddress(target *ASTNode) (string, int, string, bool) {
+	switch target.Type {
+	case NodeIdentifier:
+		if sym, ok := is.globalVars[target.VarName]; ok {
+			return target.VarName, 0, sym.Type, true
+		}
+	case NodeArrayAccess:
+		array := target.Children[0]
+		index, err := evalConstant(target.Children[1], is.enumConstant)
+		if err != nil || array.Type != NodeIdentifier {
+			break
+		}
+		if sym, ok := is.globalVars[array.VarName]; ok && sym.ArraySize > 0 {
+			return array.VarName, int(index) * is.elementStride(sym), sym.Type, true
+		}
+	case NodeMemberAccess:
+		if target.Operator != "." || len(target.Children) != 1 {
+			break
+		}
+		symbol, offset, structType, ok := is.objectAddress(target.Children[0])
+		if !ok {
+			break
+		}
+		if member, err := is.lookupMember(structType, target.MemberName); err == nil {
+			return symbol, offset + member.Offset, member.Type, true
+		}
+	}
+	return "", 0, "", false
+}
+
+// elementStride is the distance between a global array's elements: a
+// struct's size, or an eightbyte slot for scalars (see NodeArrayAccess)
+func (is *InstructionSelector) elementStride(sym *Symbol) int {
+	return sym.Size / sym.ArraySize
+}
+
+// dataDirectives writes data as .byte runs, with .zero for runs of zeros,
+// and the addresses in it as .quad directives
+func dataDirectives(data []byte, addrs []DataAddress) []string {
+	var lines []string
+	start := 0
+	for _, addr := range addrs {
+		lines = append(lines, byteDirectives(data[start:addr.Offset])...)
+		target := addr.Symbol
+		if addr.Addend != 0 {
+			target += fmt.Sprintf("%+d", addr.Addend)
+		}
+		lines = append(lines, ".quad "+target)
+		start = addr.Offset + 8
+	}
+	return append(lines, byteDirectives(data[start:])...)
+}
+
+// byteDirectives writes data as .byte runs, with .zero for runs of zeros
+func byteDirectives(data []byte) []string {
+	var lines []string
+	for i := 0; i < len(data); {
+		zeros := i
+		for zeros < len(data) && data[zeros] == 0 {
+			zeros++
+		}
+		if zeros-i >= 8 || zeros == len(data) {
+			lines = append(lines, fmt.Sprintf(".zero %d", zeros-i))
+			i = zeros
+			continue
+		}
+		var bytes []string
+		for ; i < len(data) && len(bytes) < 16; i++ {
+			if data[i] == 0 && i+8 <= len(data) && allZero(data[i:i+8]) {
+				break
+			}
+			bytes = append(bytes, strconv.Itoa(int(data[i])))
+		}
+		lines = append(lines, ".byte "+strings.Join(bytes, ","))
+	}
+	return lines
+}
+
+// allZero reports whether every byte of data is 0
+func allZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
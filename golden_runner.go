@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Golden-output test runner: ccompiler test <dir> [--update] [options]
+// Every .c file in dir is compiled (with the usual compiler options), run,
+// and its stdout and exit code compared with <name>.expected next to it.
+// A golden file is the expected stdout, optionally followed by a last line
+// "[exit N]" when the program should exit with N rather than 0, or just
+// "[compile error]" for input the compiler must reject (cleanly: a hang or
+// panic still fails). Files without a golden file are skipped; --update
+// (re)writes the golden files from what the programs do now. Under
+// -fsyntax-only nothing is linked or run, so only compile errors tell.
+// With -jit each program is run in memory by a child compiler, given the
+// same options; with -emit-artifacts the JSON a child writes for each one
+// is its output.
+
+// goldenRunTimeout bounds each test program's run
+const goldenRunTimeout = 10 * time.Second
+
+var goldenExitLine = regexp.MustCompile(`(?m)^\[exit (-?\d+)\]\n?\z`)
+
+const goldenCompileError = "[compile error]\n"
+
+// goldenResult is what one test program did
+type goldenResult struct {
+	stdout       string
+	exitCode     int
+	compileError bool
+}
+
+// String renders a result in golden file form
+func (r goldenResult) String() string {
+	if r.compileError {
+		return goldenCompileError
+	}
+	if r.exitCode == 0 {
+		return r.stdout
+	}
+	out := r.stdout
+	if out != "" && !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	return out + fmt.Sprintf("[exit %d]\n", r.exitCode)
+}
+
+// parseGolden reads a golden file
+func parseGolden(text string) goldenResult {
+	if text == goldenCompileError {
+		return goldenResult{compileError: true}
+	}
+	if m := goldenExitLine.FindStringSubmatchIndex(text); m != nil {
+		code, _ := strconv.Atoi(text[m[2]:m[3]])
+		return goldenResult{stdout: text[:m[0]], exitCode: code}
+	}
+	return goldenResult{stdout: text}
+}
+
+// runTestCommand implements the test subcommand and returns the exit status
+func runTestCommand(args []string) int {
+	update := false
+	var rest []string
+	for _, arg := range args {
+		if arg == "--update" {
+			update = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	cl, err := parseCommandLine(rest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	dir := cl.sourceFile
+	if dir == "" {
+		fmt.Fprintln(os.Stderr, "Usage: ccompiler test <dir> [--update] [options]")
+		return 2
+	}
+	sources, err := filepath.Glob(filepath.Join(dir, "*.c"))
+	if err != nil || len(sources) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no .c files in %s\n", dir)
+		return 2
+	}
+	sort.Strings(sources)
+
+	workDir, err := os.MkdirTemp("", "ccompiler-test-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	defer os.RemoveAll(workDir)
+
+	var flags []string // the options, for a -jit child
+	for _, arg := range rest {
+		if arg != dir {
+			flags = append(flags, arg)
+		}
+	}
+
+	passed, failed, skipped := 0, 0, 0
+	for _, source := range sources {
+		name := strings.TrimSuffix(filepath.Base(source), ".c")
+		goldenPath := strings.TrimSuffix(source, ".c") + ".expected"
+		golden, readErr := os.ReadFile(goldenPath)
+		if readErr != nil && !update {
+			skipped++
+			fmt.Printf("SKIP  %s (no %s)\n", name, filepath.Base(goldenPath))
+			continue
+		}
+
+		var got goldenResult
+		if cl.jitMode || cl.artifacts {
+			got, err = runChild(source, flags)
+		} else {
+			got, err = compileAndRun(source, filepath.Join(workDir, name), cl.options)
+		}
+		if got.compileError && (update || parseGolden(string(golden)).compileError) {
+			err = nil
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL  %s: %v\n", name, err)
+			continue
+		}
+		if update {
+			if err := os.WriteFile(goldenPath, []byte(got.String()), 0644); err != nil {
+				failed++
+				fmt.Printf("FAIL  %s: %v\n", name, err)
+				continue
+			}
+			passed++
+			fmt.Printf("WROTE %s\n", filepath.Base(goldenPath))
+			continue
+		}
+		if want := parseGolden(string(golden)); got != want {
+			failed++
+			fmt.Printf("FAIL  %s: %s\n", name, describeMismatch(want, got))
+			continue
+		}
+		passed++
+		fmt.Printf("PASS  %s\n", name)
+	}
+
+	fmt.Printf("\n%d passed, %d failed, %d skipped\n", passed, failed, skipped)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// compileAndRun builds source into binary and runs it. If it doesn't
+// compile the result is marked compileError, along with the error.
+func compileAndRun(source, binary string, options CompilerOptions) (result goldenResult, err error) {
+	text, err := os.ReadFile(source)
+	if err != nil {
+		return goldenResult{}, err
+	}
+	// A compiler bug shouldn't take the rest of the run down with it
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = goldenResult{}, fmt.Errorf("compiler panicked: %v", r)
+		}
+	}()
+	options.SourceFile = source
+	compiler := NewCompilerPipeline(string(text), options)
+	if err := compiler.Compile(); err != nil {
+		return goldenResult{compileError: true}, fmt.Errorf("compile: %v", err)
+	}
+	if options.SyntaxOnly {
+		return goldenResult{}, nil
+	}
+	if err := compiler.AssembleAndLink(binary); err != nil {
+		return goldenResult{}, fmt.Errorf("link: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), goldenRunTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, binary)
+	cmd.Dir = filepath.Dir(source)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return goldenResult{}, fmt.Errorf("timed out after %v", goldenRunTimeout)
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return goldenResult{}, fmt.Errorf("run: %v", err)
+	}
+	return goldenResult{stdout: stdout.String(), exitCode: cmd.ProcessState.ExitCode()}, nil
+}
+
+// runChild runs a child compiler on source given flags (-jit, so a program
+// that crashes doesn't take the runner with it, or -emit-artifacts). The
+// first line the child writes to stderr is its error.
+func runChild(source string, flags []string) (goldenResult, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return goldenResult{}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), goldenRunTimeout)
+	defer cancel()
+	// Named from its own directory, where the child runs, so the paths it
+	// reports don't depend on where the tree is
+	cmd := exec.CommandContext(ctx, self, append(flags, filepath.Base(source))...)
+	cmd.Dir = filepath.Dir(source)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return goldenResult{}, fmt.Errorf("timed out after %v", goldenRunTimeout)
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return goldenResult{}, fmt.Errorf("run: %v", err)
+	}
+	if message := strings.TrimSpace(stderr.String()); message != "" {
+		if strings.HasPrefix(message, "Compilation error") {
+			return goldenResult{compileError: true}, fmt.Errorf("compile: %s", message)
+		}
+		message, _, _ = strings.Cut(message, "\n")
+		return goldenResult{}, errors.New(message)
+	}
+	return goldenResult{stdout: stdout.String(), exitCode: cmd.ProcessState.ExitCode()}, nil
+}
+
+// describeMismatch says how a result differs from the golden one
+func describeMismatch(want, got goldenResult) string {
+	if want.compileError {
+		return "compiled, expected a compile error"
+	}
+	if want.stdout == got.stdout {
+		return fmt.Sprintf("exit code %d, expected %d", got.exitCode, want.exitCode)
+	}
+	wantLines := strings.Split(want.stdout, "\n")
+	gotLines := strings.Split(got.stdout, "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g || i >= len(wantLines) || i >= len(gotLines) {
+			return fmt.Sprintf("stdout line %d is %q, expected %q", i+1, g, w)
+		}
+	}
+	return "stdout differs"
+}
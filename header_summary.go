@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Header summaries
+// What the preprocessor learns from scanning a header (its struct typedefs,
+// simple typedefs and function declarations) is a HeaderSummary. Scanning
+// large headers like raylib.h on every compile is wasted work, so summaries
+// are cached by a hash of the header's contents and the target spec: in
+// memory for the life of the process, and on disk next to the compile cache
+// (unless -fno-cache). Enum constants aren't summarized; they reach the
+// parser with the header's text.
+//
+// Summaries can also be written out and read back for any set of headers:
+// -emit-header-summaries=<file> saves those of every header a compile
+// includes, and -header-summaries=<file> applies a saved set before
+// preprocessing, so the types are known whether or not the headers are.
+
+// HeaderSummary is what one header defines
+type HeaderSummary struct {
+	Path      string                        `json:"path,omitempty"`
+	Types     []*HeaderType                 `json:"types,omitempty"` // in definition order
+	Functions map[string]*FunctionSignature `json:"functions,omitempty"`
+}
+
+// HeaderType is a typedef: of a struct defined in place (Members, and Tag
+// if the struct is named), of a pointer to a function or an array
+// (Typedef), or of another type (Alias)
+type HeaderType struct {
+	Name    string         `json:"name"`
+	Tag     string         `json:"tag,omitempty"`
+	Members []StructMember `json:"members,omitempty"`
+	Typedef *TypedefType   `json:"typedef,omitempty"`
+	Alias   string         `json:"alias,omitempty"`
+}
+
+// headerSummaryCache holds the summaries computed or loaded in this process
+var headerSummaryCache sync.Map // key -> *HeaderSummary
+
+// summarizeHeader returns the summary of a header's content, from the cache
+// when it has been scanned before, and records it for HeaderSummaries
+func (p *Preprocessor) summarizeHeader(path string, content []byte) *HeaderSummary {
+	h := sha256.New()
+	writeCompilerStamp(h)
+	h.Write(p.target.JSON())
+	h.Write(content)
+	key := hex.EncodeToString(h.Sum(nil))
+
+	summary := p.cachedHeaderSummary(key)
+	if summary == nil {
+		summary = p.scanHeader(content)
+		headerSummaryCache.Store(key, summary)
+		p.storeHeaderSummary(key, summary)
+	}
+	recorded := *summary
+	recorded.Path = path
+	p.summaries = append(p.summaries, &recorded)
+	return summary
+}
+
+// headerSummaryDir is where summaries are kept on disk, or "" if nowhere
+func (p *Preprocessor) headerSummaryDir() string {
+	if !p.headerCache {
+		return ""
+	}
+	dir := compileCacheDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "headers")
+}
+
+func (p *Preprocessor) cachedHeaderSummary(key string) *HeaderSummary {
+	if summary, ok := headerSummaryCache.Load(key); ok {
+		return summary.(*HeaderSummary)
+	}
+	dir := p.headerSummaryDir()
+	if dir == "" {
+		return nil
+	}
+	data, err := p.fs.ReadFile(filepath.Join(dir, key+".json"))
+	if err != nil {
+		return nil
+	}
+	summary := &HeaderSummary{}
+	if json.Unmarshal(data, summary) != nil {
+		return nil
+	}
+	headerSummaryCache.Store(key, summary)
+	return summary
+}
+
+// storeHeaderSummary saves a summary to disk. Failing to is harmless.
+func (p *Preprocessor) storeHeaderSummary(key string, summary *HeaderSummary) {
+	dir := p.headerSummaryDir()
+	if dir == "" || os.MkdirAll(dir, 0755) != nil {
+		return
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return
+	}
+	writeCacheFile(dir, key+".json", data)
+}
+
+// HeaderSummaries are the summaries of the headers included so far, in
+// the order they were included
+func (p *Preprocessor) HeaderSummaries() []*HeaderSummary {
+	return p.summaries
+}
+
+// WriteHeaderSummaries saves a set of summaries to a file
+func WriteHeaderSummaries(path string, summaries []*HeaderSummary) error {
+	data, err := json.MarshalIndent(summaries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ReadHeaderSummaries loads a set of summaries written by WriteHeaderSummaries
+func ReadHeaderSummaries(fsys SourceFS, path string) ([]*HeaderSummary, error) {
+	data, err := fsys.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("header summaries: %w", err)
+	}
+	var summaries []*HeaderSummary
+	if err := json.Unmarshal(data, &summaries); err != nil {
+		return nil, fmt.Errorf("header summaries %s: %w", path, err)
+	}
+	return summaries, nil
+}
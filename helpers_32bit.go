@@ -1,81 +1,57 @@
 package main
 
-import "fmt"
-
-// formatOperand32 formats operands for 32-bit operations (int types)
-func (ce *CodeEmitter) formatOperand32(op *Operand) string {
+// operand32 is op as the operand of a 32-bit operation (int types)
+func (ce *CodeEmitter) operand32(op *Operand) MachineOperand {
 	if op == nil {
-		return ""
+		return SymOp("")
 	}
 	
 	switch op.Type {
 	case "reg":
 		// Convert 64-bit register to 32-bit equivalent
-		return "%" + ce.reg64to32(op.Value)
+		return RegOp(ce.reg64to32(op.Value))
 	case "freg":
-		return "%" + op.Value
+		return RegOp(op.Value)
 	case "imm":
-		// Convert escape sequences to numeric values for assembly
-		val := op.Value
-		if val == "\\0" {
-			val = "0"
-		} else if val == "\\n" {
-			val = "10"
-		} else if val == "\\t" {
-			val = "9"
-		} else if val == "\\r" {
-			val = "13"
-		} else if val == "\\\\" {
-			val = "92"
-		} else if val == "\\'" {
-			val = "39"
-		} else if val == "\\\"" {
-			val = "34"
-		}
-		return "$" + val
+		return immOperand(op)
 	case "label":
-		return op.Value
+		return SymOp(op.Value)
 	case "mem":
-		if op.Offset == 0 {
-			return "(%rbp)"
-		}
-		return fmt.Sprintf("%d(%%rbp)", op.Offset)
+		return MemOp("rbp", int64(op.Offset))
 	case "var":
 		if op.IsGlobal {
-			return op.Value + "(%rip)"
+			return globalAddr(op)
 		}
-		return fmt.Sprintf("%d(%%rbp)", op.Offset)
+		return MemOp("rbp", int64(op.Offset))
 	case "array":
 		// arr[index] where index is in IndexTemp
 		if op.IndexTemp != nil {
-			indexReg := ce.formatOperand32(op.IndexTemp)
+			index := ce.operand32(op.IndexTemp)
 			if op.IsGlobal {
-				return fmt.Sprintf("%s(%s, %s, 1)", op.Value, "%rip", indexReg)
+				return RIPOp(op.Value).Indexed(index.Reg, 1)
 			}
-			return fmt.Sprintf("%d(%%rbp, %s, 1)", op.Offset, indexReg)
+			return MemOp("rbp", int64(op.Offset)).Indexed(index.Reg, 1)
 		}
-		return fmt.Sprintf("%d(%%rbp)", op.Offset)
+		return MemOp("rbp", int64(op.Offset))
 	case "addr":
 		// Address of variable - use lea
 		if op.IsGlobal {
-			return op.Value + "(%rip)"
+			return globalAddr(op)
 		}
-		return fmt.Sprintf("%d(%%rbp)", op.Offset)
+		return MemOp("rbp", int64(op.Offset))
 	case "ptr":
 		// Dereference - load from address in IndexTemp
 		if op.IndexTemp != nil {
-			ptrReg := ce.formatOperand32(op.IndexTemp)
-			return fmt.Sprintf("(%s)", ptrReg)
+			return MemOp(ce.operand32(op.IndexTemp).Reg, 0)
 		}
 		if op.SourcePtr != nil {
 			// Use the source pointer
-			ptrReg := ce.formatOperand32(op.SourcePtr)
-			return fmt.Sprintf("(%s)", ptrReg)
+			return MemOp(ce.operand32(op.SourcePtr).Reg, 0)
 		}
-		return fmt.Sprintf("(%%%s)", op.Value)
+		return MemOp(op.Value, 0)
 	}
 	
-	return ""
+	return SymOp("")
 }
 
 // reg64to32 converts 64-bit register names to 32-bit equivalents
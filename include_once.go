@@ -0,0 +1,165 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Include once
+// A header is known by its canonical path (absolute and cleaned, with
+// symlinks resolved on the real filesystem), however the #include spelled
+// it: "util.h", "./util.h" and "lib/../util.h" are one header. A quoted
+// #include searches the including file's directory first, then the include
+// paths.
+//
+// A header is skipped when it's included again and
+//
+//	it said #pragma once
+//	it's wrapped in an include guard whose macro is still defined:
+//	    #ifndef UTIL_H / #define UTIL_H ... #endif, with nothing but
+//	    comments outside (#if !defined(UTIL_H) works too)
+//	it's still being processed, including itself through others
+//
+// so each contributes its declarations once, and headers that include each
+// other terminate. One with no guard is included again each time, as C
+// says, for headers written to be (X macros).
+
+// canonicalPath is the path a header is known by
+func (p *Preprocessor) canonicalPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if real, err := p.fs.EvalSymlinks(path); err == nil {
+		path = real
+	}
+	return filepath.Clean(path)
+}
+
+// findInclude is the path of the header a quoted #include names
+func (p *Preprocessor) findInclude(filename string) (string, bool) {
+	if filepath.IsAbs(filename) {
+		return filename, p.fs.Exists(filename)
+	}
+	var dirs []string
+	if includer := p.currentFile(); includer != "<stdin>" {
+		dirs = append(dirs, filepath.Dir(includer))
+	}
+	for _, dir := range append(dirs, p.includePaths...) {
+		if path := filepath.Join(dir, filename); p.fs.Exists(path) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// includedOnce reports whether the header at path (canonical) is to be
+// skipped
+func (p *Preprocessor) includedOnce(path string) bool {
+	if p.onceFiles[path] {
+		return true
+	}
+	if guard, ok := p.guards[path]; ok && p.IsDefined(guard) {
+		return true
+	}
+	for _, open := range p.including {
+		if open == path {
+			return true
+		}
+	}
+	return false
+}
+
+// pragmaOnce handles #pragma once in the header being processed
+func (p *Preprocessor) pragmaOnce() {
+	if p.file != "" {
+		p.onceFiles[p.canonicalPath(p.file)] = true
+	}
+}
+
+// includeGuard is the macro guarding a header's content, or "" if it isn't
+// wrapped in one
+func includeGuard(content string) string {
+	guard, depth := "", 0
+	closed := false // the guard's #endif has been seen
+	inComment := false
+	for _, line := range spliceContinuations(strings.Split(content, "\n")) {
+		line, inComment = stripComments(line, inComment)
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if closed {
+			// Something after the #endif
+			return ""
+		}
+		fields := strings.Fields(strings.TrimSpace(strings.TrimPrefix(line, "#")))
+		if !strings.HasPrefix(line, "#") || len(fields) == 0 {
+			if guard == "" || depth == 0 {
+				return ""
+			}
+			continue
+		}
+		switch {
+		case guard == "":
+			// The first directive opens the guard
+			guard = guardMacro(fields)
+			if guard == "" {
+				return ""
+			}
+			depth = 1
+		case fields[0] == "if" || fields[0] == "ifdef" || fields[0] == "ifndef":
+			depth++
+		case fields[0] == "endif":
+			depth--
+			closed = depth == 0
+		case depth == 1 && (fields[0] == "else" || fields[0] == "elif"):
+			return ""
+		}
+	}
+	if !closed {
+		return ""
+	}
+	return guard
+}
+
+// guardMacro is X for #ifndef X or #if !defined(X), and otherwise ""
+func guardMacro(fields []string) string {
+	switch {
+	case fields[0] == "ifndef" && len(fields) == 2:
+		return fields[1]
+	case fields[0] == "if":
+		cond := strings.Join(fields[1:], "")
+		if strings.HasPrefix(cond, "!defined") {
+			name := strings.Trim(strings.TrimPrefix(cond, "!defined"), "()")
+			if name != "" && identEnd(name, 0) == len(name) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// stripComments removes the comments from line, inComment saying whether
+// it starts inside a block comment; the result says whether the next line
+// does
+func stripComments(line string, inComment bool) (string, bool) {
+	var out strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case inComment:
+			if strings.HasPrefix(line[i:], "*/") {
+				inComment = false
+				i++
+			}
+		case strings.HasPrefix(line[i:], "//"):
+			return out.String(), false
+		case strings.HasPrefix(line[i:], "/*"):
+			inComment = true
+			out.WriteByte(' ')
+			i++
+		default:
+			out.WriteByte(line[i])
+		}
+	}
+	return out.String(), inComment
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Brace initializers
+// A brace initializer (NodeCompoundLiteral) is written straight into the
+// stack object it initializes: the object is zeroed, then each value is
+// stored at the offset of the member or element the parser labeled it with
+// (InitFields: a member name, or "[index]"), recursing into nested braces.
+// So {{0, 0}, {1, 1}} fills an array of structs in place, and .inner = {.x
+// = 1} a struct member, without a temporary for each level.
+
+// initialize stores value, the initializer of the size-byte object of type
+// typ at offset(%rbp), which is already zero. An array (arraySize > 0) is
+// of arraySize elements of typ, size/arraySize bytes apart.
+func (is *InstructionSelector) initialize(offset int, typ string, size, arraySize int, value *ASTNode) error {
+	if value.Type != NodeCompoundLiteral || (value.ArraySize > 0 && arraySize == 0) {
+		// An expression, including a compound literal that's a value of
+		// its own ((int[]){1, 2} for a pointer)
+		var operand *Operand
+		var err error
+		if is.isStructValue(value) {
+			operand, err = is.selectStructValue(value)
+		} else {
+			operand, err = is.selectExpression(value)
+		}
+		if err != nil {
+			return err
+		}
+		is.storeSlotField(offset, typ, size, operand)
+		return nil
+	}
+
+	if arraySize > 0 {
+		stride := size / arraySize
+		for i, child := range value.Children {
+			index := i
+			if i < len(value.InitFields) && strings.HasPrefix(value.InitFields[i], "[") {
+				fmt.Sscanf(value.InitFields[i], "[%d]", &index)
+			}
+			if index >= arraySize {
+				return fmt.Errorf("too many initializers for %s[%d]", typ, arraySize)
+			}
+			if err := is.initialize(offset+index*stride, typ, stride, 0, child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	structDef, ok := is.structDefOf(typ)
+	if !ok {
+		// {v} for a scalar
+		if len(value.Children) == 0 {
+			return nil
+		}
+		return is.initialize(offset, typ, size, 0, value.Children[0])
+	}
+	for i, child := range value.Children {
+		// Positional by index (the parser names them when it knows the
+		// struct), designated by name
+		var member StructMember
+		if i >= len(value.InitFields) || value.InitFields[i] == "" {
+			if i >= len(structDef.Members) {
+				return fmt.Errorf("too many initializers for struct %s", structDef.Name)
+			}
+			member = structDef.Members[i]
+		} else {
+			found, err := is.lookupMember(typ, value.InitFields[i])
+			if err != nil {
+				return err
+			}
+			member = found
+		}
+		if err := is.initialize(offset+member.Offset, member.Type, member.Size, member.ArraySize, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import "strings"
+
+// Function inlining (-O2)
+// After selection, calls to small functions are replaced by a copy of the
+// callee's IR. The copy works because of how calls are selected: the caller
+// has already loaded the argument registers with OpSetArg, and the callee
+// starts by storing those registers into its parameter slots, so the cloned
+// body picks its arguments up unchanged. Cloning renames the callee's temps
+// and local labels, moves its stack slots below the caller's, and turns each
+// return into a jump to the end of the copy, where the call's result is
+// taken from %rax as after a real call.
+//
+// A callee is inlined if its body has at most -finline-limit instructions,
+// it doesn't call itself or setjmp (see setjmp.go), and nothing about its calling convention lives
+// outside the argument registers: no variadic parameters, no struct
+// parameters or results, no more than six parameters, not ms_abi.
+
+// defaultInlineLimit is the -finline-limit used when none is given
+const defaultInlineLimit = 24
+
+// inlineCalls inlines calls to small functions throughout the program
+func (is *InstructionSelector) inlineCalls(limit int) {
+	if limit <= 0 {
+		limit = defaultInlineLimit
+	}
+	bodies := is.functionBodies()
+	candidates := make(map[string][]*IRInstruction) // without entry labels
+	for name, body := range bodies {
+		if is.inlinable(name, body, limit) {
+			candidates[name] = body
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	instrs := is.instructions
+	is.instructions = make([]*IRInstruction, 0, len(instrs))
+	caller := ""
+	for _, instr := range instrs {
+		if instr.Op == OpLabel && isFunctionLabel(instr.Dst.Value) {
+			caller = instr.Dst.Value
+		}
+		if instr.Op == OpCall && (instr.Dst == nil || instr.Dst.Type == "temp") {
+			callee := instr.Src1.Value
+			if body, ok := candidates[callee]; ok && callee != caller && is.frames[caller] != nil && is.frames[callee] != nil {
+				// Place the callee's slots below everything the caller
+				// (including what's been inlined into it so far) uses
+				depth := is.frames[caller].AllocFrame(is.frames[callee])
+				is.inlineBody(body, instr.Dst, depth)
+				continue
+			}
+		}
+		is.instructions = append(is.instructions, instr)
+	}
+}
+
+// functionBodies splits the IR into functions, keyed by name
+func (is *InstructionSelector) functionBodies() map[string][]*IRInstruction {
+	bodies := make(map[string][]*IRInstruction)
+	name := ""
+	for _, instr := range is.instructions {
+		if instr.Op == OpLabel && isFunctionLabel(instr.Dst.Value) {
+			name = instr.Dst.Value
+			bodies[name] = nil
+			continue
+		}
+		if name != "" {
+			bodies[name] = append(bodies[name], instr)
+		}
+	}
+	return bodies
+}
+
+// inlinable reports whether calls to name may be replaced by body
+func (is *InstructionSelector) inlinable(name string, body []*IRInstruction, limit int) bool {
+	sig, ok := is.functions[name]
+	if !ok || name == "main" || sig.Variadic || sig.MSABI || len(sig.ParamTypes) > 6 || len(body) > limit {
+		return false
+	}
+	if is.isStructType(sig.ReturnType) {
+		return false
+	}
+	for _, param := range sig.ParamTypes {
+		if is.isStructType(param) {
+			return false
+		}
+	}
+	for _, instr := range body {
+		if instr.Op == OpCall && instr.Src1 != nil && instr.Src1.Value == name || callsReturnTwice(instr) {
+			return false
+		}
+	}
+	return true
+}
+
+// inlineBody appends a copy of body whose result lands in result (nil for
+// a void callee). The callee's frame is placed depth bytes below the
+// caller's frame pointer.
+func (is *InstructionSelector) inlineBody(body []*IRInstruction, result *Operand, depth int) {
+	temps := make(map[string]string)
+	labels := make(map[string]string)
+	for _, instr := range body {
+		if instr.Op == OpLabel {
+			labels[instr.Dst.Value] = is.newLabel(instr.Dst.Value + "_inl")
+		}
+	}
+	endLabel := is.newLabel(".L_inline_end")
+
+	// The allocator rewrites temps in place, relying on address operands
+	// sharing the temp's Operand, so sharing is kept in the copy
+	cloned := make(map[*Operand]*Operand)
+	var clone func(op *Operand) *Operand
+	clone = func(op *Operand) *Operand {
+		if op == nil {
+			return nil
+		}
+		if c, ok := cloned[op]; ok {
+			return c
+		}
+		copied := *op
+		cloned[op] = &copied
+		copied.IndexTemp = clone(op.IndexTemp)
+		copied.SourcePtr = clone(op.SourcePtr)
+		switch op.Type {
+		case "temp":
+			renamed, ok := temps[op.Value]
+			if !ok {
+				renamed = is.newTemp().Value
+				temps[op.Value] = renamed
+			}
+			copied.Value = renamed
+		case "label":
+			if renamed, ok := labels[op.Value]; ok {
+				copied.Value = renamed
+			}
+		case "mem", "var", "array", "addr":
+			if !op.IsGlobal && op.Offset < 0 {
+				copied.Offset -= depth
+			}
+		}
+		return &copied
+	}
+
+	for i, instr := range body {
+		if instr.Op == OpRet {
+			if i < len(body)-1 {
+				is.emit(OpJmp, &Operand{Type: "label", Value: endLabel}, nil, nil)
+			}
+			continue
+		}
+		is.line, is.column = instr.Line, instr.Column
+		is.emit(instr.Op, clone(instr.Dst), clone(instr.Src1), clone(instr.Src2))
+		is.instructions[len(is.instructions)-1].Func = instr.Func
+		is.instructions[len(is.instructions)-1].Clobbers = instr.Clobbers
+		is.instructions[len(is.instructions)-1].Volatile = instr.Volatile
+	}
+	is.emit(OpLabel, &Operand{Type: "label", Value: endLabel}, nil, nil)
+	if result == nil {
+		return
+	}
+	is.emit(OpMov, result, &Operand{Type: "reg", Value: is.target.CallingConvention().IntResults[0]}, nil)
+}
+
+// isFunctionLabel reports whether an IR label starts a function; local
+// labels start with a dot
+func isFunctionLabel(label string) bool {
+	return !strings.HasPrefix(label, ".")
+}
@@ -43,6 +43,20 @@ const (
 	OpPop
 	OpParam
 	OpSetArg  // Special opcode for setting up function arguments - bypasses register allocator
+	OpMemcpy  // Copy Src2 bytes from the address in Src1 to the address in Dst (see memops.go)
+	OpMemset  // Fill Src2 bytes at the address in Dst with the byte Src1
+	OpTailCall // Leave this frame and jump to Src1, which returns to our caller (see tailcall.go)
+	OpSyscall  // Make system call Src1 with the arguments OpSetArg put in place; the result goes to Dst (see freestanding.go)
+	OpConvert  // Convert Src1 from its DataType to Dst's (see conversions.go)
+	OpAtomicAdd  // Add Src2 to the target of the ptr Src1 atomically; Dst, if any, gets the old value (see atomics.go)
+	OpAtomicXchg // Swap Src2 with the target of the ptr Src1 atomically; Dst gets the old value
+	OpFence      // Full memory barrier (mfence)
+	OpTLSAddr    // Dst = the running thread's address of the thread-local variable Src1 (see tls.go)
+	OpPopcnt     // Dst = the set bits in Src1, Src2 bytes wide (see bits.go)
+	OpClz        // Dst = the leading zero bits in Src1, Src2 bytes wide
+	OpCtz        // Dst = the trailing zero bits in Src1, Src2 bytes wide
+	OpBswap      // Dst = Src1's low Src2 bytes in reverse order
+	OpPopArgs    // Drop the Src1 bytes of arguments OpPush put on the stack for the call before
 )
 
 type Operand struct {
@@ -61,11 +75,23 @@ type IRInstruction struct {
 	Dst  *Operand
 	Src1 *Operand
 	Src2 *Operand
+	Line int       // source line of the statement it was selected from, 0 if unknown
+	Column int     // and its column, 0 if unknown
+	// Registers the instruction changes besides Dst, as allocator
+	// registers: every call lists the caller-saved ones (see findClobbers)
+	Clobbers []int
+	Func string    // function that statement is in (the callee, for inlined code)
+	Pos  SourcePos // where Line is in the source or a header (see provenance.go)
+	Volatile bool  // reads or writes a volatile object: kept, and kept in order (see volatile.go)
 }
 
 type FunctionSignature struct {
 	ReturnType string
 	ParamTypes []string
+	Variadic   bool // Takes extra arguments after ParamTypes
+	External   bool // A builtin libc prototype: results come back per the ABI
+	MSABI      bool // Declared __attribute__((ms_abi)): called with the Windows x64 convention
+	NoReturn   bool // Declared noreturn: calls to it don't come back (see returns.go)
 }
 
 type InstructionSelector struct {
@@ -74,18 +100,45 @@ type InstructionSelector struct {
 	labelCounter int
 	tempCounter  int
 	varCounter   int  // Counter to make variable names unique
+	staticCounter int // Counter for static local symbols (func.var.N)
 	
 	// Symbol tables
 	localVars    map[string]*Symbol  // Current active binding for each variable name
 	allLocalVars map[string]*Symbol  // All local variables (with unique keys)
 	globalVars   map[string]*Symbol
+	globalOrder  []string  // globalVars keys in definition order
 	functions    map[string]*FunctionSignature // Track function signatures
+	functionPointers map[string]map[string]*TypedefType // Pointer-to-function typedefs of variables, by function ("" for globals)
 	stringLits   map[string]string
+	stringOrder  []string  // stringLits labels in creation order
+	stringLabels map[string]string // literal contents -> its label, so equal literals share one
 	structs      map[string]*StructDef  // Struct definitions from parser
 	typedefs     map[string]string      // Typedef aliases from parser
 	enums        map[string]int         // Enum constants from parser
 	
-	stackOffset  int
+	frame        *FrameManager            // stack slots of the function being selected (see frame.go)
+	frames       map[string]*FrameManager // every function's, by name
+	target       *TargetSpec  // Scalar sizes (see target_spec.go)
+	
+	// Aliasing model (see aliasing.go)
+	strictAliasing     bool
+	warnStrictAliasing bool
+	warnWriteStrings   bool // -Wwrite-strings: string literals are const (see const.go)
+	warnUninitialized  bool // -Wuninitialized: report locals read before they're stored (see uninitialized.go)
+	warnReturnType     bool // -Wreturn-type: report non-void functions whose end is reached (see returns.go)
+	warnUnusedVariable bool // -Wunused-variable, -Wunused-function and -Wunreachable-code (see unused.go)
+	warnUnusedFunction bool
+	warnUnreachable    bool
+	noPopcnt           bool // -mno-popcnt, -mno-lzcnt and -mno-bmi: bit builtins call libgcc (see bits.go)
+	noLzcnt            bool
+	noBMI              bool
+	inSizeof           map[*Symbol]bool // locals named in a sizeof operand, which count as used
+	warnings           []Diagnostic
+	
+	optLevel   int               // -O level; 2 and up inline constant-size memcpy/memset
+	coldBlocks map[string]string // out-of-line block label -> label it rejoins at (see branch_layout.go)
+	line       int               // source line of the statement being selected
+	column     int               // and its column, 0 if unknown
 }
 
 func NewInstructionSelector() *InstructionSelector {
@@ -96,48 +149,47 @@ func NewInstructionSelector() *InstructionSelector {
 		globalVars:   make(map[string]*Symbol),
 		functions:    make(map[string]*FunctionSignature),
 		stringLits:   make(map[string]string),
+		stringLabels: make(map[string]string),
 		structs:      make(map[string]*StructDef),
 		typedefs:     make(map[string]string),
 		enums:        make(map[string]int),
+		frames:       make(map[string]*FrameManager),
+		frame:        NewFrameManager(""), // file scope
+		target:       defaultTarget,
 	}
 	
 	// Add standard library external symbols
-	is.globalVars["stderr"] = &Symbol{
+	is.defineGlobal(&Symbol{
 		Name:       "stderr",
 		Type:       "void*",
 		IsGlobal:   true,
 		IsExternal: true,
-	}
-	is.globalVars["stdout"] = &Symbol{
+	})
+	is.defineGlobal(&Symbol{
 		Name:       "stdout",
 		Type:       "void*",
 		IsGlobal:   true,
 		IsExternal: true,
-	}
-	is.globalVars["stdin"] = &Symbol{
+	})
+	is.defineGlobal(&Symbol{
 		Name:       "stdin",
 		Type:       "void*",
 		IsGlobal:   true,
 		IsExternal: true,
-	}
-	
-	// Add raylib color constants as external symbols
-	colorType := "Color"
-	rayColors := []string{"RED", "WHITE", "BLACK", "GRAY", "LIGHTGRAY", "DARKGRAY",
-		"YELLOW", "GOLD", "ORANGE", "PINK", "MAROON", "GREEN", "LIME", "DARKGREEN",
-		"SKYBLUE", "BLUE", "DARKBLUE", "PURPLE", "VIOLET", "DARKPURPLE",
-		"BEIGE", "BROWN", "DARKBROWN", "RAYWHITE", "MAGENTA"}
-	for _, color := range rayColors {
-		is.globalVars[color] = &Symbol{
-			Name:     color,
-			Type:     colorType,
-			IsGlobal: true,
-		}
-	}
+	})
 	
 	return is
 }
 
+// defineGlobal adds (or redefines) a global, remembering the order globals
+// were first defined in so they're emitted in it
+func (is *InstructionSelector) defineGlobal(sym *Symbol) {
+	if _, exists := is.globalVars[sym.Name]; !exists {
+		is.globalOrder = append(is.globalOrder, sym.Name)
+	}
+	is.globalVars[sym.Name] = sym
+}
+
 func (is *InstructionSelector) newTemp() *Operand {
 	is.tempCounter++
 	return &Operand{
@@ -151,84 +203,138 @@ func (is *InstructionSelector) newLabel(prefix string) string {
 	return fmt.Sprintf("%s_%d", prefix, is.labelCounter)
 }
 
-func (is *InstructionSelector) emit(op OpCode, dst, src1, src2 *Operand) {
-	is.instructions = append(is.instructions, &IRInstruction{
-		Op:   op,
-		Dst:  dst,
-		Src1: src1,
-		Src2: src2,
-	})
+// stringLabel returns the .rodata label of a string literal with these
+// (decoded) contents, adding it the first time. Literals are read-only, so
+// equal ones can share storage.
+func (is *InstructionSelector) stringLabel(value string) string {
+	if label, ok := is.stringLabels[value]; ok {
+		return label
+	}
+	label := is.newLabel(".str")
+	is.stringLits[label] = value
+	is.stringOrder = append(is.stringOrder, label)
+	is.stringLabels[value] = label
+	return label
 }
 
-// getTypeSize returns the size in bytes of a type
-func (is *InstructionSelector) getTypeSize(typ string) int {
-	return is.getTypeSizeHelper(typ, make(map[string]bool))
+// newColdLabel starts an out-of-line block that rejoins the code at rejoin
+func (is *InstructionSelector) newColdLabel(rejoin string) string {
+	label := is.newLabel(".L_cold")
+	if is.coldBlocks == nil {
+		is.coldBlocks = make(map[string]string)
+	}
+	is.coldBlocks[label] = rejoin
+	return label
 }
 
-func (is *InstructionSelector) getTypeSizeHelper(typ string, visited map[string]bool) int {
-	// Prevent infinite recursion
-	if visited[typ] {
-		return 8 // Default size to break cycle
+// staticLocalName builds the assembler symbol for a static local: func.var.N
+// The dots keep it out of the C namespace while still naming its origin
+func (is *InstructionSelector) staticLocalName(varName string) string {
+	is.staticCounter++
+	return fmt.Sprintf("%s.%s.%d", is.currentFunc, varName, is.staticCounter)
+}
+
+// renameStaticLocals gives static locals in a function body their global
+// symbol names and rewrites the identifiers that refer to them. Static locals
+// are then selected like globals (one instance, zero/constant initialized once).
+func (is *InstructionSelector) renameStaticLocals(node *ASTNode, scope map[string]string) {
+	if node == nil {
+		return
 	}
-	visited[typ] = true
 	
-	// Remove const/static modifiers
-	typ = strings.TrimSpace(typ)
-	for {
-		trimmed := false
-		for _, prefix := range []string{"static ", "const ", "extern ", "volatile ", "register "} {
-			if strings.HasPrefix(typ, prefix) {
-				typ = strings.TrimSpace(typ[len(prefix):])
-				trimmed = true
-				break
-			}
+	switch node.Type {
+	case NodeIdentifier:
+		if mangled, ok := scope[node.VarName]; ok {
+			node.VarName = mangled
 		}
-		if !trimmed {
-			break
+		return
+		
+	case NodeVarDecl:
+		// Initializer sees the outer binding
+		for _, child := range node.Children {
+			is.renameStaticLocals(child, scope)
+		}
+		if strings.HasPrefix(strings.TrimSpace(node.DataType), "static ") {
+			mangled := is.staticLocalName(node.VarName)
+			scope[node.VarName] = mangled
+			node.VarName = mangled
+			node.IsGlobal = true
+		} else {
+			// A plain local hides any static of the same name
+			delete(scope, node.VarName)
 		}
+		return
+		
+	case NodeBlock, NodeFor:
+		// New scope: declarations inside don't leak out
+		inner := make(map[string]string, len(scope))
+		for k, v := range scope {
+			inner[k] = v
+		}
+		scope = inner
 	}
 	
-	// Pointers are 8 bytes
-	if len(typ) > 0 && typ[len(typ)-1] == '*' {
-		return 8
+	for _, child := range node.Children {
+		is.renameStaticLocals(child, scope)
 	}
-	
-	// Check for struct types
-	if len(typ) > 7 && typ[:7] == "struct " {
-		structName := typ[7:]
-		structName = strings.TrimSpace(structName)
-		if structDef, ok := is.structs[structName]; ok {
-			return structDef.Size
-		}
-		return 8 // Default struct size
+}
+
+// constantInitializer returns the literal text of a simple numeric
+// initializer, and whether it's a floating constant
+func constantInitializer(node *ASTNode) (string, bool, bool) {
+	if node == nil {
+		return "", false, false
 	}
-	
-	// Check for typedef'd types
-	if actualType, ok := is.typedefs[typ]; ok {
-		return is.getTypeSizeHelper(actualType, visited)
+	if node.Type == NodeNumber {
+		return node.Value, isFloatType(node.DataType), true
 	}
-	
-	// Basic types
-	switch typ {
-	case "char", "signed char", "unsigned char":
-		return 1
-	case "short", "short int", "signed short", "unsigned short":
-		return 2
-	case "int", "signed int", "unsigned int", "long", "signed long", "unsigned long":
-		return 4
-	case "long long", "signed long long", "unsigned long long":
-		return 8
-	case "float":
-		return 4
-	case "double":
-		return 8
-	case "void":
-		return 0
-	default:
-		return 8
+	if node.Type == NodeUnaryOp && node.Operator == "-" && len(node.Children) == 1 {
+		if val, floating, ok := constantInitializer(node.Children[0]); ok {
+			return "-" + val, floating, true
+		}
+	}
+	return "", false, false
+}
+
+func (is *InstructionSelector) emit(op OpCode, dst, src1, src2 *Operand) {
+	is.instructions = append(is.instructions, &IRInstruction{
+		Op:     op,
+		Dst:    dst,
+		Src1:   src1,
+		Src2:   src2,
+		Line:   is.line,
+		Column: is.column,
+		Func:   is.currentFunc,
+	})
+}
+
+// warn records a warning at line and column; code is the -W option that
+// controls it, "" if none does
+func (is *InstructionSelector) warn(code string, line, column int, format string, args ...interface{}) {
+	is.warnings = append(is.warnings, Diagnostic{Severity: "warning", Stage: "select", Code: code,
+		Line: line, Column: column, Message: fmt.Sprintf(format, args...)})
+}
+
+// popArgs drops the bytes of arguments pushed for the call just emitted
+func (is *InstructionSelector) popArgs(bytes int) {
+	if bytes > 0 {
+		is.emit(OpPopArgs, nil, &Operand{Type: "imm", Value: fmt.Sprintf("%d", bytes)}, nil)
 	}
 }
 
+// emitCall emits a call of fn with nargs (an immediate) arguments already
+// placed, which changes every caller-saved register (every register, if
+// fn returns twice: see setjmp.go); the result is in dst
+func (is *InstructionSelector) emitCall(dst, fn, nargs *Operand) {
+	is.emit(OpCall, dst, fn, nargs)
+	is.instructions[len(is.instructions)-1].Clobbers = callClobbers(fn)
+}
+
+// types sizes types by the program's structs and typedefs
+func (is *InstructionSelector) types() *TypeInfo {
+	return &TypeInfo{target: is.target, structs: is.structs, typedefs: is.typedefs}
+}
+
 // isLargeStruct returns true if the type is a struct larger than 16 bytes
 func (is *InstructionSelector) isLargeStruct(typ string) bool {
 	return is.isLargeStructHelper(typ, make(map[string]bool))
@@ -292,6 +398,9 @@ func (is *InstructionSelector) resolveType(typ string) string {
 		typ = typ[:len(typ)-1]
 	}
 	
+	// Qualifiers don't change which type is named
+	typ = strings.TrimPrefix(strings.TrimSpace(typ), "const ")
+	
 	// Resolve typedef if it exists
 	if resolvedType, ok := is.typedefs[typ]; ok {
 		typ = resolvedType
@@ -305,6 +414,36 @@ func (is *InstructionSelector) resolveType(typ string) string {
 	return typ
 }
 
+// declareGlobal merges a file-scope declaration with earlier ones for the
+// same name, following C's rules for tentative definitions: any number of
+// "int x;" and "extern int x;" make one object, which is defined (in .bss,
+// as a common symbol) unless every declaration was extern, and takes its
+// initial value from the one definition that has an initializer. A name
+// only ever declared extern gets no storage and is left to the linker.
+// Conflicts between declarations are reported by the type checker.
+func (is *InstructionSelector) declareGlobal(sym *Symbol, initialized bool) {
+	prev, exists := is.globalVars[sym.Name]
+	if !exists {
+		sym.HasInit = initialized
+		is.defineGlobal(sym)
+		return
+	}
+	if sym.IsExternal {
+		// Adds nothing to what's already declared
+		return
+	}
+	sym.IsStatic = sym.IsStatic || prev.IsStatic
+	sym.HasInit = initialized || prev.HasInit
+	sym.Align = max(sym.Align, prev.Align)
+	if !initialized {
+		sym.InitValue = prev.InitValue
+		sym.InitFloat = prev.InitFloat
+		sym.InitData = prev.InitData
+		sym.InitAddrs = prev.InitAddrs
+	}
+	is.defineGlobal(sym)
+}
+
 func (is *InstructionSelector) SelectInstructions(ast *ASTNode) error {
 	for _, child := range ast.Children {
 		if err := is.selectNode(child); err != nil {
@@ -318,6 +457,9 @@ func (is *InstructionSelector) selectNode(node *ASTNode) error {
 	if node == nil {
 		return nil
 	}
+	if node.Line > 0 {
+		is.line, is.column = node.Line, node.Column
+	}
 	
 	switch node.Type {
 	case NodeProgram:
@@ -328,76 +470,195 @@ func (is *InstructionSelector) selectNode(node *ASTNode) error {
 		}
 		
 	case NodeFunction:
-		// Track the function signature
-		is.functions[node.Name] = &FunctionSignature{
-			ReturnType: node.ReturnType,
-			ParamTypes: node.ParamTypes,
-		}
-		
 		// Skip external function declarations (no body)
 		if node.Children == nil || len(node.Children) == 0 {
-			// External function - just track it (no code generation)
+			// External function - just track it (no code generation),
+			// keeping what the pipeline already knows (External)
+			if _, known := is.functions[node.Name]; !known {
+				is.functions[node.Name] = &FunctionSignature{
+					ReturnType: node.ReturnType,
+					ParamTypes: node.ParamTypes,
+					Variadic:   node.IsVariadic,
+					MSABI:      hasAttribute(node.Attributes, "ms_abi"),
+					NoReturn:   hasAttribute(node.Attributes, "noreturn"),
+				}
+			}
 			return nil
 		}
 		
+		// Track the function signature (a prototype may have said ms_abi
+		// or noreturn)
+		msABI := hasAttribute(node.Attributes, "ms_abi")
+		noReturn := hasAttribute(node.Attributes, "noreturn")
+		if known, ok := is.functions[node.Name]; ok {
+			msABI = msABI || known.MSABI
+			noReturn = noReturn || known.NoReturn
+		}
+		is.functions[node.Name] = &FunctionSignature{
+			ReturnType: node.ReturnType,
+			ParamTypes: node.ParamTypes,
+			Variadic:   node.IsVariadic,
+			MSABI:      msABI,
+			NoReturn:   noReturn,
+		}
+		
 		is.currentFunc = node.Name
 		is.localVars = make(map[string]*Symbol)
 		is.allLocalVars = make(map[string]*Symbol)
-		is.stackOffset = 0
+		is.frame = NewFrameManager(node.Name)
+		is.frames[node.Name] = is.frame
 		is.varCounter = 0  // Reset counter for each function
 		
+		// Static locals become function-qualified globals (func.var.N)
+		if len(node.Children) > 0 {
+			is.renameStaticLocals(node.Children[0], make(map[string]string))
+		}
+		
 		// Emit function label
+		start := len(is.instructions)
 		is.emit(OpLabel, &Operand{Type: "label", Value: node.Name}, nil, nil)
 		
 		// Check if this function returns a large struct (>16 bytes)
-		// If so, the first parameter (RDI) is a hidden pointer to the return buffer
+		// If so, a hidden pointer to the return buffer arrives in the
+		// convention's StructReturn register (RDI, the first parameter, on SysV)
+		cc, err := is.conventionOf(node.Name)
+		if err != nil {
+			return err
+		}
+		if err := is.checkPassedByValue(cc, node.Name, node.ReturnType, node.ParamTypes); err != nil {
+			return err
+		}
 		var hiddenRetPtr *Symbol
 		paramRegStartIdx := 0
 		
 		if node.ReturnType != "" && is.isLargeStruct(node.ReturnType) {
 			// Allocate space for hidden return pointer
-			is.stackOffset -= 8
+			offset := is.frame.Alloc(SlotParam, "__retptr", 8, 8)
 			hiddenRetPtr = &Symbol{
 				Name:   "__retptr",
 				Type:   node.ReturnType + "*",
-				Offset: is.stackOffset,
+				Offset: offset,
 				Size:   8,
 			}
 			is.localVars["__retptr"] = hiddenRetPtr
 			
-			// Save the hidden pointer from RDI directly to stack (use "mem" not "var" to avoid register allocation)
-			retPtrReg := &Operand{Type: "reg", Value: "rdi"}
-			retPtrMem := &Operand{Type: "mem", Offset: is.stackOffset}
+			// Save the hidden pointer directly to stack (use "mem" not "var" to avoid register allocation)
+			retPtrReg := &Operand{Type: "reg", Value: cc.StructReturn}
+			retPtrMem := &Operand{Type: "mem", Offset: offset}
 			is.emit(OpStore, retPtrMem, retPtrReg, nil)
 			
-			// Regular parameters start at RSI (index 1)
-			paramRegStartIdx = 1
+			// On SysV regular parameters then start at RSI (index 1)
+			if cc.StructReturnIsArg {
+				paramRegStartIdx = 1
+			}
 		}
 		
 		// Allocate parameters
-		argRegs := []string{"rdi", "rsi", "rdx", "rcx", "r8", "r9"}
+		argRegs := cc.IntArgs
+		sseRegs := cc.FloatArgs
+		regIdx := paramRegStartIdx
+		sseIdx := 0
+		stackArg := 16 + cc.ShadowSpace // the first one past the registers, above the return address, saved %rbp and any shadow space
+		var singles []int
+		is.preserveRegisters(cc)
 		for i, param := range node.Params {
-			is.stackOffset -= 8
-			paramType := ""
+			if cc.Positional {
+				regIdx = max(regIdx, sseIdx)
+				sseIdx = regIdx
+			}
+			paramType, paramConst, paramVolatile := "", false, false
 			if i < len(node.ParamTypes) {
-				paramType = node.ParamTypes[i]
+				paramType, paramConst = splitTopConst(node.ParamTypes[i])
+				paramType, paramVolatile = splitTopVolatile(paramType)
+			}
+			
+			// Structs up to 16 bytes arrive as eightbytes in the next
+			// registers of each class; bigger ones (the MEMORY class) were
+			// copied onto the stack
+			classes, small := is.structClasses(paramType)
+			if small || (is.isStructType(paramType) && cc.StackArgs) {
+				ints, sses := 0, 0
+				for _, class := range classes {
+					if class == "sse" {
+						sses++
+					} else {
+						ints++
+					}
+				}
+				fits := small && regIdx+ints <= len(argRegs) && sseIdx+sses <= len(sseRegs)
+				if fits || cc.StackArgs {
+					slot := is.newSlot(SlotParam, param, paramType)
+					size := is.types().SizeOf(paramType)
+					is.localVars[param] = &Symbol{
+						Name:       param,
+						Type:       paramType,
+						Offset:     slot.Offset,
+						Size:       size,
+						IsConst:    paramConst,
+						IsVolatile: paramVolatile,
+					}
+					if !fits {
+						// Otherwise the caller pushed it whole, and the
+						// registers are left for the parameters after it
+						for k := 0; k < size; k += 8 {
+							is.emit(OpStore, &Operand{Type: "mem", Offset: slot.Offset + k}, &Operand{Type: "mem", Offset: stackArg}, nil)
+							stackArg += 8
+						}
+						continue
+					}
+					is.emitEightbytes(slot, classes, argRegs[regIdx:], sseRegs[sseIdx:], OpStore)
+					regIdx += ints
+					sseIdx += sses
+					continue
+				}
 			}
+			
+			offset := is.frame.Alloc(SlotParam, param, 8, 8)
 			is.localVars[param] = &Symbol{
-				Name:   param,
-				Type:   paramType,
-				Offset: is.stackOffset,
-				Size:   8,
+				Name:       param,
+				Type:       paramType,
+				Offset:     offset,
+				Size:       8,
+				IsConst:    paramConst,
+				IsVolatile: paramVolatile,
+			}
+			
+			// Doubles and floats arrive in the next XMM register, a
+			// float as single precision; it's widened once all the
+			// argument registers are saved
+			if is.isFloatingType(paramType) {
+				if sseIdx < len(sseRegs) {
+					is.emit(OpStore, &Operand{Type: "mem", Offset: offset}, &Operand{Type: "freg", Value: sseRegs[sseIdx]}, nil)
+				} else if cc.StackArgs {
+					is.emit(OpStore, &Operand{Type: "mem", Offset: offset}, &Operand{Type: "mem", Offset: stackArg}, nil)
+					stackArg += 8
+				}
+				if is.isSingle(paramType) {
+					singles = append(singles, offset)
+				}
+				sseIdx++
+				continue
 			}
 			
 			// Move from argument register to stack
 			// Account for hidden pointer if present  
 			// Use "mem" type to prevent register allocation
-			regIdx := i + paramRegStartIdx
+			paramOp := &Operand{Type: "mem", Offset: offset}
 			if regIdx < len(argRegs) {
 				argReg := &Operand{Type: "reg", Value: argRegs[regIdx]}
-				paramOp := &Operand{Type: "mem", Offset: is.stackOffset}
 				is.emit(OpStore, paramOp, argReg, nil)
+			} else if cc.StackArgs {
+				// Past the registers: copied in from the caller's pushes,
+				// so the slot holds the argument itself (a pointer
+				// parameter points where the caller's does)
+				is.emit(OpStore, paramOp, &Operand{Type: "mem", Offset: stackArg}, nil)
+				stackArg += 8
 			}
+			regIdx++
+		}
+		for _, offset := range singles {
+			slot := &Operand{Type: "mem", Offset: offset}
+			is.emit(OpStore, slot, is.widen(slot), nil)
 		}
 		
 		// Function body
@@ -407,19 +668,46 @@ func (is *InstructionSelector) selectNode(node *ASTNode) error {
 			}
 		}
 		
-		// Default return if no explicit return
+		// Default return if no explicit return. main's returns 0 (see
+		// main_function.go); the move isn't code anyone wrote, so it has no line.
+		if node.Name == "main" && !is.functions[node.Name].returnsVoid() {
+			is.emit(OpMov, &Operand{Type: "reg", Value: cc.IntResults[0]}, &Operand{Type: "imm", Value: "0"}, nil)
+			is.instructions[len(is.instructions)-1].Line = 0
+		}
 		is.emit(OpRet, nil, nil, nil)
+		if is.warnUninitialized {
+			is.checkUninitialized(start)
+		}
+		if is.warnUnusedVariable {
+			is.checkUnusedLocals(start)
+		}
+		if is.warnUnreachable {
+			is.checkUnreachable(start)
+		}
+		if is.warnReturnType {
+			is.checkReturnReached(start, node)
+		}
 		
 	case NodeVarDecl:
 		// Calculate size based on type and array size
 		varSize := 8  // Default for int/pointer
 		dataType := node.DataType
 		
-		// Strip storage class specifiers (static, const, extern, etc.)
+		// Strip storage class specifiers (static, const, extern, etc.). The
+		// variable's own constness moves to IsConst; a pointee's stays in the type.
 		dataType = strings.TrimSpace(dataType)
+		isExtern := strings.HasPrefix(dataType, "extern ")
+		dataType = strings.TrimPrefix(dataType, "extern ")
+		isStatic := strings.HasPrefix(dataType, "static ")
+		dataType, isThread := splitThreadLocal(strings.TrimPrefix(dataType, "static "))
+		dataType, isConst := splitTopConst(dataType)
+		dataType, isVolatile := splitTopVolatile(dataType)
 		for {
 			trimmed := false
 			for _, prefix := range []string{"static ", "const ", "extern ", "volatile ", "register "} {
+				if (prefix == "const " || prefix == "volatile ") && strings.HasSuffix(dataType, "*") {
+					continue
+				}
 				if strings.HasPrefix(dataType, prefix) {
 					dataType = strings.TrimSpace(dataType[len(prefix):])
 					trimmed = true
@@ -440,34 +728,75 @@ func (is *InstructionSelector) selectNode(node *ASTNode) error {
 			} else if structDef, ok := is.structs[structName]; ok {
 				varSize = structDef.Size
 			}
+		} else if structDef, ok := is.structDefOf(dataType); ok {
+			varSize = structDef.Size
 		}
 		
 		if node.ArraySize > 0 {
 			varSize = node.ArraySize * varSize  // Array: count * element size
 		}
 		
-		if node.IsGlobal {
-			is.globalVars[node.VarName] = &Symbol{
-				Name:      node.VarName,
-				IsGlobal:  true,
-				Size:      varSize,
-				ArraySize: node.ArraySize,
-				Type:      dataType,
+		// Alignment the variable or its type asks for (see attributes.go)
+		_, align, _ := is.types().Lookup(dataType)
+		align = max(align, alignedAttribute(node.Attributes))
+		
+		if node.IsGlobal || isExtern {
+			sym := &Symbol{
+				Name:       node.VarName,
+				IsGlobal:   true,
+				IsExternal: isExtern,
+				Size:       varSize,
+				ArraySize:  node.ArraySize,
+				Type:       dataType,
+				IsStatic:   isStatic,
+				IsConst:    isConst,
+				IsVolatile: isVolatile,
+				IsThreadLocal: isThread,
+				Align:      align,
+			}
+			if len(node.Children) > 0 && (node.Children[0].Type == NodeCompoundLiteral || node.ArraySize > 0) {
+				data, addrs, err := is.globalData(dataType, varSize, node.ArraySize, node.Children[0])
+				if err != nil {
+					return fmt.Errorf("%sin the initializer of '%s': %w", linePrefix(node.Line), node.VarName, err)
+				}
+				sym.InitData = data
+				sym.InitAddrs = addrs
+			} else if len(node.Children) > 0 {
+				if err := is.scalarInitializer(sym, node.Children[0]); err != nil {
+					return fmt.Errorf("%sin the initializer of '%s': %w", linePrefix(node.Line), node.VarName, err)
+				}
 			}
+			if !node.IsGlobal {
+				// extern inside a function names the global, hiding any
+				// local of the same name
+				delete(is.localVars, node.VarName)
+			}
+			is.declareGlobal(sym, len(node.Children) > 0)
 		} else {
-			is.stackOffset -= varSize
-			varOffset := is.stackOffset  // Save the variable's offset
+			allocSize := varSize
+			if node.ArraySize > 0 {
+				// Whole eightbytes, for zeroSlot
+				allocSize = (varSize + 7) &^ 7
+			}
+			if align > 16 {
+				return fmt.Errorf("%salignment of '%s' (%d) is more than the stack's (16)", linePrefix(node.Line), node.VarName, align)
+			}
+			varOffset := is.frame.Alloc(SlotLocal, node.VarName, allocSize, max(slotAlign(allocSize), align))
 			
 			// Create a unique key for this variable instance
 			is.varCounter++
 			uniqueKey := fmt.Sprintf("%s#%d", node.VarName, is.varCounter)
 			
 			sym := &Symbol{
-				Name:      node.VarName,  // Keep original name
-				Offset:    varOffset,
-				Size:      varSize,
-				ArraySize: node.ArraySize,
-				Type:      dataType,
+				Name:       node.VarName,  // Keep original name
+				Offset:     varOffset,
+				Size:       varSize,
+				ArraySize:  node.ArraySize,
+				Type:       dataType,
+				IsConst:    isConst,
+				IsVolatile: isVolatile,
+				Line:       node.Line,
+				Column:     node.Column,
 			}
 			
 			// Store in both maps:
@@ -476,47 +805,33 @@ func (is *InstructionSelector) selectNode(node *ASTNode) error {
 			is.allLocalVars[uniqueKey] = sym
 			is.localVars[node.VarName] = sym
 			
-			// Handle initialization (only for non-arrays for now)
+			// Arrays are initialized in place (see initializers.go)
+			if len(node.Children) > 0 && node.ArraySize > 0 && node.Children[0].Type == NodeCompoundLiteral {
+				start := len(is.instructions)
+				is.zeroSlot(varOffset, varSize)
+				if err := is.initialize(varOffset, dataType, varSize, node.ArraySize, node.Children[0]); err != nil {
+					return err
+				}
+				if isVolatile {
+					is.markVolatile(start)
+				}
+			}
 			if len(node.Children) > 0 && node.ArraySize == 0 {
 				initExpr := node.Children[0]
+				is.checkConstDiscard(dataType, initExpr, "initialization")
 				
-				// Check if this is a compound literal initializing a struct
-				if initExpr.Type == NodeCompoundLiteral {
-					// For compound literals, we need to copy the struct
-					// The compound literal creates a temporary and returns its address
-					// We need to copy from that temp to our variable
-					
-					result, err := is.selectExpression(initExpr)
+				// Struct values (compound literals, calls, other structs) are copied whole
+				if is.isStructType(dataType) && is.isStructValue(initExpr) {
+					result, err := is.selectStructValue(initExpr)
 					if err != nil {
 						return err
 					}
-					
-					// Get struct size
-					structSize := varSize
-					
-					// Copy struct data from compound literal temp to our variable
-					// result contains the address of the temporary
-					// We need to copy structSize bytes
-					for offset := 0; offset < structSize; offset += 8 {
-						// Load from compound literal temp
-						// result is a temp register containing the address
-						srcOp := &Operand{
-							Type:      "ptr",
-							IndexTemp: result,
-						}
-						if offset > 0 {
-							offsetOp := &Operand{Type: "imm", Value: fmt.Sprintf("%d", offset)}
-							addrTemp := is.newTemp()
-							is.emit(OpAdd, addrTemp, result, offsetOp)
-							srcOp.IndexTemp = addrTemp
-						}
-						
-						valueTemp := is.newTemp()
-						is.emit(OpLoad, valueTemp, srcOp, nil)
-						
-						// Store to our variable using the saved offset
-						dstOp := &Operand{Type: "var", Value: node.VarName, Offset: varOffset + offset}
-						is.emit(OpStore, dstOp, valueTemp, nil)
+					start := len(is.instructions)
+					dst := is.newTemp()
+					is.emit(OpLoadAddr, dst, &Operand{Type: "var", Value: node.VarName, Offset: varOffset}, nil)
+					is.storeLValue(&lvalue{addr: dst, typ: dataType, size: varSize}, result)
+					if isVolatile {
+						is.markVolatile(start)
 					}
 				} else {
 					// Regular initialization
@@ -527,20 +842,45 @@ func (is *InstructionSelector) selectNode(node *ASTNode) error {
 					
 					varOp := &Operand{Type: "var", Value: node.VarName, Offset: varOffset, Size: varSize}
 					is.emit(OpStore, varOp, result, nil)
+					is.instructions[len(is.instructions)-1].Volatile = isVolatile
 				}
 			}
 		}
 		
 	case NodeReturn:
 		if len(node.Children) > 0 {
-			result, err := is.selectExpression(node.Children[0])
+			funcSig := is.functions[is.currentFunc]
+			retType := ""
+			if funcSig != nil {
+				retType = funcSig.ReturnType
+			}
+			is.checkConstDiscard(retType, node.Children[0], "return")
+			
+			// Structs up to 16 bytes come back in rax/rdx and xmm0/xmm1
+			cc := is.target.CallingConvention()
+			if classes, ok := is.structClasses(retType); ok {
+				value, err := is.selectStructValue(node.Children[0])
+				if err != nil {
+					return err
+				}
+				is.emitEightbytes(is.structSlot(value, retType), classes, cc.IntResults, cc.FloatResults, OpLoad)
+				is.emit(OpRet, nil, nil, nil)
+				return nil
+			}
+			
+			var result *Operand
+			var err error
+			if is.isStructValue(node.Children[0]) {
+				result, err = is.selectStructValue(node.Children[0])
+			} else {
+				result, err = is.selectExpression(node.Children[0])
+			}
 			if err != nil {
 				return err
 			}
 			
 			// Check if we're returning a large struct
-			funcSig := is.functions[is.currentFunc]
-			if funcSig != nil && funcSig.ReturnType != "" && is.isLargeStruct(funcSig.ReturnType) {
+			if retType != "" && is.isLargeStruct(retType) {
 				// Large struct return: copy to hidden pointer location
 				// The hidden pointer is saved in __retptr
 				if retPtr, ok := is.localVars["__retptr"]; ok {
@@ -550,43 +890,21 @@ func (is *InstructionSelector) selectNode(node *ASTNode) error {
 					is.emit(OpLoad, ptrTemp, ptrVar, nil)
 					
 					// Copy the struct from result to the hidden pointer location
-					// For now, we'll use a simple memcpy approach
-					structSize := is.getTypeSize(funcSig.ReturnType)
-					
-					// If result is already a memory location, copy from it
-					if result.Type == "mem" || result.Type == "var" {
-						// Generate copy loop - for simplicity, copy 8 bytes at a time
-						for offset := 0; offset < structSize; offset += 8 {
-							srcTemp := is.newTemp()
-							srcOp := &Operand{
-								Type:   "mem",
-								Offset: result.Offset + offset,
-							}
-							is.emit(OpLoad, srcTemp, srcOp, nil)
-							
-							// Store to hidden pointer + offset
-							dstOp := &Operand{
-								Type:      "ptr",
-								IndexTemp: ptrTemp,
-							}
-							// Add offset if needed
-							if offset > 0 {
-								offsetOp := &Operand{Type: "imm", Value: fmt.Sprintf("%d", offset)}
-								addrTemp := is.newTemp()
-								is.emit(OpAdd, addrTemp, ptrTemp, offsetOp)
-								dstOp.IndexTemp = addrTemp
-							}
-							is.emit(OpStore, dstOp, srcTemp, nil)
-						}
-					}
+					is.storeLValue(&lvalue{addr: ptrTemp, typ: retType, size: is.types().SizeOf(retType)}, result)
 					
 					// Return the hidden pointer in RAX
-					retReg := &Operand{Type: "reg", Value: "rax"}
+					retReg := &Operand{Type: "reg", Value: cc.IntResults[0]}
 					is.emit(OpMov, retReg, ptrTemp, nil)
 				}
+			} else if is.isFloatingType(retType) {
+				// Floating results go back in xmm0, a float as single precision
+				if is.isSingle(retType) {
+					result = is.narrow(result)
+				}
+				is.emit(OpMovFloat, &Operand{Type: "freg", Value: cc.FloatResults[0]}, result, nil)
 			} else {
 				// Regular return: move result to RAX
-				retReg := &Operand{Type: "reg", Value: "rax"}
+				retReg := &Operand{Type: "reg", Value: cc.IntResults[0]}
 				is.emit(OpMov, retReg, result, nil)
 			}
 		}
@@ -598,8 +916,38 @@ func (is *InstructionSelector) selectNode(node *ASTNode) error {
 			return err
 		}
 		
-		elseLabel := is.newLabel(".L_else")
+		prediction := 0
+		if is.optLevel >= 1 {
+			prediction = predictThen(node)
+		}
 		endLabel := is.newLabel(".L_endif")
+		var elseNode *ASTNode
+		if len(node.Children) > 2 {
+			elseNode = node.Children[2]
+		}
+		
+		if prediction < 0 {
+			// Unlikely then-branch: the else falls through
+			coldLabel := is.newColdLabel(endLabel)
+			is.emit(OpJnz, &Operand{Type: "label", Value: coldLabel}, cond, nil)
+			if elseNode != nil {
+				if err := is.selectNode(elseNode); err != nil {
+					return err
+				}
+			}
+			is.emit(OpJmp, &Operand{Type: "label", Value: endLabel}, nil, nil)
+			is.emit(OpLabel, &Operand{Type: "label", Value: coldLabel}, nil, nil)
+			if err := is.selectNode(node.Children[1]); err != nil {
+				return err
+			}
+			is.emit(OpLabel, &Operand{Type: "label", Value: endLabel}, nil, nil)
+			break
+		}
+		
+		elseLabel := is.newLabel(".L_else")
+		if prediction > 0 && elseNode != nil {
+			elseLabel = is.newColdLabel(endLabel)
+		}
 		
 		is.emit(OpJz, &Operand{Type: "label", Value: elseLabel}, cond, nil)
 		
@@ -611,8 +959,8 @@ func (is *InstructionSelector) selectNode(node *ASTNode) error {
 		
 		// Else branch
 		is.emit(OpLabel, &Operand{Type: "label", Value: elseLabel}, nil, nil)
-		if len(node.Children) > 2 {
-			if err := is.selectNode(node.Children[2]); err != nil {
+		if elseNode != nil {
+			if err := is.selectNode(elseNode); err != nil {
 				return err
 			}
 		}
@@ -623,6 +971,25 @@ func (is *InstructionSelector) selectNode(node *ASTNode) error {
 		startLabel := is.newLabel(".L_while_start")
 		endLabel := is.newLabel(".L_while_end")
 		
+		if is.optLevel >= 1 {
+			// Rotated: the test sits at the bottom, and the back-edge is
+			// the conditional jump
+			condLabel := is.newLabel(".L_while_cond")
+			is.emit(OpJmp, &Operand{Type: "label", Value: condLabel}, nil, nil)
+			is.emit(OpLabel, &Operand{Type: "label", Value: startLabel}, nil, nil)
+			if err := is.selectNode(node.Children[1]); err != nil {
+				return err
+			}
+			is.emit(OpLabel, &Operand{Type: "label", Value: condLabel}, nil, nil)
+			cond, err := is.selectExpression(node.Children[0])
+			if err != nil {
+				return err
+			}
+			is.emit(OpJnz, &Operand{Type: "label", Value: startLabel}, cond, nil)
+			is.emit(OpLabel, &Operand{Type: "label", Value: endLabel}, nil, nil)
+			break
+		}
+		
 		is.emit(OpLabel, &Operand{Type: "label", Value: startLabel}, nil, nil)
 		
 		cond, err := is.selectExpression(node.Children[0])
@@ -676,6 +1043,27 @@ func (is *InstructionSelector) selectNode(node *ASTNode) error {
 		startLabel := is.newLabel(".L_for_start")
 		endLabel := is.newLabel(".L_for_end")
 		
+		if is.optLevel >= 1 && cond != nil {
+			// Rotated like while loops
+			condLabel := is.newLabel(".L_for_cond")
+			is.emit(OpJmp, &Operand{Type: "label", Value: condLabel}, nil, nil)
+			is.emit(OpLabel, &Operand{Type: "label", Value: startLabel}, nil, nil)
+			if body != nil {
+				is.selectNode(body)
+			}
+			if incr != nil {
+				is.selectExpression(incr)
+			}
+			is.emit(OpLabel, &Operand{Type: "label", Value: condLabel}, nil, nil)
+			condResult, err := is.selectExpression(cond)
+			if err != nil {
+				return err
+			}
+			is.emit(OpJnz, &Operand{Type: "label", Value: startLabel}, condResult, nil)
+			is.emit(OpLabel, &Operand{Type: "label", Value: endLabel}, nil, nil)
+			break
+		}
+		
 		is.emit(OpLabel, &Operand{Type: "label", Value: startLabel}, nil, nil)
 		
 		if cond != nil {
@@ -776,6 +1164,9 @@ func (is *InstructionSelector) selectNode(node *ASTNode) error {
 		
 	case NodeExprStmt:
 		if len(node.Children) > 0 {
+			if _, ok, err := is.selectAtomic(node.Children[0], false); ok {
+				return err
+			}
 			_, err := is.selectExpression(node.Children[0])
 			return err
 		}
@@ -797,7 +1188,499 @@ func (is *InstructionSelector) selectNode(node *ASTNode) error {
 	return nil
 }
 
+// storeJoinValue writes one arm of a conditional into its join slot
+// Every source kind (imm, var, addr, mem, label) goes through a fresh temp
+// so the emitter only ever sees a register-to-memory store
+func (is *InstructionSelector) storeJoinValue(join *Operand, val *Operand) {
+	value := is.newTemp()
+	is.emit(OpMov, value, val, nil)
+	is.emit(OpStore, &Operand{Type: "mem", Offset: join.Offset}, value, nil)
+}
+
+// selectArm selects one arm of a conditional, a struct variable as itself
+func (is *InstructionSelector) selectArm(node *ASTNode) (*Operand, error) {
+	if is.isStructValue(node) {
+		return is.selectStructValue(node)
+	}
+	return is.selectExpression(node)
+}
+
+// selectLogical selects a && b or a || b as a value: 0 or 1, with b
+// evaluated only if a doesn't decide it. Like a ternary's arms, the result
+// goes through a join slot, so it survives whatever b evaluates (calls,
+// nested logicals) however it's used after.
+func (is *InstructionSelector) selectLogical(node *ASTNode) (*Operand, error) {
+	left, err := is.selectExpression(node.Children[0])
+	if err != nil {
+		return nil, err
+	}
+	
+	// The result if a decides it
+	join := &Operand{Type: "mem", Offset: is.frame.Alloc(SlotTemp, node.Operator, 8, 8), DataType: "int"}
+	decided, skip := "0", OpJz
+	if node.Operator == "||" {
+		decided, skip = "1", OpJnz
+	}
+	is.storeJoinValue(join, &Operand{Type: "imm", Value: decided})
+	endLabel := is.newLabel(".L_logical_end")
+	is.emit(skip, &Operand{Type: "label", Value: endLabel}, left, nil)
+	
+	right, err := is.selectExpression(node.Children[1])
+	if err != nil {
+		return nil, err
+	}
+	if right.Type == "label" {
+		// A string or function: its address
+		addr := is.newTemp()
+		is.emit(OpMov, addr, right, nil)
+		right = addr
+	}
+	zero := &Operand{Type: "imm", Value: "0"}
+	if is.isFloatingType(right.DataType) {
+		zero = &Operand{Type: "imm", Value: "0.0", DataType: "double"}
+	}
+	truth := is.newTemp()
+	truth.DataType = "int"
+	is.emit(OpNe, truth, right, zero)
+	is.storeJoinValue(join, truth)
+	is.emit(OpLabel, &Operand{Type: "label", Value: endLabel}, nil, nil)
+	
+	result := is.newTemp()
+	result.DataType = "int"
+	is.emit(OpMov, result, &Operand{Type: "mem", Offset: join.Offset}, nil)
+	return result, nil
+}
+
+// zeroSlot clears size bytes of stack from offset, rounded up to whole
+// eightbytes
+func (is *InstructionSelector) zeroSlot(offset, size int) {
+	addr := is.newTemp()
+	is.emit(OpLoadAddr, addr, &Operand{Type: "mem", Offset: offset}, nil)
+	is.fillBytes(addr, &Operand{Type: "imm", Value: "0"}, (size+7)&^7)
+}
+
+// storeSlotField stores value into the typ-sized field at offset(%rbp).
+// The address is taken right before the store so it isn't held live
+// across the evaluation of other fields.
+func (is *InstructionSelector) storeSlotField(offset int, typ string, size int, value *Operand) {
+	addr := is.newTemp()
+	is.emit(OpLoadAddr, addr, &Operand{Type: "mem", Offset: offset}, nil)
+	is.storeLValue(&lvalue{addr: addr, typ: typ, size: size}, value)
+}
+
+// selectArrayLiteral lowers (T[N]){...} to an unnamed stack array laid out
+// at T's real size, so it can be passed wherever a T* is expected
+func (is *InstructionSelector) selectArrayLiteral(node *ASTNode) (*Operand, error) {
+	elemType := node.DataType
+	elemSize := is.types().SizeOf(elemType)
+	if elemSize <= 0 {
+		elemSize = 8
+	}
+	if len(node.Children) > node.ArraySize {
+		return nil, fmt.Errorf("too many initializers for %s[%d]", elemType, node.ArraySize)
+	}
+	
+	size := (elemSize*node.ArraySize + 7) &^ 7
+	is.labelCounter++
+	tempName := fmt.Sprintf("%s.compound_lit.%d", is.currentFunc, is.labelCounter)
+	base := is.frame.Alloc(SlotTemp, tempName, size, slotAlign(size))
+	is.localVars[tempName] = &Symbol{
+		Name:      tempName,
+		Offset:    base,
+		Size:      size,
+		ArraySize: node.ArraySize,
+		Type:      elemType,
+	}
+	
+	// Elements without an initializer are zero
+	is.zeroSlot(base, size)
+	if err := is.initialize(base, elemType, elemSize*node.ArraySize, node.ArraySize, node); err != nil {
+		return nil, err
+	}
+	
+	addr := is.newTemp()
+	addr.DataType = elemType + "*"
+	is.emit(OpLoadAddr, addr, &Operand{Type: "mem", Offset: base}, nil)
+	return addr, nil
+}
+
+// selectElementAddress computes &base[index] (element sizes follow NodeArrayAccess)
+func (is *InstructionSelector) selectElementAddress(node *ASTNode) (*Operand, error) {
+	if len(node.Children) < 2 {
+		return nil, fmt.Errorf("array access needs 2 operands")
+	}
+	baseNode := node.Children[0]
+	
+	index, err := is.selectExpression(node.Children[1])
+	if err != nil {
+		return nil, err
+	}
+	
+	elementType := ""
+	elementSize := 8
+	var baseAddr *Operand
+	
+	if baseNode.Type == NodeIdentifier {
+		var sym *Symbol
+		if s, ok := is.localVars[baseNode.VarName]; ok {
+			sym = s
+		} else if s, ok := is.globalVars[baseNode.VarName]; ok {
+			sym = s
+		} else {
+			return nil, fmt.Errorf("undefined array: %s", baseNode.VarName)
+		}
+		
+		if strings.Contains(sym.Type, "*") {
+			// Pointer: index from the pointer's value
+			elementType = strings.TrimSuffix(strings.TrimSpace(sym.Type), "*")
+			elementSize = is.types().SizeOf(elementType)
+			baseAddr, err = is.selectExpression(baseNode)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			// Array: index from the array's own storage
+			elementType = sym.Type
+			baseAddr = is.newTemp()
+			varOp := &Operand{Type: "var", Value: baseNode.VarName, Offset: sym.Offset, IsGlobal: sym.IsGlobal}
+			is.emit(OpLoadAddr, baseAddr, varOp, nil)
+		}
+	} else {
+		baseAddr, err = is.selectExpression(baseNode)
+		if err != nil {
+			return nil, err
+		}
+	}
+	
+	byteOffset := is.newTemp()
+	is.emit(OpMul, byteOffset, index, &Operand{Type: "imm", Value: fmt.Sprintf("%d", elementSize)})
+	
+	result := is.newTemp()
+	is.emit(OpAdd, result, baseAddr, byteOffset)
+	if elementType != "" {
+		result.DataType = elementType + "*"
+	}
+	return result, nil
+}
+
+// lvalue is the address of an assignable expression and what lives there
+type lvalue struct {
+	addr      *Operand // temp holding the address
+	typ       string   // object type (element type for arrays)
+	size      int      // object size in bytes (one element for arrays)
+	arraySize int      // element count when the object is an array
+}
+
+// isNestedLValue reports whether an lvalue needs the general address path:
+// dot access through anything but a variable (a.b.c, a[i].x, p->a.b) or
+// indexing an array member (p->a[i])
+func isNestedLValue(node *ASTNode) bool {
+	if len(node.Children) == 0 {
+		return false
+	}
+	base := node.Children[0]
+	switch node.Type {
+	case NodeMemberAccess:
+		return !node.IsPointer && (base.Type == NodeMemberAccess || base.Type == NodeArrayAccess)
+	case NodeArrayAccess:
+		return base.Type == NodeMemberAccess
+	}
+	return false
+}
+
+// lookupMember finds a struct member by name, looking through typedefs and pointers
+func (is *InstructionSelector) lookupMember(structType, memberName string) (StructMember, error) {
+	structName := strings.TrimSpace(strings.TrimRight(is.resolveType(structType), "*"))
+	structName = strings.TrimPrefix(structName, "struct ")
+	structName = strings.TrimPrefix(structName, "union ")
+	structName = strings.TrimSpace(structName)
+
+	structDef, ok := is.structs[structName]
+	if !ok {
+		return StructMember{}, fmt.Errorf("undefined struct: '%s' (from type: '%s')", structName, structType)
+	}
+	for _, member := range structDef.Members {
+		if member.Name == memberName {
+			return member, nil
+		}
+	}
+	return StructMember{}, fmt.Errorf("struct %s has no member %s", structName, memberName)
+}
+
+// offsetAddress returns addr + offset as a new temp (addr itself for 0)
+func (is *InstructionSelector) offsetAddress(addr *Operand, offset int) *Operand {
+	if offset == 0 {
+		return addr
+	}
+	result := is.newTemp()
+	is.emit(OpAdd, result, addr, &Operand{Type: "imm", Value: fmt.Sprintf("%d", offset)})
+	return result
+}
+
+// selectLValue computes the address of an lvalue expression. Member access
+// and indexing recurse on their base, so arbitrarily nested chains work.
+func (is *InstructionSelector) selectLValue(node *ASTNode) (*lvalue, error) {
+	switch node.Type {
+	case NodeIdentifier:
+		sym, ok := is.localVars[node.VarName]
+		if !ok {
+			sym, ok = is.globalVars[node.VarName]
+		}
+		if !ok {
+			return nil, fmt.Errorf("undefined variable: %s", node.VarName)
+		}
+		addr := is.newTemp()
+		is.emit(OpLoadAddr, addr, &Operand{Type: "var", Value: node.VarName, Offset: sym.Offset, IsGlobal: sym.IsGlobal}, nil)
+		lv := &lvalue{addr: addr, typ: sym.Type, size: sym.Size, arraySize: sym.ArraySize}
+		if sym.ArraySize > 0 {
+			lv.size = sym.Size / sym.ArraySize
+		}
+		return lv, nil
+
+	case NodeUnaryOp:
+		if node.Operator != "*" {
+			break
+		}
+		ptr, err := is.selectExpression(node.Children[0])
+		if err != nil {
+			return nil, err
+		}
+		typ, _ := pointeeType(ptr.DataType)
+		return &lvalue{addr: ptr, typ: typ, size: is.types().SizeOf(typ)}, nil
+
+	case NodeMemberAccess:
+		baseNode := node.Children[0]
+		var baseAddr *Operand
+		var structType string
+		if node.IsPointer {
+			// p->m: the base's value is the struct address
+			ptr, err := is.selectExpression(baseNode)
+			if err != nil {
+				return nil, err
+			}
+			baseAddr = ptr
+			structType, _ = pointeeType(ptr.DataType)
+			if structType == "" {
+				structType, _ = pointeeType(baseNode.DataType)
+			}
+		} else if !isAddressable(baseNode) {
+			// Struct values (calls, compound literals): address their slot
+			val, err := is.selectExpression(baseNode)
+			if err != nil {
+				return nil, err
+			}
+			structType = val.DataType
+			baseAddr = is.structAddress(val, structType)
+		} else {
+			base, err := is.selectLValue(baseNode)
+			if err != nil {
+				return nil, err
+			}
+			baseAddr = base.addr
+			structType = base.typ
+		}
+
+		member, err := is.lookupMember(structType, node.MemberName)
+		if err != nil {
+			return nil, err
+		}
+		lv := &lvalue{addr: is.offsetAddress(baseAddr, member.Offset), typ: member.Type, size: member.Size, arraySize: member.ArraySize}
+		if member.ArraySize > 0 {
+			lv.size = member.Size / member.ArraySize
+		}
+		return lv, nil
+
+	case NodeArrayAccess:
+		baseNode := node.Children[0]
+		var baseAddr *Operand
+		var elementType string
+		elementSize := 8
+		var err error
+
+		var ptr *Operand
+		if isAddressable(baseNode) {
+			base, err := is.selectLValue(baseNode)
+			if err != nil {
+				return nil, err
+			}
+			if base.arraySize > 0 {
+				// Array object: index from its own storage
+				baseAddr = base.addr
+				elementType = base.typ
+				elementSize = base.size
+				if baseNode.Type == NodeIdentifier && !is.isStructType(elementType) {
+					// Scalar array variables use 8-byte slots (see NodeArrayAccess)
+					elementSize = 8
+				}
+			} else {
+				ptr = is.loadLValue(base)
+			}
+		} else {
+			ptr, err = is.selectExpression(baseNode)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if ptr != nil {
+			// Pointer: index from its value
+			baseAddr = ptr
+			elementType, _ = pointeeType(ptr.DataType)
+			if size := is.types().SizeOf(elementType); elementType != "" && size > 0 {
+				elementSize = size
+			}
+		}
+
+		index, err := is.selectExpression(node.Children[1])
+		if err != nil {
+			return nil, err
+		}
+		byteOffset := is.newTemp()
+		is.emit(OpMul, byteOffset, index, &Operand{Type: "imm", Value: fmt.Sprintf("%d", elementSize)})
+		addr := is.newTemp()
+		is.emit(OpAdd, addr, baseAddr, byteOffset)
+		return &lvalue{addr: addr, typ: elementType, size: elementSize}, nil
+	}
+	return nil, fmt.Errorf("expression is not assignable (node type %d, in function: %s)", node.Type, is.currentFunc)
+}
+
+// compoundOps maps compound assignment operators to the operation they apply
+var compoundOps = map[string]OpCode{
+	"+=": OpAdd, "-=": OpSub, "*=": OpMul, "/=": OpDiv, "%=": OpMod,
+	"&=": OpAnd, "|=": OpOr, "^=": OpXor, "<<=": OpShl, ">>=": OpShr,
+}
+
+// selectCompoundAssign selects x op= v. The target is evaluated once, so
+// side effects in it (a[f()] += 1) happen once: a variable is loaded and
+// stored in place, anything else has its address computed into a temp that
+// both the load and the store go through.
+func (is *InstructionSelector) selectCompoundAssign(node *ASTNode) (*Operand, error) {
+	op, ok := compoundOps[node.Operator]
+	if !ok {
+		return nil, fmt.Errorf("unsupported compound assignment: %s", node.Operator)
+	}
+	target := node.Children[0]
+	
+	var oldValue *Operand
+	var store func(value *Operand)
+	switch {
+	case target.Type == NodeIdentifier:
+		var varOp *Operand
+		var varType string
+		if sym, ok := is.localVars[target.VarName]; ok {
+			varOp = &Operand{Type: "var", Value: target.VarName, Offset: sym.Offset}
+			varType = sym.Type
+		} else if sym, ok := is.globalVars[target.VarName]; ok {
+			varOp = &Operand{Type: "var", Value: target.VarName, IsGlobal: true}
+			varType = sym.Type
+		} else {
+			return nil, fmt.Errorf("undefined variable: %s", target.VarName)
+		}
+		oldValue = is.newTemp()
+		oldValue.DataType = varType
+		is.emit(OpLoad, oldValue, varOp, nil)
+		store = func(value *Operand) { is.emit(OpStore, varOp, value, nil) }
+	case isAddressable(target):
+		lv, err := is.selectLValue(target)
+		if err != nil {
+			return nil, err
+		}
+		oldValue = is.loadLValue(lv)
+		store = func(value *Operand) { is.storeLValue(lv, value) }
+	default:
+		return nil, fmt.Errorf("invalid compound assignment target")
+	}
+	
+	rightValue, err := is.selectExpression(node.Children[1])
+	if err != nil {
+		return nil, err
+	}
+	if node.DataType == "" {
+		result := is.newTemp()
+		result.DataType = oldValue.DataType
+		is.emit(op, result, oldValue, rightValue)
+		store(result)
+		return result, nil
+	}
+	// Computed in the type the checker chose, then converted back
+	targetType := oldValue.DataType
+	typ := is.scalarType(node.DataType)
+	result := is.newTemp()
+	result.DataType = typ
+	is.emit(op, result, is.convert(oldValue, targetType, typ), is.typed(rightValue, typ))
+	switch op {
+	case OpAdd, OpSub, OpMul, OpShl:
+		result = is.wrap(result, typ)
+	}
+	result = is.convert(result, typ, targetType)
+	store(result)
+	return result, nil
+}
+
+// isAddressable reports whether selectLValue can take node's address
+func isAddressable(node *ASTNode) bool {
+	switch node.Type {
+	case NodeIdentifier, NodeMemberAccess, NodeArrayAccess:
+		return true
+	case NodeUnaryOp:
+		return node.Operator == "*"
+	}
+	return false
+}
+
+// isStructType reports whether typ names a struct or union (not a pointer to one)
+func (is *InstructionSelector) isStructType(typ string) bool {
+	typ = is.resolveType(typ)
+	return !strings.HasSuffix(typ, "*") && (strings.HasPrefix(typ, "struct ") || strings.HasPrefix(typ, "union "))
+}
+
+// loadLValue reads an lvalue. Arrays decay to their address, and structs too
+// big for a register are represented by their address like other struct temps.
+func (is *InstructionSelector) loadLValue(lv *lvalue) *Operand {
+	if lv.arraySize > 0 {
+		lv.addr.DataType = lv.typ + "*"
+		return lv.addr
+	}
+	if lv.size > 8 {
+		lv.addr.DataType = lv.typ
+		return lv.addr
+	}
+	result := is.newTemp()
+	result.DataType = lv.typ
+	is.emit(OpLoad, result, &Operand{Type: "ptr", IndexTemp: lv.addr, Size: lv.size, DataType: lv.typ}, nil)
+	if lv.size == 4 && is.isSingle(lv.typ) {
+		result = is.widen(result)
+		result.DataType = lv.typ
+	}
+	return result
+}
+
+// storeLValue writes value to an lvalue, copying structs larger than a register
+func (is *InstructionSelector) storeLValue(lv *lvalue, value *Operand) {
+	if lv.size <= 8 {
+		if lv.size == 4 && is.isSingle(lv.typ) {
+			value = is.narrow(value)
+		}
+		is.emit(OpStore, &Operand{Type: "ptr", IndexTemp: lv.addr, Size: lv.size, DataType: lv.typ}, value, nil)
+		return
+	}
+	// value is a slot or variable, or a temp holding the source's address
+	src := value
+	if value.Type == "mem" || value.Type == "var" {
+		src = is.structAddress(value, lv.typ)
+	}
+	is.copyBytes(lv.addr, src, lv.size)
+}
+
 func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error) {
+	start := len(is.instructions)
+	result, err := is.selectExpressionKind(node)
+	if err == nil && node != nil && is.accessesVolatile(node) {
+		is.markVolatile(start)
+	}
+	return result, err
+}
+
+func (is *InstructionSelector) selectExpressionKind(node *ASTNode) (*Operand, error) {
 	if node == nil {
 		return nil, nil
 	}
@@ -806,14 +1689,27 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 	case NodeNumber:
 		op := &Operand{Type: "imm", Value: node.Value}
 		if node.DataType != "" {
-			op.DataType = node.DataType
+			op.DataType = is.scalarType(node.DataType)
+		}
+		// An instruction's immediate is 32 bits, sign-extended; a wider
+		// constant is loaded into a register first
+		if n, err := parseIntegerLiteral(node.Value); err == nil && !is.isFloatingType(op.DataType) && int64(int32(n)) != n {
+			temp := is.newTemp()
+			temp.DataType = op.DataType
+			is.emit(OpMov, temp, op, nil)
+			return temp, nil
 		}
 		return op, nil
 		
+	case NodeSizeof:
+		// Sized by the type checker; the operand isn't evaluated
+		if is.warnUnusedVariable {
+			is.markSizeofOperands(node)
+		}
+		return &Operand{Type: "imm", Value: fmt.Sprintf("%d", node.IntValue), DataType: "unsigned long"}, nil
+		
 	case NodeString:
-		label := is.newLabel(".str")
-		is.stringLits[label] = node.Value
-		return &Operand{Type: "label", Value: label}, nil
+		return &Operand{Type: "label", Value: is.stringLabel(node.Value)}, nil
 		
 	case NodeIdentifier:
 		// Check for enum constants first
@@ -825,12 +1721,26 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 			temp := is.newTemp()
 			temp.DataType = sym.Type
 			varOp := &Operand{Type: "var", Value: node.VarName, Offset: sym.Offset}
+			if sym.ArraySize > 0 && (is.isStructType(sym.Type) || is.types().SizeOf(sym.Type) == 8) {
+				// An array's value is the address of its first element.
+				// (Only struct and 8-byte elements are laid out as in C;
+				// narrower scalars use 8-byte slots, see NodeArrayAccess.)
+				temp.DataType = sym.Type + "*"
+				is.emit(OpLoadAddr, temp, varOp, nil)
+				return temp, nil
+			}
 			is.emit(OpLoad, temp, varOp, nil)
 			return temp, nil
 		} else if sym, ok := is.globalVars[node.VarName]; ok {
 			temp := is.newTemp()
 			temp.DataType = sym.Type
 			varOp := &Operand{Type: "var", Value: node.VarName, IsGlobal: true}
+			if sym.ArraySize > 0 && (is.isStructType(sym.Type) || is.types().SizeOf(sym.Type) == 8) {
+				// As for a local array
+				temp.DataType = sym.Type + "*"
+				is.emit(OpLoadAddr, temp, varOp, nil)
+				return temp, nil
+			}
 			is.emit(OpLoad, temp, varOp, nil)
 			return temp, nil
 		} else if _, ok := is.functions[node.VarName]; ok {
@@ -841,6 +1751,9 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 		return nil, fmt.Errorf("undefined variable: %s (in function: %s)", node.VarName, is.currentFunc)
 		
 	case NodeBinaryOp:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return is.selectLogical(node)
+		}
 		left, err := is.selectExpression(node.Children[0])
 		if err != nil {
 			return nil, err
@@ -853,8 +1766,21 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 		
 		result := is.newTemp()
 		
-		// Propagate type: if either operand is float/double, result is float/double
-		if left.DataType == "double" || right.DataType == "double" {
+		if node.DataType != "" {
+			// The checker brought the operands to the type the operation
+			// is computed in
+			typ := is.scalarType(node.DataType)
+			left = is.typed(left, typ)
+			if node.Operator != "<<" && node.Operator != ">>" {
+				right = is.typed(right, typ)
+			}
+			result.DataType = typ
+			switch node.Operator {
+			case "==", "!=", "<", "<=", ">", ">=":
+				result.DataType = "int"
+			}
+		} else if left.DataType == "double" || right.DataType == "double" {
+			// Propagate type: if either operand is float/double, result is float/double
 			result.DataType = "double"
 		} else if left.DataType == "float" || right.DataType == "float" {
 			result.DataType = "float"
@@ -897,22 +1823,14 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 			is.emit(OpGt, result, left, right)
 		case ">=":
 			is.emit(OpGe, result, left, right)
-		case "&&":
-			// Short-circuit AND
-			endLabel := is.newLabel(".L_and_end")
-			is.emit(OpJz, &Operand{Type: "label", Value: endLabel}, left, nil)
-			is.emit(OpMov, result, right, nil)
-			is.emit(OpLabel, &Operand{Type: "label", Value: endLabel}, nil, nil)
-		case "||":
-			// Short-circuit OR
-			endLabel := is.newLabel(".L_or_end")
-			is.emit(OpJnz, &Operand{Type: "label", Value: endLabel}, left, nil)
-			is.emit(OpMov, result, right, nil)
-			is.emit(OpLabel, &Operand{Type: "label", Value: endLabel}, nil, nil)
 		default:
 			return nil, fmt.Errorf("unknown binary operator: %s", node.Operator)
 		}
 		
+		switch node.Operator {
+		case "+", "-", "*", "<<":
+			return is.wrap(result, result.DataType), nil
+		}
 		return result, nil
 		
 	case NodeUnaryOp:
@@ -923,11 +1841,14 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 			if node.Children[0].Type == NodeIdentifier {
 				varName := node.Children[0].VarName
 				var varOp *Operand
+				var varType string
 				
 				if sym, ok := is.localVars[varName]; ok {
 					varOp = &Operand{Type: "var", Value: varName, Offset: sym.Offset}
-				} else if _, ok := is.globalVars[varName]; ok {
+					varType = sym.Type
+				} else if sym, ok := is.globalVars[varName]; ok {
 					varOp = &Operand{Type: "var", Value: varName, IsGlobal: true}
+					varType = sym.Type
 				} else {
 					return nil, fmt.Errorf("undefined variable: %s", varName)
 				}
@@ -945,6 +1866,7 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 				} else {
 					is.emit(OpSub, newVal, currentVal, one)
 				}
+				newVal = is.wrap(newVal, varType)
 				
 				// Store new value back to variable
 				is.emit(OpStore, varOp, newVal, nil)
@@ -958,9 +1880,70 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 					return newVal, nil
 				}
 			}
+			// Members, elements and *p: read, then write back through the
+			// address, once each (the target might be volatile)
+			if isAddressable(node.Children[0]) {
+				lv, err := is.selectLValue(node.Children[0])
+				if err != nil {
+					return nil, err
+				}
+				currentVal := is.loadLValue(lv)
+				one := &Operand{Type: "imm", Value: "1"}
+				newVal := is.newTemp()
+				newVal.DataType = currentVal.DataType
+				if node.Operator == "++" || node.Operator == "++_post" {
+					is.emit(OpAdd, newVal, currentVal, one)
+				} else {
+					is.emit(OpSub, newVal, currentVal, one)
+				}
+				newVal = is.wrap(newVal, lv.typ)
+				is.storeLValue(lv, newVal)
+				if node.Operator == "++_post" || node.Operator == "--_post" {
+					return currentVal, nil
+				}
+				return newVal, nil
+			}
 			// Fallthrough for complex expressions
 		}
 		
+		// &arr[i]: compute the element address without loading it
+		if node.Operator == "&" && node.Children[0].Type == NodeArrayAccess {
+			return is.selectElementAddress(node.Children[0])
+		}
+		
+		// &s.m, &p->m: the member's address, through the same path stores
+		// to it take
+		if node.Operator == "&" && node.Children[0].Type == NodeMemberAccess {
+			lv, err := is.selectLValue(node.Children[0])
+			if err != nil {
+				return nil, err
+			}
+			result := is.newTemp()
+			result.DataType = lv.typ + "*"
+			is.emit(OpMov, result, lv.addr, nil)
+			return result, nil
+		}
+		
+		// &x: x's address, without reading x (which might be volatile)
+		if node.Operator == "&" && node.Children[0].Type == NodeIdentifier {
+			varName := node.Children[0].VarName
+			result := &Operand{Type: "addr", Value: varName}
+			sym, ok := is.localVars[varName]
+			if ok {
+				// Address of a local variable (rbp + offset)
+				result.Offset = sym.Offset
+			} else if sym, ok = is.globalVars[varName]; ok {
+				result.IsGlobal = true
+			} else {
+				return nil, fmt.Errorf("undefined variable: %s", varName)
+			}
+			result.DataType = sym.Type + "*"
+			if sym.IsVolatile {
+				result.DataType = addVolatile(sym.Type) + "*"
+			}
+			return result, nil
+		}
+		
 		operand, err := is.selectExpression(node.Children[0])
 		if err != nil {
 			return nil, err
@@ -969,14 +1952,25 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 		result := is.newTemp()
 		
 		switch node.Operator {
+		case "+":
+			result.DataType = operand.DataType
+			is.emit(OpMov, result, operand, nil)
 		case "-":
+			if is.isFloatingType(operand.DataType) {
+				// negq would flip the wrong bits: subtract from zero
+				result.DataType = "double"
+				is.emit(OpSub, result, &Operand{Type: "imm", Value: "0.0", DataType: "double"}, operand)
+				return result, nil
+			}
 			is.emit(OpNeg, result, operand, nil)
+			return is.wrapUnary(result, operand), nil
 		case "!":
 			is.emit(OpNot, result, operand, nil)
 		case "~":
 			// Bitwise NOT
 			allOnes := &Operand{Type: "imm", Value: "-1"}
 			is.emit(OpXor, result, operand, allOnes)
+			return is.wrapUnary(result, operand), nil
 		case "++":
 			// Pre-increment (fallback for complex expressions)
 			one := &Operand{Type: "imm", Value: "1"}
@@ -998,33 +1992,13 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 			one := &Operand{Type: "imm", Value: "1"}
 			is.emit(OpSub, operand, operand, one)
 		case "&":
-			// Address-of operator
-			if node.Children[0].Type != NodeIdentifier {
-				return nil, fmt.Errorf("& operator requires identifier")
-			}
-			varName := node.Children[0].VarName
-			if sym, ok := is.localVars[varName]; ok {
-				// Return address of local variable (rbp + offset)
-				result.Type = "addr"
-				result.Value = varName
-				result.Offset = sym.Offset
-			} else if _, ok := is.globalVars[varName]; ok {
-				result.Type = "addr"
-				result.Value = varName
-				result.IsGlobal = true
-			} else {
-				return nil, fmt.Errorf("undefined variable: %s", varName)
-			}
-			return result, nil
+			return nil, fmt.Errorf("& operator requires identifier")
 		case "*":
 			// Dereference operator - load from pointer
-			// operand contains the address, load from it
-			is.emit(OpLoad, result, &Operand{Type: "ptr", Value: operand.Value, IndexTemp: operand}, nil)
-			
-			// If operand has type info like "Type*", result should be "Type"
-			if operand.DataType != "" && strings.HasSuffix(operand.DataType, "*") {
-				result.DataType = strings.TrimSpace(operand.DataType[:len(operand.DataType)-1])
-			}
+			// operand contains the address, load from it at the pointee's width
+			pointee, _ := pointeeType(operand.DataType)
+			is.emit(OpLoad, result, &Operand{Type: "ptr", Value: operand.Value, IndexTemp: operand, DataType: pointee}, nil)
+			result.DataType = pointee
 			return result, nil
 		default:
 			return nil, fmt.Errorf("unknown unary operator: %s", node.Operator)
@@ -1038,6 +2012,14 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 			return nil, fmt.Errorf("array access needs 2 operands")
 		}
 		
+		if isNestedLValue(node) {
+			lv, err := is.selectLValue(node)
+			if err != nil {
+				return nil, err
+			}
+			return is.loadLValue(lv), nil
+		}
+		
 		// Get base - can be an identifier, member access, or any pointer expression
 		baseNode := node.Children[0]
 		
@@ -1053,15 +2035,18 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 			var baseOffset int
 			var isGlobal bool
 			var varType string
+			var isArray bool
 			
 			if sym, ok := is.localVars[varName]; ok {
 				baseOffset = sym.Offset
 				isGlobal = false
 				varType = sym.Type
+				isArray = sym.ArraySize > 0
 			} else if sym, ok := is.globalVars[varName]; ok {
 				baseOffset = 0
 				isGlobal = true
 				varType = sym.Type
+				isArray = sym.ArraySize > 0
 			} else {
 				return nil, fmt.Errorf("undefined array: %s", varName)
 			}
@@ -1070,10 +2055,10 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 			var elementType string
 			var elementSize int
 			
-			if strings.Contains(varType, "*") {
+			if strings.Contains(varType, "*") && !isArray {
 				// Pointer type - element is what it points to
 				elementType = strings.TrimSuffix(strings.TrimSpace(varType), "*")
-				elementSize = is.getTypeSize(elementType)
+				elementSize = is.types().SizeOf(elementType)
 			} else {
 				// Array type - for now assume 8-byte elements
 				elementType = varType
@@ -1087,7 +2072,7 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 			
 			// Check if the variable is a pointer type
 			// Pointers need to be dereferenced, not accessed as arrays
-			if strings.Contains(varType, "*") {
+			if strings.Contains(varType, "*") && !isArray {
 				// It's a pointer - load the pointer value first, then index it
 				baseAddr, err := is.selectExpression(baseNode)
 				if err != nil {
@@ -1112,6 +2097,9 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 			
 			// Use the optimized array access path for actual arrays
 			result := is.newTemp()
+			if is.isFloatingType(elementType) {
+				result.DataType = elementType
+			}
 			arrayOp := &Operand{
 				Type:      "array",
 				Value:     varName,
@@ -1155,6 +2143,15 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 			return nil, fmt.Errorf("member access needs base")
 		}
 		
+		// a.b.c, a[i].x: address the whole chain
+		if isNestedLValue(node) {
+			lv, err := is.selectLValue(node)
+			if err != nil {
+				return nil, err
+			}
+			return is.loadLValue(lv), nil
+		}
+		
 		baseNode := node.Children[0]
 		memberName := node.MemberName
 		isPtr := node.IsPointer  // true for -> operator
@@ -1269,11 +2266,13 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 		memberOffset := -1
 		memberSize := 8  // Default
 		memberType := "" // NEW: track member type
+		memberArray := false
 		for _, member := range structDef.Members {
 			if member.Name == memberName {
 				memberOffset = member.Offset
 				memberSize = member.Size
 				memberType = member.Type // NEW: get member type
+				memberArray = member.ArraySize > 0
 				break
 			}
 		}
@@ -1282,6 +2281,20 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 			return nil, fmt.Errorf("struct %s has no member %s", structName, memberName)
 		}
 		
+		if memberArray {
+			// An array member's value is the address of its first element
+			structAddr := baseTemp
+			if baseTemp.Type == "var" || baseTemp.Type == "mem" {
+				structAddr = is.newTemp()
+				op := OpLoadAddr
+				if isPtr {
+					op = OpLoad
+				}
+				is.emit(op, structAddr, &Operand{Type: baseTemp.Type, Value: baseTemp.Value, Offset: baseTemp.Offset, IsGlobal: baseTemp.IsGlobal}, nil)
+			}
+			return is.typed(is.offsetAddress(structAddr, memberOffset), memberType+"*"), nil
+		}
+		
 		// Load member value
 		result := is.newTemp()
 		result.DataType = memberType // NEW: set result DataType
@@ -1313,7 +2326,8 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 		} else {
 			// struct.member: direct access
 			// This only works for simple variable bases
-			if baseTemp.Type == "var" {
+			if baseTemp.Type == "var" || baseTemp.Type == "mem" {
+				// Variables and struct slots (compound literals, call results)
 				finalOffset := baseTemp.Offset + memberOffset
 				memberOp := &Operand{Type: "var", Value: baseTemp.Value, Offset: finalOffset, IsGlobal: baseTemp.IsGlobal, Size: memberSize, DataType: memberType}
 				is.emit(OpLoad, result, memberOp, nil)
@@ -1340,259 +2354,53 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 			}
 		}
 		
+		if memberSize == 4 && is.isSingle(memberType) {
+			result = is.widen(result)
+			result.DataType = memberType
+		}
 		return result, nil
 		
 	case NodeAssignment:
-		// Expand compound assignments to regular assignments
-		// e.g., x += 5 becomes x = x + 5
+		if node.Operator == "=" {
+			is.checkConstDiscard(is.exprType(node.Children[0]), node.Children[1], "assignment")
+		}
+		
 		if node.Operator != "=" {
-			oldValue, err := is.selectExpression(node.Children[0])
+			return is.selectCompoundAssign(node)
+		}
+		
+		// Nested lvalues (a.b.c = v, p->a[i].x = v): address, then store
+		if isNestedLValue(node.Children[0]) {
+			lv, err := is.selectLValue(node.Children[0])
 			if err != nil {
 				return nil, err
 			}
-			
-			rightValue, err := is.selectExpression(node.Children[1])
+			value, err := is.selectExpression(node.Children[1])
 			if err != nil {
 				return nil, err
 			}
-			
-			temp := is.newTemp()
-			switch node.Operator {
-			case "+=":
-				is.emit(OpAdd, temp, oldValue, rightValue)
-			case "-=":
-				is.emit(OpSub, temp, oldValue, rightValue)
-			case "*=":
-				is.emit(OpMul, temp, oldValue, rightValue)
-			case "/=":
-				is.emit(OpDiv, temp, oldValue, rightValue)
-			case "%=":
-				is.emit(OpMod, temp, oldValue, rightValue)
-			case "&=":
-				is.emit(OpAnd, temp, oldValue, rightValue)
-			case "|=":
-				is.emit(OpOr, temp, oldValue, rightValue)
-			case "^=":
-				is.emit(OpXor, temp, oldValue, rightValue)
-			case "<<=":
-				is.emit(OpShl, temp, oldValue, rightValue)
-			case ">>=":
-				is.emit(OpShr, temp, oldValue, rightValue)
-			default:
-				return nil, fmt.Errorf("unsupported compound assignment: %s", node.Operator)
-			}
-			
-			// Replace the right side with the computed value
-			node.Children[1] = &ASTNode{
-				Type: NodeIdentifier, // Placeholder - will use temp operand
-			}
-			// Update operator to simple assignment
-			node.Operator = "="
-			// Update right side value
-			node.Children[1] = &ASTNode{
-				Type: NodeNumber,
-				Value: "", // Will be replaced by temp below
-			}
-			// Store the temp as the value to assign
-			// Fall through to regular assignment handling with temp as the value
-			
-			// Continue with normal assignment, but using temp as value
-			var assignValue = temp
-			
-			// Now handle the assignment based on lvalue type
-			if node.Children[0].Type == NodeArrayAccess {
-				arrayNode := node.Children[0]
-				baseNode := arrayNode.Children[0]
-				
-				// Get index
-				index, err := is.selectExpression(arrayNode.Children[1])
-				if err != nil {
-					return nil, err
-				}
-				
-				// Calculate byte offset: index * 8
-				elementSize := &Operand{Type: "imm", Value: "8"}
-				byteOffset := is.newTemp()
-				is.emit(OpMul, byteOffset, index, elementSize)
-				
-				// Check if base is a simple identifier (local/global array)
-				if baseNode.Type == NodeIdentifier {
-					varName := baseNode.VarName
-					var baseOffset int
-					var isGlobal bool
-					
-					if sym, ok := is.localVars[varName]; ok {
-						baseOffset = sym.Offset
-						isGlobal = false
-					} else if _, ok := is.globalVars[varName]; ok {
-						baseOffset = 0
-						isGlobal = true
-					} else {
-						return nil, fmt.Errorf("undefined array: %s", varName)
-					}
-					
-					arrayOp := &Operand{
-						Type:      "array",
-						Value:     varName,
-						Offset:    baseOffset,
-						IsGlobal:  isGlobal,
-						IndexTemp: byteOffset,
-					}
-					is.emit(OpStore, arrayOp, assignValue, nil)
-				} else {
-					baseAddr, err := is.selectExpression(baseNode)
-					if err != nil {
-						return nil, err
-					}
-					
-					finalAddr := is.newTemp()
-					is.emit(OpAdd, finalAddr, baseAddr, byteOffset)
-					
-					ptrOp := &Operand{
-						Type:      "ptr",
-						IndexTemp: finalAddr,
-					}
-					is.emit(OpStore, ptrOp, assignValue, nil)
-				}
-				
-				return assignValue, nil
-			}
-			
-			// Handle member access compound assignment
-			if node.Children[0].Type == NodeMemberAccess {
-				memberNode := node.Children[0]
-				baseNode := memberNode.Children[0]
-				memberName := memberNode.MemberName
-				isPtr := memberNode.IsPointer
-				
-				var structType string
-				var baseTemp *Operand
-				
-				if baseNode.Type == NodeIdentifier {
-					varName := baseNode.VarName
-					var baseOffset int
-					var isGlobal bool
-					
-					if sym, ok := is.localVars[varName]; ok {
-						baseOffset = sym.Offset
-						isGlobal = false
-						structType = sym.Type
-					} else if sym, ok := is.globalVars[varName]; ok {
-						baseOffset = 0
-						isGlobal = true
-						structType = sym.Type
-					} else {
-						return nil, fmt.Errorf("undefined variable: %s", varName)
-					}
-					
-					baseTemp = &Operand{Type: "var", Value: varName, Offset: baseOffset, IsGlobal: isGlobal}
-				} else {
-					baseTempVal, err := is.selectExpression(baseNode)
-					if err != nil {
-						return nil, err
-					}
-					baseTemp = baseTempVal
-					structType = baseTemp.DataType
-					if structType == "" {
-						structType = baseNode.DataType
-					}
-				}
-				
-				structType = is.resolveType(structType)
-				structName := structType
-				for len(structName) > 0 && structName[len(structName)-1] == '*' {
-					structName = structName[:len(structName)-1]
-				}
-				structName = strings.TrimSpace(structName)
-				
-				if len(structName) > 7 && structName[:7] == "struct " {
-					structName = structName[7:]
-				} else if len(structName) > 6 && structName[:6] == "union " {
-					structName = structName[6:]
-				}
-				structName = strings.TrimSpace(structName)
-				
-				structDef, ok := is.structs[structName]
-				if !ok {
-					return nil, fmt.Errorf("undefined struct: %s", structName)
-				}
-				
-				memberOffset := -1
-				memberSize := 8  // Default
-				for _, member := range structDef.Members {
-					if member.Name == memberName {
-						memberOffset = member.Offset
-						memberSize = member.Size
-						break
-					}
-				}
-				
-				if memberOffset == -1 {
-					return nil, fmt.Errorf("struct %s has no member %s", structName, memberName)
-				}
-				
-				if isPtr {
-					var ptrTemp *Operand
-					
-					if baseTemp.Type == "var" {
-						ptrTempReg := is.newTemp()
-						is.emit(OpLoad, ptrTempReg, baseTemp, nil)
-						ptrTemp = ptrTempReg
-					} else {
-						ptrTemp = baseTemp
-					}
-					
-					if memberOffset != 0 {
-						offsetOp := &Operand{Type: "imm", Value: fmt.Sprintf("%d", memberOffset)}
-						ptrWithOffset := is.newTemp()
-						is.emit(OpAdd, ptrWithOffset, ptrTemp, offsetOp)
-						ptrTemp = ptrWithOffset
-					}
-					
-					memberOp := &Operand{Type: "ptr", IndexTemp: ptrTemp, Size: memberSize}
-					is.emit(OpStore, memberOp, assignValue, nil)
-				} else {
-					if baseTemp.Type == "var" {
-						finalOffset := baseTemp.Offset + memberOffset
-						memberOp := &Operand{Type: "var", Value: baseTemp.Value, Offset: finalOffset, IsGlobal: baseTemp.IsGlobal, Size: memberSize}
-						is.emit(OpStore, memberOp, assignValue, nil)
-						return assignValue, nil
-					} else {
-						return nil, fmt.Errorf("dot access on complex expression for assignment not yet supported")
-					}
-				}
-				
-				return assignValue, nil
+			is.storeLValue(lv, value)
+			return value, nil
+		}
+		
+		// Struct assignment copies the whole struct. The value goes first so
+		// the destination address is only live for the copy itself.
+		if is.isStructValue(node.Children[1]) && isAddressable(node.Children[0]) {
+			value, err := is.selectStructValue(node.Children[1])
+			if err != nil {
+				return nil, err
 			}
-			
-			// Handle dereference compound assignment
-			if node.Children[0].Type == NodeUnaryOp && node.Children[0].Operator == "*" {
-				ptrExpr, err := is.selectExpression(node.Children[0].Children[0])
-				if err != nil {
-					return nil, err
-				}
-				
-				ptrOp := &Operand{Type: "ptr", IndexTemp: ptrExpr}
-				is.emit(OpStore, ptrOp, assignValue, nil)
-				return assignValue, nil
+			lv, err := is.selectLValue(node.Children[0])
+			if err != nil {
+				return nil, err
 			}
-			
-			// Handle regular variable compound assignment
-			if node.Children[0].Type == NodeIdentifier {
-				varName := node.Children[0].VarName
-				
-				if sym, ok := is.localVars[varName]; ok {
-					varOp := &Operand{Type: "var", Value: varName, Offset: sym.Offset}
-					is.emit(OpStore, varOp, assignValue, nil)
-				} else if _, ok := is.globalVars[varName]; ok {
-					varOp := &Operand{Type: "var", Value: varName, IsGlobal: true}
-					is.emit(OpStore, varOp, assignValue, nil)
-				}
-				
-				return assignValue, nil
+			if lv.typ == "" {
+				// *p through an untyped pointer: size the copy from the value
+				lv.typ = is.structValueType(node.Children[1])
+				lv.size = is.types().SizeOf(lv.typ)
 			}
-			
-			return nil, fmt.Errorf("invalid compound assignment target")
+			is.storeLValue(lv, value)
+			return value, nil
 		}
 		
 		// Handle array assignment: arr[i] = value or expr[i] = value
@@ -1735,10 +2543,12 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 			// Find member offset and size
 			memberOffset := -1
 			memberSize := 8  // Default
+			memberType := ""
 			for _, member := range structDef.Members {
 				if member.Name == memberName {
 					memberOffset = member.Offset
 					memberSize = member.Size
+					memberType = member.Type
 					break
 				}
 			}
@@ -1752,6 +2562,10 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 			if err != nil {
 				return nil, err
 			}
+			stored := value
+			if memberSize == 4 && is.isSingle(memberType) {
+				stored = is.narrow(value)
+			}
 			
 			// Store to member
 			if isPtr {
@@ -1778,7 +2592,7 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 				
 				// Store to pointer
 				memberOp := &Operand{Type: "ptr", IndexTemp: ptrTemp, Size: memberSize}
-				is.emit(OpStore, memberOp, value, nil)
+				is.emit(OpStore, memberOp, stored, nil)
 			} else {
 				// struct.member: direct access
 				// Need to compute address of base, add member offset, and store
@@ -1787,7 +2601,7 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 					// Simple variable
 					finalOffset := baseTemp.Offset + memberOffset
 					memberOp := &Operand{Type: "var", Value: baseTemp.Value, Offset: finalOffset, IsGlobal: baseTemp.IsGlobal, Size: memberSize}
-					is.emit(OpStore, memberOp, value, nil)
+					is.emit(OpStore, memberOp, stored, nil)
 					return value, nil
 				} else {
 					// Complex expression - need address
@@ -1813,67 +2627,6 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 				return nil, err
 			}
 			
-			// Check if we're assigning a struct
-			// Only if RHS is a direct compound literal (not inside a statement expression)
-			isStructCopy := false
-			var structSize int
-			
-			// Check if RHS is a compound literal
-			if node.Children[1].Type == NodeCompoundLiteral {
-				isStructCopy = true
-				structType := node.Children[1].DataType
-				structSize = is.getTypeSize(structType)
-			}
-			
-			if isStructCopy && structSize > 0 {
-				// Generate a memory copy: copy structSize bytes from value (src addr) to ptrExpr (dst addr)
-				if structSize <= 32 {
-					// Small struct: copy field by field (8 bytes at a time)
-					for offset := 0; offset < structSize; offset += 8 {
-						remaining := structSize - offset
-						copySize := 8
-						if remaining < 8 {
-							copySize = remaining
-						}
-						
-						// Load from source: *(value + offset)
-						srcTemp := is.newTemp()
-						if offset > 0 {
-							offsetOp := &Operand{Type: "imm", Value: fmt.Sprintf("%d", offset)}
-							srcAddr := is.newTemp()
-							is.emit(OpAdd, srcAddr, value, offsetOp)
-							srcOp := &Operand{Type: "ptr", IndexTemp: srcAddr, Size: copySize}
-							is.emit(OpLoad, srcTemp, srcOp, nil)
-						} else {
-							srcOp := &Operand{Type: "ptr", IndexTemp: value, Size: copySize}
-							is.emit(OpLoad, srcTemp, srcOp, nil)
-						}
-						
-						// Store to dest: *(ptrExpr + offset)
-						if offset > 0 {
-							offsetOp := &Operand{Type: "imm", Value: fmt.Sprintf("%d", offset)}
-							dstAddr := is.newTemp()
-							is.emit(OpAdd, dstAddr, ptrExpr, offsetOp)
-							dstOp := &Operand{Type: "ptr", IndexTemp: dstAddr, Size: copySize}
-							is.emit(OpStore, dstOp, srcTemp, nil)
-						} else {
-							dstOp := &Operand{Type: "ptr", IndexTemp: ptrExpr, Size: copySize}
-							is.emit(OpStore, dstOp, srcTemp, nil)
-						}
-					}
-				} else {
-					// Large struct: call memcpy
-					// memcpy(ptrExpr, value, structSize)
-					sizeOp := &Operand{Type: "imm", Value: fmt.Sprintf("%d", structSize)}
-					is.emit(OpMov, &Operand{Type: "reg", Value: "rdi"}, ptrExpr, nil)
-					is.emit(OpMov, &Operand{Type: "reg", Value: "rsi"}, value, nil)
-					is.emit(OpMov, &Operand{Type: "reg", Value: "rdx"}, sizeOp, nil)
-					is.emit(OpCall, &Operand{Type: "label", Value: "memcpy"}, nil, nil)
-				}
-				
-				return value, nil
-			}
-			
 			// Store to pointer
 			ptrOp := &Operand{Type: "ptr", IndexTemp: ptrExpr}
 			is.emit(OpStore, ptrOp, value, nil)
@@ -1904,117 +2657,273 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 		return value, nil
 		
 	case NodeCall:
+		if result, ok, err := is.selectMemCall(node); ok {
+			return result, err
+		}
+		if result, ok, err := is.selectAtomic(node, true); ok {
+			return result, err
+		}
+		if result, ok, err := is.selectBitBuiltin(node); ok {
+			return result, err
+		}
+		if node.Name == "__syscall" {
+			return is.selectSyscall(node)
+		}
+		if node.Name == "__builtin_assert" && len(node.Children) == 4 {
+			return is.selectAssert(node)
+		}
+		if node.Name == "__builtin_expect" && len(node.Children) == 2 {
+			// Only a hint for branch layout; the value is the first operand
+			return is.selectExpression(node.Children[0])
+		}
+		
+		// A call through a variable of a pointer-to-function typedef calls
+		// the address it holds, loaded before the arguments are
+		// evaluated, with the typedef's signature
+		var callee *Operand
+		funcSig, prototyped := is.functions[node.Name]
+		if typ := is.functionPointer(node.Name); typ != nil {
+			addr, err := is.selectExpression(&ASTNode{Type: NodeIdentifier, VarName: node.Name, Line: node.Line, Column: node.Column})
+			if err != nil {
+				return nil, err
+			}
+			callee = addr
+			funcSig = &FunctionSignature{ReturnType: typ.Base, ParamTypes: typ.Params, Variadic: typ.Variadic}
+			prototyped = true
+		}
+		
 		// Check if this function returns a large struct
 		var returnType string
-		if funcSig, ok := is.functions[node.Name]; ok {
+		if prototyped {
 			returnType = funcSig.ReturnType
 		}
+		cc := is.target.CallingConvention()
+		if callee == nil {
+			var err error
+			if cc, err = is.conventionOf(node.Name); err != nil {
+				return nil, err
+			}
+		}
+		if err := is.checkPassedByValue(cc, node.Name, returnType, nil); err != nil {
+			return nil, err
+		}
 		
 		// Evaluate arguments
 		args := []*Operand{}
-		for _, argNode := range node.Children {
+		type argGroup struct {
+			n      int  // how many of args the argument is: a struct's eightbytes go together
+			memory bool // a struct over 16 bytes, which always goes on the stack
+		}
+		var groups []argGroup
+		for i, argNode := range node.Children {
+			if prototyped && i < len(funcSig.ParamTypes) {
+				is.checkConstDiscard(funcSig.ParamTypes[i], argNode, fmt.Sprintf("passing argument %d of '%s'", i+1, node.Name))
+			}
+			// Structs up to 16 bytes travel as their eightbytes, each in the
+			// next register of its class; bigger ones are copied onto the
+			// stack an eightbyte at a time
+			if typ := is.structValueType(argNode); typ != "" {
+				if err := is.checkPassedByValue(cc, node.Name, "", []string{typ}); err != nil {
+					return nil, err
+				}
+				classes, small := is.structClasses(typ)
+				if small || cc.StackArgs {
+					val, err := is.selectStructValue(argNode)
+					if err != nil {
+						return nil, err
+					}
+					slot := is.structSlot(val, typ)
+					size := is.types().SizeOf(typ)
+					for k := 0; k < size; k += 8 {
+						part := &Operand{Type: "mem", Offset: slot.Offset + k, DataType: "long"}
+						if small && classes[k/8] == "sse" {
+							part.DataType = "double"
+						}
+						args = append(args, part)
+					}
+					groups = append(groups, argGroup{n: (size + 7) / 8, memory: !small})
+					continue
+				}
+			}
 			arg, err := is.selectExpression(argNode)
 			if err != nil {
 				return nil, err
 			}
+			if prototyped && i < len(funcSig.ParamTypes) && arg.Type == "imm" && !strings.Contains(arg.Value, ".") {
+				// An integer constant passed for a floating parameter is
+				// converted by the prototype, so it goes in an XMM register
+				switch strings.TrimPrefix(is.resolveType(funcSig.ParamTypes[i]), "const ") {
+				case "float", "double":
+					arg = &Operand{Type: "imm", Value: arg.Value + ".0", DataType: "double"}
+				}
+			}
+			if prototyped && i < len(funcSig.ParamTypes) && is.isSingle(funcSig.ParamTypes[i]) {
+				// A float parameter takes single precision; anything
+				// unprototyped or variadic goes as the double it is
+				arg = is.narrow(arg)
+			}
 			args = append(args, arg)
+			groups = append(groups, argGroup{n: 1})
 		}
 		
 		// Check if we need to allocate space for a large struct return
 		var retSlot *Operand
-		argStartIdx := 0
 		
 		if returnType != "" && is.isLargeStruct(returnType) {
 			// Allocate space for return value on stack
-			structSize := is.getTypeSize(returnType)
-			is.stackOffset -= structSize
-			if is.stackOffset%16 != 0 {
-				is.stackOffset -= is.stackOffset % 16
-			}
-			
-			retSlotOffset := is.stackOffset
-			retSlot = &Operand{
-				Type:     "mem",  // Use "mem" type to prevent register allocation
-				Offset:   retSlotOffset,
-				DataType: returnType,
-			}
-			
-			argStartIdx = 1 // Regular arguments start at rsi
+			// Use "mem" type to prevent register allocation
+			retSlot = is.newSlot(SlotReturnBuffer, node.Name, returnType)
 		}
 		
 		// Prepare arguments for call
 		// Use OpSetArg which bypasses register allocation
-		intRegIdx := argStartIdx
+		intRegIdx := 0
 		floatRegIdx := 0
-		intRegs := []string{"rdi", "rsi", "rdx", "rcx", "r8", "r9"}
-		floatRegs := []string{"xmm0", "xmm1", "xmm2", "xmm3", "xmm4", "xmm5", "xmm6", "xmm7"}
-		
-		for _, arg := range args {
-			// Determine if this argument is a float
-			isFloat := arg.DataType == "float" || arg.DataType == "double" ||
-				(arg.Type == "imm" && strings.Contains(arg.Value, "."))
-			
-			if isFloat {
-				if floatRegIdx < len(floatRegs) {
-					regOp := &Operand{Type: "freg", Value: floatRegs[floatRegIdx]}
-					floatRegIdx++
-					is.emit(OpSetArg, regOp, arg, nil)
+		intRegs := cc.argRegisters(retSlot != nil) // after the hidden pointer, if it's an argument
+		floatRegs := cc.FloatArgs
+		
+		type regArg struct{ reg, arg *Operand }
+		var inRegs []regArg
+		var onStack []*Operand
+		next := 0
+		for _, g := range groups {
+			group := args[next : next+g.n]
+			next += g.n
+			ints, sses := 0, 0
+			for _, part := range group {
+				if part.DataType == "double" {
+					sses++
+				} else {
+					ints++
 				}
-			} else {
-				if intRegIdx < len(intRegs) {
-					regOp := &Operand{Type: "reg", Value: intRegs[intRegIdx]}
-					intRegIdx++
-					is.emit(OpSetArg, regOp, arg, nil)
+			}
+			if g.memory || (g.n > 1 && (intRegIdx+ints > len(intRegs) || floatRegIdx+sses > len(floatRegs))) {
+				// A struct whose eightbytes don't all fit in what's left
+				// of the registers goes on the stack whole, and the
+				// registers stay for the arguments after it
+				if cc.StackArgs {
+					onStack = append(onStack, group...)
+				}
+				continue
+			}
+			for _, arg := range group {
+				// Determine if this argument is a float
+				isFloat := arg.DataType == "float" || arg.DataType == "double" ||
+					(arg.Type == "imm" && strings.Contains(arg.Value, "."))
+				
+				if cc.Positional {
+					if isFloat && funcSig.Variadic {
+						return nil, fmt.Errorf("passing a floating argument to '%s', which is variadic and ms_abi, isn't supported", node.Name)
+					}
+					intRegIdx = max(intRegIdx, floatRegIdx)
+					floatRegIdx = intRegIdx
+				}
+				if isFloat {
+					if floatRegIdx < len(floatRegs) {
+						regOp := &Operand{Type: "freg", Value: floatRegs[floatRegIdx]}
+						floatRegIdx++
+						inRegs = append(inRegs, regArg{regOp, arg})
+						continue
+					}
+				} else {
+					if intRegIdx < len(intRegs) {
+						regOp := &Operand{Type: "reg", Value: intRegs[intRegIdx]}
+						intRegIdx++
+						inRegs = append(inRegs, regArg{regOp, arg})
+						continue
+					}
+				}
+				if cc.StackArgs {
+					onStack = append(onStack, arg)
 				}
 			}
 		}
 		
+		// The rest go on the stack, pushed last to first before the
+		// registers are loaded, and padded so %rsp stays 16-byte aligned
+		stackBytes := 8 * len(onStack)
+		if len(onStack)%2 == 1 {
+			is.emit(OpPush, nil, &Operand{Type: "imm", Value: "0"}, nil)
+			stackBytes += 8
+		}
+		for i := len(onStack) - 1; i >= 0; i-- {
+			is.emit(OpPush, nil, onStack[i], nil)
+		}
+		// and below them, room for the callee to keep its register
+		// arguments in (ms_abi)
+		for i := 0; i < cc.ShadowSpace; i += 8 {
+			is.emit(OpPush, nil, &Operand{Type: "imm", Value: "0"}, nil)
+		}
+		stackBytes += cc.ShadowSpace
+		for _, a := range inRegs {
+			is.emit(OpSetArg, a.reg, a.arg, nil)
+		}
+		
 		// NOW emit the hidden pointer load (after args are in place)
 		if retSlot != nil {
-			is.emit(OpLoadAddr, &Operand{Type: "reg", Value: "rdi"}, retSlot, nil)
+			is.emit(OpLoadAddr, &Operand{Type: "reg", Value: cc.StructReturn}, retSlot, nil)
 		}
 		
-		// Call function
-		result := is.newTemp()
+		// Variadic and unprototyped callees read the number of vector
+		// registers used from %al
+		if cc.VarargCount != "" && (!prototyped || funcSig.Variadic) {
+			is.emit(OpSetArg, &Operand{Type: "reg", Value: cc.VarargCount}, &Operand{Type: "imm", Value: fmt.Sprintf("%d", floatRegIdx)}, nil)
+		}
+		
+		// Call function, or the address in %r11, which no argument is in
 		funcOp := &Operand{Type: "label", Value: node.Name}
-		is.emit(OpCall, result, funcOp, &Operand{Type: "imm", Value: fmt.Sprintf("%d", len(args))})
+		if callee != nil {
+			funcOp = &Operand{Type: "reg", Value: "r11"}
+			is.emit(OpSetArg, funcOp, callee, nil)
+		}
+		if prototyped && funcSig.returnsVoid() {
+			// Nothing comes back, so nothing is kept; only a cast to void
+			// reads the "value"
+			is.emitCall(nil, funcOp, &Operand{Type: "imm", Value: fmt.Sprintf("%d", len(args))})
+			is.popArgs(stackBytes)
+			return &Operand{Type: "imm", Value: "0"}, nil
+		}
+		result := is.newTemp()
+		if is.isStructType(returnType) {
+			// Struct results are collected from the return registers below;
+			// copying rax anywhere first could clobber them
+			result = &Operand{Type: "reg", Value: cc.IntResults[0]}
+		}
+		if prototyped && is.isFloatingType(returnType) {
+			// Floating results come back in xmm0, a float as single precision
+			is.emitCall(&Operand{Type: "reg", Value: cc.IntResults[0]}, funcOp, &Operand{Type: "imm", Value: fmt.Sprintf("%d", len(args))})
+			is.popArgs(stackBytes)
+			result.DataType = "double"
+			is.emit(OpMov, result, &Operand{Type: "freg", Value: cc.FloatResults[0]}, nil)
+			if is.isSingle(returnType) {
+				return is.widen(result), nil
+			}
+			return result, nil
+		}
+		is.emitCall(result, funcOp, &Operand{Type: "imm", Value: fmt.Sprintf("%d", len(args))})
+		is.popArgs(stackBytes)
 		
 		// If we used a return slot, the result is there, not in rax
 		if retSlot != nil {
-			result.DataType = returnType
-			result.Offset = retSlot.Offset
-			result.Type = "mem"
-		} else if returnType != "" {
-			// Check if this is a struct return that uses RAX+RDX (9-16 bytes)
-			structSize := is.getTypeSize(returnType)
-			if structSize > 8 && structSize <= 16 {
-				// Struct is returned in RAX (first 8 bytes) + RDX (next 8 bytes)
-				// We need to save both registers to memory
-				is.stackOffset -= 16  // Allocate space for full struct
-				if is.stackOffset%16 != 0 {
-					is.stackOffset -= is.stackOffset % 16
-				}
-				
-				// Save RAX (first 8 bytes)
-				raxOp := &Operand{Type: "reg", Value: "rax"}
-				firstPart := &Operand{Type: "mem", Offset: is.stackOffset}
-				is.emit(OpStore, firstPart, raxOp, nil)
-				
-				// Save RDX (second 8 bytes)
-				rdxOp := &Operand{Type: "reg", Value: "rdx"}
-				secondPart := &Operand{Type: "mem", Offset: is.stackOffset + 8}
-				is.emit(OpStore, secondPart, rdxOp, nil)
-				
-				// Result points to the combined struct on stack
-				result.Type = "mem"
-				result.Offset = is.stackOffset
-				result.DataType = returnType
-			}
+			return retSlot, nil
+		} else if classes, ok := is.structClasses(returnType); ok {
+			// Structs up to 16 bytes come back in rax/rdx and xmm0/xmm1;
+			// spill them so the result is a slot like other struct values
+			slot := is.newSlot(SlotReturnBuffer, node.Name, returnType)
+			is.emitEightbytes(slot, classes, cc.IntResults, cc.FloatResults, OpStore)
+			return slot, nil
 		}
 		
 		return result, nil
 		
 	case NodeTernary:
+		// cond ? a : b - both arms store into one join slot on the stack and
+		// the value is reloaded after the join. Like call return slots the
+		// slot is never register-allocated, so it survives whatever the other
+		// arm evaluates (nested ternaries, calls).
+		if len(node.Children) < 3 {
+			return nil, fmt.Errorf("ternary needs 3 operands")
+		}
 		cond, err := is.selectExpression(node.Children[0])
 		if err != nil {
 			return nil, err
@@ -2022,15 +2931,32 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 		
 		elseLabel := is.newLabel(".L_ternary_else")
 		endLabel := is.newLabel(".L_ternary_end")
-		result := is.newTemp()
 		
 		is.emit(OpJz, &Operand{Type: "label", Value: elseLabel}, cond, nil)
 		
-		thenVal, err := is.selectExpression(node.Children[1])
+		thenVal, err := is.selectArm(node.Children[1])
 		if err != nil {
 			return nil, err
 		}
-		is.emit(OpMov, result, thenVal, nil)
+		
+		if is.isStructType(thenVal.DataType) {
+			// Struct arms are copied whole into the slot, which is the
+			// result, like a compound literal's
+			join := is.newSlot(SlotTemp, "?:", thenVal.DataType)
+			is.copyStructTo(join, thenVal)
+			is.emit(OpJmp, &Operand{Type: "label", Value: endLabel}, nil, nil)
+			is.emit(OpLabel, &Operand{Type: "label", Value: elseLabel}, nil, nil)
+			elseVal, err := is.selectArm(node.Children[2])
+			if err != nil {
+				return nil, err
+			}
+			is.copyStructTo(join, elseVal)
+			is.emit(OpLabel, &Operand{Type: "label", Value: endLabel}, nil, nil)
+			return join, nil
+		}
+		
+		join := &Operand{Type: "mem", Offset: is.frame.Alloc(SlotTemp, "?:", 8, 8), DataType: thenVal.DataType}
+		is.storeJoinValue(join, thenVal)
 		is.emit(OpJmp, &Operand{Type: "label", Value: endLabel}, nil, nil)
 		
 		is.emit(OpLabel, &Operand{Type: "label", Value: elseLabel}, nil, nil)
@@ -2038,97 +2964,58 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 		if err != nil {
 			return nil, err
 		}
-		is.emit(OpMov, result, elseVal, nil)
+		is.storeJoinValue(join, elseVal)
 		
 		is.emit(OpLabel, &Operand{Type: "label", Value: endLabel}, nil, nil)
 		
+		if join.DataType == "" {
+			join.DataType = elseVal.DataType
+		}
+		result := is.newTemp()
+		result.DataType = join.DataType
+		is.emit(OpMov, result, &Operand{Type: "mem", Offset: join.Offset}, nil)
 		return result, nil
 		
 	case NodeCompoundLiteral:
-		// Create temporary struct and initialize fields
-		// Extract struct name from type
-		structType := node.DataType
-		structName := structType
-		// Strip pointers
-		for len(structName) > 0 && structName[len(structName)-1] == '*' {
-			structName = structName[:len(structName)-1]
+		// (T[]){...} is an unnamed array; its value is its address
+		if node.ArraySize > 0 {
+			return is.selectArrayLiteral(node)
 		}
-		structName = strings.TrimSpace(structName)
-		
-		if len(structName) > 7 && structName[:7] == "struct " {
-			structName = structName[7:]
-		} else if len(structName) > 6 && structName[:6] == "union " {
-			structName = structName[6:]
+		// (int){5} is just its initializer
+		if !is.isStructType(node.DataType) {
+			if len(node.Children) == 0 {
+				return &Operand{Type: "imm", Value: "0", DataType: node.DataType}, nil
+			}
+			return is.selectExpression(node.Children[0])
 		}
-		structName = strings.TrimSpace(structName)
 		
-		// Find struct definition
-		structDef, ok := is.structs[structName]
+		// Create temporary struct and initialize fields
+		structType := node.DataType
+		structDef, ok := is.structDefOf(structType)
 		if !ok {
-			return nil, fmt.Errorf("undefined struct: %s", structName)
+			return nil, fmt.Errorf("undefined struct: %s", structType)
 		}
 		
 		// Allocate temporary struct on stack
-		tempName := is.newLabel(".compound_lit")
-		is.stackOffset -= structDef.Size
+		// Named after its function so it can be traced back to the source
+		is.labelCounter++
+		tempName := fmt.Sprintf("%s.compound_lit.%d", is.currentFunc, is.labelCounter)
+		slot := is.newSlot(SlotTemp, tempName, structType)
 		is.localVars[tempName] = &Symbol{
 			Name:   tempName,
-			Offset: is.stackOffset,
+			Offset: slot.Offset,
 			Size:   structDef.Size,
 			Type:   structType,
 		}
 		
-		baseOffset := is.stackOffset
-		
-		// Initialize fields
-		for i, fieldName := range node.InitFields {
-			if i >= len(node.Children) {
-				break
-			}
-			
-			value, err := is.selectExpression(node.Children[i])
-			if err != nil {
-				return nil, err
-			}
-			
-			// Find field offset and size
-			var fieldOffset int
-			var fieldSize int
-			if fieldName == "" {
-				// Positional - use index
-				if i < len(structDef.Members) {
-					fieldOffset = structDef.Members[i].Offset
-					fieldSize = structDef.Members[i].Size
-				} else {
-					return nil, fmt.Errorf("too many initializers for struct %s", structName)
-				}
-			} else {
-				// Named field
-				found := false
-				for _, member := range structDef.Members {
-					if member.Name == fieldName {
-						fieldOffset = member.Offset
-						fieldSize = member.Size
-						found = true
-						break
-					}
-				}
-				if !found {
-					return nil, fmt.Errorf("struct %s has no member %s", structName, fieldName)
-				}
-			}
-			
-			// Store value to field with correct size
-			finalOffset := baseOffset + fieldOffset
-			fieldOp := &Operand{Type: "var", Value: tempName, Offset: finalOffset, Size: fieldSize}
-			is.emit(OpStore, fieldOp, value, nil)
+		// Members without an initializer are zero
+		is.zeroSlot(slot.Offset, structDef.Size)
+		if err := is.initialize(slot.Offset, structType, structDef.Size, 0, node); err != nil {
+			return nil, err
 		}
 		
-		// Return address of temporary
-		result := is.newTemp()
-		addrOp := &Operand{Type: "addr", Value: tempName, Offset: baseOffset}
-		is.emit(OpLoad, result, addrOp, nil)
-		return result, nil
+		// The slot itself is the value
+		return slot, nil
 		
 	case NodeBlock:
 		// Statement expression: ({ stmts; expr; })
@@ -2168,9 +3055,14 @@ func (is *InstructionSelector) selectExpression(node *ASTNode) (*Operand, error)
 		if err != nil {
 			return nil, err
 		}
-		// Preserve the cast type information
-		result.DataType = node.DataType
-		return result, nil
+		if node.Operator == "implicit" {
+			return is.convert(result, node.Value, node.DataType), nil
+		}
+		is.checkAliasingCast(result.DataType, node.DataType)
+		// The checker converted the operand if its form changes (see
+		// conversions.go), so only its type changes here. Relabel a copy:
+		// result may be the destination of the instruction that made it.
+		return is.typed(result, node.DataType), nil
 		
 	default:
 		return nil, fmt.Errorf("unknown expression type: %d", node.Type)
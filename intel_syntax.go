@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Intel syntax
+// -masm=intel prints the emitter's MachineInstr stream the way Intel's
+// manuals and most debuggers write it: destination first, no % or $
+// sigils, [base+index*scale+disp] memory operands with an explicit
+// BYTE/WORD/DWORD/QWORD PTR size, and mnemonics without AT&T's size
+// suffixes. The output starts with ".intel_syntax noprefix", so GAS (and
+// gcc) assemble it as-is. Only the printed text changes: the native
+// assembler works from the same instruction stream either way.
+
+// intelMnemonics are the AT&T mnemonics whose Intel names aren't just the
+// suffix dropped
+var intelMnemonics = map[string]string{
+	"cqto": "cqo", "cltq": "cdqe", "cltd": "cdq", "cwtl": "cwde",
+	"movslq": "movsxd",
+	"movsbq": "movsx", "movsbl": "movsx", "movsbw": "movsx", "movswq": "movsx", "movswl": "movsx",
+	"movzbq": "movzx", "movzbl": "movzx", "movzbw": "movzx", "movzwq": "movzx", "movzwl": "movzx",
+	"cvtsi2sdq": "cvtsi2sd", "cvtsi2sdl": "cvtsi2sd", "cvtsi2ssq": "cvtsi2ss", "cvtsi2ssl": "cvtsi2ss",
+	"cvttsd2siq": "cvttsd2si", "cvttsd2sil": "cvttsd2si", "cvttss2siq": "cvttss2si", "cvttss2sil": "cvttss2si",
+}
+
+// intelPtrSizes name memory operand sizes
+var intelPtrSizes = map[int]string{1: "BYTE PTR ", 2: "WORD PTR ", 4: "DWORD PTR ", 8: "QWORD PTR "}
+
+// intelMnemonic is mi's Intel mnemonic and the size of its memory operand
+// (0 when the other operand or the instruction itself implies it)
+func (mi *MachineInstr) intelMnemonic() (string, int) {
+	usesXMM := false
+	for _, o := range mi.Operands {
+		if o.Kind == MOpReg && strings.HasPrefix(o.Reg, "xmm") {
+			usesXMM = true
+		}
+	}
+	if name, ok := intelMnemonics[mi.Op]; ok {
+		// The memory operand is the source: movzbl's b, cvtsi2sdq's q
+		size := 0
+		switch {
+		case strings.HasPrefix(mi.Op, "movs") || strings.HasPrefix(mi.Op, "movz"):
+			size = suffixSize(mi.Op[len(mi.Op)-2])
+		case strings.HasPrefix(mi.Op, "cvtsi2"):
+			size = suffixSize(mi.Op[len(mi.Op)-1])
+		}
+		return name, size
+	}
+	if mi.Size == 0 || usesXMM || len(mi.Operands) == 0 {
+		// movq between a general and an XMM register keeps its name, and
+		// so do string instructions (rep movsb), which have no operands
+		return mi.Op, 0
+	}
+	name := mi.Op[:len(mi.Op)-1]
+	if name == "lea" {
+		return name, 0
+	}
+	return name, mi.Size
+}
+
+func suffixSize(c byte) int {
+	switch c {
+	case 'b':
+		return 1
+	case 'w':
+		return 2
+	case 'l':
+		return 4
+	case 'q':
+		return 8
+	}
+	return 0
+}
+
+// IntelString renders the operand in Intel syntax; size, if not 0, is
+// spelled out for a memory operand
+func (o MachineOperand) IntelString(size int) string {
+	switch o.Kind {
+	case MOpReg:
+		return o.Reg
+	case MOpImm:
+		if o.Symbol != "" {
+			return "OFFSET " + o.Symbol
+		}
+		return fmt.Sprintf("%d", o.Disp)
+	case MOpMem:
+		var sb strings.Builder
+		sb.WriteString(intelPtrSizes[size])
+		sb.WriteString("[")
+		terms := 0
+		term := func(s string) {
+			if terms > 0 && !strings.HasPrefix(s, "-") {
+				sb.WriteString("+")
+			}
+			sb.WriteString(s)
+			terms++
+		}
+		if o.Reg != "" {
+			term(o.Reg)
+		}
+		if o.Index != "" {
+			if o.Scale > 1 {
+				term(fmt.Sprintf("%s*%d", o.Index, o.Scale))
+			} else {
+				term(o.Index)
+			}
+		}
+		if o.Symbol != "" {
+			term(o.Symbol)
+		}
+		if o.Disp != 0 || terms == 0 {
+			term(fmt.Sprintf("%d", o.Disp))
+		}
+		sb.WriteString("]")
+		return sb.String()
+	default:
+		return o.Symbol
+	}
+}
+
+// IntelString renders the instruction as one line of Intel-syntax GAS
+func (mi *MachineInstr) IntelString() string {
+	if mi.Kind != MInstr {
+		return mi.String()
+	}
+	name, size := mi.intelMnemonic()
+	if mi.Prefix != "" {
+		name = mi.Prefix + " " + name
+	}
+	if len(mi.Operands) == 0 {
+		return "    " + name
+	}
+	ops := make([]string, len(mi.Operands))
+	for i, o := range mi.Operands {
+		opSize := size
+		if o.Indirect && o.Kind == MOpMem {
+			opSize = 8 // call/jmp through a pointer in memory
+		}
+		// Intel puts the destination first
+		ops[len(ops)-1-i] = o.IntelString(opSize)
+	}
+	return "    " + name + " " + strings.Join(ops, ", ")
+}
+
+// PrintMachineInstrsIntel renders a whole stream as Intel-syntax GAS text
+func PrintMachineInstrsIntel(instrs []*MachineInstr) string {
+	var sb strings.Builder
+	sb.WriteString("    .intel_syntax noprefix\n")
+	for _, mi := range instrs {
+		sb.WriteString(mi.IntelString())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,39 @@
+package main
+
+// IR segments
+// Instruction selection produces one instruction stream for the whole
+// program, which the whole-program passes (inlining, cold block layout,
+// the emitters) walk in one go. The register allocators work on one
+// function's segment of it at a time instead: no temp lives across
+// functions, so nothing is lost, and the interference graph (which
+// compares every pair of temps) is as big as the largest function rather
+// than the program.
+
+// irSegment is one function's stretch of the instruction stream, from its
+// entry label to the next function's
+type irSegment struct {
+	Function string // "" for anything before the first function
+	Instrs   []*IRInstruction
+}
+
+// segmentIR splits an instruction stream at its function labels. The
+// segments share the stream's instructions.
+func segmentIR(instrs []*IRInstruction) []irSegment {
+	var segments []irSegment
+	start := 0
+	function := ""
+	for i, instr := range instrs {
+		if instr.Op != OpLabel || !isFunctionLabel(instr.Dst.Value) {
+			continue
+		}
+		if i > start {
+			segments = append(segments, irSegment{function, instrs[start:i]})
+		}
+		start = i
+		function = instr.Dst.Value
+	}
+	if len(instrs) > start {
+		segments = append(segments, irSegment{function, instrs[start:]})
+	}
+	return segments
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// JIT execution (-jit)
+// The encoded .text and data sections are copied into one anonymous mapping:
+//
+//	[.text][extern stubs] | page boundary | [.rodata][.data][.bss]
+//
+// Calls to functions we don't define (printf, malloc ...) are routed through
+// a 14-byte stub `jmp *0(%rip); .quad addr`, so the rel32 call displacement
+// always reaches no matter where the dynamic loader put libc.
+
+const jitStubSize = 14
+
+type jitImage struct {
+	code     []byte            // text, stubs, rodata, data and zeroed bss
+	execSize uint64            // leading bytes that must be executable (page rounded)
+	symbols  map[string]uint64 // symbol -> offset in code
+	externs  []string          // symbols resolved at load time, one stub each
+	stubBase uint64            // offset of the first stub
+	absolute []jitAbsolute     // addresses in data, known once the image is mapped
+}
+
+// jitAbsolute is an 8-byte address at offset place in the image: the load
+// address plus offset
+type jitAbsolute struct {
+	place, offset uint64
+}
+
+// buildJITImage lays out the sections and applies every relocation that
+// doesn't depend on the load address: the PC32 ones. The addresses in
+// data are listed for jitExecute to fill in.
+func buildJITImage(text []byte, textSyms map[string]uint64, relocs []Relocation, rodata, data, bss *Section) (*jitImage, error) {
+	img := &jitImage{symbols: make(map[string]uint64)}
+	for name, offset := range textSyms {
+		img.symbols[name] = offset
+	}
+
+	// Data sections start on their own page so .text can be made read+exec
+	img.stubBase = alignUp(uint64(len(text)), 16)
+
+	// Every symbol not defined here gets a stub; only calls/jumps can use one
+	externIndex := make(map[string]int)
+	isDefined := func(name string) bool {
+		if _, ok := img.symbols[name]; ok {
+			return true
+		}
+		for _, sec := range []*Section{rodata, data, bss} {
+			if _, ok := sec.Symbols[name]; ok {
+				return true
+			}
+		}
+		return false
+	}
+	for _, rel := range relocs {
+		if isDefined(rel.Symbol) {
+			continue
+		}
+		if rel.Section != "" || rel.Offset == 0 || (text[rel.Offset-1] != 0xE8 && text[rel.Offset-1] != 0xE9) {
+			return nil, fmt.Errorf("cannot reference external data symbol '%s' in JIT mode", rel.Symbol)
+		}
+		if _, ok := externIndex[rel.Symbol]; !ok {
+			externIndex[rel.Symbol] = len(img.externs)
+			img.externs = append(img.externs, rel.Symbol)
+		}
+	}
+	// Keep stub order stable between runs
+	sort.Strings(img.externs)
+	for i, name := range img.externs {
+		externIndex[name] = i
+		img.symbols[name] = img.stubBase + uint64(i*jitStubSize)
+	}
+
+	execEnd := img.stubBase + uint64(len(img.externs)*jitStubSize)
+	img.execSize = alignUp(execEnd, elfPageSize)
+
+	rodataBase := img.execSize
+	dataBase := alignUp(rodataBase+rodata.Size, max(data.Align, 16))
+	bssBase := alignUp(dataBase+data.Size, max(bss.Align, 16))
+	total := alignUp(bssBase+bss.Size, elfPageSize)
+
+	for _, sec := range []struct {
+		s    *Section
+		base uint64
+	}{{rodata, rodataBase}, {data, dataBase}, {bss, bssBase}} {
+		for name, offset := range sec.s.Symbols {
+			img.symbols[name] = sec.base + offset
+		}
+	}
+
+	img.code = make([]byte, total)
+	copy(img.code, text)
+	copy(img.code[rodataBase:], rodata.Data)
+	copy(img.code[dataBase:], data.Data)
+
+	// Stubs: FF 25 00000000 = jmp *0(%rip), followed by the target address
+	for i := range img.externs {
+		stub := img.code[img.stubBase+uint64(i*jitStubSize):]
+		copy(stub, []byte{0xFF, 0x25, 0, 0, 0, 0})
+	}
+
+	// PC32: S + A - P
+	sectionBase := map[string]uint64{"rodata": rodataBase, "data": dataBase}
+	for _, rel := range relocs {
+		if rel.Type == R_X86_64_64 && rel.Section != "" {
+			img.absolute = append(img.absolute, jitAbsolute{
+				place:  sectionBase[rel.Section] + rel.Offset,
+				offset: uint64(int64(img.symbols[rel.Symbol]) + rel.Addend),
+			})
+			continue
+		}
+		if rel.Type != R_X86_64_PC32 {
+			return nil, fmt.Errorf("unsupported relocation type in JIT mode: %d", rel.Type)
+		}
+		target := img.symbols[rel.Symbol]
+		disp := int64(target) + rel.Addend - int64(rel.Offset)
+		encoderX86_64.Put(img.code[rel.Offset:], uint64(disp), 4)
+	}
+
+	return img, nil
+}
+
+// bindExterns fills each stub with the resolved absolute address
+func (img *jitImage) bindExterns(resolve func(name string) (uint64, error)) error {
+	for i, name := range img.externs {
+		addr, err := resolve(name)
+		if err != nil {
+			return err
+		}
+		slot := img.stubBase + uint64(i*jitStubSize) + 6
+		encoderX86_64.Put(img.code[slot:], addr, 8)
+	}
+	return nil
+}
+
+// RunJIT encodes the compiled program and runs main in this process
+// Returns main's return value
+func (cp *CompilerPipeline) RunJIT() (int, error) {
+	if cp.options.Verbose {
+		fmt.Println("\n[5/5] JIT Assembly...")
+	}
+
+	assembler := NewAssembler()
+	text, err := assembler.AssembleInstrs(cp.emitter.MachineInstrs())
+	if err != nil {
+		return 0, fmt.Errorf("JIT assembly failed: %w", err)
+	}
+
+	rodata, data, bss := assembler.Sections()
+	img, err := buildJITImage(text, assembler.GetSymbols(), assembler.GetRelocations(), rodata, data, bss)
+	if err != nil {
+		return 0, err
+	}
+
+	mainOffset, ok := img.symbols["main"]
+	if !ok {
+		return 0, fmt.Errorf("no main function to run")
+	}
+
+	if cp.options.Verbose {
+		fmt.Printf("  Image: %d bytes (%d executable), %d external symbols\n",
+			len(img.code), img.execSize, len(img.externs))
+	}
+
+	var constructors, destructors []uint64
+	for _, name := range cp.inits.constructorOrder() {
+		constructors = append(constructors, img.symbols[name])
+	}
+	for _, name := range cp.inits.destructorOrder() {
+		destructors = append(destructors, img.symbols[name])
+	}
+	return jitExecute(img, mainOffset, constructors, destructors, cp.options.LibraryFlags)
+}
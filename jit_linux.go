@@ -0,0 +1,130 @@
+//go:build linux && amd64 && cgo
+
+package main
+
+/*
+#cgo LDFLAGS: -ldl
+#define _GNU_SOURCE
+#include <dlfcn.h>
+#include <stdio.h>
+#include <stdlib.h>
+
+static void *jit_lookup(void *handle, const char *name) {
+	return dlsym(handle ? handle : RTLD_DEFAULT, name);
+}
+
+static void *jit_open(const char *name) {
+	return dlopen(name, RTLD_NOW | RTLD_GLOBAL);
+}
+
+// Generated code doesn't preserve every callee-saved register yet, so the
+// trampoline saves them all: jit_trampoline(fn, argc, argv)
+int jit_trampoline(void *fn, int argc, char **argv);
+__asm__(
+	".text\n"
+	".globl jit_trampoline\n"
+	"jit_trampoline:\n"
+	"    pushq %rbx\n"
+	"    pushq %rbp\n"
+	"    pushq %r12\n"
+	"    pushq %r13\n"
+	"    pushq %r14\n"
+	"    pushq %r15\n"
+	"    subq $8, %rsp\n"
+	"    movq %rdi, %rax\n"
+	"    movl %esi, %edi\n"
+	"    movq %rdx, %rsi\n"
+	"    call *%rax\n"
+	"    addq $8, %rsp\n"
+	"    popq %r15\n"
+	"    popq %r14\n"
+	"    popq %r13\n"
+	"    popq %r12\n"
+	"    popq %rbp\n"
+	"    popq %rbx\n"
+	"    ret\n"
+);
+
+// jit_call_init runs a constructor or destructor (see constructors.go)
+static void jit_call_init(void *fn) {
+	jit_trampoline(fn, 0, NULL);
+	fflush(NULL);
+}
+
+static int jit_call_main(void *fn) {
+	static char *argv[] = {"a.out", NULL};
+	int ret = jit_trampoline(fn, 1, argv);
+	// The program's stdio buffers belong to this process now
+	fflush(NULL);
+	return ret;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// jitExecute maps the image, binds external calls via dlsym and calls main,
+// with the constructors before it and the destructors after
+func jitExecute(img *jitImage, mainOffset uint64, constructors, destructors []uint64, libFlags []string) (int, error) {
+	// libc is already loaded (we link against it); libm and -l libraries
+	// are opened globally so RTLD_DEFAULT lookups find them
+	libs := []string{"libm.so.6"}
+	for _, flag := range libFlags {
+		if !strings.HasPrefix(flag, "-l") {
+			continue
+		}
+		name := strings.TrimPrefix(flag, "-l")
+		if name != "c" && name != "m" {
+			libs = append(libs, "lib"+name+".so")
+		}
+	}
+	for _, lib := range libs {
+		cname := C.CString(lib)
+		C.jit_open(cname)
+		C.free(unsafe.Pointer(cname))
+	}
+
+	err := img.bindExterns(func(name string) (uint64, error) {
+		cname := C.CString(name)
+		defer C.free(unsafe.Pointer(cname))
+		addr := C.jit_lookup(nil, cname)
+		if addr == nil {
+			return 0, fmt.Errorf("undefined symbol in JIT mode: %s", name)
+		}
+		return uint64(uintptr(addr)), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	mem, err := syscall.Mmap(-1, 0, len(img.code),
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return 0, fmt.Errorf("mmap failed: %w", err)
+	}
+	defer syscall.Munmap(mem)
+
+	copy(mem, img.code)
+	base := uint64(uintptr(unsafe.Pointer(&mem[0])))
+	for _, abs := range img.absolute {
+		encoderX86_64.Put(mem[abs.place:], base+abs.offset, 8)
+	}
+	if err := syscall.Mprotect(mem[:img.execSize], syscall.PROT_READ|syscall.PROT_EXEC); err != nil {
+		return 0, fmt.Errorf("mprotect failed: %w", err)
+	}
+
+	for _, offset := range constructors {
+		C.jit_call_init(unsafe.Pointer(&mem[offset]))
+	}
+	entry := unsafe.Pointer(&mem[mainOffset])
+	status := int(C.jit_call_main(entry))
+	for _, offset := range destructors {
+		C.jit_call_init(unsafe.Pointer(&mem[offset]))
+	}
+	return status, nil
+}
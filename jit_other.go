@@ -0,0 +1,10 @@
+//go:build !(linux && amd64 && cgo)
+
+package main
+
+import "fmt"
+
+// jitExecute needs mmap and dlsym; without cgo there is no way to find libc
+func jitExecute(img *jitImage, mainOffset uint64, constructors, destructors []uint64, libFlags []string) (int, error) {
+	return 0, fmt.Errorf("-jit requires linux/amd64 with cgo enabled")
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 type TokenType int
@@ -29,7 +31,10 @@ const (
 	TYPEDEF
 	ENUM
 	CONST
+	VOLATILE
 	STATIC
+	EXTERN
+	THREAD // __thread, _Thread_local (see tls.go)
 	IF
 	ELSE
 	WHILE
@@ -41,6 +46,7 @@ const (
 	CASE
 	DEFAULT
 	SIZEOF
+	ALIGNOF
 	
 	// Operators
 	PLUS
@@ -95,6 +101,9 @@ const (
 	INCLUDE
 	DEFINE
 	HASH
+	
+	// Characters the lexer can't turn into a token (reported by the parser)
+	ILLEGAL
 )
 
 type Token struct {
@@ -112,7 +121,11 @@ type Lexer struct {
 	start   int
 }
 
+// utf8BOM is the byte order mark some editors put at the start of files
+const utf8BOM = "\xEF\xBB\xBF"
+
 func NewLexer(source string) *Lexer {
+	source = strings.TrimPrefix(source, utf8BOM)
 	return &Lexer{
 		source: source,
 		pos:    0,
@@ -136,7 +149,11 @@ var keywords = map[string]TokenType{
 	"typedef":  TYPEDEF,
 	"enum":     ENUM,
 	"const":    CONST,
+	"volatile": VOLATILE,
 	"static":   STATIC,
+	"extern":   EXTERN,
+	"__thread": THREAD,
+	"_Thread_local": THREAD,
 	"if":       IF,
 	"else":     ELSE,
 	"while":    WHILE,
@@ -148,6 +165,7 @@ var keywords = map[string]TokenType{
 	"case":     CASE,
 	"default":  DEFAULT,
 	"sizeof":   SIZEOF,
+	"_Alignof": ALIGNOF,
 }
 
 func (l *Lexer) current() byte {
@@ -174,6 +192,8 @@ func (l *Lexer) advance() byte {
 	if ch == '\n' {
 		l.line++
 		l.column = 1
+	} else if !utf8.RuneStart(ch) {
+		// UTF-8 continuation byte: columns count characters, not bytes
 	} else {
 		l.column++
 	}
@@ -234,30 +254,51 @@ func (l *Lexer) NextToken() Token {
 		return Token{Type: HASH, Lexeme: directiveLine, Line: startLine, Column: startColumn}
 	}
 	
-	// Identifiers and keywords
-	if unicode.IsLetter(rune(ch)) || ch == '_' {
+	// Identifiers and keywords (ASCII only; UTF-8 is allowed in strings and comments)
+	if isIdentStart(ch) || ch >= utf8.RuneSelf {
 		start := l.pos
-		for unicode.IsLetter(rune(l.current())) || unicode.IsDigit(rune(l.current())) || l.current() == '_' {
+		for isIdentChar(l.current()) || l.current() >= utf8.RuneSelf {
 			l.advance()
 		}
 		lexeme := l.source[start:l.pos]
 		
+		// A non-ASCII character anywhere in the word makes the whole word illegal,
+		// rather than splitting it into garbled tokens
+		if !isASCII(lexeme) {
+			return Token{Type: ILLEGAL, Lexeme: lexeme, Line: startLine, Column: startColumn}
+		}
+		
 		if tokenType, ok := keywords[lexeme]; ok {
 			return Token{Type: tokenType, Lexeme: lexeme, Line: startLine, Column: startColumn}
 		}
 		return Token{Type: IDENTIFIER, Lexeme: lexeme, Line: startLine, Column: startColumn}
 	}
 	
-	// Numbers
-	if unicode.IsDigit(rune(ch)) {
+	// Numbers: integers, and floating constants with a fraction, an
+	// exponent (e, or p for a hex one) or both, so "1e-3", ".5f" and
+	// "0x1p-4" are one token each
+	if unicode.IsDigit(rune(ch)) || (ch == '.' && unicode.IsDigit(rune(l.peek(1)))) {
 		start := l.pos
-		for unicode.IsDigit(rune(l.current())) || l.current() == '.' || l.current() == 'x' || 
-			l.current() == 'X' || (l.current() >= 'a' && l.current() <= 'f') || 
-			(l.current() >= 'A' && l.current() <= 'F') {
+		hex := ch == '0' && (l.peek(1) == 'x' || l.peek(1) == 'X')
+		if hex {
+			l.advance()
 			l.advance()
 		}
-		// Handle suffixes like L, U, UL, etc.
-		for l.current() == 'L' || l.current() == 'U' || l.current() == 'l' || l.current() == 'u' {
+		for {
+			c := l.current()
+			if unicode.IsDigit(rune(c)) || c == '.' || (hex && isHexDigit(c)) {
+				l.advance()
+			} else if (!hex && (c == 'e' || c == 'E')) || (hex && (c == 'p' || c == 'P')) {
+				l.advance()
+				if l.current() == '+' || l.current() == '-' {
+					l.advance()
+				}
+			} else {
+				break
+			}
+		}
+		// Handle suffixes like L, U, UL, F, etc.
+		for strings.IndexByte("uUlLfF", l.current()) >= 0 {
 			l.advance()
 		}
 		return Token{Type: NUMBER, Lexeme: l.source[start:l.pos], Line: startLine, Column: startColumn}
@@ -273,19 +314,24 @@ func (l *Lexer) NextToken() Token {
 			}
 			l.advance()
 		}
-		lexeme := l.source[start:l.pos]
+		// A string token's lexeme is the bytes the literal stands for, with
+		// its escapes decoded
+		lexeme := string(decodeCString(l.source[start:l.pos]))
 		l.advance() // closing "
 		return Token{Type: STRING, Lexeme: lexeme, Line: startLine, Column: startColumn}
 	}
 	
-	// Character literals
+	// Character literals, up to the closing ' as strings are: an escape
+	// can be several characters ('\x1b', '\033')
 	if ch == '\'' {
 		l.advance()
 		start := l.pos
-		if l.current() == '\\' {
+		for l.current() != '\'' && l.current() != '\n' && l.current() != 0 {
+			if l.current() == '\\' {
+				l.advance()
+			}
 			l.advance()
 		}
-		l.advance()
 		lexeme := l.source[start:l.pos]
 		l.advance() // closing '
 		return Token{Type: CHAR, Lexeme: lexeme, Line: startLine, Column: startColumn}
@@ -428,7 +474,107 @@ func (l *Lexer) NextToken() Token {
 		return Token{Type: COLON, Lexeme: ":", Line: startLine, Column: startColumn}
 	}
 	
-	return Token{Type: EOF, Lexeme: string(ch), Line: startLine, Column: startColumn}
+	return Token{Type: ILLEGAL, Lexeme: string(ch), Line: startLine, Column: startColumn}
+}
+
+func isIdentStart(ch byte) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch == '_'
+}
+
+func isIdentChar(ch byte) bool {
+	return isIdentStart(ch) || (ch >= '0' && ch <= '9')
+}
+
+// decodeCString turns a literal's escapes (\n, \t, \x41, \101 ...) into
+// the bytes they stand for. A universal character name (\u00e9,
+// \U0001F600) is its character in UTF-8, as gcc's execution charset has it.
+func decodeCString(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			out = append(out, s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case 'n':
+			out = append(out, '\n')
+		case 't':
+			out = append(out, '\t')
+		case 'r':
+			out = append(out, '\r')
+		case 'a':
+			out = append(out, 7)
+		case 'b':
+			out = append(out, 8)
+		case 'f':
+			out = append(out, 12)
+		case 'v':
+			out = append(out, 11)
+		case 'e', 'E':
+			// GNU's escape character
+			out = append(out, 27)
+		case 'u', 'U':
+			digits := 4
+			if c == 'U' {
+				digits = 8
+			}
+			val := 0
+			for n := 0; n < digits && i+1 < len(s) && isHexDigit(s[i+1]); n++ {
+				i++
+				val = val*16 + hexValue(s[i])
+			}
+			out = utf8.AppendRune(out, rune(val))
+		case 'x':
+			val := 0
+			for i+1 < len(s) && isHexDigit(s[i+1]) {
+				i++
+				val = val*16 + hexValue(s[i])
+			}
+			out = append(out, byte(val))
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			val := int(c - '0')
+			for n := 0; n < 2 && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '7'; n++ {
+				i++
+				val = val*8 + int(s[i]-'0')
+			}
+			out = append(out, byte(val))
+		default:
+			// \\ \" \' \? map to themselves
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// illegalTokenError describes an ILLEGAL token: the first non-ASCII character
+// and, when it's part of a word, the identifier it appeared in
+func illegalTokenError(tok Token) error {
+	pos := fmt.Sprintf("line %d, column %d", tok.Line, tok.Column)
+	for i, r := range tok.Lexeme {
+		if r < utf8.RuneSelf {
+			continue
+		}
+		col := tok.Column + utf8.RuneCountInString(tok.Lexeme[:i])
+		pos = fmt.Sprintf("line %d, column %d", tok.Line, col)
+		if _, size := utf8.DecodeRuneInString(tok.Lexeme[i:]); r == utf8.RuneError && size == 1 {
+			return fmt.Errorf("%s: invalid UTF-8 byte 0x%02X in source", pos, tok.Lexeme[i])
+		}
+		if strings.IndexFunc(tok.Lexeme, func(c rune) bool { return c < utf8.RuneSelf }) >= 0 {
+			return fmt.Errorf("%s: non-ASCII character '%c' (U+%04X) in identifier '%s'", pos, r, r, tok.Lexeme)
+		}
+		return fmt.Errorf("%s: non-ASCII character '%c' (U+%04X) outside of a string or comment", pos, r, r)
+	}
+	return fmt.Errorf("%s: unexpected character '%s'", pos, tok.Lexeme)
 }
 
 func (l *Lexer) AllTokens() []Token {
@@ -453,17 +599,17 @@ func (t TokenType) String() string {
 	names := map[TokenType]string{
 		EOF: "EOF", IDENTIFIER: "IDENTIFIER", NUMBER: "NUMBER", STRING: "STRING", CHAR: "CHAR",
 		INT: "INT", VOID: "VOID", CHAR_KW: "CHAR_KW", FLOAT: "FLOAT", DOUBLE: "DOUBLE",
-		STRUCT: "STRUCT", TYPEDEF: "TYPEDEF", ENUM: "ENUM", CONST: "CONST", STATIC: "STATIC",
+		STRUCT: "STRUCT", TYPEDEF: "TYPEDEF", ENUM: "ENUM", CONST: "CONST", VOLATILE: "VOLATILE", STATIC: "STATIC", EXTERN: "EXTERN", THREAD: "THREAD",
 		IF: "IF", ELSE: "ELSE", WHILE: "WHILE", FOR: "FOR", RETURN: "RETURN",
 		BREAK: "BREAK", CONTINUE: "CONTINUE", SWITCH: "SWITCH", CASE: "CASE", DEFAULT: "DEFAULT",
-		SIZEOF: "SIZEOF", PLUS: "PLUS", MINUS: "MINUS", STAR: "STAR", SLASH: "SLASH",
+		SIZEOF: "SIZEOF", ALIGNOF: "ALIGNOF", PLUS: "PLUS", MINUS: "MINUS", STAR: "STAR", SLASH: "SLASH",
 		PERCENT: "PERCENT", ASSIGN: "ASSIGN", EQ: "EQ", NE: "NE", LT: "LT", LE: "LE",
 		GT: "GT", GE: "GE", LAND: "LAND", LOR: "LOR", LNOT: "LNOT", BAND: "BAND",
 		BOR: "BOR", BXOR: "BXOR", BNOT: "BNOT", LSHIFT: "LSHIFT", RSHIFT: "RSHIFT",
 		INC: "INC", DEC: "DEC", ARROW: "ARROW", DOT: "DOT", QUESTION: "QUESTION",
 		LPAREN: "LPAREN", RPAREN: "RPAREN", LBRACE: "LBRACE", RBRACE: "RBRACE",
 		LBRACKET: "LBRACKET", RBRACKET: "RBRACKET", SEMICOLON: "SEMICOLON", COMMA: "COMMA",
-		COLON: "COLON", INCLUDE: "INCLUDE", DEFINE: "DEFINE", HASH: "HASH",
+		COLON: "COLON", INCLUDE: "INCLUDE", DEFINE: "DEFINE", HASH: "HASH", ILLEGAL: "ILLEGAL",
 	}
 	if name, ok := names[t]; ok {
 		return name
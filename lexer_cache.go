@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/sha256"
+	"sync"
+)
+
+// TokenCache memoizes lexer output keyed by a hash of the source text
+// Watch mode and editor tooling re-lex the same (mostly unchanged) files
+// repeatedly; a hit skips lexing entirely. Token slices are shared between
+// callers and must be treated as read-only. Sources over maxCachedSource
+// are streamed and never cached (see token_stream.go).
+type TokenCache struct {
+	mu      sync.Mutex
+	entries map[[32]byte]*tokenCacheEntry
+	order   [][32]byte // insertion order, oldest first
+	limit   int
+	hits    int
+	misses  int
+}
+
+type tokenCacheEntry struct {
+	tokens []Token
+}
+
+// defaultTokenCache is shared by every parser in the process
+var defaultTokenCache = NewTokenCache(64)
+
+func NewTokenCache(limit int) *TokenCache {
+	if limit <= 0 {
+		limit = 1
+	}
+	return &TokenCache{
+		entries: make(map[[32]byte]*tokenCacheEntry),
+		limit:   limit,
+	}
+}
+
+// Stream returns a stream of source's tokens: the cached ones on a hit,
+// otherwise lexed as the parser asks for them, and cached once the stream
+// reaches the end if source is small enough to keep whole
+func (c *TokenCache) Stream(source string) *tokenStream {
+	key := sha256.Sum256([]byte(source))
+
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok {
+		c.hits++
+		c.mu.Unlock()
+		return cachedTokenStream(entry.tokens)
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	// Lex outside the lock so independent files don't serialize
+	stream := newTokenStream(source)
+	if len(source) <= maxCachedSource {
+		stream.keep = true
+		stream.done = func(tokens []Token) { c.store(key, tokens) }
+	}
+	return stream
+}
+
+// store caches the tokens of the source whose hash is key
+func (c *TokenCache) store(key [32]byte, tokens []Token) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = &tokenCacheEntry{tokens: tokens}
+		c.order = append(c.order, key)
+
+		// Evict the oldest entries once over the limit
+		for len(c.order) > c.limit {
+			delete(c.entries, c.order[0])
+			c.order = c.order[1:]
+		}
+	}
+}
+
+// Stats reports cache hits and misses since creation
+func (c *TokenCache) Stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// Clear drops all cached token streams
+func (c *TokenCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[[32]byte]*tokenCacheEntry)
+	c.order = nil
+}
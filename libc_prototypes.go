@@ -0,0 +1,156 @@
+package main
+
+// Builtin libc prototypes
+// System headers are skipped by the preprocessor, so without these a call to
+// printf or sqrt would have no prototype and every argument would be passed as
+// an int. The table covers the common stdio, stdlib, string, ctype, pthread,
+// setjmp, execinfo and math functions. A prototype is used only when the program doesn't
+// declare the function itself. Calls to functions with no prototype at all
+// are reported by -Wimplicit-function-declaration.
+
+// libcPrototypes maps each function to its signature, written as in the
+// headers
+var libcPrototypes = map[string]*FunctionSignature{
+	// stdio.h
+	"printf":   {ReturnType: "int", ParamTypes: []string{"const char*"}, Variadic: true},
+	"fprintf":  {ReturnType: "int", ParamTypes: []string{"void*", "const char*"}, Variadic: true},
+	"sprintf":  {ReturnType: "int", ParamTypes: []string{"char*", "const char*"}, Variadic: true},
+	"snprintf": {ReturnType: "int", ParamTypes: []string{"char*", "unsigned long", "const char*"}, Variadic: true},
+	"scanf":    {ReturnType: "int", ParamTypes: []string{"const char*"}, Variadic: true},
+	"sscanf":   {ReturnType: "int", ParamTypes: []string{"const char*", "const char*"}, Variadic: true},
+	"fscanf":   {ReturnType: "int", ParamTypes: []string{"void*", "const char*"}, Variadic: true},
+	"puts":     {ReturnType: "int", ParamTypes: []string{"const char*"}},
+	"putchar":  {ReturnType: "int", ParamTypes: []string{"int"}},
+	"getchar":  {ReturnType: "int"},
+	"fputs":    {ReturnType: "int", ParamTypes: []string{"const char*", "void*"}},
+	"fputc":    {ReturnType: "int", ParamTypes: []string{"int", "void*"}},
+	"fgets":    {ReturnType: "char*", ParamTypes: []string{"char*", "int", "void*"}},
+	"fgetc":    {ReturnType: "int", ParamTypes: []string{"void*"}},
+	"fopen":    {ReturnType: "void*", ParamTypes: []string{"const char*", "const char*"}},
+	"fclose":   {ReturnType: "int", ParamTypes: []string{"void*"}},
+	"fflush":   {ReturnType: "int", ParamTypes: []string{"void*"}},
+	"fread":    {ReturnType: "unsigned long", ParamTypes: []string{"void*", "unsigned long", "unsigned long", "void*"}},
+	"fwrite":   {ReturnType: "unsigned long", ParamTypes: []string{"const void*", "unsigned long", "unsigned long", "void*"}},
+	"perror":   {ReturnType: "void", ParamTypes: []string{"const char*"}},
+
+	// stdlib.h
+	"malloc":  {ReturnType: "void*", ParamTypes: []string{"unsigned long"}},
+	"calloc":  {ReturnType: "void*", ParamTypes: []string{"unsigned long", "unsigned long"}},
+	"realloc": {ReturnType: "void*", ParamTypes: []string{"void*", "unsigned long"}},
+	"free":    {ReturnType: "void", ParamTypes: []string{"void*"}},
+	"exit":    {ReturnType: "void", ParamTypes: []string{"int"}},
+	"abort":   {ReturnType: "void"},
+	"atoi":    {ReturnType: "int", ParamTypes: []string{"const char*"}},
+	"atol":    {ReturnType: "long", ParamTypes: []string{"const char*"}},
+	"atof":    {ReturnType: "double", ParamTypes: []string{"const char*"}},
+	"strtol":  {ReturnType: "long", ParamTypes: []string{"const char*", "char**", "int"}},
+	"strtod":  {ReturnType: "double", ParamTypes: []string{"const char*", "char**"}},
+	"abs":     {ReturnType: "int", ParamTypes: []string{"int"}},
+	"labs":    {ReturnType: "long", ParamTypes: []string{"long"}},
+	"rand":    {ReturnType: "int"},
+	"srand":   {ReturnType: "void", ParamTypes: []string{"unsigned int"}},
+	"getenv":  {ReturnType: "char*", ParamTypes: []string{"const char*"}},
+	"system":  {ReturnType: "int", ParamTypes: []string{"const char*"}},
+
+	// unistd.h
+	"write": {ReturnType: "long", ParamTypes: []string{"int", "const void*", "unsigned long"}},
+	"_exit": {ReturnType: "void", ParamTypes: []string{"int"}},
+
+	// string.h
+	"memcpy":  {ReturnType: "void*", ParamTypes: []string{"void*", "const void*", "unsigned long"}},
+	"memmove": {ReturnType: "void*", ParamTypes: []string{"void*", "const void*", "unsigned long"}},
+	"memset":  {ReturnType: "void*", ParamTypes: []string{"void*", "int", "unsigned long"}},
+	"memcmp":  {ReturnType: "int", ParamTypes: []string{"const void*", "const void*", "unsigned long"}},
+	"strlen":  {ReturnType: "unsigned long", ParamTypes: []string{"const char*"}},
+	"strcpy":  {ReturnType: "char*", ParamTypes: []string{"char*", "const char*"}},
+	"strncpy": {ReturnType: "char*", ParamTypes: []string{"char*", "const char*", "unsigned long"}},
+	"strcat":  {ReturnType: "char*", ParamTypes: []string{"char*", "const char*"}},
+	"strncat": {ReturnType: "char*", ParamTypes: []string{"char*", "const char*", "unsigned long"}},
+	"strcmp":  {ReturnType: "int", ParamTypes: []string{"const char*", "const char*"}},
+	"strncmp": {ReturnType: "int", ParamTypes: []string{"const char*", "const char*", "unsigned long"}},
+	"strchr":  {ReturnType: "char*", ParamTypes: []string{"const char*", "int"}},
+	"strrchr": {ReturnType: "char*", ParamTypes: []string{"const char*", "int"}},
+	"strstr":  {ReturnType: "char*", ParamTypes: []string{"const char*", "const char*"}},
+	"strdup":  {ReturnType: "char*", ParamTypes: []string{"const char*"}},
+
+	// ctype.h
+	"isalpha": {ReturnType: "int", ParamTypes: []string{"int"}},
+	"isdigit": {ReturnType: "int", ParamTypes: []string{"int"}},
+	"isalnum": {ReturnType: "int", ParamTypes: []string{"int"}},
+	"isspace": {ReturnType: "int", ParamTypes: []string{"int"}},
+	"isupper": {ReturnType: "int", ParamTypes: []string{"int"}},
+	"islower": {ReturnType: "int", ParamTypes: []string{"int"}},
+	"toupper": {ReturnType: "int", ParamTypes: []string{"int"}},
+	"tolower": {ReturnType: "int", ParamTypes: []string{"int"}},
+
+	// pthread.h (the pthread types are passed by pointer)
+	"pthread_create":        {ReturnType: "int", ParamTypes: []string{"void*", "const void*", "void*", "void*"}},
+	"pthread_join":          {ReturnType: "int", ParamTypes: []string{"unsigned long", "void**"}},
+	"pthread_mutex_init":    {ReturnType: "int", ParamTypes: []string{"void*", "const void*"}},
+	"pthread_mutex_lock":    {ReturnType: "int", ParamTypes: []string{"void*"}},
+	"pthread_mutex_unlock":  {ReturnType: "int", ParamTypes: []string{"void*"}},
+	"pthread_mutex_destroy": {ReturnType: "int", ParamTypes: []string{"void*"}},
+
+	// setjmp.h (a jmp_buf is passed as a pointer to its first element; see setjmp.go)
+	"setjmp":      {ReturnType: "int", ParamTypes: []string{"long*"}},
+	"_setjmp":     {ReturnType: "int", ParamTypes: []string{"long*"}},
+	"__sigsetjmp": {ReturnType: "int", ParamTypes: []string{"long*", "int"}},
+	"longjmp":     {ReturnType: "void", ParamTypes: []string{"long*", "int"}},
+	"_longjmp":    {ReturnType: "void", ParamTypes: []string{"long*", "int"}},
+	"siglongjmp":  {ReturnType: "void", ParamTypes: []string{"long*", "int"}},
+
+	// execinfo.h
+	"backtrace":            {ReturnType: "int", ParamTypes: []string{"void**", "int"}},
+	"backtrace_symbols_fd": {ReturnType: "void", ParamTypes: []string{"void**", "int", "int"}},
+
+	// math.h
+	"sqrt":  {ReturnType: "double", ParamTypes: []string{"double"}},
+	"pow":   {ReturnType: "double", ParamTypes: []string{"double", "double"}},
+	"fabs":  {ReturnType: "double", ParamTypes: []string{"double"}},
+	"floor": {ReturnType: "double", ParamTypes: []string{"double"}},
+	"ceil":  {ReturnType: "double", ParamTypes: []string{"double"}},
+	"fmod":  {ReturnType: "double", ParamTypes: []string{"double", "double"}},
+	"sin":   {ReturnType: "double", ParamTypes: []string{"double"}},
+	"cos":   {ReturnType: "double", ParamTypes: []string{"double"}},
+	"tan":   {ReturnType: "double", ParamTypes: []string{"double"}},
+	"atan2": {ReturnType: "double", ParamTypes: []string{"double", "double"}},
+	"exp":   {ReturnType: "double", ParamTypes: []string{"double"}},
+	"log":   {ReturnType: "double", ParamTypes: []string{"double"}},
+
+	// Compiler builtins, selected inline
+	"__builtin_expect":     {ReturnType: "long", ParamTypes: []string{"long", "long"}},
+	"__builtin_assert":     {ReturnType: "void", Variadic: true},                      // see assert.go
+	"__builtin_popcount":   {ReturnType: "int", ParamTypes: []string{"unsigned int"}}, // see bits.go
+	"__builtin_popcountl":  {ReturnType: "int", ParamTypes: []string{"unsigned long"}},
+	"__builtin_popcountll": {ReturnType: "int", ParamTypes: []string{"unsigned long long"}},
+	"__builtin_clz":        {ReturnType: "int", ParamTypes: []string{"unsigned int"}},
+	"__builtin_clzl":       {ReturnType: "int", ParamTypes: []string{"unsigned long"}},
+	"__builtin_clzll":      {ReturnType: "int", ParamTypes: []string{"unsigned long long"}},
+	"__builtin_ctz":        {ReturnType: "int", ParamTypes: []string{"unsigned int"}},
+	"__builtin_ctzl":       {ReturnType: "int", ParamTypes: []string{"unsigned long"}},
+	"__builtin_ctzll":      {ReturnType: "int", ParamTypes: []string{"unsigned long long"}},
+	"__builtin_bswap16":    {ReturnType: "unsigned short", ParamTypes: []string{"unsigned short"}},
+	"__builtin_bswap32":    {ReturnType: "unsigned int", ParamTypes: []string{"unsigned int"}},
+	"__builtin_bswap64":    {ReturnType: "unsigned long", ParamTypes: []string{"unsigned long"}},
+	"__syscall":            {ReturnType: "long", ParamTypes: []string{"long"}, Variadic: true}, // see freestanding.go
+
+	// libgcc, which the bit builtins call when their instructions are off
+	"__popcountdi2": {ReturnType: "int", ParamTypes: []string{"unsigned long"}},
+	"__clzdi2":      {ReturnType: "int", ParamTypes: []string{"unsigned long"}},
+	"__ctzdi2":      {ReturnType: "int", ParamTypes: []string{"unsigned long"}},
+	"__bswapsi2":    {ReturnType: "unsigned int", ParamTypes: []string{"unsigned int"}},
+	"__bswapdi2":    {ReturnType: "unsigned long", ParamTypes: []string{"unsigned long"}},
+}
+
+// addLibcPrototypes adds the builtin prototypes for functions not already in
+// functions, marked External so calls follow the platform ABI
+func addLibcPrototypes(functions map[string]*FunctionSignature) {
+	for name, sig := range libcPrototypes {
+		if _, exists := functions[name]; exists {
+			continue
+		}
+		proto := *sig
+		proto.External = true
+		functions[name] = &proto
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Library profiles
+// What the compiler needs to know about a third-party library (where its
+// headers are, how to link it, and the types and globals programs may use
+// without including its headers) comes from a LibraryProfile rather than
+// paths and names built into the stages. raylib ships as a built-in profile
+// and is used when no -libprofile is given. -libprofile=<name|file.json>
+// selects profiles instead (repeatable; "none" for none). A name that isn't
+// built in is looked up as <name>.json in $CCOMPILER_PROFILE_DIR, or else
+// in the user config dir's ccompiler/profiles. -print-libprofile=<name>
+// writes a profile out to start a new one from (see profiles/).
+//
+// Directories and link flags may use $VAR or ${VAR}; entries that expand to
+// nothing (a directory whose variable isn't set) are dropped.
+
+// LibraryProfile describes one library
+type LibraryProfile struct {
+	Name        string            `json:"name"`
+	IncludeDirs []string          `json:"include_dirs,omitempty"` // searched after the default include paths
+	LinkFlags   []string          `json:"link_flags,omitempty"`   // -L and -l flags, before those from the command line
+	Defines     map[string]string `json:"defines,omitempty"`      // predefined macros, before -D and -U
+	// C declarations (struct definitions, typedefs, enums) in effect before
+	// the program's own, so its types are known without its headers
+	Declarations []string        `json:"declarations,omitempty"`
+	Globals      []ProfileGlobal `json:"globals,omitempty"`
+}
+
+// ProfileGlobal is a global the library provides: defined in the library
+// (Extern) or, for names its headers define as macros we don't expand,
+// given a definition in every program
+type ProfileGlobal struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Extern bool   `json:"extern,omitempty"`
+}
+
+// builtinProfiles are selectable by name
+var builtinProfiles = map[string]*LibraryProfile{
+	"raylib": {
+		Name:        "raylib",
+		IncludeDirs: []string{"$RAYLIB_SRC"},
+		LinkFlags:   []string{"-L$RAYLIB_SRC", "-lraylib", "-lm", "-lpthread", "-ldl", "-lrt"},
+		Declarations: []string{
+			"typedef struct Color { unsigned char r; unsigned char g; unsigned char b; unsigned char a; } Color;",
+		},
+		Globals: raylibColors(),
+	},
+}
+
+// defaultProfiles are used when no -libprofile is given
+var defaultProfiles = []string{"raylib"}
+
+// raylibColors are raylib's predefined colors. raylib.h defines them as
+// compound-literal macros; without it they're Color globals.
+func raylibColors() []ProfileGlobal {
+	var globals []ProfileGlobal
+	for _, name := range []string{"RED", "WHITE", "BLACK", "GRAY", "LIGHTGRAY", "DARKGRAY",
+		"YELLOW", "GOLD", "ORANGE", "PINK", "MAROON", "GREEN", "LIME", "DARKGREEN",
+		"SKYBLUE", "BLUE", "DARKBLUE", "PURPLE", "VIOLET", "DARKPURPLE",
+		"BEIGE", "BROWN", "DARKBROWN", "RAYWHITE", "MAGENTA"} {
+		globals = append(globals, ProfileGlobal{Name: name, Type: "Color"})
+	}
+	return globals
+}
+
+// profileDirs are searched for <name>.json, in order
+func profileDirs() []string {
+	var dirs []string
+	if dir := os.Getenv("CCOMPILER_PROFILE_DIR"); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	if base, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(base, "ccompiler", "profiles"))
+	}
+	return dirs
+}
+
+// LoadLibraryProfile finds a profile by built-in name, by name in the
+// profile directories, or by path, reading from fsys
+func LoadLibraryProfile(fsys SourceFS, ref string) (*LibraryProfile, error) {
+	if profile, ok := builtinProfiles[ref]; ok {
+		return profile, nil
+	}
+	path := ref
+	if !strings.ContainsRune(ref, os.PathSeparator) && !strings.HasSuffix(ref, ".json") {
+		path = ""
+		for _, dir := range profileDirs() {
+			candidate := filepath.Join(dir, ref+".json")
+			if fsys.Exists(candidate) {
+				path = candidate
+				break
+			}
+		}
+		if path == "" {
+			return nil, fmt.Errorf("unknown library profile %q (built in: %s)", ref, strings.Join(builtinProfileNames(), ", "))
+		}
+	}
+	data, err := fsys.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("library profile: %w", err)
+	}
+	profile := &LibraryProfile{}
+	if err := json.Unmarshal(data, profile); err != nil {
+		return nil, fmt.Errorf("library profile %s: %w", path, err)
+	}
+	if err := profile.Validate(); err != nil {
+		return nil, fmt.Errorf("library profile %s: %w", path, err)
+	}
+	return profile, nil
+}
+
+// loadLibraryProfiles loads the profiles -libprofile selected, or the
+// defaults if it wasn't given
+func loadLibraryProfiles(fsys SourceFS, refs []string) ([]*LibraryProfile, error) {
+	if len(refs) == 0 {
+		refs = defaultProfiles
+	}
+	var profiles []*LibraryProfile
+	for _, ref := range refs {
+		if ref == "none" {
+			continue
+		}
+		profile, err := LoadLibraryProfile(fsys, ref)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+func builtinProfileNames() []string {
+	var names []string
+	for name := range builtinProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks that every entry is usable
+func (l *LibraryProfile) Validate() error {
+	if l.Name == "" {
+		return fmt.Errorf("name is missing")
+	}
+	for _, flag := range l.LinkFlags {
+		if !strings.HasPrefix(flag, "-") {
+			return fmt.Errorf("link flag %q doesn't start with '-'", flag)
+		}
+	}
+	for _, global := range l.Globals {
+		if global.Name == "" || global.Type == "" {
+			return fmt.Errorf("global %q needs both a name and a type", global.Name)
+		}
+	}
+	return nil
+}
+
+// JSON renders the profile in the format LoadLibraryProfile reads
+func (l *LibraryProfile) JSON() []byte {
+	data, _ := json.MarshalIndent(l, "", "  ")
+	return append(data, '\n')
+}
+
+// includeDirs are the profile's include directories, expanded
+func (l *LibraryProfile) includeDirs() []string {
+	var dirs []string
+	for _, dir := range l.IncludeDirs {
+		if dir = os.ExpandEnv(dir); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// linkFlags are the profile's link flags, expanded
+func (l *LibraryProfile) linkFlags() []string {
+	var flags []string
+	for _, flag := range l.LinkFlags {
+		flag = os.ExpandEnv(flag)
+		if flag == "-L" || flag == "-l" || flag == "" {
+			continue
+		}
+		flags = append(flags, flag)
+	}
+	return flags
+}
+
+// profileLinkFlags are the link flags of every profile in effect, followed
+// by those from the command line
+func (cp *CompilerPipeline) profileLinkFlags() []string {
+	var flags []string
+	for _, profile := range cp.profiles {
+		flags = append(flags, profile.linkFlags()...)
+	}
+	return append(flags, cp.options.LibraryFlags...)
+}
+
+// declareProfileTypes parses the profiles' declarations into the parser
+// before it sees the program
+func (cp *CompilerPipeline) declareProfileTypes() error {
+	for _, profile := range cp.profiles {
+		for _, decl := range profile.Declarations {
+			declParser := NewParser(decl)
+			declParser.target = cp.target
+			if _, err := declParser.Parse(); err != nil {
+				return fmt.Errorf("library profile %s: %w", profile.Name, err)
+			}
+			for name, def := range declParser.structs {
+				cp.parser.structs[name] = def
+			}
+			for name, typ := range declParser.typedefs {
+				cp.parser.typedefs[name] = typ
+			}
+			for name, value := range declParser.enums {
+				cp.parser.enums[name] = value
+			}
+		}
+	}
+	return nil
+}
+
+// declareProfileGlobals gives the selector the profiles' globals. A name
+// the program declares itself (an enumerator, typedef, variable or
+// function) shadows the profile's global, which then isn't defined.
+func (cp *CompilerPipeline) declareProfileGlobals() {
+	declared := make(map[string]bool)
+	for name := range cp.parser.enums {
+		declared[name] = true
+	}
+	for name := range cp.parser.typedefs {
+		declared[name] = true
+	}
+	for _, node := range cp.ast.Children {
+		switch node.Type {
+		case NodeVarDecl:
+			declared[node.VarName] = true
+		case NodeFunction:
+			declared[node.Name] = true
+		}
+	}
+	for _, profile := range cp.profiles {
+		for _, global := range profile.Globals {
+			if declared[global.Name] {
+				continue
+			}
+			cp.selector.defineGlobal(&Symbol{
+				Name:       global.Name,
+				Type:       global.Type,
+				IsGlobal:   true,
+				IsExternal: global.Extern,
+			})
+		}
+	}
+}
+
+// printLibraryProfile implements -print-libprofile=
+func printLibraryProfile(ref string) {
+	profile, err := LoadLibraryProfile(osFS{}, ref)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(profile.JSON())
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Undefined symbols
+// A call to a function that's neither defined in the program nor exported
+// by a library in the link would otherwise surface as a linker error that
+// doesn't say where the call is. Before linking, every call target is
+// looked up in the program's own functions and in the symbols of libc and
+// of each -l library, found the way the linker finds them (lib<name>.so,
+// then lib<name>.a, in each search directory; linker scripts such as
+// libc.so are followed). If some library can't be found or read we can't
+// tell what it provides, so nothing is reported and the linker has the
+// final say. gcc links libgcc along with libc, which the bit builtins'
+// fallbacks call (see bits.go).
+
+// librarySearchDirs are searched after the -L directories
+var librarySearchDirs = []string{
+	"/usr/local/lib",
+	"/usr/lib/x86_64-linux-gnu",
+	"/lib/x86_64-linux-gnu",
+	"/usr/lib64",
+	"/lib64",
+	"/usr/lib",
+	"/lib",
+}
+
+// callSite is one call to a named function
+type callSite struct {
+	Callee string `json:"callee"`
+	Caller string `json:"caller"`
+	Line   int    `json:"line,omitempty"`
+}
+
+// collectCallSites lists the direct calls in the IR, in program order
+func collectCallSites(instrs []*IRInstruction) []callSite {
+	var calls []callSite
+	caller := ""
+	for _, instr := range instrs {
+		switch instr.Op {
+		case OpLabel:
+			if isFunctionLabel(instr.Dst.Value) {
+				caller = instr.Dst.Value
+			}
+		case OpCall, OpTailCall:
+			if instr.Src1 != nil && instr.Src1.Type == "label" {
+				calls = append(calls, callSite{Callee: instr.Src1.Value, Caller: caller, Line: instr.Line})
+			}
+		}
+	}
+	return calls
+}
+
+// definedFunctions are the functions the IR defines
+func definedFunctions(instrs []*IRInstruction) map[string]bool {
+	defined := make(map[string]bool)
+	for _, instr := range instrs {
+		if instr.Op == OpLabel && isFunctionLabel(instr.Dst.Value) {
+			defined[instr.Dst.Value] = true
+		}
+	}
+	return defined
+}
+
+// checkUndefinedSymbols reports calls nothing in the link defines. linkFlags
+// are the -L and -l flags the program is linked with; withLibc adds libc.
+func (cp *CompilerPipeline) checkUndefinedSymbols(linkFlags []string, withLibc bool) error {
+	dirs := []string{}
+	libs := []string{}
+	if withLibc {
+		libs = append(libs, "c")
+	}
+	for _, flag := range linkFlags {
+		switch {
+		case strings.HasPrefix(flag, "-L"):
+			dirs = append(dirs, flag[2:])
+		case strings.HasPrefix(flag, "-l"):
+			libs = append(libs, flag[2:])
+		}
+	}
+	dirs = append(dirs, librarySearchDirs...)
+
+	var provided []map[string]bool
+	for _, lib := range libs {
+		symbols, ok := findLibrarySymbols(lib, dirs)
+		if !ok {
+			return nil
+		}
+		provided = append(provided, symbols)
+	}
+
+	var undefined []string
+	reported := make(map[string]bool)
+	for _, call := range cp.calls {
+		if cp.defined[call.Callee] || reported[call.Callee] || (withLibc && isLibgccHelper(call.Callee)) {
+			continue
+		}
+		found := false
+		for _, symbols := range provided {
+			if symbols[call.Callee] {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		reported[call.Callee] = true
+		where := fmt.Sprintf("called from %s", call.Caller)
+		if call.Line > 0 {
+			where += fmt.Sprintf(" at line %d", call.Line)
+		}
+		undefined = append(undefined, fmt.Sprintf("undefined reference to %s (%s)", call.Callee, where))
+	}
+	if len(undefined) > 0 {
+		return fmt.Errorf("%s", strings.Join(undefined, "\n"))
+	}
+	return nil
+}
+
+// librarySymbolCache holds the symbols of each library file read so far
+var librarySymbolCache = make(map[string]map[string]bool)
+
+// findLibrarySymbols finds lib<name> in dirs and reads the symbols it defines
+func findLibrarySymbols(name string, dirs []string) (map[string]bool, bool) {
+	for _, dir := range dirs {
+		for _, ext := range []string{".so", ".a"} {
+			path := filepath.Join(dir, "lib"+name+ext)
+			if _, err := os.Stat(path); err == nil {
+				return librarySymbols(path, 0)
+			}
+		}
+	}
+	return nil, false
+}
+
+// librarySymbols reads the symbols defined by a shared object, an archive,
+// or the files a linker script names
+func librarySymbols(path string, depth int) (map[string]bool, bool) {
+	if symbols, ok := librarySymbolCache[path]; ok {
+		return symbols, symbols != nil
+	}
+	data, err := os.ReadFile(path)
+	var symbols map[string]bool
+	switch {
+	case err != nil:
+	case bytes.HasPrefix(data, []byte(elf.ELFMAG)):
+		symbols = sharedObjectSymbols(data)
+	case bytes.HasPrefix(data, []byte("!<arch>\n")):
+		symbols = archiveSymbols(data)
+	case depth < 4:
+		symbols = linkerScriptSymbols(string(data), depth)
+	}
+	librarySymbolCache[path] = symbols
+	return symbols, symbols != nil
+}
+
+// sharedObjectSymbols reads the dynamic symbols a shared object defines
+func sharedObjectSymbols(data []byte) map[string]bool {
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	syms, err := f.DynamicSymbols()
+	if err != nil {
+		return nil
+	}
+	symbols := make(map[string]bool)
+	for _, sym := range syms {
+		if sym.Section != elf.SHN_UNDEF {
+			symbols[sym.Name] = true
+		}
+	}
+	return symbols
+}
+
+// archiveSymbols reads an ar archive's symbol index: the first member,
+// named "/" (32-bit offsets) or "/SYM64/" (64-bit), holds a count, that
+// many member offsets, and then the symbol names, each NUL-terminated
+func archiveSymbols(data []byte) map[string]bool {
+	const headerSize = 60
+	data = data[len("!<arch>\n"):]
+	if len(data) == 0 {
+		// No members (glibc's libpthread.a and friends since 2.34)
+		return map[string]bool{}
+	}
+	if len(data) < headerSize {
+		return nil
+	}
+	name := strings.TrimSpace(string(data[:16]))
+	var size int
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(data[48:58])), "%d", &size); err != nil || headerSize+size > len(data) {
+		return nil
+	}
+	index := data[headerSize : headerSize+size]
+	width := 4
+	switch name {
+	case "/":
+	case "/SYM64/":
+		width = 8
+	default:
+		return nil
+	}
+	if len(index) < width {
+		return nil
+	}
+	var count uint64
+	if width == 4 {
+		count = uint64(binary.BigEndian.Uint32(index))
+	} else {
+		count = binary.BigEndian.Uint64(index)
+	}
+	names := uint64(width) * (count + 1)
+	if names > uint64(len(index)) {
+		return nil
+	}
+	symbols := make(map[string]bool)
+	for _, symbol := range strings.Split(string(index[names:]), "\x00") {
+		if symbol != "" {
+			symbols[symbol] = true
+		}
+	}
+	return symbols
+}
+
+// linkerScriptSymbols reads the libraries a linker script such as
+// "GROUP ( /lib/libc.so.6 /usr/lib/libc_nonshared.a AS_NEEDED ( ... ) )"
+// pulls in
+func linkerScriptSymbols(script string, depth int) map[string]bool {
+	fields := strings.FieldsFunc(script, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '(' || r == ')' || r == ','
+	})
+	var symbols map[string]bool
+	inComment := false
+	for _, field := range fields {
+		switch {
+		case strings.HasPrefix(field, "/*"):
+			inComment = !strings.HasSuffix(field, "*/")
+			continue
+		case inComment:
+			inComment = !strings.HasSuffix(field, "*/")
+			continue
+		case !strings.HasPrefix(field, "/"):
+			continue
+		}
+		more, ok := librarySymbols(field, depth+1)
+		if !ok {
+			return nil
+		}
+		if symbols == nil {
+			symbols = make(map[string]bool)
+		}
+		for name := range more {
+			symbols[name] = true
+		}
+	}
+	return symbols
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"fmt"
+	"math"
+	"sort"
+	"strings"
 	"sync"
 )
 
@@ -11,12 +14,24 @@ type Linker struct {
 	rodataSection []byte
 	dataSection   []byte
 	bssSize       uint64
+	bssAlign      uint64 // strictest alignment of any object's .bss
 	
-	symbols       map[string]LinkSymbol
+	symbols       map[string]LinkSymbol // globals by name, locals by localKey
 	relocations   []Relocation
+	frames        []*unwindFrame // for .eh_frame, at their offsets in textSection
+	inputs        []*linkInput
+	duplicates    []string
+	weakRefs      map[string]bool   // referenced as .weak without a definition
+	referrers     map[string]string // the first object referring to each symbol
 	
 	entryPoint    string
 	entryOffset   uint64
+	
+	// Section start addresses relative to .text (filled in by layoutSections)
+	elf           *ELFGenerator
+	sectionBase   map[string]uint64
+	
+	enc           ByteEncoder // relocation byte order / address size
 }
 
 type LinkSymbol struct {
@@ -26,6 +41,8 @@ type LinkSymbol struct {
 	Section string
 	Binding byte
 	Type    byte
+	Common  bool
+	Object  int // index of the input that defined it
 }
 
 const (
@@ -45,31 +62,159 @@ const (
 func NewLinker() *Linker {
 	return &Linker{
 		symbols:     make(map[string]LinkSymbol),
+		weakRefs:    make(map[string]bool),
+		referrers:   make(map[string]string),
 		relocations: make([]Relocation, 0),
 		entryPoint:  "main",
+		enc:         encoderX86_64,
+	}
+}
+
+// LinkObject is one input to the link: the program as the assembler
+// encoded it (see Assembler.Object), or an archive member (see
+// linker_archive.go)
+type LinkObject struct {
+	Name        string // for errors and the map file
+	Text        []byte
+	TextSymbols map[string]uint64
+	Rodata      *Section
+	Data        *Section
+	Bss         *Section
+	Relocations []Relocation
+	Bindings    map[string]byte // STB_LOCAL for names missing; a weak name not defined is a weak reference
+	Commons     map[string]bool // common symbols, which give way to a real definition
+	Frames      []*unwindFrame  // call frame information for Text's functions (see unwind.go)
+}
+
+// linkInput is where one object's sections went in the output
+type linkInput struct {
+	name   string
+	start  map[string]uint64 // by section, relative to the section
+	size   map[string]uint64
+	reason string // what pulled an archive member in
+}
+
+// AddObject appends an object's sections to the output and defines its
+// symbols. Locals are only visible to the object's own relocations; a
+// global defined twice is an error (reported by Link), unless one of the
+// definitions is weak or common, in which case the other one wins.
+func (l *Linker) AddObject(obj *LinkObject) {
+	index := len(l.inputs)
+	in := &linkInput{name: obj.Name, start: make(map[string]uint64), size: make(map[string]uint64)}
+	l.inputs = append(l.inputs, in)
+
+	// Each object's part of a section starts 16-byte aligned, or more if
+	// its contents ask for more
+	place := func(section string, out *[]byte, contents []byte, align uint64) {
+		in.start[section] = uint64(len(*out))
+		if len(contents) > 0 {
+			in.start[section] = alignUp(uint64(len(*out)), max(align, 16))
+			*out = append(*out, make([]byte, in.start[section]-uint64(len(*out)))...)
+			*out = append(*out, contents...)
+		}
+		in.size[section] = uint64(len(contents))
+	}
+	place("text", &l.textSection, obj.Text, 16)
+	place("rodata", &l.rodataSection, obj.Rodata.Data, obj.Rodata.Align)
+	place("data", &l.dataSection, obj.Data.Data, obj.Data.Align)
+	in.start["bss"] = l.bssSize
+	if obj.Bss.Size > 0 {
+		l.bssAlign = max(l.bssAlign, obj.Bss.Align, 16)
+		in.start["bss"] = alignUp(l.bssSize, max(obj.Bss.Align, 16))
+		l.bssSize = in.start["bss"] + obj.Bss.Size
+	}
+	in.size["bss"] = obj.Bss.Size
+	for _, f := range obj.Frames {
+		moved := *f
+		moved.Start += in.start["text"]
+		moved.End += in.start["text"]
+		l.frames = append(l.frames, &moved)
+	}
+
+	l.define(obj, index, "text", obj.TextSymbols, STT_FUNC)
+	for _, sec := range []*Section{obj.Rodata, obj.Data, obj.Bss} {
+		l.define(obj, index, sec.Name, sec.Symbols, STT_OBJECT)
+	}
+	for _, name := range sortedNames(obj.Bindings) {
+		if obj.Bindings[name] == STB_WEAK && !objectDefines(obj, name) {
+			l.weakRefs[name] = true
+		}
+	}
+	for _, rel := range obj.Relocations {
+		section := rel.Section
+		if section == "" {
+			section = "text"
+		}
+		rel.Offset += in.start[section]
+		if obj.Bindings[rel.Symbol] == STB_LOCAL && objectDefines(obj, rel.Symbol) {
+			rel.Symbol = localKey(rel.Symbol, index)
+		}
+		if _, ok := l.referrers[rel.Symbol]; !ok {
+			l.referrers[rel.Symbol] = obj.Name
+		}
+		l.relocations = append(l.relocations, rel)
 	}
 }
 
-func (l *Linker) SetSections(text, rodata, data []byte, bssSize uint64) {
-	l.textSection = text
-	l.rodataSection = rodata
-	l.dataSection = data
-	l.bssSize = bssSize
+// define adds the symbols an object defines in one section
+func (l *Linker) define(obj *LinkObject, index int, section string, symbols map[string]uint64, symType byte) {
+	for _, name := range sortedNames(symbols) {
+		sym := LinkSymbol{
+			Name:    name,
+			Value:   l.inputs[index].start[section] + symbols[name],
+			Section: section,
+			Binding: obj.Bindings[name],
+			Type:    symType,
+			Common:  obj.Commons[name],
+			Object:  index,
+		}
+		if sym.Binding == STB_LOCAL {
+			l.symbols[localKey(name, index)] = sym
+			continue
+		}
+		old, ok := l.symbols[name]
+		switch {
+		case !ok:
+		case sym.Binding == STB_WEAK || sym.Common:
+			// A weak or common definition never displaces another one
+			continue
+		case old.Binding == STB_WEAK || old.Common:
+		default:
+			l.duplicates = append(l.duplicates, fmt.Sprintf("multiple definition of '%s' (in %s and %s)",
+				name, l.inputs[old.Object].name, obj.Name))
+			continue
+		}
+		l.symbols[name] = sym
+	}
+}
+
+// localKey is the symbol table key of a local symbol, which only its own
+// object's relocations see
+func localKey(name string, object int) string {
+	return fmt.Sprintf("%s#%d", name, object)
 }
 
-func (l *Linker) AddSymbol(name string, value uint64, section string) {
-	l.symbols[name] = LinkSymbol{
-		Name:    name,
-		Value:   value,
-		Size:    0,
-		Section: section,
-		Binding: STB_GLOBAL,
-		Type:    STT_FUNC,
+// objectDefines reports whether obj defines name in any section
+func objectDefines(obj *LinkObject, name string) bool {
+	if _, ok := obj.TextSymbols[name]; ok {
+		return true
 	}
+	for _, sec := range []*Section{obj.Rodata, obj.Data, obj.Bss} {
+		if _, ok := sec.Symbols[name]; ok {
+			return true
+		}
+	}
+	return false
 }
 
-func (l *Linker) AddRelocation(rel Relocation) {
-	l.relocations = append(l.relocations, rel)
+// sortedNames are a map's keys in order, so links are reproducible
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 func (l *Linker) Link() ([]byte, error) {
@@ -79,6 +224,9 @@ func (l *Linker) Link() ([]byte, error) {
 		return nil, err
 	}
 	
+	// Place sections so relocations can target rodata/data/bss
+	l.layoutSections()
+	
 	// Debug: check text section size
 	if false {  // Set to true to debug
 		fmt.Printf("DEBUG: Text section size: %d bytes\n", len(l.textSection))
@@ -93,7 +241,7 @@ func (l *Linker) Link() ([]byte, error) {
 	
 	// Find entry point
 	if entry, ok := l.symbols[l.entryPoint]; ok {
-		l.entryOffset = entry.Value
+		l.entryOffset = l.sectionBase[entry.Section] + entry.Value
 	} else {
 		return nil, fmt.Errorf("entry point '%s' not found", l.entryPoint)
 	}
@@ -109,16 +257,64 @@ func min(a, b int) int {
 	return b
 }
 
+// layoutSections computes where each section lands relative to .text
+func (l *Linker) layoutSections() {
+	l.elf = NewELFGenerator()
+	l.elf.enc = l.enc
+	l.elf.SetCode(l.textSection, l.rodataSection, l.dataSection, l.bssSize)
+	l.elf.bssAlign = l.bssAlign
+	if len(l.frames) > 0 {
+		// Sized first, then written for where they landed
+		l.elf.SetUnwind(buildEHFrame(l.enc, l.frames, 0, 0, 0))
+		layout := l.elf.Layout()
+		l.elf.SetUnwind(buildEHFrame(l.enc, l.frames, layout.TextAddr, layout.EhFrameAddr, layout.EhFrameHdrAddr))
+	}
+	layout := l.elf.Layout()
+	
+	l.sectionBase = map[string]uint64{
+		"text":   0,
+		"rodata": layout.RodataAddr - layout.TextAddr,
+		"data":   layout.DataAddr - layout.TextAddr,
+		"bss":    layout.BssAddr - layout.TextAddr,
+		"undef":  -layout.TextAddr, // so an undefined weak symbol is at 0
+	}
+}
+
+// resolveSymbols checks every global is defined once and every reference
+// has a definition. A weak reference nothing defines resolves to 0.
 func (l *Linker) resolveSymbols() error {
-	// Check for undefined symbols
-	for _, rel := range l.relocations {
-		if _, ok := l.symbols[rel.Symbol]; !ok {
-			return fmt.Errorf("undefined symbol: %s", rel.Symbol)
+	if len(l.duplicates) > 0 {
+		return fmt.Errorf("%s", strings.Join(l.duplicates, "\n"))
+	}
+	var undefined []string
+	for _, name := range l.Undefined() {
+		if l.weakRefs[name] {
+			l.symbols[name] = LinkSymbol{Name: name, Section: "undef", Binding: STB_WEAK}
+			continue
 		}
+		undefined = append(undefined, fmt.Sprintf("undefined symbol: %s (referenced from %s)", name, l.referrers[name]))
+	}
+	if len(undefined) > 0 {
+		return fmt.Errorf("%s", strings.Join(undefined, "\n"))
 	}
 	return nil
 }
 
+// Undefined are the symbols relocations refer to that nothing defines
+func (l *Linker) Undefined() []string {
+	var undefined []string
+	seen := make(map[string]bool)
+	for _, rel := range l.relocations {
+		if _, ok := l.symbols[rel.Symbol]; ok || seen[rel.Symbol] {
+			continue
+		}
+		seen[rel.Symbol] = true
+		undefined = append(undefined, rel.Symbol)
+	}
+	sort.Strings(undefined)
+	return undefined
+}
+
 func (l *Linker) applyRelocations() error {
 	// Use goroutines to process relocations in parallel
 	// Split relocations into chunks
@@ -175,35 +371,44 @@ func (l *Linker) applyRelocation(rel Relocation) error {
 	var target []byte
 	switch rel.Type {
 	case R_X86_64_PC32:
-		// PC-relative 32-bit
-		targetAddr := sym.Value
-		pcAddr := rel.Offset + 4
+		// PC-relative 32-bit (addresses are relative to the start of .text)
+		targetAddr := l.sectionBase[sym.Section] + sym.Value
+		// S + A - P: the -4 addend accounts for the displacement size
+		pcAddr := l.relocationBase(rel) + rel.Offset
 		offset := int32(int64(targetAddr) - int64(pcAddr) + rel.Addend)
 		
-		target = l.textSection
+		target = l.relocationTarget(rel)
 		if int(rel.Offset)+4 > len(target) {
 			return fmt.Errorf("relocation offset out of bounds")
 		}
 		
-		// Write 32-bit offset (little-endian)
-		target[rel.Offset] = byte(offset)
-		target[rel.Offset+1] = byte(offset >> 8)
-		target[rel.Offset+2] = byte(offset >> 16)
-		target[rel.Offset+3] = byte(offset >> 24)
+		// Write 32-bit offset
+		l.enc.Put(target[rel.Offset:], uint64(offset), 4)
 		
 	case R_X86_64_64:
 		// Absolute 64-bit
-		targetAddr := sym.Value + uint64(rel.Addend)
+		targetAddr := l.elf.Layout().TextAddr + l.sectionBase[sym.Section] + sym.Value + uint64(rel.Addend)
 		
-		target = l.textSection
+		target = l.relocationTarget(rel)
 		if int(rel.Offset)+8 > len(target) {
 			return fmt.Errorf("relocation offset out of bounds")
 		}
 		
-		// Write 64-bit address (little-endian)
-		for i := 0; i < 8; i++ {
-			target[rel.Offset+uint64(i)] = byte(targetAddr >> (i * 8))
+		// Write 64-bit address
+		l.enc.Put(target[rel.Offset:], targetAddr, 8)
+		
+	case R_X86_64_32, R_X86_64_32S:
+		// Absolute 32-bit, zero- or sign-extended by the instruction
+		targetAddr := int64(l.elf.Layout().TextAddr+l.sectionBase[sym.Section]+sym.Value) + rel.Addend
+		if (rel.Type == R_X86_64_32 && uint64(targetAddr) > math.MaxUint32) ||
+			(rel.Type == R_X86_64_32S && (targetAddr < math.MinInt32 || targetAddr > math.MaxInt32)) {
+			return fmt.Errorf("address of %s doesn't fit a 32-bit relocation", rel.Symbol)
 		}
+		target = l.relocationTarget(rel)
+		if int(rel.Offset)+4 > len(target) {
+			return fmt.Errorf("relocation offset out of bounds")
+		}
+		l.enc.Put(target[rel.Offset:], uint64(targetAddr), 4)
 		
 	default:
 		return fmt.Errorf("unsupported relocation type: %d", rel.Type)
@@ -212,18 +417,48 @@ func (l *Linker) applyRelocation(rel Relocation) error {
 	return nil
 }
 
+// relocationTarget is the section a relocation patches: .text, or the
+// .rodata or .data a data directive's address went in
+func (l *Linker) relocationTarget(rel Relocation) []byte {
+	switch rel.Section {
+	case "rodata":
+		return l.rodataSection
+	case "data":
+		return l.dataSection
+	}
+	return l.textSection
+}
+
+// relocationBase is where the section a relocation patches starts,
+// relative to .text
+func (l *Linker) relocationBase(rel Relocation) uint64 {
+	if rel.Section == "" {
+		return 0
+	}
+	return l.sectionBase[rel.Section]
+}
+
 func (l *Linker) generateExecutable() ([]byte, error) {
-	// Create ELF generator
-	elfGen := NewELFGenerator()
-	
-	// Set sections
-	elfGen.SetCode(l.textSection, l.rodataSection, l.dataSection, l.bssSize)
+	// ELF generator was created (and sections set) by layoutSections
+	elfGen := l.elf
+	textAddr := elfGen.Layout().TextAddr
 	
-	// Add symbols to ELF (in parallel)
+	// Add symbols to ELF (in parallel). The table is sorted, locals first as
+	// ELF requires, so the output is the same on every run.
 	symbolSlice := make([]LinkSymbol, 0, len(l.symbols))
 	for _, sym := range l.symbols {
 		symbolSlice = append(symbolSlice, sym)
 	}
+	sort.Slice(symbolSlice, func(i, j int) bool {
+		a, b := symbolSlice[i], symbolSlice[j]
+		if (a.Binding == STB_LOCAL) != (b.Binding == STB_LOCAL) {
+			return a.Binding == STB_LOCAL
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Object < b.Object
+	})
 	
 	// Process symbols in parallel
 	var wg sync.WaitGroup
@@ -240,7 +475,7 @@ func (l *Linker) generateExecutable() ([]byte, error) {
 		symType byte
 	}
 	
-	symbolDataChan := make(chan symbolData, len(symbolSlice))
+	prepared := make([]symbolData, len(symbolSlice))
 	
 	for i := 0; i < numWorkers; i++ {
 		start := i * chunkSize
@@ -253,42 +488,27 @@ func (l *Linker) generateExecutable() ([]byte, error) {
 		}
 		
 		wg.Add(1)
-		go func(syms []LinkSymbol) {
+		go func(start int, syms []LinkSymbol) {
 			defer wg.Done()
 			
-			for _, sym := range syms {
-				var sectionIdx uint16 = 1
-				switch sym.Section {
-				case "text":
-					sectionIdx = 1
-				case "rodata":
-					sectionIdx = 2
-				case "data":
-					sectionIdx = 3
-				case "bss":
-					sectionIdx = 4
-				}
+			for i, sym := range syms {
+				sectionIdx := elfGen.SectionIndex(sym.Section)
 				
-				symbolDataChan <- symbolData{
+				prepared[start+i] = symbolData{
 					name:    sym.Name,
-					value:   sym.Value,
+					value:   textAddr + l.sectionBase[sym.Section] + sym.Value,
 					size:    sym.Size,
 					section: sectionIdx,
 					binding: sym.Binding,
 					symType: sym.Type,
 				}
 			}
-		}(symbolSlice[start:end])
+		}(start, symbolSlice[start:end])
 	}
+	wg.Wait()
 	
-	// Wait for workers
-	go func() {
-		wg.Wait()
-		close(symbolDataChan)
-	}()
-	
-	// Add symbols sequentially from channel
-	for sd := range symbolDataChan {
+	// Add symbols sequentially, in table order
+	for _, sd := range prepared {
 		elfGen.AddSymbol(sd.name, sd.value, sd.size, sd.section, sd.binding, sd.symType)
 	}
 	
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Archives
+// With -fuse-ld=internal, each -l library is looked for as lib<name>.a in
+// the -L directories and then the usual ones (see librarySearchDirs), and
+// the members that define a symbol the link still needs are pulled in, as
+// often as it takes for what they need in turn. Members are x86-64 ELF
+// relocatable objects; their allocated sections are merged into .text,
+// .rodata, .data and .bss, and their relocations are applied like the
+// program's:
+//
+//	R_X86_64_64, _32, _32S        absolute
+//	R_X86_64_PC32, _PLT32         PC-relative (there's no PLT: calls go
+//	                              straight to the function)
+//	R_X86_64_GOTPCRELX, _REX_     a movq of a GOT entry, rewritten to the
+//	GOTPCRELX                     leaq of the address it would hold
+//
+// .eh_frame and notes are left out. Anything else that needs support at
+// run time (thread-locals, constructors, IFUNCs) is an error, so libc can't
+// be linked this way.
+
+// archiveMember is one object in an archive
+type archiveMember struct {
+	name    string
+	data    []byte
+	defines map[string]bool // globals it defines, not counting commons
+	loaded  bool
+}
+
+// archive is a library the link can pull members from
+type archive struct {
+	path    string
+	members []*archiveMember
+}
+
+// findArchives finds lib<name>.a for each -l in flags
+func findArchives(flags []string) ([]string, error) {
+	var dirs, paths []string
+	for _, flag := range flags {
+		if strings.HasPrefix(flag, "-L") {
+			dirs = append(dirs, flag[2:])
+		}
+	}
+	dirs = append(dirs, librarySearchDirs...)
+	for _, flag := range flags {
+		if !strings.HasPrefix(flag, "-l") {
+			continue
+		}
+		name := "lib" + flag[2:] + ".a"
+		found := false
+		for _, dir := range dirs {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				paths = append(paths, path)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("cannot find %s for %s (the internal linker only links static libraries)", name, flag)
+		}
+	}
+	return paths, nil
+}
+
+// PullArchives adds the members of the archives at paths that define
+// symbols the link needs, until nothing more is needed from them
+func (l *Linker) PullArchives(paths []string) error {
+	var archives []*archive
+	for _, path := range paths {
+		more, err := readArchives(path, 0)
+		if err != nil {
+			return err
+		}
+		archives = append(archives, more...)
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, name := range l.Undefined() {
+			// A weak reference doesn't pull anything in
+			if l.weakRefs[name] {
+				continue
+			}
+			member, ar := findMember(archives, name)
+			if member == nil {
+				continue
+			}
+			obj, err := loadObject(fmt.Sprintf("%s(%s)", filepath.Base(ar.path), member.name), member.data)
+			if err != nil {
+				return err
+			}
+			member.loaded = true
+			l.AddObject(obj)
+			l.inputs[len(l.inputs)-1].reason = fmt.Sprintf("%s (%s)", l.referrers[name], name)
+			changed = true
+		}
+	}
+	return nil
+}
+
+// findMember is the first member not linked yet that defines name
+func findMember(archives []*archive, name string) (*archiveMember, *archive) {
+	for _, ar := range archives {
+		for _, member := range ar.members {
+			if !member.loaded && member.defines[name] {
+				return member, ar
+			}
+		}
+	}
+	return nil, nil
+}
+
+// readArchives reads the archive at path, or the archives a linker script
+// there (libm.a's "GROUP ( /usr/lib/.../libm-2.35.a ... )") names
+func readArchives(path string, depth int) ([]*archive, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte("!<arch>\n")) {
+		ar, err := readArchive(path, data)
+		if err != nil {
+			return nil, err
+		}
+		return []*archive{ar}, nil
+	}
+	if depth >= 4 || bytes.IndexByte(data, 0) >= 0 {
+		return nil, fmt.Errorf("%s: not an archive", path)
+	}
+	var archives []*archive
+	fields := strings.FieldsFunc(string(data), func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '(' || r == ')' || r == ','
+	})
+	for _, field := range fields {
+		if !strings.HasPrefix(field, "/") || strings.HasPrefix(field, "/*") {
+			continue
+		}
+		more, err := readArchives(field, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, more...)
+	}
+	return archives, nil
+}
+
+// readArchive reads an ar archive's object members, and what each defines.
+// Member names are "name/" or, when too long for the header, "/offset"
+// into the "//" member's table of names.
+func readArchive(path string, data []byte) (*archive, error) {
+	const headerSize = 60
+	ar := &archive{path: path}
+	var longNames []byte
+	for pos := len("!<arch>\n"); pos+headerSize <= len(data); {
+		header := data[pos : pos+headerSize]
+		size, err := strconv.Atoi(strings.TrimSpace(string(header[48:58])))
+		if err != nil || pos+headerSize+size > len(data) {
+			return nil, fmt.Errorf("%s: malformed archive", path)
+		}
+		body := data[pos+headerSize : pos+headerSize+size]
+		pos += headerSize + size + size%2
+		name := strings.TrimSpace(string(header[:16]))
+		switch {
+		case name == "/" || name == "/SYM64/":
+			continue
+		case name == "//":
+			longNames = body
+			continue
+		case strings.HasPrefix(name, "/"):
+			offset, err := strconv.Atoi(name[1:])
+			if err != nil || offset >= len(longNames) {
+				return nil, fmt.Errorf("%s: malformed archive", path)
+			}
+			name = string(longNames[offset:])
+			name = name[:strings.IndexAny(name+"\n", "\n")]
+		}
+		name = strings.TrimSuffix(name, "/")
+		member := &archiveMember{name: name, data: body, defines: make(map[string]bool)}
+		if f, err := elf.NewFile(bytes.NewReader(body)); err == nil {
+			syms, _ := f.Symbols()
+			for _, sym := range syms {
+				bind := elf.ST_BIND(sym.Info)
+				if (bind == elf.STB_GLOBAL || bind == elf.STB_WEAK) && sym.Section != elf.SHN_UNDEF && sym.Section != elf.SHN_COMMON {
+					member.defines[sym.Name] = true
+				}
+			}
+		}
+		ar.members = append(ar.members, member)
+	}
+	return ar, nil
+}
+
+// loadObject reads an ELF relocatable object into a LinkObject
+func loadObject(name string, data []byte) (*LinkObject, error) {
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if f.Type != elf.ET_REL || f.Machine != elf.EM_X86_64 {
+		return nil, fmt.Errorf("%s: not an x86-64 relocatable object", name)
+	}
+	obj := &LinkObject{
+		Name:        name,
+		TextSymbols: make(map[string]uint64),
+		Rodata:      newSection("rodata"),
+		Data:        newSection("data"),
+		Bss:         newSection("bss"),
+		Bindings:    make(map[string]byte),
+		Commons:     make(map[string]bool),
+	}
+
+	// Where each allocated section went: the output section and its offset
+	type placement struct {
+		section string
+		offset  uint64
+	}
+	placed := make(map[int]placement)
+	for i, sec := range f.Sections {
+		if sec.Flags&elf.SHF_ALLOC == 0 || sec.Name == ".eh_frame" || strings.HasPrefix(sec.Name, ".note") {
+			continue
+		}
+		if sec.Flags&elf.SHF_TLS != 0 || sec.Type == elf.SHT_INIT_ARRAY || sec.Type == elf.SHT_FINI_ARRAY || sec.Type == elf.SHT_PREINIT_ARRAY {
+			return nil, fmt.Errorf("%s: section %s isn't supported by the internal linker", name, sec.Name)
+		}
+		align := max(sec.Addralign, 1)
+		switch {
+		case sec.Flags&elf.SHF_EXECINSTR != 0:
+			offset := alignUp(uint64(len(obj.Text)), align)
+			obj.Text = append(obj.Text, make([]byte, offset-uint64(len(obj.Text)))...)
+			body, err := sec.Data()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			obj.Text = append(obj.Text, body...)
+			placed[i] = placement{"text", offset}
+		case sec.Type == elf.SHT_NOBITS:
+			obj.Bss.align(align)
+			placed[i] = placement{"bss", obj.Bss.Size}
+			obj.Bss.Size += sec.Size
+		default:
+			out := obj.Rodata
+			if sec.Flags&elf.SHF_WRITE != 0 {
+				out = obj.Data
+			}
+			out.align(align)
+			placed[i] = placement{out.Name, out.Size}
+			body, err := sec.Data()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			out.write(body...)
+		}
+	}
+	sectionSymbols := func(section string) map[string]uint64 {
+		switch section {
+		case "text":
+			return obj.TextSymbols
+		case "rodata":
+			return obj.Rodata.Symbols
+		case "data":
+			return obj.Data.Symbols
+		}
+		return obj.Bss.Symbols
+	}
+
+	// Symbols, by their index in .symtab. A section's own symbol is given
+	// the section's name, so relocations against it have something to use.
+	syms, err := f.Symbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	names := make([]string, len(syms)+1)
+	for i, sym := range syms {
+		symType := elf.ST_TYPE(sym.Info)
+		bind := byte(elf.ST_BIND(sym.Info))
+		symName := sym.Name
+		switch {
+		case symType == elf.STT_FILE:
+			continue
+		case symType == elf.STT_GNU_IFUNC:
+			return nil, fmt.Errorf("%s: %s is an IFUNC, which the internal linker can't resolve", name, symName)
+		case symType == elf.STT_SECTION:
+			if int(sym.Section) < len(f.Sections) {
+				symName = fmt.Sprintf("%s[%d]", f.Sections[sym.Section].Name, sym.Section)
+			}
+			bind = STB_LOCAL
+		}
+		names[i+1] = symName
+		switch sym.Section {
+		case elf.SHN_UNDEF:
+			if bind == STB_WEAK {
+				obj.Bindings[symName] = STB_WEAK
+			}
+			continue
+		case elf.SHN_COMMON:
+			obj.Bss.align(max(sym.Value, 1))
+			obj.Bss.define(symName)
+			obj.Bss.Size += sym.Size
+			obj.Commons[symName] = true
+		default:
+			at, ok := placed[int(sym.Section)]
+			if !ok {
+				continue
+			}
+			sectionSymbols(at.section)[symName] = at.offset + sym.Value
+		}
+		obj.Bindings[symName] = bind
+	}
+
+	for _, sec := range f.Sections {
+		if sec.Type != elf.SHT_RELA {
+			continue
+		}
+		at, ok := placed[int(sec.Info)]
+		if !ok {
+			continue
+		}
+		body, err := sec.Data()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for pos := 0; pos+24 <= len(body); pos += 24 {
+			offset := binary.LittleEndian.Uint64(body[pos:])
+			info := binary.LittleEndian.Uint64(body[pos+8:])
+			rel := Relocation{
+				Offset: at.offset + offset,
+				Addend: int64(binary.LittleEndian.Uint64(body[pos+16:])),
+			}
+			if at.section != "text" {
+				rel.Section = at.section
+			}
+			if symIndex := int(info >> 32); symIndex < len(names) {
+				rel.Symbol = names[symIndex]
+			}
+			switch elf.R_X86_64(uint32(info)) {
+			case elf.R_X86_64_64:
+				rel.Type = R_X86_64_64
+			case elf.R_X86_64_PC32, elf.R_X86_64_PLT32:
+				rel.Type = R_X86_64_PC32
+			case elf.R_X86_64_32:
+				rel.Type = R_X86_64_32
+			case elf.R_X86_64_32S:
+				rel.Type = R_X86_64_32S
+			case elf.R_X86_64_GOTPCRELX, elf.R_X86_64_REX_GOTPCRELX:
+				// movq sym@GOTPCREL(%rip), %reg becomes leaq sym(%rip), %reg
+				if at.section != "text" || rel.Offset < 2 || obj.Text[rel.Offset-2] != 0x8b {
+					return nil, fmt.Errorf("%s: GOT reference to %s the internal linker can't relax", name, rel.Symbol)
+				}
+				obj.Text[rel.Offset-2] = 0x8d
+				rel.Type = R_X86_64_PC32
+			case elf.R_X86_64_NONE:
+				continue
+			default:
+				return nil, fmt.Errorf("%s: relocation %v against %s isn't supported by the internal linker",
+					name, elf.R_X86_64(uint32(info)), rel.Symbol)
+			}
+			obj.Relocations = append(obj.Relocations, rel)
+		}
+	}
+	return obj, nil
+}
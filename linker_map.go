@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Map files (-Wl,-Map=<file>)
+// After an internal link, the map lists the archive members that were
+// pulled in and why, then each output section with its address and size,
+// what each input contributed to it, and the final address of every global
+// symbol, in the layout GNU ld's maps use:
+//
+//	Archive member included to satisfy reference by file (symbol)
+//
+//	libsq.a(sq.o)                 prog.c (square)
+//
+//	Memory map
+//
+//	.text           0x0000000000401000       0xd3
+//	 .text          0x0000000000401000       0xc1 prog.c
+//	                0x0000000000401000                main
+//
+// When gcc links, the flag is passed through and ld writes the map.
+
+// WriteMapFile writes the map of the last Link to path
+func (l *Linker) WriteMapFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	l.writeMap(w)
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (l *Linker) writeMap(w io.Writer) {
+	fmt.Fprintln(w, "Archive member included to satisfy reference by file (symbol)")
+	fmt.Fprintln(w)
+	for _, in := range l.inputs {
+		if in.reason != "" {
+			fmt.Fprintf(w, "%-29s %s\n", in.name, in.reason)
+		}
+	}
+	fmt.Fprintln(w)
+
+	// Globals, by input and section, in address order
+	type entry struct {
+		name  string
+		value uint64
+	}
+	globals := make(map[int]map[string][]entry)
+	for _, sym := range l.symbols {
+		if sym.Binding == STB_LOCAL || sym.Section == "undef" {
+			continue
+		}
+		if globals[sym.Object] == nil {
+			globals[sym.Object] = make(map[string][]entry)
+		}
+		globals[sym.Object][sym.Section] = append(globals[sym.Object][sym.Section], entry{sym.Name, sym.Value})
+	}
+
+	textAddr := l.elf.Layout().TextAddr
+	sizes := map[string]uint64{
+		"text":   uint64(len(l.textSection)),
+		"rodata": uint64(len(l.rodataSection)),
+		"data":   uint64(len(l.dataSection)),
+		"bss":    l.bssSize,
+	}
+	fmt.Fprintln(w, "Memory map")
+	for _, section := range []string{"text", "rodata", "data", "bss"} {
+		base := textAddr + l.sectionBase[section]
+		fmt.Fprintf(w, "\n%-15s 0x%016x %#10x\n", "."+section, base, sizes[section])
+		for index, in := range l.inputs {
+			if in.size[section] == 0 {
+				continue
+			}
+			fmt.Fprintf(w, " %-14s 0x%016x %#10x %s\n", "."+section, base+in.start[section], in.size[section], in.name)
+			syms := globals[index][section]
+			sort.Slice(syms, func(i, j int) bool {
+				if syms[i].value != syms[j].value {
+					return syms[i].value < syms[j].value
+				}
+				return syms[i].name < syms[j].name
+			})
+			for _, sym := range syms {
+				fmt.Fprintf(w, "%-15s 0x%016x                %s\n", "", base+sym.value, sym.name)
+			}
+		}
+	}
+}
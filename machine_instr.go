@@ -0,0 +1,348 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Structured machine instructions
+// CodeEmitter produces a stream of MachineInstr; the GAS printer (String)
+// and the binary encoder (Assembler.AssembleInstrs) both consume the same
+// stream, so the native path never has to re-split a giant assembly string.
+
+type MachineInstrKind int
+
+const (
+	MInstr     MachineInstrKind = iota // opcode + operands
+	MLabel                             // name:
+	MDirective                         // .section, .globl, .string ...
+	MComment                           // # text
+	MBlank                             // empty line (kept so printed output is unchanged)
+)
+
+type MachineOperandKind int
+
+const (
+	MOpReg    MachineOperandKind = iota // %rax
+	MOpImm                              // $42 or $symbol
+	MOpMem                              // disp(%base,%index,scale) or symbol(%rip)
+	MOpSymbol                           // bare label / call target
+)
+
+type MachineOperand struct {
+	Kind     MachineOperandKind
+	Reg      string // register (MOpReg) or base register (MOpMem), without %
+	Index    string // index register for scaled addressing
+	Scale    int
+	Disp     int64
+	Symbol   string // label for MOpSymbol, RIP-relative symbol, or symbolic immediate
+	Indirect bool   // *operand (indirect call/jmp)
+}
+
+type MachineInstr struct {
+	Kind     MachineInstrKind
+	Op       string // mnemonic, directive (with leading dot), label name or comment text
+	Prefix   string // lock or rep before the mnemonic, "" if none
+	Operands []MachineOperand
+	Args     string // raw directive arguments (strings may contain commas)
+	Size     int    // operand size in bytes from the mnemonic suffix, 0 if not sized
+}
+
+// Constructors used by the emitter
+
+func RegOp(name string) MachineOperand {
+	return MachineOperand{Kind: MOpReg, Reg: strings.TrimPrefix(name, "%")}
+}
+
+func ImmOp(val int64) MachineOperand {
+	return MachineOperand{Kind: MOpImm, Disp: val}
+}
+
+func MemOp(base string, disp int64) MachineOperand {
+	return MachineOperand{Kind: MOpMem, Reg: strings.TrimPrefix(base, "%"), Disp: disp}
+}
+
+func RIPOp(symbol string) MachineOperand {
+	return MachineOperand{Kind: MOpMem, Reg: "rip", Symbol: symbol}
+}
+
+func SymOp(symbol string) MachineOperand {
+	return MachineOperand{Kind: MOpSymbol, Symbol: symbol}
+}
+
+// ImmTextOp is an immediate as written: a number, or anything else (a
+// symbol, a float's digits) kept as its text
+func ImmTextOp(text string) MachineOperand {
+	if val, err := parseImmediate(text); err == nil && !strings.Contains(text, ".") {
+		return ImmOp(val)
+	}
+	return MachineOperand{Kind: MOpImm, Symbol: strings.TrimPrefix(text, "$")}
+}
+
+// Indexed adds index*scale to the memory operand o
+func (o MachineOperand) Indexed(index string, scale int) MachineOperand {
+	o.Index = strings.TrimPrefix(index, "%")
+	o.Scale = scale
+	return o
+}
+
+func NewInstr(op string, operands ...MachineOperand) *MachineInstr {
+	return &MachineInstr{Kind: MInstr, Op: op, Operands: operands, Size: mnemonicSize(op)}
+}
+
+func NewLabel(name string) *MachineInstr {
+	return &MachineInstr{Kind: MLabel, Op: name}
+}
+
+func NewDirective(name, args string) *MachineInstr {
+	return &MachineInstr{Kind: MDirective, Op: name, Args: args}
+}
+
+// directiveLine makes a directive of a line such as ".quad main", for the
+// data layouts the x86-64 and ARM64 emitters share as text
+func directiveLine(line string) *MachineInstr {
+	name, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+	return NewDirective(name, strings.TrimSpace(args))
+}
+
+// sizedMnemonics are base mnemonics that take an AT&T b/w/l/q size suffix
+var sizedMnemonics = map[string]bool{
+	"mov": true, "add": true, "sub": true, "imul": true, "idiv": true, "div": true,
+	"cmp": true, "and": true, "or": true, "xor": true, "test": true, "lea": true,
+	"push": true, "pop": true, "neg": true, "not": true, "inc": true, "dec": true,
+	"sal": true, "sar": true, "shl": true, "shr": true, "movzb": true, "movsb": true,
+	"movzw": true, "movsw": true, "movs": true, "xchg": true, "xadd": true,
+	"popcnt": true, "lzcnt": true, "tzcnt": true, "bswap": true,
+}
+
+// mnemonicSize derives the operand size from the suffix (movq -> 8, movl -> 4)
+func mnemonicSize(op string) int {
+	if len(op) < 2 {
+		return 0
+	}
+	base := op[:len(op)-1]
+	if !sizedMnemonics[base] {
+		return 0
+	}
+	switch op[len(op)-1] {
+	case 'q':
+		return 8
+	case 'l':
+		return 4
+	case 'w':
+		return 2
+	case 'b':
+		return 1
+	}
+	return 0
+}
+
+// String renders the operand in AT&T syntax
+func (o MachineOperand) String() string {
+	prefix := ""
+	if o.Indirect {
+		prefix = "*"
+	}
+	switch o.Kind {
+	case MOpReg:
+		return prefix + "%" + o.Reg
+	case MOpImm:
+		if o.Symbol != "" {
+			return "$" + o.Symbol
+		}
+		return fmt.Sprintf("$%d", o.Disp)
+	case MOpMem:
+		var sb strings.Builder
+		sb.WriteString(prefix)
+		if o.Symbol != "" {
+			sb.WriteString(o.Symbol)
+			if o.Disp != 0 {
+				sb.WriteString(fmt.Sprintf("%+d", o.Disp))
+			}
+		} else if o.Disp != 0 {
+			sb.WriteString(strconv.FormatInt(o.Disp, 10))
+		}
+		sb.WriteString("(")
+		if o.Reg != "" {
+			sb.WriteString("%" + o.Reg)
+		}
+		if o.Index != "" {
+			sb.WriteString(",%" + o.Index)
+			if o.Scale != 0 {
+				sb.WriteString(fmt.Sprintf(",%d", o.Scale))
+			}
+		}
+		sb.WriteString(")")
+		return sb.String()
+	default:
+		return prefix + o.Symbol
+	}
+}
+
+// String renders the instruction as one line of GAS assembly
+func (mi *MachineInstr) String() string {
+	switch mi.Kind {
+	case MLabel:
+		return mi.Op + ":"
+	case MDirective:
+		if mi.Args == "" {
+			return "    " + mi.Op
+		}
+		return "    " + mi.Op + " " + mi.Args
+	case MComment:
+		return mi.Op
+	case MBlank:
+		return ""
+	}
+
+	name := mi.Op
+	if mi.Prefix != "" {
+		name = mi.Prefix + " " + name
+	}
+	if len(mi.Operands) == 0 {
+		return "    " + name
+	}
+	ops := make([]string, len(mi.Operands))
+	for i, o := range mi.Operands {
+		ops[i] = o.String()
+	}
+	return "    " + name + " " + strings.Join(ops, ", ")
+}
+
+// PrintMachineInstrs renders a whole stream as GAS text
+func PrintMachineInstrs(instrs []*MachineInstr) string {
+	var sb strings.Builder
+	for _, mi := range instrs {
+		sb.WriteString(mi.String())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// ParseMachineLine converts one line of AT&T assembly into a MachineInstr
+func ParseMachineLine(line string) *MachineInstr {
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case trimmed == "":
+		return &MachineInstr{Kind: MBlank}
+	case strings.HasPrefix(trimmed, "#"):
+		return &MachineInstr{Kind: MComment, Op: line}
+	case strings.HasSuffix(trimmed, ":") && !strings.ContainsAny(trimmed, " \t"):
+		return NewLabel(strings.TrimSuffix(trimmed, ":"))
+	case strings.HasPrefix(trimmed, "."):
+		name, args, _ := strings.Cut(trimmed, " ")
+		return NewDirective(name, strings.TrimSpace(args))
+	}
+
+	op, rest, _ := strings.Cut(trimmed, " ")
+	if op == "lock" || op == "rep" {
+		// A prefix, and the instruction it applies to on the same line
+		if mi := ParseMachineLine(rest); mi.Kind == MInstr {
+			mi.Prefix = op
+			return mi
+		}
+	}
+	mi := NewInstr(op)
+	for _, text := range splitOperands(rest) {
+		mi.Operands = append(mi.Operands, parseMachineOperand(text))
+	}
+	return mi
+}
+
+// ParseMachineText converts assembly text into a MachineInstr stream
+func ParseMachineText(text string) []*MachineInstr {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	instrs := make([]*MachineInstr, 0, len(lines))
+	for _, line := range lines {
+		instrs = append(instrs, ParseMachineLine(line))
+	}
+	return instrs
+}
+
+// splitOperands splits on commas that aren't inside parentheses
+func splitOperands(s string) []string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	var parts []string
+	depth := 0
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(s[start:]))
+}
+
+func parseMachineOperand(s string) MachineOperand {
+	var o MachineOperand
+	if strings.HasPrefix(s, "*") {
+		o.Indirect = true
+		s = s[1:]
+	}
+
+	switch {
+	case strings.HasPrefix(s, "%"):
+		o.Kind = MOpReg
+		o.Reg = s[1:]
+	case strings.HasPrefix(s, "$"):
+		o = ImmTextOp(s[1:])
+	case strings.HasSuffix(s, ")") && strings.Contains(s, "("):
+		o.Kind = MOpMem
+		open := strings.Index(s, "(")
+		prefix := s[:open]
+		inner := strings.Split(s[open+1:len(s)-1], ",")
+		o.Reg = strings.TrimPrefix(strings.TrimSpace(inner[0]), "%")
+		if len(inner) > 1 {
+			o.Index = strings.TrimPrefix(strings.TrimSpace(inner[1]), "%")
+			o.Scale = 1
+		}
+		if len(inner) > 2 {
+			o.Scale, _ = strconv.Atoi(strings.TrimSpace(inner[2]))
+		}
+		if prefix != "" {
+			if val, err := strconv.ParseInt(prefix, 0, 64); err == nil {
+				o.Disp = val
+			} else {
+				o.Symbol = prefix
+			}
+		}
+	default:
+		o.Kind = MOpSymbol
+		o.Symbol = s
+	}
+	return o
+}
+
+// machineBuffer collects emitter output as MachineInstrs
+type machineBuffer struct {
+	instrs []*MachineInstr
+}
+
+// Add appends instructions
+func (b *machineBuffer) Add(instrs ...*MachineInstr) {
+	b.instrs = append(b.instrs, instrs...)
+}
+
+func (b *machineBuffer) Instrs() []*MachineInstr {
+	return b.instrs
+}
+
+func (b *machineBuffer) Len() int {
+	return len(b.instrs)
+}
+
+func (b *machineBuffer) String() string {
+	return PrintMachineInstrs(b.instrs)
+}
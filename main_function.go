@@ -0,0 +1,45 @@
+package main
+
+import "strings"
+
+// main
+// Falling off the end of main returns 0, as C has it, rather than whatever
+// was last left in the result register; the selector adds the return.
+// -Wmain (on by default, except with -ffreestanding, where main is an
+// ordinary function) reports a main whose signature isn't one a hosted
+// program may use:
+//
+//	int main(void)
+//	int main(int argc, char **argv)
+//	int main(int argc, char **argv, char **envp)
+//
+// argv may also be written char *argv[], and its chars may be const.
+
+// checkMain reports main's signature if it isn't one of those
+func (tc *TypeChecker) checkMain(node *ASTNode) {
+	tc.currentFunc = ""
+	if tc.normalizeType(node.ReturnType) != "int" {
+		tc.warnf(node, "-Wmain", "return type of 'main' is not 'int'")
+	}
+	params := node.ParamTypes
+	switch len(params) {
+	case 0:
+	case 2, 3:
+		if tc.normalizeType(params[0]) != "int" {
+			tc.warnf(node, "-Wmain", "first argument of 'main' should be 'int'")
+		}
+		if !tc.isStringArray(params[1]) {
+			tc.warnf(node, "-Wmain", "second argument of 'main' should be 'char **'")
+		}
+		if len(params) == 3 && !tc.isStringArray(params[2]) {
+			tc.warnf(node, "-Wmain", "third argument of 'main' should probably be 'char **'")
+		}
+	default:
+		tc.warnf(node, "-Wmain", "'main' takes only zero, two or three arguments")
+	}
+}
+
+// isStringArray reports whether typ is char** (or points to const chars)
+func (tc *TypeChecker) isStringArray(typ string) bool {
+	return strings.ReplaceAll(tc.normalizeType(typ), " ", "") == "char**"
+}
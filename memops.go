@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Block memory operations
+// Struct copies and zero-fills are selected as one OpMemcpy or OpMemset
+// rather than a chain of loads and stores:
+//
+//	memcpy  dst, src, $size   (dst and src hold addresses)
+//	memset  dst, val, $size   (val is the byte to store)
+//
+// lowerMemoryOps runs before register allocation and unrolls the small ones
+// into register-sized moves through temps. The emitter turns the rest into
+// rep movsb / rep stosq. At -O2 explicit memcpy and memset calls with a
+// constant size are selected the same way instead of calling libc.
+
+// memUnrollLimit is the largest block copied or filled with unrolled moves
+const memUnrollLimit = 64
+
+// copyChunkTypes gives ptr loads of each chunk size their width
+var copyChunkTypes = map[int]string{1: "char", 2: "short", 4: "int", 8: ""}
+
+// copyBytes copies size bytes from the address in src to the address in dst
+func (is *InstructionSelector) copyBytes(dst, src *Operand, size int) {
+	is.emit(OpMemcpy, dst, src, &Operand{Type: "imm", Value: fmt.Sprintf("%d", size)})
+}
+
+// fillBytes sets size bytes at the address in dst to the byte val
+func (is *InstructionSelector) fillBytes(dst, val *Operand, size int) {
+	is.emit(OpMemset, dst, val, &Operand{Type: "imm", Value: fmt.Sprintf("%d", size)})
+}
+
+// selectMemCall selects memcpy(dst, src, n) or memset(dst, c, n) with a
+// constant n inline. ok is false if the call doesn't qualify.
+func (is *InstructionSelector) selectMemCall(node *ASTNode) (result *Operand, ok bool, err error) {
+	if is.optLevel < 2 || len(node.Children) != 3 || (node.Name != "memcpy" && node.Name != "memset") {
+		return nil, false, nil
+	}
+	if sig, known := is.functions[node.Name]; !known || !sig.External {
+		// The program's own memcpy
+		return nil, false, nil
+	}
+	sizeNode := node.Children[2]
+	size, convErr := strconv.Atoi(sizeNode.Value)
+	if sizeNode.Type != NodeNumber || convErr != nil || size < 0 {
+		return nil, false, nil
+	}
+	dst, err := is.selectExpression(node.Children[0])
+	if err != nil {
+		return nil, true, err
+	}
+	// Keep the destination in a temp: it's also the call's value
+	addr := is.newTemp()
+	is.emit(OpMov, addr, dst, nil)
+	src, err := is.selectExpression(node.Children[1])
+	if err != nil {
+		return nil, true, err
+	}
+	if node.Name == "memcpy" {
+		srcAddr := is.newTemp()
+		is.emit(OpMov, srcAddr, src, nil)
+		is.copyBytes(addr, srcAddr, size)
+	} else {
+		is.fillBytes(addr, src, size)
+	}
+	return addr, true, nil
+}
+
+// lowerMemoryOps unrolls OpMemcpy and OpMemset of up to memUnrollLimit bytes
+// into loads and stores, leaving larger ones for the emitter
+func (is *InstructionSelector) lowerMemoryOps() {
+	instrs := is.instructions
+	is.instructions = make([]*IRInstruction, 0, len(instrs))
+	for _, instr := range instrs {
+		if instr.Op != OpMemcpy && instr.Op != OpMemset {
+			is.instructions = append(is.instructions, instr)
+			continue
+		}
+		is.line, is.column = instr.Line, instr.Column
+		size, _ := strconv.Atoi(instr.Src2.Value)
+		if size > memUnrollLimit {
+			is.instructions = append(is.instructions, instr)
+			continue
+		}
+		if instr.Op == OpMemcpy {
+			is.unrollCopy(instr.Dst, instr.Src1, size)
+			continue
+		}
+		pattern, ok := bytePattern(instr.Src1)
+		if !ok {
+			// A byte computed at run time; rep stosb takes it as is
+			is.instructions = append(is.instructions, instr)
+			continue
+		}
+		is.unrollFill(instr.Dst, pattern, size)
+	}
+}
+
+// unrollCopy copies size bytes in the widest chunks that fit
+func (is *InstructionSelector) unrollCopy(dst, src *Operand, size int) {
+	for offset := 0; offset < size; {
+		chunk := memChunk(size - offset)
+		data := is.newTemp()
+		is.emit(OpLoad, data, &Operand{Type: "ptr", IndexTemp: is.offsetAddress(src, offset), Size: chunk, DataType: copyChunkTypes[chunk]}, nil)
+		is.emit(OpStore, &Operand{Type: "ptr", IndexTemp: is.offsetAddress(dst, offset), Size: chunk}, data, nil)
+		offset += chunk
+	}
+}
+
+// unrollFill stores pattern, a byte repeated eight times, over size bytes
+func (is *InstructionSelector) unrollFill(dst *Operand, pattern string, size int) {
+	// In a temp, not an immediate: a ptr store of an immediate goes through
+	// %rax, which may hold the address
+	data := is.newTemp()
+	is.emit(OpMov, data, &Operand{Type: "imm", Value: pattern}, nil)
+	for offset := 0; offset < size; {
+		chunk := memChunk(size - offset)
+		is.emit(OpStore, &Operand{Type: "ptr", IndexTemp: is.offsetAddress(dst, offset), Size: chunk}, data, nil)
+		offset += chunk
+	}
+}
+
+// memChunk is the widest power-of-two move of at most remaining bytes
+func memChunk(remaining int) int {
+	chunk := 8
+	for chunk > remaining {
+		chunk /= 2
+	}
+	return chunk
+}
+
+// bytePattern repeats a constant memset byte across a 64-bit word
+func bytePattern(val *Operand) (string, bool) {
+	if val.Type != "imm" {
+		return "", false
+	}
+	b, err := strconv.ParseInt(val.Value, 0, 64)
+	if err != nil {
+		return "", false
+	}
+	return strconv.FormatUint(uint64(b&0xff)*0x0101010101010101, 10), true
+}
+
+// emitMemcpy copies with rep movsb. rdi, rsi and rcx may hold live temps,
+// so they're saved around it; the addresses go through the stack in case
+// they live in those registers.
+func (ce *CodeEmitter) emitMemcpy(instr *IRInstruction) {
+	ce.emit("pushq", RegOp("rdi"))
+	ce.emit("pushq", RegOp("rsi"))
+	ce.emit("pushq", RegOp("rcx"))
+	ce.emit("pushq", ce.operand(instr.Src1))
+	ce.emit("pushq", ce.operand(instr.Dst))
+	ce.emit("popq", RegOp("rdi"))
+	ce.emit("popq", RegOp("rsi"))
+	ce.emit("movq", ImmTextOp(instr.Src2.Value), RegOp("rcx"))
+	ce.emitPrefixed("rep", "movsb")
+	ce.emit("popq", RegOp("rcx"))
+	ce.emit("popq", RegOp("rsi"))
+	ce.emit("popq", RegOp("rdi"))
+}
+
+// emitMemset fills with rep stosq when it can store whole zero quadwords,
+// rep stosb otherwise. rdi, rcx and rax are saved like in emitMemcpy.
+func (ce *CodeEmitter) emitMemset(instr *IRInstruction) {
+	size, _ := strconv.Atoi(instr.Src2.Value)
+	ce.emit("pushq", RegOp("rdi"))
+	ce.emit("pushq", RegOp("rcx"))
+	ce.emit("pushq", RegOp("rax"))
+	ce.emit("pushq", ce.operand(instr.Dst))
+	ce.emit("movq", ce.operand(instr.Src1), RegOp("rax"))
+	ce.emit("popq", RegOp("rdi"))
+	zero := instr.Src1.Type == "imm" && ce.operand(instr.Src1) == ImmOp(0)
+	if zero && size%8 == 0 {
+		ce.emit("movq", ImmOp(int64(size/8)), RegOp("rcx"))
+		ce.emitPrefixed("rep", "stosq")
+	} else {
+		ce.emit("movq", ImmOp(int64(size)), RegOp("rcx"))
+		ce.emitPrefixed("rep", "stosb")
+	}
+	ce.emit("popq", RegOp("rax"))
+	ce.emit("popq", RegOp("rcx"))
+	ce.emit("popq", RegOp("rdi"))
+}
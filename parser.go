@@ -37,6 +37,7 @@ const (
 	NodeAddressOf
 	NodeDereference
 	NodeCompoundLiteral
+	NodeSizeof // sizeof or _Alignof (Operator) of an expression, sized by the type checker
 )
 
 type ASTNode struct {
@@ -53,6 +54,8 @@ type ASTNode struct {
 	Params     []string
 	ParamTypes []string
 	ReturnType string
+	IsVariadic bool // Parameter list ends in ...
+	Attributes []Attribute // __attribute__((...)) the declaration gave (see attributes.go)
 	
 	// For operators
 	Operator string
@@ -74,16 +77,21 @@ type ASTNode struct {
 	// For compound literals
 	InitFields   []string // Field names for designated initializers
 	
-	Line   int
-	Column int
+	Line      int
+	Column    int
+	EndLine   int // A block's closing brace
+	EndColumn int
 }
 
 // StructMember represents a member of a struct
 type StructMember struct {
-	Name   string
-	Type   string
-	Offset int
-	Size   int
+	Name      string
+	Type      string
+	Offset    int
+	Size      int
+	ArraySize int // Element count for array members (Type is the element type)
+	Packed    bool // __attribute__((packed)): no padding before it (see attributes.go)
+	Aligned   int  // __attribute__((aligned(N))): at least this alignment, 0 if not given
 }
 
 // StructDef represents a struct definition
@@ -91,21 +99,34 @@ type StructDef struct {
 	Name    string
 	Members []StructMember
 	Size    int
+	Align   int // Strictest member alignment (0 if unknown, e.g. from headers)
+	Packed  bool // __attribute__((packed)): members unpadded, 1-byte aligned (see attributes.go)
+	Aligned int  // __attribute__((aligned(N))): at least this alignment, 0 if not given
 }
 
 type Parser struct {
 	compiler *Compiler
-	tokens   []Token
+	tokens   *tokenStream // see token_stream.go
 	pos      int
 	structs  map[string]*StructDef // Track struct definitions
 	typedefs map[string]string     // Track typedef aliases: alias -> actual type
+	typedefTypes map[string]*TypedefType // Typedefs of function pointers and arrays (see typedef_types.go)
+	typedefUsed  *TypedefType            // The structured typedef the last parseType resolved, if any
+	typeAttributes []Attribute           // The __attribute__s the last parseType read among its specifiers
 	enums    map[string]int        // Track enum constants: name -> value
 	errors   []error               // Collect all parsing errors
+	target   *TargetSpec           // Scalar sizes and alignments
+	index    []IndexedSymbol       // Declarations seen, for the symbol index (see symbol_index.go)
+	function string                // Function being parsed, for __func__
+	enumMembers map[string][]string // Enumerators of each enum type ("enum Color"), in order
+	arrayDims   map[string][]int    // Dimensions of multi-dimensional globals (see flattenSubscripts)
+	localDims   map[string]map[string][]int // Dimensions of each function's multi-dimensional locals
+	functionPointers map[string]map[string]*TypedefType // Pointer-to-function typedefs of each function's parameters and locals, and of globals (under "")
 }
 
 func NewParser(source string) *Parser {
-	lexer := NewLexer(source)
-	tokens := lexer.AllTokens()
+	// Token streams are cached by content hash (see TokenCache)
+	tokens := defaultTokenCache.Stream(source)
 	
 	// Initialize with common standard library typedefs
 	typedefs := make(map[string]string)
@@ -124,6 +145,12 @@ func NewParser(source string) *Parser {
 	typedefs["ssize_t"] = "long"
 	// stdbool.h
 	typedefs["bool"] = "int"
+	// setjmp.h: jmp_buf is an array, 200 bytes on glibc (see setjmp.go)
+	typedefTypes := make(map[string]*TypedefType)
+	for _, name := range []string{"jmp_buf", "sigjmp_buf"} {
+		typedefTypes[name] = &TypedefType{Base: "long", Dims: []int{jmpBufLongs}}
+		typedefs[name] = typedefTypes[name].Flat()
+	}
 	
 	// Initialize with common standard library constants
 	enums := make(map[string]int)
@@ -140,29 +167,29 @@ func NewParser(source string) *Parser {
 		pos:      0,
 		structs:  make(map[string]*StructDef),
 		typedefs: typedefs,
+		typedefTypes: typedefTypes,
 		enums:    enums,
+		enumMembers: make(map[string][]string),
 		errors:   []error{},
+		target:   defaultTarget,
 	}
 }
 
 func (p *Parser) current() Token {
-	if p.pos >= len(p.tokens) {
-		return p.tokens[len(p.tokens)-1] // EOF
-	}
-	return p.tokens[p.pos]
+	return p.tokens.at(p.pos)
 }
 
 func (p *Parser) peek(offset int) Token {
 	pos := p.pos + offset
-	if pos >= len(p.tokens) {
-		return p.tokens[len(p.tokens)-1]
+	if pos < 0 {
+		return Token{Type: EOF}
 	}
-	return p.tokens[pos]
+	return p.tokens.at(pos)
 }
 
 func (p *Parser) advance() Token {
 	tok := p.current()
-	if p.pos < len(p.tokens)-1 {
+	if tok.Type != EOF {
 		p.pos++
 	}
 	return tok
@@ -189,35 +216,114 @@ func (p *Parser) isAtEnd() bool {
 	return p.current().Type == EOF
 }
 
-// recordError adds an error to the error list
+// maxParseErrors is how many errors are collected before giving up: past
+// the first few, most are fallout from earlier ones
+const maxParseErrors = 50
+
+// recordError adds an error to the error list. Once there are
+// maxParseErrors of them the rest of the input is skipped.
 func (p *Parser) recordError(err error) {
 	if err != nil {
 		p.errors = append(p.errors, err)
+		if len(p.errors) >= maxParseErrors {
+			p.pos = p.tokens.end()
+		}
+	}
+}
+
+// checkProgress guards a loop that hands each iteration to another parse
+// function: if the iteration that began at start consumed nothing, the
+// next one would see the same token, so that token is an error
+func (p *Parser) checkProgress(start int, where string) error {
+	if p.pos != start || p.isAtEnd() {
+		return nil
 	}
+	return fmt.Errorf("unexpected '%s' in %s at line %d", p.current().Lexeme, where, p.current().Line)
 }
 
-// synchronize attempts to recover from a parse error by advancing to the next safe point
+// synchronize recovers from an error in a top-level declaration: it skips
+// to just past the next ';' or brace-enclosed body, whichever ends the
+// declaration, and always consumes at least one token
 func (p *Parser) synchronize() {
-	// Advance past the error
-	p.advance()
-	
-	// Skip tokens until we find a statement boundary
+	start := p.pos
+	depth := 0
 	for !p.isAtEnd() {
-		// Stop at semicolons (end of statement)
-		if p.peek(-1).Type == SEMICOLON {
-			return
+		switch p.current().Type {
+		case LBRACE:
+			depth++
+		case RBRACE:
+			depth--
+			if depth <= 0 {
+				p.advance()
+				if p.match(SEMICOLON) {
+					p.advance()
+				}
+				return
+			}
+		case SEMICOLON:
+			if depth == 0 {
+				p.advance()
+				return
+			}
 		}
-		
-		// Stop at statement keywords
+		p.advance()
+	}
+	if p.pos == start {
+		p.advance()
+	}
+}
+
+// skipStatement recovers from an error in a statement: it skips to just
+// past the next ';' or brace-enclosed block, stopping before the '}' that
+// closes the enclosing block
+func (p *Parser) skipStatement() {
+	depth := 0
+	for !p.isAtEnd() {
 		switch p.current().Type {
-		case IF, WHILE, FOR, RETURN, INT, VOID, CHAR_KW, FLOAT, DOUBLE, STRUCT, TYPEDEF:
-			return
+		case LBRACE:
+			depth++
+		case RBRACE:
+			if depth == 0 {
+				return
+			}
+			depth--
+			if depth == 0 {
+				p.advance()
+				return
+			}
+		case SEMICOLON:
+			if depth == 0 {
+				p.advance()
+				return
+			}
 		}
-		
 		p.advance()
 	}
 }
 
+// parseStatementsUntil parses statements until one of the closing tokens
+// (or EOF). A statement with an error is recorded and skipped, so the rest
+// of the block still gets checked.
+func (p *Parser) parseStatementsUntil(where string, closing ...TokenType) []*ASTNode {
+	stmts := []*ASTNode{}
+	for !p.match(closing...) && !p.isAtEnd() {
+		start := p.pos
+		stmt, err := p.parseStatement()
+		if err == nil {
+			err = p.checkProgress(start, where)
+		}
+		if err != nil {
+			p.recordError(fmt.Errorf("line %d: %w", p.current().Line, err))
+			p.skipStatement()
+			continue
+		}
+		if stmt != nil {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
+
 // resolveTypedef resolves a type through typedef aliases
 func (p *Parser) resolveTypedef(typ string) string {
 	if resolvedType, ok := p.typedefs[typ]; ok {
@@ -235,43 +341,18 @@ func (p *Parser) isTypeName() bool {
 	return isTypedef
 }
 
-// getTypeSize returns the size in bytes of a type
-func (p *Parser) getTypeSize(typ string) int {
-	// Remove const/static modifiers
-	typ = stripQualifiers(typ)
-	
-	// Pointers are 8 bytes
-	if len(typ) > 0 && typ[len(typ)-1] == '*' {
-		return 8
-	}
-	
-	// Check for struct types
-	if len(typ) > 7 && typ[:7] == "struct " {
-		structName := typ[7:]
-		if structDef, ok := p.structs[structName]; ok {
-			return structDef.Size
-		}
-		return 8 // Default struct size
-	}
-	
-	// Basic types
-	switch typ {
-	case "int", "float":
-		return 4
-	case "long", "double":
-		return 8
-	case "char":
-		return 1
-	case "void":
-		return 0
-	default:
-		return 4 // Default
-	}
+// types sizes types by the structs and typedefs parsed so far
+func (p *Parser) types() *TypeInfo {
+	return &TypeInfo{target: p.target, structs: p.structs, typedefs: p.typedefs, derived: p.typedefTypes}
 }
 
 func stripQualifiers(typ string) string {
-	typ = trimPrefix(typ, "const ")
 	typ = trimPrefix(typ, "static ")
+	typ = trimPrefix(typ, "__thread ")
+	typ = trimPrefix(typ, "const ")
+	typ = trimPrefix(typ, "volatile ")
+	typ = strings.TrimSuffix(typ, " const")
+	typ = strings.TrimSuffix(typ, " volatile")
 	return typ
 }
 
@@ -289,55 +370,70 @@ func (p *Parser) Parse() (*ASTNode, error) {
 		Children: []*ASTNode{},
 	}
 	
-	iterCount := 0
-	maxIter := 10000000  // 10 million - much higher limit
+	// Characters the lexer rejected would only produce confusing parse errors
+	for _, tok := range p.tokens.illegal() {
+		p.recordError(illegalTokenError(tok))
+	}
+	if len(p.errors) > 0 {
+		return program, p.errorSummary()
+	}
 	
 	for p.current().Type != EOF {
-		iterCount++
-		if iterCount > maxIter {
-			err := fmt.Errorf("parser appears to be stuck in infinite loop at position %d, token: %s (line %d)", p.pos, p.current().Lexeme, p.current().Line)
-			p.recordError(err)
-			break
-		}
-		
 		// Skip preprocessor
 		if p.match(HASH) {
 			p.skipPreprocessor()
 			continue
 		}
 		
+		start := p.pos
 		node, err := p.parseTopLevel()
+		if err == nil {
+			err = p.checkProgress(start, "declaration")
+		}
 		if err != nil {
 			p.recordError(fmt.Errorf("line %d: %w", p.current().Line, err))
 			// Try to recover and continue parsing
 			p.synchronize()
+			p.tokens.release(p.pos)
 			continue
 		}
 		
 		if node != nil {
 			program.Children = append(program.Children, node)
 		}
+		// Nothing looks back past a finished declaration
+		p.tokens.release(p.pos)
 	}
 	
 	// If we collected any errors, report them all
 	if len(p.errors) > 0 {
-		var errMsg strings.Builder
-		errMsg.WriteString(fmt.Sprintf("encountered %d parsing error(s):\n", len(p.errors)))
-		for i, err := range p.errors {
-			errMsg.WriteString(fmt.Sprintf("  [%d] %v\n", i+1, err))
-			if i >= 9 {  // Limit to first 10 errors
-				errMsg.WriteString(fmt.Sprintf("  ... and %d more errors\n", len(p.errors)-10))
-				break
-			}
-		}
-		return program, fmt.Errorf("%s", errMsg.String())
+		return program, p.errorSummary()
 	}
+	flattenSubscripts(program, p.arrayDims, p.localDims)
 	
 	return program, nil
 }
 
+// errorSummary combines the collected errors into one, listing the first ten
+func (p *Parser) errorSummary() error {
+	var errMsg strings.Builder
+	errMsg.WriteString(fmt.Sprintf("encountered %d parsing error(s):\n", len(p.errors)))
+	for i, err := range p.errors {
+		errMsg.WriteString(fmt.Sprintf("  [%d] %v\n", i+1, err))
+		if i >= 9 {  // Limit to first 10 errors
+			errMsg.WriteString(fmt.Sprintf("  ... and %d more errors\n", len(p.errors)-10))
+			break
+		}
+	}
+	return fmt.Errorf("%s", errMsg.String())
+}
+
+// skipPreprocessor skips a directive left in the token stream: the '#' and
+// whatever follows it on the same line
 func (p *Parser) skipPreprocessor() {
-	for p.current().Type != EOF && p.current().Line == p.peek(1).Line {
+	line := p.current().Line
+	p.advance() // skip #
+	for p.current().Type != EOF && p.current().Line == line {
 		p.advance()
 	}
 }
@@ -355,19 +451,26 @@ func (p *Parser) parseTopLevel() (*ASTNode, error) {
 		
 		// typedef struct { ... } Name; or typedef struct Name Name;
 		if p.match(STRUCT, UNION) {
+			union := p.match(UNION)
 			p.advance()
+			attrs := p.parseAttributes()
 			
 			var structName string
 			var aliasName string
 			
 			// Check if struct has a name
+			var nameTok Token
 			if p.match(IDENTIFIER) {
-				structName = p.current().Lexeme
+				nameTok = p.current()
+				structName = nameTok.Lexeme
 				p.advance()
 			}
 			
 			// If there's a body, parse it properly
 			if p.match(LBRACE) {
+				if structName != "" {
+					p.indexSymbol(SymbolStruct, structName, "struct "+structName, nameTok, true)
+				}
 				// Create temporary struct name if none given
 				if structName == "" {
 					structName = "__anon_typedef_" + fmt.Sprintf("%d", p.pos)
@@ -377,10 +480,11 @@ func (p *Parser) parseTopLevel() (*ASTNode, error) {
 				p.advance() // skip {
 				
 				members := []StructMember{}
-				offset := 0
 				
 				for !p.match(RBRACE) && !p.match(EOF) {
 					memberType := p.parseType()
+					typeAttrs := p.typeAttributes
+					elements := p.typedefElements()
 					
 					// Parse member name(s) - can have multiple per line like: int r, g, b, a;
 					for {
@@ -390,40 +494,37 @@ func (p *Parser) parseTopLevel() (*ASTNode, error) {
 						memberName := p.current().Lexeme
 						p.advance()
 						
-						memberSize := p.getTypeSize(memberType)
-					
-					// Calculate alignment for this member
-					alignment := memberSize
-					if alignment > 8 {
-						alignment = 8  // Max alignment is 8 bytes
-					}
-					
-					// Add padding to align offset
-					if offset%alignment != 0 {
-						offset += alignment - (offset % alignment)
-					}
+						memberSize := p.types().SizeOf(memberType)
 						
 						// Handle arrays: int arr[10];
+						arraySize := 0
 						if p.match(LBRACKET) {
 							p.advance()
-							if p.match(NUMBER) {
-								sizeVal, _ := strconv.Atoi(p.current().Lexeme)
-								memberSize = sizeVal * memberSize
-								p.advance()
+							sizeVal, err := p.parseArrayDimension()
+							if err != nil {
+								return nil, err
 							}
+							memberSize = sizeVal * memberSize
+							arraySize = sizeVal
 							if !p.match(RBRACKET) {
 								return nil, fmt.Errorf("expected ]")
 							}
 							p.advance()
 						}
+						if elements > 0 {
+							memberSize *= elements
+							arraySize = max(arraySize, 1) * elements
+						}
 						
-						members = append(members, StructMember{
-							Name:   memberName,
-							Type:   memberType,
-							Offset: offset,
-							Size:   memberSize,
-						})
-						offset += memberSize
+						member := StructMember{
+							Name:      memberName,
+							Type:      memberType,
+							Size:      memberSize,
+							ArraySize: arraySize,
+						}
+						member.applyAttributes(typeAttrs)
+						member.applyAttributes(p.parseAttributes())
+						members = append(members, member)
 						
 						// Continue if we see a comma (multiple declarators on same line)
 						if p.match(COMMA) {
@@ -446,35 +547,19 @@ func (p *Parser) parseTopLevel() (*ASTNode, error) {
 				}
 				p.advance()
 				
-				// Calculate struct's alignment (max of all member alignments, capped at 8)
-				structAlignment := 1
-				for _, member := range members {
-					memberAlign := member.Size
-					if memberAlign > 8 {
-						memberAlign = 8
-					}
-					if memberAlign > structAlignment {
-						structAlignment = memberAlign
-					}
-				}
-				
-				// Add padding at end to make struct size a multiple of its alignment
-				if offset%structAlignment != 0 {
-					offset += structAlignment - (offset % structAlignment)
-				}
-				
 				// Store the struct definition
-				p.structs[structName] = &StructDef{
-					Name:    structName,
-					Members: members,
-					Size:    offset,
-				}
+				def := &StructDef{Name: structName, Members: members}
+				def.applyAttributes(append(attrs, p.parseAttributes()...))
+				p.types().Layout(def, union)
+				p.structs[structName] = def
 			}
 			
 			// Get the typedef alias name
 			if p.match(IDENTIFIER) {
 				aliasName = p.current().Lexeme
+				p.indexSymbol(SymbolTypedef, aliasName, "struct "+structName, p.current(), true)
 				p.advance()
+				p.parseAttributes()
 			}
 			
 			// Register the typedef
@@ -490,10 +575,29 @@ func (p *Parser) parseTopLevel() (*ASTNode, error) {
 		
 		// typedef existing_type new_name;
 		existingType := p.parseType()
+		inner := p.typedefUsed
+		if p.match(LPAREN) && p.peek(1).Type == STAR {
+			// typedef R (*Name)(params);
+			return nil, p.parseFunctionPointerTypedef(existingType)
+		}
 		if p.match(IDENTIFIER) {
-			aliasName := p.current().Lexeme
+			aliasTok := p.current()
 			p.advance()
-			p.typedefs[aliasName] = existingType
+			// typedef T Name[N]...;
+			array, err := p.parseArrayTypedef(existingType, inner)
+			if err != nil {
+				return nil, err
+			}
+			p.parseAttributes()
+			switch {
+			case array != nil:
+				p.defineTypedef(aliasTok, array)
+			case inner != nil:
+				p.defineTypedef(aliasTok, inner)
+			default:
+				p.indexSymbol(SymbolTypedef, aliasTok.Lexeme, existingType, aliasTok, true)
+				p.typedefs[aliasTok.Lexeme] = existingType
+			}
 		}
 		
 		if p.match(SEMICOLON) {
@@ -502,12 +606,23 @@ func (p *Parser) parseTopLevel() (*ASTNode, error) {
 		return nil, nil
 	}
 	
-	// Skip struct/union/typedef/enum - parse struct/union definitions
-	if p.match(STRUCT, UNION) {
-		err := p.parseStructDef()
+	// Struct/union definitions, which may declare a global too. A tag that
+	// isn't defined or declared here is a type, of a global or a function.
+	if p.match(STRUCT, UNION) && (p.peek(1).Type != IDENTIFIER || p.peek(2).Type == LBRACE || p.peek(2).Type == SEMICOLON || isAttributeKeyword(p.peek(1).Lexeme)) {
+		typ, err := p.parseStructDef()
 		if err != nil {
 			return nil, err
 		}
+		if p.match(IDENTIFIER) {
+			// struct S { ... } s;
+			nameTok := p.current()
+			p.advance()
+			p.indexSymbol(SymbolGlobal, nameTok.Lexeme, typ, nameTok, true)
+			return p.parseGlobalVar(nameTok.Lexeme, typ)
+		}
+		if p.match(SEMICOLON) {
+			p.advance()
+		}
 		return nil, nil
 	}
 	
@@ -518,7 +633,7 @@ func (p *Parser) parseTopLevel() (*ASTNode, error) {
 		// Check if it's a struct/union typedef
 		if p.match(STRUCT) {
 			// Parse the struct definition
-			err := p.parseStructDef()
+			_, err := p.parseStructDef()
 			if err != nil {
 				return nil, err
 			}
@@ -540,40 +655,78 @@ func (p *Parser) parseTopLevel() (*ASTNode, error) {
 		}
 	}
 	
-	if p.match(ENUM) {
-		err := p.parseEnumDef()
-		if err != nil {
-			return nil, err
-		}
-		return nil, nil
-	}
-	
-	// Parse type
+	// Parse type, and any attributes among its specifiers
 	dataType := p.parseType()
+	attrs := p.typeAttributes
 	
 	// Get identifier
+	if p.match(LPAREN) {
+		// int (*p)[3], int (*fp)(int): only typedefs take these
+		return nil, fmt.Errorf("parenthesized declarator of a global is not supported at line %d", p.current().Line)
+	}
 	if !p.match(IDENTIFIER) {
 		p.advance()
 		return nil, nil
 	}
 	
-	name := p.current().Lexeme
+	nameTok := p.current()
+	name := nameTok.Lexeme
 	p.advance()
 	
 	// Function or variable?
 	if p.match(LPAREN) {
-		return p.parseFunction(name, dataType)
+		// Functions are external whether or not they say so
+		fn, err := p.parseFunction(name, strings.TrimPrefix(dataType, "extern "))
+		if fn != nil {
+			fn.Line, fn.Column = nameTok.Line, nameTok.Column
+			fn.Attributes = append(attrs, fn.Attributes...)
+			p.indexSymbol(SymbolFunction, name, fn.ReturnType, nameTok, fn.Children != nil)
+		}
+		return fn, err
 	} else {
-		return p.parseGlobalVar(name, dataType)
+		p.indexSymbol(SymbolGlobal, name, strings.TrimPrefix(dataType, "extern "), nameTok, !strings.HasPrefix(dataType, "extern "))
+		global, err := p.parseGlobalVar(name, dataType)
+		if global != nil {
+			global.Attributes = append(attrs, global.Attributes...)
+		}
+		return global, err
 	}
 }
 
+// parseType parses a type specifier. Qualifiers are normalized so constness
+// survives in the type string: "const T" for a const object or pointee
+// (const int, const char*), and a trailing " const" for a const pointer
+// (char* const). See const.go. volatile is kept the same way, inside const:
+// "const volatile int", "char* volatile const" (see volatile.go).
 func (p *Parser) parseType() string {
 	typ := ""
-	
-	// Storage class
-	if p.match(STATIC, CONST) {
-		typ += p.current().Lexeme + " "
+	var used *TypedefType
+	
+	// Storage class, qualifiers and attributes, in any order
+	isStatic, isExtern, isThread, isConst, isVolatile := false, false, false, false, false
+	var attrs []Attribute
+	for p.match(STATIC, EXTERN, THREAD, CONST, VOLATILE) || p.atAttribute() || p.atNoreturn() {
+		if p.atAttribute() {
+			attrs = append(attrs, p.parseAttributes()...)
+			continue
+		}
+		if p.atNoreturn() {
+			attrs = append(attrs, Attribute{Name: "noreturn"})
+			p.advance()
+			continue
+		}
+		switch p.current().Type {
+		case STATIC:
+			isStatic = true
+		case EXTERN:
+			isExtern = true
+		case THREAD:
+			isThread = true
+		case VOLATILE:
+			isVolatile = true
+		default:
+			isConst = true
+		}
 		p.advance()
 	}
 	
@@ -587,9 +740,12 @@ func (p *Parser) parseType() string {
 	if p.match(INT, VOID, CHAR_KW, FLOAT, DOUBLE) {
 		typ += p.current().Lexeme
 		p.advance()
+	} else if p.match(ENUM) {
+		typ += p.parseEnumType()
 	} else if p.match(STRUCT, UNION) {
 		structOrUnion := p.current().Lexeme  // "struct" or "union"
 		p.advance()
+		structAttrs := p.parseAttributes()
 		if p.match(IDENTIFIER) {
 			typ = structOrUnion + " " + p.current().Lexeme
 			p.advance()
@@ -603,10 +759,10 @@ func (p *Parser) parseType() string {
 			p.advance() // skip {
 			
 			var members []StructMember
-			offset := 0
 			for !p.match(RBRACE) && !p.match(EOF) {
 				// Parse field type
 				fieldType := p.parseType()
+				fieldAttrs := p.typeAttributes
 				
 				// Parse field name
 				if !p.match(IDENTIFIER) {
@@ -617,22 +773,13 @@ func (p *Parser) parseType() string {
 				fieldName := p.current().Lexeme
 				p.advance()
 				
-				// Calculate size (simplified - just use 8 bytes for everything)
-				fieldSize := 8
-				
-				members = append(members, StructMember{
-					Name:   fieldName,
-					Type:   fieldType,
-					Offset: offset,
-					Size:   fieldSize,
-				})
-				
-				// For unions, all members are at offset 0
-				if structOrUnion == "union" {
-					offset = 0
-				} else {
-					offset += fieldSize
+				member := StructMember{
+					Name: fieldName,
+					Type: fieldType,
 				}
+				member.applyAttributes(fieldAttrs)
+				member.applyAttributes(p.parseAttributes())
+				members = append(members, member)
 				
 				// Expect semicolon
 				if !p.match(SEMICOLON) {
@@ -656,11 +803,10 @@ func (p *Parser) parseType() string {
 			}
 			
 			// Register the anonymous struct/union
-			p.structs[anonName] = &StructDef{
-				Name:    anonName,
-				Members: members,
-				Size:    offset,
-			}
+			def := &StructDef{Name: anonName, Members: members}
+			def.applyAttributes(append(structAttrs, p.parseAttributes()...))
+			p.types().Layout(def, structOrUnion == "union")
+			p.structs[anonName] = def
 		}
 	} else if p.match(IDENTIFIER) {
 		// Check if this could be a typedef name
@@ -671,6 +817,7 @@ func (p *Parser) parseType() string {
 		if resolvedType != typeName {
 			p.advance()
 			typ += resolvedType
+			used = p.typedefTypes[typeName]
 		} else if typ == "" {
 			// No modifiers yet - treat as type name (typedef or unknown type)
 			p.advance()
@@ -680,11 +827,37 @@ func (p *Parser) parseType() string {
 		// don't consume it - it's likely the variable name, not a type
 	}
 	
-	// Pointers
+	// Qualifiers after the base type: char const *
+	for p.match(CONST, VOLATILE) || p.atAttribute() {
+		if p.atAttribute() {
+			attrs = append(attrs, p.parseAttributes()...)
+			continue
+		}
+		if p.current().Type == VOLATILE {
+			isVolatile = true
+		} else {
+			isConst = true
+		}
+		p.advance()
+	}
+	
+	// Pointers, each optionally qualified itself: char *const p
+	pointerConst, pointerVolatile := false, false
 	for p.match(STAR) {
 		typ += "*"
 		p.advance()
+		pointerConst, pointerVolatile = false, false
+		used = nil // A pointer to the typedef's type, not the typedef's
+		for p.match(CONST, VOLATILE) {
+			if p.current().Type == VOLATILE {
+				pointerVolatile = true
+			} else {
+				pointerConst = true
+			}
+			p.advance()
+		}
 	}
+	attrs = append(attrs, p.parseAttributes()...)
 	
 	// If we have modifiers but no base type, default to int
 	// (e.g., "long" means "long int", "unsigned" means "unsigned int")
@@ -698,29 +871,65 @@ func (p *Parser) parseType() string {
 		typ = "int"
 	}
 	
+	if isVolatile && !strings.HasPrefix(typ, "volatile ") {
+		typ = "volatile " + typ
+	}
+	if isConst && !strings.HasPrefix(typ, "const ") {
+		typ = "const " + typ
+	}
+	if isThread {
+		typ = "__thread " + typ
+	}
+	if isStatic {
+		typ = "static " + typ
+	}
+	if isExtern {
+		typ = "extern " + typ
+	}
+	if pointerVolatile {
+		typ += " volatile"
+	}
+	if pointerConst {
+		typ += " const"
+	}
+	p.typedefUsed = used
+	p.typeAttributes = attrs
 	return typ
 }
 
-func (p *Parser) parseStructDef() error {
-	p.advance() // skip 'struct'
+// parseStructDef parses a struct or union specifier at the top level,
+// recording its definition, and returns its type ("struct Name"). What
+// follows it (a declarator, or the ';') is left to the caller.
+func (p *Parser) parseStructDef() (string, error) {
+	union := p.match(UNION)
+	p.advance() // skip 'struct' or 'union'
+	attrs := p.parseAttributes()
 	
 	// Get struct name (optional for anonymous structs in typedefs)
 	var structName string
+	var nameTok Token
 	if p.match(IDENTIFIER) {
-		structName = p.current().Lexeme
+		nameTok = p.current()
+		structName = nameTok.Lexeme
 		p.advance()
 	}
 	
 	// Check for just declaration (struct Foo;) or definition
+	keyword := "struct "
+	if union {
+		keyword = "union "
+	}
 	if p.match(SEMICOLON) {
-		p.advance()
-		return nil // Forward declaration, ignore
+		return keyword + structName, nil // Forward declaration, ignore
 	}
 	
 	if !p.match(LBRACE) {
 		// It's a variable declaration using the struct, skip for now
 		p.skipStructOrTypedef()
-		return nil
+		return "", nil
+	}
+	if structName != "" {
+		p.indexSymbol(SymbolStruct, structName, "struct "+structName, nameTok, true)
 	}
 	
 	// Anonymous struct - generate a name
@@ -731,58 +940,55 @@ func (p *Parser) parseStructDef() error {
 	p.advance() // skip {
 	
 	members := []StructMember{}
-	currentOffset := 0
 	
 	// Parse members
 	for !p.match(RBRACE) && !p.match(EOF) {
 		// Parse member type
 		memberType := p.parseType()
+		typeAttrs := p.typeAttributes
+		elements := p.typedefElements()
 		
 		// Parse member name(s) - can have multiple per line
 		for {
 			if !p.match(IDENTIFIER) {
-				return fmt.Errorf("expected member name in struct")
+				return "", fmt.Errorf("expected member name in struct")
 			}
 			
 			memberName := p.current().Lexeme
 			p.advance()
 			
 			// Calculate actual member size based on type
-			memberSize := p.getTypeSize(memberType)
-			
-			// Calculate alignment for this member
-			alignment := memberSize
-			if alignment > 8 {
-				alignment = 8  // Max alignment is 8 bytes
-			}
-			
-			// Add padding to align currentOffset
-			if currentOffset%alignment != 0 {
-				currentOffset += alignment - (currentOffset % alignment)
-			}
+			memberSize := p.types().SizeOf(memberType)
 			
 			// Handle arrays: int arr[10];
+			arraySize := 0
 			if p.match(LBRACKET) {
 				p.advance()
-				if p.match(NUMBER) {
-					sizeVal, _ := strconv.Atoi(p.current().Lexeme)
-					memberSize = sizeVal * memberSize
-					p.advance()
+				sizeVal, err := p.parseArrayDimension()
+				if err != nil {
+					return "", err
 				}
+				memberSize = sizeVal * memberSize
+				arraySize = sizeVal
 				if !p.match(RBRACKET) {
-					return fmt.Errorf("expected ]")
+					return "", fmt.Errorf("expected ]")
 				}
 				p.advance()
 			}
+			if elements > 0 {
+				memberSize *= elements
+				arraySize = max(arraySize, 1) * elements
+			}
 			
-			members = append(members, StructMember{
-				Name:   memberName,
-				Type:   memberType,
-				Offset: currentOffset,
-				Size:   memberSize,
-			})
-			
-			currentOffset += memberSize
+			member := StructMember{
+				Name:      memberName,
+				Type:      memberType,
+				Size:      memberSize,
+				ArraySize: arraySize,
+			}
+			member.applyAttributes(typeAttrs)
+			member.applyAttributes(p.parseAttributes())
+			members = append(members, member)
 			
 			if p.match(COMMA) {
 				p.advance()
@@ -792,69 +998,51 @@ func (p *Parser) parseStructDef() error {
 		}
 		
 		if !p.match(SEMICOLON) {
-			return fmt.Errorf("expected ; after struct member")
+			return "", fmt.Errorf("expected ; after struct member")
 		}
 		p.advance()
 	}
 	
 	if !p.match(RBRACE) {
-		return fmt.Errorf("expected } at end of struct")
+		return "", fmt.Errorf("expected } at end of struct")
 	}
 	p.advance()
 	
-	// Optional variable name and semicolon
-	if p.match(IDENTIFIER) {
-		p.advance()
-	}
-	if p.match(SEMICOLON) {
-		p.advance()
-	}
-	
-	// Calculate struct's alignment (max of all member alignments, capped at 8)
-	structAlignment := 1
-	for _, member := range members {
-		memberAlign := member.Size
-		if memberAlign > 8 {
-			memberAlign = 8
-		}
-		if memberAlign > structAlignment {
-			structAlignment = memberAlign
-		}
-	}
-	
-	// Add padding at end to make struct size a multiple of its alignment
-	if currentOffset%structAlignment != 0 {
-		currentOffset += structAlignment - (currentOffset % structAlignment)
-	}
-	
 	// Store struct definition
-	p.structs[structName] = &StructDef{
-		Name:    structName,
-		Members: members,
-		Size:    currentOffset,
-	}
+	def := &StructDef{Name: structName, Members: members}
+	def.applyAttributes(append(attrs, p.parseAttributes()...))
+	p.types().Layout(def, union)
+	p.structs[structName] = def
 	
-	return nil
+	return keyword + structName, nil
 }
 
-func (p *Parser) parseEnumDef() error {
+// parseEnumType parses an enum specifier (enum Tag, enum { ... } or
+// enum Tag { ... }), records its constants, and returns the type it stands
+// for: "enum Tag", registered as an alias of int since enums are int-width
+// integers.
+func (p *Parser) parseEnumType() string {
 	p.advance() // skip 'enum'
 	
-	// Optional enum name
+	// Optional enum name. The type is "enum Name", which resolves to int;
+	// an anonymous enum gets a made-up name.
+	var nameTok Token
+	typ := fmt.Sprintf("enum __anon_enum_%d", p.pos)
 	if p.match(IDENTIFIER) {
-		_ = p.current().Lexeme // enumName not used yet
+		nameTok = p.current()
+		typ = "enum " + nameTok.Lexeme
 		p.advance()
 	}
-	
-	// Check for just declaration (enum Foo;)
-	if p.match(SEMICOLON) {
-		p.advance()
-		return nil // Forward declaration, ignore
-	}
+	p.typedefs[typ] = "int"
 	
 	if !p.match(LBRACE) {
-		return fmt.Errorf("expected { or ; after enum name")
+		// Reference to the tag, or a forward declaration (enum Foo;)
+		return typ
+	}
+	if nameTok.Lexeme != "" {
+		p.indexSymbol(SymbolEnum, nameTok.Lexeme, typ, nameTok, true)
 	}
+	var members []string
 	p.advance() // skip {
 	
 	// Parse enum values
@@ -866,29 +1054,28 @@ func (p *Parser) parseEnumDef() error {
 		}
 		
 		constName := p.current().Lexeme
+		p.indexSymbol(SymbolEnumConstant, constName, "int", p.current(), true)
 		p.advance()
 		
 		// Check for explicit value
 		if p.match(ASSIGN) {
 			p.advance()
 			
-			// Parse the value - for simplicity, only handle number literals
-			if p.match(NUMBER) {
-				value, err := strconv.Atoi(p.current().Lexeme)
-				if err == nil {
-					currentValue = value
-				}
-				p.advance()
-			} else {
-				// Skip complex expressions
+			line := p.current().Line
+			value, err := p.parseConstantExpression()
+			if err != nil {
+				p.recordError(fmt.Errorf("line %d: enumerator value for '%s' is not an integer constant: %w", line, constName, err))
 				for !p.match(COMMA, RBRACE, EOF) {
 					p.advance()
 				}
+			} else {
+				currentValue = value
 			}
 		}
 		
 		// Store enum constant
 		p.enums[constName] = currentValue
+		members = append(members, constName)
 		currentValue++
 		
 		// Optional comma
@@ -897,20 +1084,11 @@ func (p *Parser) parseEnumDef() error {
 		}
 	}
 	
-	if !p.match(RBRACE) {
-		return fmt.Errorf("expected } at end of enum")
-	}
-	p.advance()
-	
-	// Optional variable name and semicolon
-	if p.match(IDENTIFIER) {
-		p.advance()
-	}
-	if p.match(SEMICOLON) {
+	if p.match(RBRACE) {
 		p.advance()
 	}
-	
-	return nil
+	p.enumMembers[typ] = members
+	return typ
 }
 
 func (p *Parser) skipStructOrTypedef() {
@@ -940,6 +1118,9 @@ func (p *Parser) parseFunction(name string, returnType string) (*ASTNode, error)
 	
 	params := []string{}
 	paramTypes := []string{}
+	variadic := false
+	emptyList := p.match(RPAREN) // f(), as opposed to f(void)
+	delete(p.functionPointers, name) // a prototype's parameters may be named differently
 	
 	for !p.match(RPAREN) && !p.match(EOF) {
 		if p.match(VOID) && p.peek(1).Type == RPAREN {
@@ -947,15 +1128,26 @@ func (p *Parser) parseFunction(name string, returnType string) (*ASTNode, error)
 			break
 		}
 		
+		start := p.pos
 		paramType := p.parseType()
+		if p.typedefElements() > 0 {
+			// An array parameter is a pointer to its elements
+			paramType += "*"
+		}
 		paramTypes = append(paramTypes, paramType)
 		
 		if p.match(IDENTIFIER) {
 			params = append(params, p.current().Lexeme)
+			p.noteFunctionPointer(name, p.current().Lexeme)
 			p.advance()
 		}
+		p.parseAttributes()
 		
-		// Skip array brackets
+		// Skip array brackets. An array parameter is a pointer to its
+		// elements (only the first dimension; the rest aren't tracked).
+		if p.match(LBRACKET) {
+			paramTypes[len(paramTypes)-1] += "*"
+		}
 		for p.match(LBRACKET) {
 			p.advance()
 			for !p.match(RBRACKET) && !p.match(EOF) {
@@ -973,21 +1165,26 @@ func (p *Parser) parseFunction(name string, returnType string) (*ASTNode, error)
 				p.advance() // skip first .
 				p.advance() // skip second .
 				p.advance() // skip third .
-				// Variadic function - just continue to closing paren
+				variadic = true
 			}
 		}
+		if err := p.checkProgress(start, fmt.Sprintf("parameter list of '%s'", name)); err != nil {
+			return nil, err
+		}
 	}
 	
 	if p.match(RPAREN) {
 		p.advance()
 	}
 	
-	// Skip GCC attributes like __THROW, __wur, __attribute__((...)...)
+	// GCC attributes, and macros like __THROW and __wur, which are skipped
+	var attrs []Attribute
 	for p.match(IDENTIFIER) {
 		lexeme := p.current().Lexeme
 		
-		// Skip anything starting with __ (GCC attributes)
-		if len(lexeme) >= 2 && lexeme[0] == '_' && lexeme[1] == '_' {
+		if isAttributeKeyword(lexeme) {
+			attrs = append(attrs, p.parseAttributes()...)
+		} else if len(lexeme) >= 2 && lexeme[0] == '_' && lexeme[1] == '_' {
 			p.advance()
 			
 			// If followed by (, skip the whole thing
@@ -1015,20 +1212,26 @@ func (p *Parser) parseFunction(name string, returnType string) (*ASTNode, error)
 	// Declaration only (external function)?
 	if p.match(SEMICOLON) {
 		p.advance()
-		// Return a function node marked as external
+		// Return a function node marked as external. A declaration with
+		// an empty list says nothing about the parameters, so any
+		// arguments are accepted, as for a variadic function.
 		return &ASTNode{
 			Type:       NodeFunction,
 			Name:       name,
 			ReturnType: returnType,
 			Params:     params,
 			ParamTypes: paramTypes,
+			IsVariadic: variadic || emptyList,
+			Attributes: attrs,
 			IsGlobal:   true,  // Mark as external
 			Children:   nil,   // No body
 		}, nil
 	}
 	
 	// Parse body
+	p.function = name
 	body, err := p.parseBlock()
+	p.function = ""
 	if err != nil {
 		return nil, fmt.Errorf("error parsing function '%s' body: %w (at token '%s', line %d)", name, err, p.current().Lexeme, p.current().Line)
 	}
@@ -1039,26 +1242,248 @@ func (p *Parser) parseFunction(name string, returnType string) (*ASTNode, error)
 		ReturnType: returnType,
 		Params:     params,
 		ParamTypes: paramTypes,
+		IsVariadic: variadic,
+		Attributes: attrs,
 		Children:   []*ASTNode{body},
 	}, nil
 }
 
 func (p *Parser) parseGlobalVar(name string, dataType string) (*ASTNode, error) {
-	// Skip initializers and array dims for now
-	for !p.match(SEMICOLON) && !p.match(EOF) {
+	elements, typedefDims := p.typedefElements(), p.typedefDims()
+	p.noteFunctionPointer("", name)
+	node := &ASTNode{
+		Type:     NodeVarDecl,
+		VarName:  name,
+		DataType: dataType,
+		IsGlobal: true,
+		Line:     p.current().Line,
+		Column:   p.current().Column,
+	}
+	
+	// Array dimensions: int board[64], long totals[3][4] (flattened, like
+	// an array typedef's elements)
+	arraySize := -1
+	var dims []int
+	for p.match(LBRACKET) {
+		p.advance()
+		size, err := p.parseArrayDimension()
+		if err != nil {
+			return nil, err
+		}
+		if !p.match(RBRACKET) {
+			return nil, fmt.Errorf("expected ']' at line %d", p.current().Line)
+		}
 		p.advance()
+		dims = append(dims, size)
+		arraySize = max(arraySize, 1) * size
+		node.ArraySize = arraySize
+	}
+	// Matrix grid, for typedef int Matrix[4][4], is an int[4][4] too
+	dims = append(dims, typedefDims...)
+	if len(dims) > 1 {
+		if p.arrayDims == nil {
+			p.arrayDims = make(map[string][]int)
+		}
+		p.arrayDims[name] = dims
+	}
+	if elements > 0 {
+		arraySize = max(arraySize, 1) * elements
+		node.ArraySize = arraySize
+	}
+	node.Attributes = p.parseAttributes()
+	
+	// An initializer: brace initializers are laid out as the global's data
+	// (see global_data.go), and an unsized array takes its length from one
+	if p.match(ASSIGN) {
+		p.advance()
+		if p.match(LBRACE) {
+			init, err := p.parseCompoundLiteral(dataType, arraySize)
+			if err != nil {
+				return nil, err
+			}
+			flattenRows(init, dims)
+			node.ArraySize = max(node.ArraySize, init.ArraySize)
+			node.Children = []*ASTNode{init}
+		} else {
+			init, err := p.parseAssignment()
+			if err != nil {
+				return nil, err
+			}
+			if init.Type == NodeString && arraySize == 0 {
+				// char name[] = "..." holds the string and its NUL
+				node.ArraySize = len(init.Value) + 1
+			}
+			node.Children = []*ASTNode{init}
+		}
 	}
 	
+	// Further declarators are skipped for now
+	for !p.match(SEMICOLON) && !p.match(EOF) {
+		p.advance()
+	}
 	if p.match(SEMICOLON) {
 		p.advance()
 	}
 	
-	return &ASTNode{
-		Type:     NodeVarDecl,
-		VarName:  name,
-		DataType: dataType,
-		IsGlobal: true,
-	}, nil
+	return node, nil
+}
+
+// flattenRows rewrites the initializer of a multi-dimensional array,
+// whose rows are in braces of their own, as one of its flattened elements:
+// {{1, 2}, {3, 4}} for [2][2] becomes {1, 2, 3, 4}. Values without row
+// braces are already in order.
+func flattenRows(init *ASTNode, dims []int) {
+	if len(dims) < 2 {
+		return
+	}
+	stride := 1
+	for _, dim := range dims[1:] {
+		stride *= dim
+	}
+	var children []*ASTNode
+	var fields []string
+	for i, child := range init.Children {
+		index := i
+		if i < len(init.InitFields) && strings.HasPrefix(init.InitFields[i], "[") {
+			fmt.Sscanf(init.InitFields[i], "[%d]", &index)
+		}
+		if child.Type != NodeCompoundLiteral {
+			children = append(children, child)
+			fields = append(fields, fmt.Sprintf("[%d]", index))
+			continue
+		}
+		flattenRows(child, dims[1:])
+		for j, elem := range child.Children {
+			at := j
+			if j < len(child.InitFields) && strings.HasPrefix(child.InitFields[j], "[") {
+				fmt.Sscanf(child.InitFields[j], "[%d]", &at)
+			}
+			children = append(children, elem)
+			fields = append(fields, fmt.Sprintf("[%d]", index*stride+at))
+		}
+	}
+	init.Children, init.InitFields = children, fields
+}
+
+// flattenSubscripts rewrites the subscripts of multi-dimensional globals,
+// which are stored flattened (see flattenRows), as their element's:
+// totals[i][j] for long totals[3][4] becomes totals[i*4 + j]. Only fully
+// subscripted ones are rewritten, and not in a function with a parameter
+// or local of the same name. In the initializers of globals, where they
+// can only be address constants, rows are rewritten too (see flattenRow).
+// Locals of an array typedef are stored flattened as well, and localDims
+// has their dimensions by function.
+func flattenSubscripts(program *ASTNode, arrayDims map[string][]int, localDims map[string]map[string][]int) {
+	if len(arrayDims) == 0 && len(localDims) == 0 {
+		return
+	}
+	for _, fn := range program.Children {
+		if fn.Type == NodeVarDecl {
+			for _, init := range fn.Children {
+				flattenInitializer(init, arrayDims)
+			}
+			continue
+		}
+		if fn.Type != NodeFunction {
+			continue
+		}
+		visible := make(map[string][]int)
+		for name, dims := range arrayDims {
+			visible[name] = dims
+		}
+		for _, param := range fn.Params {
+			delete(visible, param)
+		}
+		dropLocals(fn, visible)
+		for name, dims := range localDims[fn.Name] {
+			visible[name] = dims
+		}
+		flattenSubscript(fn, visible)
+	}
+}
+
+// dropLocals takes the names of node's local declarations out of arrayDims
+func dropLocals(node *ASTNode, arrayDims map[string][]int) {
+	if node.Type == NodeVarDecl {
+		delete(arrayDims, node.VarName)
+	}
+	for _, child := range node.Children {
+		dropLocals(child, arrayDims)
+	}
+}
+
+// flattenSubscript rewrites the subscripts in node (see flattenSubscripts)
+func flattenSubscript(node *ASTNode, arrayDims map[string][]int) {
+	for _, child := range node.Children {
+		flattenSubscript(child, arrayDims)
+	}
+	if base, indices, dims := subscriptsOf(node, arrayDims); dims != nil && len(indices) == len(dims) {
+		node.Children = []*ASTNode{base, flatIndex(indices, dims, node.Line)}
+	}
+}
+
+// flattenInitializer rewrites the subscripts in a global's initializer:
+// as flattenSubscript, and rows as their first element's address
+func flattenInitializer(node *ASTNode, arrayDims map[string][]int) {
+	if node.Type == NodeSizeof {
+		return
+	}
+	target := node
+	if node.Type == NodeUnaryOp && node.Operator == "&" && len(node.Children) == 1 {
+		target = node.Children[0]
+	}
+	if base, indices, dims := subscriptsOf(target, arrayDims); dims != nil {
+		if len(indices) == len(dims) {
+			target.Children = []*ASTNode{base, flatIndex(indices, dims, target.Line)}
+		} else {
+			flattenRow(node, base, indices, dims)
+		}
+		return
+	}
+	for _, child := range node.Children {
+		flattenInitializer(child, arrayDims)
+	}
+}
+
+// flattenRow rewrites node, a row of a multi-dimensional global or its
+// address, as the address of the row's first element: for int tab[2][3],
+// tab[1] and &tab[1] both become &tab[3]
+func flattenRow(node, base *ASTNode, indices []*ASTNode, dims []int) {
+	for len(indices) < len(dims) {
+		indices = append(indices, &ASTNode{Type: NodeNumber, Value: "0", DataType: "int", Line: node.Line})
+	}
+	element := &ASTNode{Type: NodeArrayAccess, Line: node.Line, Children: []*ASTNode{base, flatIndex(indices, dims, node.Line)}}
+	*node = ASTNode{Type: NodeUnaryOp, Operator: "&", Line: node.Line, Column: node.Column, Children: []*ASTNode{element}}
+}
+
+// subscriptsOf splits node, if it subscripts a multi-dimensional global,
+// into the global and its indices, outermost first, with its dimensions
+func subscriptsOf(node *ASTNode, arrayDims map[string][]int) (*ASTNode, []*ASTNode, []int) {
+	if node.Type != NodeArrayAccess {
+		return nil, nil, nil
+	}
+	var indices []*ASTNode
+	base := node
+	for base.Type == NodeArrayAccess && len(base.Children) == 2 {
+		indices = append([]*ASTNode{base.Children[1]}, indices...)
+		base = base.Children[0]
+	}
+	dims, ok := arrayDims[base.VarName]
+	if base.Type != NodeIdentifier || !ok || len(indices) > len(dims) {
+		return nil, nil, nil
+	}
+	return base, indices, dims
+}
+
+// flatIndex is the flattened index of a full set of subscripts
+func flatIndex(indices []*ASTNode, dims []int, line int) *ASTNode {
+	index := indices[0]
+	for i, dim := range dims[1:] {
+		stride := &ASTNode{Type: NodeNumber, Value: strconv.Itoa(dim), IntValue: dim, DataType: "int", Line: line}
+		scaled := &ASTNode{Type: NodeBinaryOp, Operator: "*", Line: line, Children: []*ASTNode{index, stride}}
+		index = &ASTNode{Type: NodeBinaryOp, Operator: "+", Line: line, Children: []*ASTNode{scaled, indices[i+1]}}
+	}
+	return index
 }
 
 func (p *Parser) parseBlock() (*ASTNode, error) {
@@ -1069,29 +1494,53 @@ func (p *Parser) parseBlock() (*ASTNode, error) {
 	
 	block := &ASTNode{
 		Type:     NodeBlock,
-		Children: []*ASTNode{},
-	}
-	
-	for !p.match(RBRACE) && !p.match(EOF) {
-		stmt, err := p.parseStatement()
-		if err != nil {
-			return nil, err
-		}
-		if stmt != nil {
-			block.Children = append(block.Children, stmt)
-		}
+		Children: p.parseStatementsUntil("block", RBRACE),
 	}
 	
 	if p.match(RBRACE) {
+		block.EndLine, block.EndColumn = p.current().Line, p.current().Column
 		p.advance()
 	}
 	
 	return block, nil
 }
 
+// parseStatement parses one statement, tagged with where it starts
 func (p *Parser) parseStatement() (*ASTNode, error) {
+	line, column := p.current().Line, p.current().Column
+	stmt, err := p.parseStatementKind()
+	if stmt != nil && stmt.Line == 0 {
+		stmt.Line, stmt.Column = line, column
+	}
+	return stmt, err
+}
+
+func (p *Parser) parseStatementKind() (*ASTNode, error) {
 	// Variable declaration (with optional storage class and type modifiers)
-	if p.match(INT, CHAR_KW, FLOAT, DOUBLE, STATIC, CONST, STRUCT, UNION, UNSIGNED, SIGNED, LONG, SHORT) {
+	if p.match(INT, CHAR_KW, FLOAT, DOUBLE, STATIC, EXTERN, THREAD, CONST, VOLATILE, STRUCT, UNION, UNSIGNED, SIGNED, LONG, SHORT) {
+		return p.parseVarDecl()
+	}
+	
+	// enum Tag { ... }; defines constants without declaring a variable
+	if p.match(ENUM) {
+		dataType := p.parseType()
+		if p.match(SEMICOLON) {
+			p.advance()
+			return nil, nil
+		}
+		return p.parseDeclarator(dataType)
+	}
+	
+	// Attributes start a declaration, or are a statement of their own:
+	// __attribute__((fallthrough));
+	if p.atAttribute() {
+		save := p.pos
+		p.parseAttributes()
+		if p.match(SEMICOLON) {
+			p.advance()
+			return nil, nil
+		}
+		p.pos = save
 		return p.parseVarDecl()
 	}
 	
@@ -1179,38 +1628,44 @@ func (p *Parser) parseStatement() (*ASTNode, error) {
 
 func (p *Parser) parseVarDecl() (*ASTNode, error) {
 	dataType := p.parseType()
-	
+	attrs := p.typeAttributes
+	node, err := p.parseDeclarator(dataType)
+	if node != nil {
+		node.Attributes = append(attrs, node.Attributes...)
+	}
+	return node, err
+}
+
+// parseDeclarator parses the rest of a declaration once its type is known
+func (p *Parser) parseDeclarator(dataType string) (*ASTNode, error) {
+	elements, typedefDims := p.typedefElements(), p.typedefDims()
 	if !p.match(IDENTIFIER) {
 		return nil, fmt.Errorf("expected identifier")
 	}
 	
-	varName := p.current().Lexeme
+	varName, line, column := p.current().Lexeme, p.current().Line, p.current().Column
 	p.advance()
+	p.noteFunctionPointer(p.function, varName)
 	
 	node := &ASTNode{
 		Type:     NodeVarDecl,
 		VarName:  varName,
 		DataType: dataType,
+		Line:     line,
+		Column:   column,
 	}
 	
 	// Handle array declaration: int arr[10]
+	arraySize := -1
 	if p.match(LBRACKET) {
 		p.advance()
 		
-		if !p.match(RBRACKET) {
-			// Array size
-			sizeExpr, err := p.parseExpression()
-			if err != nil {
-				return nil, err
-			}
-			
-			// For now, only support constant sizes
-			if sizeExpr.Type == NodeNumber {
-				node.ArraySize = sizeExpr.IntValue
-			} else {
-				return nil, fmt.Errorf("array size must be a constant")
-			}
+		size, err := p.parseArrayDimension()
+		if err != nil {
+			return nil, err
 		}
+		node.ArraySize = size
+		arraySize = size
 		
 		if !p.match(RBRACKET) {
 			return nil, fmt.Errorf("expected ']'")
@@ -1218,18 +1673,32 @@ func (p *Parser) parseVarDecl() (*ASTNode, error) {
 		p.advance()
 	}
 	
+	// An array typedef's elements, flattened into the array's
+	if elements > 0 {
+		var dims []int
+		if arraySize >= 0 {
+			dims = []int{arraySize}
+		}
+		p.noteLocalDims(varName, append(dims, typedefDims...))
+		arraySize = max(arraySize, 1) * elements
+		node.ArraySize = arraySize
+	}
+	node.Attributes = p.parseAttributes()
+	
 	// Handle initialization
 	if p.match(ASSIGN) {
 		p.advance()
 		
 		// Check if this is a struct/typedef initialization with brace initializer
 		if p.match(LBRACE) {
-			// This is a compound literal initialization
+			// This is a compound literal initialization; an unsized
+			// array takes its length from it
 			resolvedType := p.resolveTypedef(dataType)
-			initExpr, err := p.parseCompoundLiteral(resolvedType)
+			initExpr, err := p.parseCompoundLiteral(resolvedType, arraySize)
 			if err != nil {
 				return nil, err
 			}
+			node.ArraySize = max(node.ArraySize, initExpr.ArraySize)
 			node.Children = []*ASTNode{initExpr}
 		} else {
 			initExpr, err := p.parseExpression()
@@ -1248,10 +1717,9 @@ func (p *Parser) parseVarDecl() (*ASTNode, error) {
 }
 
 func (p *Parser) parseReturn() (*ASTNode, error) {
+	node := &ASTNode{Type: NodeReturn, Line: p.current().Line, Column: p.current().Column}
 	p.advance() // skip return
 	
-	node := &ASTNode{Type: NodeReturn}
-	
 	if !p.match(SEMICOLON) {
 		expr, err := p.parseExpression()
 		if err != nil {
@@ -1349,6 +1817,10 @@ func (p *Parser) parseFor() (*ASTNode, error) {
 			if p.match(SEMICOLON) {
 				p.advance()
 			}
+			// Wrap so the selector can tell an expression init from the increment
+			if init != nil {
+				init = &ASTNode{Type: NodeExprStmt, Children: []*ASTNode{init}}
+			}
 		}
 		if err != nil {
 			return nil, err
@@ -1407,6 +1879,7 @@ func (p *Parser) parseFor() (*ASTNode, error) {
 }
 
 func (p *Parser) parseSwitch() (*ASTNode, error) {
+	line, column := p.current().Line, p.current().Column
 	p.advance() // skip 'switch'
 	
 	if !p.match(LPAREN) {
@@ -1440,6 +1913,7 @@ func (p *Parser) parseSwitch() (*ASTNode, error) {
 			}
 			cases = append(cases, caseNode)
 		} else if p.match(DEFAULT) {
+			defaultLine := p.current().Line
 			p.advance()
 			if !p.match(COLON) {
 				return nil, fmt.Errorf("expected ':' after default")
@@ -1447,19 +1921,13 @@ func (p *Parser) parseSwitch() (*ASTNode, error) {
 			p.advance()
 			
 			// Parse statements until next case/default/}
-			stmts := []*ASTNode{}
-			for !p.match(CASE, DEFAULT, RBRACE) && !p.isAtEnd() {
-				stmt, err := p.parseStatement()
-				if err != nil {
-					return nil, err
-				}
-				stmts = append(stmts, stmt)
-			}
+			stmts := p.parseStatementsUntil("switch", CASE, DEFAULT, RBRACE)
 			
 			defaultCase = &ASTNode{
 				Type:     NodeCase,
 				Value:    "default",
 				Children: stmts,
+				Line:     defaultLine,
 			}
 		} else {
 			return nil, fmt.Errorf("expected 'case' or 'default' in switch")
@@ -1480,10 +1948,13 @@ func (p *Parser) parseSwitch() (*ASTNode, error) {
 	return &ASTNode{
 		Type:     NodeSwitch,
 		Children: children,
+		Line:     line,
+		Column:   column,
 	}, nil
 }
 
 func (p *Parser) parseCase() (*ASTNode, error) {
+	line, column := p.current().Line, p.current().Column
 	p.advance() // skip 'case'
 	
 	value, err := p.parseExpression()
@@ -1497,14 +1968,7 @@ func (p *Parser) parseCase() (*ASTNode, error) {
 	p.advance()
 	
 	// Parse statements until next case/default/}
-	stmts := []*ASTNode{}
-	for !p.match(CASE, DEFAULT, RBRACE) && !p.isAtEnd() {
-		stmt, err := p.parseStatement()
-		if err != nil {
-			return nil, err
-		}
-		stmts = append(stmts, stmt)
-	}
+	stmts := p.parseStatementsUntil("switch", CASE, DEFAULT, RBRACE)
 	
 	// First child is the case value, rest are statements
 	children := []*ASTNode{value}
@@ -1513,6 +1977,8 @@ func (p *Parser) parseCase() (*ASTNode, error) {
 	return &ASTNode{
 		Type:     NodeCase,
 		Children: children,
+		Line:     line,
+		Column:   column,
 	}, nil
 }
 
@@ -1526,8 +1992,9 @@ func (p *Parser) parseAssignment() (*ASTNode, error) {
 		return nil, err
 	}
 	
-	if p.match(ASSIGN, PLUSASSIGN, MINUSASSIGN, STARASSIGN, SLASHASSIGN) {
-		op := p.current().Lexeme
+	if p.match(ASSIGN, PLUSASSIGN, MINUSASSIGN, STARASSIGN, SLASHASSIGN, PERCENTASSIGN,
+		LSHIFTASSIGN, RSHIFTASSIGN, BANDASSIGN, BORASSIGN, BXORASSIGN) {
+		op, line, column := p.current().Lexeme, p.current().Line, p.current().Column
 		p.advance()
 		
 		right, err := p.parseAssignment()
@@ -1538,6 +2005,8 @@ func (p *Parser) parseAssignment() (*ASTNode, error) {
 		return &ASTNode{
 			Type:     NodeAssignment,
 			Operator: op,
+			Line:     line,
+			Column:   column,
 			Children: []*ASTNode{left, right},
 		}, nil
 	}
@@ -1585,7 +2054,7 @@ func (p *Parser) parseLogicalOr() (*ASTNode, error) {
 	}
 	
 	for p.match(LOR) {
-		op := p.current().Lexeme
+		op, line, column := p.current().Lexeme, p.current().Line, p.current().Column
 		p.advance()
 		
 		right, err := p.parseLogicalAnd()
@@ -1596,6 +2065,8 @@ func (p *Parser) parseLogicalOr() (*ASTNode, error) {
 		left = &ASTNode{
 			Type:     NodeBinaryOp,
 			Operator: op,
+			Line:     line,
+			Column:   column,
 			Children: []*ASTNode{left, right},
 		}
 	}
@@ -1610,7 +2081,7 @@ func (p *Parser) parseLogicalAnd() (*ASTNode, error) {
 	}
 	
 	for p.match(LAND) {
-		op := p.current().Lexeme
+		op, line, column := p.current().Lexeme, p.current().Line, p.current().Column
 		p.advance()
 		
 		right, err := p.parseBitwiseOr()
@@ -1621,6 +2092,8 @@ func (p *Parser) parseLogicalAnd() (*ASTNode, error) {
 		left = &ASTNode{
 			Type:     NodeBinaryOp,
 			Operator: op,
+			Line:     line,
+			Column:   column,
 			Children: []*ASTNode{left, right},
 		}
 	}
@@ -1635,7 +2108,7 @@ func (p *Parser) parseBitwiseOr() (*ASTNode, error) {
 	}
 	
 	for p.match(BOR) {
-		op := p.current().Lexeme
+		op, line, column := p.current().Lexeme, p.current().Line, p.current().Column
 		p.advance()
 		
 		right, err := p.parseBitwiseXor()
@@ -1646,6 +2119,8 @@ func (p *Parser) parseBitwiseOr() (*ASTNode, error) {
 		left = &ASTNode{
 			Type:     NodeBinaryOp,
 			Operator: op,
+			Line:     line,
+			Column:   column,
 			Children: []*ASTNode{left, right},
 		}
 	}
@@ -1660,7 +2135,7 @@ func (p *Parser) parseBitwiseXor() (*ASTNode, error) {
 	}
 	
 	for p.match(BXOR) {
-		op := p.current().Lexeme
+		op, line, column := p.current().Lexeme, p.current().Line, p.current().Column
 		p.advance()
 		
 		right, err := p.parseBitwiseAnd()
@@ -1671,6 +2146,8 @@ func (p *Parser) parseBitwiseXor() (*ASTNode, error) {
 		left = &ASTNode{
 			Type:     NodeBinaryOp,
 			Operator: op,
+			Line:     line,
+			Column:   column,
 			Children: []*ASTNode{left, right},
 		}
 	}
@@ -1685,7 +2162,7 @@ func (p *Parser) parseBitwiseAnd() (*ASTNode, error) {
 	}
 	
 	for p.match(BAND) {
-		op := p.current().Lexeme
+		op, line, column := p.current().Lexeme, p.current().Line, p.current().Column
 		p.advance()
 		
 		right, err := p.parseEquality()
@@ -1696,6 +2173,8 @@ func (p *Parser) parseBitwiseAnd() (*ASTNode, error) {
 		left = &ASTNode{
 			Type:     NodeBinaryOp,
 			Operator: op,
+			Line:     line,
+			Column:   column,
 			Children: []*ASTNode{left, right},
 		}
 	}
@@ -1710,7 +2189,7 @@ func (p *Parser) parseEquality() (*ASTNode, error) {
 	}
 	
 	for p.match(EQ, NE) {
-		op := p.current().Lexeme
+		op, line, column := p.current().Lexeme, p.current().Line, p.current().Column
 		p.advance()
 		
 		right, err := p.parseComparison()
@@ -1721,6 +2200,8 @@ func (p *Parser) parseEquality() (*ASTNode, error) {
 		left = &ASTNode{
 			Type:     NodeBinaryOp,
 			Operator: op,
+			Line:     line,
+			Column:   column,
 			Children: []*ASTNode{left, right},
 		}
 	}
@@ -1735,7 +2216,7 @@ func (p *Parser) parseComparison() (*ASTNode, error) {
 	}
 	
 	for p.match(LT, LE, GT, GE) {
-		op := p.current().Lexeme
+		op, line, column := p.current().Lexeme, p.current().Line, p.current().Column
 		p.advance()
 		
 		right, err := p.parseShift()
@@ -1746,6 +2227,8 @@ func (p *Parser) parseComparison() (*ASTNode, error) {
 		left = &ASTNode{
 			Type:     NodeBinaryOp,
 			Operator: op,
+			Line:     line,
+			Column:   column,
 			Children: []*ASTNode{left, right},
 		}
 	}
@@ -1760,7 +2243,7 @@ func (p *Parser) parseShift() (*ASTNode, error) {
 	}
 	
 	for p.match(LSHIFT, RSHIFT) {
-		op := p.current().Lexeme
+		op, line, column := p.current().Lexeme, p.current().Line, p.current().Column
 		p.advance()
 		
 		right, err := p.parseAdditive()
@@ -1771,6 +2254,8 @@ func (p *Parser) parseShift() (*ASTNode, error) {
 		left = &ASTNode{
 			Type:     NodeBinaryOp,
 			Operator: op,
+			Line:     line,
+			Column:   column,
 			Children: []*ASTNode{left, right},
 		}
 	}
@@ -1785,7 +2270,7 @@ func (p *Parser) parseAdditive() (*ASTNode, error) {
 	}
 	
 	for p.match(PLUS, MINUS) {
-		op := p.current().Lexeme
+		op, line, column := p.current().Lexeme, p.current().Line, p.current().Column
 		p.advance()
 		
 		right, err := p.parseMultiplicative()
@@ -1796,6 +2281,8 @@ func (p *Parser) parseAdditive() (*ASTNode, error) {
 		left = &ASTNode{
 			Type:     NodeBinaryOp,
 			Operator: op,
+			Line:     line,
+			Column:   column,
 			Children: []*ASTNode{left, right},
 		}
 	}
@@ -1810,7 +2297,7 @@ func (p *Parser) parseMultiplicative() (*ASTNode, error) {
 	}
 	
 	for p.match(STAR, SLASH, PERCENT) {
-		op := p.current().Lexeme
+		op, line, column := p.current().Lexeme, p.current().Line, p.current().Column
 		p.advance()
 		
 		right, err := p.parseUnary()
@@ -1821,6 +2308,8 @@ func (p *Parser) parseMultiplicative() (*ASTNode, error) {
 		left = &ASTNode{
 			Type:     NodeBinaryOp,
 			Operator: op,
+			Line:     line,
+			Column:   column,
 			Children: []*ASTNode{left, right},
 		}
 	}
@@ -1829,8 +2318,12 @@ func (p *Parser) parseMultiplicative() (*ASTNode, error) {
 }
 
 func (p *Parser) parseUnary() (*ASTNode, error) {
-	if p.match(MINUS, LNOT, BNOT, BAND, STAR, INC, DEC) {
-		op := p.current().Lexeme
+	if p.match(SIZEOF, ALIGNOF) {
+		return p.parseSizeof()
+	}
+	
+	if p.match(PLUS, MINUS, LNOT, BNOT, BAND, STAR, INC, DEC) {
+		op, line, column := p.current().Lexeme, p.current().Line, p.current().Column
 		p.advance()
 		
 		operand, err := p.parseUnary()
@@ -1841,6 +2334,8 @@ func (p *Parser) parseUnary() (*ASTNode, error) {
 		return &ASTNode{
 			Type:     NodeUnaryOp,
 			Operator: op,
+			Line:     line,
+			Column:   column,
 			Children: []*ASTNode{operand},
 		}, nil
 	}
@@ -1848,6 +2343,61 @@ func (p *Parser) parseUnary() (*ASTNode, error) {
 	return p.parsePostfix()
 }
 
+// parseSizeof parses sizeof and _Alignof. Of a parenthesized type they're a
+// number straight away; of an expression, which sizeof doesn't evaluate,
+// they're a NodeSizeof that the type checker sizes once it knows the
+// expression's type. IntValue holds the parser's guess until then.
+func (p *Parser) parseSizeof() (*ASTNode, error) {
+	op, line, column := p.current().Lexeme, p.current().Line, p.current().Column
+	p.advance()
+	
+	// sizeof(type)
+	if p.match(LPAREN) {
+		start := p.pos
+		p.advance() // skip (
+		if p.match(INT, CHAR_KW, VOID, FLOAT, DOUBLE, STRUCT, UNION, ENUM, UNSIGNED, SIGNED, LONG, SHORT, CONST, VOLATILE) || p.isTypeName() {
+			typeName := p.parseType()
+			if !p.match(RPAREN) {
+				return nil, fmt.Errorf("expected ')' after %s type at line %d", op, p.current().Line)
+			}
+			p.advance()
+			value := p.types().SizeOf(typeName) * max(p.typedefElements(), 1)
+			if op == "_Alignof" {
+				value = p.types().AlignOf(typeName)
+			}
+			return &ASTNode{
+				Type:     NodeNumber,
+				Value:    fmt.Sprintf("%d", value),
+				IntValue: value,
+				Line:     line,
+				Column:   column,
+			}, nil
+		}
+		p.pos = start // a parenthesized expression
+	}
+	
+	// sizeof expr, sizeof(expr)
+	expr, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	guess := p.types().SizeOf(expr.DataType)
+	if op == "_Alignof" {
+		guess = p.types().AlignOf(expr.DataType)
+	}
+	if guess == 0 {
+		guess = 4 // Default to int size
+	}
+	return &ASTNode{
+		Type:     NodeSizeof,
+		Operator: op,
+		IntValue: guess,
+		Line:     line,
+		Column:   column,
+		Children: []*ASTNode{expr},
+	}, nil
+}
+
 func (p *Parser) parsePostfix() (*ASTNode, error) {
 	left, err := p.parsePrimary()
 	if err != nil {
@@ -1856,11 +2406,13 @@ func (p *Parser) parsePostfix() (*ASTNode, error) {
 	
 	for {
 		if p.match(INC, DEC) {
-			op := p.current().Lexeme
+			opTok := p.current()
 			p.advance()
 			left = &ASTNode{
 				Type:     NodeUnaryOp,
-				Operator: op + "_post",
+				Operator: opTok.Lexeme + "_post",
+				Line:     opTok.Line,
+				Column:   opTok.Column,
 				Children: []*ASTNode{left},
 			}
 		} else if p.match(LBRACKET) {
@@ -1909,103 +2461,60 @@ func (p *Parser) parsePrimary() (*ASTNode, error) {
 		
 		// Determine if it's a float or int based on presence of decimal point
 		dataType := "int"
-		if strings.Contains(value, ".") || strings.Contains(value, "e") || strings.Contains(value, "E") {
-			dataType = "double"
-		}
-		
-		return &ASTNode{
-			Type:     NodeNumber,
-			Value:    value,
-			IntValue: intVal,
-			DataType: dataType,
-		}, nil
-	}
-	
-	// sizeof operator
-	if p.match(SIZEOF) {
-		p.advance()
-		
-		// sizeof(type) or sizeof(expr)
-		if !p.match(LPAREN) {
-			return nil, fmt.Errorf("expected '(' after sizeof")
-		}
-		p.advance()
-		
-		// Try to parse as a type
-		var sizeVal int
-		if p.match(INT, CHAR_KW, VOID, FLOAT, DOUBLE, STRUCT, UNION, UNSIGNED, SIGNED, LONG, SHORT) || p.isTypeName() {
-			// Type
-			typeName := p.parseType()
-			sizeVal = p.getTypeSize(typeName)
-		} else {
-			// Expression - parse and get its type
-			expr, err := p.parseExpression()
+		if isFloatLiteral(value) {
+			var err error
+			value, dataType, err = parseFloatLiteral(value)
 			if err != nil {
 				return nil, err
 			}
-			// For now, assume all expressions are int-sized
-			sizeVal = p.getTypeSize(expr.DataType)
-			if sizeVal == 0 {
-				sizeVal = 4 // Default to int size
+		} else {
+			// Integer constants are typed by value and suffix; the
+			// suffix isn't part of the value the backend sees
+			dataType = integerLiteralType(value, p.target)
+			value = strings.TrimRight(value, "uUlL")
+			if n, err := parseIntegerLiteral(value); err == nil {
+				intVal = int(n)
 			}
 		}
 		
-		if !p.match(RPAREN) {
-			return nil, fmt.Errorf("expected ')' after sizeof")
-		}
-		p.advance()
-		
 		return &ASTNode{
 			Type:     NodeNumber,
-			Value:    fmt.Sprintf("%d", sizeVal),
-			IntValue: sizeVal,
+			Value:    value,
+			IntValue: intVal,
+			DataType: dataType,
 		}, nil
 	}
 	
 	// String
 	if p.match(STRING) {
+		// Adjacent literals are one string ("foo" "bar" is "foobar")
 		value := p.current().Lexeme
 		p.advance()
+		for p.match(STRING) {
+			value += p.current().Lexeme
+			p.advance()
+		}
 		return &ASTNode{
 			Type:  NodeString,
 			Value: value,
 		}, nil
 	}
 	
+	// __func__ names the enclosing function (C11 6.4.2.2); __FUNCTION__ is
+	// gcc's older spelling
+	if p.match(IDENTIFIER) && p.function != "" && (p.current().Lexeme == "__func__" || p.current().Lexeme == "__FUNCTION__") {
+		p.advance()
+		return &ASTNode{Type: NodeString, Value: p.function}, nil
+	}
+	
 	// Character
 	if p.match(CHAR) {
 		lexeme := p.current().Lexeme
 		p.advance()
-		
-		// Convert character literal to numeric value
-		var charValue int
-		if len(lexeme) == 0 {
-			return nil, fmt.Errorf("empty character literal")
-		} else if lexeme[0] == '\\' && len(lexeme) > 1 {
-			// Escape sequence
-			switch lexeme[1] {
-			case '0':
-				charValue = 0
-			case 'n':
-				charValue = 10
-			case 't':
-				charValue = 9
-			case 'r':
-				charValue = 13
-			case '\\':
-				charValue = 92
-			case '\'':
-				charValue = 39
-			case '"':
-				charValue = 34
-			default:
-				charValue = int(lexeme[1])
-			}
-		} else {
-			// Regular character
-			charValue = int(lexeme[0])
+		charValue, err := characterConstant(lexeme)
+		if err != nil {
+			return nil, err
 		}
-		
 		return &ASTNode{
 			Type:  NodeNumber,
 			Value: fmt.Sprintf("%d", charValue),
@@ -2014,7 +2523,7 @@ func (p *Parser) parsePrimary() (*ASTNode, error) {
 	
 	// Identifier or function call
 	if p.match(IDENTIFIER) {
-		name := p.current().Lexeme
+		name, line, column := p.current().Lexeme, p.current().Line, p.current().Column
 		p.advance()
 		
 		// Function call
@@ -2042,6 +2551,8 @@ func (p *Parser) parsePrimary() (*ASTNode, error) {
 				Type:     NodeCall,
 				Name:     name,
 				Children: args,
+				Line:     line,
+				Column:   column,
 			}, nil
 		}
 		
@@ -2049,11 +2560,14 @@ func (p *Parser) parsePrimary() (*ASTNode, error) {
 		return &ASTNode{
 			Type:    NodeIdentifier,
 			VarName: name,
+			Line:    line,
+			Column:  column,
 		}, nil
 	}
 	
 	// Parenthesized expression or statement expression
 	if p.match(LPAREN) {
+		openLine := p.current().Line
 		p.advance()
 		
 		// Check for statement expression: ({ statements; expr; })
@@ -2069,37 +2583,55 @@ func (p *Parser) parsePrimary() (*ASTNode, error) {
 		isCast := false
 		
 		// Definite type keywords indicate a cast
-		if p.match(INT, CHAR_KW, FLOAT, DOUBLE, VOID, UNSIGNED, SIGNED, LONG, SHORT, CONST) {
+		if p.match(INT, CHAR_KW, FLOAT, DOUBLE, VOID, UNSIGNED, SIGNED, LONG, SHORT, CONST, VOLATILE) {
 			isCast = true
-		} else if p.match(STRUCT, UNION) {
-			// struct/union is definitely a type
+		} else if p.match(STRUCT, UNION, ENUM) {
+			// struct/union/enum is definitely a type
 			isCast = true
 		} else if p.isTypeName() {
 			// It's a typedef - need to check if it's being used as a type or variable
 			// Heuristic: if next token after identifier is * or ), it's likely a cast
 			// (TypeName*) expr   -> cast
 			// (TypeName) expr    -> could be cast or paren expr
+			// (TypeName[]){...}  -> array compound literal
 			// (varname + 1)      -> paren expr
 			
 			// Peek ahead: after the identifier, what comes next?
-			if p.pos+1 < len(p.tokens) {
-				nextToken := p.tokens[p.pos+1]
-				if nextToken.Type == STAR || nextToken.Type == RPAREN {
-					// (TypeName*) or (TypeName) - likely a cast
-					isCast = true
-				}
+			if nextToken := p.peek(1); nextToken.Type == STAR || nextToken.Type == RPAREN || nextToken.Type == LBRACKET {
+				// (TypeName*), (TypeName) or (TypeName[n]) - likely a cast
+				isCast = true
 			}
 		}
 		
 		if isCast {
 			// Parse as cast
 			castType := p.parseType()
+			
+			// Array compound literal: (int[]){1, 2, 3} or (int[4]){...}
+			arraySize := -1
+			if p.match(LBRACKET) {
+				p.advance()
+				size, err := p.parseArrayDimension()
+				if err != nil {
+					return nil, err
+				}
+				arraySize = size
+				if !p.match(RBRACKET) {
+					return nil, fmt.Errorf("expected ] in compound literal type at line %d", p.current().Line)
+				}
+				p.advance()
+			}
+			
 			if p.match(RPAREN) {
 				p.advance()
 				
 				// Check for compound literal: (Type){...}
 				if p.match(LBRACE) {
-					return p.parseCompoundLiteral(castType)
+					// Unsized arrays take their length from the initializer
+					return p.parseCompoundLiteral(castType, arraySize)
+				}
+				if arraySize >= 0 {
+					return nil, fmt.Errorf("cast to array type at line %d", p.current().Line)
 				}
 				
 				// Regular cast: (Type)expr
@@ -2124,7 +2656,7 @@ func (p *Parser) parsePrimary() (*ASTNode, error) {
 		}
 		
 		if !p.match(RPAREN) {
-			return nil, fmt.Errorf("expected ) at line %d, got %s (after parsing expression starting at line %d)", p.current().Line, p.current().Lexeme, p.tokens[p.pos-10].Line)
+			return nil, fmt.Errorf("expected ) at line %d, got %s (after the expression opened at line %d)", p.current().Line, p.current().Lexeme, openLine)
 		}
 		p.advance()
 		
@@ -2134,54 +2666,100 @@ func (p *Parser) parsePrimary() (*ASTNode, error) {
 	return nil, fmt.Errorf("unexpected token: %s at line %d", p.current().Lexeme, p.current().Line)
 }
 
-func (p *Parser) parseCompoundLiteral(typeName string) (*ASTNode, error) {
-	// Parse compound literal: {.field1=val1, .field2=val2, ...}
-	// or positional: {val1, val2, ...}
-	
+// parseCompoundLiteral parses a brace initializer for an object of
+// typeName, or for an array of them unless arraySize is -1 (0 if the
+// initializer sets the length). Designators (.field = v, [index] = v) may be
+// mixed with positional values, which continue from the last one, and
+// braces nest for members and elements that are themselves structs or
+// arrays. Each value is labeled in InitFields with what it initializes: a
+// member name (empty if the struct isn't known), or "[index]" for an
+// element.
+func (p *Parser) parseCompoundLiteral(typeName string, arraySize int) (*ASTNode, error) {
 	// Resolve typedef
 	resolvedType := p.resolveTypedef(typeName)
 	
 	if !p.match(LBRACE) {
 		return nil, fmt.Errorf("expected { for compound literal")
 	}
+	lit := &ASTNode{Type: NodeCompoundLiteral, DataType: resolvedType, Line: p.current().Line}
 	p.advance()
 	
-	initFields := []string{}
-	initValues := []*ASTNode{}
+	var members []StructMember
+	if def, ok := p.structs[structTag(p.resolveTypedef(stripQualifiers(resolvedType)))]; ok && arraySize < 0 {
+		members = def.Members
+	}
+	next := 0 // The member or element a positional value initializes
+	length := 0
 	
 	for !p.match(RBRACE) && !p.match(EOF) {
-		// Check for designated initializer: .fieldname = value
-		if p.match(DOT) {
+		field := ""
+		switch {
+		case p.match(DOT) && arraySize < 0:
+			// Designated member: .fieldname = value
 			p.advance()
-			
 			if !p.match(IDENTIFIER) {
 				return nil, fmt.Errorf("expected field name after .")
 			}
-			fieldName := p.current().Lexeme
+			field = p.current().Lexeme
 			p.advance()
-			
 			if !p.match(ASSIGN) {
 				return nil, fmt.Errorf("expected = after field name")
 			}
 			p.advance()
-			
-			value, err := p.parseAssignment()
-			if err != nil {
-				return nil, err
+			for i, member := range members {
+				if member.Name == field {
+					next = i
+				}
 			}
-			
-			initFields = append(initFields, fieldName)
-			initValues = append(initValues, value)
-		} else {
-			// Positional initializer
-			value, err := p.parseAssignment()
+		case p.match(LBRACKET) && arraySize >= 0:
+			// Designated element: [index] = value
+			p.advance()
+			index, err := p.parseConstantExpression()
 			if err != nil {
 				return nil, err
 			}
-			
-			initFields = append(initFields, "") // Empty string means positional
-			initValues = append(initValues, value)
+			if !p.match(RBRACKET) {
+				return nil, fmt.Errorf("expected ] after array designator")
+			}
+			p.advance()
+			if !p.match(ASSIGN) {
+				return nil, fmt.Errorf("expected = after array designator")
+			}
+			p.advance()
+			next = index
+		case arraySize < 0 && next < len(members):
+			field = members[next].Name
+		}
+		
+		// What the value initializes decides what nested braces mean
+		valueType, valueArraySize := "", -1
+		if arraySize >= 0 {
+			if next < 0 || (arraySize > 0 && next >= arraySize) {
+				return nil, fmt.Errorf("array index %d out of bounds in initializer at line %d", next, p.current().Line)
+			}
+			field = fmt.Sprintf("[%d]", next)
+			valueType = resolvedType
+			length = max(length, next+1)
+		} else if next < len(members) {
+			valueType = members[next].Type
+			if members[next].ArraySize > 0 {
+				valueArraySize = members[next].ArraySize
+			}
 		}
+		next++
+		
+		var value *ASTNode
+		var err error
+		if p.match(LBRACE) {
+			value, err = p.parseCompoundLiteral(valueType, valueArraySize)
+		} else {
+			value, err = p.parseAssignment()
+		}
+		if err != nil {
+			return nil, err
+		}
+		lit.InitFields = append(lit.InitFields, field)
+		lit.Children = append(lit.Children, value)
 		
 		if p.match(COMMA) {
 			p.advance()
@@ -2195,12 +2773,20 @@ func (p *Parser) parseCompoundLiteral(typeName string) (*ASTNode, error) {
 	}
 	p.advance()
 	
-	return &ASTNode{
-		Type:       NodeCompoundLiteral,
-		DataType:   resolvedType,
-		InitFields: initFields,
-		Children:   initValues,
-	}, nil
+	if arraySize >= 0 {
+		lit.ArraySize = max(arraySize, length)
+	}
+	return lit, nil
+}
+
+// structTag is the name a struct or union type is defined under
+func structTag(typ string) string {
+	typ = stripQualifiers(strings.TrimSpace(typ))
+	if strings.HasSuffix(typ, "*") {
+		return ""
+	}
+	typ = strings.TrimPrefix(typ, "struct ")
+	return strings.TrimPrefix(typ, "union ")
 }
 
 func (p *Parser) parseStatementExpression() (*ASTNode, error) {
@@ -2212,17 +2798,10 @@ func (p *Parser) parseStatementExpression() (*ASTNode, error) {
 	}
 	p.advance()
 	
-	statements := []*ASTNode{}
 	var resultExpr *ASTNode
 	
 	// Parse statements until we hit the last expression
-	for !p.match(RBRACE) && !p.match(EOF) {
-		stmt, err := p.parseStatement()
-		if err != nil {
-			return nil, err
-		}
-		statements = append(statements, stmt)
-	}
+	statements := p.parseStatementsUntil("statement expression", RBRACE)
 	
 	if !p.match(RBRACE) {
 		return nil, fmt.Errorf("expected } at end of statement expression")
@@ -3,9 +3,11 @@ package main
 import (
 	"fmt"
 	"os"
-	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Preprocessor handles C preprocessor directives
@@ -13,27 +15,55 @@ type Preprocessor struct {
 	defines       map[string]string
 	funcMacros    map[string]*FunctionMacro // Function-like macros
 	includePaths  []string
-	processed     map[string]bool  // Track processed files to avoid cycles
+	processed     map[string]bool  // Headers opened so far, by canonical path (see include_once.go)
+	onceFiles     map[string]bool   // Headers that said #pragma once
+	guards        map[string]string // The include guard macro of each header that has one
+	including     []string          // Headers being processed, innermost last
 	mu            sync.RWMutex      // For thread-safe define access
 	typedefMap    map[string]*StructDef // External typedefs from headers
+	typedefTypes  map[string]*TypedefType // External typedefs of function pointers and arrays
+	typeAliases   map[string]string // External typedefs of other types: the type each names
 	structMap     map[string]*StructDef // External structs from headers
 	functionSigs  map[string]*FunctionSignature // Function signatures from headers
+	fs            SourceFS                      // File access (real filesystem unless injected)
+	target        *TargetSpec                   // Scalar sizes for header struct layout
+	summaries     []*HeaderSummary              // Headers included so far (see header_summary.go)
+	includes      []string                      // Every file #include opened, in order (see dependencies.go)
+	headerCache   bool                          // Keep header summaries on disk too
+	file          string                        // Header being processed ("" for the main source)
+	mainFile      string                        // What __FILE__ says in the main source
+	line          int                           // Line being processed, for __LINE__
+	lineMap       []SourcePos                   // Origin of each line of the last Process output
+}
+
+// SourcePos is where a line of preprocessed output came from: a line of
+// the main source (File "") or of a header
+type SourcePos struct {
+	File string `json:"file,omitempty"`
+	Line int    `json:"line"`
 }
 
 type FunctionMacro struct {
-	Params []string
-	Body   string
+	Params   []string
+	Body     string
+	Variadic bool // Declared with ... after Params: the rest of the arguments are __VA_ARGS__
 }
 
 func NewPreprocessor() *Preprocessor {
 	p := &Preprocessor{
 		defines:      make(map[string]string),
 		funcMacros:   make(map[string]*FunctionMacro),
-		includePaths: []string{"/usr/include", "/usr/local/include", ".", "/home/lee/Documents/clibs/raylib/src"},
+		includePaths: append(append([]string(nil), systemIncludeDirs...), "."),
 		processed:    make(map[string]bool),
+		onceFiles:    make(map[string]bool),
+		guards:       make(map[string]string),
 		typedefMap:   make(map[string]*StructDef),
+		typedefTypes: make(map[string]*TypedefType),
+		typeAliases:  make(map[string]string),
 		structMap:    make(map[string]*StructDef),
 		functionSigs: make(map[string]*FunctionSignature),
+		fs:           osFS{},
+		target:       defaultTarget,
 	}
 	
 	// Add standard built-in macros
@@ -41,169 +71,87 @@ func NewPreprocessor() *Preprocessor {
 	p.defines["true"] = "1"
 	p.defines["false"] = "0"
 	
+	// Predefined macros (C11 6.10.8) and the platform's, as gcc defines
+	// them. -D and -U apply afterwards, so any can be overridden.
+	// __FILE__ and __LINE__ change as we go; see expandMacros.
+	for name, value := range predefinedMacros {
+		p.defines[name] = value
+	}
+	p.SetTarget(defaultTarget)
+	now := time.Now()
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		// Reproducible builds pin the date
+		now = time.Unix(epoch, 0).UTC()
+	}
+	p.defines["__DATE__"] = `"` + now.Format("Jan _2 2006") + `"`
+	p.defines["__TIME__"] = `"` + now.Format("15:04:05") + `"`
+	
 	return p
 }
 
-// parseRaylibHeader parses raylib.h to extract enum constants
-func (p *Preprocessor) parseRaylibHeader() {
-	raylibPath := "/home/lee/Documents/clibs/raylib/src/raylib.h"
-	content, err := os.ReadFile(raylibPath)
-	if err != nil {
-		// If we can't read raylib.h, add some fallback defines
-		fmt.Fprintf(os.Stderr, "Warning: Could not read %s: %v\n", raylibPath, err)
-		p.addFallbackDefines()
-		return
-	}
-	
-	lines := strings.Split(string(content), "\n")
-	inEnum := false
-	enumValue := 0
-	
-	for i := 0; i < len(lines); i++ {
-		line := strings.TrimSpace(lines[i])
-		
-		// Skip comments
-		if strings.HasPrefix(line, "//") || strings.HasPrefix(line, "/*") {
-			continue
-		}
-		
-		// Check for #define directives
-		if strings.HasPrefix(line, "#define") {
-			parts := strings.Fields(line)
-			if len(parts) >= 3 {
-				name := parts[1]
-				value := strings.Join(parts[2:], " ")
-				// Clean up the value
-				value = strings.TrimSpace(value)
-				value = strings.Split(value, "//")[0] // Remove trailing comments
-				value = strings.TrimSpace(value)
-				
-				// Only add simple numeric or identifier defines
-				if len(value) > 0 && (isNumeric(value) || p.IsDefined(value)) {
-					p.defines[name] = value
-				}
-			}
-			continue
-		}
-		
-		// Check for enum start
-		if strings.Contains(line, "typedef enum") || (strings.Contains(line, "enum") && strings.Contains(line, "{")) {
-			inEnum = true
-			enumValue = 0
-			continue
-		}
-		
-		// Check for enum end
-		if inEnum && strings.Contains(line, "}") {
-			inEnum = false
-			continue
-		}
-		
-		// Parse enum values
-		if inEnum {
-			// Remove comments
-			line = strings.Split(line, "//")[0]
-			line = strings.TrimSpace(line)
-			
-			if line == "" || line == "{" {
-				continue
-			}
-			
-			// Handle enum entries
-			if strings.Contains(line, "=") {
-				// Explicit value: NAME = value,
-				parts := strings.Split(line, "=")
-				if len(parts) >= 2 {
-					name := strings.TrimSpace(parts[0])
-					valueStr := strings.TrimSuffix(strings.TrimSpace(parts[1]), ",")
-					valueStr = strings.TrimSpace(valueStr)
-					
-					// Parse the value (might be hex like 0x00000040)
-					if strings.HasPrefix(valueStr, "0x") || strings.HasPrefix(valueStr, "0X") {
-						// Hex value
-						var val int
-						fmt.Sscanf(valueStr, "%x", &val)
-						p.defines[name] = fmt.Sprintf("%d", val)
-						enumValue = val + 1
-					} else {
-						// Try to parse as decimal
-						var val int
-						n, _ := fmt.Sscanf(valueStr, "%d", &val)
-						if n == 1 {
-							p.defines[name] = fmt.Sprintf("%d", val)
-							enumValue = val + 1
-						}
-					}
-				}
-			} else {
-				// Implicit value: NAME,
-				name := strings.TrimSuffix(strings.TrimSpace(line), ",")
-				if name != "" && name != "{" && name != "}" {
-					p.defines[name] = fmt.Sprintf("%d", enumValue)
-					enumValue++
-				}
-			}
-		}
-	}
+// predefinedMacros are defined before any source is read
+var predefinedMacros = map[string]string{
+	"__STDC__":         "1",
+	"__STDC_VERSION__": "201112L",
+	"__STDC_HOSTED__":  "1",
+	"__linux__":        "1",
+	"__linux":          "1",
+	"__gnu_linux__":    "1",
+	"__unix__":         "1",
+	"__unix":           "1",
+	"__ELF__":          "1",
+	"__LP64__":         "1",
+	"_LP64":            "1",
+	"__CHAR_BIT__":     "8",
+	"__ATOMIC_RELAXED": "0",
+	"__ATOMIC_CONSUME": "1",
+	"__ATOMIC_ACQUIRE": "2",
+	"__ATOMIC_RELEASE": "3",
+	"__ATOMIC_ACQ_REL": "4",
+	"__ATOMIC_SEQ_CST": "5",
 }
 
-// addFallbackDefines adds hardcoded fallback defines if raylib.h can't be read
-func (p *Preprocessor) addFallbackDefines() {
-	// Add raylib log levels
-	p.defines["LOG_ALL"] = "0"
-	p.defines["LOG_TRACE"] = "1"
-	p.defines["LOG_DEBUG"] = "2"
-	p.defines["LOG_INFO"] = "3"
-	p.defines["LOG_WARNING"] = "4"
-	p.defines["LOG_ERROR"] = "5"
-	p.defines["LOG_FATAL"] = "6"
-	p.defines["LOG_NONE"] = "7"
-	
-	// Add raylib window flags
-	p.defines["FLAG_VSYNC_HINT"] = "64"
-	p.defines["FLAG_FULLSCREEN_MODE"] = "2"
-	p.defines["FLAG_WINDOW_RESIZABLE"] = "4"
-	p.defines["FLAG_WINDOW_UNDECORATED"] = "8"
-	p.defines["FLAG_WINDOW_HIDDEN"] = "128"
-	p.defines["FLAG_WINDOW_MINIMIZED"] = "512"
-	p.defines["FLAG_WINDOW_MAXIMIZED"] = "1024"
-	p.defines["FLAG_WINDOW_UNFOCUSED"] = "2048"
-	p.defines["FLAG_WINDOW_TOPMOST"] = "4096"
-	p.defines["FLAG_WINDOW_ALWAYS_RUN"] = "256"
-	p.defines["FLAG_WINDOW_TRANSPARENT"] = "16"
-	p.defines["FLAG_WINDOW_HIGHDPI"] = "8192"
-	p.defines["FLAG_MSAA_4X_HINT"] = "32"
-	p.defines["FLAG_INTERLACED_HINT"] = "65536"
-	
-	// Add shader uniform types
-	p.defines["SHADER_UNIFORM_FLOAT"] = "0"
-	p.defines["SHADER_UNIFORM_VEC2"] = "1"
-	p.defines["SHADER_UNIFORM_VEC3"] = "2"
-	p.defines["SHADER_UNIFORM_VEC4"] = "3"
-	p.defines["SHADER_UNIFORM_INT"] = "4"
-	p.defines["SHADER_UNIFORM_IVEC2"] = "5"
-	p.defines["SHADER_UNIFORM_IVEC3"] = "6"
-	p.defines["SHADER_UNIFORM_IVEC4"] = "7"
-	p.defines["SHADER_UNIFORM_SAMPLER2D"] = "8"
+// archMacros are the predefined macros that name each target architecture
+var archMacros = map[string]map[string]string{
+	"x86_64": {
+		"__x86_64__": "1",
+		"__x86_64":   "1",
+		"__amd64__":  "1",
+		"__amd64":    "1",
+	},
+	"aarch64": {
+		"__aarch64__":       "1",
+		"__ARM_64BIT_STATE": "1",
+		"__ARM_ARCH":        "8",
+	},
 }
 
-// Helper to check if a string is numeric
-func isNumeric(s string) bool {
-	if s == "" {
-		return false
+// SetTarget switches the preprocessor to target: its architecture's
+// macros replace the previous one's, and __CHAR_UNSIGNED__ is defined when
+// plain char is unsigned
+func (p *Preprocessor) SetTarget(target *TargetSpec) {
+	for name := range archMacros[p.target.Arch] {
+		delete(p.defines, name)
 	}
-	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
-		return len(s) > 2
+	p.target = target
+	for name, value := range archMacros[target.Arch] {
+		p.defines[name] = value
 	}
-	if strings.HasPrefix(s, "-") {
-		s = s[1:]
+	delete(p.defines, "__CHAR_UNSIGNED__")
+	if !target.CharSigned {
+		p.defines["__CHAR_UNSIGNED__"] = "1"
 	}
-	for _, c := range s {
-		if c < '0' || c > '9' {
-			return false
-		}
+}
+
+// currentFile is what __FILE__ expands to here
+func (p *Preprocessor) currentFile() string {
+	if p.file != "" {
+		return p.file
+	}
+	if p.mainFile != "" {
+		return p.mainFile
 	}
-	return true
+	return "<stdin>"
 }
 
 // Define adds a preprocessor define
@@ -213,10 +161,68 @@ func (p *Preprocessor) Define(name, value string) {
 	p.defines[name] = value
 }
 
+// DefineMacro defines a macro from what follows #define: "NAME value", or
+// "NAME(params) body" when the parenthesis comes straight after the name
+// ("NAME (value)" is an object-like macro whose value is parenthesized).
+// -D name=value defines "name value", so -D'SQ(x)=((x)*(x))' is
+// function-like, as it is for gcc.
+func (p *Preprocessor) DefineMacro(text string) error {
+	text = strings.TrimSpace(text)
+	end := identEnd(text, 0)
+	if end == 0 || !isIdentStart(text[0]) {
+		return fmt.Errorf("macro names must be identifiers")
+	}
+	name := text[:end]
+	if end < len(text) && text[end] == '(' {
+		closeParen := strings.Index(text, ")")
+		if closeParen < 0 {
+			return fmt.Errorf("missing ')' in the parameters of macro %s", name)
+		}
+		params := []string{}
+		variadic := false
+		if paramsStr := text[end+1 : closeParen]; strings.TrimSpace(paramsStr) != "" {
+			for _, param := range strings.Split(paramsStr, ",") {
+				params = append(params, strings.TrimSpace(param))
+			}
+		}
+		if len(params) > 0 && params[len(params)-1] == "..." {
+			params = params[:len(params)-1]
+			variadic = true
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.defines, name)
+		p.funcMacros[name] = &FunctionMacro{
+			Params:   params,
+			Body:     strings.TrimSpace(text[closeParen+1:]),
+			Variadic: variadic,
+		}
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.funcMacros, name)
+	p.defines[name] = strings.Join(strings.Fields(text[end:]), " ")
+	return nil
+}
+
+// Undefine removes a define or function-like macro, as -U does
+func (p *Preprocessor) Undefine(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.defines, name)
+	delete(p.funcMacros, name)
+}
+
 func (p *Preprocessor) AddIncludePath(path string) {
 	p.includePaths = append(p.includePaths, path)
 }
 
+// SetIncludePaths replaces the default search paths (useful with an in-memory filesystem)
+func (p *Preprocessor) SetIncludePaths(paths []string) {
+	p.includePaths = append([]string(nil), paths...)
+}
+
 func (p *Preprocessor) IsDefined(name string) bool {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -225,66 +231,116 @@ func (p *Preprocessor) IsDefined(name string) bool {
 		return true
 	}
 	_, ok = p.funcMacros[name]
-	return ok
+	return ok || name == "__FILE__" || name == "__LINE__"
 }
 
-// evaluateIfCondition evaluates a #if condition
-func (p *Preprocessor) evaluateIfCondition(condition string) bool {
-	condition = strings.TrimSpace(condition)
-	
-	// Handle: defined(X) or defined X
-	if strings.HasPrefix(condition, "defined") {
-		rest := strings.TrimSpace(condition[7:])
-		
-		// Check for defined(X)
-		if strings.HasPrefix(rest, "(") {
-			closeIdx := strings.Index(rest, ")")
-			if closeIdx > 0 {
-				name := strings.TrimSpace(rest[1:closeIdx])
-				return p.IsDefined(name)
-			}
-		} else {
-			// Check for defined X
-			parts := strings.Fields(rest)
-			if len(parts) > 0 {
-				return p.IsDefined(parts[0])
-			}
+// evaluateIfCondition evaluates a #if or #elif condition: defined X and
+// defined(X) are replaced by 1 or 0, macros are expanded, identifiers left
+// over are 0, and the result is an integer constant expression (see
+// const_eval.go) that is true if it isn't 0
+func (p *Preprocessor) evaluateIfCondition(condition string) (bool, error) {
+	expr := p.replaceDefined(condition)
+	for i := 0; i < 16; i++ {
+		expanded := p.expandMacros(expr)
+		if expanded == expr {
+			break
 		}
-		return false
+		expr = p.replaceDefined(expanded)
 	}
-	
-	// Handle: !defined(X) or !defined X
-	if strings.HasPrefix(condition, "!") {
-		rest := strings.TrimSpace(condition[1:])
-		if strings.HasPrefix(rest, "defined") {
-			return !p.evaluateIfCondition(rest)
-		}
+	if strings.TrimSpace(expr) == "" {
+		return false, fmt.Errorf("#if with no expression")
 	}
-	
-	// Handle numeric comparisons: 0, 1, etc.
-	if condition == "0" {
-		return false
+	parser := NewParser(expr)
+	node, err := parser.parseTernary()
+	if err != nil {
+		return false, fmt.Errorf("#if %s: %w", condition, err)
 	}
-	if condition == "1" {
-		return true
+	if !parser.isAtEnd() {
+		return false, fmt.Errorf("#if %s: unexpected '%s'", condition, parser.current().Lexeme)
 	}
-	
-	// Try to evaluate as a macro reference
-	if p.IsDefined(condition) {
-		value := p.defines[condition]
-		if value == "0" {
-			return false
+	value, err := evalConstant(node, func(string) (int64, bool) { return 0, true })
+	if err != nil {
+		return false, fmt.Errorf("#if %s: %w", condition, err)
+	}
+	return value != 0, nil
+}
+
+// replaceDefined replaces each defined X and defined(X) in a condition
+// with 1 or 0
+func (p *Preprocessor) replaceDefined(condition string) string {
+	var out strings.Builder
+	for i := 0; i < len(condition); {
+		c := condition[i]
+		if c == '"' || c == '\'' {
+			end := literalEnd(condition, i)
+			out.WriteString(condition[i:end])
+			i = end
+			continue
 		}
-		return true
+		if !isIdentStart(c) {
+			out.WriteByte(c)
+			i++
+			continue
+		}
+		end := identEnd(condition, i)
+		if condition[i:end] != "defined" {
+			out.WriteString(condition[i:end])
+			i = end
+			continue
+		}
+		j := skipSpaces(condition, end)
+		paren := j < len(condition) && condition[j] == '('
+		if paren {
+			j = skipSpaces(condition, j+1)
+		}
+		if j >= len(condition) || !isIdentStart(condition[j]) {
+			out.WriteString("defined")
+			i = end
+			continue
+		}
+		nameEnd := identEnd(condition, j)
+		name := condition[j:nameEnd]
+		j = nameEnd
+		if paren {
+			j = skipSpaces(condition, j)
+			if j >= len(condition) || condition[j] != ')' {
+				out.WriteString("defined")
+				i = end
+				continue
+			}
+			j++
+		}
+		if p.IsDefined(name) {
+			out.WriteString(" 1 ")
+		} else {
+			out.WriteString(" 0 ")
+		}
+		i = j
 	}
-	
-	// Default: undefined macros are false
-	return false
+	return out.String()
+}
+
+func identEnd(s string, i int) int {
+	for i < len(s) && isIdentChar(s[i]) {
+		i++
+	}
+	return i
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+	return i
 }
 
 func (p *Preprocessor) Process(source string) (string, error) {
-	lines := strings.Split(source, "\n")
+	// A BOM on the first line would hide a leading directive
+	source = strings.TrimPrefix(source, utf8BOM)
+	lines := spliceContinuations(strings.Split(source, "\n"))
 	var result strings.Builder
+	var lineMap []SourcePos
+	defer func() { p.lineMap = lineMap }()
 	
 	// Stack for conditional compilation
 	type condState struct {
@@ -321,7 +377,15 @@ func (p *Preprocessor) Process(source string) (string, error) {
 				
 				// Skip system headers (those in angle brackets)
 				if strings.HasPrefix(originalFilename, "<") {
+					if filename == "assert.h" {
+						// Skipped like the rest, but assert is ours (see assert.go)
+						p.mu.Lock()
+						_, ndebug := p.defines["NDEBUG"]
+						p.funcMacros["assert"] = assertMacro(ndebug)
+						p.mu.Unlock()
+					}
 					result.WriteString(fmt.Sprintf("// Skipped system header: %s\n", originalFilename))
+					lineMap = append(lineMap, SourcePos{p.file, i + 1})
 					continue
 				}
 				
@@ -330,11 +394,14 @@ func (p *Preprocessor) Process(source string) (string, error) {
 				if err != nil {
 					// For now, just skip includes we can't find
 					result.WriteString(fmt.Sprintf("// Skipped: #include %s\n", filename))
+					lineMap = append(lineMap, SourcePos{p.file, i + 1})
 					continue
 				}
 				
 				result.WriteString(content)
 				result.WriteString("\n")
+				lineMap = append(lineMap, p.lineMap...)
+				lineMap = append(lineMap, SourcePos{p.file, i + 1})
 				
 			case "#define":
 				if !condStack[len(condStack)-1].active {
@@ -345,54 +412,10 @@ func (p *Preprocessor) Process(source string) (string, error) {
 					return "", fmt.Errorf("line %d: #define requires name", i+1)
 				}
 				
-				// Parse the full line to handle function-like macros
-				// Format: #define NAME(params) body
-				// or: #define NAME value
-				restOfLine := strings.TrimSpace(line[strings.Index(line, directive[1]):])
-				
-				// Check if it's a function-like macro
-				if len(restOfLine) > 0 && strings.Contains(restOfLine, "(") {
-					// Find the opening paren
-					parenIdx := strings.Index(restOfLine, "(")
-					name := restOfLine[:parenIdx]
-					
-					// Check if paren is immediately after name (no space = function macro)
-					if parenIdx == len(name) {
-						// Function-like macro
-						closeParenIdx := strings.Index(restOfLine, ")")
-						if closeParenIdx > parenIdx {
-							// Extract parameters
-							paramsStr := restOfLine[parenIdx+1 : closeParenIdx]
-							params := []string{}
-							if strings.TrimSpace(paramsStr) != "" {
-								for _, param := range strings.Split(paramsStr, ",") {
-									params = append(params, strings.TrimSpace(param))
-								}
-							}
-							
-							// Extract body (everything after closing paren)
-							body := strings.TrimSpace(restOfLine[closeParenIdx+1:])
-							
-							p.mu.Lock()
-							p.funcMacros[name] = &FunctionMacro{
-								Params: params,
-								Body:   body,
-							}
-							p.mu.Unlock()
-							continue
-						}
-					}
-				}
-				
-				// Simple object-like macro
-				name := directive[1]
-				value := ""
-				if len(directive) > 2 {
-					value = strings.Join(directive[2:], " ")
-				}
-				
-				p.Define(name, value)
 				// Don't output the #define itself
+				if err := p.DefineMacro(line[strings.Index(line, "#define")+len("#define"):]); err != nil {
+					return "", fmt.Errorf("line %d: %w", i+1, err)
+				}
 				
 			case "#ifdef":
 				if len(directive) < 2 {
@@ -429,11 +452,17 @@ func (p *Preprocessor) Process(source string) (string, error) {
 				condStack = condStack[:len(condStack)-1]
 				
 			case "#if":
-				// Parse #if expression
-				// For now, support: #if defined(X) and #if !defined(X)
-				restOfLine := strings.TrimSpace(line[strings.Index(line, "#if")+3:])
-				condition := p.evaluateIfCondition(restOfLine)
-				active := condStack[len(condStack)-1].active && condition
+				// Conditions inside a skipped block aren't evaluated
+				active := condStack[len(condStack)-1].active
+				if active {
+					restOfLine := strings.TrimSpace(line[strings.Index(line, "#if")+3:])
+					p.line = i + 1
+					condition, err := p.evaluateIfCondition(restOfLine)
+					if err != nil {
+						return "", fmt.Errorf("line %d: %w", i+1, err)
+					}
+					active = condition
+				}
 				condStack = append(condStack, condState{active: active, taken: active})
 				
 			case "#elif":
@@ -447,7 +476,11 @@ func (p *Preprocessor) Process(source string) (string, error) {
 				
 				if parent && !current.taken {
 					restOfLine := strings.TrimSpace(line[strings.Index(line, "#elif")+5:])
-					condition := p.evaluateIfCondition(restOfLine)
+					p.line = i + 1
+					condition, err := p.evaluateIfCondition(restOfLine)
+					if err != nil {
+						return "", fmt.Errorf("line %d: %w", i+1, err)
+					}
 					current.active = condition
 					if condition {
 						current.taken = true
@@ -472,7 +505,10 @@ func (p *Preprocessor) Process(source string) (string, error) {
 				p.mu.Unlock()
 				
 			case "#pragma":
-				// Ignore pragmas
+				// #pragma once; others are ignored
+				if condStack[len(condStack)-1].active && len(directive) > 1 && directive[1] == "once" {
+					p.pragmaOnce()
+				}
 				
 			default:
 				// Unknown directive - skip
@@ -484,68 +520,82 @@ func (p *Preprocessor) Process(source string) (string, error) {
 		// Only include line if we're in an active block
 		if condStack[len(condStack)-1].active {
 			// Expand macros in the line (proper text substitution)
+			p.line = i + 1
 			expanded := p.expandMacros(line)
 			result.WriteString(expanded)
 			result.WriteString("\n")
+			lineMap = append(lineMap, SourcePos{p.file, i + 1})
 		}
 	}
 	
 	return result.String(), nil
 }
 
-func (p *Preprocessor) processInclude(filename string) (string, error) {
-	// Check if already processed (avoid cycles)
-	if p.processed[filename] {
-		return "", nil
-	}
-	
-	// Try to find the file
-	var fullPath string
-	var found bool
-	
-	// If filename is an absolute path, try it directly first
-	if filepath.IsAbs(filename) {
-		if _, err := os.Stat(filename); err == nil {
-			fullPath = filename
-			found = true
-		}
-	}
-	
-	// Otherwise, search in include paths
-	if !found {
-		for _, searchPath := range p.includePaths {
-			testPath := filepath.Join(searchPath, filename)
-			if _, err := os.Stat(testPath); err == nil {
-				fullPath = testPath
-				found = true
+// spliceContinuations joins each line that ends in a backslash to the
+// next, so a #define (or anything else) can span lines. The joined line
+// takes the place of the first and the lines it took in are left empty,
+// so every line keeps its number.
+func spliceContinuations(lines []string) []string {
+	for i := 0; i < len(lines); i++ {
+		j := i + 1
+		for j < len(lines) {
+			// Trailing blanks after the backslash are forgiven, as gcc does
+			line := strings.TrimRight(lines[i], " \t\r")
+			if !strings.HasSuffix(line, "\\") {
 				break
 			}
+			lines[i] = line[:len(line)-1] + lines[j]
+			lines[j] = ""
+			j++
 		}
+		i = j - 1
 	}
-	
+	return lines
+}
+
+func (p *Preprocessor) processInclude(filename string) (string, error) {
+	fullPath, found := p.findInclude(filename)
 	if !found {
 		return "", fmt.Errorf("include file not found: %s", filename)
 	}
 	
+	// Each header contributes once, if it says so (see include_once.go)
+	key := p.canonicalPath(fullPath)
+	if p.includedOnce(key) {
+		p.lineMap = nil
+		return "", nil
+	}
+	
 	// Read file
-	content, err := os.ReadFile(fullPath)
+	content, err := p.fs.ReadFile(fullPath)
 	if err != nil {
 		return "", err
 	}
-	
-	// Mark as processed
-	p.processed[fullPath] = true
+	if !p.processed[key] {
+		p.processed[key] = true
+		p.includes = append(p.includes, fullPath)
+	}
+	if guard := includeGuard(string(content)); guard != "" {
+		p.guards[key] = guard
+	}
 	
 	// Extract types and function signatures from this header
 	// (Do this BEFORE processing to catch declarations before they're preprocessed away)
-	p.ExtractTypesFromHeader(fullPath)
+	p.ApplyHeaderSummary(p.summarizeHeader(fullPath, content))
 	
 	// Process all files the same way
+	outer := p.file
+	p.file = fullPath
+	p.including = append(p.including, key)
+	defer func() {
+		p.file = outer
+		p.including = p.including[:len(p.including)-1]
+	}()
 	return p.Process(string(content))
 }
 
 func (p *Preprocessor) processHeaderSimple(source string) (string, error) {
-	lines := strings.Split(source, "\n")
+	lines := spliceContinuations(strings.Split(source, "\n"))
 	var result strings.Builder
 	
 	type condState struct {
@@ -664,21 +714,51 @@ func (p *Preprocessor) processHeaderSimple(source string) (string, error) {
 	return result.String(), nil
 }
 
+// paintMark goes before a macro's name inside its own expansion, where it
+// isn't expanded again (so #define stdin stdin is stdin); expandMacros
+// removes the marks when it's done
+const paintMark = "\x01"
+
+// maxExpansionPasses bounds rescanning, for macros that expand each other
+// without end
+const maxExpansionPasses = 32
+
 func (p *Preprocessor) expandMacros(line string) string {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 	
 	result := line
 	
-	// First expand function-like macros
-	for name, macro := range p.funcMacros {
-		result = p.expandFunctionMacro(result, name, macro)
+	// Expansions are rescanned for the macros they use, until none are left
+	for pass := 0; pass < maxExpansionPasses; pass++ {
+		before := result
+		
+		// First expand function-like macros
+		for name, macro := range p.funcMacros {
+			result = p.expandFunctionMacro(result, name, macro)
+		}
+		
+		// Then expand object-like macros
+		for name, value := range p.defines {
+			if strings.Contains(result, name) {
+				// Use word boundary matching
+				result = replaceIdentifier(result, name, paintName(value, name))
+			}
+		}
+		
+		if result == before {
+			break
+		}
 	}
+	result = strings.ReplaceAll(result, paintMark, "")
 	
-	// Then expand object-like macros
-	for name, value := range p.defines {
-		// Use word boundary matching
-		result = replaceIdentifier(result, name, value)
+	// Last, so they're also expanded where other macros used them. A -D of
+	// either has already replaced it.
+	if strings.Contains(result, "__FILE__") {
+		result = replaceIdentifier(result, "__FILE__", strconv.Quote(p.currentFile()))
+	}
+	if strings.Contains(result, "__LINE__") {
+		result = replaceIdentifier(result, "__LINE__", strconv.Itoa(p.line))
 	}
 	
 	return result
@@ -692,7 +772,7 @@ func (p *Preprocessor) expandFunctionMacro(text string, name string, macro *Func
 		// Check if we found the macro name
 		if strings.HasPrefix(text[i:], name) {
 			// Check if it's a complete identifier followed by (
-			if (i == 0 || !isIdentifierChar(text[i-1])) {
+			if i == 0 || (!isIdentifierChar(text[i-1]) && text[i-1] != paintMark[0]) {
 				// Check for opening paren
 				j := i + len(name)
 				// Skip whitespace
@@ -709,6 +789,13 @@ func (p *Preprocessor) expandFunctionMacro(text string, name string, macro *Func
 					currentArg := ""
 					
 					for j < len(text) && depth > 0 {
+						if text[j] == '"' || text[j] == '\'' {
+							// Commas and parens in literals don't count
+							end := literalEnd(text, j)
+							currentArg += text[j:end]
+							j = end
+							continue
+						}
 						if text[j] == '(' {
 							depth++
 							currentArg += string(text[j])
@@ -732,9 +819,14 @@ func (p *Preprocessor) expandFunctionMacro(text string, name string, macro *Func
 						j++
 					}
 					
-					// Substitute parameters in body
-					expansion := macro.Body
-					for idx, param := range macro.Params {
+					// Substitute parameters in body: #param first, as a string
+					body, params := paintName(macro.Body, name), macro.Params
+					if macro.Variadic {
+						params, args = variadicArgs(macro, args)
+						body = deleteVariadicComma(body, args[len(args)-1])
+					}
+					expansion := stringizeParams(body, params, args)
+					for idx, param := range params {
 						if idx < len(args) {
 							expansion = replaceIdentifier(expansion, param, args[idx])
 						}
@@ -754,15 +846,103 @@ func (p *Preprocessor) expandFunctionMacro(text string, name string, macro *Func
 	return result.String()
 }
 
+// variadicArgs binds the arguments of a variadic macro to its parameters:
+// each named one takes its own (empty if it's missing) and __VA_ARGS__ the
+// rest, with their commas
+func variadicArgs(macro *FunctionMacro, args []string) (params, bound []string) {
+	params = append(append([]string(nil), macro.Params...), "__VA_ARGS__")
+	bound = make([]string, len(params))
+	copy(bound, args)
+	if len(args) > len(macro.Params) {
+		bound[len(macro.Params)] = strings.Join(args[len(macro.Params):], ", ")
+	}
+	return params, bound
+}
+
+// variadicComma is GNU's ", ## __VA_ARGS__"
+var variadicComma = regexp.MustCompile(`,\s*##\s*__VA_ARGS__`)
+
+// deleteVariadicComma drops the comma of ", ## __VA_ARGS__" when there are
+// no variable arguments, so LOG("x") can expand to printf("x"), and the ##
+// when there are
+func deleteVariadicComma(body, varArgs string) string {
+	replacement := ", __VA_ARGS__"
+	if varArgs == "" {
+		replacement = ""
+	}
+	return variadicComma.ReplaceAllLiteralString(body, replacement)
+}
+
+// stringizeParams replaces each #param in a macro body with the argument's
+// text as a string literal
+func stringizeParams(body string, params, args []string) string {
+	if !strings.Contains(body, "#") {
+		return body
+	}
+	var result strings.Builder
+	for i := 0; i < len(body); i++ {
+		if body[i] == '"' || body[i] == '\'' {
+			end := literalEnd(body, i)
+			result.WriteString(body[i:end])
+			i = end - 1
+			continue
+		}
+		if body[i] != '#' || (i+1 < len(body) && body[i+1] == '#') || (i > 0 && body[i-1] == '#') {
+			result.WriteByte(body[i])
+			continue
+		}
+		j := i + 1
+		for j < len(body) && (body[j] == ' ' || body[j] == '\t') {
+			j++
+		}
+		k := j
+		for k < len(body) && isIdentifierChar(body[k]) {
+			k++
+		}
+		stringized := false
+		for idx, param := range params {
+			if body[j:k] == param && idx < len(args) {
+				arg := strings.ReplaceAll(args[idx], `\`, `\\`)
+				result.WriteString(`"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`)
+				stringized = true
+				break
+			}
+		}
+		if stringized {
+			i = k - 1
+			continue
+		}
+		result.WriteByte(body[i])
+	}
+	return result.String()
+}
+
+// paintName marks each use of a macro's own name in its body (see paintMark)
+func paintName(body, name string) string {
+	if !strings.Contains(body, name) {
+		return body
+	}
+	return replaceIdentifier(body, name, paintMark+name)
+}
+
 func replaceIdentifier(text, identifier, replacement string) string {
 	var result strings.Builder
 	i := 0
 	
 	for i < len(text) {
+		// Nothing inside string and character literals is a macro
+		if text[i] == '"' || text[i] == '\'' {
+			end := literalEnd(text, i)
+			result.WriteString(text[i:end])
+			i = end
+			continue
+		}
+
 		// Check if we found the identifier
 		if strings.HasPrefix(text[i:], identifier) {
-			// Check if it's a complete identifier (not part of another word)
-			if (i == 0 || !isIdentifierChar(text[i-1])) &&
+			// Check if it's a complete identifier (not part of another word
+			// or painted)
+			if (i == 0 || (!isIdentifierChar(text[i-1]) && text[i-1] != paintMark[0])) &&
 			   (i+len(identifier) >= len(text) || !isIdentifierChar(text[i+len(identifier)])) {
 				result.WriteString(replacement)
 				i += len(identifier)
@@ -777,13 +957,37 @@ func replaceIdentifier(text, identifier, replacement string) string {
 	return result.String()
 }
 
+// literalEnd is the index just past the string or character literal that
+// starts at text[start] (or len(text) if it isn't closed on this line)
+func literalEnd(text string, start int) int {
+	quote := text[start]
+	for i := start + 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return len(text)
+}
+
 func isIdentifierChar(c byte) bool {
 	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_'
 }
 
+// SourcePosition maps a line of the last Process output (1-based) back to
+// where it came from
+func (p *Preprocessor) SourcePosition(line int) SourcePos {
+	if line < 1 || line > len(p.lineMap) {
+		return SourcePos{Line: line}
+	}
+	return p.lineMap[line-1]
+}
+
 // ProcessFile is a convenience function to preprocess a file
 func (p *Preprocessor) ProcessFile(filename string) (string, error) {
-	content, err := os.ReadFile(filename)
+	content, err := p.fs.ReadFile(filename)
 	if err != nil {
 		return "", err
 	}
@@ -793,14 +997,20 @@ func (p *Preprocessor) ProcessFile(filename string) (string, error) {
 
 // ExtractTypesFromHeader parses a header file to extract typedef and struct definitions
 func (p *Preprocessor) ExtractTypesFromHeader(filename string) error {
-	content, err := os.ReadFile(filename)
+	content, err := p.fs.ReadFile(filename)
 	if err != nil {
 		return err
 	}
-	
+	p.ApplyHeaderSummary(p.summarizeHeader(filename, content))
+	return nil
+}
+
+// scanHeader collects a header's typedef and struct definitions and
+// function declarations (see header_summary.go)
+func (p *Preprocessor) scanHeader(content []byte) *HeaderSummary {
+	summary := &HeaderSummary{Functions: make(map[string]*FunctionSignature)}
 	lines := strings.Split(string(content), "\n")
 	
-	// First pass: collect all struct and typedef definitions
 	for i := 0; i < len(lines); i++ {
 		line := strings.TrimSpace(lines[i])
 		
@@ -818,26 +1028,70 @@ func (p *Preprocessor) ExtractTypesFromHeader(filename string) error {
 			}
 			
 			// Parse the typedef
-			p.parseTypedefStruct(structDef)
+			if typ := p.parseTypedefStruct(structDef); typ != nil {
+				summary.Types = append(summary.Types, typ)
+			}
 		} else if strings.HasPrefix(line, "typedef ") && !strings.Contains(line, "{") {
+			// typedef void (*Callback)(int); or typedef int Matrix[4][4];
+			if typ := parseHeaderTypedef(line); typ != nil {
+				summary.Types = append(summary.Types, typ)
+				continue
+			}
 			// Simple typedef alias: typedef OldType NewType;
-			p.parseSimpleTypedef(line)
+			if typ := parseSimpleTypedef(line); typ != nil {
+				summary.Types = append(summary.Types, typ)
+			}
+			continue
 		}
 		// Also extract function declarations for tracking return types
 		// Look for RLAPI function declarations (raylib API functions)
 		if strings.Contains(line, "RLAPI ") || (strings.Contains(line, "(") && strings.Contains(line, ");")) {
-			p.parseFunctionDeclaration(line)
+			if name, sig := parseFunctionDeclaration(line); sig != nil {
+				summary.Functions[name] = sig
+			}
+		}
+	}
+	return summary
+}
+
+// ApplyHeaderSummary adds a header's types and function signatures to
+// those already known, in the order the header defines them
+func (p *Preprocessor) ApplyHeaderSummary(summary *HeaderSummary) {
+	for _, typ := range summary.Types {
+		if typ.Typedef != nil {
+			p.typedefTypes[typ.Name] = typ.Typedef
+			continue
 		}
+		if typ.Alias != "" {
+			p.applySimpleTypedef(typ.Name, typ.Alias)
+			continue
+		}
+		// Structs are laid out in place, so each application gets its own members
+		structType := &StructDef{
+			Name:    typ.Name,
+			Members: append([]StructMember(nil), typ.Members...),
+		}
+		
+		// Store under the typedef name
+		p.typedefMap[typ.Name] = structType
+		p.structMap[typ.Name] = structType
+		
+		// Also store under the struct name if it exists and is different
+		if typ.Tag != "" && typ.Tag != typ.Name {
+			p.structMap[typ.Tag] = structType
+		}
+	}
+	for name, sig := range summary.Functions {
+		copied := *sig
+		p.functionSigs[name] = &copied
 	}
 	
-	// Second pass: resolve struct sizes now that all structs are known
+	// Lay out the structs now that all of them are known
 	p.resolveStructSizes()
-	
-	return nil
 }
 
 // parseSimpleTypedef parses a simple type alias
-func (p *Preprocessor) parseSimpleTypedef(line string) {
+func parseSimpleTypedef(line string) *HeaderType {
 	// Example: typedef Texture Texture2D;
 	// Example: typedef struct Color Color;
 	
@@ -849,31 +1103,31 @@ func (p *Preprocessor) parseSimpleTypedef(line string) {
 	// Split into tokens
 	tokens := strings.Fields(line)
 	if len(tokens) < 2 {
-		return
+		return nil
 	}
 	
-	// Last token is the new type name
-	newTypeName := tokens[len(tokens)-1]
-	// Everything before is the old type
-	oldType := strings.Join(tokens[:len(tokens)-1], " ")
-	
+	// Last token is the new type name, everything before is the old type
+	return &HeaderType{
+		Name:  tokens[len(tokens)-1],
+		Alias: strings.Join(tokens[:len(tokens)-1], " "),
+	}
+}
+
+// applySimpleTypedef defines newTypeName as an alias of oldType
+func (p *Preprocessor) applySimpleTypedef(newTypeName, oldType string) {
 	// For simple aliases, we just create a struct with the same definition as the original
 	// If the original is in our structMap, copy it
 	if existing, ok := p.structMap[oldType]; ok {
 		p.typedefMap[newTypeName] = existing
 		p.structMap[newTypeName] = existing
 	} else {
-		// Otherwise, create a placeholder struct
-		// This allows the typedef to be recognized even if we don't know the full definition
-		p.typedefMap[newTypeName] = &StructDef{
-			Name: newTypeName,
-			Members: []StructMember{},
-		}
+		// Otherwise it's sized as whatever it names
+		p.typeAliases[newTypeName] = oldType
 	}
 }
 
 // parseTypedefStruct parses a typedef struct definition
-func (p *Preprocessor) parseTypedefStruct(def string) {
+func (p *Preprocessor) parseTypedefStruct(def string) *HeaderType {
 	// Example: typedef struct { float x; float y; } Vector2;
 	// Example: typedef struct Color { unsigned char r, g, b, a; } Color;
 	// Example: typedef struct RenderTexture { ... } RenderTexture;
@@ -881,7 +1135,7 @@ func (p *Preprocessor) parseTypedefStruct(def string) {
 	// Find the type name (after closing brace)
 	closeBraceIdx := strings.LastIndex(def, "}")
 	if closeBraceIdx == -1 {
-		return
+		return nil
 	}
 	
 	afterBrace := strings.TrimSpace(def[closeBraceIdx+1:])
@@ -890,7 +1144,7 @@ func (p *Preprocessor) parseTypedefStruct(def string) {
 	
 	typeName := afterBrace
 	if typeName == "" {
-		return
+		return nil
 	}
 	
 	// Extract struct name if it exists (between "struct" and "{")
@@ -905,41 +1159,20 @@ func (p *Preprocessor) parseTypedefStruct(def string) {
 	
 	// Extract member definitions between braces
 	if openBraceIdx == -1 {
-		return
+		return nil
 	}
 	
 	membersStr := def[openBraceIdx+1 : closeBraceIdx]
-	members := p.parseStructMembers(membersStr)
-	
-	// Calculate total size
-	totalSize := 0
-	for _, member := range members {
-		if member.Offset+member.Size > totalSize {
-			totalSize = member.Offset + member.Size
-		}
-	}
-	
-	// Create struct type
-	structType := &StructDef{
+	return &HeaderType{
 		Name:    typeName,
-		Members: members,
-		Size:    totalSize,
-	}
-	
-	// Store under the typedef name
-	p.typedefMap[typeName] = structType
-	p.structMap[typeName] = structType
-	
-	// Also store under the struct name if it exists and is different
-	if structName != "" && structName != typeName {
-		p.structMap[structName] = structType
+		Tag:     structName,
+		Members: p.parseStructMembers(membersStr),
 	}
 }
 
 // parseStructMembers parses struct member declarations
 func (p *Preprocessor) parseStructMembers(membersStr string) []StructMember {
 	var members []StructMember
-	offset := 0
 	
 	// Split by semicolon to get individual member declarations
 	declarations := strings.Split(membersStr, ";")
@@ -964,21 +1197,13 @@ func (p *Preprocessor) parseStructMembers(membersStr string) []StructMember {
 		namesStr := parts[len(parts)-1]
 		names := strings.Split(namesStr, ",")
 		
+		// Offsets and sizes come when the struct is laid out, once every
+		// struct a member might be is known
 		memberType := p.mapTypeString(typeStr)
-		// Get size for basic types only during parsing
-		// Struct sizes will be calculated later
-		memberSize := p.getBasicTypeSize(memberType)
-		
 		for _, name := range names {
 			name = strings.TrimSpace(name)
 			if name != "" {
-				members = append(members, StructMember{
-					Name:   name,
-					Type:   memberType,
-					Offset: offset,
-					Size:   memberSize,
-				})
-				offset += memberSize
+				members = append(members, StructMember{Name: name, Type: memberType})
 			}
 		}
 	}
@@ -986,94 +1211,9 @@ func (p *Preprocessor) parseStructMembers(membersStr string) []StructMember {
 	return members
 }
 
-// getBasicTypeSize returns size of basic types without recursion
-func (p *Preprocessor) getBasicTypeSize(typ string) int {
-	typ = strings.TrimSpace(typ)
-	
-	// Pointers are 8 bytes
-	if strings.HasSuffix(typ, "*") {
-		return 8
-	}
-	
-	// Basic types
-	switch typ {
-	case "char", "signed char", "unsigned char":
-		return 1
-	case "short", "short int", "signed short", "unsigned short":
-		return 2
-	case "int", "signed int", "unsigned int":
-		return 4
-	case "long", "signed long", "unsigned long", "long long", "signed long long", "unsigned long long":
-		return 8
-	case "float":
-		return 4
-	case "double":
-		return 8
-	case "void":
-		return 0
-	default:
-		// For unknown types (including other structs), use a placeholder
-		// The actual size will be resolved later
-		return 0
-	}
-}
-
-// getTypeSize returns the size in bytes of a type
-func (p *Preprocessor) getTypeSize(typ string) int {
-	return p.getTypeSizeHelper(typ, make(map[string]bool))
-}
-
-func (p *Preprocessor) getTypeSizeHelper(typ string, visited map[string]bool) int {
-	// Prevent infinite recursion
-	if visited[typ] {
-		return 8 // Default to break cycle
-	}
-	visited[typ] = true
-	
-	typ = strings.TrimSpace(typ)
-	
-	// Pointers are 8 bytes
-	if strings.HasSuffix(typ, "*") {
-		return 8
-	}
-	
-	// Check if it's a known struct
-	if structDef, ok := p.structMap[typ]; ok {
-		return structDef.Size
-	}
-	
-	// Check for struct prefix
-	if strings.HasPrefix(typ, "struct ") {
-		structName := strings.TrimSpace(typ[7:])
-		if structDef, ok := p.structMap[structName]; ok {
-			return structDef.Size
-		}
-	}
-	
-	// Check typedef map
-	if structDef, ok := p.typedefMap[typ]; ok {
-		return structDef.Size
-	}
-	
-	// Basic types
-	switch typ {
-	case "char", "signed char", "unsigned char":
-		return 1
-	case "short", "short int", "signed short", "unsigned short":
-		return 2
-	case "int", "signed int", "unsigned int":
-		return 4
-	case "long", "signed long", "unsigned long", "long long", "signed long long", "unsigned long long":
-		return 8
-	case "float":
-		return 4
-	case "double":
-		return 8
-	case "void":
-		return 0
-	default:
-		return 8 // Default for unknown types
-	}
+// types sizes types by the headers' structs and typedefs
+func (p *Preprocessor) types() *TypeInfo {
+	return &TypeInfo{target: p.target, structs: p.structMap, typedefs: p.typeAliases, derived: p.typedefTypes}
 }
 
 // mapTypeString converts C type string to internal type
@@ -1105,27 +1245,27 @@ func (p *Preprocessor) mapTypeString(typeStr string) string {
 }
 
 // parseFunctionDeclaration parses a function declaration to extract return type
-func (p *Preprocessor) parseFunctionDeclaration(line string) {
+func parseFunctionDeclaration(line string) (string, *FunctionSignature) {
 	// Clean up the line
 	line = strings.TrimSpace(line)
 	line = strings.ReplaceAll(line, "RLAPI ", "")
 	
 	// Skip if it doesn't look like a function declaration
 	if !strings.Contains(line, "(") || !strings.Contains(line, ")") {
-		return
+		return "", nil
 	}
 	
 	// Find the function name and return type
 	// Format: ReturnType FunctionName(params);
 	parenIdx := strings.Index(line, "(")
 	if parenIdx == -1 {
-		return
+		return "", nil
 	}
 	
 	beforeParen := strings.TrimSpace(line[:parenIdx])
 	parts := strings.Fields(beforeParen)
 	if len(parts) < 2 {
-		return
+		return "", nil
 	}
 	
 	// Last part is function name, everything before is return type
@@ -1136,17 +1276,22 @@ func (p *Preprocessor) parseFunctionDeclaration(line string) {
 	paramStart := parenIdx + 1
 	paramEnd := strings.Index(line[paramStart:], ")")
 	if paramEnd == -1 {
-		return
+		return "", nil
 	}
 	
 	paramsStr := strings.TrimSpace(line[paramStart : paramStart+paramEnd])
 	var paramTypes []string
+	variadic := false
 	
 	if paramsStr != "" && paramsStr != "void" {
 		// Split by comma
 		params := strings.Split(paramsStr, ",")
 		for _, param := range params {
 			param = strings.TrimSpace(param)
+			if param == "..." {
+				variadic = true
+				continue
+			}
 			// Extract just the type (remove parameter name)
 			paramParts := strings.Fields(param)
 			if len(paramParts) > 0 {
@@ -1163,54 +1308,47 @@ func (p *Preprocessor) parseFunctionDeclaration(line string) {
 		}
 	}
 	
-	// Store the function signature
-	p.functionSigs[funcName] = &FunctionSignature{
+	return funcName, &FunctionSignature{
 		ReturnType: returnType,
 		ParamTypes: paramTypes,
+		Variadic:   variadic,
 	}
 }
 
-// resolveStructSizes computes actual sizes of all structs after they're all parsed
+// resolveStructSizes lays out the structs not laid out yet, each after the
+// structs its members are, so a nested struct has its size when the one
+// holding it is laid out
 func (p *Preprocessor) resolveStructSizes() {
-// Keep resolving until no changes (handles nested structs)
-maxIterations := 10
-for iter := 0; iter < maxIterations; iter++ {
-changed := false
-
-for _, structDef := range p.structMap {
-if structDef.Size > 0 {
-continue // Already computed
-}
-
-// Compute size from members
-totalSize := 0
-allResolved := true
-
-for i := range structDef.Members {
-member := &structDef.Members[i]
-if member.Size == 0 {
-// Try to resolve the member size
-memberSize := p.getTypeSizeHelper(member.Type, make(map[string]bool))
-if memberSize > 0 {
-member.Size = memberSize
-member.Offset = totalSize
-totalSize += memberSize
-} else {
-allResolved = false
-}
-} else {
-totalSize = member.Offset + member.Size
-}
-}
-
-if allResolved && totalSize > 0 {
-structDef.Size = totalSize
-changed = true
-}
-}
-
-if !changed {
-break
-}
-}
+	types := p.types()
+	ready := func(def *StructDef) bool {
+		for _, member := range def.Members {
+			if _, _, ok := types.Lookup(member.Type); !ok && member.Size == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	pending := make(map[*StructDef]bool)
+	for _, def := range p.structMap {
+		if def.Size == 0 && len(def.Members) > 0 {
+			pending[def] = true
+		}
+	}
+	for len(pending) > 0 {
+		progress := false
+		for def := range pending {
+			if ready(def) {
+				types.Layout(def, false)
+				delete(pending, def)
+				progress = true
+			}
+		}
+		if !progress {
+			// The rest hold types no header defines, or each other
+			for def := range pending {
+				types.Layout(def, false)
+			}
+			return
+		}
+	}
 }
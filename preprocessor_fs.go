@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SourceFS abstracts how the preprocessor finds and reads source files
+// The default reads the real filesystem; -fheader-overlay= serves headers
+// from memory on top of it, and embedders can inject their own with
+// SetFileSystem so includes are machine-independent
+type SourceFS interface {
+	ReadFile(name string) ([]byte, error)
+	Exists(name string) bool
+	EvalSymlinks(name string) (string, error) // the path with its links resolved
+}
+
+// osFS reads from the host filesystem
+type osFS struct{}
+
+func (osFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (osFS) Exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func (osFS) EvalSymlinks(name string) (string, error) {
+	return filepath.EvalSymlinks(name)
+}
+
+// MapFS is an in-memory SourceFS keyed by cleaned absolute path
+type MapFS map[string]string
+
+func mapFSKey(name string) string {
+	if abs, err := filepath.Abs(name); err == nil {
+		name = abs
+	}
+	return filepath.Clean(name)
+}
+
+func (m MapFS) ReadFile(name string) ([]byte, error) {
+	content, ok := m[mapFSKey(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return []byte(content), nil
+}
+
+func (m MapFS) Exists(name string) bool {
+	_, ok := m[mapFSKey(name)]
+	return ok
+}
+
+// EvalSymlinks is name itself: there are no links in memory
+func (m MapFS) EvalSymlinks(name string) (string, error) {
+	if !m.Exists(name) {
+		return "", &os.PathError{Op: "lstat", Path: name, Err: os.ErrNotExist}
+	}
+	return name, nil
+}
+
+// overlayFS serves the files in top and reads the rest from base
+type overlayFS struct {
+	top  MapFS
+	base SourceFS
+}
+
+func (o overlayFS) ReadFile(name string) ([]byte, error) {
+	if o.top.Exists(name) {
+		return o.top.ReadFile(name)
+	}
+	return o.base.ReadFile(name)
+}
+
+func (o overlayFS) Exists(name string) bool {
+	return o.top.Exists(name) || o.base.Exists(name)
+}
+
+func (o overlayFS) EvalSymlinks(name string) (string, error) {
+	if o.top.Exists(name) {
+		return name, nil
+	}
+	return o.base.EvalSymlinks(name)
+}
+
+// LoadHeaderOverlay reads a -fheader-overlay= file: a JSON object from
+// paths, relative to the file's directory, to their contents
+func LoadHeaderOverlay(path string) (MapFS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("header overlay: %w", err)
+	}
+	var files map[string]string
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, fmt.Errorf("header overlay %s: %w", path, err)
+	}
+	overlay := make(MapFS, len(files))
+	for name, content := range files {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(filepath.Dir(path), name)
+		}
+		overlay[mapFSKey(name)] = content
+	}
+	return overlay, nil
+}
+
+// SetFileSystem replaces the filesystem the compile reads headers, header
+// summaries and library profiles from
+func (cp *CompilerPipeline) SetFileSystem(fsys SourceFS) {
+	cp.fs = fsys
+}
+
+// fileSystem is the one given to SetFileSystem (the host's by default),
+// under the -fheader-overlay= files
+func (cp *CompilerPipeline) fileSystem() (SourceFS, error) {
+	fsys := cp.fs
+	if fsys == nil {
+		fsys = osFS{}
+	}
+	if cp.options.HeaderOverlay == "" {
+		return fsys, nil
+	}
+	top, err := LoadHeaderOverlay(cp.options.HeaderOverlay)
+	if err != nil {
+		return nil, err
+	}
+	return overlayFS{top, fsys}, nil
+}
+
+// SetFileSystem replaces the filesystem used for #include and header scanning
+func (p *Preprocessor) SetFileSystem(fsys SourceFS) {
+	if fsys == nil {
+		fsys = osFS{}
+	}
+	p.fs = fsys
+}
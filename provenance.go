@@ -0,0 +1,71 @@
+package main
+
+import "fmt"
+
+// Provenance
+// Each IR instruction carries the line of the statement it was selected
+// from, which is a line of the preprocessed source, and the function that
+// statement is in. Once the IR passes are done (and before the verifier
+// looks at it), attachProvenance maps every line back through the
+// preprocessor to the file and line it came from, so what's reported about
+// an instruction points at code the user wrote:
+//
+//   - -emit-asm-annotated comments the assembly with "# foo.c:42: <line>"
+//     (on AArch64, "// foo.c:42: <line>")
+//   - the IR verifier's errors give the position and function
+//
+// Inlined code keeps the callee's lines and name, so it points into the
+// callee. Instructions added after selection with no line of their own (a
+// jump to rejoin a moved cold block, say) just get the function they're in.
+
+// String renders a position as "file:line", or "line N" when the file
+// isn't known
+func (pos SourcePos) String() string {
+	if pos.File == "" {
+		return fmt.Sprintf("line %d", pos.Line)
+	}
+	return fmt.Sprintf("%s:%d", pos.File, pos.Line)
+}
+
+// attachProvenance fills in every instruction's Pos, and Func where the
+// selector didn't set it
+func (cp *CompilerPipeline) attachProvenance(instrs []*IRInstruction) {
+	function := ""
+	for _, instr := range instrs {
+		if instr.Op == OpLabel && isFunctionLabel(instr.Dst.Value) {
+			function = instr.Dst.Value
+		}
+		if instr.Func == "" {
+			instr.Func = function
+		}
+		if instr.Line > 0 {
+			instr.Pos = cp.sourcePos(instr.Line)
+		}
+	}
+}
+
+// sourcePos is where a line of the preprocessed source came from
+func (cp *CompilerPipeline) sourcePos(line int) SourcePos {
+	pos := SourcePos{Line: line}
+	if cp.preprocessor != nil {
+		pos = cp.preprocessor.SourcePosition(line)
+	}
+	if pos.File == "" {
+		pos.File = cp.options.SourceFile
+	}
+	return pos
+}
+
+// origin says where an instruction came from: "foo.c:42: in function 'f'",
+// as much of it as is known
+func (instr *IRInstruction) origin() string {
+	where := fmt.Sprintf("in function '%s'", instr.Func)
+	if instr.Line <= 0 {
+		return where
+	}
+	pos := instr.Pos
+	if pos.Line == 0 {
+		pos.Line = instr.Line
+	}
+	return pos.String() + ": " + where
+}
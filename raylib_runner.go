@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// raylib example runner: ccompiler raylib-test <examples_dir> [--report=file] [options]
+// Every .c file under dir (raylib keeps its examples in core/, shapes/,
+// textures/ and so on) is compiled and linked with the usual compiler
+// options, the raylib profile's among them. The examples open windows, so
+// nothing is run. Each one that doesn't build is classified by the phase it
+// stopped in:
+//
+//	preprocess   #include, macros and the header signatures
+//	parse        parsing and type checking
+//	select       instruction selection and the IR checks after it
+//	emit         register allocation and emission, and assembly the
+//	             assembler rejects
+//	link         undefined symbols and the linker
+//
+// A panic counts against the phase it happened in. The summary gives the
+// failures per phase and how many examples built; the report, JSON written
+// to raylib-report.json (or --report), has the same plus each example's
+// phase and first error, so the count can be tracked from run to run and
+// the most common failures fixed first.
+
+// raylibPhases are the phases failures are classified by, in pipeline order
+var raylibPhases = []string{"preprocess", "parse", "select", "emit", "link"}
+
+// raylibPhaseOf maps the pipeline's phases (see CompilerPipeline.enter)
+// to the report's
+var raylibPhaseOf = map[string]string{
+	"preprocess": "preprocess",
+	"parse":      "parse",
+	"typecheck":  "parse",
+	"select":     "select",
+	"regalloc":   "emit",
+	"emit":       "emit",
+	"link":       "link",
+}
+
+// raylibExample is one example's entry in the report
+type raylibExample struct {
+	Name  string `json:"name"` // its path under the examples directory, without .c
+	Built bool   `json:"built"`
+	Phase string `json:"phase,omitempty"` // where it failed
+	Error string `json:"error,omitempty"` // the first error
+}
+
+// raylibReport is the report raylib-test writes
+type raylibReport struct {
+	Dir      string          `json:"dir"`
+	Total    int             `json:"total"`
+	Built    int             `json:"built"`
+	Failures map[string]int  `json:"failures"` // by phase
+	Examples []raylibExample `json:"examples"`
+}
+
+// runRaylibTestCommand implements the raylib-test subcommand and returns
+// the exit status
+func runRaylibTestCommand(args []string) int {
+	reportPath := "raylib-report.json"
+	var rest []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--report=") {
+			reportPath = strings.TrimPrefix(arg, "--report=")
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	cl, err := parseCommandLine(rest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	dir := cl.sourceFile
+	if dir == "" {
+		fmt.Fprintln(os.Stderr, "Usage: ccompiler raylib-test <examples_dir> [--report=file] [options]")
+		return 2
+	}
+	var sources []string
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && strings.HasSuffix(path, ".c") {
+			sources = append(sources, path)
+		}
+		return err
+	})
+	if err != nil || len(sources) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no .c files under %s\n", dir)
+		return 2
+	}
+	sort.Strings(sources)
+
+	workDir, err := os.MkdirTemp("", "ccompiler-raylib-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	defer os.RemoveAll(workDir)
+
+	report := raylibReport{Dir: dir, Total: len(sources), Failures: make(map[string]int)}
+	for _, phase := range raylibPhases {
+		report.Failures[phase] = 0
+	}
+	for i, source := range sources {
+		name, _ := filepath.Rel(dir, source)
+		name = filepath.ToSlash(strings.TrimSuffix(name, ".c"))
+		example := raylibExample{Name: name}
+		phase, err := buildExample(source, filepath.Join(workDir, fmt.Sprintf("example%d", i)), cl.options)
+		if err != nil {
+			example.Phase, example.Error = phase, firstError(err)
+			report.Failures[phase]++
+			fmt.Printf("FAIL  %s (%s): %s\n", name, phase, example.Error)
+		} else {
+			example.Built = true
+			report.Built++
+			fmt.Printf("OK    %s\n", name)
+		}
+		report.Examples = append(report.Examples, example)
+	}
+
+	fmt.Println("\nFailures by phase:")
+	for _, phase := range raylibPhases {
+		fmt.Printf("  %-10s %d\n", phase, report.Failures[phase])
+	}
+	fmt.Printf("\n%d of %d examples built (%.1f%%)\n", report.Built, report.Total, 100*float64(report.Built)/float64(report.Total))
+
+	data, _ := json.MarshalIndent(report, "", "  ")
+	if err := os.WriteFile(reportPath, append(data, '\n'), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	fmt.Printf("Report written to %s\n", reportPath)
+	return 0
+}
+
+// buildExample compiles and links source into binary, and if that fails
+// says which phase it failed in
+func buildExample(source, binary string, options CompilerOptions) (phase string, err error) {
+	text, err := os.ReadFile(source)
+	if err != nil {
+		return "preprocess", err
+	}
+	options.SourceFile = source
+	compiler := NewCompilerPipeline(string(text), options)
+	defer func() {
+		if r := recover(); r != nil {
+			phase, err = raylibPhaseOf[compiler.phase], fmt.Errorf("compiler panicked: %v", r)
+		}
+	}()
+	if err := compiler.Compile(); err != nil {
+		return raylibPhaseOf[compiler.phase], err
+	}
+	if err := compiler.Link(binary); err != nil {
+		if strings.Contains(err.Error(), "Assembler messages:") {
+			// The emitted assembly is what's wrong
+			return "emit", err
+		}
+		return "link", err
+	}
+	return "", nil
+}
@@ -5,16 +5,104 @@ import (
 	"sort"
 )
 
+// allocatableRegs are the registers temps may be given. The code emitter
+// moves through %rax wherever an instruction can't take two memory
+// operands (a spilled temp, a variable, a label's address), so %rax never
+// holds a temp; %r11 is its second scratch register (divisors, array
+// indexes), so it doesn't either.
+func allocatableRegs() []int {
+	return []int{RBX, RCX, RDX, RSI, RDI, R8, R9, R10, R12, R13, R14, R15}
+}
+
+// allocatableReg is the allocatable register named name
+func allocatableReg(name string) (int, bool) {
+	for _, reg := range allocatableRegs() {
+		if regNames[reg] == name {
+			return reg, true
+		}
+	}
+	return 0, false
+}
+
+// callerSavedRegs are the allocatable registers a callee may change
+var callerSavedRegs = []int{RCX, RDX, RSI, RDI, R8, R9, R10}
+
+// clobber is an instruction that writes registers behind the allocator's
+// back
+type clobber struct {
+	index int
+	regs  []int
+}
+
+// findClobbers lists, in order, the instructions that write registers the
+// allocator doesn't assign: a call changes the registers it lists in
+// Clobbers (every caller-saved one), so a temp live across it gets a
+// callee-saved register or a spill slot; division leaves the remainder in %rdx (cqto/idiv), a variable shift needs
+// its count in %cl, the syscall instruction overwrites %rcx with the
+// return address, and argument setup (or anything else selected into a
+// named register) changes the register it names
+func findClobbers(instrs []*IRInstruction) []clobber {
+	var clobbers []clobber
+	for i, instr := range instrs {
+		switch {
+		case len(instr.Clobbers) > 0:
+			clobbers = append(clobbers, clobber{i, instr.Clobbers})
+			continue
+		case instr.Op == OpDiv || instr.Op == OpMod:
+			clobbers = append(clobbers, clobber{i, []int{RDX}})
+			continue
+		case (instr.Op == OpShl || instr.Op == OpShr) && instr.Src2 != nil && instr.Src2.Type != "imm":
+			clobbers = append(clobbers, clobber{i, []int{RCX}})
+			continue
+		case instr.Op == OpSyscall:
+			clobbers = append(clobbers, clobber{i, []int{RCX}})
+			continue
+		}
+		if instr.Dst != nil && instr.Dst.Type == "reg" {
+			for reg, name := range regNames {
+				if name == instr.Dst.Value {
+					clobbers = append(clobbers, clobber{i, []int{reg}})
+					break
+				}
+			}
+		}
+	}
+	return clobbers
+}
+
+// clobberedDuring is the set of registers written while a temp defined at
+// start and last used at end holds its value. Writes at start or end don't
+// count: the temp is defined by the instruction, or read before it writes.
+func clobberedDuring(clobbers []clobber, start, end int) map[int]bool {
+	regs := make(map[int]bool)
+	i := sort.Search(len(clobbers), func(i int) bool { return clobbers[i].index > start })
+	for ; i < len(clobbers) && clobbers[i].index < end; i++ {
+		for _, reg := range clobbers[i].regs {
+			regs[reg] = true
+		}
+	}
+	return regs
+}
+
 // Register allocator using graph coloring
 type RegisterAllocator struct {
 	instructions  []*IRInstruction
 	liveRanges    map[string]*LiveRange
 	interferenceGraph map[string]map[string]bool
 	allocation    map[string]int
-	spilledVars   map[string]int
+	spilledVars   map[string]int // temp -> its spill slot's offset from %rbp
+	frames        *spillFrames
+	clobbers      []clobber      // see findClobbers
 	
 	availableRegs []int
 	usedRegs      map[int]bool
+	
+	// Move-related temps coalesced into one: temp -> the temp it was
+	// merged into (see coalesce)
+	aliases map[string]string
+	// Registers temps are copied into (arguments), tried first so the
+	// copy is from a register to itself
+	preferred map[string][]int
 }
 
 type LiveRange struct {
@@ -24,9 +112,12 @@ type LiveRange struct {
 	Uses    []int
 }
 
-func NewRegisterAllocator(instructions []*IRInstruction) *RegisterAllocator {
-	// Available general-purpose registers (excluding RSP, RBP)
-	availableRegs := []int{RAX, RBX, RCX, RDX, RSI, RDI, R8, R9, R10, R11, R12, R13, R14, R15}
+// NewRegisterAllocator creates an allocator for instructions; temps it
+// can't keep in registers get spill slots in frames (see frame.go)
+func NewRegisterAllocator(instructions []*IRInstruction, frames map[string]*FrameManager) *RegisterAllocator {
+	// Available general-purpose registers (excluding RSP, RBP, and RAX,
+	// the emitter's scratch register for memory-to-memory moves)
+	availableRegs := allocatableRegs()
 	
 	return &RegisterAllocator{
 		instructions:      instructions,
@@ -34,8 +125,12 @@ func NewRegisterAllocator(instructions []*IRInstruction) *RegisterAllocator {
 		interferenceGraph: make(map[string]map[string]bool),
 		allocation:        make(map[string]int),
 		spilledVars:       make(map[string]int),
+		frames:            newSpillFrames(instructions, frames),
+		clobbers:          findClobbers(instructions),
 		availableRegs:     availableRegs,
 		usedRegs:          make(map[int]bool),
+		aliases:           make(map[string]string),
+		preferred:         make(map[string][]int),
 	}
 }
 
@@ -44,9 +139,12 @@ func (ra *RegisterAllocator) Allocate() error {
 	ra.computeLiveRanges()
 	
 	// Step 2: Build interference graph
-	ra.buildInterferenceGraph()
+	moves := ra.findMoves()
+	ra.buildInterferenceGraph(moves)
 	
-	// Step 3: Allocate registers using graph coloring
+	// Step 3: Merge move-related temps, then allocate registers using
+	// graph coloring
+	ra.coalesce(moves)
 	ra.colorGraph()
 	
 	// Step 4: Rewrite instructions with allocated registers
@@ -55,10 +153,22 @@ func (ra *RegisterAllocator) Allocate() error {
 	return nil
 }
 
+// tempOperands lists the operands an instruction reads or writes, including
+// address temps nested in ptr/array operands (used as soon as the access runs)
+func tempOperands(instr *IRInstruction) []*Operand {
+	operands := []*Operand{instr.Dst, instr.Src1, instr.Src2}
+	for _, op := range []*Operand{instr.Dst, instr.Src1, instr.Src2} {
+		if op != nil && op.IndexTemp != nil {
+			operands = append(operands, op.IndexTemp)
+		}
+	}
+	return operands
+}
+
 func (ra *RegisterAllocator) computeLiveRanges() {
 	for i, instr := range ra.instructions {
 		// Record use/def for each operand
-		operands := []*Operand{instr.Dst, instr.Src1, instr.Src2}
+		operands := tempOperands(instr)
 		
 		for _, op := range operands {
 			// Only compute live ranges for temporaries, not variables
@@ -85,7 +195,43 @@ func (ra *RegisterAllocator) computeLiveRanges() {
 	}
 }
 
-func (ra *RegisterAllocator) buildInterferenceGraph() {
+// move is a copy from one temp to another that starts the destination's
+// live range and ends the source's, so the two can share a register
+type move struct {
+	dst, src string
+}
+
+// findMoves lists, in order, the temp-to-temp moves whose temps meet only
+// at the move, and notes the registers temps are moved into
+func (ra *RegisterAllocator) findMoves() []move {
+	var moves []move
+	for i, instr := range ra.instructions {
+		if (instr.Op == OpSetArg || instr.Op == OpMov) && instr.Dst != nil && instr.Dst.Type == "reg" && instr.Src1 != nil && instr.Src1.Type == "temp" {
+			if reg, ok := allocatableReg(instr.Dst.Value); ok {
+				ra.preferred[instr.Src1.Value] = append(ra.preferred[instr.Src1.Value], reg)
+			}
+			continue
+		}
+		if instr.Op != OpMov || instr.Dst == nil || instr.Src1 == nil || instr.Dst.Type != "temp" || instr.Src1.Type != "temp" {
+			continue
+		}
+		dst, src := instr.Dst.Value, instr.Src1.Value
+		if dst != src && ra.liveRanges[dst].Start == i && ra.liveRanges[src].End == i {
+			moves = append(moves, move{dst, src})
+		}
+	}
+	return moves
+}
+
+func (ra *RegisterAllocator) buildInterferenceGraph(moves []move) {
+	// The temps of a move meet at it, but don't interfere there: the
+	// source is read as the destination is written
+	related := make(map[move]bool)
+	for _, m := range moves {
+		related[m] = true
+		related[move{m.src, m.dst}] = true
+	}
+	
 	// Two variables interfere if their live ranges overlap
 	for name1, lr1 := range ra.liveRanges {
 		if ra.interferenceGraph[name1] == nil {
@@ -93,7 +239,7 @@ func (ra *RegisterAllocator) buildInterferenceGraph() {
 		}
 		
 		for name2, lr2 := range ra.liveRanges {
-			if name1 == name2 {
+			if name1 == name2 || related[move{name1, name2}] {
 				continue
 			}
 			
@@ -105,10 +251,91 @@ func (ra *RegisterAllocator) buildInterferenceGraph() {
 	}
 }
 
+// coalesce merges the temps of each move that can share a register without
+// making the graph harder to color, so the move copies a register onto
+// itself and the emitter drops it. Merging is conservative: the merged
+// temp must have fewer than k neighbors of degree k or more (Briggs), or
+// every neighbor of the source must already interfere with the destination
+// or have degree under k (George), where k is the number of registers not
+// clobbered while the merged temp is live.
+func (ra *RegisterAllocator) coalesce(moves []move) {
+	for _, m := range moves {
+		dst, src := ra.find(m.dst), ra.find(m.src)
+		if dst == src || ra.interferenceGraph[dst][src] {
+			continue
+		}
+		lr1, lr2 := ra.liveRanges[dst], ra.liveRanges[src]
+		start, end := min(lr1.Start, lr2.Start), max(lr1.End, lr2.End)
+		k := 0
+		clobbered := clobberedDuring(ra.clobbers, start, end)
+		for _, reg := range ra.availableRegs {
+			if !clobbered[reg] {
+				k++
+			}
+		}
+		if !ra.briggs(dst, src, k) && !ra.george(dst, src, k) {
+			continue
+		}
+		
+		// src's live range, neighbors and preferences become dst's
+		ra.preferred[dst] = append(ra.preferred[dst], ra.preferred[src]...)
+		lr1.Start, lr1.End = start, end
+		lr1.Uses = append(lr1.Uses, lr2.Uses...)
+		delete(ra.liveRanges, src)
+		for neighbor := range ra.interferenceGraph[src] {
+			delete(ra.interferenceGraph[neighbor], src)
+			ra.interferenceGraph[neighbor][dst] = true
+			ra.interferenceGraph[dst][neighbor] = true
+		}
+		delete(ra.interferenceGraph, src)
+		ra.aliases[src] = dst
+	}
+}
+
+// briggs reports whether a and b merged would have fewer than k neighbors
+// of degree k or more
+func (ra *RegisterAllocator) briggs(a, b string, k int) bool {
+	significant := 0
+	for _, temp := range []string{a, b} {
+		for neighbor := range ra.interferenceGraph[temp] {
+			if temp == b && ra.interferenceGraph[a][neighbor] {
+				continue // Counted with a
+			}
+			if len(ra.interferenceGraph[neighbor]) >= k {
+				significant++
+			}
+		}
+	}
+	return significant < k
+}
+
+// george reports whether every neighbor of b interferes with a already or
+// has degree under k
+func (ra *RegisterAllocator) george(a, b string, k int) bool {
+	for neighbor := range ra.interferenceGraph[b] {
+		if !ra.interferenceGraph[a][neighbor] && len(ra.interferenceGraph[neighbor]) >= k {
+			return false
+		}
+	}
+	return true
+}
+
+// find is the temp a temp was coalesced into, itself if it wasn't
+func (ra *RegisterAllocator) find(temp string) string {
+	for {
+		merged, ok := ra.aliases[temp]
+		if !ok {
+			return temp
+		}
+		temp = merged
+	}
+}
+
 func (ra *RegisterAllocator) colorGraph() {
 	// Sort variables by live range length (longer first)
 	type varInfo struct {
 		name   string
+		start  int
 		length int
 		degree int
 	}
@@ -118,17 +345,25 @@ func (ra *RegisterAllocator) colorGraph() {
 		degree := len(ra.interferenceGraph[name])
 		vars = append(vars, varInfo{
 			name:   name,
+			start:  lr.Start,
 			length: lr.End - lr.Start,
 			degree: degree,
 		})
 	}
 	
-	// Sort by degree (more neighbors first), then by length
+	// Sort by degree (more neighbors first), then by length, then by
+	// position so ties don't depend on map order
 	sort.Slice(vars, func(i, j int) bool {
 		if vars[i].degree != vars[j].degree {
 			return vars[i].degree > vars[j].degree
 		}
-		return vars[i].length > vars[j].length
+		if vars[i].length != vars[j].length {
+			return vars[i].length > vars[j].length
+		}
+		if vars[i].start != vars[j].start {
+			return vars[i].start < vars[j].start
+		}
+		return vars[i].name < vars[j].name
 	})
 	
 	// Greedy coloring
@@ -150,25 +385,31 @@ func (ra *RegisterAllocator) allocateRegister(varName string) {
 		}
 	}
 	
-	// Find first available register
-	for _, reg := range ra.availableRegs {
-		if !usedColors[reg] {
+	// Nor can it have a register that's written while it's live
+	lr := ra.liveRanges[varName]
+	clobbered := clobberedDuring(ra.clobbers, lr.Start, lr.End)
+	
+	// Find first available register, preferring one it's copied into
+	for _, reg := range append(ra.preferred[varName], ra.availableRegs...) {
+		if !usedColors[reg] && !clobbered[reg] {
 			ra.allocation[varName] = reg
 			ra.usedRegs[reg] = true
 			return
 		}
 	}
 	
-	// No register available - spill to stack
-	spillOffset := len(ra.spilledVars) * 8
-	ra.spilledVars[varName] = spillOffset
+	// No register available - spill to the function's frame
+	ra.spilledVars[varName] = ra.frames.spill(varName, ra.liveRanges[varName].Start)
 }
 
 func (ra *RegisterAllocator) rewriteInstructions() {
+	// An address temp in a ptr or array operand can be a copy of the
+	// one its instruction wrote (a cast relabels a copy), so it's
+	// rewritten too
 	for _, instr := range ra.instructions {
-		ra.rewriteOperand(&instr.Dst)
-		ra.rewriteOperand(&instr.Src1)
-		ra.rewriteOperand(&instr.Src2)
+		for _, op := range tempOperands(instr) {
+			ra.rewriteOperand(&op)
+		}
 	}
 }
 
@@ -180,13 +421,14 @@ func (ra *RegisterAllocator) rewriteOperand(op **Operand) {
 	operand := *op
 	
 	if operand.Type == "temp" {
-		if reg, ok := ra.allocation[operand.Value]; ok {
+		temp := ra.find(operand.Value)
+		if reg, ok := ra.allocation[temp]; ok {
 			operand.Type = "reg"
 			operand.Value = regNames[reg]
-		} else if offset, ok := ra.spilledVars[operand.Value]; ok {
+		} else if offset, ok := ra.spilledVars[temp]; ok {
 			// Spilled to stack
 			operand.Type = "mem"
-			operand.Offset = -offset
+			operand.Offset = offset
 		}
 	} else if operand.Type == "var" {
 		// Variables are always on the stack - don't allocate to registers
@@ -207,6 +449,11 @@ func (ra *RegisterAllocator) GetSpilledVars() map[string]int {
 	return ra.spilledVars
 }
 
+// CoalescedMoves is the number of moves coalescing removed
+func (ra *RegisterAllocator) CoalescedMoves() int {
+	return len(ra.aliases)
+}
+
 // Advanced: Linear scan register allocation (faster alternative)
 type LinearScanAllocator struct {
 	instructions []*IRInstruction
@@ -214,7 +461,9 @@ type LinearScanAllocator struct {
 	active       []*Interval
 	allocation   map[string]int
 	freeRegs     []int
-	stackSlots   map[string]int
+	stackSlots   map[string]int // temp -> its spill slot's offset from %rbp
+	frames       *spillFrames
+	clobbers     []clobber // see findClobbers
 }
 
 type Interval struct {
@@ -224,8 +473,8 @@ type Interval struct {
 	Reg     int
 }
 
-func NewLinearScanAllocator(instructions []*IRInstruction) *LinearScanAllocator {
-	freeRegs := []int{RAX, RBX, RCX, RDX, RSI, RDI, R8, R9, R10, R11, R12, R13, R14, R15}
+func NewLinearScanAllocator(instructions []*IRInstruction, frames map[string]*FrameManager) *LinearScanAllocator {
+	freeRegs := allocatableRegs()
 	
 	return &LinearScanAllocator{
 		instructions: instructions,
@@ -234,6 +483,8 @@ func NewLinearScanAllocator(instructions []*IRInstruction) *LinearScanAllocator
 		allocation:   make(map[string]int),
 		freeRegs:     freeRegs,
 		stackSlots:   make(map[string]int),
+		frames:       newSpillFrames(instructions, frames),
+		clobbers:     findClobbers(instructions),
 	}
 }
 
@@ -243,19 +494,32 @@ func (lsa *LinearScanAllocator) Allocate() error {
 	
 	// Sort intervals by start point
 	sort.Slice(lsa.intervals, func(i, j int) bool {
-		return lsa.intervals[i].Start < lsa.intervals[j].Start
+		if lsa.intervals[i].Start != lsa.intervals[j].Start {
+			return lsa.intervals[i].Start < lsa.intervals[j].Start
+		}
+		return lsa.intervals[i].VarName < lsa.intervals[j].VarName
 	})
 	
 	// Linear scan
 	for _, interval := range lsa.intervals {
 		lsa.expireOldIntervals(interval)
 		
-		if len(lsa.freeRegs) == 0 {
-			lsa.spillAtInterval(interval)
+		// Registers written while the interval is live are out
+		clobbered := clobberedDuring(lsa.clobbers, interval.Start, interval.End)
+		free := -1
+		for i, reg := range lsa.freeRegs {
+			if !clobbered[reg] {
+				free = i
+				break
+			}
+		}
+		
+		if free < 0 {
+			lsa.spillAtInterval(interval, clobbered)
 		} else {
 			// Allocate register
-			reg := lsa.freeRegs[0]
-			lsa.freeRegs = lsa.freeRegs[1:]
+			reg := lsa.freeRegs[free]
+			lsa.freeRegs = append(lsa.freeRegs[:free], lsa.freeRegs[free+1:]...)
 			
 			interval.Reg = reg
 			lsa.allocation[interval.VarName] = reg
@@ -278,7 +542,7 @@ func (lsa *LinearScanAllocator) computeIntervals() {
 	varIntervals := make(map[string]*Interval)
 	
 	for i, instr := range lsa.instructions {
-		operands := []*Operand{instr.Dst, instr.Src1, instr.Src2}
+		operands := tempOperands(instr)
 		
 		for _, op := range operands {
 			// Only compute intervals for temporaries, not variables
@@ -320,17 +584,20 @@ func (lsa *LinearScanAllocator) expireOldIntervals(interval *Interval) {
 	}
 }
 
-func (lsa *LinearScanAllocator) spillAtInterval(interval *Interval) {
+func (lsa *LinearScanAllocator) spillAtInterval(interval *Interval, clobbered map[int]bool) {
+	if len(lsa.active) == 0 {
+		lsa.stackSlots[interval.VarName] = lsa.frames.spill(interval.VarName, interval.Start)
+		return
+	}
 	// Find interval with furthest end point
 	spill := lsa.active[len(lsa.active)-1]
 	
-	if spill.End > interval.End {
+	if spill.End > interval.End && !clobbered[spill.Reg] {
 		// Spill the last active interval
 		interval.Reg = spill.Reg
 		lsa.allocation[interval.VarName] = spill.Reg
 		
-		offset := len(lsa.stackSlots) * 8
-		lsa.stackSlots[spill.VarName] = offset
+		lsa.stackSlots[spill.VarName] = lsa.frames.spill(spill.VarName, spill.Start)
 		delete(lsa.allocation, spill.VarName)
 		
 		lsa.active[len(lsa.active)-1] = interval
@@ -339,16 +606,16 @@ func (lsa *LinearScanAllocator) spillAtInterval(interval *Interval) {
 		})
 	} else {
 		// Spill current interval
-		offset := len(lsa.stackSlots) * 8
-		lsa.stackSlots[interval.VarName] = offset
+		lsa.stackSlots[interval.VarName] = lsa.frames.spill(interval.VarName, interval.Start)
 	}
 }
 
 func (lsa *LinearScanAllocator) rewriteInstructions() {
+	// Address temps included, as in RegisterAllocator.rewriteInstructions
 	for _, instr := range lsa.instructions {
-		lsa.rewriteOperand(&instr.Dst)
-		lsa.rewriteOperand(&instr.Src1)
-		lsa.rewriteOperand(&instr.Src2)
+		for _, op := range tempOperands(instr) {
+			lsa.rewriteOperand(&op)
+		}
 	}
 }
 
@@ -372,7 +639,7 @@ func (lsa *LinearScanAllocator) rewriteOperand(op **Operand) {
 		} else if offset, ok := lsa.stackSlots[varName]; ok {
 			oldDataType := operand.DataType  // Preserve DataType
 			operand.Type = "mem"
-			operand.Offset = -offset
+			operand.Offset = offset
 			operand.DataType = oldDataType  // Restore DataType
 		}
 	} else if operand.Type == "var" {
@@ -0,0 +1,129 @@
+package main
+
+import "strings"
+
+// Returns (-Wreturn-type, on by default)
+// A function's returns have to agree with its return type. The type
+// checker reports a return that doesn't:
+//
+//	'return' with a value, in function returning void
+//	'return' with no value, in function returning non-void
+//
+// (returning a void call from a void function is fine), and the selector
+// reports a non-void function whose end some path reaches, once its IR
+// shows the paths:
+//
+//	control reaches end of non-void function
+//
+// A branch on a constant (while (1)) only goes one way, and nothing runs
+// after a call to a function that doesn't return, such as exit or one
+// declared noreturn. main is exempt: its end returns 0 (see
+// main_function.go). Once the checks are done, the code after such a call
+// (up to the next label) is dropped.
+
+// noReturnFunctions are the libc functions that never return to the caller
+var noReturnFunctions = map[string]bool{
+	"exit": true, "_exit": true, "_Exit": true, "quick_exit": true,
+	"abort": true, "longjmp": true, "siglongjmp": true, "__assert_fail": true,
+}
+
+// returnsVoid reports whether the function has no result
+func (sig *FunctionSignature) returnsVoid() bool {
+	if sig == nil {
+		return false
+	}
+	typ := strings.TrimSpace(sig.ReturnType)
+	for _, prefix := range []string{"extern ", "static ", "inline "} {
+		typ = strings.TrimSpace(strings.TrimPrefix(typ, prefix))
+	}
+	return typ == "void"
+}
+
+// checkReturnReached reports the non-void function whose IR starts at
+// instruction start if its end can be reached, which is where the selector
+// has added a return of its own
+func (is *InstructionSelector) checkReturnReached(start int, node *ASTNode) {
+	if node.Name == "main" || is.functions[node.Name].returnsVoid() {
+		return
+	}
+	fn := is.instructions[start:]
+	blocks := splitBlocks(fn)
+	reached := make([]bool, len(blocks))
+	reached[0] = true
+	for work := []int{0}; len(work) > 0; {
+		b := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, s := range is.liveSuccessors(fn, blocks, b) {
+			if !reached[s] {
+				reached[s] = true
+				work = append(work, s)
+			}
+		}
+	}
+	last := blocks[len(blocks)-1]
+	if reached[len(blocks)-1] && !is.callsNoReturn(fn[last.start:last.end]) {
+		body := node.Children[0]
+		is.warn("-Wreturn-type", body.EndLine, body.EndColumn, "in function '%s': control reaches end of non-void function", node.Name)
+	}
+}
+
+// liveSuccessors are the blocks control can go to from block b: a branch
+// on a constant goes only one way, and a block that calls a function that
+// doesn't return goes nowhere
+func (is *InstructionSelector) liveSuccessors(fn []*IRInstruction, blocks []*basicBlock, b int) []int {
+	block := blocks[b]
+	if is.callsNoReturn(fn[block.start:block.end]) {
+		return nil
+	}
+	last := fn[block.end-1]
+	if (last.Op != OpJz && last.Op != OpJnz) || last.Src1 == nil || last.Src1.Type != "imm" {
+		return block.succs
+	}
+	taken := (last.Src1.Value == "0") == (last.Op == OpJz)
+	var live []int
+	for _, s := range block.succs {
+		first := fn[blocks[s].start]
+		target := first.Op == OpLabel && first.Dst.Value == last.Dst.Value
+		if target == taken {
+			live = append(live, s)
+		}
+	}
+	return live
+}
+
+// callsNoReturn reports whether instrs call a function that never returns
+func (is *InstructionSelector) callsNoReturn(instrs []*IRInstruction) bool {
+	for _, instr := range instrs {
+		if is.isNoReturnCall(instr) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNoReturnCall reports whether instr calls a function that never
+// returns: one of libc's, or one declared noreturn (see attributes.go)
+func (is *InstructionSelector) isNoReturnCall(instr *IRInstruction) bool {
+	if instr.Op != OpCall || instr.Src1 == nil {
+		return false
+	}
+	sig, ok := is.functions[instr.Src1.Value]
+	return noReturnFunctions[instr.Src1.Value] || (ok && sig.NoReturn)
+}
+
+// dropAfterNoReturn removes the code after each call to a function that
+// never returns, up to the next label: nothing can get to it
+func (is *InstructionSelector) dropAfterNoReturn() {
+	kept := is.instructions[:0]
+	dropping := false
+	for _, instr := range is.instructions {
+		if instr.Op == OpLabel {
+			dropping = false
+		}
+		if !dropping {
+			kept = append(kept, instr)
+		}
+		dropping = dropping || is.isNoReturnCall(instr)
+	}
+	is.instructions = kept
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Light runtime checks (-fsanitize=light)
+// After selection each load or store through a pointer is preceded by a
+// test that the pointer isn't null, and each integer division by a
+// non-constant by a test that the divisor isn't zero:
+//
+//	jz .L_trap, t7        ; t7 is the pointer or the divisor
+//	t8 = load [t7]
+//	...
+//	.L_trap:              ; after the function's last return
+//	setarg %rdi, $2
+//	setarg %rsi, .str_9   ; "runtime error in f at line 12: ..."
+//	setarg %rdx, $len
+//	call write
+//	call abort
+//
+// An address computed as pointer + constant (p->member) is checked through
+// the pointer. The trap blocks are shared per function and message, and are
+// only ever entered, never left, so they don't disturb the live ranges of
+// the code they guard.
+
+// insertSanitizerChecks adds the checks to every function
+func (is *InstructionSelector) insertSanitizerChecks() {
+	instrs := is.instructions
+	is.instructions = make([]*IRInstruction, 0, len(instrs))
+	start := 0
+	for start < len(instrs) {
+		end := start + 1
+		for end < len(instrs) && !(instrs[end].Op == OpLabel && isFunctionLabel(instrs[end].Dst.Value)) {
+			end++
+		}
+		is.checksIn(instrs[start:end])
+		start = end
+	}
+}
+
+// checksIn appends one function, which starts with its label, with its
+// checks and trap blocks
+func (is *InstructionSelector) checksIn(fn []*IRInstruction) {
+	if len(fn) == 0 || fn[0].Op != OpLabel {
+		is.instructions = append(is.instructions, fn...)
+		return
+	}
+	name := fn[0].Dst.Value
+
+	// Where an address is pointer + constant, the pointer is what's checked.
+	// Only temps defined once can be followed.
+	defs := make(map[string]int)
+	for _, instr := range fn {
+		if instr.Dst != nil && instr.Dst.Type == "temp" {
+			defs[instr.Dst.Value]++
+		}
+	}
+	offsetOf := make(map[string]*Operand)
+	for _, instr := range fn {
+		if instr.Op == OpAdd && instr.Dst.Type == "temp" && defs[instr.Dst.Value] == 1 &&
+			instr.Src1 != nil && instr.Src1.Type == "temp" && defs[instr.Src1.Value] == 1 &&
+			instr.Src2 != nil && instr.Src2.Type == "imm" {
+			offsetOf[instr.Dst.Value] = instr.Src1
+		}
+	}
+	basePointer := func(addr *Operand) *Operand {
+		for steps := 0; steps < 8; steps++ {
+			base, ok := offsetOf[addr.Value]
+			if !ok {
+				break
+			}
+			addr = base
+		}
+		return addr
+	}
+
+	traps := make(map[string]string) // message -> trap label
+	var trapOrder []string
+	check := func(value *Operand, what string, line int) {
+		message := fmt.Sprintf("runtime error in %s at line %d: %s", name, line, what)
+		label, ok := traps[message]
+		if !ok {
+			label = is.newLabel(".L_trap")
+			traps[message] = label
+			trapOrder = append(trapOrder, message)
+		}
+		is.instructions = append(is.instructions, &IRInstruction{Op: OpJz, Dst: &Operand{Type: "label", Value: label}, Src1: value, Line: line})
+	}
+
+	for _, instr := range fn {
+		if addr := dereferencedPointer(instr); addr != nil {
+			check(basePointer(addr), "null pointer dereference", instr.Line)
+		}
+		if (instr.Op == OpDiv || instr.Op == OpMod) && isIntegerDivisor(instr) {
+			check(instr.Src2, "division by zero", instr.Line)
+		}
+		is.instructions = append(is.instructions, instr)
+	}
+
+	for _, message := range trapOrder {
+		is.line, is.column = 0, 0
+		is.emit(OpLabel, &Operand{Type: "label", Value: traps[message]}, nil, nil)
+		text := is.stringLabel(message + "\n")
+		args := is.target.CallingConvention().IntArgs
+		is.emit(OpSetArg, &Operand{Type: "reg", Value: args[0]}, &Operand{Type: "imm", Value: "2"}, nil)
+		is.emit(OpSetArg, &Operand{Type: "reg", Value: args[1]}, &Operand{Type: "label", Value: text}, nil)
+		is.emit(OpSetArg, &Operand{Type: "reg", Value: args[2]}, &Operand{Type: "imm", Value: fmt.Sprintf("%d", len(message)+1)}, nil)
+		is.emitCall(is.newTemp(), &Operand{Type: "label", Value: "write"}, &Operand{Type: "imm", Value: "3"})
+		is.emitCall(is.newTemp(), &Operand{Type: "label", Value: "abort"}, &Operand{Type: "imm", Value: "0"})
+	}
+}
+
+// dereferencedPointer is the temp holding the address a load or store goes
+// through, or nil if it doesn't go through a pointer
+func dereferencedPointer(instr *IRInstruction) *Operand {
+	var mem *Operand
+	switch instr.Op {
+	case OpLoad:
+		mem = instr.Src1
+	case OpStore:
+		mem = instr.Dst
+	default:
+		return nil
+	}
+	if mem == nil || mem.Type != "ptr" || mem.IndexTemp == nil || mem.IndexTemp.Type != "temp" {
+		return nil
+	}
+	return mem.IndexTemp
+}
+
+// isIntegerDivisor reports whether a division's divisor is an integer that
+// isn't known until run time
+func isIntegerDivisor(instr *IRInstruction) bool {
+	if instr.Src2 == nil || instr.Src2.Type != "temp" {
+		return false
+	}
+	for _, op := range []*Operand{instr.Dst, instr.Src1, instr.Src2} {
+		if op == nil {
+			continue
+		}
+		switch strings.TrimPrefix(op.DataType, "const ") {
+		case "float", "double":
+			return false
+		}
+	}
+	return true
+}
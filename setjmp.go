@@ -0,0 +1,49 @@
+package main
+
+// setjmp and longjmp
+// setjmp saves the stack pointer, the return address and the callee-saved
+// registers in a jmp_buf and returns 0; longjmp restores them, so setjmp
+// returns again, with longjmp's value. Memory is as longjmp left it, but
+// the registers are as setjmp found them. A temp the allocator kept in
+// %rbx across the setjmp call, and changed before the longjmp, comes back
+// with its old value, and one in a caller-saved register doesn't come back
+// at all.
+//
+// So a call of a function that returns twice (setjmp and its relatives,
+// and vfork) lists every allocatable register in Clobbers: each temp live
+// across it is spilled to its stack slot, which longjmp leaves alone, and
+// reloaded from there after. Locals live in their stack slots anyway. Such
+// a call is never turned into a sibling call, whose frame would be gone by
+// the time it returned the second time, and a function making one is never
+// inlined, as gcc doesn't either.
+//
+// jmp_buf and sigjmp_buf are glibc's: 200 bytes, which selection takes as
+// 25 longs, so a local one is laid out (and passed) as C has it.
+
+// returnsTwice are the functions that can return more than once
+var returnsTwice = map[string]bool{
+	"setjmp":      true,
+	"_setjmp":     true,
+	"sigsetjmp":   true,
+	"__sigsetjmp": true,
+	"savectx":     true,
+	"vfork":       true,
+	"getcontext":  true,
+}
+
+// jmpBufLongs is the size of glibc's jmp_buf, in longs
+const jmpBufLongs = 25
+
+// callsReturnTwice reports whether instr calls a function that returns twice
+func callsReturnTwice(instr *IRInstruction) bool {
+	return (instr.Op == OpCall || instr.Op == OpTailCall) && instr.Src1 != nil && returnsTwice[instr.Src1.Value]
+}
+
+// callClobbers are the registers a call of fn changes, as far as the
+// allocator is concerned
+func callClobbers(fn *Operand) []int {
+	if fn != nil && returnsTwice[fn.Value] {
+		return allocatableRegs()
+	}
+	return callerSavedRegs
+}
@@ -0,0 +1,216 @@
+package main
+
+import "strings"
+
+// Struct values
+// A struct-valued expression is one of three things: a "mem" stack slot
+// (compound literals, call results), a "var" naming the struct itself, or a
+// temp. Temps of structs wider than a register hold the struct's address
+// (see loadLValue); narrower ones hold the bytes. The helpers here move
+// between those forms and classify structs of up to 16 bytes for passing and
+// returning in registers (SysV AMD64 ABI 3.2.3, or AAPCS64's simpler rule;
+// see calling_convention.go).
+
+// structDefOf finds the definition of a struct or union type, through typedefs
+func (is *InstructionSelector) structDefOf(typ string) (*StructDef, bool) {
+	if !is.isStructType(typ) {
+		return nil, false
+	}
+	name := strings.TrimSpace(is.resolveType(typ))
+	name = strings.TrimPrefix(name, "struct ")
+	name = strings.TrimPrefix(name, "union ")
+	def, ok := is.structs[strings.TrimSpace(name)]
+	return def, ok
+}
+
+// isStructValue reports whether node yields a whole struct, which is copied
+// rather than moved through a register
+func (is *InstructionSelector) isStructValue(node *ASTNode) bool {
+	return is.structValueType(node) != ""
+}
+
+// structValueType returns the struct type node yields, or "" if it isn't
+// struct-valued
+func (is *InstructionSelector) structValueType(node *ASTNode) string {
+	typ := ""
+	switch node.Type {
+	case NodeCompoundLiteral:
+		if node.ArraySize == 0 {
+			typ = node.DataType
+		}
+	case NodeCall:
+		if sig, ok := is.functions[node.Name]; ok {
+			typ = sig.ReturnType
+		}
+	case NodeTernary:
+		if len(node.Children) == 3 {
+			if typ = is.structValueType(node.Children[1]); typ == "" {
+				typ = is.structValueType(node.Children[2])
+			}
+		}
+	case NodeIdentifier:
+		sym, ok := is.localVars[node.VarName]
+		if !ok {
+			sym, ok = is.globalVars[node.VarName]
+		}
+		if ok && sym.ArraySize == 0 {
+			typ = sym.Type
+		}
+	}
+	if typ == "" || !is.isStructType(typ) {
+		return ""
+	}
+	return typ
+}
+
+// selectStructValue evaluates a struct-valued node. Variables are returned
+// as themselves rather than loaded, so structs of any size survive.
+func (is *InstructionSelector) selectStructValue(node *ASTNode) (*Operand, error) {
+	if node.Type == NodeIdentifier {
+		if sym, ok := is.localVars[node.VarName]; ok {
+			return &Operand{Type: "var", Value: node.VarName, Offset: sym.Offset, DataType: sym.Type}, nil
+		}
+		if sym, ok := is.globalVars[node.VarName]; ok {
+			return &Operand{Type: "var", Value: node.VarName, IsGlobal: true, DataType: sym.Type}, nil
+		}
+	}
+	return is.selectExpression(node)
+}
+
+// newSlot reserves a stack slot for a value of typ, rounded up to whole
+// eightbytes so register-sized copies stay inside it
+func (is *InstructionSelector) newSlot(kind SlotKind, name, typ string) *Operand {
+	size := (is.types().SizeOf(typ) + 7) &^ 7
+	return &Operand{Type: "mem", Offset: is.frame.Alloc(kind, name, size, slotAlign(size)), DataType: typ}
+}
+
+// structSlot returns a struct value as a local stack slot, copying it into
+// a new one unless it already lives in one
+func (is *InstructionSelector) structSlot(val *Operand, typ string) *Operand {
+	switch {
+	case val.Type == "mem":
+		return val
+	case val.Type == "var" && !val.IsGlobal:
+		return &Operand{Type: "mem", Offset: val.Offset, DataType: typ}
+	}
+	slot := is.newSlot(SlotTemp, "struct copy", typ)
+	size := is.types().SizeOf(typ)
+	if size <= 8 && val.Type != "var" {
+		// The temp holds the bytes themselves
+		is.emit(OpStore, &Operand{Type: "mem", Offset: slot.Offset}, val, nil)
+		return slot
+	}
+	dst := is.newTemp()
+	is.emit(OpLoadAddr, dst, slot, nil)
+	is.copyBytes(dst, is.structAddress(val, typ), size)
+	return slot
+}
+
+// structAddress returns the address of a struct value
+func (is *InstructionSelector) structAddress(val *Operand, typ string) *Operand {
+	if val.Type != "mem" && val.Type != "var" {
+		if is.types().SizeOf(typ) > 8 {
+			// Wide struct temps already hold the address
+			return val
+		}
+		val = is.structSlot(val, typ)
+	}
+	addr := is.newTemp()
+	addr.DataType = typ + "*"
+	is.emit(OpLoadAddr, addr, val, nil)
+	return addr
+}
+
+// copyStructTo copies the struct value val into slot, a stack slot of its type
+func (is *InstructionSelector) copyStructTo(slot, val *Operand) {
+	dst := is.newTemp()
+	is.emit(OpLoadAddr, dst, slot, nil)
+	is.copyBytes(dst, is.structAddress(val, slot.DataType), is.types().SizeOf(slot.DataType))
+}
+
+// structClasses classifies each eightbyte of a struct as "int" or "sse".
+// ok is false for structs over 16 bytes, which go through memory.
+func (is *InstructionSelector) structClasses(typ string) (classes []string, ok bool) {
+	size := is.types().SizeOf(typ)
+	if _, isStruct := is.structDefOf(typ); !isStruct || size <= 0 || size > 16 {
+		return nil, false
+	}
+	classes = make([]string, (size+7)/8)
+	is.classifyFields(typ, 0, classes, 0)
+	for i, class := range classes {
+		if class == "" {
+			// Padding only
+			classes[i] = "sse"
+		}
+	}
+	if !is.target.CallingConvention().EightbyteClasses && !is.onlyDoubles(typ, 0) {
+		// AAPCS64: floating registers only for a struct of doubles
+		for i := range classes {
+			classes[i] = "int"
+		}
+	}
+	return classes, true
+}
+
+// onlyDoubles reports whether every scalar field of typ is a double
+func (is *InstructionSelector) onlyDoubles(typ string, depth int) bool {
+	def, ok := is.structDefOf(typ)
+	if !ok || depth > 8 {
+		return strings.TrimPrefix(is.resolveType(typ), "const ") == "double"
+	}
+	for _, member := range def.Members {
+		if !is.onlyDoubles(member.Type, depth+1) {
+			return false
+		}
+	}
+	return len(def.Members) > 0
+}
+
+// classifyFields merges the classes of typ's scalar fields, placed at base,
+// into classes: any integer field makes its eightbyte "int"
+func (is *InstructionSelector) classifyFields(typ string, base int, classes []string, depth int) {
+	def, ok := is.structDefOf(typ)
+	if !ok || depth > 8 {
+		idx := base / 8
+		if idx >= len(classes) || classes[idx] == "int" {
+			return
+		}
+		switch strings.TrimPrefix(is.resolveType(typ), "const ") {
+		case "float", "double":
+			classes[idx] = "sse"
+		default:
+			classes[idx] = "int"
+		}
+		return
+	}
+	for _, member := range def.Members {
+		count := max(member.ArraySize, 1)
+		for k := 0; k < count; k++ {
+			is.classifyFields(member.Type, base+member.Offset+k*(member.Size/count), classes, depth+1)
+		}
+	}
+}
+
+// emitEightbytes moves a struct slot's eightbytes between memory and
+// registers: op is OpLoad to fill intRegs/sseRegs from the slot, OpStore to
+// spill them into it. Each class takes the next register of its kind.
+func (is *InstructionSelector) emitEightbytes(slot *Operand, classes []string, intRegs, sseRegs []string, op OpCode) {
+	intIdx, sseIdx := 0, 0
+	for k, class := range classes {
+		reg := &Operand{Type: "reg"}
+		if class == "sse" {
+			reg.Type = "freg"
+			reg.Value = sseRegs[sseIdx]
+			sseIdx++
+		} else {
+			reg.Value = intRegs[intIdx]
+			intIdx++
+		}
+		part := &Operand{Type: "mem", Offset: slot.Offset + 8*k}
+		if op == OpStore {
+			is.emit(OpStore, part, reg, nil)
+		} else {
+			is.emit(OpLoad, reg, part, nil)
+		}
+	}
+}
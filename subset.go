@@ -0,0 +1,413 @@
+package main
+
+import "strings"
+
+// Self-hosting subset (-std=subset)
+// The subset is the part of C this compiler is known to compile correctly.
+// With -std=subset the type checker rejects every construct outside it,
+// naming the construct and why, so a program either compiles to what C
+// says it means or fails with a list of what's missing; nothing in it is
+// miscompiled silently. `ccompiler subset <dir>` holds the subset to that
+// over a corpus (see subset_runner.go). What the compiler rejects anyway
+// (a parse error) is left to fail as it does; what's outside the subset is
+// the code it would accept and get wrong:
+//
+//	continue                       loops don't jump to their next iteration
+//	break that isn't directly in a case
+//	                               loops ignore break, and a case only sees
+//	                               its own statements
+//	case that falls through        each case must end in break or return
+//	default before the last case   default's statements run wherever it is
+//	do-while loop                  do isn't parsed as a loop
+//	for condition ...              the header is told apart by node kind, so
+//	for increment ...                only those kinds are placed correctly
+//	array of scalars used as a pointer, address of an array-of-scalars
+//	  element                      their elements are 8-byte slots, not C
+//	                               layout (unless they're 8 bytes), and the
+//	                               name doesn't decay; in a global's
+//	                               initializer too
+//	local array of pointers        its elements are read as what they point to
+//	array dereferenced with *      *name reads the first slot as a pointer
+//	address taken outside a call argument
+//	                               &name is only computed as an argument or
+//	                               a conditional's arm
+//	assignment to an element through a pointer variable
+//	                               name[i] = v stores into a local array slot
+//	struct copied from an array element
+//	                               only a pointer's element copied into a
+//	                               variable is copied correctly
+//	arithmetic on a pointer to anything wider than a byte
+//	                               it isn't scaled by the size of what the
+//	                               pointer points to (indexing is)
+//	++ or -- on anything but a variable
+//	                               the new value isn't stored back
+//	signed result narrower than long from a library function
+//	                               it isn't sign-extended from the bits the
+//	                               callee sets (strcmp(a, b) < 0 is false)
+//	struct passed by value with float members
+//	                               not classified the way the ABI passes it
+//	struct-valued conditional with an arm that isn't a variable, call or
+//	  compound literal             the arm's first bytes are copied as if
+//	                               they were its address
+//
+// A construct comes off the list when the compiler gets it right.
+
+// subsetGap is a construct outside the subset, and why it is
+type subsetGap struct {
+	construct string
+	reason    string
+}
+
+var (
+	gapContinue       = subsetGap{"continue", "loops don't jump to their next iteration"}
+	gapNestedBreak    = subsetGap{"break that isn't directly in a case", "loops ignore break, and a case only sees its own statements"}
+	gapFallthrough    = subsetGap{"case that falls through", "each case must end in break or return"}
+	gapDefaultFirst   = subsetGap{"default before the last case", "default's statements run wherever it appears"}
+	gapDoWhile        = subsetGap{"do-while loop", "do isn't parsed as a loop"}
+	gapForCondition   = subsetGap{"for condition other than a comparison, name or constant", "the selector wouldn't recognize it as the condition"}
+	gapForIncrement   = subsetGap{"for increment other than an assignment or unary operation", "the selector wouldn't recognize it as the increment"}
+	gapArrayDecay     = subsetGap{"array of scalars used as a pointer", "its elements are 8-byte slots and its name doesn't decay"}
+	gapElementAddress = subsetGap{"address of an array-of-scalars element", "its elements are 8-byte slots, not C layout"}
+	gapPointerArray   = subsetGap{"local array of pointers", "its elements are read as what they point to"}
+	gapArrayDeref     = subsetGap{"array dereferenced with *", "*name reads the array's first slot as a pointer"}
+	gapAddressOf      = subsetGap{"address taken outside a call argument", "&name is only computed correctly as an argument or a conditional's arm"}
+	gapPointerStore   = subsetGap{"assignment to an element through a pointer variable", "name[i] = v stores into a local array slot"}
+	gapElementCopy    = subsetGap{"struct copied from an array element", "only a pointer's element copied into a variable is copied correctly"}
+	gapPointerArith   = subsetGap{"arithmetic on a pointer to anything wider than a byte", "it isn't scaled by the size of what the pointer points to"}
+	gapIncDec         = subsetGap{"++ or -- on anything but a variable", "the new value isn't stored back"}
+	gapNarrowResult   = subsetGap{"signed result narrower than long from a library function", "it isn't sign-extended from the bits the callee sets"}
+	gapStructArg      = subsetGap{"struct passed by value with float members", "it isn't passed the way the ABI passes it"}
+	gapStructArm      = subsetGap{"struct-valued conditional with an arm that isn't a variable, call or compound literal", "the arm's first bytes are copied as if they were its address"}
+)
+
+// subsetMarker is how a subset diagnostic reads: "<construct> is outside
+// -std=subset: <reason>" (the corpus runner groups them by construct)
+const subsetMarker = " is outside -std=subset: "
+
+// outsideSubset reports a construct outside the subset at node, or at the
+// statement it's in if the node has no line of its own
+func (tc *TypeChecker) outsideSubset(node *ASTNode, gap subsetGap) {
+	if node.Line == 0 {
+		node = &ASTNode{Line: tc.subsetLine}
+	}
+	tc.errors = append(tc.errors, tc.locate(node, gap.construct+subsetMarker+gap.reason))
+}
+
+// checkSubsetStmt checks a statement, or an expression the checker meets
+// where a statement goes, against the subset. Nested statements get their
+// own call from checkStmt.
+func (tc *TypeChecker) checkSubsetStmt(node *ASTNode) {
+	if node.Line > 0 {
+		tc.subsetLine = node.Line
+	}
+	switch node.Type {
+	case NodeContinue:
+		tc.outsideSubset(node, gapContinue)
+	case NodeBreak:
+		if !tc.caseBreaks[node] {
+			tc.outsideSubset(node, gapNestedBreak)
+		}
+	case NodeSwitch:
+		if len(node.Children) > 0 {
+			tc.checkSubsetExpr(node.Children[0], false)
+		}
+		tc.checkSubsetSwitch(node)
+	case NodeFor:
+		tc.checkSubsetFor(node)
+	case NodeVarDecl, NodeReturn:
+		if node.Type == NodeVarDecl && node.ArraySize > 0 && tc.kindOf(declType(node)[:len(declType(node))-1]) == kindPointer {
+			tc.outsideSubset(node, gapPointerArray)
+		}
+		if node.Type == NodeVarDecl && len(node.Children) > 0 {
+			tc.checkSubsetCopy(node, nil, node.Children[0])
+		}
+		for _, child := range node.Children {
+			tc.checkSubsetExpr(child, false)
+		}
+	case NodeExprStmt:
+		// "do { ... } while (c);" reads as the name do, a block and a
+		// while loop
+		if len(node.Children) == 1 && node.Children[0].Type == NodeIdentifier && node.Children[0].VarName == "do" {
+			if _, declared := tc.lookup("do"); !declared {
+				tc.outsideSubset(node, gapDoWhile)
+			}
+		}
+	default:
+		if node.Type == NodeCall {
+			// A call made for its effects: only its arguments are used
+			for _, arg := range node.Children {
+				tc.checkSubsetExpr(arg, true)
+			}
+			return
+		}
+		if isExpressionNode(node) {
+			tc.checkSubsetExpr(node, false)
+		}
+	}
+}
+
+// checkSubsetSwitch checks that the cases of a switch can't fall through
+// and that default comes last, and marks the breaks that end cases
+func (tc *TypeChecker) checkSubsetSwitch(node *ASTNode) {
+	var cases []*ASTNode
+	for _, child := range node.Children[1:] {
+		if child.Type == NodeCase {
+			cases = append(cases, child)
+		}
+	}
+	for i, caseNode := range cases {
+		statements := caseNode.Children
+		if caseNode.Value == "default" {
+			if i != len(cases)-1 {
+				tc.outsideSubset(caseNode, gapDefaultFirst)
+			}
+		} else if len(statements) > 0 {
+			statements = statements[1:] // the label
+		}
+		ends := false
+		for _, stmt := range statements {
+			switch stmt.Type {
+			case NodeBreak:
+				tc.caseBreaks[stmt] = true
+				ends = true
+			case NodeReturn:
+				ends = true
+			}
+		}
+		if !ends && caseNode.Value != "default" {
+			tc.outsideSubset(caseNode, gapFallthrough)
+		}
+	}
+}
+
+// checkSubsetFor checks that selection will find a for loop's condition
+// and increment: with the parts that are absent left out of the node, it
+// tells them apart by their kind of node (see selectNode)
+func (tc *TypeChecker) checkSubsetFor(node *ASTNode) {
+	if len(node.Children) == 0 {
+		return
+	}
+	header := node.Children[:len(node.Children)-1]
+	if len(header) > 0 && (header[0].Type == NodeVarDecl || header[0].Type == NodeExprStmt) {
+		header = header[1:]
+	}
+	isCondition := func(n *ASTNode) bool {
+		return n.Type == NodeBinaryOp || n.Type == NodeIdentifier || n.Type == NodeNumber
+	}
+	isIncrement := func(n *ASTNode) bool {
+		return n.Type == NodeBinaryOp || n.Type == NodeAssignment || n.Type == NodeUnaryOp
+	}
+	switch len(header) {
+	case 1:
+		// Either part alone: ++ and -- can only be the increment
+		if isCondition(header[0]) || header[0].Type == NodeAssignment || isIncDec(header[0]) {
+			return
+		}
+		tc.outsideSubset(header[0], gapForCondition)
+	case 2:
+		if !isCondition(header[0]) {
+			tc.outsideSubset(header[0], gapForCondition)
+		}
+		if !isIncrement(header[1]) {
+			tc.outsideSubset(header[1], gapForIncrement)
+		}
+	}
+}
+
+func isIncDec(node *ASTNode) bool {
+	if node.Type != NodeUnaryOp {
+		return false
+	}
+	switch node.Operator {
+	case "++", "--", "++_post", "--_post":
+		return true
+	}
+	return false
+}
+
+// checkSubsetExpr checks an expression; argument is whether its value is
+// passed straight to a call (through casts), or is an arm of a conditional
+func (tc *TypeChecker) checkSubsetExpr(node *ASTNode, argument bool) {
+	switch node.Type {
+	case NodeIdentifier:
+		if _, ok := tc.scalarArray(node.VarName); ok {
+			tc.outsideSubset(node, gapArrayDecay)
+		}
+		return
+	case NodeSizeof:
+		// Only the operand's layout is used
+		return
+	case NodeArrayAccess:
+		// Indexing an array is fine; only its name used as a value isn't
+		if len(node.Children) == 2 {
+			if node.Children[0].Type != NodeIdentifier {
+				tc.checkSubsetExpr(node.Children[0], false)
+			}
+			tc.checkSubsetExpr(node.Children[1], false)
+		}
+		return
+	case NodeAssignment:
+		if node.Operator == "=" {
+			tc.checkSubsetCopy(node, node.Children[0], node.Children[1])
+		}
+		if target := node.Children[0]; node.Operator == "=" && target.Type == NodeArrayAccess &&
+			len(target.Children) == 2 && target.Children[0].Type == NodeIdentifier {
+			// A struct element is copied through its address, which is right
+			v, ok := tc.lookupVar(target.Children[0].VarName)
+			element, _ := pointeeType(tc.normalizeType(v.typ))
+			if ok && v.arraySize == 0 && tc.kindOf(element) != kindStruct {
+				tc.outsideSubset(node, gapPointerStore)
+			}
+		}
+	case NodeCall:
+		if !tc.hasBody[node.Name] {
+			if sig, ok := tc.functions[node.Name]; ok && tc.isNarrowSigned(sig.ReturnType) {
+				tc.outsideSubset(node, gapNarrowResult)
+			}
+		}
+	case NodeUnaryOp:
+		if isIncDec(node) && len(node.Children) == 1 && node.Children[0].Type != NodeIdentifier {
+			tc.outsideSubset(node, gapIncDec)
+		}
+		if node.Operator == "*" && len(node.Children) == 1 && node.Children[0].Type == NodeIdentifier {
+			if v, ok := tc.lookupVar(node.Children[0].VarName); ok && v.arraySize > 0 {
+				tc.outsideSubset(node, gapArrayDeref)
+				return
+			}
+		}
+		if node.Operator == "&" && len(node.Children) == 1 {
+			operand := node.Children[0]
+			if operand.Type == NodeIdentifier {
+				if !argument {
+					tc.outsideSubset(node, gapAddressOf)
+				}
+				return
+			}
+			if operand.Type == NodeArrayAccess && len(operand.Children) == 2 && operand.Children[0].Type == NodeIdentifier {
+				// 8-byte elements are where C puts them
+				element, ok := tc.scalarArray(operand.Children[0].VarName)
+				if size, _ := tc.target.SizeOf(tc.normalizeType(element)); ok && size != 8 {
+					tc.outsideSubset(node, gapElementAddress)
+				}
+			}
+		}
+	}
+	if !isExpressionNode(node) {
+		// A statement expression's statements are checked as statements
+		return
+	}
+	for i, child := range node.Children {
+		passed := node.Type == NodeCall || (node.Type == NodeCast && argument) || (node.Type == NodeTernary && i > 0)
+		tc.checkSubsetExpr(child, passed)
+	}
+}
+
+// checkSubsetPointerArith checks +, -, ++ or -- on a value of type pointer:
+// only byte (and void) pointers step the way C says
+func (tc *TypeChecker) checkSubsetPointerArith(node *ASTNode, pointer string) {
+	pointee, ok := pointeeType(tc.normalizeType(pointer))
+	if !ok || tc.kindOf(pointee) == kindVoid {
+		return
+	}
+	if size, known := tc.target.SizeOf(tc.normalizeType(pointee)); known && size == 1 {
+		return
+	}
+	tc.outsideSubset(node, gapPointerArith)
+}
+
+// isNarrowSigned reports whether typ is a signed integer type narrower than
+// a register
+func (tc *TypeChecker) isNarrowSigned(typ string) bool {
+	typ = tc.normalizeType(typ)
+	size, ok := tc.target.SizeOf(typ)
+	return ok && size < 8 && tc.kindOf(typ) == kindArith && !isFloatType(typ) && !tc.target.IsUnsigned(typ)
+}
+
+// checkSubsetCopy checks a copy of source into target (nil for a variable
+// being initialized) for the struct copies that go wrong: from an element
+// of a local array, and from one element to another
+func (tc *TypeChecker) checkSubsetCopy(node, target, source *ASTNode) {
+	if source.Type != NodeArrayAccess || len(source.Children) != 2 || source.Children[0].Type != NodeIdentifier {
+		return
+	}
+	v, ok := tc.lookupVar(source.Children[0].VarName)
+	if !ok {
+		return
+	}
+	element, _ := pointeeType(tc.normalizeType(v.typ))
+	if tc.kindOf(element) != kindStruct {
+		return
+	}
+	if v.arraySize > 0 || (target != nil && target.Type == NodeArrayAccess) {
+		tc.outsideSubset(node, gapElementCopy)
+	}
+}
+
+// checkSubsetConditional checks the arms of a struct-valued conditional:
+// the selector copies a struct variable, call result or compound literal
+// into the join slot whole, and nothing else
+func (tc *TypeChecker) checkSubsetConditional(node *ASTNode) {
+	for _, arm := range node.Children[1:] {
+		switch arm.Type {
+		case NodeIdentifier, NodeCall, NodeCompoundLiteral, NodeTernary:
+			continue
+		}
+		tc.outsideSubset(node, gapStructArm)
+		return
+	}
+}
+
+// scalarArray finds the element type of an array of numbers or pointers
+// (one of types the checker can't work out may be of structs)
+func (tc *TypeChecker) scalarArray(name string) (string, bool) {
+	v, ok := tc.lookupVar(name)
+	if !ok {
+		return "", false
+	}
+	element := strings.TrimSuffix(v.typ, "*")
+	kind := tc.kindOf(element)
+	return element, v.arraySize > 0 && (kind == kindArith || kind == kindPointer)
+}
+
+// checkSubsetGlobal checks a file-scope declaration. Its storage and
+// constant values are laid out as C says (see global_data.go); the
+// addresses in its initializer are held to the same gaps as an argument's.
+func (tc *TypeChecker) checkSubsetGlobal(node *ASTNode) {
+	tc.subsetLine = node.Line
+	for _, value := range node.Children {
+		tc.checkSubsetInitializer(value)
+	}
+}
+
+// checkSubsetInitializer checks a value in a global's initializer, in
+// braces or not
+func (tc *TypeChecker) checkSubsetInitializer(node *ASTNode) {
+	if node.Type == NodeCompoundLiteral {
+		for _, child := range node.Children {
+			tc.checkSubsetInitializer(child)
+		}
+		return
+	}
+	tc.checkSubsetExpr(node, true)
+}
+
+// checkSubsetPassing checks that values of the given types, passed as
+// arguments, are passed the way the ABI classifies them
+func (tc *TypeChecker) checkSubsetPassing(node *ASTNode, types []string) {
+	for _, typ := range types {
+		typ = tc.normalizeType(typ)
+		if tc.kindOf(typ) != kindStruct {
+			continue
+		}
+		def, ok := tc.structs[structTag(typ)]
+		if !ok {
+			continue
+		}
+		for _, member := range def.Members {
+			if tc.normalizeType(member.Type) == "float" {
+				tc.outsideSubset(node, gapStructArg)
+				return
+			}
+		}
+	}
+}
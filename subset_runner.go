@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Subset corpus runner: ccompiler subset <dir> [--cc=gcc] [options]
+// Every .c file in dir is compiled with -std=subset (and the usual compiler
+// options). A program the subset accepts is also built by the reference
+// compiler, both are run, and they must print the same output and exit
+// the same way: a difference is a construct the subset claims and the
+// compiler gets wrong, and fails the run. A program the subset rejects
+// isn't a failure. Its diagnostics are gathered, across the corpus, into a
+// list of the constructs outside the subset, most used first, with where
+// each is used; programs that fail to compile for any other reason (a
+// parse error) are listed with their first error. Together they're the
+// list of what the compiler is missing.
+
+// subsetDiagnostic finds the construct a subset diagnostic names, and its
+// line when it has one
+var subsetDiagnostic = regexp.MustCompile(`(?:line (\d+): )?(?:in function '[^']*': )?([^:\n]*)` + regexp.QuoteMeta(subsetMarker))
+
+// runSubsetCommand implements the subset subcommand and returns the exit
+// status
+func runSubsetCommand(args []string) int {
+	reference := "gcc"
+	var rest []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--cc=") {
+			reference = strings.TrimPrefix(arg, "--cc=")
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	cl, err := parseCommandLine(rest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	dir := cl.sourceFile
+	if dir == "" {
+		fmt.Fprintln(os.Stderr, "Usage: ccompiler subset <dir> [--cc=gcc] [options]")
+		return 2
+	}
+	if _, err := exec.LookPath(reference); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: reference compiler %s not found\n", reference)
+		return 2
+	}
+	sources, err := filepath.Glob(filepath.Join(dir, "*.c"))
+	if err != nil || len(sources) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no .c files in %s\n", dir)
+		return 2
+	}
+	sort.Strings(sources)
+
+	workDir, err := os.MkdirTemp("", "ccompiler-subset-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	defer os.RemoveAll(workDir)
+
+	options := cl.options
+	options.StdSubset = true
+	accepted, outside, notCompiled, failed := 0, 0, 0, 0
+	uses := make(map[string][]string) // construct -> file:line of each use
+	var otherErrors []string
+	for _, source := range sources {
+		name := strings.TrimSuffix(filepath.Base(source), ".c")
+		binary := filepath.Join(workDir, name)
+		ours, err := compileAndRun(source, binary, options)
+		if ours.compileError {
+			found := subsetDiagnostic.FindAllStringSubmatch(err.Error(), -1)
+			if len(found) == 0 {
+				otherErrors = append(otherErrors, fmt.Sprintf("%s: %s", filepath.Base(source), firstError(err)))
+				notCompiled++
+				fmt.Printf("ERROR %s: doesn't compile\n", name)
+				continue
+			}
+			for _, match := range found {
+				where := filepath.Base(source)
+				if match[1] != "" {
+					where += ":" + match[1]
+				}
+				construct := strings.TrimSpace(match[2])
+				uses[construct] = append(uses[construct], where)
+			}
+			outside++
+			fmt.Printf("OUT   %s: %d use(s) of constructs outside the subset\n", name, len(found))
+			continue
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL  %s: %v\n", name, err)
+			continue
+		}
+		ref, err := benchReference(reference, source, binary+".ref", 1)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL  %s (%s): %v\n", name, reference, err)
+			continue
+		}
+		if ours != ref.output {
+			failed++
+			fmt.Printf("WRONG %s: accepted by -std=subset, but %s\n", name, describeMismatch(ref.output, ours))
+			continue
+		}
+		accepted++
+		fmt.Printf("OK    %s\n", name)
+	}
+
+	if len(uses) > 0 {
+		constructs := make([]string, 0, len(uses))
+		for construct := range uses {
+			constructs = append(constructs, construct)
+		}
+		sort.Slice(constructs, func(i, j int) bool {
+			a, b := constructs[i], constructs[j]
+			if len(uses[a]) != len(uses[b]) {
+				return len(uses[a]) > len(uses[b])
+			}
+			return a < b
+		})
+		fmt.Println("\nOutside the subset (uses, construct, where):")
+		for _, construct := range constructs {
+			where := uses[construct]
+			if len(where) > 6 {
+				where = append(where[:6:6], "and "+strconv.Itoa(len(where)-6)+" more")
+			}
+			fmt.Printf("  %3d  %s  (%s)\n", len(uses[construct]), construct, strings.Join(where, ", "))
+		}
+	}
+	if len(otherErrors) > 0 {
+		fmt.Println("\nNot compiled for other reasons:")
+		for _, line := range otherErrors {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+	fmt.Printf("\n%d in the subset and correct, %d outside it, %d not compiled, %d failed\n", accepted, outside, notCompiled, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// firstError is the first line of a compile error, or for a list of errors
+// under a heading ("encountered 2 parsing error(s):") the first of them
+func firstError(err error) string {
+	lines := strings.Split(strings.TrimPrefix(err.Error(), "compile: "), "\n")
+	if len(lines) > 1 && strings.HasSuffix(lines[0], ":") {
+		return strings.TrimSpace(lines[1])
+	}
+	return lines[0]
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Switch checks
+// Case labels are integer constant expressions (see const_eval.go), folded
+// here to the number selection compares against. Two cases with the same
+// value would compile to two comparisons, the second never taken, so a
+// duplicate case value is an error. A switch on an enum type that has no
+// default is expected to handle every enumerator; with -Wswitch (on by
+// default) each one it misses is reported.
+
+// checkSwitch checks the case labels of a switch whose controlling
+// expression has type typ
+func (tc *TypeChecker) checkSwitch(node *ASTNode, typ string) {
+	seen := make(map[int64]*ASTNode)
+	handled := make(map[int64]bool)
+	hasDefault := false
+	for _, caseNode := range node.Children[1:] {
+		if caseNode.Type != NodeCase {
+			continue
+		}
+		if caseNode.Value == "default" {
+			hasDefault = true
+			continue
+		}
+		if len(caseNode.Children) == 0 {
+			continue
+		}
+		label := caseNode.Children[0]
+		value, err := evalConstant(label, tc.caseConstant)
+		if err != nil {
+			tc.errorf(caseNode, "case label does not reduce to an integer constant: %v", err)
+			continue
+		}
+		// Selection compares against the folded value
+		caseNode.Children[0] = &ASTNode{Type: NodeNumber, Value: strconv.FormatInt(value, 10), IntValue: int(value), DataType: "int", Line: label.Line}
+		if prev, dup := seen[value]; dup {
+			tc.errorf(caseNode, "duplicate case value '%d' (previously used at line %d)", value, prev.Line)
+			continue
+		}
+		seen[value] = caseNode
+		handled[value] = true
+	}
+	if !tc.warnSwitch || hasDefault {
+		return
+	}
+	enum := tc.enumType(typ)
+	if enum == "" {
+		return
+	}
+	for _, name := range tc.enumMembers[enum] {
+		if !handled[int64(tc.enums[name])] {
+			tc.warnf(node, "-Wswitch", "enumeration value '%s' not handled in switch", name)
+		}
+	}
+}
+
+// caseConstant is the value of an enum constant in a case label, unless a
+// variable of the same name hides it
+func (tc *TypeChecker) caseConstant(name string) (int64, bool) {
+	if _, shadowed := tc.lookup(name); shadowed {
+		return 0, false
+	}
+	value, ok := tc.enums[name]
+	return int64(value), ok
+}
+
+// enumType is the enum type ("enum Color") typ names, through typedefs, or
+// "" if it isn't one
+func (tc *TypeChecker) enumType(typ string) string {
+	var words []string
+	for _, word := range strings.Fields(typ) {
+		if word != "const" && word != "volatile" {
+			words = append(words, word)
+		}
+	}
+	typ = strings.Join(words, " ")
+	for i := 0; i < 8; i++ {
+		if _, ok := tc.enumMembers[typ]; ok {
+			return typ
+		}
+		resolved, ok := tc.typedefs[typ]
+		if !ok || resolved == typ {
+			break
+		}
+		typ = strings.TrimSpace(resolved)
+	}
+	return ""
+}
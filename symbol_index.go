@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Symbol index
+// Editor tooling (go-to-definition, outlines) wants to know what a program
+// declares and where, as this compiler's front end sees it. The parser
+// records each function, global, struct, typedef, enum and enum constant
+// it declares, at the token that names it, and BuildSymbolIndex maps those
+// positions back through the preprocessor to the main source or the header
+// they came from. Only the front end runs, and a parse error still yields
+// the symbols declared before it. -emit-symbol-index prints the index as
+// JSON.
+
+// SymbolKind says what an indexed name is
+type SymbolKind string
+
+const (
+	SymbolFunction     SymbolKind = "function"
+	SymbolGlobal       SymbolKind = "global"
+	SymbolStruct       SymbolKind = "struct"
+	SymbolTypedef      SymbolKind = "typedef"
+	SymbolEnum         SymbolKind = "enum"
+	SymbolEnumConstant SymbolKind = "enum_constant"
+)
+
+// IndexedSymbol is one declaration. Line and Column are 1-based; File is
+// the header it's in, or "" for the main source.
+type IndexedSymbol struct {
+	Name       string     `json:"name"`
+	Kind       SymbolKind `json:"kind"`
+	Type       string     `json:"type,omitempty"` // return type for functions
+	File       string     `json:"file,omitempty"`
+	Line       int        `json:"line"`
+	Column     int        `json:"column"`
+	Definition bool       `json:"definition"` // false for prototypes and extern declarations
+}
+
+// SymbolIndex is everything one program declares, in source order
+type SymbolIndex struct {
+	Symbols []IndexedSymbol `json:"symbols"`
+}
+
+// indexSymbol records a declaration named by tok
+func (p *Parser) indexSymbol(kind SymbolKind, name, typ string, tok Token, definition bool) {
+	p.index = append(p.index, IndexedSymbol{
+		Name:       name,
+		Kind:       kind,
+		Type:       typ,
+		Line:       tok.Line,
+		Column:     tok.Column,
+		Definition: definition,
+	})
+}
+
+// BuildSymbolIndex preprocesses and parses source and indexes what it
+// declares. With a parse error, the index covers what was parsed and the
+// error is returned with it.
+func BuildSymbolIndex(source string, options CompilerOptions) (*SymbolIndex, error) {
+	cp := NewCompilerPipeline(source, options)
+	preprocessed, err := cp.Preprocess()
+	if err != nil {
+		return &SymbolIndex{}, err
+	}
+	cp.parser = NewParser(preprocessed)
+	cp.parser.target = cp.target
+	_, err = cp.parser.Parse()
+	return cp.symbolIndex(), err
+}
+
+// symbolIndex is what the parser recorded, at positions in the original
+// files
+func (cp *CompilerPipeline) symbolIndex() *SymbolIndex {
+	index := &SymbolIndex{Symbols: append([]IndexedSymbol(nil), cp.parser.index...)}
+	if cp.preprocessor != nil {
+		for i := range index.Symbols {
+			sym := &index.Symbols[i]
+			pos := cp.preprocessor.SourcePosition(sym.Line)
+			sym.File, sym.Line = pos.File, pos.Line
+		}
+	}
+	return index
+}
+
+// Lookup returns every declaration of name, definitions first
+func (x *SymbolIndex) Lookup(name string) []IndexedSymbol {
+	var found []IndexedSymbol
+	for _, sym := range x.Symbols {
+		if sym.Name == name {
+			found = append(found, sym)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Definition && !found[j].Definition })
+	return found
+}
+
+// Definition finds where name is defined, falling back to its first
+// declaration
+func (x *SymbolIndex) Definition(name string) (IndexedSymbol, bool) {
+	found := x.Lookup(name)
+	if len(found) == 0 {
+		return IndexedSymbol{}, false
+	}
+	return found[0], true
+}
+
+// Outline lists the declarations in the main source, in line order
+func (x *SymbolIndex) Outline() []IndexedSymbol {
+	var outline []IndexedSymbol
+	for _, sym := range x.Symbols {
+		if sym.File == "" {
+			outline = append(outline, sym)
+		}
+	}
+	sort.SliceStable(outline, func(i, j int) bool {
+		if outline[i].Line != outline[j].Line {
+			return outline[i].Line < outline[j].Line
+		}
+		return outline[i].Column < outline[j].Column
+	})
+	return outline
+}
+
+// JSON renders the index for -emit-symbol-index
+func (x *SymbolIndex) JSON() []byte {
+	data, _ := json.MarshalIndent(x, "", "  ")
+	return append(data, '\n')
+}
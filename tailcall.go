@@ -0,0 +1,134 @@
+package main
+
+// Sibling and tail calls (-foptimize-sibling-calls, on by default at -O2)
+// A call whose result is returned straight away,
+//
+//	call t, f ; mov %rax, t ; ret      (or call ; ret in a void function)
+//
+// possibly through jumps and copies of the result, becomes OpTailCall: the
+// emitter tears down the frame and jumps to f, which returns directly to our
+// caller. Arguments are already in registers, so the frame isn't needed once
+// the call starts - unless something in it escaped. Functions that take the
+// address of a local never tail call, since the callee could still be using
+// it, and neither does setjmp, which needs the frame to return into again
+// (see setjmp.go). Neither do calls into or out of ms_abi functions, whose
+// convention differs in what the stack and registers hold, or calls
+// through a pointer, whose address is only kept for the call. Self-recursive
+// calls are jumps back to the function's entry, so deep recursion runs in
+// constant stack.
+
+// markTailCalls rewrites calls in tail position into OpTailCall
+func (is *InstructionSelector) markTailCalls() {
+	instrs := is.instructions
+	is.instructions = make([]*IRInstruction, 0, len(instrs))
+	start := 0
+	for start < len(instrs) {
+		end := start + 1
+		for end < len(instrs) && !(instrs[end].Op == OpLabel && isFunctionLabel(instrs[end].Dst.Value)) {
+			end++
+		}
+		is.instructions = append(is.instructions, is.tailCallsIn(instrs[start:end])...)
+		start = end
+	}
+}
+
+// tailCallsIn rewrites the tail calls of one function, which starts with
+// its label
+func (is *InstructionSelector) tailCallsIn(fn []*IRInstruction) []*IRInstruction {
+	if len(fn) == 0 || fn[0].Op != OpLabel || frameEscapes(fn) {
+		return fn
+	}
+	void := false
+	if sig, ok := is.functions[fn[0].Dst.Value]; ok {
+		if sig.MSABI {
+			// Its caller's registers are restored before the jump
+			return fn
+		}
+		void = sig.returnsVoid()
+	}
+	labels := make(map[string]int)
+	for i, instr := range fn {
+		if instr.Op == OpLabel {
+			labels[instr.Dst.Value] = i
+		}
+	}
+	out := make([]*IRInstruction, len(fn))
+	copy(out, fn)
+	result := is.target.CallingConvention().IntResults[0]
+	for i, instr := range fn {
+		if instr.Op == OpCall && instr.Src1.Type == "label" && (instr.Dst == nil || instr.Dst.Type == "temp") && !callsReturnTwice(instr) && !is.callsMSABI(instr) && returnsResult(fn, labels, i, void, result) {
+			// What follows the call is dead now but harmless
+			out[i] = &IRInstruction{Op: OpTailCall, Src1: instr.Src1, Src2: instr.Src2, Line: instr.Line, Func: instr.Func}
+		}
+	}
+	return out
+}
+
+// returnsResult reports whether everything after the call at fn[i] only
+// moves its result into the result register (%rax) and returns. Jumps and
+// labels are followed, so returns from inlined bodies and from inside
+// if/else count.
+func returnsResult(fn []*IRInstruction, labels map[string]int, i int, void bool, result string) bool {
+	holders := map[string]bool{result: true}
+	if fn[i].Dst != nil {
+		holders[fn[i].Dst.Value] = true
+	}
+	pos := i + 1
+	for steps := 0; steps < 32 && pos < len(fn); steps++ {
+		instr := fn[pos]
+		switch instr.Op {
+		case OpLabel:
+			pos++
+		case OpJmp:
+			target, ok := labels[instr.Dst.Value]
+			if !ok {
+				return false
+			}
+			pos = target
+		case OpMov:
+			if instr.Src1 == nil || !holders[instr.Src1.Value] || (instr.Src1.Type != "temp" && instr.Src1.Type != "reg") {
+				return false
+			}
+			holders[instr.Dst.Value] = true
+			pos++
+		case OpRet:
+			return void || holders[result]
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// frameEscapes reports whether a function takes the address of any of its
+// own stack slots
+func frameEscapes(fn []*IRInstruction) bool {
+	local := func(op *Operand) bool {
+		return op != nil && (op.Type == "mem" || op.Type == "var") && !op.IsGlobal
+	}
+	var escapes func(op *Operand) bool
+	escapes = func(op *Operand) bool {
+		if op == nil {
+			return false
+		}
+		if op.Type == "addr" && !op.IsGlobal {
+			return true
+		}
+		return escapes(op.IndexTemp) || escapes(op.SourcePtr)
+	}
+	for _, instr := range fn {
+		if instr.Op == OpLoadAddr && local(instr.Src1) {
+			return true
+		}
+		if escapes(instr.Dst) || escapes(instr.Src1) || escapes(instr.Src2) {
+			return true
+		}
+	}
+	return false
+}
+
+// callsMSABI reports whether instr calls an ms_abi function
+func (is *InstructionSelector) callsMSABI(instr *IRInstruction) bool {
+	sig, ok := is.functions[instr.Src1.Value]
+	return ok && sig.MSABI
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Target spec
+// Implementation-defined behavior (scalar sizes and alignments, whether
+// plain char is signed, bitfield allocation order) comes from one TargetSpec
+// rather than constants scattered through the preprocessor, parser and
+// backend. The built-in default describes x86-64 System V (LP64);
+// -target=arm64 selects AArch64 Linux (LP64 too, with unsigned char).
+// -target-spec=<file> loads a JSON spec over the selected one, and
+// -print-target-spec writes the active spec out so it can be reviewed,
+// diffed, or edited into a new one (see targets/).
+
+// TargetSpec describes the implementation-defined parts of the type model
+type TargetSpec struct {
+	Name       string         `json:"name"`
+	Arch       string         `json:"arch"`       // "x86_64" or "aarch64": the instruction set and calling convention
+	Sizes      map[string]int `json:"sizes"`      // bytes, keyed by targetScalarTypes
+	Alignments map[string]int `json:"alignments"` // bytes, same keys
+	CharSigned bool           `json:"char_signed"`
+	// Order bitfields are allocated within a storage unit: "lsb-first" or
+	// "msb-first". The parser doesn't accept bitfield members yet; layout
+	// will follow this when it does.
+	BitfieldOrder string `json:"bitfield_order"`
+}
+
+// targetScalarTypes are the keys every spec defines. Qualifiers and
+// signedness don't change size, and all pointers share "pointer".
+var targetScalarTypes = []string{
+	"_Bool", "char", "short", "int", "long", "long long",
+	"float", "double", "long double", "pointer",
+}
+
+// DefaultTargetSpec returns the x86-64 System V spec
+func DefaultTargetSpec() *TargetSpec {
+	return &TargetSpec{
+		Name: "x86_64-sysv",
+		Arch: "x86_64",
+		Sizes: map[string]int{
+			"_Bool": 1, "char": 1, "short": 2, "int": 4, "long": 8, "long long": 8,
+			"float": 4, "double": 8, "long double": 16, "pointer": 8,
+		},
+		Alignments: map[string]int{
+			"_Bool": 1, "char": 1, "short": 2, "int": 4, "long": 8, "long long": 8,
+			"float": 4, "double": 8, "long double": 16, "pointer": 8,
+		},
+		CharSigned:    true,
+		BitfieldOrder: "lsb-first",
+	}
+}
+
+// AArch64TargetSpec returns the AArch64 Linux (AAPCS64) spec: the same
+// sizes as x86-64, but plain char is unsigned
+func AArch64TargetSpec() *TargetSpec {
+	spec := DefaultTargetSpec()
+	spec.Name = "aarch64-linux"
+	spec.Arch = "aarch64"
+	spec.CharSigned = false
+	return spec
+}
+
+// TargetForArch returns the built-in spec for -target=<arch>
+func TargetForArch(arch string) (*TargetSpec, error) {
+	switch arch {
+	case "", "x86_64", "x86-64", "amd64":
+		return DefaultTargetSpec(), nil
+	case "aarch64", "arm64":
+		return AArch64TargetSpec(), nil
+	}
+	return nil, fmt.Errorf("unknown target '%s' (use x86_64 or arm64)", arch)
+}
+
+// defaultTarget is used by stages the pipeline hasn't given a spec
+var defaultTarget = DefaultTargetSpec()
+
+// LoadTargetSpec reads a JSON spec over base. Keys it leaves out keep
+// base's values.
+func LoadTargetSpec(path string, base *TargetSpec) (*TargetSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("target spec: %w", err)
+	}
+	spec := *base
+	spec.Sizes = copyIntMap(base.Sizes)
+	spec.Alignments = copyIntMap(base.Alignments)
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("target spec %s: %w", path, err)
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, fmt.Errorf("target spec %s: %w", path, err)
+	}
+	return &spec, nil
+}
+
+func copyIntMap(m map[string]int) map[string]int {
+	out := make(map[string]int, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// Validate checks that the spec is complete and self-consistent
+func (t *TargetSpec) Validate() error {
+	for key := range t.Sizes {
+		if !isTargetScalarType(key) {
+			return fmt.Errorf("unknown type %q in sizes", key)
+		}
+	}
+	for key := range t.Alignments {
+		if !isTargetScalarType(key) {
+			return fmt.Errorf("unknown type %q in alignments", key)
+		}
+	}
+	for _, key := range targetScalarTypes {
+		size, align := t.Sizes[key], t.Alignments[key]
+		if size <= 0 {
+			return fmt.Errorf("size of %s must be positive, got %d", key, size)
+		}
+		if align <= 0 || align&(align-1) != 0 {
+			return fmt.Errorf("alignment of %s must be a power of two, got %d", key, align)
+		}
+	}
+	if t.Sizes["char"] != 1 {
+		return fmt.Errorf("size of char must be 1, got %d", t.Sizes["char"])
+	}
+	switch t.BitfieldOrder {
+	case "lsb-first", "msb-first":
+	default:
+		return fmt.Errorf("bitfield_order must be \"lsb-first\" or \"msb-first\", got %q", t.BitfieldOrder)
+	}
+	switch t.Arch {
+	case "x86_64", "aarch64":
+	default:
+		return fmt.Errorf("arch must be \"x86_64\" or \"aarch64\", got %q", t.Arch)
+	}
+	return nil
+}
+
+func isTargetScalarType(key string) bool {
+	for _, known := range targetScalarTypes {
+		if key == known {
+			return true
+		}
+	}
+	return false
+}
+
+// JSON renders the spec in the format LoadTargetSpec reads
+func (t *TargetSpec) JSON() []byte {
+	data, _ := json.MarshalIndent(t, "", "  ")
+	return append(data, '\n')
+}
+
+// scalarKey maps a C type to its spec key, ignoring qualifiers and
+// signedness ("unsigned long int" -> "long", "const char*" -> "pointer").
+// ok is false for void, structs, typedef names and anything else that isn't
+// a built-in scalar.
+func scalarKey(typ string) (key string, ok bool) {
+	typ = trimTopQualifiers(typ)
+	if strings.HasSuffix(typ, "*") {
+		return "pointer", true
+	}
+	var words []string
+	sawSign := false
+	for _, word := range strings.Fields(typ) {
+		switch word {
+		case "const", "volatile", "static", "extern", "register", "restrict", "inline":
+			continue
+		case "signed", "unsigned":
+			sawSign = true
+			continue
+		}
+		words = append(words, word)
+	}
+	switch strings.Join(words, " ") {
+	case "":
+		// Bare "unsigned"/"signed"
+		return "int", sawSign
+	case "int":
+		return "int", true
+	case "short", "short int":
+		return "short", true
+	case "long", "long int":
+		return "long", true
+	case "long long", "long long int":
+		return "long long", true
+	case "char":
+		return "char", true
+	case "_Bool", "bool":
+		return "_Bool", true
+	case "float":
+		return "float", true
+	case "double":
+		return "double", true
+	case "long double":
+		return "long double", true
+	}
+	if len(words) == 2 && words[0] == "enum" {
+		// Enumerated types are compatible with int
+		return "int", true
+	}
+	return "", false
+}
+
+// SizeOf returns the size of a built-in scalar type
+func (t *TargetSpec) SizeOf(typ string) (int, bool) {
+	key, ok := scalarKey(typ)
+	if !ok {
+		return 0, false
+	}
+	return t.Sizes[key], true
+}
+
+// AlignOf returns the alignment of a built-in scalar type
+func (t *TargetSpec) AlignOf(typ string) (int, bool) {
+	key, ok := scalarKey(typ)
+	if !ok {
+		return 0, false
+	}
+	return t.Alignments[key], true
+}
+
+// IsSignedChar reports whether loads of typ sign-extend a byte: signed
+// char always, plain char when the target says so
+func (t *TargetSpec) IsSignedChar(typ string) bool {
+	var words []string
+	for _, word := range strings.Fields(typ) {
+		if word != "const" && word != "volatile" && word != "register" {
+			words = append(words, word)
+		}
+	}
+	switch strings.Join(words, " ") {
+	case "signed char":
+		return true
+	case "char":
+		return t.CharSigned
+	}
+	return false
+}
+
+// IsUnsigned reports whether typ, a scalar type, holds no negative values:
+// the unsigned integer types, _Bool, plain char when the target says so,
+// and pointers
+func (t *TargetSpec) IsUnsigned(typ string) bool {
+	key, ok := scalarKey(typ)
+	switch {
+	case !ok:
+		return false
+	case key == "pointer" || key == "_Bool":
+		return true
+	case key == "char" && !t.IsSignedChar(typ):
+		return true
+	}
+	for _, word := range strings.Fields(typ) {
+		if word == "unsigned" {
+			return true
+		}
+	}
+	return false
+}
+
+// printTargetSpec implements -print-target-spec, honoring -target= and
+// -target-spec= (path, empty if not given)
+func printTargetSpec(arch, path string) {
+	spec, err := resolveTarget(arch, path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(spec.JSON())
+}
+
+// resolveTarget is the spec for -target=arch with -target-spec=path, if
+// given, loaded over it
+func resolveTarget(arch, path string) (*TargetSpec, error) {
+	spec, err := TargetForArch(arch)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		return LoadTargetSpec(path, spec)
+	}
+	return spec, nil
+}
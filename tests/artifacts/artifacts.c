@@ -0,0 +1,14 @@
+// -emit-artifacts writes every stage's output as JSON: the IR, assembly,
+// machine code, declarations and diagnostics
+// (ccompiler test tests/artifacts -emit-artifacts)
+#define SCALE 3
+
+int scale(int x) {
+    return x * SCALE;
+}
+
+int main(void) {
+    const char *name = "scale";
+    char *copy = name;
+    return scale(copy[0] == 's') + 1;
+}
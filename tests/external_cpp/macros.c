@@ -0,0 +1,26 @@
+// Runs with -fexternal-cpp: token pasting, variadic macros and X macros,
+// which the system's cpp expands, with <...> headers still skipped and
+// <assert.h> still defining our assert
+#include <stdio.h>
+#include <assert.h>
+#include "macros.h"
+
+#define DECLARE(name, value) int name = value;
+#define PRINT(name, value) printf("%s = %d\n", #name, name);
+
+static int XCAT(counter_, VERSION_MAJOR) = 40;
+
+int add3(int a, int b, int c) {
+    return a + b + c;
+}
+
+int main() {
+    FIELDS(DECLARE)
+    FIELDS(PRINT)
+    printf("version %s modern %d\n", XSTR(VERSION_MAJOR.VERSION_MINOR), MODERN);
+    printf("counter %d square %d\n", counter_2 + 2, SQUARE(1 + 2));
+    printf("apply %d\n", APPLY(add3, 1, 2, 3));
+    printf("line %d\n", __LINE__);
+    assert(SQUARE(3) == 9);
+    return 0;
+}
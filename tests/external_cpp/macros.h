@@ -0,0 +1,17 @@
+#ifndef MACROS_H
+#define MACROS_H
+#define CAT(a, b) a##b
+#define XCAT(a, b) CAT(a, b)
+#define STR(x) #x
+#define XSTR(x) STR(x)
+#define VERSION_MAJOR 2
+#define VERSION_MINOR 7
+#define SQUARE(x) ((x) * (x))
+#define APPLY(f, ...) f(__VA_ARGS__)
+#define FIELDS(X) X(width, 3) X(height, 4) X(depth, 5)
+#if VERSION_MAJOR * 100 + VERSION_MINOR >= 207 && defined(SQUARE)
+#define MODERN 1
+#else
+#define MODERN 0
+#endif
+#endif
@@ -0,0 +1,44 @@
+// Runs with -ffreestanding: write, malloc and exit come from the builtin
+// runtime, and main is called from _start
+void *malloc(unsigned long n);
+void free(void *p);
+long write(int fd, const void *buf, unsigned long n);
+void exit(int status);
+
+long length(char *s) {
+    long n = 0;
+    while (*(s + n)) n = n + 1;
+    return n;
+}
+
+void say(char *s) {
+    write(1, s, length(s));
+}
+
+int main() {
+    char *letters = malloc(27);
+    char *ok = malloc(100);
+    long i = 0;
+    while (i < 26) {
+        *(letters + i) = 'a' + i;
+        i = i + 1;
+    }
+    *(letters + 26) = 0;
+    say(letters);
+    say("\n");
+
+    // Blocks don't overlap
+    *ok = 'o';
+    *(ok + 1) = 'k';
+    *(ok + 2) = '\n';
+    *(ok + 3) = 0;
+    if (ok - letters >= 27) say(ok);
+    free(letters);
+    free(ok);
+
+#if __STDC_HOSTED__
+    say("hosted\n");
+#endif
+    exit(3);
+    return 0;
+}
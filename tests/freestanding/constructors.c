@@ -0,0 +1,40 @@
+// Runs with -ffreestanding: the _start stub runs the constructors before
+// main, by priority, and the destructors once main returns
+int write(int fd, char *buf, long n);
+
+long length(char *s) {
+    long n = 0;
+    while (*(s + n)) n = n + 1;
+    return n;
+}
+
+void say(char *s) {
+    write(1, s, length(s));
+}
+
+int ready;
+
+__attribute__((constructor)) static void second(void) {
+    say("constructor\n");
+    ready = ready + 1;
+}
+
+__attribute__((constructor(101))) static void first(void) {
+    say("constructor(101)\n");
+    ready = ready + 1;
+}
+
+static void cleanup(void) __attribute__((destructor));
+
+static void cleanup(void) {
+    say("destructor\n");
+}
+
+__attribute__((destructor(101))) static void last(void) {
+    say("destructor(101)\n");
+}
+
+int main() {
+    if (ready == 2) say("main, after both constructors\n");
+    return 3;
+}
@@ -0,0 +1,25 @@
+// Globals initialized with addresses: each is a .quad the linker fills in,
+// with -fuse-ld=internal too
+long write(long fd, char *buf, long n);
+
+long lengths[3] = {5, 4, 6};
+char *words[] = {"zero\n", "one\n", "three\n"};
+struct Entry {
+    char *text;
+    long size;
+};
+struct Entry entries[2] = {{"first\n", 6}, {.size = 7, .text = "second\n"}};
+long *middle = &lengths[1];
+long *last = lengths + 2;
+char *tail = "skipped: tail\n" + 9;
+struct Entry *second = &entries[1];
+
+int main() {
+    write(1, words[0], lengths[0]);
+    write(1, words[1], lengths[1]);
+    write(1, words[2], lengths[2]);
+    write(1, entries[0].text, entries[0].size);
+    write(1, second->text, second->size);
+    write(1, tail, 5);
+    return *middle * 10 + *last;
+}
@@ -0,0 +1,16 @@
+// Strings, initialized and zeroed globals and a float constant: with
+// -fuse-ld=internal too, every one of them is laid out by the assembler
+long write(long fd, char *buf, long n);
+
+long counter = 5;
+long total;
+
+int main() {
+    char *a = "data \"sections\"\tok\n";
+    write(1, a, 19);
+    write(1, "x\101\x42\n", 4);
+    double half = 0.5;
+    total = counter + 37;
+    if (half > 0.25) write(1, "half\n", 5);
+    return total;
+}
@@ -0,0 +1,51 @@
+// Runs with -ffreestanding: system calls made directly with __syscall,
+// with no runtime function in between (x86-64 Linux numbers)
+void *malloc(unsigned long n);
+
+enum { SYS_write = 1, SYS_getpid = 39, SYS_rt_sigprocmask = 14, SYS_exit = 60 };
+
+long length(char *s) {
+    long n = 0;
+    while (*(s + n)) n = n + 1;
+    return n;
+}
+
+void say(char *s) {
+    __syscall(SYS_write, 1, s, length(s));
+}
+
+void say_number(long n) {
+    if (n >= 10) say_number(n / 10);
+    char *digit = malloc(8);
+    *digit = '0' + n % 10;
+    __syscall(SYS_write, 1, digit, 1);
+}
+
+int main() {
+    long written = __syscall(SYS_write, 1, "hello from a raw write\n", 23);
+    say("wrote ");
+    say_number(written);
+    say(" bytes\n");
+
+    if (__syscall(SYS_getpid) > 0) say("have a pid\n");
+
+    // Four arguments: the fourth, the size of the signal set, must reach
+    // the kernel in r10 or the call fails with -EINVAL
+    long old[2];
+    long masked = __syscall(SYS_rt_sigprocmask, 0, 0, old, 8);
+    say("sigprocmask: ");
+    say_number(masked);
+    say("\n");
+    long bad = __syscall(SYS_rt_sigprocmask, 0, 0, old, 3);
+    if (bad < 0) say("a bad size is refused\n");
+
+    // A bad file descriptor comes back as -EBADF
+    long failed = __syscall(SYS_write, 99, "x", 1);
+    say("bad fd: -");
+    say_number(-failed);
+    say("\n");
+
+    __syscall(SYS_exit, 0);
+    say("not reached\n");
+    return 1;
+}
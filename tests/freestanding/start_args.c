@@ -0,0 +1,19 @@
+// _start passes main the argc, argv and envp it finds on the stack
+long write(int fd, const void *buf, unsigned long n);
+
+void check(long ok, char *what) {
+    if (ok) write(1, "ok   ", 5);
+    else write(1, "FAIL ", 5);
+    long n = 0;
+    while (*(what + n)) n = n + 1;
+    write(1, what, n);
+    write(1, "\n", 1);
+}
+
+int main(long argc, char **argv, char **envp) {
+    check(argc == 1, "argc");
+    check(argv[0] != 0, "argv[0]");
+    check(argv[argc] == 0, "argv ends with NULL");
+    check(envp == &argv[argc + 1], "envp follows argv");
+    return argc + 4;
+}
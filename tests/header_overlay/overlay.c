@@ -0,0 +1,15 @@
+// Runs with -fheader-overlay=headers.json: headers served from memory, one that
+// only exists there, one that hides the file of the same name on disk, and
+// one in a subdirectory that includes another (#pragma once still applies)
+#include <stdio.h>
+#include "memory.h"
+#include "shadowed.h"
+#include "include/nested.h"
+#include "memory.h"
+
+int main() {
+	printf("%d %d\n", FROM_MEMORY, twice(FROM_MEMORY));
+	printf("%s\n", SHADOWED);
+	printf("%d\n", NESTED);
+	return 0;
+}
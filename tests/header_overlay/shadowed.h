@@ -0,0 +1,2 @@
+// Served from headers.json instead under -fheader-overlay=
+#define SHADOWED "from disk"
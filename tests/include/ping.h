@@ -0,0 +1,11 @@
+// ping.h and pong.h include each other
+#if !defined(PING_H)
+#define PING_H
+
+#include "pong.h"
+
+static int ping(int n) {
+    return n + 1;
+}
+
+#endif
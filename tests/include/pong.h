@@ -0,0 +1,8 @@
+#ifndef PONG_H
+#define PONG_H
+#include "ping.h"
+
+static int pong(int n) {
+    return n * 10;
+}
+#endif
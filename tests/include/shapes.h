@@ -0,0 +1,16 @@
+/* Shapes: guarded, and included by way of several paths */
+#ifndef SHAPES_H
+#define SHAPES_H
+
+#include "units.h"
+
+struct Rect {
+    int w;
+    int h;
+};
+
+static int area(struct Rect r) {
+    return r.w * r.h * UNIT;
+}
+
+#endif /* SHAPES_H */
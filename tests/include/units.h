@@ -0,0 +1,5 @@
+#pragma once
+
+#define UNIT 2
+
+static int units_included = 1;
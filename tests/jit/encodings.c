@@ -0,0 +1,46 @@
+// Runs with -jit: the built-in assembler encodes everything, including
+// 32-bit division (cdq, idivl), byte stores (movb) and indexed addressing
+#include <stdio.h>
+
+struct Point {
+    int x;
+    int y;
+};
+
+char initial;
+struct Point origin;
+struct Tag {
+    char kind;
+    char mark;
+} tag;
+char *names[] = {"zero", "one", "two"};
+
+int main() {
+    char buf[8];
+    long squares[6];
+    int i;
+    int total = 0;
+    for (i = 0; i < 6; i++) {
+        squares[i] = i * i;
+    }
+    for (i = 0; i < 7; i++) {
+        int q = i / 2;
+        buf[i] = 'a' + q;
+        total = total + q + i % 3;
+    }
+    initial = buf[6];
+    struct Tag local;
+    local.kind = 'L';
+    local.mark = buf[1];
+    tag.kind = 'G';
+    char *p = &tag.mark;
+    *p = '!';
+    origin.x = -17 / 5;
+    origin.y = -17 % 5;
+    long big = 1000000007;
+    printf("%c%c%c %c %d\n", buf[0], buf[3], buf[5], initial, total);
+    printf("%ld %ld %ld\n", squares[2], squares[5], big / squares[3]);
+    printf("%d %d %s\n", origin.x, origin.y, names[2]);
+    printf("%c%c %c%c\n", local.kind, local.mark, tag.kind, tag.mark);
+    return squares[4] + origin.y;
+}
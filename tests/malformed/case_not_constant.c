@@ -0,0 +1,11 @@
+int pick(int x, int y) {
+    switch (x) {
+        case 1: return 10;
+        case y: return 20;
+    }
+    return 0;
+}
+
+int main() {
+    return pick(1, 2);
+}
@@ -0,0 +1,7 @@
+// Writing a const variable is caught by the type checker, at the line of
+// the write, with -fsyntax-only too (ccompiler test tests/malformed -fsyntax-only)
+int main() {
+    const int limit = 10;
+    limit = 20;
+    return limit;
+}
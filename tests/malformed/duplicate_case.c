@@ -0,0 +1,14 @@
+enum Shape { CIRCLE, SQUARE, TRIANGLE };
+
+int sides(int shape) {
+    switch (shape) {
+        case 0: return 0;
+        case SQUARE: return 4;
+        case 1: return 4;
+    }
+    return 3;
+}
+
+int main() {
+    return sides(SQUARE);
+}
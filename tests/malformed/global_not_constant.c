@@ -0,0 +1,8 @@
+// A global's initializer must be a constant or an address: it isn't
+// silently left zero
+int count = 3;
+int copies[2] = {1, count};
+
+int main() {
+    return copies[1];
+}
@@ -0,0 +1,8 @@
+// A global pointer to an array isn't supported: it's an error, not a
+// pointer left null
+int grid[2][3] = {{1, 2, 3}, {4, 5, 6}};
+int (*row)[3] = &grid[1];
+
+int main() {
+    return (*row)[0];
+}
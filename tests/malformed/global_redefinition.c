@@ -0,0 +1,3 @@
+int x = 1;
+int x = 2;
+int main() { return x; }
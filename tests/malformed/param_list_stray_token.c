@@ -0,0 +1,3 @@
+// Fuzz-derived: a parameter list that ends in a token nothing consumes
+// used to loop forever.
+t m(?
@@ -0,0 +1,6 @@
+// Fuzz-derived: an unclosed parameter list runs into the body.
+int f( { }
+
+int main() {
+    return 0;
+}
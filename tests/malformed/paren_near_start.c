@@ -0,0 +1 @@
+int f(){return (1;}
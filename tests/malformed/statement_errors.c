@@ -0,0 +1,20 @@
+// Each bad statement is reported and skipped; parsing carries on with the
+// next statement, case and function.
+int f(int x) {
+    int y = ;
+    switch (x) {
+    case 1:
+        y = );
+        break;
+    default:
+        y = 2 +;
+    }
+    return y;
+}
+
+int main() {
+    if (f(1) {
+        return 1;
+    }
+    return (0;
+}
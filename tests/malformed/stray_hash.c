@@ -0,0 +1,4 @@
+// Fuzz-derived: a '#' at the end of a line was never consumed, so the
+// parser spun on it until its iteration cap gave up, hiding the real error.
+int a; #
+int f( { }
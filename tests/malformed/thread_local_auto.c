@@ -0,0 +1,9 @@
+int next_id(void) {
+    __thread int id;
+    id = id + 1;
+    return id;
+}
+
+int main() {
+    return next_id();
+}
@@ -0,0 +1,6 @@
+// An unknown character used to end the token stream, silently dropping
+// the rest of the file.
+int main() {
+    int a = 1 @ 2;
+    return a;
+}
@@ -0,0 +1,34 @@
+// ctype.h and atoi
+#include <stdio.h>
+
+int my_isspace(int c) {
+    return c == ' ' || c == '\t' || c == '\n';
+}
+
+int my_isdigit(int c) {
+    return c >= '0' && c <= '9';
+}
+
+int my_atoi(const char *s) {
+    while (my_isspace(*s)) {
+        s++;
+    }
+    int sign = 1;
+    if (*s == '-') {
+        sign = -1;
+        s++;
+    } else if (*s == '+') {
+        s++;
+    }
+    int value = 0;
+    while (my_isdigit(*s)) {
+        value = value * 10 + (*s - '0');
+        s++;
+    }
+    return sign * value;
+}
+
+int main() {
+    printf("%d %d %d %d\n", my_atoi("42"), my_atoi("  -17x"), my_atoi("+8"), my_atoi("none"));
+    return 0;
+}
@@ -0,0 +1,31 @@
+// Bit twiddling on unsigned values
+#include <stdio.h>
+
+int popcount(unsigned long x) {
+    int n = 0;
+    while (x) {
+        x = x & (x - 1);
+        n++;
+    }
+    return n;
+}
+
+unsigned int reverse_bits(unsigned int x) {
+    unsigned int r = 0;
+    for (int i = 0; i < 32; i++) {
+        r = (r << 1) | (x & 1);
+        x = x >> 1;
+    }
+    return r;
+}
+
+int is_power_of_two(unsigned long x) {
+    return x != 0 && (x & (x - 1)) == 0;
+}
+
+int main() {
+    printf("%d %d %d\n", popcount(0), popcount(255), popcount(0xF0F0F0F0F0UL));
+    printf("%08x %08x\n", reverse_bits(1), reverse_bits(0x12345678));
+    printf("%d %d %d\n", is_power_of_two(64), is_power_of_two(96), is_power_of_two(1UL << 40));
+    return 0;
+}
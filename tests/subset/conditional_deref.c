@@ -0,0 +1,20 @@
+// A struct-valued conditional whose arm is reached through a pointer is
+// outside the subset: the arm's first bytes would be copied as an address
+#include <stdio.h>
+
+struct Box {
+    long left;
+    long top;
+    long width;
+};
+
+long width(struct Box *current, struct Box other, int pick) {
+    return (pick ? *current : other).width;
+}
+
+int main(void) {
+    struct Box first = {1, 2, 3};
+    struct Box second = {4, 5, 6};
+    printf("%ld\n", width(&first, second, 1));
+    return 0;
+}
@@ -0,0 +1,35 @@
+// Conditionals that pick between struct values: variables, calls and
+// compound literals are copied whole, whatever the struct's size
+#include <stdio.h>
+
+struct Point {
+    int x;
+    int y;
+};
+
+struct Box {
+    long left;
+    long top;
+    long width;
+};
+
+struct Box unit(long at) {
+    struct Box b = {at, at, 1};
+    return b;
+}
+
+int main(void) {
+    struct Point a = {1, 2};
+    struct Point b = {3, 4};
+    struct Box wide = {10, 20, 30};
+    int pick = 1;
+    printf("%d %d\n", (pick ? a : b).y, (!pick ? a : b).x);
+    struct Point chosen = pick ? b : a;
+    printf("%d %d\n", chosen.x, chosen.y);
+    printf("%ld\n", (pick ? wide : unit(5)).width);
+    struct Box other = !pick ? wide : unit(7);
+    printf("%ld %ld %ld\n", other.left, other.top, other.width);
+    struct Point lit = pick ? (struct Point){8, 9} : a;
+    printf("%d %d\n", lit.x, lit.y);
+    return 0;
+}
@@ -0,0 +1,39 @@
+// Global tables: arrays, structs and the addresses of strings and other
+// globals, laid out by the compiler in .data
+#include <stdio.h>
+
+struct Unit {
+    const char *name;
+    long scale;
+};
+
+struct Unit units[3] = {{"bytes", 1}, {"kilobytes", 1024}, {"megabytes", 1048576}};
+const char *suffixes[] = {"B", "KiB", "MiB"};
+long limits[3] = {1024, 1048576};
+struct Unit *largest = &units[2];
+long counts[3][2];
+int total = 6 * 7;
+
+int pick(long size) {
+    int i = 0;
+    while (i < 2 && size >= limits[i]) {
+        i = i + 1;
+    }
+    return i;
+}
+
+int main(void) {
+    long sizes[3] = {512, 4096, 3145728};
+    int i;
+    for (i = 0; i < 3; i = i + 1) {
+        int unit = pick(sizes[i]);
+        counts[unit][0] = counts[unit][0] + 1;
+        counts[unit][1] = counts[unit][1] + sizes[i];
+        printf("%ld %s (%s)\n", sizes[i] / units[unit].scale, suffixes[unit], units[unit].name);
+    }
+    for (i = 0; i < 3; i = i + 1) {
+        printf("%s: %ld, %ld\n", units[i].name, counts[i][0], counts[i][1]);
+    }
+    printf("%s %ld %d\n", largest->name, largest->scale, total);
+    return 0;
+}
@@ -0,0 +1,26 @@
+// djb2 string hashing into buckets
+#include <stdio.h>
+#include <stdlib.h>
+
+unsigned long hash(const char *s) {
+    unsigned long h = 5381;
+    while (*s) {
+        h = h * 33 + *s;
+        s++;
+    }
+    return h;
+}
+
+int main() {
+    int *buckets = calloc(8, sizeof(int));
+    const char *words[6] = {"apple", "banana", "cherry", "date", "elder", "fig"};
+    for (int i = 0; i < 6; i++) {
+        buckets[hash(words[i]) % 8]++;
+    }
+    for (int i = 0; i < 8; i++) {
+        printf("%d", buckets[i]);
+    }
+    printf(" %lu\n", hash("hash") % 1000);
+    free(buckets);
+    return 0;
+}
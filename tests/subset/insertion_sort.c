@@ -0,0 +1,29 @@
+// Sorting records by key
+#include <stdio.h>
+
+typedef struct {
+    int key;
+    double weight;
+} Record;
+
+void sort_records(Record *r, int n) {
+    for (int i = 1; i < n; i++) {
+        Record current = r[i];
+        int j = i - 1;
+        while (j >= 0 && r[j].key > current.key) {
+            r[j + 1] = r[j];
+            j--;
+        }
+        r[j + 1] = current;
+    }
+}
+
+int main() {
+    Record records[5] = {{5, 0.5}, {2, 0.2}, {9, 0.9}, {1, 0.1}, {7, 0.7}};
+    sort_records(records, 5);
+    for (int i = 0; i < 5; i++) {
+        printf("%d:%.1f ", records[i].key, records[i].weight);
+    }
+    printf("\n");
+    return 0;
+}
@@ -0,0 +1,31 @@
+// Formatting a number into a buffer on the stack
+#include <stdio.h>
+
+int format_int(char *buf, int value) {
+    char digits[16];
+    int n = 0;
+    int negative = value < 0;
+    if (negative) {
+        value = -value;
+    }
+    do {
+        digits[n++] = '0' + value % 10;
+        value /= 10;
+    } while (value > 0);
+    int len = 0;
+    if (negative) {
+        buf[len++] = '-';
+    }
+    while (n > 0) {
+        buf[len++] = digits[--n];
+    }
+    buf[len] = 0;
+    return len;
+}
+
+int main() {
+    char buf[16];
+    int len = format_int(buf, -4096);
+    printf("%s (%d)\n", buf, len);
+    return 0;
+}
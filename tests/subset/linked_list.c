@@ -0,0 +1,49 @@
+// A singly linked list on the heap
+#include <stdio.h>
+#include <stdlib.h>
+
+typedef struct Node {
+    int value;
+    struct Node *next;
+} Node;
+
+Node *push(Node *head, int value) {
+    Node *node = malloc(sizeof(Node));
+    node->value = value;
+    node->next = head;
+    return node;
+}
+
+Node *reverse(Node *head) {
+    Node *prev = 0;
+    while (head) {
+        Node *next = head->next;
+        head->next = prev;
+        prev = head;
+        head = next;
+    }
+    return prev;
+}
+
+int sum(Node *head) {
+    int total = 0;
+    for (Node *n = head; n; n = n->next) {
+        total += n->value;
+    }
+    return total;
+}
+
+int main() {
+    Node *list = 0;
+    for (int i = 1; i <= 5; i++) {
+        list = push(list, i * i);
+    }
+    list = reverse(list);
+    printf("first %d, sum %d\n", list->value, sum(list));
+    while (list) {
+        Node *next = list->next;
+        free(list);
+        list = next;
+    }
+    return 0;
+}
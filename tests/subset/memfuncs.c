@@ -0,0 +1,47 @@
+// memset, memcpy and memcmp over bytes
+#include <stdio.h>
+#include <stdlib.h>
+
+void *my_memset(void *dst, int c, unsigned long n) {
+    unsigned char *p = dst;
+    for (unsigned long i = 0; i < n; i++) {
+        p[i] = c;
+    }
+    return dst;
+}
+
+void *my_memcpy(void *dst, const void *src, unsigned long n) {
+    unsigned char *d = dst;
+    const unsigned char *s = src;
+    unsigned long i = 0;
+    while (i < n) {
+        d[i] = s[i];
+        i++;
+    }
+    return dst;
+}
+
+int my_memcmp(const void *a, const void *b, unsigned long n) {
+    const unsigned char *x = a;
+    const unsigned char *y = b;
+    unsigned long i = 0;
+    while (i < n) {
+        if (x[i] != y[i]) {
+            return x[i] - y[i];
+        }
+        i++;
+    }
+    return 0;
+}
+
+int main() {
+    unsigned char *a = malloc(16);
+    unsigned char *b = malloc(16);
+    my_memset(a, 7, 16);
+    my_memcpy(b, a, 16);
+    b[9] = 9;
+    printf("%d %d %d\n", a[15], my_memcmp(a, b, 9), my_memcmp(a, b, 16));
+    free(a);
+    free(b);
+    return 0;
+}
@@ -0,0 +1,45 @@
+// Integer number theory: gcd, modular powers, integer square roots
+#include <stdio.h>
+
+long gcd(long a, long b) {
+    while (b != 0) {
+        long t = a % b;
+        a = b;
+        b = t;
+    }
+    return a;
+}
+
+long power_mod(long base, long exp, long mod) {
+    long result = 1;
+    base = base % mod;
+    while (exp > 0) {
+        if (exp % 2 == 1) {
+            result = result * base % mod;
+        }
+        base = base * base % mod;
+        exp = exp / 2;
+    }
+    return result;
+}
+
+long isqrt(long n) {
+    if (n < 2) {
+        return n;
+    }
+    long x = n;
+    long y = (x + 1) / 2;
+    while (y < x) {
+        x = y;
+        y = (x + n / x) / 2;
+    }
+    return x;
+}
+
+int main() {
+    printf("gcd %ld, lcm %ld\n", gcd(1071, 462), 1071 / gcd(1071, 462) * 462);
+    printf("3^200 mod 1000007 = %ld\n", power_mod(3, 200, 1000007));
+    printf("isqrt %ld %ld %ld\n", isqrt(99), isqrt(100), isqrt(1000000007));
+    printf("isqrt %ld, 5^3 mod 2^33 = %ld\n", isqrt(5000000000L), power_mod(5, 3, 8589934592L));
+    return 0;
+}
@@ -0,0 +1,51 @@
+// A fixed-size ring buffer behind a pointer to its state
+#include <stdio.h>
+#include <stdlib.h>
+
+typedef struct {
+    int *data;
+    int capacity;
+    int head;
+    int count;
+} Ring;
+
+Ring *ring_new(int capacity) {
+    Ring *r = malloc(sizeof(Ring));
+    r->data = malloc(capacity * sizeof(int));
+    r->capacity = capacity;
+    r->head = 0;
+    r->count = 0;
+    return r;
+}
+
+void ring_push(Ring *r, int value) {
+    int tail = (r->head + r->count) % r->capacity;
+    *(r->data + tail) = value;
+    if (r->count == r->capacity) {
+        r->head = (r->head + 1) % r->capacity;
+    } else {
+        r->count = r->count + 1;
+    }
+}
+
+int ring_pop(Ring *r) {
+    int value = *(r->data + r->head);
+    r->head = (r->head + 1) % r->capacity;
+    r->count = r->count - 1;
+    return value;
+}
+
+int main() {
+    Ring *r = ring_new(4);
+    for (int i = 1; i <= 6; i++) {
+        ring_push(r, i * 10);
+    }
+    int total = 0;
+    while (r->count > 0) {
+        total = total * 100 + ring_pop(r) / 10;
+    }
+    printf("%d\n", total);
+    free(r->data);
+    free(r);
+    return 0;
+}
@@ -0,0 +1,62 @@
+// Calls that pass arguments on the stack: scalars after the sixth integer
+// or eighth floating-point one, a struct whose eightbytes don't all fit in
+// the registers that are left, and structs of more than 16 bytes
+#include <stdio.h>
+
+struct Pair {
+    long x;
+    long y;
+};
+
+struct Big {
+    long a;
+    long b;
+    long c;
+    int d;
+};
+
+long many(long a, long b, long c, long d, long e, long f, long g, long h) {
+    return a + 2 * b + 3 * c + 4 * d + 5 * e + 6 * f + 7 * g + 8 * h;
+}
+
+double tenths(double a, double b, double c, double d, double e, double f, double g, double h, double i, double j) {
+    return a + b + c + d + e + f + g + h + i * 10 + j * 100;
+}
+
+long pairs(long a, long b, long c, long d, long e, struct Pair p, struct Pair q) {
+    return a + b + c + d + e + p.x * 10 + p.y * 100 + q.x * 1000 + q.y * 10000;
+}
+
+long after(long a, long b, long c, long d, long e, struct Pair p, long f) {
+    return a + b + c + d + e + p.x * 10 + p.y * 100 + f * 1000;
+}
+
+long sumbig(struct Big b) {
+    return b.a + b.b * 10 + b.c * 100 + b.d * 1000;
+}
+
+long around(long x, struct Big b, long y) {
+    b.a = 9;
+    return x + sumbig(b) * 10 + y;
+}
+
+int main() {
+    struct Pair p;
+    struct Pair q;
+    p.x = 1;
+    p.y = 2;
+    q.x = 3;
+    q.y = 4;
+    printf("%ld\n", many(1, 2, 3, 4, 5, 6, 7, 8));
+    printf("%.1f\n", tenths(1, 2, 3, 4, 5, 6, 7, 8, 9, 10));
+    printf("%ld\n", pairs(1, 1, 1, 1, 1, p, q));
+    printf("%ld\n", after(1, 1, 1, 1, 1, p, 9));
+    struct Big big;
+    big.a = 1;
+    big.b = 2;
+    big.c = 3;
+    big.d = 4;
+    printf("%ld\n", sumbig(big));
+    printf("%ld %ld\n", around(5, big, 6), big.a);
+    return 0;
+}
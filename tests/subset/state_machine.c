@@ -0,0 +1,48 @@
+// A switch-driven lexer for integers and operators
+#include <stdio.h>
+
+enum Kind { NUMBER, PLUS, MINUS, END, OTHER };
+
+int classify(char c) {
+    switch (c) {
+    case '+':
+        return PLUS;
+    case '-':
+        return MINUS;
+    case 0:
+        return END;
+    default:
+        if (c >= '0' && c <= '9') {
+            return NUMBER;
+        }
+        return OTHER;
+    }
+}
+
+int evaluate(const char *s) {
+    int total = 0;
+    int sign = 1;
+    while (*s) {
+        int kind = classify(*s);
+        switch (kind) {
+        case NUMBER:
+            total += sign * (*s - '0');
+            break;
+        case PLUS:
+            sign = 1;
+            break;
+        case MINUS:
+            sign = -1;
+            break;
+        default:
+            break;
+        }
+        s++;
+    }
+    return total;
+}
+
+int main() {
+    printf("%d %d\n", evaluate("1+2+3"), evaluate("9-4 - 1+x"));
+    return 0;
+}
@@ -0,0 +1,55 @@
+// string.h routines over malloc'd buffers
+#include <stdio.h>
+#include <stdlib.h>
+
+unsigned long my_strlen(const char *s) {
+    unsigned long n = 0;
+    while (s[n]) {
+        n++;
+    }
+    return n;
+}
+
+int my_strcmp(const char *a, const char *b) {
+    while (*a && *a == *b) {
+        a++;
+        b++;
+    }
+    return *a - *b;
+}
+
+char *my_strchr(const char *s, int c) {
+    while (*s) {
+        if (*s == c) {
+            return (char *)s;
+        }
+        s++;
+    }
+    return 0;
+}
+
+char *my_strcpy(char *dst, const char *src) {
+    char *d = dst;
+    while (*src) {
+        *d = *src;
+        d++;
+        src++;
+    }
+    *d = 0;
+    return dst;
+}
+
+char *my_strdup(const char *s) {
+    char *copy = malloc(my_strlen(s) + 1);
+    return my_strcpy(copy, s);
+}
+
+int main() {
+    char *hello = my_strdup("hello, world");
+    printf("%lu %s\n", my_strlen(hello), hello);
+    printf("%d %d %d\n", my_strcmp("abc", "abc") == 0, my_strcmp("abc", "abd") < 0, my_strcmp("b", "a") > 0);
+    char *comma = my_strchr(hello, ',');
+    printf("%s|%d\n", comma, my_strchr(hello, 'z') == 0);
+    free(hello);
+    return 0;
+}
@@ -0,0 +1,34 @@
+// Splitting a line into words, strtok style
+#include <stdio.h>
+
+int count_words(const char *s) {
+    int words = 0;
+    int in_word = 0;
+    for (; *s; s++) {
+        if (*s == ' ' || *s == ',') {
+            in_word = 0;
+            continue;
+        }
+        if (!in_word) {
+            words++;
+            in_word = 1;
+        }
+    }
+    return words;
+}
+
+int first_word_length(const char *s) {
+    int n = 0;
+    while (1) {
+        if (s[n] == 0 || s[n] == ' ') {
+            break;
+        }
+        n++;
+    }
+    return n;
+}
+
+int main() {
+    printf("%d %d\n", count_words("the quick, brown  fox"), first_word_length("jumps over"));
+    return 0;
+}
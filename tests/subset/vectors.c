@@ -0,0 +1,34 @@
+// Small structs of doubles passed and returned by value
+#include <stdio.h>
+
+typedef struct {
+    double x;
+    double y;
+} Vec2;
+
+Vec2 vec2(double x, double y) {
+    Vec2 v;
+    v.x = x;
+    v.y = y;
+    return v;
+}
+
+Vec2 add(Vec2 a, Vec2 b) {
+    return vec2(a.x + b.x, a.y + b.y);
+}
+
+Vec2 scale(Vec2 v, double s) {
+    return vec2(v.x * s, v.y * s);
+}
+
+double dot(Vec2 a, Vec2 b) {
+    return a.x * b.x + a.y * b.y;
+}
+
+int main() {
+    Vec2 a = vec2(1.5, -2);
+    Vec2 b = vec2(4, 0.25);
+    Vec2 c = add(scale(a, 2), b);
+    printf("(%.2f, %.2f) dot %.3f\n", c.x, c.y, dot(a, b));
+    return 0;
+}
@@ -0,0 +1,70 @@
+#include <stdio.h>
+
+typedef struct { int a; short s; unsigned char u; } S;
+
+unsigned int half(unsigned int v) {
+    return v / 2;
+}
+
+long widen(int v) {
+    return v;
+}
+
+int main() {
+    int x = -1;
+    long y = x;
+    printf("1 %ld\n", y);
+    long z = x + 10L;
+    printf("2 %ld\n", z);
+    char c = -3;
+    int ci = c + 1;
+    printf("3 %d\n", ci);
+    unsigned int u = 0;
+    printf("4 %d\n", u - 1 > 5);
+    unsigned char uc = 200;
+    printf("5 %d\n", uc + uc);
+    int n = 3;
+    double d = n + 0.5;
+    printf("6 %f\n", d);
+    double e = 2.75;
+    int t = e;
+    printf("7 %d\n", t);
+    long m = n * e;
+    printf("8 %ld\n", m);
+    printf("9 %f\n", n / 2.0);
+    printf("10 %d\n", x < 0u);
+    unsigned int big = 4000000000u;
+    printf("11 %ld\n", big + 1L);
+    short sh = -5;
+    printf("12 %ld\n", sh * 2L);
+    S s;
+    s.a = -7;
+    s.s = -2;
+    s.u = 250;
+    long r = s.a + s.s + s.u;
+    printf("13 %ld\n", r);
+    int q = -7;
+    printf("14 %d %d\n", q / 2, q % 3);
+    double f = n;
+    printf("15 %f\n", f);
+    printf("16 %d\n", n < 3.5);
+    unsigned int top = 4294967295u;
+    printf("17 %u %u %u\n", top + 1, top / 3, top >> 28);
+    printf("18 %u\n", half(top));
+    unsigned char k = 250;
+    k += 10;
+    printf("19 %d\n", k);
+    char trunc = 300;
+    printf("20 %d\n", trunc);
+    printf("21 %ld\n", widen(-42));
+    int neg = -9;
+    printf("22 %d\n", neg >> 1);
+    double g = -2.5;
+    printf("23 %d\n", g < 0);
+    unsigned int one = 1;
+    printf("24 %u %u\n", -one, ~one);
+    unsigned char wrap = 255;
+    wrap++;
+    printf("25 %d %d\n", wrap, -wrap);
+    return 0;
+}
@@ -0,0 +1,31 @@
+// assert from <assert.h>: passing assertions do nothing, and with NDEBUG
+// defined before the include, assert doesn't evaluate its argument
+#include <assert.h>
+
+int calls = 0;
+
+int count() {
+    calls = calls + 1;
+    return 1;
+}
+
+int check(int n) {
+    assert(n >= 0);
+    assert(n < 100 && "n in range, (0..99)");
+    return n * 2;
+}
+
+#define NDEBUG
+#include <assert.h>
+
+int unchecked(int n) {
+    assert(count() == 0);
+    return n;
+}
+
+int main() {
+    printf("%d\n", check(21));
+    printf("%d\n", unchecked(7));
+    printf("calls %d\n", calls);
+    return 0;
+}
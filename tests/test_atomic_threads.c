@@ -0,0 +1,29 @@
+#include <stdio.h>
+#include <pthread.h>
+
+long hits = 0;
+int lock = 0;
+long guarded = 0;
+
+void *worker(void *arg) {
+    int i;
+    for (i = 0; i < 100000; i++) {
+        __atomic_fetch_add(&hits, 1, __ATOMIC_SEQ_CST);
+        while (__sync_lock_test_and_set(&lock, 1)) {
+        }
+        guarded = guarded + 1;
+        __atomic_store_n(&lock, 0, __ATOMIC_RELEASE);
+    }
+    return arg;
+}
+
+int main() {
+    pthread_t a;
+    pthread_t b;
+    pthread_create(&a, 0, worker, 0);
+    pthread_create(&b, 0, worker, 0);
+    pthread_join(a, 0);
+    pthread_join(b, 0);
+    printf("hits=%ld guarded=%ld\n", hits, guarded);
+    return 0;
+}
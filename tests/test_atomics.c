@@ -0,0 +1,52 @@
+#include <stdio.h>
+
+int counter = 0;
+long total = 0;
+char flag = 0;
+int lock = 0;
+
+void spin_lock(int *l) {
+    while (__sync_lock_test_and_set(l, 1)) {
+    }
+}
+
+void spin_unlock(int *l) {
+    __atomic_store_n(l, 0, __ATOMIC_RELEASE);
+}
+
+int bump(int *p, int n) {
+    int i;
+    int last = 0;
+    for (i = 0; i < n; i++) {
+        last = __atomic_fetch_add(p, 2, __ATOMIC_SEQ_CST);
+    }
+    return last;
+}
+
+int main() {
+    int old = bump(&counter, 5);
+    printf("counter=%d old=%d\n", counter, old);
+
+    __atomic_fetch_add(&total, 100000000000L, __ATOMIC_RELAXED);
+    __atomic_fetch_add(&total, -1, __ATOMIC_RELAXED);
+    printf("total=%ld\n", __atomic_load_n(&total, __ATOMIC_ACQUIRE));
+
+    char was = __sync_lock_test_and_set(&flag, 7);
+    printf("flag=%d was=%d\n", flag, was);
+    char prev = __atomic_fetch_add(&flag, 250, __ATOMIC_SEQ_CST);
+    printf("flag=%d prev=%d\n", flag, prev);
+
+    spin_lock(&lock);
+    printf("locked=%d\n", __atomic_load_n(&lock, __ATOMIC_SEQ_CST));
+    spin_unlock(&lock);
+    printf("unlocked=%d\n", lock);
+
+    int x = 1;
+    int *slot = 0;
+    int *had = __sync_lock_test_and_set(&slot, &x);
+    printf("had=%d now=%d\n", had == 0, *slot);
+    __atomic_store_n(&x, 41, __ATOMIC_SEQ_CST);
+    __sync_synchronize();
+    printf("x=%d\n", __atomic_load_n(slot, __ATOMIC_RELAXED) + 1);
+    return 0;
+}
@@ -0,0 +1,135 @@
+// __attribute__((...)) in the places declarations have them: packed and
+// aligned layouts, noreturn calls, constructors and destructors, and the
+// attributes that are only read past
+#include <stdio.h>
+#include <stdlib.h>
+
+struct __attribute__((packed)) Header {
+    char tag;
+    int length;
+    short flags;
+};
+
+struct Wire {
+    char kind;
+    long value;
+} __attribute__((packed));
+
+typedef struct __attribute__((__packed__)) {
+    char a;
+    double b;
+} PackedPair;
+
+struct Aligned {
+    char c;
+    int n __attribute__((aligned(16)));
+};
+
+struct Line {
+    int x;
+} __attribute__((aligned(32)));
+
+struct Mixed {
+    char c;
+    int n __attribute__((packed));
+    char d;
+};
+
+long counter __attribute__((aligned(32)));
+__attribute__((aligned(64))) static long slot = 5;
+struct Line line;
+static int order;
+
+__attribute__((noreturn)) static void fail(const char *why);
+_Noreturn void bail(int code);
+
+static void fail(const char *why) {
+    printf("fail: %s\n", why);
+    exit(3);
+}
+
+void bail(int code) {
+    exit(code);
+}
+
+// Nothing follows the call to fail, and no return is missing
+int twice(int n) {
+    if (n > 0) {
+        return n * 2;
+    }
+    fail("not positive");
+}
+
+__attribute__((constructor)) static void setup(void) {
+    order = order * 10 + 1;
+    printf("setup, order %d\n", order);
+}
+
+__attribute__((constructor(101))) static void early(void) {
+    order = order * 10 + 2;
+    printf("early, order %d\n", order);
+}
+
+static void teardown(void) __attribute__((destructor));
+
+static void teardown(void) {
+    printf("teardown, order %d\n", order);
+}
+
+__attribute__((destructor(200))) static void late(void) {
+    printf("late\n");
+}
+
+__attribute__((unused)) static int helper(int x) {
+    return x + 1;
+}
+
+int sum(int a, int b __attribute__((unused)), int c) {
+    return a + c;
+}
+
+long distance(void *from, void *to) {
+    return (char *)to - (char *)from;
+}
+
+long misalignment(void *p, long align) {
+    long address = (long)p;
+    return address % align;
+}
+
+int main(void) {
+    struct Header h;
+    struct Wire w;
+    PackedPair pp;
+    struct Aligned al;
+    struct Mixed mx;
+    int local __attribute__((aligned(16))) = 7;
+    char buf[3] __attribute__((aligned(16)));
+    __attribute__((unused)) int spare = 0;
+
+    printf("sizes: header %d, wire %d, pair %d\n", (int)sizeof(struct Header), (int)sizeof(struct Wire), (int)sizeof(PackedPair));
+    printf("sizes: aligned %d, line %d, mixed %d\n", (int)sizeof(struct Aligned), (int)sizeof(struct Line), (int)sizeof(struct Mixed));
+    printf("header offsets %ld %ld\n", distance(&h, &h.length), distance(&h, &h.flags));
+    printf("aligned offset %ld, mixed offsets %ld %ld\n", distance(&al, &al.n), distance(&mx, &mx.n), distance(&mx, &mx.d));
+
+    h.tag = 'x';
+    h.length = 123456;
+    h.flags = 7;
+    w.kind = 2;
+    w.value = 987654321;
+    pp.a = 1;
+    pp.b = 2.5;
+    printf("%c %d %d, %d %ld, %g\n", h.tag, h.length, h.flags, w.kind, w.value, pp.b);
+
+    printf("misaligned by: counter %ld, slot %ld, line %ld, local %ld, buf %ld\n",
+           misalignment(&counter, 32), misalignment(&slot, 64), misalignment(&line, 32),
+           misalignment(&local, 16), misalignment(buf, 16));
+    printf("local %d, slot %ld, sum %d\n", local, slot, sum(4, 0, 6));
+
+    printf("twice %d\n", twice(21));
+    printf("order %d\n", order);
+    if (local == 7) {
+        return 0;
+    }
+    bail(5);
+}
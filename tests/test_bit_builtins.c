@@ -0,0 +1,47 @@
+#include <stdio.h>
+
+// Bit builtins: popcount, clz, ctz and the byte swaps, on constants and on
+// values only known at run time
+
+unsigned int mix(unsigned int x) {
+    return x * 40503u;
+}
+
+int bits_set(unsigned long words[], int n) {
+    int total = 0;
+    int i;
+    for (i = 0; i < n; i++) {
+        total += __builtin_popcountl(words[i]);
+    }
+    return total;
+}
+
+int log2_floor(unsigned int x) {
+    return 31 - __builtin_clz(x);
+}
+
+int main() {
+    unsigned long words[4];
+    words[0] = 0xffUL;
+    words[1] = 0x8000000000000001UL;
+    words[2] = 0;
+    words[3] = 0xf0f0f0f0f0f0f0f0UL;
+    printf("popcount %d %d %d\n", __builtin_popcount(0), __builtin_popcount(0xffffffffu), __builtin_popcount(mix(7)));
+    printf("popcountl %d\n", bits_set(words, 4));
+    printf("popcountll %d\n", __builtin_popcountll(-1LL));
+    printf("clz %d %d %d\n", __builtin_clz(1), __builtin_clz(0x80000000u), __builtin_clz(mix(3)));
+    printf("clzl %d %d\n", __builtin_clzl(1UL), __builtin_clzll(0x100000000ULL));
+    printf("ctz %d %d %d\n", __builtin_ctz(1), __builtin_ctz(0x80000000u), __builtin_ctz(mix(8)));
+    printf("ctzl %d %d\n", __builtin_ctzl(0x8000000000000000UL), __builtin_ctzll(0x10000ULL));
+    int i;
+    for (i = 1; i < 70000; i = i * 7) {
+        printf("log2(%d) = %d\n", i, log2_floor(i));
+    }
+    unsigned short port = 0x1f90;
+    printf("bswap16 %x\n", __builtin_bswap16(port));
+    printf("bswap32 %x %x\n", __builtin_bswap32(0x12345678u), __builtin_bswap32(mix(5)));
+    unsigned long v = __builtin_bswap64(0x0102030405060708UL);
+    printf("bswap64 %lx\n", v);
+    printf("round trip %d\n", __builtin_bswap64(__builtin_bswap64(v)) == v);
+    return 0;
+}
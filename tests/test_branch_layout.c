@@ -0,0 +1,54 @@
+// Branches predicted by __builtin_expect and the error-path heuristics, and
+// rotated loops (both laid out differently from -O1 up)
+#include <stdio.h>
+#include <stdlib.h>
+int check(int x) {
+    if (x < 0) {
+        return -1;
+    }
+    return x * 2;
+}
+int pick(int x) {
+    if (__builtin_expect(x == 7, 0)) {
+        printf("rare %d\n", x);
+    } else {
+        x = x + 1;
+    }
+    return x;
+}
+int likely_then(int x) {
+    if (__builtin_expect(x > 0, 1)) {
+        x = x + 10;
+    } else {
+        printf("nonpositive\n");
+    }
+    return x;
+}
+int main() {
+    int total = 0;
+    int i = 0;
+    while (i < 10) {
+        int r = check(i - 2);
+        total = total + r;
+        i = i + 1;
+    }
+    printf("%d\n", total);
+    for (int j = 0; j < 9; j++) {
+        int p = pick(j);
+        total = total + p;
+    }
+    printf("%d\n", total);
+    int q = likely_then(5);
+    printf("%d\n", q);
+    q = likely_then(0);
+    printf("%d\n", q);
+    if (total < 0) {
+        exit(3);
+    }
+    int k = 0;
+    while (k > 5) {
+        k = k + 1;
+    }
+    printf("%d\n", k);
+    return 0;
+}
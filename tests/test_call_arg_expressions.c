@@ -0,0 +1,26 @@
+#include <stdio.h>
+
+int add3(int a, int b, int c) { return a * 100 + b * 10 + c; }
+int six(int a, int b, int c, int d, int e, int f) { return a + 2 * b + 3 * c + 4 * d + 5 * e + 6 * f; }
+int id(int x) { return x; }
+int twice(int x) { return 2 * x; }
+double mix(double a, int b, double c, int d) { return a * 1000 + b * 100 + c * 10 + d; }
+long pick(long a, long b) { return a - b; }
+
+int main() {
+    int x = 3;
+    int y = 0;
+    int t = 1;
+    printf("%d\n", add3(1, x > 2 ? 5 : 6, t && y));
+    printf("%d\n", add3(x, y || t, x < 0 ? id(7) : twice(4)));
+    printf("%d\n", add3(id(1), id(2), id(3)));
+    printf("%d\n", add3(twice(id(1)), x ? twice(2) : id(9), !y && x > 1));
+    printf("%d\n", six(id(1), 2, twice(1) + 1, x ? 4 : 0, id(5), t || id(0)));
+    printf("%d\n", six(6, 5, 4, 3, 2, 1));
+    printf("%.1f\n", mix(x > 1 ? 1.5 : 2.5, id(2), twice(1) ? 3.0 : 0.0, y || x));
+    printf("%ld\n", pick(id(10), pick(id(3), twice(4))));
+    printf("%d %d %d\n", id(x), x > 2 && twice(x) == 6, id(t) ? id(x) : id(y));
+    printf("%d\n", add3(add3(1, 2, 3) % 10, add3(id(4), 5, 6) % 10, twice(add3(0, 0, 4))));
+    printf("%d %d %d\n", add3(id(0) || 0.5, x && "s", y && id(1)), (y || id(0)) + 2, x && (t || id(0)));
+    return 0;
+}
@@ -0,0 +1,36 @@
+#include <stdio.h>
+
+typedef unsigned char byte;
+
+int truncate(double d) {
+    return (int)d;
+}
+
+int main() {
+    int x = 300;
+    printf("1 %d\n", (char)x);
+    printf("2 %d\n", (unsigned char)x);
+    printf("3 %d\n", (byte)(x + 1));
+    double d = -7.9;
+    printf("4 %d\n", (int)d);
+    printf("5 %d\n", truncate(3.99));
+    printf("6 %f\n", (double)x / 8);
+    int big = 70000;
+    printf("7 %d\n", (short)big);
+    printf("8 %d\n", (unsigned short)-1);
+    long l = -1;
+    printf("9 %u\n", (unsigned int)l);
+    printf("10 %ld\n", (long)(unsigned int)l);
+    char c = -1;
+    printf("13 %d\n", (unsigned char)c);
+    printf("14 %ld\n", (long)c);
+    printf("16 %d\n", (char)513 + 1);
+    float f = (float)0.1;
+    printf("17 %.10f\n", f);
+    printf("18 %d\n", (int)(float)2.5);
+    printf("19 %.1f\n", (float)x);
+    long p = (long)&big;
+    int back = *(int *)p;
+    printf("20 %d %d\n", back, *(int *)p + 1);
+    return 0;
+}
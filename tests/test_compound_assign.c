@@ -0,0 +1,53 @@
+#include <stdio.h>
+#include <stdlib.h>
+struct S { int a; long b; int arr[4]; };
+int g;
+int main() {
+    int a[3];
+    a[0] = 1;
+    a[1] = 2;
+    a[2] = 3;
+    int j = 1;
+    a[j++] += 10;
+    printf("%d\n", a[1]);
+    printf("%d\n", j);
+    int *p = calloc(16, 4);
+    *p = 7;
+    int k = 1;
+    p[k++] += 5;
+    printf("%d\n", k);
+    printf("%d\n", p[1]);
+    *p *= 6;
+    printf("%d\n", *p);
+    struct S s;
+    s.a = 3;
+    s.b = 100;
+    s.a <<= 2;
+    s.b -= 1;
+    printf("%d\n", s.a);
+    printf("%ld\n", s.b);
+    struct S *sp = malloc(sizeof(struct S));
+    sp->a = 12;
+    sp->a |= 1;
+    printf("%d\n", sp->a);
+    int x = 10;
+    int m = 4;
+    x %= m;
+    printf("%d\n", x);
+    g += 3;
+    g ^= 1;
+    printf("%d\n", g);
+    double d = 1.5;
+    d += 2.25;
+    printf("%f\n", d);
+    int i;
+    int sum = 0;
+    for (i = 0; i < 10; i += 3) {
+        sum += i;
+    }
+    printf("%d\n", sum);
+    int y = (x += 5);
+    printf("%d\n", y);
+    printf("%d\n", a[2]);
+    return 0;
+}
@@ -0,0 +1,57 @@
+// Compound literals as values: calls, returns, assignments, arrays
+#include <stdio.h>
+
+typedef struct { int x; int y; } Vec;
+typedef struct { int x; int y; int w; int h; } Box;
+typedef struct { long a; long b; long c; } Big;
+
+Vec make_vec(int x, int y) {
+    return (Vec){x, y};
+}
+
+Box grow(Box b, int by) {
+    return (Box){b.x - by, b.y - by, b.w + 2 * by, b.h + 2 * by};
+}
+
+Big make_big(long n) {
+    return (Big){n, n * 2, n * 3};
+}
+
+int area(Box b) {
+    return b.w * b.h;
+}
+
+int sum(int *xs, int n) {
+    int total = 0;
+    int i;
+    for (i = 0; i < n; i++) {
+        total += xs[i];
+    }
+    return total;
+}
+
+int main() {
+    Vec v = make_vec(3, 4);
+    printf("%d %d\n", v.x, v.y);
+
+    Box b = grow((Box){10, 20, 30, 40}, 5);
+    printf("%d %d\n", b.x, b.y);
+    printf("%d %d\n", b.w, b.h);
+    printf("%d\n", area((Box){0, 0, 6, 7}));
+
+    b = (Box){.w = 2, .h = 3};
+    printf("%d %d\n", b.x, b.y);
+    printf("%d %d\n", b.w, b.h);
+
+    Big g = make_big(5);
+    printf("%ld\n", g.a + g.b * 10 + g.c * 100);
+
+    int *xs = (int[]){1, 2, 3, 4};
+    printf("%d\n", sum(xs, 4));
+    printf("%d\n", sum((int[]){10, 20, 30}, 3));
+    printf("%d\n", xs[2]);
+
+    printf("%d\n", (Vec){7, 8}.y);
+    printf("%d\n", make_vec(1, 9).y);
+    return area(b);
+}
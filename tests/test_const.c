@@ -0,0 +1,41 @@
+// const-qualified objects, pointers to const, and const pointers
+#include <stdio.h>
+
+typedef struct {
+    int x;
+    int y;
+} Point;
+
+int sum_point(const Point *p) {
+    return p->x + p->y;
+}
+
+int length(const char *s) {
+    int n = 0;
+    while (s[n]) {
+        n++;
+    }
+    return n;
+}
+
+int first_char(const char *const s) {
+    return s[0];
+}
+
+int main() {
+    const int answer = 42;
+    printf("answer = %d\n", answer);
+
+    const char *msg = "hello";
+    printf("length = %d\n", length(msg));
+    msg = "hi";
+    printf("length = %d\n", length(msg));
+
+    printf("first = %d\n", first_char(msg));
+
+    Point pt;
+    pt.x = 3;
+    pt.y = 4;
+    printf("sum = %d\n", sum_point(&pt));
+    return 0;
+}
@@ -0,0 +1,36 @@
+#include <stdio.h>
+#define MAX 4
+#define FLAG_A 1
+#define FLAG_B 2
+#if MAX * 2 > 6 && defined(FLAG_A) && !defined FLAG_C
+#define BIG 1
+#elif MAX > 100
+#define BIG 2
+#else
+#define BIG 0
+#endif
+#if __STDC_VERSION__ >= 199901L
+#define C99 1
+#endif
+enum Bits { B0 = 1 << 0, B1 = 1 << 1, B2 = B0 | B1, B3 = sizeof(int) * 2, B4 = 'a' - 'A' };
+struct S { int v[MAX + 1]; };
+int classify(int x) {
+    int r = 0;
+    switch (x) {
+        case FLAG_A | FLAG_B: r = 3; break;
+        case -1: r = 9; break;
+        default: r = 1; break;
+    }
+    return r;
+}
+int main() {
+    int buf[MAX * 2];
+    printf("%d\n", BIG);
+    printf("%d\n", C99);
+    printf("%d\n", B2);
+    printf("%d\n", B3 + B4);
+    printf("%d\n", (int)sizeof(buf));
+    printf("%d\n", (int)sizeof(struct S));
+    printf("%d\n", classify(3));
+    return 0;
+}
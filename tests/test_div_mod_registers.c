@@ -0,0 +1,37 @@
+// Division leaves its remainder in %rdx and a variable shift needs its
+// count in %cl: values living in those registers must survive them
+#include <stdio.h>
+
+long mixed(long a, long b, long c, long d, long e, long f) {
+    return (a / b) + (c % d) + e * f;
+}
+
+long shifts(long x, long n, long m) {
+    return (x << n) + (x >> m) + (n << m) + x / n;
+}
+
+long chain(long a, long b) {
+    long q = a / b;
+    long r = a % b;
+    long s = (a * 3) / (b + 1) + (a * 5) % (b + 2);
+    return q * 10000 + r * 100 + s;
+}
+
+int main() {
+    printf("%ld\n", mixed(100, 7, 50, 6, 3, 4));
+    printf("%ld\n", mixed(-100, 7, -50, 6, 2, 9));
+    printf("%ld\n", shifts(1000, 3, 2));
+    printf("%ld\n", chain(123, 10));
+    long i = 0;
+    long n = 5;
+    long table[8];
+    long local[8];
+    while (i < 8) {
+        table[i] = (i * 17) % n + (i << n) / (n - 2);
+        local[i] = table[i] * 2 + i / 3;
+        i = i + 1;
+    }
+    printf("%ld\n", table[7] + local[6]);
+    printf("%ld\n", table[3] * 100 + local[2]);
+    return 0;
+}
@@ -0,0 +1,30 @@
+#include <stdio.h>
+
+typedef enum { NORTH, EAST, SOUTH, WEST } Heading;
+
+enum Suit { CLUBS = 1, DIAMONDS, HEARTS = 10, SPADES };
+
+int turns(Heading h) {
+    int n = -1;
+    switch (h) {
+        case NORTH: n = 0; break;
+        case EAST: n = 1; break;
+        case SOUTH: n = 2; break;
+        case WEST: n = 3; break;
+    }
+    return n;
+}
+
+int points(enum Suit s) {
+    switch (s) {
+        case HEARTS: return 5;
+        default: return 1;
+    }
+}
+
+int main() {
+    printf("%d\n", turns(NORTH));
+    printf("%d\n", points(HEARTS));
+    printf("%d\n", points(SPADES));
+    return 0;
+}
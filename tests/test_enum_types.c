@@ -0,0 +1,47 @@
+// Enum tags and enum typedefs used as types
+#include <stdio.h>
+
+enum Suit { HEARTS, SPADES = 5, CLUBS };
+
+typedef enum { NORTH, EAST, SOUTH, WEST } Direction;
+
+enum Suit current;
+
+enum Suit next_suit(enum Suit c) {
+    if (c == HEARTS) {
+        return SPADES;
+    }
+    return HEARTS;
+}
+
+Direction turn_right(Direction d) {
+    if (d == WEST) {
+        return NORTH;
+    }
+    return (Direction)(d + 1);
+}
+
+int main() {
+    enum Suit c = HEARTS;
+    printf("c = %d\n", c);
+    c = next_suit(c);
+    printf("next = %d\n", c);
+    current = CLUBS;
+    printf("global = %d\n", current);
+
+    enum Shape { CIRCLE = 10, SQUARE };
+    enum Shape s = SQUARE;
+    printf("shape = %d\n", s);
+
+    Direction d = WEST;
+    d = turn_right(d);
+    printf("turned = %d\n", d);
+
+    int raw = 6;
+    enum Suit fromInt = (enum Suit)raw;
+    printf("cast = %d\n", fromInt);
+
+    printf("sizeof(enum Suit) = %d\n", (int)sizeof(enum Suit));
+    printf("sizeof(Direction) = %d\n", (int)sizeof(Direction));
+    return 0;
+}
@@ -0,0 +1,17 @@
+#include <stdio.h>
+#include <stdlib.h>
+
+// The program's environment, stdin and exit status reach it unchanged
+int main(int argc, char **argv) {
+    printf("argc %d\n", argc);
+    if (argv[argc] == 0) printf("argv ends with NULL\n");
+    if (getenv("CCOMPILER_TEST_SURELY_UNSET") == 0) printf("unset variable is NULL\n");
+
+    // The test runner gives programs an empty stdin
+    char line[16];
+    if (fgets(line, 16, stdin) == 0) printf("stdin at EOF\n");
+
+    fflush(stdout);
+    exit(42);
+    return 0;
+}
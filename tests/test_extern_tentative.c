@@ -0,0 +1,24 @@
+#include <stdio.h>
+extern int counter;
+int counter;
+int counter = 5;
+extern int counter;
+int total;
+int total;
+static int hidden = 7;
+extern int hidden;
+int bump() {
+    extern int later;
+    later += 1;
+    return later;
+}
+int later = 40;
+int main() {
+    counter += 1;
+    total = 3;
+    printf("%d\n", counter);
+    printf("%d\n", total);
+    printf("%d\n", hidden);
+    printf("%d\n", bump());
+    return 0;
+}
@@ -0,0 +1,47 @@
+#include <stdio.h>
+double scale = 1e-3;
+float half = .5f;
+double hundred = 1e2;
+double quarter = 2.5e-1;
+double three = 0x1.8p1;
+long double wide = 4.5L;
+double below = -2.5e-1;
+
+int main(void) {
+    printf("%.4f %.2f %.2f %.2f %.2f %.2f %.2f\n", scale, half, hundred, quarter, three, (double)wide, below);
+    double a = 1e-3;
+    double b = 2.5e2;
+    double c = .5;
+    double d = 3.;
+    double e = 0x1p-4;
+    double g = 1E+3;
+    float f = 0.1f;
+    float h = 2.5F;
+    double big = 6.02214076e23;
+    double tiny = 1.5e-10;
+    printf("%.6f %.1f %.2f %.1f %.6f %.1f\n", a, b, c, d, e, g);
+    printf("%.10f %.2f\n", f, h);
+    printf("%g %g\n", big, tiny);
+    printf("%d %d %d\n", (int)sizeof(1.5f), (int)sizeof(1.5), (int)sizeof(1.5L));
+    double fd = 0.1f;
+    printf("%.17g\n", fd);
+    printf("%.17g\n", 0.1);
+    float prod = 1.5f * 2.0f;
+    printf("%.2f\n", prod);
+    double mixed = 0.1f + 0.1;
+    printf("%.17g\n", mixed);
+    printf("%.3f\n", 1e1 / 4);
+    int n = 5e0;
+    printf("%d\n", n);
+    double fromLong = 2.25L;
+    long double ld = 1.5L * 2;
+    printf("%.2f %.2f\n", fromLong, (double)ld);
+    printf("%.2f\n", (double)(0.5L + 1));
+    double million = 2e6;
+    double tenBillion = 1e10;
+    double small = 1e-7;
+    double spelled = 10000000000.0;
+    printf("%g %g %g %g\n", million, tenBillion, small, spelled);
+    printf("%.1f %g\n", 2e6 + 1, 1e10 / 4);
+    return 0;
+}
@@ -0,0 +1,40 @@
+#include <stdio.h>
+
+typedef struct { long a; long b; long c; } Triple;
+typedef struct { long x; long y; } Pair;
+
+/* Leaf: its slots live in the red zone */
+long mix(long a, long b) {
+    long t = a * 3;
+    Pair p = { a, b };
+    long u = p.x + p.y;
+    return t + u;
+}
+
+/* Returns through a buffer the caller reserves */
+Triple make(long base) {
+    Triple t;
+    t.a = base;
+    t.b = base + 1;
+    t.c = base + 2;
+    return t;
+}
+
+long pick(long n) {
+    long small = 10;
+    long big = 20;
+    return n > 5 ? big : small;
+}
+
+int main() {
+    Triple t = make(7);
+    long before = 1000;
+    long m = mix(2, 5);
+    printf("%ld\n", m);
+    printf("%ld\n", t.a + t.b + t.c);
+    long hi = pick(9);
+    long lo = pick(1);
+    printf("%ld\n", hi + lo);
+    printf("%ld\n", before);
+    return 0;
+}
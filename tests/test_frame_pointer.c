@@ -0,0 +1,53 @@
+#include <stdio.h>
+
+/* Leaf functions: with -fomit-frame-pointer they address their slots from
+   %rsp, in the red zone or in a frame they reserve */
+
+long square_sum(long x) {
+    long a[4];
+    a[0] = x;
+    a[1] = x * x;
+    a[2] = a[0] + a[1];
+    return a[2];
+}
+
+long weighted(long n) {
+    long w[40];
+    long i = 0;
+    long s = 0;
+    for (i = 0; i < 40; i++) {
+        w[i] = i * n;
+    }
+    for (i = 0; i < 40; i++) {
+        s += w[i] * (i % 3);
+    }
+    return s;
+}
+
+long six(long a, long b, long c, long d, long e, long f) {
+    return a + b * c - d + e * f;
+}
+
+long busy(long x) {
+    long p = x + 1;
+    long q = x * 2;
+    long r = x - 3;
+    long s = p * q;
+    long t = q * r;
+    long u = r * p;
+    long v = s + t;
+    long w = t + u;
+    return p + q + r + s + t + u + v * w;
+}
+
+/* Not a leaf: keeps its frame pointer */
+long outer(long x) {
+    return square_sum(x) + weighted(x) + busy(x);
+}
+
+int main() {
+    printf("%ld %ld\n", square_sum(5), weighted(3));
+    printf("%ld\n", six(1, 2, 3, 4, 5, 6));
+    printf("%ld %ld\n", busy(4), outer(2));
+    return 0;
+}
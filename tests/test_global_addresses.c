@@ -0,0 +1,62 @@
+#include <stdio.h>
+
+// Globals whose initializers hold addresses and strings
+
+int twice(int x) { return 2 * x; }
+int thrice(int x) { return 3 * x; }
+
+typedef int (*unary)(int);
+
+int x = 5;
+long vals[4] = {10, 20, 30, 40};
+char *names[] = {"zero", "one", "two"};
+struct E {
+    const char *name;
+    int v;
+} tbl[2] = {{"a", 1}, {"b", 2}};
+struct Op {
+    const char *name;
+    unary fn;
+};
+struct Op ops[] = {{"twice", twice}, {.fn = &thrice, .name = "thrice"}};
+long *third = &vals[2];
+long *second = vals + 1;
+const char *tail = "hello" + 2;
+int *px = &x;
+struct Op *last = &ops[1];
+void *table[] = {&x, vals, "s", 0};
+char msg[] = "hi";
+char buf[8] = "abc";
+struct Named {
+    char name[8];
+    int v;
+} named = {"xyz", 3};
+int grid[2][3] = {{1, 2, 3}, {4, 5, 6}};
+struct Point {
+    int x;
+    int y;
+} origin = {7, 8};
+int *cell = &grid[1][1];
+int *row = grid[1];
+int *row_addr = (int *)&grid[1];
+int *past_row = grid[0] + 2;
+int *origin_y = &origin.y;
+int *tbl_v = &tbl[1].v;
+
+int main(void) {
+    static const char *local[] = {"a", "b"};
+    int i;
+    printf("%s %s %s\n", names[0], names[1], names[2]);
+    printf("%s %d %s %d\n", tbl[0].name, tbl[0].v, tbl[1].name, tbl[1].v);
+    for (i = 0; i < 2; i++) {
+        printf("%s %d %d\n", ops[i].name, ops[i].fn != 0, ops[i].fn != ops[1 - i].fn);
+    }
+    printf("%ld %ld %s %d %s\n", *third, *second, tail, *px, last->name);
+    printf("%s %d %d\n", (char *)table[2], table[3] == 0, *(int *)table[0]);
+    printf("%s%s\n", local[0], local[1]);
+    printf("%c%c %d %c%c%c %s %d %d\n", msg[0], msg[1], msg[2], buf[0], buf[2], buf[3] + '0', named.name, named.v, (int)sizeof(msg));
+    printf("%d %d %d %d %d %d\n", *cell, *row, *row_addr, *past_row, *origin_y, *tbl_v);
+    names[1] = "uno";
+    printf("%s\n", names[1]);
+    return 0;
+}
@@ -0,0 +1,105 @@
+// Global arrays and structs get storage of their real size: in .bss when
+// uninitialized, in .data with a brace initializer's values laid out
+#include <stdio.h>
+
+struct Cell {
+    char kind;
+    int owner;
+    double weight;
+};
+
+typedef struct {
+    int x;
+    int y;
+} Pos;
+
+int board[64];
+long totals[3][4];
+struct Cell cells[10];
+Pos origin;
+Pos path[5];
+static short history[9];
+int after = 7;
+
+int counts[4] = {1, 2, 3, 4};
+long sparse[8] = {[2] = 20, [6] = -6};
+struct Cell hero = {'h', 3, 2.5};
+Pos corners[3] = {{1, 2}, {3, 4}, {.y = 9}};
+double grid[2][3] = {{1, 2, 3}, {4, 5, 6}};
+long primes[] = {2, 3, 5, 7, 11};
+
+struct Sprite {
+    short frame;
+    long id;
+} player = {5, 1234567};
+
+int sum_board(void) {
+    int total = 0;
+    int i;
+    for (i = 0; i < 64; i++) {
+        total += board[i];
+    }
+    return total;
+}
+
+int main() {
+    int i;
+    int j;
+    for (i = 0; i < 64; i++) {
+        board[i] = i * 3;
+    }
+    for (i = 0; i < 10; i++) {
+        cells[i].kind = 'a' + i;
+        cells[i].owner = i;
+        cells[i].weight = i * 0.5;
+    }
+    for (i = 0; i < 5; i++) {
+        path[i].x = i;
+        path[i].y = -i;
+    }
+    for (i = 0; i < 9; i++) {
+        history[i] = i * 100;
+    }
+    origin.x = 11;
+    origin.y = 12;
+
+    printf("board: %d %d %d sum %d\n", board[0], board[63], after, sum_board());
+    printf("cells: %c %d %.1f\n", cells[9].kind, cells[9].owner, cells[9].weight);
+    printf("cells: %c %d %.1f\n", cells[0].kind, cells[0].owner, cells[0].weight);
+    printf("path: %d %d origin %d %d\n", path[4].x, path[4].y, origin.x, origin.y);
+    printf("history: %d %d\n", history[0], history[8]);
+
+    printf("sizes: %d %d %d %d\n", (int)sizeof(board), (int)sizeof(totals), (int)sizeof(cells), (int)sizeof(path));
+    printf("sizes: %d %d %d\n", (int)sizeof(history), (int)sizeof(grid), (int)sizeof(primes));
+
+    printf("counts: %d %d %d %d\n", counts[0], counts[1], counts[2], counts[3]);
+    printf("sparse: %ld %ld %ld\n", sparse[2], sparse[6], sparse[7]);
+    printf("hero: %c %d %.1f\n", hero.kind, hero.owner, hero.weight);
+    printf("corners: %d %d %d %d\n", corners[0].x, corners[1].y, corners[2].x, corners[2].y);
+
+    printf("grid: %.1f %.1f %.1f\n", grid[0][0], grid[1][0], grid[1][2]);
+    for (i = 0; i < 3; i++) {
+        for (j = 0; j < 4; j++) {
+            totals[i][j] = i * 10 + j;
+        }
+    }
+    totals[2][3] += 100;
+    grid[0][1] = totals[1][2] * 0.5;
+    printf("totals: %ld %ld %ld %ld\n", totals[0][3], totals[1][2], totals[2][0], totals[2][3]);
+    printf("grid: %.1f %.1f\n", grid[0][1], grid[0][2]);
+
+    long *p = primes;
+    long product = 1;
+    for (i = 0; i < 5; i++) {
+        product *= p[i];
+    }
+    printf("primes: %ld\n", product);
+
+    player.frame++;
+    printf("player: %d %ld\n", player.frame, player.id);
+
+    counts[3] += 10;
+    hero.owner = 42;
+    printf("after: %d %d\n", counts[3], hero.owner);
+    return 0;
+}
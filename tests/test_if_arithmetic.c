@@ -0,0 +1,50 @@
+#include <stdio.h>
+
+// Defaults that -D overrides, e.g. -DMAX_ENTITIES=256
+#ifndef MAX_ENTITIES
+#define MAX_ENTITIES 64
+#endif
+#ifndef LEVEL
+#define LEVEL 1
+#endif
+
+#define SIZE (4 * 64)
+#define HALF (SIZE / 2)
+#define FLAGS 0x30
+#define SQ(x) ((x) * (x))
+#define MAX(a, b) ((a) > (b) ? (a) : (b))
+#define TWICE(x) ((x) * 2)
+int counter = 41;
+#define counter (counter + 1)
+#define FAST
+
+#if MAX_ENTITIES > 128
+#define POOL "large"
+#else
+#define POOL "small"
+#endif
+
+int main() {
+    printf("entities %d pool %s\n", MAX_ENTITIES, POOL);
+#if SIZE == 256 && HALF == 128
+    printf("size %d half %d\n", SIZE, HALF);
+#endif
+#if defined(FAST) && (LEVEL >= 2 || !defined(SLOW))
+    printf("fast at level %d\n", LEVEL);
+#endif
+#if defined FLAGS && (FLAGS & 0x10) && !(FLAGS & 0x01)
+    printf("flags %#x\n", FLAGS);
+#endif
+#if SQ(LEVEL + 2) == 9
+    printf("square %d\n", SQ(LEVEL + 2));
+#elif SQ(LEVEL) > 100
+    printf("big square\n");
+#else
+    printf("other square %d\n", SQ(LEVEL));
+#endif
+    // Macros in macros, in arguments and in expansions
+    printf("max %d twice %d\n", MAX(MAX(1, SIZE), HALF), TWICE(TWICE(LEVEL)));
+    // A macro's own name in its expansion isn't expanded again
+    printf("counter %d\n", counter);
+    return 0;
+}
@@ -0,0 +1,33 @@
+// Headers contribute once however they're reached: #pragma once, include
+// guards, different paths to one file and headers that include each other;
+// a header without a guard is included each time
+#include <stdio.h>
+#include "include/shapes.h"
+#include "include/../include/shapes.h"
+#include "./include/units.h"
+#include "include/ping.h"
+#include "include/pong.h"
+
+enum {
+#define COLOR(name, bit) name = bit,
+#include "include/colors.def"
+#undef COLOR
+};
+
+int color_sum(void) {
+    int sum = 0;
+#define COLOR(name, bit) sum += name;
+#include "include/colors.def"
+#undef COLOR
+    return sum;
+}
+
+int main() {
+    struct Rect r;
+    r.w = 3;
+    r.h = 4;
+    printf("area %d unit %d included %d\n", area(r), UNIT, units_included);
+    printf("ping %d pong %d\n", ping(1), pong(2));
+    printf("colors %d %d %d sum %d\n", red, green, blue, color_sum());
+    return 0;
+}
@@ -0,0 +1,38 @@
+// Small functions called from main; at -O2 their bodies are inlined
+#include <stdio.h>
+
+typedef struct { long x; long y; } P;
+
+long getx(P *p) { return p->x; }
+long sq(long v) { return v * v; }
+long clampi(long v, long lo, long hi) { return v < lo ? lo : (v > hi ? hi : v); }
+long sum_to(long n) {
+    long total = 0;
+    long i;
+    for (i = 1; i <= n; i++) {
+        total += i;
+    }
+    return total;
+}
+void bump(long *counter) { *counter = *counter + 1; }
+
+int main() {
+    P p;
+    p.x = 7;
+    p.y = 9;
+    long a = getx(&p);
+    long b = sq(a);
+    long c = sq(3);
+    printf("%ld\n", b + c);
+    long d = clampi(b + c, 0, 50);
+    printf("%ld\n", d);
+    long e = clampi(-4, 0, 50);
+    printf("%ld\n", e);
+    long f = sum_to(10);
+    printf("%ld\n", f);
+    long n = 0;
+    bump(&n);
+    bump(&n);
+    printf("%ld\n", n);
+    return 0;
+}
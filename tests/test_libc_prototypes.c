@@ -0,0 +1,19 @@
+// Calls through the builtin libc prototypes: doubles through printf's
+// varargs, integer constants converted for double parameters, and double
+// results returned in xmm0
+#include <stdio.h>
+#include <string.h>
+#include <math.h>
+
+int main() {
+    double d = 2.25;
+    printf("%f\n", d);
+    printf("%f\n", 0.5);
+    printf("%f\n", sqrt(16));
+    printf("%f\n", sqrt(d));
+    printf("%f\n", pow(2, 10));
+    double f = floor(d);
+    printf("%f\n", f);
+    printf("%d\n", strlen("hello"));
+    return 0;
+}
@@ -0,0 +1,39 @@
+#include <stdio.h>
+
+#define GREETING \
+    "hello from a continued define"
+
+#define MAX(a, b) \
+    ((a) > (b) ? \
+     (a) : (b))
+
+#define SWAP(x, y) { \
+        int t = x;   \
+        x = y;       \
+        y = t;       \
+    }
+
+#define LIMIT 10 + \
+    20 + \
+    30
+
+#if LIMIT > 50 && \
+    defined(MAX)
+#define CHECKED 1
+#else
+#define CHECKED 0
+#endif
+
+int main() {
+    int a = 3;
+    int b = 9;
+    printf("%s\n", GREETING);
+    printf("max %d\n", MAX(a, b));
+    SWAP(a, b);
+    printf("swapped %d %d\n", a, b);
+    printf("limit %d checked %d\n", LIMIT, CHECKED);
+    int total = a + \
+        b;
+    printf("total %d at line %d\n", total, __LINE__);
+    return 0;
+}
@@ -0,0 +1,36 @@
+// Values computed before a call and used after it must survive the call:
+// neither the callee nor the moves that set up its arguments may change them
+#include <stdio.h>
+
+long add3(long a, long b, long c) {
+    return a + b + c;
+}
+
+long id(long x) {
+    return x;
+}
+
+long twice(long x) {
+    return x * 2;
+}
+
+long keep(long a, long b) {
+    long sum = a + b;
+    long diff = a - b;
+    long t = twice(sum);
+    long u = twice(diff);
+    return sum * 1000 + diff * 100 + t + u;
+}
+
+int main() {
+    long a = 5;
+    long b = 6;
+    long r = a * b + add3(a, b, 1) * (a - b) + id(a + b);
+    printf("%ld\n", r);
+    r = (a + 1) * (b + 2) - add3(a * 2, b * 3, a * b);
+    printf("%ld\n", r);
+    r = (a * b) * 100 + id(b - a) * (a + b);
+    printf("%ld\n", r);
+    printf("%ld\n", keep(7, 3));
+    return 0;
+}
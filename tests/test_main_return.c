@@ -0,0 +1,22 @@
+#include <stdio.h>
+
+// main returns 0 when control falls off its end, whatever the last call
+// left in the result register. argv written as an array is char**.
+
+int count_args(int argc, char *argv[]) {
+    int n = 0;
+    for (int i = 0; i < argc; i++) {
+        if (argv[i] != NULL) {
+            n++;
+        }
+    }
+    return n;
+}
+
+int main(int argc, char *argv[], char *envp[]) {
+    printf("argc: %d\n", argc);
+    printf("counted: %d\n", count_args(argc, argv));
+    printf("argv[argc] is NULL: %d\n", argv[argc] == NULL);
+    printf("envp is set: %d\n", envp != NULL);
+    printf("printf returns a count, which main doesn't\n");
+}
@@ -0,0 +1,41 @@
+// Block copies and fills: small structs unrolled, large ones with rep
+// movsb/stosq, and constant-size memcpy/memset calls (inlined at -O2)
+#include <stdio.h>
+#include <string.h>
+
+typedef struct { long a; long b; } Pair;
+typedef struct { long a; long b; long c; long d; long e; long f; long g; long h; long i; long tag; } Block;
+
+long block_sum(Block *b) {
+    long total = b->a + b->b + b->c;
+    total += b->d + b->e + b->f;
+    total += b->g + b->h + b->i;
+    return total + b->tag;
+}
+
+int main() {
+    Pair p = (Pair){3, 4};
+    Pair q;
+    q = p;
+    printf("%ld\n", q.a + q.b);
+
+    Block x = (Block){.tag = 7};
+    printf("%ld\n", block_sum(&x));
+    x.c = 5;
+    x.i = 100;
+    Block y;
+    y = x;
+    printf("%ld\n", block_sum(&y));
+
+    Block z;
+    memset(&z, 0, sizeof(Block));
+    printf("%ld\n", block_sum(&z));
+    memcpy(&z, &y, sizeof(Block));
+    printf("%ld\n", block_sum(&z));
+
+    long words[2];
+    memset(&words[0], 1, 16);
+    printf("%ld\n", words[0]);
+    printf("%ld\n", words[1]);
+    return 0;
+}
@@ -0,0 +1,54 @@
+// Functions declared ms_abi are called with the Windows x64 convention:
+// arguments by position in rcx, rdx, r8, r9 / xmm0-xmm3, then the stack
+#include <stdio.h>
+
+__attribute__((ms_abi)) long weigh(long a, double b, long c, double d) {
+    return a * 1000 + (long)(b * 100) + c * 10 + (long)d;
+}
+
+int __attribute__((ms_abi)) sum6(int a, int b, int c, int d, int e, int f) {
+    return a + 2 * b + 3 * c + 4 * d + 5 * e + 6 * f;
+}
+
+double scale(double x, long k) __attribute__((ms_abi));
+
+__attribute__((ms_abi)) double scale(double x, long k) {
+    return x * k;
+}
+
+// A callback that calls back into System V code
+__attribute__((__ms_abi__)) int report(const char *name, int value) {
+    printf("%s = %d\n", name, value);
+    return value + 1;
+}
+
+__attribute__((ms_abi)) long fact(long n) {
+    if (n <= 1) {
+        return 1;
+    }
+    return n * fact(n - 1);
+}
+
+__attribute__((sysv_abi)) int plain(int x) {
+    return x * 3;
+}
+
+__attribute__((ms_abi)) int eight(int a, int b, int c, int d, int e, int f, int g, int h) {
+    return a - b + c - d + e - f + g - h + plain(h);
+}
+
+int main(void) {
+    printf("weigh: %ld\n", weigh(7, 0.25, 3, 9.0));
+    printf("sum6: %d\n", sum6(1, 2, 3, 4, 5, 6));
+    printf("scale: %.2f\n", scale(1.5, 4));
+    int r = report("answer", 41);
+    printf("report returned %d\n", r);
+    printf("fact: %ld\n", fact(10));
+    printf("eight: %d\n", eight(10, 1, 20, 2, 30, 3, 40, 4));
+    long total = 0;
+    for (int i = 0; i < 5; i++) {
+        total += sum6(i, i, i, i, i, i) + weigh(i, 0.5, i, 1.0);
+    }
+    printf("total: %ld\n", total);
+    return 0;
+}
@@ -0,0 +1,27 @@
+#include <stdio.h>
+
+int g(int x) { return x + 1; }
+int h(int x) { return x * 2; }
+int f2(int a, int b) { return a * 10 + b; }
+int f6(int a, int b, int c, int d, int e, int f) { return ((((a * 10 + b) * 10 + c) * 10 + d) * 10 + e) * 10 + f; }
+long lf(long a, long b, long c) { return a * 10000 + b * 100 + c; }
+double df(double a, int b, double c) { return a * 100 + b * 10 + c; }
+double half(double x) { return x / 2; }
+
+int main() {
+    printf("%d\n", f2(g(1), h(2)));
+    printf("%d\n", f6(g(0), h(1), g(2), h(2), g(4), h(3)));
+    printf("%d\n", f6(g(g(0)), f2(g(0), h(1)) % 10, g(h(1)), 4, h(g(1)) + 1, f2(0, g(5))));
+    printf("%ld\n", lf(g(10), lf(1, g(1), h(1)) % 100, f2(h(3), g(3))));
+    printf("%.2f\n", df(half(g(2)), h(g(1)), half(half(h(2)))));
+    int a = g(1);
+    int b = h(a);
+    int c = g(b);
+    int d = h(c);
+    int e = g(d);
+    int k = h(e);
+    int m = g(k);
+    printf("%d\n", f6(a, b, c, d, e, g(k)) + f2(m, h(m)) + f6(g(a), g(b), g(c), g(d), g(e), g(k)));
+    printf("%d\n", f2(f2(f2(g(1), h(1)), f2(h(1), g(1))), f2(f2(1, 2), f2(3, 4))));
+    return 0;
+}
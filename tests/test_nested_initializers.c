@@ -0,0 +1,63 @@
+#include <stdio.h>
+
+typedef struct { int x; int y; } Vector2;
+typedef struct { int id; Vector2 inner; int tail; } Wrapper;
+struct Line { Vector2 from; Vector2 to; };
+typedef struct { double weight; int counts[3]; char tag; } Stats;
+typedef struct { Vector2 pts[2]; int n; } Path;
+
+int sum_points(Vector2 *pts, int n) {
+    int total = 0;
+    for (int i = 0; i < n; i++) {
+        total = total + pts[i].x * 10 + pts[i].y;
+    }
+    return total;
+}
+
+int main() {
+    int a[3] = {1, 2, 3};
+    printf("a: %d %d %d\n", a[0], a[1], a[2]);
+
+    int b[5] = {[3] = 30, 40, [1] = 10};
+    printf("b: %d %d %d %d %d\n", b[0], b[1], b[2], b[3], b[4]);
+
+    int c[] = {7, 8, 9, 10};
+    printf("c: %d %d %d\n", c[0], c[3], (int)(sizeof(c) / sizeof(c[0])));
+
+    Wrapper w = { .id = 4, .inner = { .x = 1 } };
+    printf("w: %d %d %d %d\n", w.id, w.inner.x, w.inner.y, w.tail);
+
+    Wrapper w2 = { 5, { 6, 7 }, 8 };
+    printf("w2: %d %d %d %d\n", w2.id, w2.inner.x, w2.inner.y, w2.tail);
+
+    Wrapper w3 = { .inner = { .y = 2 }, 9 };
+    printf("w3: %d %d %d %d\n", w3.id, w3.inner.x, w3.inner.y, w3.tail);
+
+    Vector2 pts[2] = {{0, 0}, {1, 1}};
+    printf("pts: %d %d %d %d\n", pts[0].x, pts[0].y, pts[1].x, pts[1].y);
+
+    Vector2 more[4] = {{5, 6}, [2] = {.y = 3}, {7, 8}};
+    printf("more: %d\n", sum_points(more, 4));
+
+    struct Line line = { .to = { 3, 4 }, .from = { .x = 1, .y = 2 } };
+    printf("line: %d %d %d %d\n", line.from.x, line.from.y, line.to.x, line.to.y);
+
+    Stats s = { .counts = { 1, 2 }, .weight = 3, .tag = 'z' };
+    printf("s: %.2f %d %d %d %c\n", s.weight, s.counts[0], s.counts[1], s.counts[2], s.tag);
+
+    Stats t = { 1, { [2] = 5 }, 'q' };
+    printf("t: %.2f %d %d %d %c\n", t.weight, t.counts[0], t.counts[1], t.counts[2], t.tag);
+
+    Path path = { { {1, 2}, {3, 4} }, 2 };
+    printf("path: %d %d\n", sum_points(path.pts, path.n), path.n);
+
+    Vector2 *lit = (Vector2[]){ {9, 8}, {7, 6} };
+    printf("lit: %d %d\n", lit[1].x, lit[0].y);
+
+    Wrapper cl = (Wrapper){ .tail = 11, .inner = { 12, 13 } };
+    printf("cl: %d %d %d %d\n", cl.id, cl.inner.x, cl.inner.y, cl.tail);
+
+    double d[3] = {1, 2.5, 3};
+    printf("d: %.2f %.2f %.2f\n", d[0], d[1], d[2]);
+    return 0;
+}
@@ -0,0 +1,44 @@
+// Nested lvalue chains: a.b.c, p->a[i], p->a[i].x, arr[i].x (read, write, +=)
+#include <stdio.h>
+#include <stdlib.h>
+
+struct Vec { int x; int y; };
+struct Inner { int a; struct Vec pos; };
+struct Outer { int id; struct Inner in; int vals[4]; struct Vec pts[3]; };
+
+int main() {
+    struct Outer o;
+    o.id = 1;
+    o.in.a = 7;
+    o.in.pos.x = 10;
+    o.in.pos.y = 20;
+    printf("%d\n", o.in.a);
+    printf("%d\n", o.in.pos.x);
+    printf("%d\n", o.in.pos.y);
+    struct Outer *p = malloc(sizeof(struct Outer));
+    int i;
+    for (i = 0; i < 4; i++) {
+        p->vals[i] = i * 3;
+    }
+    for (i = 0; i < 3; i++) {
+        p->pts[i].x = i + 100;
+        p->pts[i].y = i + 200;
+    }
+    p->in.pos.x = 5;
+    p->in.pos.x += 4;
+    p->vals[2] += 10;
+    printf("%d\n", p->vals[3]);
+    printf("%d\n", p->vals[2]);
+    printf("%d\n", p->pts[1].x);
+    printf("%d\n", p->pts[2].y);
+    printf("%d\n", p->in.pos.x);
+    struct Vec arr[3];
+    for (i = 0; i < 3; i++) {
+        arr[i].x = i * 2;
+        arr[i].y = i * 5;
+    }
+    printf("%d\n", arr[2].x);
+    printf("%d\n", arr[2].y);
+    printf("%d\n", arr[1].y);
+    return o.in.pos.y;
+}
@@ -0,0 +1,153 @@
+#include <stdio.h>
+
+struct Point {
+    int x;
+    int y;
+};
+
+struct Counter {
+    char name;
+    long total;
+    int hits[4];
+    struct Point last;
+};
+
+typedef struct Node {
+    int value;
+    struct Node *next;
+} Node;
+
+void move(struct Point *p, int dx, int dy) {
+    p->x += dx;
+    p->y = p->y + dy;
+}
+
+void reset(struct Point *p) {
+    p->x = 0;
+    p->y = 0;
+}
+
+void record(struct Counter *c, int slot, int x, int y) {
+    c->total += slot + 1;
+    c->hits[slot]++;
+    c->last.x = x;
+    c->last.y = y;
+    move(&c->last, 1, 1);
+}
+
+/* Many values live across the writes, so the pointer and the fields
+   compete for registers */
+void accumulate(struct Counter *c, int n) {
+    int i;
+    long a = 1;
+    long b = 2;
+    long d = 3;
+    long e = 4;
+    long f = 5;
+    for (i = 0; i < n; i++) {
+        a = a + i;
+        b = b * 2 % 1000;
+        d = d + a;
+        e = e ^ b;
+        f = f + d % 7;
+        c->total = c->total + i;
+        c->hits[i % 4] = c->hits[i % 4] + 1;
+    }
+    c->last.x = (int)(a + b + d + e + f);
+}
+
+/* The parameter itself is reassigned: the writes land in each node */
+void bump_all(Node *n, int by) {
+    while (n) {
+        n->value += by;
+        n = n->next;
+    }
+}
+
+void set_both(struct Point *p, struct Point *q, int v) {
+    p->x = v;
+    q->x = v + 1;
+    p->y = q->x + 1;
+}
+
+int read_after_write(struct Point *p) {
+    p->x = 11;
+    return p->x + p->y;
+}
+
+/* Pointers past the argument registers arrive on the stack */
+void seventh(int a, int b, int c, int d, int e, int f, struct Point *p) {
+    p->x = a + f;
+    p->y += b;
+}
+
+void eighth(int a, int b, int c, int d, int e, int f, struct Point *p, struct Counter *k) {
+    p->x = c * d;
+    k->total = k->total + e;
+    k->last.y = f;
+    move(&k->last, a, b);
+}
+
+void forward(struct Counter *c) {
+    record(c, 3, 9, 9);
+}
+
+int main() {
+    struct Point p;
+    struct Point q;
+    struct Counter c;
+    Node n1;
+    Node n2;
+    Node n3;
+    int i;
+    int r;
+
+    p.x = 1;
+    p.y = 2;
+    move(&p, 3, 4);
+    printf("move: %d %d\n", p.x, p.y);
+    reset(&p);
+    printf("reset: %d %d\n", p.x, p.y);
+
+    c.name = 'c';
+    c.total = 0;
+    for (i = 0; i < 4; i++) {
+        c.hits[i] = 0;
+    }
+    c.last.x = 0;
+    c.last.y = 0;
+    record(&c, 0, 5, 6);
+    record(&c, 2, 7, 8);
+    printf("record: %ld %d %d %d %d\n", c.total, c.hits[0], c.hits[1], c.hits[2], c.hits[3]);
+    printf("  last %d %d\n", c.last.x, c.last.y);
+    forward(&c);
+    printf("forward: %ld %d last %d %d\n", c.total, c.hits[3], c.last.x, c.last.y);
+    accumulate(&c, 10);
+    printf("accumulate: %ld %d %d %d %d\n", c.total, c.hits[0], c.hits[1], c.hits[2], c.hits[3]);
+    printf("  last %d\n", c.last.x);
+
+    n1.value = 1;
+    n1.next = &n2;
+    n2.value = 2;
+    n2.next = &n3;
+    n3.value = 3;
+    n3.next = 0;
+    bump_all(&n1, 10);
+    printf("bump_all: %d %d %d\n", n1.value, n2.value, n3.value);
+
+    set_both(&p, &q, 5);
+    printf("set_both: %d %d %d\n", p.x, p.y, q.x);
+    set_both(&p, &p, 5);
+    printf("aliased: %d %d\n", p.x, p.y);
+
+    q.y = 10;
+    seventh(1, 2, 3, 4, 5, 6, &q);
+    printf("seventh: %d %d\n", q.x, q.y);
+    eighth(1, 2, 3, 4, 5, 6, &q, &c);
+    printf("eighth: %d %ld %d %d\n", q.x, c.total, c.last.x, c.last.y);
+
+    p.y = 4;
+    r = read_after_write(&p);
+    printf("read_after_write: %d %d\n", r, p.x);
+    return 0;
+}
@@ -0,0 +1,33 @@
+// Predefined macros: __LINE__, __FILE__, __func__, and the standard and
+// platform macros
+#define HERE __LINE__
+
+int file_ends_in_c() {
+    const char *f = __FILE__;
+    const char *last = f;
+    while (*f) {
+        last = f;
+        f = f + 1;
+    }
+    return *last == 'c';
+}
+
+int main() {
+    printf("line %d\n", __LINE__);
+    printf("here %d\n", HERE);
+    printf("func %s\n", __func__);
+    printf("file ends in c: %d\n", file_ends_in_c());
+#if defined(__STDC__) && __STDC__
+    printf("stdc\n");
+#endif
+#ifdef __x86_64__
+    printf("x86_64\n");
+#endif
+#ifdef __linux__
+    printf("linux\n");
+#endif
+#ifdef __LINE__
+    printf("__LINE__ is defined\n");
+#endif
+    return 0;
+}
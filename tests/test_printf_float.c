@@ -0,0 +1,33 @@
+// Floating arguments to printf: doubles and floats go in XMM registers
+// (floats promoted to double), and our own float and double functions pass
+// and return them the same way
+#include <stdio.h>
+
+typedef struct { float x; float y; } Vec2;
+typedef struct { float w; int n; double d; } Mix;
+
+float scale(float v, float k) { return v * k; }
+double avg(double a, double b) { return (a + b) / 2.0; }
+Vec2 make(float x, float y) { Vec2 v; v.x = x; v.y = y; return v; }
+void grow(Vec2 *p, float by) { p->x = p->x + by; p->y += by; }
+
+int main() {
+    printf("%f\n", 3.14);
+    Vec2 v = {1.5, 2.25};
+    printf("%f %f\n", v.x, v.y);
+    grow(&v, 0.5);
+    printf("%f %f\n", v.x, v.y);
+    Vec2 m = make(3.5, 4.75);
+    printf("%.2f %.2f\n", m.x, m.y);
+    Mix mx = {0.25, 7, 9.5};
+    printf("%f %d %f\n", mx.w, mx.n, mx.d);
+    float arr[3];
+    arr[1] = 8.125;
+    printf("%f\n", arr[1]);
+    printf("%f %f\n", scale(1.5, 3), avg(1.0, 4.0));
+    float s = scale(2.0, 0.25);
+    double d = avg(s, 1.5);
+    printf("%g %g %e\n", s, d, 12345.678);
+    printf("%d %f %d %f %s\n", 1, 0.5, 2, 1.75, "end");
+    return 0;
+}
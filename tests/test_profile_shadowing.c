@@ -0,0 +1,23 @@
+// The default raylib profile defines RED, GREEN, BLUE and the other colors
+// as Color globals; a program's own declarations of those names win
+#include <stdio.h>
+
+enum Channel { RED, GREEN = 5, BLUE };
+
+typedef int WHITE;
+
+int BLACK = 7;
+
+int GRAY(void) {
+	return 8;
+}
+
+int main() {
+	int order[3] = {BLUE, GREEN, RED};
+	printf("%d %d %d\n", order[0], order[1], order[2]);
+	enum Channel c = BLUE;
+	printf("%d\n", c == BLUE);
+	WHITE w = 3;
+	printf("%d %d %d\n", w, BLACK, GRAY());
+	return 0;
+}
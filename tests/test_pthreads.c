@@ -0,0 +1,54 @@
+// Threads smoke test: compiled callbacks invoked by pthread_create
+// Expected output:
+//   sum of squares: 30
+//   counter: 4000
+#include <stdio.h>
+#include <stdlib.h>
+#include <pthread.h>
+
+long counter = 0;
+pthread_mutex_t *lock;
+
+void *square(void *arg) {
+	long n = (long)arg;
+	return (void *)(n * n);
+}
+
+void *count(void *arg) {
+	int i;
+	for (i = 0; i < 1000; i++) {
+		pthread_mutex_lock(lock);
+		counter = counter + 1;
+		pthread_mutex_unlock(lock);
+	}
+	return 0;
+}
+
+int main() {
+	pthread_t threads[4];
+	long ret;
+	long total = 0;
+	long i;
+	
+	for (i = 0; i < 4; i++) {
+		pthread_create(&threads[i], 0, square, (void *)(i + 1));
+	}
+	for (i = 0; i < 4; i++) {
+		pthread_join(threads[i], (void **)&ret);
+		total = total + ret;
+	}
+	printf("sum of squares: %ld\n", total);
+	
+	lock = malloc(64);
+	pthread_mutex_init(lock, 0);
+	for (i = 0; i < 4; i++) {
+		pthread_create(&threads[i], 0, count, 0);
+	}
+	for (i = 0; i < 4; i++) {
+		pthread_join(threads[i], 0);
+	}
+	pthread_mutex_destroy(lock);
+	free(lock);
+	printf("counter: %ld\n", counter);
+	return 0;
+}
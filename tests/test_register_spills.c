@@ -0,0 +1,35 @@
+#include <stdio.h>
+
+/* Each operand stays live until the innermost parentheses are done, so
+   more temps are live at once than there are registers */
+long deep(long base) {
+    long v0 = base + 0;
+    long v1 = base + 1;
+    long v2 = base + 2;
+    long v3 = base + 3;
+    long v4 = base + 4;
+    long v5 = base + 5;
+    long v6 = base + 6;
+    long v7 = base + 7;
+    long v8 = base + 8;
+    long v9 = base + 9;
+    long v10 = base + 10;
+    long v11 = base + 11;
+    long v12 = base + 12;
+    long v13 = base + 13;
+    long v14 = base + 14;
+    long v15 = base + 15;
+    long v16 = base + 16;
+    long v17 = base + 17;
+    long keep = base * 2;
+    long r = v0 + (v1 - (v2 + (v3 - (v4 + (v5 - (v6 + (v7 - (v8 + (v9 - (v10 + (v11 - (v12 + (v13 - (v14 + (v15 - (v16 + (v17)))))))))))))))));
+    return r + keep;
+}
+
+int main() {
+    long first = deep(1);
+    long second = deep(100);
+    printf("%ld\n", first);
+    printf("%ld\n", second);
+    return 0;
+}
@@ -0,0 +1,44 @@
+#include <stdio.h>
+#include <setjmp.h>
+
+void raise_error(jmp_buf env, int code) {
+    longjmp(env, code);
+}
+
+int parse_digit(jmp_buf env, int c) {
+    if (c < 48 || c > 57) {
+        raise_error(env, c);
+    }
+    return c - 48;
+}
+
+int checked_sum(int a, int b, int c) {
+    jmp_buf env;
+    int base = a * 1000 + b;
+    int code = setjmp(env);
+    if (code != 0) {
+        return -(base + code);
+    }
+    int total = parse_digit(env, a) + parse_digit(env, b) + parse_digit(env, c);
+    return base * 0 + total;
+}
+
+int retries(void) {
+    jmp_buf env;
+    volatile int attempts = 0;
+    long scale = 3;
+    int seen = setjmp(env);
+    attempts++;
+    if (attempts < 4) {
+        longjmp(env, seen + attempts);
+    }
+    return seen * 100 + attempts * scale;
+}
+
+int main() {
+    printf("sum=%d\n", checked_sum(49, 50, 51));
+    printf("sum=%d\n", checked_sum(49, 120, 51));
+    printf("sum=%d\n", checked_sum(7, 50, 51));
+    printf("retries=%d\n", retries());
+    return 0;
+}
@@ -0,0 +1,43 @@
+// Adjacent string literals are one string, and character constants
+// decode the escapes string literals do
+#include <stdio.h>
+#include <string.h>
+
+#define NAME "ahoy"
+#define GREETING "hello, " NAME "!"
+
+int main(void) {
+    const char *joined = "foo" "bar";
+    printf("%s %d\n", joined, (int)strlen(joined));
+    printf("%s\n", GREETING);
+    const char *banner = "multi"
+                         "line"
+                         " banner";
+    printf("%s\n", banner);
+    printf("%d\n", (int)sizeof("ab" "cd"));
+
+    /* Escapes survive into the data as the bytes they stand for */
+    const char *esc = "\x1b[1mbold\x1b[0m";
+    printf("%d %d %d\n", (int)strlen(esc), esc[0], esc[4]);
+    const char *quoted = "say \"hi\"\t\\ done";
+    printf("%s %d\n", quoted, (int)strlen(quoted));
+    const char *octal = "\101\102\103\0hidden";
+    printf("%s %d\n", octal, (int)strlen(octal));
+    const char *split = "\x41" "B";
+    printf("%s\n", split);
+    const char *gnu = "\e[0m";
+    printf("%d %d\n", gnu[0], (int)strlen(gnu));
+    const char *accent = "café";
+    printf("%d %d %d\n", (int)strlen(accent), accent[3] & 255, accent[4] & 255);
+    const char *bell = "\a\b\f\v\r?\?";
+    printf("%d %d %d %d\n", bell[0], bell[1], bell[2], bell[3]);
+    printf("%d %d\n", bell[4], (int)strlen(bell));
+
+    /* Character constants decode the same escapes */
+    printf("%d %d %d %d %d\n", '\x1b', '\033', '\e', '\'', '\\');
+    printf("%d %d %d\n", '\xff', '\0', '\x7f');
+    printf("%d\n", 'ab');
+    char c = '\t';
+    printf("%d\n", c);
+    return 0;
+}
@@ -0,0 +1,34 @@
+// String literal escapes reach the program as the bytes they stand for
+#include <stdio.h>
+
+long length(char *s) {
+    long n = 0;
+    while (s[n] != 0) {
+        n = n + 1;
+    }
+    return n;
+}
+
+long sum(char *s) {
+    long total = 0;
+    long i = 0;
+    while (s[i] != 0) {
+        total = total + s[i];
+        i = i + 1;
+    }
+    return total;
+}
+
+int main() {
+    puts("backslash-n written out: \\n");
+    puts("quotes: \"quoted\" and 'single'");
+    puts("hex \x41\x42\x43, octal \101\102\103");
+    puts("tab\there");
+    printf("%ld\n", length("a\\b\"c"));
+    printf("%ld\n", sum("\a\b\f\v\033"));
+    printf("%ld\n", length("same"));
+    printf("%ld\n", length("same"));
+    printf("%ld\n", sum("\\\\"));
+    puts("caf\303\251");
+    return 0;
+}
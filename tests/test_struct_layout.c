@@ -0,0 +1,109 @@
+#include <stdio.h>
+#include <string.h>
+
+/* Where the one set byte is: a member's offset, after clearing the
+   struct and setting the member */
+int set_at(unsigned char *raw, int size) {
+    int i;
+    for (i = 0; i < size; i++) {
+        if (raw[i] != 0) {
+            return i;
+        }
+    }
+    return -1;
+}
+
+struct Mixed {
+    char tag;
+    int count;
+    char flag;
+    double weight;
+    short id;
+};
+
+typedef union {
+    int i;
+    double d;
+    char bytes[12];
+} Value;
+
+union Word {
+    unsigned int whole;
+    unsigned char part;
+};
+
+struct Holder {
+    char kind;
+    struct {
+        char c;
+        int n;
+    } inner;
+    long after;
+};
+
+typedef struct Pair {
+    char a;
+    long b;
+} Pair;
+
+struct Nested {
+    char head;
+    Pair pair;
+    Value value;
+    char tail;
+};
+
+int main() {
+    struct Mixed m;
+    Value v;
+    union Word w;
+    struct Holder h;
+    struct Nested n;
+
+    printf("Mixed: %d %d\n", (int)sizeof(struct Mixed), (int)_Alignof(struct Mixed));
+    memset(&m, 0, sizeof(m));
+    m.count = 1;
+    printf("  count at %d\n", set_at((unsigned char *)&m, sizeof(m)));
+    memset(&m, 0, sizeof(m));
+    m.weight = 2.0; /* only its top byte is set */
+    printf("  weight at %d\n", set_at((unsigned char *)&m, sizeof(m)) - 7);
+    memset(&m, 0, sizeof(m));
+    m.id = 3;
+    printf("  id at %d\n", set_at((unsigned char *)&m, sizeof(m)));
+
+    printf("Value: %d %d\n", (int)sizeof(Value), (int)_Alignof(Value));
+    v.d = 0.0;
+    v.i = 7;
+    printf("  i %d\n", v.i);
+
+    printf("Word: %d\n", (int)sizeof(union Word));
+    w.whole = 0x11223344;
+    printf("  part %x\n", w.part);
+
+    printf("Holder: %d\n", (int)sizeof(struct Holder));
+    memset(&h, 0, sizeof(h));
+    h.inner.c = 1;
+    printf("  inner at %d\n", set_at((unsigned char *)&h, sizeof(h)));
+    memset(&h, 0, sizeof(h));
+    h.inner.n = 1;
+    printf("  inner.n at %d\n", set_at((unsigned char *)&h, sizeof(h)));
+    memset(&h, 0, sizeof(h));
+    h.after = 1;
+    printf("  after at %d\n", set_at((unsigned char *)&h, sizeof(h)));
+
+    printf("Pair: %d\n", (int)sizeof(Pair));
+    printf("Nested: %d\n", (int)sizeof(struct Nested));
+    memset(&n, 0, sizeof(n));
+    n.pair.a = 1;
+    printf("  pair at %d\n", set_at((unsigned char *)&n, sizeof(n)));
+    memset(&n, 0, sizeof(n));
+    n.value.i = 1;
+    printf("  value at %d\n", set_at((unsigned char *)&n, sizeof(n)));
+    memset(&n, 0, sizeof(n));
+    n.tail = 1;
+    printf("  tail at %d\n", set_at((unsigned char *)&n, sizeof(n)));
+    n.pair.b = 40;
+    n.tail = 2;
+    printf("  sum %ld\n", n.pair.b + n.tail);
+    return 0;
+}
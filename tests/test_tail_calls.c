@@ -0,0 +1,29 @@
+// Self-recursive and mutually recursive calls in tail position. With
+// -foptimize-sibling-calls (the default at -O2) these run in constant stack.
+#include <stdio.h>
+long count_down(long n, long acc) {
+    if (n == 0) {
+        return acc;
+    }
+    return count_down(n - 1, acc + 1);
+}
+long is_even(long n);
+long is_odd(long n) {
+    if (n == 0) {
+        return 0;
+    }
+    return is_even(n - 1);
+}
+long is_even(long n) {
+    if (n == 0) {
+        return 1;
+    }
+    return is_odd(n - 1);
+}
+int main() {
+    long r = count_down(100000, 0);
+    printf("%ld\n", r);
+    long e = is_even(10001);
+    printf("%ld\n", e);
+    return 0;
+}
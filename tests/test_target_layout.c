@@ -0,0 +1,31 @@
+// Implementation-defined layout from the default target spec (x86-64 SysV)
+#include <stdio.h>
+
+struct Mixed { char c; short s; int i; long l; };
+struct Tail { long l; char c; };
+struct Names { char tag; char name[3]; short id; };
+
+int main() {
+    printf("%d\n", (int)sizeof(struct Mixed));
+    printf("%d\n", (int)sizeof(struct Tail));
+    printf("%d\n", (int)sizeof(struct Names));
+    printf("%d\n", (int)sizeof(long));
+    printf("%d\n", (int)sizeof(short));
+
+    struct Mixed m;
+    m.c = -3;
+    m.s = 300;
+    m.i = 70000;
+    m.l = 5;
+    printf("%d\n", m.c);
+    printf("%d\n", m.s);
+    printf("%d\n", m.i);
+
+    m.c = 200;
+    if (m.c < 0) {
+        printf("char is signed\n");
+    } else {
+        printf("char is unsigned\n");
+    }
+    return m.c + 60;
+}
@@ -0,0 +1,81 @@
+// Conditional expression lowering: nesting, call arguments, struct pointers
+// and assignment through a selected pointer
+#include <stdio.h>
+
+typedef struct {
+	int x;
+	int y;
+} Point;
+
+typedef struct {
+	long a;
+	long b;
+	long c;
+} Triple;
+
+Triple make_triple(long v) {
+	Triple t = {v, v + 1, v + 2};
+	return t;
+}
+
+int max2(int a, int b) {
+	return a > b ? a : b;
+}
+
+int classify(int n) {
+	return n < 0 ? -1 : n == 0 ? 0 : n < 10 ? 1 : 2;
+}
+
+int main() {
+	int a = 3;
+	int b = 7;
+	int c = 0;
+	
+	// Nested in both arms
+	c = a ? b ? 11 : 12 : 13;
+	printf("nested: %d\n", c);
+	c = a > 5 ? 1 : b > 5 ? 2 : 3;
+	printf("chain: %d\n", c);
+	c = classify(-4);
+	printf("classify: %d", c);
+	c = classify(0);
+	printf(" %d", c);
+	c = classify(5);
+	printf(" %d", c);
+	c = classify(50);
+	printf(" %d\n", c);
+	
+	// As call arguments
+	printf("arg: %d\n", a < b ? a : b);
+	printf("max2: %d\n", max2(a < b ? a : b, 5));
+	
+	// Selecting between struct pointers
+	Point p1;
+	Point p2;
+	p1.x = 1;
+	p1.y = 10;
+	p2.x = 2;
+	p2.y = 20;
+	Point *pp = a > b ? &p1 : &p2;
+	printf("ptr: %d %d\n", pp->x, pp->y);
+	pp = a < b ? &p1 : &p2;
+	pp->y = 15;
+	printf("member through: %d %d\n", p1.y, p2.y);
+	
+	// Assignment through the selected pointer
+	int *ip = a < b ? &a : &b;
+	*ip = 42;
+	printf("through: %d %d\n", a, b);
+	*(a > b ? &a : &b) = 99;
+	printf("through expr: %d %d\n", a, b);
+	
+	// Selecting between struct values
+	printf("struct member: %d %d\n", (a > b ? p1 : p2).y, (a < b ? p1 : p2).x);
+	Point picked = a < b ? p2 : p1;
+	printf("struct copy: %d %d\n", picked.x, picked.y);
+	Triple t1 = {1, 2, 3};
+	printf("wide member: %ld\n", (a > b ? t1 : make_triple(10)).c);
+	Triple t2 = a > b ? make_triple(4) : t1;
+	printf("wide copy: %ld %ld %ld\n", t2.a, t2.b, t2.c);
+	return 0;
+}
@@ -0,0 +1,46 @@
+#include <stdio.h>
+#include <pthread.h>
+
+__thread int tls_counter;
+__thread long tls_total = 100;
+_Thread_local int *tls_last;
+static __thread int tls_hidden = 7;
+int shared = 0;
+
+int bump(int n) {
+    static __thread int calls;
+    calls++;
+    tls_counter = tls_counter + n;
+    tls_total += n;
+    tls_last = &tls_counter;
+    return calls;
+}
+
+void *worker(void *arg) {
+    long id = (long)arg;
+    int i;
+    int calls = 0;
+    for (i = 0; i < 1000; i++) {
+        calls = bump(id);
+    }
+    tls_hidden++;
+    __atomic_fetch_add(&shared, tls_counter, __ATOMIC_SEQ_CST);
+    printf("worker %ld: counter=%d total=%ld calls=%d\n", id, tls_counter, tls_total, calls);
+    printf("worker %ld: hidden=%d mine=%d\n", id, tls_hidden, *tls_last == tls_counter);
+    return 0;
+}
+
+int main() {
+    pthread_t a;
+    pthread_t b;
+    pthread_create(&a, 0, worker, (void *)1);
+    pthread_join(a, 0);
+    pthread_create(&b, 0, worker, (void *)2);
+    pthread_join(b, 0);
+    int calls = bump(5);
+    int *p = &tls_counter;
+    *p += 1;
+    printf("main: counter=%d total=%ld calls=%d\n", tls_counter, tls_total, calls);
+    printf("main: hidden=%d shared=%d\n", tls_hidden, shared);
+    return 0;
+}
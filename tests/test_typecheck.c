@@ -0,0 +1,44 @@
+// Well-typed code the type checker must accept
+#include <stdio.h>
+#include <stdlib.h>
+
+typedef struct {
+    int w;
+    int h;
+} Size;
+
+int area(Size s) {
+    return s.w * s.h;
+}
+
+Size grow(Size s, int by) {
+    Size r;
+    r.w = s.w + by;
+    r.h = s.h + by;
+    return r;
+}
+
+long span(int *first, int *last) {
+    return last - first;
+}
+
+int main() {
+    Size s;
+    s.w = 2;
+    s.h = 3;
+    Size t = grow(s, 1);
+    printf("area = %d\n", area(t));
+
+    int *p = NULL;
+    if (p == 0) {
+        printf("null\n");
+    }
+
+    int values[4];
+    int *end = values + 3;
+    printf("span = %ld\n", span(values, end));
+
+    char *name = "sizes";
+    printf("%s\n", name);
+    return 0;
+}
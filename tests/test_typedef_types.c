@@ -0,0 +1,80 @@
+#include <stdio.h>
+
+typedef void (*Callback)(int);
+typedef unsigned char *(*LoadData)(const char *fileName, int *dataSize);
+typedef int Matrix[4][4];
+typedef float Vec3[3];
+typedef Vec3 Triangle[3];
+typedef Callback Handler;
+typedef long Row[4];
+typedef int (*BinOp)(int, int);
+typedef double (*Scale)(double);
+
+typedef struct {
+    Callback onEvent;
+    Vec3 position;
+    int id;
+} Listener;
+
+// An array parameter is a pointer to its elements
+int row_bytes(Row r) {
+    return (int)sizeof(r);
+}
+
+int has_handler(Handler h) {
+    return h != 0;
+}
+
+Matrix identity;
+
+static int add(int a, int b) { return a + b; }
+static int mul(int a, int b) { return a * b; }
+static double half(double x) { return x / 2; }
+static void report(int n) { printf("event %d\n", n); }
+
+BinOp global_op = mul;
+
+// Calls go through the pointer, with the typedef's signature
+int fold(BinOp f, int seed, int n) {
+    for (int i = 1; i <= n; i++) {
+        seed = f(seed, i);
+    }
+    return seed;
+}
+
+int main() {
+    printf("%d %d %d %d\n", (int)sizeof(Matrix), (int)sizeof(Vec3), (int)sizeof(Triangle), (int)sizeof(Callback));
+    printf("%d %d %d\n", (int)sizeof(Listener), (int)sizeof(Handler), (int)sizeof(LoadData));
+    Row r;
+    for (int i = 0; i < 4; i++) {
+        r[i] = i * 10 + 1;
+    }
+    long sum = 0;
+    for (int i = 0; i < 4; i++) {
+        sum = sum + r[i];
+    }
+    printf("row %ld of %d bytes, %d as a parameter\n", sum, (int)sizeof(r), row_bytes(0));
+    Listener l;
+    l.id = 3;
+    l.onEvent = 0;
+    l.position[1] = 2.5;
+    printf("listener %d %.1f %d\n", l.id, l.position[1], has_handler(l.onEvent));
+    
+    // Variables of an array typedef are indexed as the array
+    Matrix m;
+    for (int i = 0; i < 4; i++) {
+        for (int j = 0; j < 4; j++) {
+            m[i][j] = i * 10 + j;
+            identity[i][j] = i == j;
+        }
+    }
+    printf("matrix %d %d %d %d\n", m[1][0], m[3][2], identity[2][2], identity[2][3]);
+    
+    BinOp op = add;
+    Scale scale = half;
+    Handler h = report;
+    printf("calls %d %d %d %d\n", op(2, 3), op(op(1, 2), 4), fold(mul, 1, 5), global_op(6, 7));
+    printf("scaled %.2f\n", scale(3));
+    h(7);
+    return 0;
+}
@@ -0,0 +1,54 @@
+// Unary plus, sizeof without parentheses, _Alignof, and ! through pointers
+// to narrow types (which must load only the pointee's bytes).
+#include <stdio.h>
+#include <stdlib.h>
+
+struct Pair { char c; double d; };
+struct Buf { int v[5]; short len; };
+
+int main() {
+    int x = 5;
+    long l = 3;
+    int arr[7];
+    char *str = "hello";
+    struct Pair p;
+    struct Buf b;
+    struct Buf *bp = &b;
+
+    printf("%ld\n", sizeof x);
+    printf("%ld\n", sizeof l);
+    printf("%ld\n", sizeof arr);
+    printf("%ld\n", sizeof arr / sizeof arr[0]);
+    printf("%ld\n", sizeof(int));
+    printf("%ld\n", sizeof (x) + 1);
+    printf("%ld\n", sizeof str);
+    printf("%ld\n", sizeof *str);
+    printf("%ld\n", sizeof p);
+    printf("%ld\n", sizeof b.v);
+    printf("%ld\n", sizeof bp->len);
+    printf("%ld\n", _Alignof(double));
+    printf("%ld\n", _Alignof(struct Pair));
+    printf("%ld\n", _Alignof p);
+
+    // The operand of sizeof isn't evaluated
+    int n = 0;
+    long k = sizeof n++;
+    printf("%d %ld\n", n, k);
+
+    printf("%d\n", +x);
+    printf("%d\n", -+x);
+    int y = + + x;
+    printf("%d\n", y);
+
+    long *w = malloc(16);
+    *w = 256;
+    char *c = w;
+    printf("%d\n", !*c);
+    *w = 65536;
+    short *s = w;
+    printf("%d\n", !*s);
+    if (!*c) {
+        printf("low byte is zero\n");
+    }
+    return 0;
+}
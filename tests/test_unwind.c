@@ -0,0 +1,26 @@
+/* glibc's backtrace() unwinds through our frames with their .eh_frame.
+   descend returns early before its call, so its CFI has to pick up again
+   after the first epilogue; its recursion keeps it from being inlined. */
+#include <stdio.h>
+#include <execinfo.h>
+
+int depth(void) {
+    long frames[64];
+    return backtrace(frames, 64);
+}
+
+int descend(int n) {
+    if (n == 0) {
+        return depth();
+    }
+    int r = descend(n - 1);
+    return r + 1000;
+}
+
+int main() {
+    int shallow = descend(0);
+    int deep = descend(3);
+    printf("extra frames %d\n", deep - shallow - 3000);
+    printf("deeper again %d\n", descend(7) - shallow - 7000);
+    return 0;
+}
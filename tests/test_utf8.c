@@ -0,0 +1,18 @@
+﻿// UTF-8 source: this file starts with a byte order mark
+#include <stdio.h>
+
+// Comments may hold UTF-8: café, naïve, →, 日本
+/* Block comments too: üöä ✓ */
+
+int main() {
+    // Strings pass the bytes through untouched
+    printf("héllo, wörld ✓\n");
+    char *s = "ü";
+    int n = 0;
+    while (s[n] != 0) {
+        n = n + 1;
+    }
+    printf("bytes: %d\n", n);
+    printf("first: %d\n", s[0] & 255);
+    return 0;
+}
@@ -0,0 +1,23 @@
+#include <stdio.h>
+
+#define LOG(fmt, ...) printf(fmt, __VA_ARGS__)
+#define TRACE(fmt, ...) printf(fmt, ##__VA_ARGS__)
+#define SHOW(...) printf("%s\n", #__VA_ARGS__)
+#define CALL(f, ...) f(__VA_ARGS__)
+#define FIRST(x, ...) (x)
+
+static int sum3(int a, int b, int c) {
+    return a + b + c;
+}
+
+int main() {
+    LOG("%d + %d = %d\n", 2, 3, 2 + 3);
+    LOG("%s\n", "one argument");
+    TRACE("no arguments\n");
+    TRACE("with %s and %d\n", "a string", 42);
+    SHOW(a, b, (c, d));
+    printf("%d\n", CALL(sum3, 1, sum3(2, 10, 8), 300));
+    printf("%d\n", FIRST(7, 8, 9) + FIRST(1));
+    LOG("%d\n", sum3(1, 2, 3));
+    return 0;
+}
@@ -0,0 +1,65 @@
+#include <stdio.h>
+
+// Void functions called for their side effects: nothing comes back, so
+// nothing is kept from the call
+
+int counter = 0;
+
+void bump(int by) {
+    counter += by;
+}
+
+void bump_twice(int by) {
+    bump(by);
+    bump(by);
+}
+
+static void record(int *slot, int value) {
+    if (value < 0) {
+        return;
+    }
+    *slot = value;
+}
+
+void forward(int by) {
+    return bump(by);
+}
+
+int after_void_calls(int n) {
+    int total = n;
+    bump(1);
+    total = total + n;
+    bump_twice(2);
+    return total + counter;
+}
+
+void countdown(int n) {
+    if (n == 0) {
+        return;
+    }
+    bump(1);
+    countdown(n - 1);
+}
+
+int main(void) {
+    int slot = 7;
+    bump(3);
+    printf("counter after bump: %d\n", counter);
+    bump_twice(5);
+    printf("counter after bump_twice: %d\n", counter);
+    record(&slot, -1);
+    printf("slot after negative record: %d\n", slot);
+    record(&slot, 42);
+    printf("slot after record: %d\n", slot);
+    forward(10);
+    printf("counter after forward: %d\n", counter);
+    (void)after_void_calls(0);
+    printf("after_void_calls: %d\n", after_void_calls(4));
+    countdown(100);
+    printf("counter after countdown: %d\n", counter);
+    for (int i = 0; i < 3; i++) {
+        bump(i);
+    }
+    printf("counter after loop: %d\n", counter);
+    return 0;
+}
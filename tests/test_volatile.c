@@ -0,0 +1,57 @@
+#include <stdio.h>
+
+// volatile objects are read and written exactly as often as the source says
+
+volatile int ticks;
+const volatile int status = 7;
+
+struct Device {
+    int id;
+    volatile int reg;
+};
+
+static int poll(volatile int *p) {
+    int a = *p;
+    int b = *p;
+    return a + b;
+}
+
+static void bump(volatile int *counter) {
+    *counter = *counter + 1;
+    (*counter)++;
+}
+
+int main(void) {
+    volatile int x = 1;
+    x = 2;
+    x = 3;
+    int y = x + x;
+    printf("x=%d y=%d\n", x, y);
+
+    ticks = 10;
+    ticks++;
+    ++ticks;
+    bump(&ticks);
+    printf("ticks=%d status=%d\n", ticks, status);
+
+    volatile int *p = &x;
+    *p = 5;
+    printf("poll=%d x=%d\n", poll(p), x);
+
+    int * volatile q = &y;
+    *q = 40;
+    printf("y=%d\n", y);
+
+    struct Device d;
+    d.id = 1;
+    d.reg = 9;
+    d.reg = d.reg + d.id;
+    printf("reg=%d\n", d.reg);
+
+    volatile char c = 'a';
+    c++;
+    volatile short s = -3;
+    s = s * 2;
+    printf("c=%c s=%d\n", c, s);
+    return 0;
+}
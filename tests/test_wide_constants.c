@@ -0,0 +1,19 @@
+// Integer constants that don't fit in an instruction's 32-bit immediate
+#include <stdio.h>
+
+long wide = 5000000000L;
+
+int main() {
+    long b = 5000000000L;
+    long c = b + 6000000000L;
+    long d = -5000000000L;
+    long e = c * 3000000000L;
+    unsigned int u = 4000000000u;
+    if (b > 4000000000L) {
+        printf("b is past 2^32\n");
+    }
+    b = 2147483648L;
+    printf("%ld %ld %ld %ld %ld %u\n", b, c, d, e, wide, u);
+    printf("%ld %ld\n", 7000000000L, 3000000000L + 3000000000L);
+    return 0;
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Thread-local storage
+// A variable declared __thread (or _Thread_local) has one instance per
+// thread, as errno does: a counter each worker keeps for itself, or the last
+// error of the calling thread. Its type string carries a "__thread " prefix,
+// inside static or extern ("static __thread int"); the symbol records it in
+// IsThreadLocal. Only variables with static storage can be thread-local, so
+// a block-scope one needs static or extern.
+//
+// Selection treats thread-local variables like any other global. Once it's
+// done, lowerThreadLocals rewrites each access into one through the
+// variable's address, which OpTLSAddr computes with the initial-exec model:
+//
+//	movq %fs:0, %rax                  the thread pointer
+//	addq name@gottpoff(%rip), %rax    plus the variable's offset from it,
+//	                                  which the linker puts in the GOT
+//
+// That works for variables this program defines and for ones a shared
+// library it's linked against (initially) defines. The variables themselves
+// go in .tbss or, with a constant initializer, .tdata, which the C library
+// copies for every thread it starts.
+//
+// The built-in assembler and linker (-fuse-ld=internal and -jit)
+// have no TLS relocations or segment, so they stop with a diagnostic rather
+// than make every thread share one variable; AArch64 has none yet either.
+
+// errNativeTLS is the built-in assembler's diagnostic for thread-local storage
+var errNativeTLS = fmt.Errorf("thread-local variables need the system assembler and linker; build without -fuse-ld=internal and -jit")
+
+// splitThreadLocal separates "__thread " from a type whose storage class
+// is already off: "__thread int" -> ("int", true)
+func splitThreadLocal(typ string) (string, bool) {
+	return strings.CutPrefix(strings.TrimSpace(typ), "__thread ")
+}
+
+// isThreadLocalDecl reports whether a declaration says __thread
+func isThreadLocalDecl(node *ASTNode) bool {
+	typ := strings.TrimPrefix(strings.TrimSpace(node.DataType), "extern ")
+	_, thread := splitThreadLocal(strings.TrimPrefix(typ, "static "))
+	return thread
+}
+
+// threadLocal is the thread-local variable op names, if it names one
+func (is *InstructionSelector) threadLocal(op *Operand) (*Symbol, bool) {
+	if op == nil || !op.IsGlobal {
+		return nil, false
+	}
+	switch op.Type {
+	case "var", "addr", "array":
+	default:
+		return nil, false
+	}
+	sym, ok := is.globalVars[op.Value]
+	return sym, ok && sym.IsThreadLocal
+}
+
+// lowerThreadLocals makes every access of a thread-local variable go
+// through the address OpTLSAddr computes for the running thread: loads and
+// stores through a ptr operand, anything else through a temp loaded from
+// or stored to one. Without the C library (freestanding) there's no thread
+// pointer to compute it from.
+func (is *InstructionSelector) lowerThreadLocals(freestanding bool) error {
+	instrs := is.instructions
+	lower := false
+	for _, instr := range instrs {
+		for _, op := range []*Operand{instr.Dst, instr.Src1, instr.Src2} {
+			if sym, ok := is.threadLocal(op); ok {
+				switch {
+				case is.target.Arch == "aarch64":
+					return fmt.Errorf("in function '%s': thread-local variable '%s' isn't supported on aarch64", instr.Func, sym.Name)
+				case freestanding:
+					return fmt.Errorf("in function '%s': thread-local variable '%s' needs the C library's thread setup, which -ffreestanding leaves out", instr.Func, sym.Name)
+				}
+				lower = true
+			}
+		}
+	}
+	if !lower {
+		return nil
+	}
+	is.instructions = make([]*IRInstruction, 0, len(instrs))
+	for _, instr := range instrs {
+		is.line, is.column = instr.Line, instr.Column
+		is.currentFunc = instr.Func
+		start := len(is.instructions)
+		is.lowerThreadLocalAccess(instr)
+		if instr.Volatile {
+			is.markVolatile(start)
+		}
+	}
+	return nil
+}
+
+// lowerThreadLocalAccess appends instr, with the thread-local variables it
+// accesses lowered
+func (is *InstructionSelector) lowerThreadLocalAccess(instr *IRInstruction) {
+	if _, ok := is.threadLocal(instr.Src1); ok && instr.Op == OpLoadAddr {
+		is.emit(OpTLSAddr, instr.Dst, &Operand{Type: "label", Value: instr.Src1.Value}, nil)
+		return
+	}
+	for _, src := range []**Operand{&instr.Src1, &instr.Src2} {
+		if _, ok := is.threadLocal(*src); !ok {
+			continue
+		}
+		*src = is.threadLocalOperand(*src)
+		if (*src).Type == "ptr" && !(instr.Op == OpLoad && src == &instr.Src1) {
+			value := is.newTemp()
+			value.DataType = (*src).DataType
+			is.emit(OpLoad, value, *src, nil)
+			*src = value
+		}
+	}
+	if _, ok := is.threadLocal(instr.Dst); !ok {
+		is.instructions = append(is.instructions, instr)
+		return
+	}
+	target := is.threadLocalOperand(instr.Dst)
+	if instr.Op == OpStore {
+		instr.Dst = target
+		is.instructions = append(is.instructions, instr)
+		return
+	}
+	instr.Dst = is.newTemp()
+	is.instructions = append(is.instructions, instr)
+	is.emit(OpStore, target, instr.Dst, nil)
+}
+
+// threadLocalOperand computes the address of the thread-local variable op
+// accesses, and returns what op becomes: the address itself for "addr",
+// otherwise a ptr operand through it
+func (is *InstructionSelector) threadLocalOperand(op *Operand) *Operand {
+	addr := is.newTemp()
+	is.emit(OpTLSAddr, addr, &Operand{Type: "label", Value: op.Value}, nil)
+	switch op.Type {
+	case "addr":
+		addr.DataType = op.DataType
+		return addr
+	case "array":
+		if op.IndexTemp != nil {
+			element := is.newTemp()
+			is.emit(OpAdd, element, addr, op.IndexTemp)
+			addr = element
+		}
+	}
+	return &Operand{Type: "ptr", IndexTemp: addr, Size: op.Size, DataType: op.DataType}
+}
+
+// emitTLSAddr emits OpTLSAddr: the thread pointer plus the variable's
+// offset from it, read from the GOT
+func (ce *CodeEmitter) emitTLSAddr(instr *IRInstruction) {
+	ce.emit("movq", RegOp("fs:0"), RegOp("rax"))
+	ce.emit("addq", RIPOp(instr.Src1.Value+"@gottpoff"), RegOp("rax"))
+	ce.emit("movq", RegOp("rax"), ce.operand(instr.Dst))
+}
+
+// emitThreadLocals lays out the thread-local variables this file defines:
+// the constant-initialized ones in .tdata, the rest in .tbss
+func (ce *CodeEmitter) emitThreadLocals(names []string) {
+	for _, section := range []string{".tdata,\"awT\",@progbits", ".tbss,\"awT\",@nobits"} {
+		initialized := strings.HasPrefix(section, ".tdata")
+		started := false
+		for _, name := range names {
+			sym := ce.globalVars[name]
+			if (sym.InitValue != "") != initialized {
+				continue
+			}
+			if !started {
+				ce.bssSection.Add(NewDirective(".section", section))
+				started = true
+			}
+			if !sym.IsStatic {
+				ce.bssSection.Add(NewDirective(".globl", name))
+			}
+			ce.bssSection.Add(
+				NewDirective(".type", name+", @object"),
+				NewDirective(".size", fmt.Sprintf("%s, %d", name, sym.Size)),
+				NewDirective(".align", fmt.Sprint(max(sym.Size, 1))),
+				NewLabel(name),
+			)
+			if initialized {
+				ce.bssSection.Add(NewDirective(sym.dataDirective(), sym.InitValue))
+			} else {
+				ce.bssSection.Add(NewDirective(".zero", fmt.Sprint(sym.Size)))
+			}
+		}
+	}
+}
+
+// usesTLS reports whether mi needs thread-local storage, which the
+// built-in assembler doesn't have
+func usesTLS(mi *MachineInstr) bool {
+	switch mi.Kind {
+	case MDirective:
+		sec, ok := sectionDirective(mi.Op, mi.Args)
+		return ok && (strings.HasPrefix(sec, ".tdata") || strings.HasPrefix(sec, ".tbss"))
+	case MInstr:
+		for _, op := range mi.Operands {
+			if strings.HasPrefix(op.Reg, "fs:") || strings.Contains(op.Symbol, "@gottpoff") {
+				return true
+			}
+		}
+	}
+	return false
+}
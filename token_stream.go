@@ -0,0 +1,104 @@
+package main
+
+// Token streams
+// The parser asks for tokens as it goes rather than having the whole
+// translation unit lexed first: after includes, a unit can be megabytes of
+// header declarations, and a slice of every one of its tokens was the
+// largest allocation of a compile. A tokenStream lexes on demand and keeps
+// only the tokens from the start of the current top-level declaration on,
+// which is as far back as the parser ever looks (see Parser.Parse). A
+// source small enough to cache is kept whole instead, so TokenCache can
+// hand its tokens to the next parse of the same text.
+
+// maxCachedSource is the largest source (in bytes) whose tokens are kept
+// whole and cached
+const maxCachedSource = 1 << 20
+
+type tokenStream struct {
+	lexer  *Lexer // nil once it has returned EOF
+	source string
+	buf    []Token // the tokens from position base on
+	base   int
+	keep   bool          // keep every token: base stays 0
+	done   func([]Token) // given every token once EOF is lexed, if keep
+	lexed  int           // tokens lexed (or taken from the cache)
+}
+
+func newTokenStream(source string) *tokenStream {
+	return &tokenStream{lexer: NewLexer(source), source: source}
+}
+
+// cachedTokenStream replays tokens a stream lexed before. They're shared,
+// and never written.
+func cachedTokenStream(tokens []Token) *tokenStream {
+	return &tokenStream{buf: tokens, keep: true, lexed: len(tokens)}
+}
+
+// at is the token at position pos, lexing up to it. Past the end it's EOF.
+func (s *tokenStream) at(pos int) Token {
+	for pos-s.base >= len(s.buf) && s.lexer != nil {
+		s.next()
+	}
+	if i := pos - s.base; i < len(s.buf) {
+		return s.buf[i]
+	}
+	return s.buf[len(s.buf)-1]
+}
+
+// next lexes one more token
+func (s *tokenStream) next() {
+	tok := s.lexer.NextToken()
+	s.buf = append(s.buf, tok)
+	s.lexed++
+	if tok.Type == EOF {
+		s.lexer = nil
+		if s.keep && s.done != nil {
+			s.done(s.buf)
+		}
+	}
+}
+
+// release drops the tokens before pos: the parser won't ask for them again
+func (s *tokenStream) release(pos int) {
+	n := pos - s.base
+	if s.keep || n <= 0 || n >= len(s.buf) {
+		return
+	}
+	kept := copy(s.buf, s.buf[n:])
+	clear(s.buf[kept:])
+	s.buf = s.buf[:kept]
+	s.base = pos
+}
+
+// end lexes the rest of the source, keeping none of it unless the stream
+// keeps everything, and returns the position of EOF
+func (s *tokenStream) end() int {
+	for s.lexer != nil {
+		s.next()
+		s.release(s.base + len(s.buf) - 1)
+	}
+	return s.base + len(s.buf) - 1
+}
+
+// illegal lists the tokens the lexer rejects, in order. A stream that
+// keeps everything lexes it all now; any other lexes the source once more
+// on the side, keeping only what it's after.
+func (s *tokenStream) illegal() []Token {
+	var illegal []Token
+	if s.keep {
+		s.end()
+		for _, tok := range s.buf {
+			if tok.Type == ILLEGAL {
+				illegal = append(illegal, tok)
+			}
+		}
+		return illegal
+	}
+	lexer := NewLexer(s.source)
+	for tok := lexer.NextToken(); tok.Type != EOF; tok = lexer.NextToken() {
+		if tok.Type == ILLEGAL {
+			illegal = append(illegal, tok)
+		}
+	}
+	return illegal
+}
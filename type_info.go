@@ -0,0 +1,133 @@
+package main
+
+import "strings"
+
+// Type sizes
+// Every phase that lays out or allocates data asks one TypeInfo for the size
+// and alignment of a type, so a struct is the same shape whether the
+// preprocessor read it from a header, the parser from the source, or the
+// selector is copying it:
+//
+//	scalars and pointers   from the target spec
+//	struct and union X     the definition under X (the preprocessor keys
+//	                       tags as "struct X"), or under a typedef name
+//	typedef names          followed to the type they name; an array
+//	                       typedef is its elements, a function pointer a
+//	                       pointer
+//	anything else          an eightbyte (unknownTypeSize), as a name from a
+//	                       header nobody read is most likely a pointer or a
+//	                       long
+//
+// Layout gives a struct's members their offsets, each aligned for its type,
+// and the struct its size (padded to its alignment) and alignment; a
+// union's members all start at 0. Each phase builds a TypeInfo over its own
+// definitions when it needs one.
+
+// unknownTypeSize is the size and alignment of a type nothing defines
+const unknownTypeSize = 8
+
+// TypeInfo answers the size and alignment of types, from the target and
+// one phase's definitions
+type TypeInfo struct {
+	target   *TargetSpec
+	structs  map[string]*StructDef   // by tag, and by typedef name for a typedef of a struct
+	typedefs map[string]string       // other typedefs: the type each names
+	derived  map[string]*TypedefType // typedefs of arrays and pointers to functions
+}
+
+// SizeOf is the size of typ in bytes
+func (ti *TypeInfo) SizeOf(typ string) int {
+	size, _, _ := ti.Lookup(typ)
+	return size
+}
+
+// AlignOf is the alignment of typ in bytes
+func (ti *TypeInfo) AlignOf(typ string) int {
+	_, align, _ := ti.Lookup(typ)
+	return align
+}
+
+// Lookup is the size and alignment of typ; ok is false if nothing defines
+// it (or a struct it names hasn't been laid out yet), and they're the
+// unknown type's
+func (ti *TypeInfo) Lookup(typ string) (size, align int, ok bool) {
+	return ti.lookup(typ, make(map[string]bool))
+}
+
+func (ti *TypeInfo) lookup(typ string, visited map[string]bool) (size, align int, ok bool) {
+	typ = trimTopQualifiers(typ)
+	for trimmed := ""; trimmed != typ; {
+		trimmed = typ
+		for _, prefix := range []string{"static ", "extern ", "register ", "__thread ", "const ", "volatile "} {
+			typ = strings.TrimSpace(strings.TrimPrefix(typ, prefix))
+		}
+	}
+	if visited[typ] {
+		return unknownTypeSize, unknownTypeSize, false
+	}
+	visited[typ] = true
+
+	if size, ok := ti.target.SizeOf(typ); ok {
+		align, _ := ti.target.AlignOf(typ)
+		return size, align, true
+	}
+	if typ == "void" {
+		return 0, 1, true
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(typ, "struct "), "union ")
+	for _, key := range []string{name, typ} {
+		// A struct with members and no size yet is still to be laid out;
+		// an empty (or incomplete) one is 0 bytes
+		if def, found := ti.structs[key]; found && (def.Size > 0 || len(def.Members) == 0) {
+			align := def.Align
+			if align == 0 {
+				align = max(1, min(def.Size, unknownTypeSize))
+			}
+			return def.Size, align, true
+		}
+	}
+	if def, found := ti.derived[typ]; found {
+		if def.Function {
+			return ti.target.Sizes["pointer"], ti.target.Alignments["pointer"], true
+		}
+		size, align, ok := ti.lookup(def.Base, visited)
+		return size * max(def.Elements(), 1), align, ok
+	}
+	if actual, found := ti.typedefs[typ]; found {
+		return ti.lookup(actual, visited)
+	}
+	return unknownTypeSize, unknownTypeSize, false
+}
+
+// Layout places def's members, each at the next offset aligned for its type
+// (or all at 0 in a union), and sets def's size and alignment. A member's
+// Size is kept if it's set, and otherwise is its type's (times ArraySize
+// for an array). A packed struct or member is aligned to 1 and an aligned
+// one to at least what it asks (see attributes.go).
+func (ti *TypeInfo) Layout(def *StructDef, union bool) {
+	offset, size, align := 0, 0, 1
+	for i := range def.Members {
+		member := &def.Members[i]
+		memberSize, memberAlign, _ := ti.Lookup(member.Type)
+		if member.Size == 0 {
+			member.Size = memberSize * max(member.ArraySize, 1)
+		}
+		if def.Packed || member.Packed {
+			memberAlign = 1
+		}
+		memberAlign = max(memberAlign, member.Aligned)
+		if union {
+			member.Offset = 0
+			size = max(size, member.Size)
+		} else {
+			offset = roundUp(offset, memberAlign)
+			member.Offset = offset
+			offset += member.Size
+			size = offset
+		}
+		align = max(align, memberAlign)
+	}
+	align = max(align, def.Aligned)
+	def.Size = roundUp(size, align)
+	def.Align = align
+}
@@ -0,0 +1,848 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type checking
+// The checker runs between parsing and instruction selection. It walks the
+// AST with its own scopes and reports what selection would otherwise compile
+// silently: calls that don't match the callee's declared parameters,
+// arithmetic on structs, and assignments, initializations and returns between
+// incompatible types. Only types it can work out are checked; anything it
+// can't (names from headers, statement expressions) is left to the selector,
+// so the checker never rejects code the selector accepts for lack of
+// information. Errors stop the compile; warnings are printed like the
+// selector's.
+
+// TypeChecker is the semantic-analysis pass
+type TypeChecker struct {
+	structs   map[string]*StructDef
+	typedefs  map[string]string
+	enums     map[string]int
+	functions map[string]*FunctionSignature // declared in the source, and libc
+	// Declared in headers. Their parameter lists are only approximate, so
+	// calls to them count as declared but aren't checked.
+	headerFunctions  map[string]*FunctionSignature
+	warnImplicitDecl bool
+	warnSwitch       bool                // -Wswitch: report enumerators a switch doesn't handle
+	warnReturnType   bool                // -Wreturn-type: report returns that don't match the return type (see returns.go)
+	warnMain         bool                // -Wmain: report main's signature if C doesn't allow it (see main_function.go)
+	warnUnusedValue  bool                // -Wunused-value: report statements with no effect (see unused_value.go)
+	stmtExprValues   map[*ASTNode]bool   // statements that are the value of a statement expression
+	warnConversion   bool                // -Wconversion: report implicit conversions that may change a value
+	enumMembers      map[string][]string // enumerators of each enum type, in order
+	subset           bool                // -std=subset: reject constructs outside the subset (see subset.go)
+	caseBreaks       map[*ASTNode]bool   // breaks that end a case, which the subset allows
+	subsetLine       int                 // line of the statement being checked against the subset
+	hasBody          map[string]bool     // functions the program defines, rather than only declares
+	target    *TargetSpec
+
+	globals       map[string]scopeVar
+	staticGlobals map[string]bool // whether each global was first declared static
+	threadGlobals map[string]bool // whether each global is thread-local (see tls.go)
+	scopes      []map[string]scopeVar
+	currentFunc string
+	returnType  string
+
+	errors   []string
+	warnings []Diagnostic
+}
+
+// NewTypeChecker creates a checker over the parser's type information
+func NewTypeChecker(p *Parser) *TypeChecker {
+	return &TypeChecker{
+		structs:       p.structs,
+		typedefs:      p.typedefs,
+		enums:         p.enums,
+		enumMembers:   p.enumMembers,
+		functions:     make(map[string]*FunctionSignature),
+		target:        p.target,
+		globals:       make(map[string]scopeVar),
+		staticGlobals: make(map[string]bool),
+		threadGlobals: make(map[string]bool),
+		caseBreaks:    make(map[*ASTNode]bool),
+		hasBody:       make(map[string]bool),
+		stmtExprValues: make(map[*ASTNode]bool),
+	}
+}
+
+// Check checks a whole program, returning an error summarizing the first
+// few type errors if there are any
+func (tc *TypeChecker) Check(program *ASTNode) error {
+	// Functions may be called before they're defined
+	for _, node := range program.Children {
+		if node.Type == NodeFunction {
+			tc.functions[node.Name] = &FunctionSignature{
+				ReturnType: node.ReturnType,
+				ParamTypes: node.ParamTypes,
+				Variadic:   node.IsVariadic,
+			}
+			if len(node.Children) > 0 {
+				tc.hasBody[node.Name] = true
+			}
+		}
+	}
+	addLibcPrototypes(tc.functions)
+	defined := make(map[string]bool) // globals with an initializer so far
+	for _, node := range program.Children {
+		switch node.Type {
+		case NodeFunction:
+			if node.Name == "main" && len(node.Children) > 0 && tc.warnMain {
+				tc.checkMain(node)
+			}
+			tc.checkFunction(node)
+		case NodeVarDecl:
+			tc.currentFunc = ""
+			tc.checkGlobalDecl(node, defined)
+			if tc.subset {
+				tc.checkSubsetGlobal(node)
+			}
+			tc.globals[node.VarName] = scopeVar{typ: declType(node), arraySize: node.ArraySize}
+		}
+	}
+	if len(tc.errors) == 0 {
+		return nil
+	}
+	var msg strings.Builder
+	for i, err := range tc.errors {
+		if i == 10 {
+			fmt.Fprintf(&msg, "\n  ... and %d more errors", len(tc.errors)-10)
+			break
+		}
+		if i > 0 {
+			msg.WriteString("\n  ")
+		}
+		msg.WriteString(err)
+	}
+	return fmt.Errorf("%s", msg.String())
+}
+
+// scopeVar is a variable in scope: its type as expressions see it, with
+// arrays decayed, and the array's length (0 if it isn't one) for sizeof
+type scopeVar struct {
+	typ       string
+	arraySize int
+}
+
+// checkGlobalDecl checks a file-scope declaration against earlier ones for
+// the same name. Repeating a declaration is fine (see declareGlobal), but
+// the types must agree, only one may have an initializer, and a static
+// object can't also be declared non-static, nor a thread-local one not
+// thread-local.
+func (tc *TypeChecker) checkGlobalDecl(node *ASTNode, defined map[string]bool) {
+	name := node.VarName
+	extern := strings.HasPrefix(strings.TrimSpace(node.DataType), "extern ")
+	static := isStaticDecl(node)
+	thread := isThreadLocalDecl(node)
+	if prev, ok := tc.globals[name]; ok {
+		if typ := declType(node); typ != prev.typ || node.ArraySize != prev.arraySize {
+			tc.errorf(node, "conflicting types for '%s': %s, previously declared as %s", name, typ, prev.typ)
+		}
+		if len(node.Children) > 0 && defined[name] {
+			tc.errorf(node, "redefinition of '%s'", name)
+		}
+		if static != tc.staticGlobals[name] && !(extern && tc.staticGlobals[name]) {
+			if static {
+				tc.errorf(node, "static declaration of '%s' follows non-static declaration", name)
+			} else {
+				tc.errorf(node, "non-static declaration of '%s' follows static declaration", name)
+			}
+		}
+		if thread != tc.threadGlobals[name] {
+			if thread {
+				tc.errorf(node, "thread-local declaration of '%s' follows non-thread-local declaration", name)
+			} else {
+				tc.errorf(node, "non-thread-local declaration of '%s' follows thread-local declaration", name)
+			}
+		}
+	} else {
+		tc.staticGlobals[name] = static
+		tc.threadGlobals[name] = thread
+	}
+	if len(node.Children) > 0 {
+		defined[name] = true
+	}
+}
+
+// isStaticDecl reports whether a declaration has the static storage class
+func isStaticDecl(node *ASTNode) bool {
+	return strings.HasPrefix(strings.TrimPrefix(strings.TrimSpace(node.DataType), "extern "), "static ")
+}
+
+// declType is the type a declaration gives its name; arrays decay
+func declType(node *ASTNode) string {
+	typ := strings.TrimSpace(node.DataType)
+	typ = strings.TrimPrefix(typ, "extern ")
+	typ = strings.TrimSpace(strings.TrimPrefix(typ, "static "))
+	typ, _ = splitThreadLocal(typ)
+	if node.ArraySize > 0 {
+		return typ + "*"
+	}
+	return typ
+}
+
+// errorf and warnf record a diagnostic at node; string arguments are types
+// and go through display
+func (tc *TypeChecker) errorf(node *ASTNode, format string, args ...interface{}) {
+	tc.errors = append(tc.errors, tc.locate(node, fmt.Sprintf(format, tc.displayArgs(args)...)))
+}
+
+// warnf's code is the -W option that controls the warning, "" if none does
+func (tc *TypeChecker) warnf(node *ASTNode, code, format string, args ...interface{}) {
+	warning := Diagnostic{Severity: "warning", Stage: "check", Code: code, Message: fmt.Sprintf(format, tc.displayArgs(args)...)}
+	if tc.currentFunc != "" {
+		warning.Message = fmt.Sprintf("in function '%s': %s", tc.currentFunc, warning.Message)
+	}
+	if node != nil {
+		warning.Line, warning.Column = node.Line, node.Column
+	}
+	tc.warnings = append(tc.warnings, warning)
+}
+
+func (tc *TypeChecker) displayArgs(args []interface{}) []interface{} {
+	shown := make([]interface{}, len(args))
+	for i, arg := range args {
+		if typ, ok := arg.(string); ok {
+			arg = tc.display(typ)
+		}
+		shown[i] = arg
+	}
+	return shown
+}
+
+// display names a type for messages, using the typedef name of an
+// anonymous struct rather than its internal name
+func (tc *TypeChecker) display(typ string) string {
+	if !strings.Contains(typ, "__anon_") {
+		return typ
+	}
+	base := strings.TrimRight(typ, "* ")
+	name := ""
+	for alias, target := range tc.typedefs {
+		if target == base && !strings.Contains(alias, " ") && (name == "" || alias < name) {
+			name = alias
+		}
+	}
+	if name == "" {
+		return typ
+	}
+	return name + typ[len(base):]
+}
+
+func (tc *TypeChecker) locate(node *ASTNode, msg string) string {
+	if tc.currentFunc == "" {
+		// At file scope
+		if node != nil && node.Line > 0 {
+			return fmt.Sprintf("line %d: %s", node.Line, msg)
+		}
+		return msg
+	}
+	if node != nil && node.Line > 0 {
+		return fmt.Sprintf("line %d: in function '%s': %s", node.Line, tc.currentFunc, msg)
+	}
+	return fmt.Sprintf("in function '%s': %s", tc.currentFunc, msg)
+}
+
+func (tc *TypeChecker) pushScope() {
+	tc.scopes = append(tc.scopes, make(map[string]scopeVar))
+}
+
+func (tc *TypeChecker) popScope() {
+	tc.scopes = tc.scopes[:len(tc.scopes)-1]
+}
+
+func (tc *TypeChecker) declare(name, typ string, arraySize int) {
+	tc.scopes[len(tc.scopes)-1][name] = scopeVar{typ: typ, arraySize: arraySize}
+}
+
+// lookup finds a variable's type, innermost scope first
+func (tc *TypeChecker) lookup(name string) (string, bool) {
+	v, ok := tc.lookupVar(name)
+	return v.typ, ok
+}
+
+func (tc *TypeChecker) lookupVar(name string) (scopeVar, bool) {
+	for i := len(tc.scopes) - 1; i >= 0; i-- {
+		if v, ok := tc.scopes[i][name]; ok {
+			return v, true
+		}
+	}
+	v, ok := tc.globals[name]
+	return v, ok
+}
+
+func (tc *TypeChecker) checkFunction(node *ASTNode) {
+	if len(node.Children) == 0 {
+		return
+	}
+	tc.currentFunc = node.Name
+	tc.returnType = node.ReturnType
+	tc.pushScope()
+	for i, param := range node.Params {
+		if i < len(node.ParamTypes) {
+			tc.declare(param, node.ParamTypes[i], 0)
+		}
+	}
+	if tc.subset {
+		tc.checkSubsetPassing(node, node.ParamTypes)
+	}
+	tc.checkStmt(node.Children[0])
+	tc.popScope()
+}
+
+func (tc *TypeChecker) checkStmt(node *ASTNode) {
+	if node == nil {
+		return
+	}
+	if tc.subset {
+		tc.checkSubsetStmt(node)
+	}
+	switch node.Type {
+	case NodeBlock, NodeFor:
+		tc.pushScope()
+		for _, child := range node.Children {
+			tc.checkStmt(child)
+		}
+		tc.popScope()
+	case NodeVarDecl:
+		typ := declType(node)
+		if isThreadLocalDecl(node) && !isStaticDecl(node) && !strings.HasPrefix(strings.TrimSpace(node.DataType), "extern ") {
+			tc.errorf(node, "function-scope '%s' implicitly auto and declared '__thread'", node.VarName)
+		}
+		if len(node.Children) > 0 && node.ArraySize == 0 {
+			tc.checkConversion(node, typ, node.Children[0], "initialization")
+		} else if len(node.Children) > 0 {
+			tc.exprType(node.Children[0])
+		}
+		tc.declare(node.VarName, typ, node.ArraySize)
+	case NodeReturn:
+		void := tc.kindOf(tc.returnType) == kindVoid
+		switch {
+		case len(node.Children) > 0 && void:
+			if tc.kindOf(tc.exprType(node.Children[0])) != kindVoid && tc.warnReturnType {
+				tc.warnf(node, "-Wreturn-type", "'return' with a value, in function returning void")
+			}
+		case len(node.Children) > 0:
+			tc.checkConversion(node, tc.returnType, node.Children[0], "return")
+		case !void && tc.kindOf(tc.returnType) != "" && tc.warnReturnType:
+			tc.warnf(node, "-Wreturn-type", "'return' with no value, in function returning non-void")
+		}
+	case NodeSwitch:
+		if len(node.Children) == 0 {
+			return
+		}
+		typ := tc.exprType(node.Children[0])
+		for _, child := range node.Children[1:] {
+			tc.checkStmt(child)
+		}
+		tc.checkSwitch(node, typ)
+	case NodeExprStmt:
+		if tc.warnUnusedValue {
+			tc.checkUnusedValue(node)
+		}
+		for _, child := range node.Children {
+			tc.checkStmt(child)
+		}
+	case NodeIf, NodeWhile, NodeCase:
+		for _, child := range node.Children {
+			tc.checkStmt(child)
+		}
+	default:
+		if isExpressionNode(node) {
+			tc.exprType(node)
+			return
+		}
+		for _, child := range node.Children {
+			tc.checkStmt(child)
+		}
+	}
+}
+
+func isExpressionNode(node *ASTNode) bool {
+	switch node.Type {
+	case NodeBinaryOp, NodeUnaryOp, NodeCall, NodeIdentifier, NodeNumber, NodeString,
+		NodeAssignment, NodeArrayAccess, NodeMemberAccess, NodeCast, NodeTernary, NodeCompoundLiteral:
+		return true
+	}
+	return false
+}
+
+// Type kinds the checker distinguishes; "" means unknown
+const (
+	kindArith   = "arithmetic"
+	kindPointer = "pointer"
+	kindStruct  = "struct"
+	kindVoid    = "void"
+)
+
+// normalizeType resolves typedefs and drops qualifiers and storage classes
+func (tc *TypeChecker) normalizeType(typ string) string {
+	typ = trimTopQualifiers(typ)
+	stars := 0
+	for strings.HasSuffix(typ, "*") {
+		stars++
+		typ = strings.TrimSpace(typ[:len(typ)-1])
+	}
+	var words []string
+	for _, word := range strings.Fields(typ) {
+		switch word {
+		case "const", "volatile", "static", "extern", "register", "inline":
+			continue
+		}
+		words = append(words, word)
+	}
+	typ = strings.Join(words, " ")
+	for i := 0; i < 8; i++ {
+		resolved, ok := tc.typedefs[typ]
+		if !ok || resolved == typ {
+			break
+		}
+		typ = tc.normalizeType(resolved)
+	}
+	return typ + strings.Repeat("*", stars)
+}
+
+// kindOf classifies a type
+func (tc *TypeChecker) kindOf(typ string) string {
+	typ = tc.normalizeType(typ)
+	switch {
+	case typ == "":
+		return ""
+	case strings.HasSuffix(typ, "*"):
+		return kindPointer
+	case typ == "void":
+		return kindVoid
+	case strings.HasPrefix(typ, "struct ") || strings.HasPrefix(typ, "union "):
+		if _, ok := tc.structs[strings.TrimSpace(typ[strings.Index(typ, " "):])]; ok {
+			return kindStruct
+		}
+		return ""
+	}
+	if _, ok := tc.target.SizeOf(typ); ok {
+		return kindArith
+	}
+	return ""
+}
+
+func isFloatType(typ string) bool {
+	return typ == "float" || typ == "double" || typ == "long double"
+}
+
+// exprType checks an expression and returns its type ("" when unknown)
+func (tc *TypeChecker) exprType(node *ASTNode) string {
+	switch node.Type {
+	case NodeNumber:
+		if node.DataType == "" {
+			return "int"
+		}
+		return node.DataType
+	case NodeString:
+		return "char*"
+	case NodeIdentifier:
+		if typ, ok := tc.lookup(node.VarName); ok {
+			return typ
+		}
+		if _, ok := tc.enums[node.VarName]; ok {
+			return "int"
+		}
+		return ""
+	case NodeCast:
+		source := tc.exprType(node.Children[0])
+		if node.Operator != "implicit" {
+			// An explicit cast converts as assignment does, but a pointer
+			// may be cast to an integer (as its address, unsigned)
+			if tc.kindOf(source) == kindPointer {
+				source = "unsigned long"
+			}
+			tc.convertImplicitly(node.Children[0], source, node.DataType)
+		}
+		return node.DataType
+	case NodeCompoundLiteral:
+		for i, child := range node.Children {
+			target := tc.initializerTarget(node, i)
+			if target == "" || child.Type == NodeCompoundLiteral {
+				// Nested braces check their own values
+				tc.exprType(child)
+				continue
+			}
+			tc.checkConversion(child, target, child, "initialization")
+		}
+		if node.ArraySize > 0 {
+			return node.DataType + "*"
+		}
+		return node.DataType
+	case NodeCall:
+		return tc.checkCall(node)
+	case NodeAssignment:
+		target := tc.exprType(node.Children[0])
+		tc.checkWritable(node, target, "assignment")
+		if node.Operator == "=" {
+			tc.checkConversion(node, target, node.Children[1], "assignment")
+		} else {
+			op := strings.TrimSuffix(node.Operator, "=")
+			value := tc.exprType(node.Children[1])
+			tc.arithResult(node, op, target, value)
+			// The operation is computed in the common type, then
+			// converted back to the target's
+			if typ := tc.operationType(op, target, value); typ != "" {
+				node.DataType = typ
+				if op != "<<" && op != ">>" {
+					tc.convertImplicitly(node.Children[1], value, typ)
+				}
+			}
+		}
+		return target
+	case NodeBinaryOp:
+		left := tc.exprType(node.Children[0])
+		right := tc.exprType(node.Children[1])
+		result := tc.arithResult(node, node.Operator, left, right)
+		if typ := tc.operationType(node.Operator, left, right); typ != "" {
+			node.DataType = typ
+			tc.convertImplicitly(node.Children[0], left, typ)
+			if node.Operator != "<<" && node.Operator != ">>" {
+				tc.convertImplicitly(node.Children[1], right, typ)
+			}
+		}
+		return result
+	case NodeUnaryOp:
+		operand := tc.exprType(node.Children[0])
+		switch node.Operator {
+		case "*":
+			if pointee, ok := tc.pointee(operand); ok {
+				return pointee
+			}
+			if kind := tc.kindOf(operand); kind == kindArith || kind == kindStruct {
+				tc.errorf(node, "invalid type argument of unary '*' (have '%s')", operand)
+			}
+			return ""
+		case "&":
+			if operand == "" {
+				return ""
+			}
+			return operand + "*"
+		case "!":
+			if tc.kindOf(operand) == kindStruct {
+				tc.errorf(node, "wrong type argument to unary '!' (have '%s')", operand)
+			}
+			return "int"
+		case "+", "-", "~":
+			if kind := tc.kindOf(operand); kind == kindStruct || kind == kindPointer {
+				tc.errorf(node, "wrong type argument to unary '%s' (have '%s')", node.Operator, operand)
+			}
+			return operand
+		}
+		if tc.kindOf(operand) == kindStruct {
+			tc.errorf(node, "wrong type argument to %s (have '%s')", incDecName(node.Operator), operand)
+		}
+		tc.checkWritable(node, operand, incDecName(node.Operator))
+		if tc.subset && tc.kindOf(operand) == kindPointer {
+			tc.checkSubsetPointerArith(node, operand)
+		}
+		return operand
+	case NodeArrayAccess:
+		base := tc.exprType(node.Children[0])
+		tc.exprType(node.Children[1])
+		if pointee, ok := tc.pointee(base); ok {
+			return pointee
+		}
+		if kind := tc.kindOf(base); kind == kindArith || kind == kindStruct {
+			tc.errorf(node, "subscripted value is neither array nor pointer (have '%s')", base)
+		}
+		return ""
+	case NodeMemberAccess:
+		member, inConst, ok := tc.member(node)
+		if !ok {
+			return ""
+		}
+		typ := member.Type
+		if inConst {
+			// Members of a const struct are const
+			typ = addConst(typ)
+		}
+		if member.ArraySize > 0 {
+			return typ + "*"
+		}
+		return typ
+	case NodeTernary:
+		tc.exprType(node.Children[0])
+		result := tc.exprType(node.Children[1])
+		tc.exprType(node.Children[2])
+		if tc.subset && tc.kindOf(result) == kindStruct {
+			tc.checkSubsetConditional(node)
+		}
+		return result
+	case NodeSizeof:
+		if size, align, ok := tc.objectLayout(node.Children[0]); ok {
+			node.IntValue = size
+			if node.Operator == "_Alignof" {
+				node.IntValue = align
+			}
+		}
+		return "unsigned long"
+	}
+	// Statement expressions and anything else: check what's inside. A
+	// statement expression's last statement is its value.
+	if node.Type == NodeBlock && len(node.Children) > 0 {
+		tc.stmtExprValues[node.Children[len(node.Children)-1]] = true
+	}
+	tc.checkStmt(node)
+	return ""
+}
+
+// pointee is the type typ points to, const if the pointee is
+func (tc *TypeChecker) pointee(typ string) (string, bool) {
+	pointee, ok := pointeeType(tc.normalizeType(typ))
+	if !ok {
+		return "", false
+	}
+	if raw, ok := constPointee(typ); ok && isConstType(raw) {
+		pointee = addConst(pointee)
+	}
+	return pointee, true
+}
+
+// member checks a member access and finds the member it names, and whether
+// the struct it's in is const
+func (tc *TypeChecker) member(node *ASTNode) (StructMember, bool, bool) {
+	object := tc.exprType(node.Children[0])
+	base := tc.normalizeType(object)
+	if node.IsPointer {
+		object, _ = constPointee(object)
+		pointee, ok := pointeeType(base)
+		if !ok {
+			return StructMember{}, false, false
+		}
+		base = pointee
+	}
+	def, ok := tc.structs[strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(base, "struct "), "union "))]
+	if !ok {
+		return StructMember{}, false, false
+	}
+	for _, member := range def.Members {
+		if member.Name == node.MemberName {
+			return member, isConstType(object), true
+		}
+	}
+	return StructMember{}, false, false
+}
+
+// initializerTarget is the type of what the i'th value of a brace
+// initializer initializes: the element type of an array, or the member the
+// parser labeled it with. It's "" if that isn't known.
+func (tc *TypeChecker) initializerTarget(node *ASTNode, i int) string {
+	if node.ArraySize > 0 {
+		return node.DataType
+	}
+	if i >= len(node.InitFields) || node.InitFields[i] == "" {
+		return ""
+	}
+	def, ok := tc.structs[structTag(tc.normalizeType(node.DataType))]
+	if !ok {
+		return ""
+	}
+	for _, member := range def.Members {
+		if member.Name == node.InitFields[i] && member.ArraySize == 0 {
+			return member.Type
+		}
+	}
+	return ""
+}
+
+// objectLayout is the size and alignment of what an expression designates:
+// unlike its type, an array name, array member or string literal is the
+// whole array
+func (tc *TypeChecker) objectLayout(node *ASTNode) (size, align int, ok bool) {
+	switch node.Type {
+	case NodeString:
+		// An array of its chars and the NUL
+		return len(node.Value) + 1, 1, true
+	case NodeIdentifier:
+		if v, found := tc.lookupVar(node.VarName); found && v.arraySize > 0 {
+			elem, _ := pointeeType(v.typ)
+			size, align, ok = tc.typeLayout(elem)
+			return size * v.arraySize, align, ok
+		}
+	case NodeMemberAccess:
+		member, _, found := tc.member(node)
+		if !found {
+			return 0, 0, false
+		}
+		if member.ArraySize > 0 {
+			size, align, ok = tc.typeLayout(member.Type)
+			return size * member.ArraySize, align, ok
+		}
+		return tc.typeLayout(member.Type)
+	}
+	return tc.typeLayout(tc.exprType(node))
+}
+
+// typeLayout is the size and alignment of a type, if the checker knows it
+func (tc *TypeChecker) typeLayout(typ string) (size, align int, ok bool) {
+	typ = tc.normalizeType(typ)
+	switch tc.kindOf(typ) {
+	case kindArith, kindPointer, kindStruct:
+		return tc.types().Lookup(typ)
+	}
+	return 0, 0, false
+}
+
+// types sizes types by the program's structs and typedefs
+func (tc *TypeChecker) types() *TypeInfo {
+	return &TypeInfo{target: tc.target, structs: tc.structs, typedefs: tc.typedefs}
+}
+
+func incDecName(op string) string {
+	if strings.HasPrefix(op, "--") {
+		return "decrement"
+	}
+	return "increment"
+}
+
+// arithResult checks a binary operator's operands and returns the result type
+func (tc *TypeChecker) arithResult(node *ASTNode, op, left, right string) string {
+	lk, rk := tc.kindOf(left), tc.kindOf(right)
+	switch op {
+	case "&&", "||":
+		if lk == kindStruct || rk == kindStruct {
+			tc.errorf(node, "used struct type value where scalar is required")
+		}
+		return "int"
+	case "==", "!=", "<", ">", "<=", ">=":
+		if lk == kindStruct || rk == kindStruct {
+			tc.errorf(node, "invalid operands to binary %s (have '%s' and '%s')", op, left, right)
+		}
+		return "int"
+	}
+	if lk == "" || rk == "" {
+		if lk == kindStruct || rk == kindStruct {
+			tc.errorf(node, "invalid operands to binary %s (have '%s' and '%s')", op, left, right)
+		}
+		return ""
+	}
+	invalid := func() string {
+		tc.errorf(node, "invalid operands to binary %s (have '%s' and '%s')", op, left, right)
+		return ""
+	}
+	if lk == kindStruct || rk == kindStruct || lk == kindVoid || rk == kindVoid {
+		return invalid()
+	}
+	if lk == kindPointer || rk == kindPointer {
+		if tc.subset {
+			if lk == kindPointer {
+				tc.checkSubsetPointerArith(node, left)
+			} else {
+				tc.checkSubsetPointerArith(node, right)
+			}
+		}
+		switch {
+		case op == "+" && lk == kindPointer && rk == kindArith:
+			return left
+		case op == "+" && lk == kindArith && rk == kindPointer:
+			return right
+		case op == "-" && lk == kindPointer && rk == kindArith:
+			return left
+		case op == "-" && lk == kindPointer && rk == kindPointer:
+			return "long"
+		}
+		return invalid()
+	}
+	// Usual arithmetic conversions (see conversions.go)
+	l, r := tc.normalizeType(left), tc.normalizeType(right)
+	switch op {
+	case "%", "<<", ">>", "&", "|", "^":
+		if isFloatType(l) || isFloatType(r) {
+			return invalid()
+		}
+	}
+	if op == "<<" || op == ">>" {
+		return promoted(tc.target, l)
+	}
+	return commonType(tc.target, l, r)
+}
+
+// checkConversion checks that value can be implicitly converted to target,
+// as in assignment. context names the conversion for messages:
+// "initialization", "assignment", "return" or "passing argument N of 'f'".
+func (tc *TypeChecker) checkConversion(node *ASTNode, target string, value *ASTNode, context string) {
+	source := tc.exprType(value)
+	tk, sk := tc.kindOf(target), tc.kindOf(source)
+	if tk == "" || sk == "" || tk == kindVoid {
+		return
+	}
+	if sk == kindVoid {
+		tc.errorf(node, "void value not ignored as it ought to be")
+		return
+	}
+	switch {
+	case tk == kindStruct || sk == kindStruct:
+		if tc.normalizeType(target) != tc.normalizeType(source) {
+			tc.errorf(node, "incompatible type for %s (expected '%s', have '%s')", context, target, source)
+		}
+	case tk == kindPointer && sk == kindArith:
+		if !isNullConstant(value) {
+			tc.warnf(node, "", "%s makes pointer from integer without a cast (expected '%s', have '%s')", context, target, source)
+		}
+	case tk == kindArith && sk == kindPointer:
+		tc.warnf(node, "", "%s makes integer from pointer without a cast (expected '%s', have '%s')", context, target, source)
+	case tk == kindArith && sk == kindArith:
+		if tc.warnConversion {
+			tc.checkPrecision(node, value, source, target)
+		}
+		tc.convertImplicitly(value, source, target)
+	}
+}
+
+// isNullConstant reports whether node is the integer constant 0, which
+// converts to any pointer type
+func isNullConstant(node *ASTNode) bool {
+	if node.Type == NodeCast && len(node.Children) > 0 {
+		return isNullConstant(node.Children[0])
+	}
+	return node.Type == NodeNumber && node.IntValue == 0 && !strings.Contains(node.Value, ".")
+}
+
+// checkCall checks a call's arguments against the callee's declaration and
+// returns the call's type
+func (tc *TypeChecker) checkCall(node *ASTNode) string {
+	if typ, ok := tc.checkAtomic(node); ok {
+		return typ
+	}
+	sig, ok := tc.functions[node.Name]
+	if !ok {
+		_, isVar := tc.lookup(node.Name)
+		_, inHeader := tc.headerFunctions[node.Name]
+		if tc.warnImplicitDecl && !isVar && !inHeader {
+			tc.warnf(node, "-Wimplicit-function-declaration", "implicit declaration of function '%s'", node.Name)
+		}
+		types := make([]string, len(node.Children))
+		for i, arg := range node.Children {
+			types[i] = tc.exprType(arg)
+		}
+		if tc.subset {
+			tc.checkSubsetPassing(node, types)
+		}
+		return ""
+	}
+	want, have := len(sig.ParamTypes), len(node.Children)
+	switch {
+	case have < want:
+		tc.errorf(node, "too few arguments to function '%s' (expected %d, have %d)", node.Name, want, have)
+	case have > want && !sig.Variadic:
+		tc.errorf(node, "too many arguments to function '%s' (expected %d, have %d)", node.Name, want, have)
+	}
+	types := make([]string, len(node.Children))
+	for i, arg := range node.Children {
+		if i >= want {
+			types[i] = tc.exprType(arg)
+			continue
+		}
+		types[i] = sig.ParamTypes[i]
+		tc.checkConversion(node, sig.ParamTypes[i], arg, fmt.Sprintf("passing argument %d of '%s'", i+1, node.Name))
+	}
+	if tc.subset {
+		tc.checkSubsetPassing(node, types)
+	}
+	return sig.ReturnType
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Structured typedefs
+// Most typedefs name a type that is spelled as a string everywhere else
+// ("unsigned long", "struct Color", "char*"), so they're kept as one, in
+// Parser.typedefs. Two kinds can't be spelled that way and are kept as a
+// TypedefType as well:
+//
+//	typedef void (*TraceLogCallback)(int logLevel, const char *text, va_list args);
+//	typedef int Matrix[4][4];
+//
+// Where a type string is wanted, either reads as its Flat type: a pointer
+// to a function is a pointer, and an array is its element type. Declaring
+// a variable or member of an array typedef also gives it the array's
+// length, with the dimensions flattened (a Matrix is 16 ints, and sizeof
+// is 64), and a parameter of one is adjusted to a pointer to its elements,
+// as C does. Calling a variable of a pointer-to-function typedef calls
+// the function it points to. The parser reads both kinds from source; the preprocessor
+// reads them from header lines into the header's summary (see scanHeader).
+
+// TypedefType is a typedef of a pointer to a function, or of an array
+type TypedefType struct {
+	Base     string   `json:"base"`               // the function's return type, or the array's element type
+	Function bool     `json:"function,omitempty"` // a pointer to a function taking Params
+	Params   []string `json:"params,omitempty"`
+	Variadic bool     `json:"variadic,omitempty"`
+	Dims     []int    `json:"dims,omitempty"` // an array's dimensions, outermost first
+}
+
+// Flat is the type string the typedef reads as
+func (t *TypedefType) Flat() string {
+	if t.Function {
+		return "void*"
+	}
+	return t.Base
+}
+
+// Elements is how many Base values an array typedef holds, or 0 if it
+// isn't an array
+func (t *TypedefType) Elements() int {
+	if len(t.Dims) == 0 {
+		return 0
+	}
+	n := 1
+	for _, dim := range t.Dims {
+		n *= dim
+	}
+	return n
+}
+
+// String spells the type as C would, without a name
+func (t *TypedefType) String() string {
+	if t.Function {
+		params := append([]string(nil), t.Params...)
+		if t.Variadic {
+			params = append(params, "...")
+		}
+		if len(params) == 0 {
+			params = []string{"void"}
+		}
+		return fmt.Sprintf("%s (*)(%s)", t.Base, strings.Join(params, ", "))
+	}
+	var dims strings.Builder
+	for _, dim := range t.Dims {
+		fmt.Fprintf(&dims, "[%d]", dim)
+	}
+	return t.Base + dims.String()
+}
+
+// defineTypedef records a structured typedef named by tok
+func (p *Parser) defineTypedef(tok Token, typ *TypedefType) {
+	p.typedefs[tok.Lexeme] = typ.Flat()
+	p.typedefTypes[tok.Lexeme] = typ
+	p.indexSymbol(SymbolTypedef, tok.Lexeme, typ.String(), tok, true)
+}
+
+// parseFunctionPointerTypedef parses "(*Name)(params);" after a typedef's
+// return type
+func (p *Parser) parseFunctionPointerTypedef(returnType string) error {
+	p.advance() // skip (
+	p.advance() // skip *
+	if !p.match(IDENTIFIER) {
+		return fmt.Errorf("expected typedef name after (*")
+	}
+	nameTok := p.current()
+	p.advance()
+	if !p.match(RPAREN) {
+		return fmt.Errorf("expected ) after typedef name %s", nameTok.Lexeme)
+	}
+	p.advance()
+	if !p.match(LPAREN) {
+		return fmt.Errorf("expected parameter list for typedef %s", nameTok.Lexeme)
+	}
+	// The rest reads as a function declaration does
+	fn, err := p.parseFunction(nameTok.Lexeme, returnType)
+	if err != nil {
+		return err
+	}
+	p.defineTypedef(nameTok, &TypedefType{
+		Base:     returnType,
+		Function: true,
+		Params:   fn.ParamTypes,
+		Variadic: fn.IsVariadic,
+	})
+	return nil
+}
+
+// parseArrayTypedef parses the dimensions after an array typedef's name
+// and returns its type, or nil if there are none. inner is the structured
+// typedef the element type came from, if any: an array of arrays is one
+// array with the dimensions of both.
+func (p *Parser) parseArrayTypedef(element string, inner *TypedefType) (*TypedefType, error) {
+	var dims []int
+	for p.match(LBRACKET) {
+		p.advance()
+		dim, err := p.parseArrayDimension()
+		if err != nil {
+			return nil, err
+		}
+		if !p.match(RBRACKET) {
+			return nil, fmt.Errorf("expected ']'")
+		}
+		p.advance()
+		dims = append(dims, dim)
+	}
+	if len(dims) == 0 {
+		return nil, nil
+	}
+	if inner != nil && len(inner.Dims) > 0 {
+		return &TypedefType{Base: inner.Base, Dims: append(dims, inner.Dims...)}, nil
+	}
+	return &TypedefType{Base: element, Dims: dims}, nil
+}
+
+// typedefElements is how many elements the array typedef the last
+// parseType resolved holds (0 if it resolved none)
+func (p *Parser) typedefElements() int {
+	if p.typedefUsed == nil {
+		return 0
+	}
+	return p.typedefUsed.Elements()
+}
+
+// typedefDims is the dimensions of the array typedef the last parseType
+// resolved (nil if it resolved none)
+func (p *Parser) typedefDims() []int {
+	if p.typedefUsed == nil {
+		return nil
+	}
+	return p.typedefUsed.Dims
+}
+
+// noteLocalDims records the dimensions of a local of the function being
+// parsed, if it has more than one, for flattenSubscripts: Matrix m is an
+// int[4][4], and m[1][0] is its fifth element
+func (p *Parser) noteLocalDims(name string, dims []int) {
+	if p.function == "" || len(dims) < 2 {
+		return
+	}
+	if p.localDims == nil {
+		p.localDims = make(map[string]map[string][]int)
+	}
+	if p.localDims[p.function] == nil {
+		p.localDims[p.function] = make(map[string][]int)
+	}
+	p.localDims[p.function][name] = dims
+}
+
+// noteFunctionPointer records that name, a parameter or local of function
+// (or a global, for ""), is of the pointer-to-function typedef the last
+// parseType resolved, if it is one: calls through it take its signature
+// (see functionPointer)
+func (p *Parser) noteFunctionPointer(function, name string) {
+	if p.typedefUsed == nil || !p.typedefUsed.Function {
+		return
+	}
+	if p.functionPointers == nil {
+		p.functionPointers = make(map[string]map[string]*TypedefType)
+	}
+	if p.functionPointers[function] == nil {
+		p.functionPointers[function] = make(map[string]*TypedefType)
+	}
+	p.functionPointers[function][name] = p.typedefUsed
+}
+
+// functionPointer is the pointer-to-function typedef of the variable name
+// in the function being selected, or nil if name isn't a variable of one:
+// a call to name then calls the function of that name
+func (is *InstructionSelector) functionPointer(name string) *TypedefType {
+	if _, ok := is.localVars[name]; ok {
+		return is.functionPointers[is.currentFunc][name]
+	}
+	if _, ok := is.globalVars[name]; ok {
+		return is.functionPointers[""][name]
+	}
+	return nil
+}
+
+var (
+	headerFunctionPointerTypedef = regexp.MustCompile(`^typedef\s+(.+?)\(\s*\*\s*([A-Za-z_]\w*)\s*\)\s*\((.*)\)\s*;$`)
+	headerArrayTypedef           = regexp.MustCompile(`^typedef\s+(.+?)\s*\b([A-Za-z_]\w*)\s*((?:\[\s*\d+\s*\])+)\s*;$`)
+	headerDimension              = regexp.MustCompile(`\d+`)
+)
+
+// parseHeaderTypedef parses a one-line typedef of a pointer to a function
+// or of an array, or returns nil for any other line
+func parseHeaderTypedef(line string) *HeaderType {
+	if m := headerFunctionPointerTypedef.FindStringSubmatch(line); m != nil {
+		typ := &TypedefType{Base: headerDeclType(m[1]), Function: true}
+		params := strings.TrimSpace(m[3])
+		if params != "" && params != "void" {
+			for _, param := range strings.Split(params, ",") {
+				param = strings.TrimSpace(param)
+				if param == "..." {
+					typ.Variadic = true
+					continue
+				}
+				typ.Params = append(typ.Params, headerDeclType(param))
+			}
+		}
+		return &HeaderType{Name: m[2], Typedef: typ}
+	}
+	if m := headerArrayTypedef.FindStringSubmatch(line); m != nil {
+		typ := &TypedefType{Base: headerDeclType(m[1])}
+		for _, dim := range headerDimension.FindAllString(m[3], -1) {
+			n, _ := strconv.Atoi(dim)
+			typ.Dims = append(typ.Dims, n)
+		}
+		return &HeaderType{Name: m[2], Typedef: typ}
+	}
+	return nil
+}
+
+// headerTypeWords can't be a declaration's name
+var headerTypeWords = map[string]bool{
+	"void": true, "char": true, "short": true, "int": true, "long": true, "float": true,
+	"double": true, "signed": true, "unsigned": true, "const": true, "volatile": true,
+}
+
+// headerDeclType is the type of a declaration in a header ("const char
+// *text" is "const char*"), spelled as the parser spells types
+func headerDeclType(decl string) string {
+	decl = strings.TrimSpace(decl)
+	end := len(decl)
+	for end > 0 && isIdentChar(decl[end-1]) {
+		end--
+	}
+	if name := decl[end:]; name != "" && !headerTypeWords[name] && strings.TrimSpace(decl[:end]) != "" {
+		decl = decl[:end]
+	}
+	words := strings.Fields(strings.ReplaceAll(decl, "*", " * "))
+	var typ strings.Builder
+	for _, word := range words {
+		if word != "*" && typ.Len() > 0 {
+			typ.WriteByte(' ')
+		}
+		typ.WriteString(word)
+	}
+	return typ.String()
+}
@@ -0,0 +1,224 @@
+package main
+
+import "fmt"
+
+// Uninitialized locals (-Wuninitialized, on by default)
+// Once a function's IR is selected it's split into basic blocks, and two
+// facts are propagated forward over them for each scalar local: stored on
+// every path to a point (must) and stored on some path (may). A load of a
+// local that isn't stored on every path is reported at the line of the
+// statement doing it, once per local:
+//
+//	'x' is used uninitialized       no path stores it first
+//	'x' may be used uninitialized   some paths do, others don't
+//
+// Parameters start out stored. Arrays and structs are left alone, since a
+// store to one element or member doesn't make the rest of it initialized,
+// and so is any local whose address is taken: what's done through the
+// pointer (a call filling it in, say) can't be seen here. Blocks no path
+// from the entry reaches are skipped.
+
+// basicBlock is a run of one function's IR with a single entry
+type basicBlock struct {
+	start, end int   // instructions [start, end)
+	succs      []int // successor blocks
+	preds      []int
+}
+
+// splitBlocks cuts a function's IR into basic blocks: a block starts at a
+// label or after a jump or return, and flows into the next one unless it
+// ends in an unconditional jump or a return
+func splitBlocks(fn []*IRInstruction) []*basicBlock {
+	var blocks []*basicBlock
+	labels := make(map[string]int)
+	start := 0
+	cut := func(end int) {
+		if end > start {
+			blocks = append(blocks, &basicBlock{start: start, end: end})
+		}
+		start = end
+	}
+	for i, instr := range fn {
+		switch instr.Op {
+		case OpLabel:
+			cut(i)
+			labels[instr.Dst.Value] = len(blocks)
+		case OpJmp, OpJz, OpJnz, OpRet, OpTailCall:
+			cut(i + 1)
+		}
+	}
+	cut(len(fn))
+
+	for b, block := range blocks {
+		last := fn[block.end-1]
+		switch last.Op {
+		case OpJmp:
+			if target, ok := labels[last.Dst.Value]; ok {
+				block.succs = append(block.succs, target)
+			}
+			continue
+		case OpJz, OpJnz:
+			if target, ok := labels[last.Dst.Value]; ok {
+				block.succs = append(block.succs, target)
+			}
+		case OpRet, OpTailCall:
+			continue
+		}
+		if b+1 < len(blocks) {
+			block.succs = append(block.succs, b+1)
+		}
+	}
+	for b, block := range blocks {
+		for _, s := range block.succs {
+			blocks[s].preds = append(blocks[s].preds, b)
+		}
+	}
+	return blocks
+}
+
+// checkUninitialized reports loads of locals not stored on every path to
+// them, in the function whose IR starts at instruction start
+func (is *InstructionSelector) checkUninitialized(start int) {
+	fn := is.instructions[start:]
+	tracked := is.trackedLocals(fn)
+	if len(tracked) == 0 {
+		return
+	}
+	blocks := splitBlocks(fn)
+
+	// Per block, the locals stored on every path (in) and on some path
+	// (maybeIn) to its start, and the same at its end
+	type facts struct{ in, out, maybeIn, maybeOut map[int]bool }
+	flow := make([]facts, len(blocks))
+	reached := make([]bool, len(blocks))
+	reached[0] = true
+	for changed := true; changed; {
+		changed = false
+		for b, block := range blocks {
+			var in, maybeIn map[int]bool
+			if b == 0 {
+				in, maybeIn = map[int]bool{}, map[int]bool{}
+			} else {
+				for _, p := range block.preds {
+					if !reached[p] {
+						continue
+					}
+					reached[b] = true
+					if in == nil {
+						in, maybeIn = copySet(flow[p].out), copySet(flow[p].maybeOut)
+						continue
+					}
+					for offset := range in {
+						if !flow[p].out[offset] {
+							delete(in, offset)
+						}
+					}
+					for offset := range flow[p].maybeOut {
+						maybeIn[offset] = true
+					}
+				}
+			}
+			if !reached[b] {
+				continue
+			}
+			out, maybeOut := copySet(in), copySet(maybeIn)
+			for _, instr := range fn[block.start:block.end] {
+				if offset, ok := storedLocal(instr, tracked); ok {
+					out[offset] = true
+					maybeOut[offset] = true
+				}
+			}
+			if len(out) != len(flow[b].out) || len(maybeOut) != len(flow[b].maybeOut) || flow[b].out == nil {
+				changed = true
+			}
+			flow[b] = facts{in, out, maybeIn, maybeOut}
+		}
+	}
+
+	reported := make(map[int]bool)
+	for b, block := range blocks {
+		if !reached[b] {
+			continue
+		}
+		stored, maybe := copySet(flow[b].in), copySet(flow[b].maybeIn)
+		for _, instr := range fn[block.start:block.end] {
+			for _, op := range []*Operand{instr.Src1, instr.Src2} {
+				sym, ok := localOperand(op, tracked)
+				if !ok || stored[sym.Offset] || reported[sym.Offset] {
+					continue
+				}
+				reported[sym.Offset] = true
+				how := "is"
+				if maybe[sym.Offset] {
+					how = "may be"
+				}
+				is.warn("-Wuninitialized", instr.Line, instr.Column, "in function '%s': '%s' %s used uninitialized",
+					is.currentFunc, sym.Name, how)
+			}
+			if offset, ok := storedLocal(instr, tracked); ok {
+				stored[offset] = true
+				maybe[offset] = true
+			}
+		}
+	}
+}
+
+// trackedLocals are the function's scalar locals whose address isn't
+// taken, by frame offset
+func (is *InstructionSelector) trackedLocals(fn []*IRInstruction) map[int]*Symbol {
+	tracked := make(map[int]*Symbol)
+	for _, sym := range is.allLocalVars {
+		if sym.ArraySize == 0 && !is.isStructType(sym.Type) {
+			tracked[sym.Offset] = sym
+		}
+	}
+	for _, instr := range fn {
+		if instr.Op == OpLoadAddr && instr.Src1 != nil && instr.Src1.Type == "var" && !instr.Src1.IsGlobal {
+			delete(tracked, instr.Src1.Offset)
+		}
+		for _, op := range []*Operand{instr.Dst, instr.Src1, instr.Src2} {
+			if op != nil && op.Type == "addr" && !op.IsGlobal {
+				delete(tracked, op.Offset)
+			}
+		}
+	}
+	return tracked
+}
+
+// localOperand is the tracked local op names, if it names one
+func localOperand(op *Operand, tracked map[int]*Symbol) (*Symbol, bool) {
+	if op == nil || op.Type != "var" || op.IsGlobal {
+		return nil, false
+	}
+	sym, ok := tracked[op.Offset]
+	return sym, ok
+}
+
+// storedLocal is the offset of the tracked local instr stores to, if any
+func storedLocal(instr *IRInstruction, tracked map[int]*Symbol) (int, bool) {
+	switch instr.Op {
+	case OpLabel, OpJmp, OpJz, OpJnz:
+		return 0, false
+	}
+	sym, ok := localOperand(instr.Dst, tracked)
+	if !ok {
+		return 0, false
+	}
+	return sym.Offset, true
+}
+
+// linePrefix is "line N: " for a known line, else nothing
+func linePrefix(line int) string {
+	if line <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("line %d: ", line)
+}
+
+func copySet(set map[int]bool) map[int]bool {
+	copied := make(map[int]bool, len(set))
+	for k := range set {
+		copied[k] = true
+	}
+	return copied
+}
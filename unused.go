@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Unused code (-Wunused-variable, -Wunused-function, -Wunreachable-code)
+// These are read off the IR as selected, before inlining or layout moves
+// anything:
+//
+//   - a local no instruction reads is reported at its declaration, as
+//     "unused variable" if nothing but its initializer stores to it and as
+//     "set but not used" if something else does. Taking its address, calling through it, or
+//     naming it in sizeof counts as a read.
+//   - a static function nothing refers to (by calling it or taking its
+//     address) outside its own body is reported at its definition.
+//   - code following a return or jump in the same basic block is reported
+//     once per block, at its line. The jumps and returns the selector adds
+//     itself (to skip an else, or to end a function) aren't code anyone
+//     wrote, and never count.
+
+// checkUnusedLocals reports the locals of the function whose IR starts at
+// instruction start that are never read
+func (is *InstructionSelector) checkUnusedLocals(start int) {
+	fn := is.instructions[start:]
+	read := make(map[*Symbol]bool)
+	stored := make(map[*Symbol]bool)
+	for _, instr := range fn {
+		for _, op := range []*Operand{instr.Src1, instr.Src2} {
+			for _, sym := range is.localsNamedBy(op) {
+				read[sym] = true
+			}
+		}
+		for _, sym := range is.localsNamedBy(instr.Dst) {
+			// Its initializer doesn't make it "set"
+			if instr.Line != sym.Line {
+				stored[sym] = true
+			}
+		}
+	}
+	var unused []*Symbol
+	for _, sym := range is.allLocalVars {
+		if !read[sym] && !is.inSizeof[sym] {
+			unused = append(unused, sym)
+		}
+	}
+	sortSymbolsByOffset(unused)
+	for _, sym := range unused {
+		msg := fmt.Sprintf("unused variable '%s'", sym.Name)
+		if stored[sym] {
+			msg = fmt.Sprintf("variable '%s' set but not used", sym.Name)
+		}
+		is.warn("-Wunused-variable", sym.Line, sym.Column, "in function '%s': %s", is.currentFunc, msg)
+	}
+}
+
+// localsNamedBy are the locals of the current function op refers to: the
+// one whose slot a var, array, address or frame operand falls in, or those
+// a label operand (a call through a function pointer) names
+func (is *InstructionSelector) localsNamedBy(op *Operand) []*Symbol {
+	if op == nil || op.IsGlobal {
+		return nil
+	}
+	var syms []*Symbol
+	for _, sym := range is.allLocalVars {
+		switch op.Type {
+		case "var", "array", "addr", "mem":
+			if op.Offset >= sym.Offset && op.Offset < sym.Offset+max(sym.Size, 1) {
+				syms = append(syms, sym)
+			}
+		case "label":
+			if op.Value == sym.Name {
+				syms = append(syms, sym)
+			}
+		}
+	}
+	return syms
+}
+
+// markSizeofOperands notes the locals a sizeof names: its operand isn't
+// evaluated, so they'd otherwise look unused
+func (is *InstructionSelector) markSizeofOperands(node *ASTNode) {
+	if node.Type == NodeIdentifier {
+		if sym, ok := is.localVars[node.VarName]; ok {
+			if is.inSizeof == nil {
+				is.inSizeof = make(map[*Symbol]bool)
+			}
+			is.inSizeof[sym] = true
+		}
+	}
+	for _, child := range node.Children {
+		if child != nil {
+			is.markSizeofOperands(child)
+		}
+	}
+}
+
+// sortSymbolsByOffset orders locals by declaration, which is down the frame
+func sortSymbolsByOffset(syms []*Symbol) {
+	for i := 1; i < len(syms); i++ {
+		for j := i; j > 0 && syms[j].Offset > syms[j-1].Offset; j-- {
+			syms[j], syms[j-1] = syms[j-1], syms[j]
+		}
+	}
+}
+
+// checkUnreachable reports code after a return or jump, in the function
+// whose IR starts at instruction start
+func (is *InstructionSelector) checkUnreachable(start int) {
+	fn := is.instructions[start:]
+	for _, block := range splitBlocks(fn) {
+		last := fn[block.end-1]
+		if last.Op != OpRet && last.Op != OpJmp && last.Op != OpTailCall {
+			continue
+		}
+		// The block ends at the jump; what follows it up to the next label
+		// is a block of its own with no way in
+		for i := block.end; i < len(fn) && fn[i].Op != OpLabel; i++ {
+			instr := fn[i]
+			if instr.Op == OpRet || instr.Op == OpJmp || instr.Line <= 0 || instr.Line < last.Line {
+				continue
+			}
+			is.warn("-Wunreachable-code", instr.Line, instr.Column, "in function '%s': code will never be executed", is.currentFunc)
+			break
+		}
+	}
+}
+
+// checkUnusedFunctions reports static functions the program defines but
+// never refers to outside their own bodies, unless an attribute says they
+// are used some other way
+func (is *InstructionSelector) checkUnusedFunctions(program *ASTNode) {
+	referenced := make(map[string]bool)
+	function := ""
+	for _, instr := range is.instructions {
+		if instr.Op == OpLabel && isFunctionLabel(instr.Dst.Value) {
+			function = instr.Dst.Value
+			continue
+		}
+		for _, op := range []*Operand{instr.Dst, instr.Src1, instr.Src2} {
+			if op != nil && op.Type == "label" && op.Value != function {
+				referenced[op.Value] = true
+			}
+		}
+	}
+	// Attributes on any declaration can keep a function: it's used, or
+	// runs before or after main
+	keptByAttribute := make(map[string]bool)
+	for _, node := range program.Children {
+		for _, name := range []string{"used", "unused", "constructor", "destructor"} {
+			if node.Type == NodeFunction && hasAttribute(node.Attributes, name) {
+				keptByAttribute[node.Name] = true
+			}
+		}
+	}
+	for _, node := range program.Children {
+		if node.Type != NodeFunction || len(node.Children) == 0 || referenced[node.Name] || keptByAttribute[node.Name] {
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(node.ReturnType), "static ") {
+			is.warn("-Wunused-function", node.Line, node.Column, "'%s' defined but not used", node.Name)
+		}
+	}
+}
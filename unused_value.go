@@ -0,0 +1,71 @@
+package main
+
+import "strings"
+
+// Unused values (-Wunused-value, on by default)
+// An expression statement is there for what it does, so one that does
+// nothing is almost always a mistake: x == 5; meant as x = 5;, or a call
+// missing its parentheses. A statement whose expression calls nothing,
+// assigns nothing, increments or decrements nothing and reads nothing
+// volatile is reported:
+//
+//	statement with no effect
+//
+// A cast to void says the value is dropped on purpose, and isn't reported,
+// and neither is a name the checker can't see the declaration of.
+// A statement expression used as a statement does whatever its statements
+// do, and the last of them, its value, isn't a statement of its own.
+
+// checkUnusedValue reports an expression statement with no effect
+func (tc *TypeChecker) checkUnusedValue(stmt *ASTNode) {
+	if len(stmt.Children) == 0 || tc.stmtExprValues[stmt] {
+		return
+	}
+	expr := stmt.Children[0]
+	if expr.Type == NodeBlock {
+		if n := len(expr.Children); n > 0 {
+			tc.stmtExprValues[expr.Children[n-1]] = true
+		}
+		return
+	}
+	if expr.Type == NodeCast && expr.Operator != "implicit" && tc.kindOf(expr.DataType) == kindVoid {
+		return
+	}
+	if !tc.hasEffect(expr) {
+		tc.warnf(stmt, "-Wunused-value", "statement with no effect")
+	}
+}
+
+// hasEffect reports whether evaluating an expression does anything besides
+// compute its value
+func (tc *TypeChecker) hasEffect(node *ASTNode) bool {
+	if node == nil {
+		return false
+	}
+	switch node.Type {
+	case NodeCall, NodeAssignment, NodeBlock:
+		return true
+	case NodeUnaryOp:
+		switch node.Operator {
+		case "++", "--", "++_post", "--_post":
+			return true
+		}
+	case NodeSizeof:
+		// Its operand isn't evaluated
+		return false
+	case NodeIdentifier:
+		// A name the checker doesn't know (from a header, say) might be
+		// volatile
+		typ, ok := tc.lookup(node.VarName)
+		if _, constant := tc.enums[node.VarName]; constant && !ok {
+			return false
+		}
+		return !ok || strings.Contains(typ, "volatile")
+	}
+	for _, child := range node.Children {
+		if tc.hasEffect(child) {
+			return true
+		}
+	}
+	return false
+}
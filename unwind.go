@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Unwind tables
+// gdb's backtraces, perf's call graphs, glibc's backtrace() and C++
+// exceptions thrown through C code all find a frame's caller from the
+// function's call frame information (CFI): for each instruction, how to
+// compute the canonical frame address (the CFA, %rsp before the call that
+// got here) and where the return address and the saved registers are
+// relative to it. The emitter describes every function with GAS's .cfi_
+// directives, from which the assembler builds .eh_frame:
+//
+//	.cfi_startproc              at the function's label
+//	.cfi_def_cfa_offset 16      after pushq %rbp: the CFA is %rsp+16
+//	.cfi_offset 6, -16          and %rbp is saved at CFA-16
+//	.cfi_def_cfa_register 6     after movq %rsp, %rbp: the CFA is %rbp+16
+//	.cfi_offset 3, -40          a callee-saved register, pushed or in the red zone
+//	.cfi_def_cfa 7, 8           after the epilogue's popq %rbp
+//	.cfi_endproc                before .size
+//
+// An epilogue the body carries on after (an early return or a sibling
+// call) sits between .cfi_remember_state and .cfi_restore_state, so the
+// code after it is described as before it. A function without a frame
+// pointer (-fomit-frame-pointer) keeps the CFA on %rsp and follows every
+// move of %rsp. Registers are DWARF's numbers, as gcc writes them, which
+// read the same in Intel syntax.
+//
+// The built-in assembler turns the directives into each function's
+// unwindFrame: where it starts and ends in .text, and its DWARF call frame
+// instructions. The internal linker writes the program's frames to
+// .eh_frame, one CIE for all of them and an FDE each, and indexes them in
+// .eh_frame_hdr, which the PT_GNU_EH_FRAME segment points unwinders to.
+// Archive members' own .eh_frame is still left out.
+
+// dwarfRegs are the DWARF numbers of the x86-64 general-purpose registers
+var dwarfRegs = map[string]int{
+	"rax": 0, "rdx": 1, "rcx": 2, "rbx": 3, "rsi": 4, "rdi": 5, "rbp": 6, "rsp": 7,
+	"r8": 8, "r9": 9, "r10": 10, "r11": 11, "r12": 12, "r13": 13, "r14": 14, "r15": 15,
+}
+
+// dwarfReturnAddress is the DWARF column of the return address (%rip)
+const dwarfReturnAddress = 16
+
+// DWARF call frame instructions
+const (
+	dwCFAAdvanceLoc       = 0x40 // | delta
+	dwCFAOffset           = 0x80 // | register, then ULEB128 offset / data alignment
+	dwCFARestore          = 0xc0 // | register
+	dwCFAAdvanceLoc1      = 0x02
+	dwCFAAdvanceLoc2      = 0x03
+	dwCFAAdvanceLoc4      = 0x04
+	dwCFAUndefined        = 0x07
+	dwCFARememberState    = 0x0a
+	dwCFARestoreState     = 0x0b
+	dwCFADefCFA           = 0x0c
+	dwCFADefCFARegister   = 0x0d
+	dwCFADefCFAOffset     = 0x0e
+	dwCFAOffsetExtendedSF = 0x11
+)
+
+// cfaDataAlign is the data alignment factor: saved registers are
+// eightbytes apart
+const cfaDataAlign = -8
+
+// cfi writes a call frame directive
+func (ce *CodeEmitter) cfi(directive, format string, args ...any) {
+	ce.output.Add(NewDirective(directive, fmt.Sprintf(format, args...)))
+}
+
+// moveRSP records that %rsp moved down by n bytes (up, for a negative n),
+// which moves the CFA's offset from it when %rsp is what it's based on
+func (ce *CodeEmitter) moveRSP(n int) {
+	ce.cfa += n
+	if ce.noFrame {
+		ce.cfi(".cfi_def_cfa_offset", "%d", ce.cfa)
+	}
+}
+
+// savedAt records that reg is saved offset bytes from the CFA
+func (ce *CodeEmitter) savedAt(reg string, offset int) {
+	ce.cfi(".cfi_offset", "%d, %d", dwarfRegs[reg], offset)
+}
+
+// continuesAfter reports whether rest, the code after an epilogue, has
+// more of the function: anything but labels before the next function
+func continuesAfter(rest []*IRInstruction) bool {
+	for _, instr := range rest {
+		if instr.Op != OpLabel {
+			return true
+		}
+		if isFunctionLabel(instr.Dst.Value) {
+			return false
+		}
+	}
+	return false
+}
+
+// unwindFrame is one function's call frame information
+type unwindFrame struct {
+	Start, End uint64 // in .text
+	Program    []byte // call frame instructions, after the CIE's
+	loc        uint64 // where the last of them takes effect
+}
+
+// advance moves the frame's location to offset, if it isn't there yet
+func (f *unwindFrame) advance(offset uint64) {
+	delta := offset - f.loc
+	switch {
+	case delta == 0:
+		return
+	case delta < 0x40:
+		f.Program = append(f.Program, dwCFAAdvanceLoc|byte(delta))
+	case delta <= 0xff:
+		f.Program = append(f.Program, dwCFAAdvanceLoc1, byte(delta))
+	case delta <= 0xffff:
+		f.Program = encoderX86_64.Append(append(f.Program, dwCFAAdvanceLoc2), delta, 2)
+	default:
+		f.Program = encoderX86_64.Append(append(f.Program, dwCFAAdvanceLoc4), delta, 4)
+	}
+	f.loc = offset
+}
+
+// cfiDirective adds a .cfi_ directive in .text to the current function's
+// frame
+func (a *Assembler) cfiDirective(mi *MachineInstr) error {
+	offset := uint64(len(a.code))
+	if mi.Op == ".cfi_startproc" {
+		a.frame = &unwindFrame{Start: offset, loc: offset}
+		return nil
+	}
+	if a.frame == nil {
+		return fmt.Errorf("%s without .cfi_startproc", mi.Op)
+	}
+	if mi.Op == ".cfi_endproc" {
+		a.frame.End = offset
+		a.frames = append(a.frames, a.frame)
+		a.frame = nil
+		return nil
+	}
+
+	var args []int
+	if strings.TrimSpace(mi.Args) != "" {
+		for _, field := range strings.Split(mi.Args, ",") {
+			field = strings.TrimPrefix(strings.TrimSpace(field), "%")
+			if reg, ok := dwarfRegs[field]; ok {
+				args = append(args, reg)
+				continue
+			}
+			n, err := strconv.Atoi(field)
+			if err != nil {
+				return fmt.Errorf("bad operand '%s' to %s", field, mi.Op)
+			}
+			args = append(args, n)
+		}
+	}
+	want := map[string]int{
+		".cfi_def_cfa": 2, ".cfi_def_cfa_register": 1, ".cfi_def_cfa_offset": 1, ".cfi_offset": 2,
+		".cfi_restore": 1, ".cfi_undefined": 1, ".cfi_remember_state": 0, ".cfi_restore_state": 0,
+	}
+	n, ok := want[mi.Op]
+	if !ok {
+		return fmt.Errorf("unsupported directive %s", mi.Op)
+	}
+	if len(args) != n {
+		return fmt.Errorf("%s takes %d operands", mi.Op, n)
+	}
+
+	f := a.frame
+	f.advance(offset)
+	switch mi.Op {
+	case ".cfi_def_cfa":
+		f.Program = appendULEB128(appendULEB128(append(f.Program, dwCFADefCFA), uint64(args[0])), uint64(args[1]))
+	case ".cfi_def_cfa_register":
+		f.Program = appendULEB128(append(f.Program, dwCFADefCFARegister), uint64(args[0]))
+	case ".cfi_def_cfa_offset":
+		f.Program = appendULEB128(append(f.Program, dwCFADefCFAOffset), uint64(args[0]))
+	case ".cfi_offset":
+		if args[1]%cfaDataAlign == 0 && args[1] <= 0 && args[0] < 0x40 {
+			f.Program = appendULEB128(append(f.Program, dwCFAOffset|byte(args[0])), uint64(args[1]/cfaDataAlign))
+		} else {
+			f.Program = appendSLEB128(appendULEB128(append(f.Program, dwCFAOffsetExtendedSF), uint64(args[0])), int64(args[1]/cfaDataAlign))
+		}
+	case ".cfi_restore":
+		f.Program = append(f.Program, dwCFARestore|byte(args[0]))
+	case ".cfi_undefined":
+		f.Program = appendULEB128(append(f.Program, dwCFAUndefined), uint64(args[0]))
+	case ".cfi_remember_state":
+		f.Program = append(f.Program, dwCFARememberState)
+	case ".cfi_restore_state":
+		f.Program = append(f.Program, dwCFARestoreState)
+	}
+	return nil
+}
+
+func appendULEB128(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func appendSLEB128(b []byte, v int64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// buildEHFrame lays out .eh_frame and .eh_frame_hdr for frames, whose
+// offsets are from .text at textAddr, with the sections at frameAddr and
+// hdrAddr. Their sizes don't depend on the addresses.
+func buildEHFrame(enc ByteEncoder, frames []*unwindFrame, textAddr, frameAddr, hdrAddr uint64) (frame, hdr []byte) {
+	// The CIE: pointers are 4-byte pc-relative (DW_EH_PE_pcrel|sdata4), and
+	// at a function's entry the CFA is %rsp+8 with the return address at it
+	cie := []byte{1, 'z', 'R', 0}
+	cie = appendULEB128(cie, 1)
+	cie = appendSLEB128(cie, cfaDataAlign)
+	cie = appendULEB128(cie, dwarfReturnAddress)
+	cie = append(cie, 1, 0x1b)
+	cie = append(cie, dwCFADefCFA, byte(dwarfRegs["rsp"]), 8, dwCFAOffset|dwarfReturnAddress, 1)
+	frame = appendCFIRecord(enc, frame, 0, cie)
+
+	type entry struct{ start, fde uint64 }
+	var table []entry
+	for _, f := range frames {
+		at := uint64(len(frame))
+		// pc_begin, then pc_range and no augmentation data
+		body := enc.Append(nil, 0, 4)
+		body = enc.Append(body, f.End-f.Start, 4)
+		body = append(body, 0)
+		body = append(body, f.Program...)
+		frame = appendCFIRecord(enc, frame, uint32(at+4), body)
+		start := textAddr + f.Start
+		enc.Put(frame[at+8:], start-(frameAddr+at+8), 4)
+		table = append(table, entry{start, frameAddr + at})
+	}
+	frame = enc.Append(frame, 0, 4)
+
+	// The header: .eh_frame's address (pcrel|sdata4), the number of FDEs
+	// (udata4) and a table of (start, FDE) sorted by start (datarel|sdata4)
+	sort.Slice(table, func(i, j int) bool { return table[i].start < table[j].start })
+	hdr = []byte{1, 0x1b, 0x03, 0x3b}
+	hdr = enc.Append(hdr, frameAddr-(hdrAddr+4), 4)
+	hdr = enc.Append(hdr, uint64(len(table)), 4)
+	for _, e := range table {
+		hdr = enc.Append(hdr, e.start-hdrAddr, 4)
+		hdr = enc.Append(hdr, e.fde-hdrAddr, 4)
+	}
+	return frame, hdr
+}
+
+// appendCFIRecord appends a CIE (id 0) or FDE (id the distance back to
+// the CIE), padded to eight bytes with DW_CFA_nop
+func appendCFIRecord(enc ByteEncoder, b []byte, id uint32, body []byte) []byte {
+	length := roundUp(8+len(body), 8) - 4
+	b = enc.Append(b, uint64(length), 4)
+	b = enc.Append(b, uint64(id), 4)
+	b = append(b, body...)
+	return append(b, make([]byte, length-4-len(body))...)
+}
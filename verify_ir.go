@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IR verifier
+// Selection bugs used to surface only as assembler errors about the output
+// ("memory-to-memory move not supported"), far from their cause. The IR is
+// checked twice instead, once selection (with inlining and the other IR
+// passes) is done and again after register allocation, and the first
+// instruction that breaks an invariant stops the compile with where it was
+// selected from (see provenance.go):
+//
+//   - every label is defined once, and every jump goes to one of them
+//   - before allocation, at most one operand of an instruction is in memory
+//     (a variable, an array element, a frame slot or what a pointer points
+//     at), apart from the moves and copies the emitter splits through a
+//     scratch register. Spilled temps are in memory too, so afterwards it's
+//     the emitter's business.
+//   - before allocation, a temp is only read after some instruction
+//     (earlier in its function) has written it; after allocation there are
+//     no temps left
+//   - every call lists the registers it clobbers, which is how the
+//     allocator knows what a temp live across it can't be kept in
+//   - after allocation, a call's arguments are placed by moves that never
+//     read a register an earlier move for the same call has written. Every
+//     argument is evaluated before the first move, and the allocator keeps
+//     temps that are still to be passed out of the registers placed before
+//     them, so the moves in order are the parallel copy the call needs.
+//
+// Code between a return or jump and the next label can't run (a sibling
+// call leaves the result copy after it, for one) and isn't checked.
+
+// verifyIR checks instrs; allocated says register allocation has run
+func verifyIR(instrs []*IRInstruction, allocated bool) error {
+	stage := "after selection"
+	if allocated {
+		stage = "after register allocation"
+	}
+	fail := func(instr *IRInstruction, format string, args ...interface{}) error {
+		return fmt.Errorf("internal compiler error: IR verifier (%s): %s: %s: %s",
+			stage, instr.origin(), strings.TrimSpace(instr.String()), fmt.Sprintf(format, args...))
+	}
+
+	labels := make(map[string]bool)
+	for _, instr := range instrs {
+		if instr.Op != OpLabel {
+			continue
+		}
+		if labels[instr.Dst.Value] {
+			return fail(instr, "label defined more than once")
+		}
+		labels[instr.Dst.Value] = true
+	}
+
+	var defined map[string]bool
+	placed := make(map[string]bool) // Argument registers set by the moves just before
+	dead := false
+	for _, instr := range instrs {
+		switch instr.Op {
+		default:
+			placed = make(map[string]bool)
+		case OpSetArg:
+			for _, op := range []*Operand{instr.Src1, instr.Src1.IndexTemp} {
+				if allocated && op != nil && op.Type == "reg" && placed[op.Value] {
+					return fail(instr, "argument read from %%%s after another argument was placed there", op.Value)
+				}
+			}
+			placed[instr.Dst.Value] = true
+		}
+		if instr.Op == OpLabel {
+			dead = false
+			if isFunctionLabel(instr.Dst.Value) {
+				defined = make(map[string]bool)
+			}
+			continue
+		}
+		if dead {
+			continue
+		}
+		switch instr.Op {
+		case OpJmp, OpJz, OpJnz:
+			if instr.Dst == nil || !labels[instr.Dst.Value] {
+				return fail(instr, "jump to an undefined label")
+			}
+		}
+		if instr.Op == OpJmp || instr.Op == OpRet || instr.Op == OpTailCall {
+			dead = true
+		}
+		if instr.Op == OpCall && len(instr.Clobbers) == 0 {
+			return fail(instr, "call doesn't list the registers it clobbers")
+		}
+		if !allocated && memoryOperands(instr) > 1 && !splitsThroughScratch(instr.Op) {
+			return fail(instr, "more than one memory operand")
+		}
+		for _, op := range []*Operand{instr.Src1, instr.Src2} {
+			for _, temp := range tempsIn(op) {
+				if allocated {
+					return fail(instr, "temp %s was never allocated", temp)
+				}
+				if !defined[temp] {
+					return fail(instr, "temp %s is used before it's defined", temp)
+				}
+			}
+		}
+		if instr.Dst != nil && instr.Op != OpLabel {
+			for _, temp := range tempsIn(instr.Dst) {
+				if allocated {
+					return fail(instr, "temp %s was never allocated", temp)
+				}
+				if instr.Dst.Type == "temp" {
+					defined[temp] = true
+				} else if !defined[temp] {
+					// An address or index the store goes through
+					return fail(instr, "temp %s is used before it's defined", temp)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isMemoryOperand reports whether op is in memory rather than a register,
+// an immediate or a label
+func isMemoryOperand(op *Operand) bool {
+	if op == nil {
+		return false
+	}
+	switch op.Type {
+	case "var", "mem", "array", "ptr":
+		return true
+	}
+	return false
+}
+
+// memoryOperands counts instr's operands in memory
+func memoryOperands(instr *IRInstruction) int {
+	n := 0
+	for _, op := range []*Operand{instr.Dst, instr.Src1, instr.Src2} {
+		if isMemoryOperand(op) {
+			n++
+		}
+	}
+	return n
+}
+
+// splitsThroughScratch reports whether the emitter moves op's operands
+// through a scratch register itself, so two of them may be in memory
+func splitsThroughScratch(op OpCode) bool {
+	switch op {
+	case OpMov, OpMovFloat, OpLoad, OpStore, OpSetArg, OpMemcpy, OpMemset, OpConvert, OpAtomicAdd, OpAtomicXchg,
+		OpPopcnt, OpClz, OpCtz, OpBswap:
+		return true
+	}
+	return false
+}
+
+// tempsIn are the temps op reads: itself, or the index or pointer an
+// array element or dereference is addressed through
+func tempsIn(op *Operand) []string {
+	if op == nil {
+		return nil
+	}
+	var temps []string
+	if op.Type == "temp" {
+		temps = append(temps, op.Value)
+	}
+	if op.IndexTemp != nil && op.IndexTemp != op {
+		temps = append(temps, tempsIn(op.IndexTemp)...)
+	}
+	return temps
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Native assembler verification
+// -verify-native links with gcc as usual, and in parallel runs the internal
+// assembler over the same assembly text. Instead of stopping at the first
+// failure it encodes every instruction and groups the failures by form
+// (mnemonic plus operand shapes), so real programs produce a worklist of
+// assembler gaps ordered by how often each form occurs.
+
+// EncodingGap is one instruction form the internal assembler can't encode
+type EncodingGap struct {
+	Form    string // e.g. "movl mem, reg"
+	Reason  string // encoder error for the first occurrence
+	Example string // first occurrence as printed
+	Count   int
+}
+
+// NativeVerifyReport summarizes one -verify-native run
+type NativeVerifyReport struct {
+	Instructions int // text-section instructions examined
+	Failed       int // instructions that couldn't be encoded
+	Gaps         []EncodingGap
+}
+
+// operandShape names the addressing form of an operand for gap grouping
+func operandShape(op MachineOperand) string {
+	prefix := ""
+	if op.Indirect {
+		prefix = "*"
+	}
+	switch op.Kind {
+	case MOpReg:
+		if strings.HasPrefix(op.Reg, "xmm") {
+			return prefix + "xmm"
+		}
+		return prefix + "reg"
+	case MOpImm:
+		return "imm"
+	case MOpMem:
+		if op.Reg == "rip" {
+			return prefix + "rip"
+		}
+		if op.Index != "" {
+			return prefix + "mem-indexed"
+		}
+		return prefix + "mem"
+	case MOpSymbol:
+		return prefix + "label"
+	}
+	return "?"
+}
+
+func instructionForm(mi *MachineInstr) string {
+	shapes := make([]string, len(mi.Operands))
+	for i, op := range mi.Operands {
+		shapes[i] = operandShape(op)
+	}
+	name := mi.Op
+	if mi.Prefix != "" {
+		name = mi.Prefix + " " + name
+	}
+	if len(shapes) == 0 {
+		return name
+	}
+	return name + " " + strings.Join(shapes, ", ")
+}
+
+// encodeChecked encodes one instruction, turning an encoder panic into an error
+func (a *Assembler) encodeChecked(mi *MachineInstr) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("encoder panic: %v", r)
+		}
+	}()
+	return a.encodeInstruction(mi)
+}
+
+// FindEncodingGaps encodes every text instruction once and reports the
+// forms that failed, most frequent first
+func (a *Assembler) FindEncodingGaps(instrs []*MachineInstr) *NativeVerifyReport {
+	report := &NativeVerifyReport{}
+	byForm := make(map[string]*EncodingGap)
+
+	a.longJumps = make(map[int]bool)
+	a.labelTargets = make(map[string]int)
+	a.symbols = make(map[string]uint64)
+	inText := true
+	for _, mi := range instrs {
+		switch mi.Kind {
+		case MDirective:
+			if sec, ok := sectionDirective(mi.Op, mi.Args); ok {
+				inText = sec == ".text"
+			}
+			continue
+		case MInstr:
+			if !inText {
+				continue
+			}
+		default:
+			continue
+		}
+
+		report.Instructions++
+		a.instrIndex = report.Instructions
+		err := a.encodeChecked(mi)
+		if err == nil {
+			continue
+		}
+		report.Failed++
+		form := instructionForm(mi)
+		gap, ok := byForm[form]
+		if !ok {
+			gap = &EncodingGap{Form: form, Reason: err.Error(), Example: strings.TrimSpace(mi.String())}
+			byForm[form] = gap
+		}
+		gap.Count++
+	}
+
+	for _, gap := range byForm {
+		report.Gaps = append(report.Gaps, *gap)
+	}
+	sort.Slice(report.Gaps, func(i, j int) bool {
+		if report.Gaps[i].Count != report.Gaps[j].Count {
+			return report.Gaps[i].Count > report.Gaps[j].Count
+		}
+		return report.Gaps[i].Form < report.Gaps[j].Form
+	})
+	return report
+}
+
+// VerifyNative runs the internal assembler over the generated assembly
+func (cp *CompilerPipeline) VerifyNative() *NativeVerifyReport {
+	return NewAssembler().FindEncodingGaps(cp.emitter.MachineInstrs())
+}
+
+// Print writes the worklist in priority order
+func (r *NativeVerifyReport) Print(w io.Writer) {
+	if r.Failed == 0 {
+		fmt.Fprintf(w, "verify-native: all %d instructions encoded by the internal assembler\n", r.Instructions)
+		return
+	}
+	fmt.Fprintf(w, "verify-native: %d of %d instructions can't be encoded (%d forms):\n",
+		r.Failed, r.Instructions, len(r.Gaps))
+	for _, gap := range r.Gaps {
+		fmt.Fprintf(w, "  %5d  %-28s %s\n", gap.Count, gap.Form, gap.Reason)
+		fmt.Fprintf(w, "         e.g. %s\n", gap.Example)
+	}
+}
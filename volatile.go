@@ -0,0 +1,141 @@
+package main
+
+import "strings"
+
+// Volatile
+// A volatile object can change, or be looked at, behind the program's back:
+// a memory-mapped register, a flag a signal handler sets, a local that has
+// to survive longjmp. Every read and write of one in the source has to
+// happen, exactly once and in source order, so the compiler may not cache
+// its value in a register, drop a store it thinks is dead or merge two loads.
+//
+// volatile is kept in the type strings parseType produces, as const is
+// (const.go): "volatile T" for a volatile object or pointee (volatile int,
+// volatile int*) and a trailing " volatile" for a volatile pointer
+// (int* volatile), inside any " const". Symbols record their own volatility
+// in IsVolatile and keep the pointee's in Type. Selection marks the memory
+// accesses of an expression that reads or writes a volatile object Volatile
+// (along with those computing its address, say loading p for *p: marking
+// too much only costs optimization), and passes over the IR keep marked
+// instructions as they are, where they are: inlining copies the mark, and
+// a pass that forwards, merges or deletes memory accesses has to leave
+// marked ones alone (-emit-ir shows them). Selection emits accesses in
+// source order and the emitter keeps that order; locals live in their
+// stack slots, so none is cached in a register.
+
+// isVolatileType reports whether an object of type typ is itself volatile.
+// Pointers are volatile only with a trailing " volatile"; a leading one is
+// the pointee's.
+func isVolatileType(typ string) bool {
+	typ = strings.TrimSuffix(strings.TrimSpace(typ), " const")
+	if strings.HasSuffix(typ, " volatile") {
+		return true
+	}
+	if strings.HasSuffix(typ, "*") {
+		return false
+	}
+	for _, word := range strings.Fields(typ) {
+		if word == "volatile" {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTopVolatile separates an object's own volatility from its type:
+// "int* volatile" -> ("int*", true), "volatile int" -> ("int", true),
+// "volatile int*" -> ("volatile int*", false). A trailing " const" is
+// expected to be split off already (splitTopConst).
+func splitTopVolatile(typ string) (string, bool) {
+	typ = strings.TrimSpace(typ)
+	if trimmed, ok := strings.CutSuffix(typ, " volatile"); ok {
+		return trimmed, true
+	}
+	if strings.HasSuffix(typ, "*") {
+		return typ, false
+	}
+	var words []string
+	volatile := false
+	for _, word := range strings.Fields(typ) {
+		if word == "volatile" {
+			volatile = true
+			continue
+		}
+		words = append(words, word)
+	}
+	return strings.Join(words, " "), volatile
+}
+
+// addVolatile qualifies typ itself: a prefix for objects, a suffix for
+// pointers (inside a trailing " const")
+func addVolatile(typ string) string {
+	if typ == "" || isVolatileType(typ) {
+		return typ
+	}
+	if base, ok := strings.CutSuffix(typ, " const"); ok {
+		return addVolatile(base) + " const"
+	}
+	if strings.HasSuffix(typ, "*") {
+		return typ + " volatile"
+	}
+	return "volatile " + typ
+}
+
+// trimTopQualifiers drops a pointer's own qualifiers: "char* volatile const"
+// -> "char*"
+func trimTopQualifiers(typ string) string {
+	typ = strings.TrimSpace(typ)
+	for {
+		trimmed := strings.TrimSuffix(strings.TrimSuffix(typ, " const"), " volatile")
+		if trimmed == typ {
+			return typ
+		}
+		typ = trimmed
+	}
+}
+
+// accessesVolatile reports whether node itself reads or writes a volatile
+// object, as opposed to only its operands doing so
+func (is *InstructionSelector) accessesVolatile(node *ASTNode) bool {
+	switch node.Type {
+	case NodeIdentifier, NodeArrayAccess, NodeMemberAccess:
+		return isVolatileType(is.exprType(node))
+	case NodeUnaryOp:
+		switch node.Operator {
+		case "*":
+			return isVolatileType(is.exprType(node))
+		case "++", "--", "++_post", "--_post":
+			return isVolatileType(is.exprType(node.Children[0]))
+		}
+	case NodeAssignment:
+		return isVolatileType(is.exprType(node.Children[0]))
+	}
+	return false
+}
+
+// markVolatile marks the memory accesses among the instructions selected
+// since start Volatile
+func (is *InstructionSelector) markVolatile(start int) {
+	for _, instr := range is.instructions[start:] {
+		if accessesMemory(instr) {
+			instr.Volatile = true
+		}
+	}
+}
+
+// accessesMemory reports whether instr reads or writes memory other than
+// through a call
+func accessesMemory(instr *IRInstruction) bool {
+	switch instr.Op {
+	case OpLoad, OpStore, OpMemcpy, OpMemset:
+		return true
+	case OpLoadAddr:
+		return false
+	}
+	for _, op := range []*Operand{instr.Dst, instr.Src1, instr.Src2} {
+		if op != nil && (op.Type == "var" || op.Type == "mem" || op.Type == "array" || op.Type == "ptr") {
+			return true
+		}
+	}
+	return false
+}
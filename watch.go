@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Watch mode
+// -watch builds the program, then polls the source and every header it
+// included and builds again whenever one of them changes, until
+// interrupted. Each build prints one status line on stderr, followed by
+// the full diagnostics the first time and afterwards only what changed:
+// "+ " before diagnostics that are new, "- " before those that went away.
+// With -run the program is run after each build that succeeds (with the
+// arguments after "--"); with -fsyntax-only nothing is built, which makes
+// a quick checker. Builds run in this one process, so the headers'
+// summaries are computed once and reused for as long as they don't change
+// (see header_summary.go), and the compile cache still answers for a
+// source that's back to a state it has been built in before.
+
+// watchInterval is how often the watched files are checked for changes
+const watchInterval = 250 * time.Millisecond
+
+// watchSettle is how long to wait after a change before building, so an
+// editor that saves in several writes is seen once it's done
+const watchSettle = 50 * time.Millisecond
+
+// watchedFiles maps each watched file to its modification time (zero if it
+// couldn't be read)
+type watchedFiles map[string]time.Time
+
+// runWatch builds and rebuilds until the process is interrupted
+func runWatch(cl *commandLine) {
+	var previous []string
+	for build := 1; ; build++ {
+		files := watchedFiles{}
+		files.add(cl.sourceFile)
+		diagnostics, result := watchBuild(cl, files)
+		printWatchStatus(os.Stderr, build, result, previous, diagnostics)
+		previous = diagnostics
+		if result.ok && cl.runMode && !cl.asmOnly && !cl.options.SyntaxOnly {
+			status, err := runBuiltProgram(result.output, cl.programArgs)
+			switch {
+			case err != nil:
+				fmt.Fprintf(os.Stderr, "[watch] can't run %s: %v\n", result.output, err)
+			case status != 0:
+				fmt.Fprintf(os.Stderr, "[watch] %s exited with status %d\n", result.output, status)
+			}
+		}
+		files.waitForChange()
+	}
+}
+
+// watchResult is how one build went
+type watchResult struct {
+	ok     bool
+	output string // what was written, if anything
+}
+
+// watchBuild compiles (and links, unless -S or -fsyntax-only) once, adding
+// the headers the source includes to files, and returns the diagnostics:
+// the warnings, then the error that stopped the build if one did
+func watchBuild(cl *commandLine, files watchedFiles) ([]string, watchResult) {
+	source, err := os.ReadFile(cl.sourceFile)
+	if err != nil {
+		return []string{fmt.Sprintf("error: %v", err)}, watchResult{}
+	}
+	options := cl.options
+	options.SourceFile = cl.sourceFile
+	compiler := NewCompilerPipeline(string(source), options)
+	compiler.warningOutput = io.Discard
+
+	err = compiler.Compile()
+	if compiler.preprocessor != nil {
+		for _, path := range compiler.preprocessor.IncludedFiles() {
+			files.add(path)
+		}
+	}
+	result := watchResult{}
+	switch {
+	case err != nil:
+	case options.SyntaxOnly:
+	case cl.asmOnly:
+		result.output = cl.outputFile
+		if result.output == "" {
+			result.output = "output.s"
+		}
+		err = compiler.WriteAssembly(result.output)
+	default:
+		result.output = cl.outputFile
+		if result.output == "" {
+			result.output = "a.out"
+		}
+		err = compiler.Link(result.output)
+	}
+	if err == nil && cl.deps.write && result.output != "" {
+		err = writeDependencies(cl.deps, compiler, cl.sourceFile, result.output)
+	}
+	diagnostics := make([]string, 0, len(compiler.Warnings())+1)
+	for _, warning := range compiler.Warnings() {
+		diagnostics = append(diagnostics, "warning: "+warning.String())
+	}
+	if err != nil {
+		return append(diagnostics, "error: "+err.Error()), watchResult{}
+	}
+	result.ok = true
+	return diagnostics, result
+}
+
+// printWatchStatus reports a build: a status line, then every diagnostic
+// after the first build and only the changes after later ones
+func printWatchStatus(w io.Writer, build int, result watchResult, previous, current []string) {
+	added, removed := diagnosticDelta(previous, current)
+	status := "failed"
+	if result.ok {
+		status = "ok"
+		if result.output != "" {
+			status = "built " + result.output
+		}
+	}
+	counts := fmt.Sprintf("%d diagnostic(s)", len(current))
+	if build > 1 {
+		counts += fmt.Sprintf(", %d new, %d gone", len(added), len(removed))
+	}
+	fmt.Fprintf(w, "[watch %s] build %d: %s, %s\n", time.Now().Format("15:04:05"), build, status, counts)
+	if build == 1 {
+		for _, d := range current {
+			fmt.Fprintln(w, d)
+		}
+		return
+	}
+	for _, d := range removed {
+		fmt.Fprintln(w, "- "+d)
+	}
+	for _, d := range added {
+		fmt.Fprintln(w, "+ "+d)
+	}
+}
+
+// diagnosticDelta lists the diagnostics in current but not previous, and
+// those in previous but not current, each in its own order. A diagnostic
+// reported twice counts twice.
+func diagnosticDelta(previous, current []string) (added, removed []string) {
+	count := make(map[string]int)
+	for _, d := range previous {
+		count[d]++
+	}
+	for _, d := range current {
+		if count[d] > 0 {
+			count[d]--
+			continue
+		}
+		added = append(added, d)
+	}
+	for _, d := range previous {
+		if count[d] > 0 {
+			count[d]--
+			removed = append(removed, d)
+		}
+	}
+	return added, removed
+}
+
+// add starts watching path, as it is now
+func (f watchedFiles) add(path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	f[path] = modTime(path)
+}
+
+// waitForChange returns once some watched file was modified, created or
+// removed
+func (f watchedFiles) waitForChange() {
+	for {
+		time.Sleep(watchInterval)
+		for path, seen := range f {
+			if !modTime(path).Equal(seen) {
+				time.Sleep(watchSettle)
+				return
+			}
+		}
+	}
+}
+
+// modTime is path's modification time, or zero if it can't be read
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}